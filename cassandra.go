@@ -1,10 +1,12 @@
 package datastore
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gocql/gocql"
@@ -36,6 +38,25 @@ func (c *Cassandra) Reader() CassandraOperator {
 	return c.reader
 }
 
+// Name returns "cassandra/<profile>".
+func (c *Cassandra) Name() string {
+	return "cassandra/" + c.name
+}
+
+// Ping queries system.local through the writer session.
+func (c *Cassandra) Ping(ctx context.Context) error {
+	if c.writer == nil {
+		return ErrCassandraSessionUnavailable
+	}
+
+	return c.writer.Execute(ctx, "SELECT now() FROM system.local")
+}
+
+// Stats returns no metrics, gocql keeps no counters of its sessions.
+func (c *Cassandra) Stats() DataStoreStats {
+	return DataStoreStats{}
+}
+
 // Close closes all active sessions (both reader and writer).
 func (c *Cassandra) Close() {
 	if c.writer != nil {
@@ -49,13 +70,33 @@ func (c *Cassandra) Close() {
 // CassandraOp represents operations for a Cassandra database connection.
 type CassandraOp struct {
 	keyspace        string
-	meta            secret.CassandraMeta // Connection metadata from configuration
-	cluster         *gocql.ClusterConfig // Cassandra cluster configuration
-	session         *gocql.Session       // Lazy-loaded session
-	opLock          sync.Mutex           // Mutex to protect session initialization
+	meta            secret.CassandraMeta          // Connection metadata from configuration
+	cluster         *gocql.ClusterConfig          // Cassandra cluster configuration
+	session         atomic.Pointer[gocql.Session] // Lazy-loaded session, read without opLock
+	opLock          sync.Mutex                    // Mutex to protect session initialization
 	columnsMetadata map[string]CassandraColumnMetadata
 	columnMetaOnce  *sync.Once
+	metaLock        sync.RWMutex
+	// MaxRetryAttempt is the number of query retries, RetryPolicy.Attempts - 1 when 0
 	MaxRetryAttempt int
+	// RetryPolicy sets the delay between query retries
+	RetryPolicy RetryPolicy
+	// RetryIdempotentOnly retries only queries marked idempotent, a timed out write may have been applied
+	RetryIdempotentOnly bool
+	// RetryDowngradeConsistency lists the consistency levels used by the successive retries, the last one
+	// is kept for further retries
+	RetryDowngradeConsistency []gocql.Consistency
+
+	options CassandraOptions
+	// hostPolicy creates the host selection policy of each session
+	hostPolicy    func() gocql.HostSelectionPolicy
+	hostObservers []CassandraHostObserverFunc
+	observerLock  sync.RWMutex
+	// metadataRefreshInterval reloads the column metadata periodically while a session is open, 0 disables it
+	metadataRefreshInterval time.Duration
+	metadataRefreshStop     chan struct{}
+	// dns resolves the contact host again to reopen the session when its addresses change, see DefaultDNSRefreshInterval
+	dns *dnsResolver
 }
 
 func (c *CassandraOp) Keyspace() string {
@@ -68,6 +109,8 @@ func (c *CassandraOp) Config() *gocql.ClusterConfig {
 }
 
 func (c *CassandraOp) ColumnsMetadata() map[string]CassandraColumnMetadata {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
 	return c.columnsMetadata
 }
 
@@ -76,6 +119,26 @@ func (c *CassandraOp) SetMaxRetryAttempt(maxRetry int) {
 	c.MaxRetryAttempt = maxRetry
 }
 
+// SetSslOptions overrides the TLS options loaded from the secret, e.g. to supply a tls.Config with
+// in-memory certificates. nil disables TLS. The current session is closed so the next one uses them.
+func (c *CassandraOp) SetSslOptions(opts *gocql.SslOptions) {
+	c.cluster.SslOpts = opts
+	c.Close()
+}
+
+// SetDialer sets the dialer opening the connections of the sessions, e.g. through an SSH bastion or a SOCKS
+// proxy, TLS still applies on top of it. nil restores the gocql dialer. The current session is closed so the next
+// one uses it.
+func (c *CassandraOp) SetDialer(dial DialContextFunc) {
+	if dial == nil {
+		c.cluster.Dialer = nil
+	} else {
+		c.cluster.Dialer = dial
+	}
+
+	c.Close()
+}
+
 func (c *CassandraOp) Exec(f func(session *gocql.Session)) error {
 	if session, err := c.NewSession(); err == nil {
 		defer session.Close()
@@ -86,36 +149,49 @@ func (c *CassandraOp) Exec(f func(session *gocql.Session)) error {
 	}
 }
 
-func (c *CassandraOp) columnMetadataInitialize(session *gocql.Session) {
+// columnMetadataInitialize loads the column metadata of the keyspace and replaces the cached one.
+func (c *CassandraOp) columnMetadataInitialize(session *gocql.Session) error {
 	iter := session.Query("select keyspace_name, table_name, column_name, kind, type from system_schema.columns where keyspace_name=? order by table_name, column_name", c.keyspace).Iter()
-	columnMetadata := CassandraColumnMetadata{}
+	columnsMetadata := map[string]CassandraColumnMetadata{}
 	for {
 		var keyspaceName, tableName, columnName, columnKind, columnType string
-		if iter.Scan(&keyspaceName, &tableName, &columnName, &columnKind, &columnType) {
-			if columnMetadata.tableName == "" {
-				columnMetadata.keyspaceName = keyspaceName
-				columnMetadata.tableName = tableName
-				columnMetadata.Columns = map[string]CassandraColumnMetadataColumn{columnName: {Name: columnName, Kind: columnKind, Type: columnType}}
-			} else if columnMetadata.TableName() == tableName {
-				columnMetadata.Columns[columnName] = CassandraColumnMetadataColumn{Name: columnName, Kind: columnKind, Type: columnType}
-			} else {
-				columnMetadata = CassandraColumnMetadata{}
-				columnMetadata.keyspaceName = keyspaceName
-				columnMetadata.tableName = tableName
-				columnMetadata.Columns = map[string]CassandraColumnMetadataColumn{columnName: {Name: columnName, Kind: columnKind, Type: columnType}}
-			}
-		} else {
+		if !iter.Scan(&keyspaceName, &tableName, &columnName, &columnKind, &columnType) {
 			break
 		}
 
-		c.columnsMetadata[columnMetadata.TableName()] = columnMetadata
+		columnMetadata, ok := columnsMetadata[tableName]
+		if !ok {
+			columnMetadata = CassandraColumnMetadata{
+				keyspaceName: keyspaceName,
+				tableName:    tableName,
+				Columns:      map[string]CassandraColumnMetadataColumn{},
+			}
+		}
+
+		columnMetadata.Columns[columnName] = CassandraColumnMetadataColumn{Name: columnName, Kind: columnKind, Type: columnType}
+		columnsMetadata[tableName] = columnMetadata
 	}
+
+	if err := iter.Close(); err != nil {
+		kklogger.WarnJ("datastore:CassandraOp.columnMetadataInitialize", err.Error())
+		return err
+	}
+
+	c.metaLock.Lock()
+	c.columnsMetadata = columnsMetadata
+	c.metaLock.Unlock()
+	return nil
 }
 
 // NewSession creates and returns a new Cassandra session.
 // Returns nil if session creation fails.
 func (c *CassandraOp) NewSession() (*gocql.Session, error) {
-	session, err := c.cluster.CreateSession()
+	cluster := *c.cluster
+	if c.hostPolicy != nil {
+		cluster.PoolConfig.HostSelectionPolicy = &cassandraObservedHostPolicy{HostSelectionPolicy: c.hostPolicy(), op: c}
+	}
+
+	session, err := cluster.CreateSession()
 	if err != nil {
 		kklogger.ErrorJ("datastore:CassandraOp.NewSession", err.Error())
 		return nil, err
@@ -131,52 +207,83 @@ func (c *CassandraOp) NewSession() (*gocql.Session, error) {
 // Session returns the current Cassandra session, creating it if it doesn't exist.
 // Uses double-checked locking pattern for thread safety.
 func (c *CassandraOp) Session() *gocql.Session {
-	if c.session != nil && c.session.Closed() == false {
-		return c.session
+	if session := c.session.Load(); session != nil && session.Closed() == false {
+		c.refreshDNS()
+		return session
 	}
 
 	c.opLock.Lock()
 	defer c.opLock.Unlock()
-	var err error
-	c.session, err = c.NewSession()
+	if session := c.session.Load(); session != nil && session.Closed() == false {
+		return session
+	}
+
+	// The reload of a session closed elsewhere stops at its next tick, it must not hold back the new one
+	c.stopMetadataRefresh()
+	session, err := c.NewSession()
 	if err != nil {
 		return nil
 	}
 
-	return c.session
+	c.session.Store(session)
+	c.startMetadataRefresh()
+	return session
 }
 
 // Close safely closes the current session if it exists.
 func (c *CassandraOp) Close() {
-	if c.session != nil && c.session.Closed() == false {
-		c.opLock.Lock()
-		defer c.opLock.Unlock()
-		c.session.Close()
-		c.session = nil
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+	if session := c.session.Load(); session != nil && session.Closed() == false {
+		c.stopMetadataRefresh()
+		session.Close()
+		c.session.Store(nil)
+		c.metaLock.Lock()
 		c.columnsMetadata = map[string]CassandraColumnMetadata{}
+		c.metaLock.Unlock()
 		c.columnMetaOnce = &sync.Once{}
 	}
 }
 
+// refreshDNS resolves the contact host in the background at most once per DefaultDNSRefreshInterval. When its
+// addresses changed, the session is closed and the next Session() opens a new one.
+func (c *CassandraOp) refreshDNS() {
+	if c.dns == nil || !c.dns.due(time.Now()) {
+		return
+	}
+
+	go func() {
+		changed, err := c.dns.resolve(context.Background())
+		if err != nil {
+			kklogger.WarnJ("datastore:CassandraOp.refreshDNS", fmt.Sprintf("resolve %s: %s", c.dns.host, err.Error()))
+			return
+		}
+
+		if changed {
+			kklogger.InfoJ("datastore:CassandraOp.refreshDNS", fmt.Sprintf("%s addresses changed, reopening the session", c.dns.host))
+			c.Close()
+		}
+	}()
+}
+
 func (c *CassandraOp) ObserveConnect(connect gocql.ObservedConnect) {
+	event := CassandraHostEvent{
+		Type:       CassandraHostConnected,
+		Host:       connect.Host.ConnectAddressAndPort(),
+		DataCenter: connect.Host.DataCenter(),
+		Rack:       connect.Host.Rack(),
+		Latency:    connect.End.Sub(connect.Start),
+		Err:        connect.Err,
+	}
+
 	if connect.Err != nil {
+		event.Type = CassandraHostConnectFailed
 		kklogger.WarnJ("datastore:CassandraOp.ObserveConnect", connect.Err.Error())
 	} else {
 		kklogger.DebugJ("datastore:CassandraOp.ObserveConnect", fmt.Sprintf("new connection to %s", connect.Host))
 	}
-}
-
-func (c *CassandraOp) Attempt(query gocql.RetryableQuery) bool {
-	eval := query.Attempts() < c.MaxRetryAttempt
-	if eval {
-		time.Sleep(time.Millisecond * 100)
-	}
-
-	return eval
-}
 
-func (c *CassandraOp) GetRetryType(err error) gocql.RetryType {
-	return gocql.RetryNextHost
+	c.notifyHostObservers(event)
 }
 
 // configureCassandraOp creates and configures a CassandraOp with the provided metadata.
@@ -186,10 +293,17 @@ func configureCassandraOp(meta secret.CassandraMeta) *CassandraOp {
 		meta:            meta,
 		columnsMetadata: map[string]CassandraColumnMetadata{},
 		columnMetaOnce:  &sync.Once{},
+		RetryPolicy:     DefaultCassandraRetryPolicy,
+
+		RetryIdempotentOnly:       DefaultCassandraRetryIdempotentOnly,
+		RetryDowngradeConsistency: DefaultCassandraRetryDowngradeConsistency,
+
+		metadataRefreshInterval: DefaultCassandraMetadataRefreshInterval,
 	}
 
 	// Configure the cluster
 	op.configureCluster()
+	op.dns = newDNSResolver(op.cluster.Hosts[0])
 
 	return op
 }
@@ -203,8 +317,13 @@ func (c *CassandraOp) configureCluster() {
 		Password: c.meta.Password,
 	}
 
-	if c.meta.CaPath != "" {
-		c.cluster.SslOpts = &gocql.SslOptions{CaPath: c.meta.CaPath, EnableHostVerification: false}
+	if c.meta.TLSEnabled() {
+		c.cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 c.meta.CaPath,
+			CertPath:               c.meta.CertPath,
+			KeyPath:                c.meta.KeyPath,
+			EnableHostVerification: c.meta.EnableHostVerification,
+		}
 	}
 
 	c.cluster.ProtoVersion = 3
@@ -216,6 +335,26 @@ func (c *CassandraOp) configureCluster() {
 	c.cluster.Keyspace = c.meta.Keyspace
 	c.cluster.ConnectObserver = c
 	c.cluster.RetryPolicy = c
+	if DefaultCassandraPreparedStatementCacheSize > 0 {
+		c.cluster.MaxPreparedStmts = DefaultCassandraPreparedStatementCacheSize
+	}
+
+	if DefaultCassandraDialer != nil {
+		c.cluster.Dialer = DefaultCassandraDialer
+	}
+
+	c.hostPolicy = cassandraHostPolicyWithMeta(c.meta)
+	if c.meta.LocalDC != "" && c.meta.LocalDCOnly {
+		c.cluster.HostFilter = gocql.DataCentreHostFilter(c.meta.LocalDC)
+	}
+
+	c.options = CassandraOptions{
+		Consistency:       c.cluster.Consistency,
+		SerialConsistency: c.cluster.SerialConsistency,
+		PageSize:          c.cluster.PageSize,
+		Timeout:           c.cluster.Timeout,
+		ConnectTimeout:    c.cluster.ConnectTimeout,
+	}
 }
 
 type CassandraColumnMetadata struct {
@@ -288,8 +427,12 @@ func NewCassandra(profileName string) *Cassandra {
 	}
 
 	// Configure writer and reader operations
-	csd.writer = configureCassandraOp(profile.Writer)
-	csd.reader = configureCassandraOp(profile.Reader)
+	writer := configureCassandraOp(profile.Writer)
+	writer.SetOptions(cassandraOptionsWithMeta(DefaultCassandraWriterOptions, profile.Writer))
+	reader := configureCassandraOp(profile.Reader)
+	reader.SetOptions(cassandraOptionsWithMeta(DefaultCassandraReaderOptions, profile.Reader))
+	csd.writer = writer
+	csd.reader = reader
 
 	return csd
 }
@@ -0,0 +1,192 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+)
+
+// DefaultCassandraBatchMaxStatements is the maximum number of statements sent in one batch,
+// larger UNLOGGED and COUNTER batches are split.
+var DefaultCassandraBatchMaxStatements = 100
+
+// DefaultCassandraBatchMaxBytes is the approximate maximum size in bytes of the statements and binds sent
+// in one batch, larger UNLOGGED and COUNTER batches are split. It defaults to the server batch_size_fail_threshold of 50KB.
+var DefaultCassandraBatchMaxBytes = 50 * 1024
+
+func init() {
+	envInt("GOTH_DEFAULT_CASSANDRA_BATCH_MAX_STATEMENTS", &DefaultCassandraBatchMaxStatements)
+	envInt("GOTH_DEFAULT_CASSANDRA_BATCH_MAX_BYTES", &DefaultCassandraBatchMaxBytes)
+}
+
+// ErrCassandraBatchTooLarge is returned for a LOGGED batch over the size limits, splitting it would break its
+// atomicity.
+var ErrCassandraBatchTooLarge = errors.New("cassandra logged batch exceeds the batch limits")
+
+// CassandraBatchStmt is a statement with its binds executed as part of a batch.
+type CassandraBatchStmt struct {
+	Stmt  string
+	Binds []interface{}
+}
+
+// CassandraBatchOptions defines options for BatchWithOptions.
+type CassandraBatchOptions struct {
+	// Type is gocql.LoggedBatch (the zero value), gocql.UnloggedBatch or gocql.CounterBatch.
+	// A LOGGED batch over the size limits fails with ErrCassandraBatchTooLarge, the others are split.
+	Type gocql.BatchType
+	// MaxStatements overrides DefaultCassandraBatchMaxStatements when positive
+	MaxStatements int
+	// MaxBytes overrides DefaultCassandraBatchMaxBytes when positive
+	MaxBytes int
+}
+
+// Batch executes the statements as one LOGGED batch, ErrCassandraBatchTooLarge when over the default size limits.
+func (c *CassandraOp) Batch(ctx context.Context, stmts ...CassandraBatchStmt) error {
+	return c.BatchWithOptions(ctx, CassandraBatchOptions{}, stmts...)
+}
+
+// BatchWithOptions executes the statements as a batch of opts.Type. UNLOGGED and COUNTER batches are split by the
+// size limits, sent in order and execution stops at the first failed batch. A LOGGED batch over the limits fails
+// with ErrCassandraBatchTooLarge without executing any statement.
+func (c *CassandraOp) BatchWithOptions(ctx context.Context, opts CassandraBatchOptions, stmts ...CassandraBatchStmt) error {
+	if len(stmts) == 0 {
+		return nil
+	}
+
+	chunks, err := cassandraBatchChunks(stmts, opts)
+	if err != nil {
+		return err
+	}
+
+	session := c.Session()
+	if session == nil {
+		return ErrCassandraSessionUnavailable
+	}
+
+	for idx, chunk := range chunks {
+		batch := session.NewBatch(opts.Type).WithContext(ctx)
+		for _, stmt := range chunk {
+			batch.Query(stmt.Stmt, stmt.Binds...)
+		}
+
+		if err := session.ExecuteBatch(batch); err != nil {
+			return fmt.Errorf("cassandra batch %d/%d: %w", idx+1, len(chunks), err)
+		}
+	}
+
+	return nil
+}
+
+// NewBatch returns a builder accumulating statements for BatchWithOptions.
+func (c *CassandraOp) NewBatch(opts CassandraBatchOptions) *CassandraBatch {
+	return NewCassandraBatch(c, opts)
+}
+
+// CassandraBatch accumulates statements and executes them with the operator's BatchWithOptions.
+type CassandraBatch struct {
+	op    CassandraOperator
+	opts  CassandraBatchOptions
+	stmts []CassandraBatchStmt
+}
+
+// NewCassandraBatch returns a batch builder executing on op.
+func NewCassandraBatch(op CassandraOperator, opts CassandraBatchOptions) *CassandraBatch {
+	return &CassandraBatch{op: op, opts: opts}
+}
+
+// Add appends a statement to the batch.
+func (b *CassandraBatch) Add(stmt string, binds ...interface{}) *CassandraBatch {
+	b.stmts = append(b.stmts, CassandraBatchStmt{Stmt: stmt, Binds: binds})
+	return b
+}
+
+// Len returns the number of statements added.
+func (b *CassandraBatch) Len() int {
+	return len(b.stmts)
+}
+
+// Statements returns the statements added.
+func (b *CassandraBatch) Statements() []CassandraBatchStmt {
+	return b.stmts
+}
+
+// Exec executes the accumulated statements and resets the builder.
+func (b *CassandraBatch) Exec(ctx context.Context) error {
+	stmts := b.stmts
+	b.stmts = nil
+	return b.op.BatchWithOptions(ctx, b.opts, stmts...)
+}
+
+// cassandraBatchChunks returns the batches the statements are sent in, ErrCassandraBatchTooLarge when a LOGGED
+// batch needs more than one.
+func cassandraBatchChunks(stmts []CassandraBatchStmt, opts CassandraBatchOptions) ([][]CassandraBatchStmt, error) {
+	chunks := splitCassandraBatch(stmts, opts)
+	if opts.Type == gocql.LoggedBatch && len(chunks) > 1 {
+		size := 0
+		for _, stmt := range stmts {
+			size += cassandraBatchStmtSize(stmt)
+		}
+
+		return nil, fmt.Errorf("%w: %d statements, %d bytes", ErrCassandraBatchTooLarge, len(stmts), size)
+	}
+
+	return chunks, nil
+}
+
+// splitCassandraBatch splits the statements so each batch stays within the statement and size limits.
+// A statement larger than the size limit is sent in a batch of its own.
+func splitCassandraBatch(stmts []CassandraBatchStmt, opts CassandraBatchOptions) [][]CassandraBatchStmt {
+	maxStatements := opts.MaxStatements
+	if maxStatements <= 0 {
+		maxStatements = DefaultCassandraBatchMaxStatements
+	}
+
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultCassandraBatchMaxBytes
+	}
+
+	var chunks [][]CassandraBatchStmt
+	start, size := 0, 0
+	for idx, stmt := range stmts {
+		stmtSize := cassandraBatchStmtSize(stmt)
+		if idx > start && (idx-start >= maxStatements || (maxBytes > 0 && size+stmtSize > maxBytes)) {
+			chunks = append(chunks, stmts[start:idx])
+			start, size = idx, 0
+		}
+
+		size += stmtSize
+	}
+
+	return append(chunks, stmts[start:])
+}
+
+// cassandraBatchStmtSize estimates the bytes a statement adds to a batch.
+func cassandraBatchStmtSize(stmt CassandraBatchStmt) int {
+	size := len(stmt.Stmt)
+	for _, bind := range stmt.Binds {
+		switch v := bind.(type) {
+		case nil:
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		case bool, int8, uint8:
+			size++
+		case int16, uint16:
+			size += 2
+		case int32, uint32, float32:
+			size += 4
+		case int, int64, uint, uint64, float64:
+			size += 8
+		case gocql.UUID:
+			size += 16
+		default:
+			size += len(fmt.Sprint(v))
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"time"
+
+	"github.com/gocql/gocql"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// Host event types of CassandraHostEvent.
+const (
+	CassandraHostConnected     = "connected"
+	CassandraHostConnectFailed = "connect_failed"
+	CassandraHostAdded         = "added"
+	CassandraHostRemoved       = "removed"
+	CassandraHostUp            = "up"
+	CassandraHostDown          = "down"
+)
+
+// CassandraHostEvent describes a connection attempt or a host state change seen by a session.
+// A host coming back up after being down is reported as CassandraHostUp once gocql reconnects it.
+type CassandraHostEvent struct {
+	Type       string
+	Host       string
+	DataCenter string
+	Rack       string
+	// Latency is the dial duration of connection events
+	Latency time.Duration
+	// Err is the dial error of CassandraHostConnectFailed events
+	Err error
+}
+
+// CassandraHostObserverFunc is called for every host event, from gocql goroutines.
+type CassandraHostObserverFunc func(event CassandraHostEvent)
+
+// AddHostObserver registers fn to be called on connections and host state changes of the operator sessions.
+func (c *CassandraOp) AddHostObserver(fn CassandraHostObserverFunc) {
+	c.observerLock.Lock()
+	defer c.observerLock.Unlock()
+	c.hostObservers = append(c.hostObservers, fn)
+}
+
+// SetHostSelectionPolicy overrides the host selection policy built from the secret. gocql policies can not be
+// shared between sessions, so newPolicy is called for every session. The current session is closed so the next
+// one uses it.
+func (c *CassandraOp) SetHostSelectionPolicy(newPolicy func() gocql.HostSelectionPolicy) {
+	c.hostPolicy = newPolicy
+	c.Close()
+}
+
+func (c *CassandraOp) notifyHostObservers(event CassandraHostEvent) {
+	c.observerLock.RLock()
+	observers := c.hostObservers
+	c.observerLock.RUnlock()
+	for _, fn := range observers {
+		fn(event)
+	}
+}
+
+func (c *CassandraOp) notifyHostState(eventType string, host *gocql.HostInfo) {
+	c.notifyHostObservers(CassandraHostEvent{
+		Type:       eventType,
+		Host:       host.ConnectAddressAndPort(),
+		DataCenter: host.DataCenter(),
+		Rack:       host.Rack(),
+	})
+}
+
+// cassandraHostPolicyWithMeta returns the policy factory configured by the secret: round robin over all hosts,
+// DC-aware round robin preferring LocalDC when set, wrapped in a token-aware policy when TokenAware is set.
+func cassandraHostPolicyWithMeta(meta secret.CassandraMeta) func() gocql.HostSelectionPolicy {
+	return func() gocql.HostSelectionPolicy {
+		policy := gocql.RoundRobinHostPolicy()
+		if meta.LocalDC != "" {
+			policy = gocql.DCAwareRoundRobinPolicy(meta.LocalDC)
+		}
+
+		switch {
+		case meta.TokenAware && meta.ShuffleReplicas:
+			policy = gocql.TokenAwareHostPolicy(policy, gocql.ShuffleReplicas())
+		case meta.TokenAware:
+			policy = gocql.TokenAwareHostPolicy(policy)
+		}
+
+		return policy
+	}
+}
+
+// cassandraObservedHostPolicy forwards host state changes of the wrapped policy to the operator observers.
+type cassandraObservedHostPolicy struct {
+	gocql.HostSelectionPolicy
+	op *CassandraOp
+}
+
+func (p *cassandraObservedHostPolicy) AddHost(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.AddHost(host)
+	p.op.notifyHostState(CassandraHostAdded, host)
+}
+
+// AddHosts keeps the bulk insert of policies supporting it, e.g. the token-aware policy.
+func (p *cassandraObservedHostPolicy) AddHosts(hosts []*gocql.HostInfo) {
+	if bulk, ok := p.HostSelectionPolicy.(interface{ AddHosts([]*gocql.HostInfo) }); ok {
+		bulk.AddHosts(hosts)
+	} else {
+		for _, host := range hosts {
+			p.HostSelectionPolicy.AddHost(host)
+		}
+	}
+
+	for _, host := range hosts {
+		p.op.notifyHostState(CassandraHostAdded, host)
+	}
+}
+
+func (p *cassandraObservedHostPolicy) RemoveHost(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.RemoveHost(host)
+	p.op.notifyHostState(CassandraHostRemoved, host)
+}
+
+func (p *cassandraObservedHostPolicy) HostUp(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.HostUp(host)
+	p.op.notifyHostState(CassandraHostUp, host)
+}
+
+func (p *cassandraObservedHostPolicy) HostDown(host *gocql.HostInfo) {
+	p.HostSelectionPolicy.HostDown(host)
+	p.op.notifyHostState(CassandraHostDown, host)
+}
+
+// Ready keeps the session start behavior of the wrapped policy, false waits for all hosts like without
+// a gocql.ReadyPolicy.
+func (p *cassandraObservedHostPolicy) Ready() bool {
+	if ready, ok := p.HostSelectionPolicy.(gocql.ReadyPolicy); ok {
+		return ready.Ready()
+	}
+
+	return false
+}
@@ -1,6 +1,8 @@
 package datastore
 
 import (
+	"context"
+
 	"github.com/gocql/gocql"
 	secret "github.com/yetiz-org/goth-datastore/secrets"
 )
@@ -8,6 +10,8 @@ import (
 // CassandraOperator defines the interface for Cassandra operations.
 // This interface allows for both real and mock implementations,
 // enabling comprehensive unit testing while maintaining API compatibility.
+// Storage layers should accept a CassandraOperator (or CassandraProvider) rather than *CassandraOp,
+// so tests can pass a *MockCassandraOp without type assertions.
 type CassandraOperator interface {
 	// Session management
 	Session() *gocql.Session
@@ -15,10 +19,27 @@ type CassandraOperator interface {
 	Close()
 	Exec(f func(session *gocql.Session)) error
 
+	// Queries
+	Query(ctx context.Context, stmt string, binds ...interface{}) *CassandraIter
+	Execute(ctx context.Context, stmt string, binds ...interface{}) error
+	PageIterator(ctx context.Context, opts CassandraPageOptions, stmt string, binds ...interface{}) *CassandraPageIterator
+
+	// Lightweight transactions
+	ExecuteLWT(ctx context.Context, stmt string, binds ...interface{}) (*CassandraLWTResult, error)
+	InsertIfNotExists(ctx context.Context, table string, row interface{}) (*CassandraLWTResult, error)
+	UpdateIf(ctx context.Context, table string, set, where, conditions CassandraRow) (*CassandraLWTResult, error)
+
+	// Batches
+	Batch(ctx context.Context, stmts ...CassandraBatchStmt) error
+	BatchWithOptions(ctx context.Context, opts CassandraBatchOptions, stmts ...CassandraBatchStmt) error
+	NewBatch(opts CassandraBatchOptions) *CassandraBatch
+
 	// Configuration access
 	Keyspace() string
 	Config() *gocql.ClusterConfig
 	ColumnsMetadata() map[string]CassandraColumnMetadata
+	TableMetadata(table string) (CassandraColumnMetadata, bool)
+	RefreshMetadata() error
 
 	// Configuration setters for testing
 	SetMaxRetryAttempt(maxRetry int)
@@ -32,3 +53,10 @@ type CassandraProvider interface {
 	Profile() secret.Cassandra
 	Close()
 }
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ CassandraOperator = (*CassandraOp)(nil)
+	_ CassandraOperator = (*MockCassandraOp)(nil)
+	_ CassandraProvider = (*Cassandra)(nil)
+)
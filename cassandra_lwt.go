@@ -0,0 +1,166 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrCassandraNotLWT is returned when a statement run as a lightweight transaction has no [applied] column.
+var ErrCassandraNotLWT = errors.New("cassandra: statement is not a lightweight transaction")
+
+// CassandraLWTResult is the outcome of a lightweight transaction.
+type CassandraLWTResult struct {
+	Applied bool
+	// Current holds the row returned with the result, the existing values when the transaction is not applied
+	Current CassandraRow
+}
+
+// Scan copies the returned row into dest, a pointer to a struct or map like for CassandraIter.Scan.
+func (r *CassandraLWTResult) Scan(dest interface{}) error {
+	return assignCassandraRow(dest, r.Current)
+}
+
+// ExecuteLWT runs a conditional INSERT, UPDATE or DELETE and parses its [applied] column and returned row.
+func (c *CassandraOp) ExecuteLWT(ctx context.Context, stmt string, binds ...interface{}) (*CassandraLWTResult, error) {
+	session := c.Session()
+	if session == nil {
+		return nil, ErrCassandraSessionUnavailable
+	}
+
+	iter := session.Query(stmt, binds...).WithContext(ctx).NoSkipMetadata().Iter()
+	row := map[string]interface{}{}
+	scanned := iter.MapScan(row)
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	if !scanned {
+		return nil, ErrCassandraNotLWT
+	}
+
+	return newCassandraLWTResult(row)
+}
+
+// InsertIfNotExists inserts row, a struct or map of column values, into table with IF NOT EXISTS.
+// The result holds the existing row when it is not applied.
+func (c *CassandraOp) InsertIfNotExists(ctx context.Context, table string, row interface{}) (*CassandraLWTResult, error) {
+	stmt, binds, err := cassandraInsertIfNotExistsStmt(table, row)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ExecuteLWT(ctx, stmt, binds...)
+}
+
+// UpdateIf sets the columns of the rows of table matching where, if the current values equal conditions.
+// The result holds the current values of the condition columns when it is not applied.
+func (c *CassandraOp) UpdateIf(ctx context.Context, table string, set, where, conditions CassandraRow) (*CassandraLWTResult, error) {
+	stmt, binds, err := cassandraUpdateIfStmt(table, set, where, conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ExecuteLWT(ctx, stmt, binds...)
+}
+
+func newCassandraLWTResult(row map[string]interface{}) (*CassandraLWTResult, error) {
+	applied, ok := row["[applied]"].(bool)
+	if !ok {
+		return nil, ErrCassandraNotLWT
+	}
+
+	delete(row, "[applied]")
+	return &CassandraLWTResult{Applied: applied, Current: row}, nil
+}
+
+func cassandraInsertIfNotExistsStmt(table string, row interface{}) (string, []interface{}, error) {
+	columns, values, err := cassandraRowColumns(row)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(columns) == 0 {
+		return "", nil, fmt.Errorf("cassandra: no columns to insert into %s", table)
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) IF NOT EXISTS", table, strings.Join(columns, ", "), placeholders)
+	return stmt, values, nil
+}
+
+func cassandraUpdateIfStmt(table string, set, where, conditions CassandraRow) (string, []interface{}, error) {
+	if len(set) == 0 || len(where) == 0 || len(conditions) == 0 {
+		return "", nil, fmt.Errorf("cassandra: UpdateIf on %s needs set, where and conditions", table)
+	}
+
+	var binds []interface{}
+	clause := func(row CassandraRow, sep string) string {
+		columns, values, _ := cassandraRowColumns(row)
+		binds = append(binds, values...)
+		for idx, column := range columns {
+			columns[idx] = column + " = ?"
+		}
+
+		return strings.Join(columns, sep)
+	}
+
+	stmt := fmt.Sprintf("UPDATE %s SET %s WHERE %s IF %s", table, clause(set, ", "), clause(where, " AND "), clause(conditions, " AND "))
+	return stmt, binds, nil
+}
+
+// cassandraRowColumns returns the columns and values of a struct or map, struct fields in declaration order
+// named like for CassandraIter.Scan, map keys sorted.
+func cassandraRowColumns(row interface{}) (columns []string, values []interface{}, err error) {
+	value := reflect.ValueOf(row)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, nil, fmt.Errorf("cassandra: row needs a map with string keys, got %T", row)
+		}
+
+		for _, key := range value.MapKeys() {
+			columns = append(columns, key.String())
+		}
+
+		sort.Strings(columns)
+		for _, column := range columns {
+			values = append(values, value.MapIndex(reflect.ValueOf(column).Convert(value.Type().Key())).Interface())
+		}
+
+		return columns, values, nil
+	case reflect.Struct:
+		var collect func(value reflect.Value)
+		collect = func(value reflect.Value) {
+			for idx := 0; idx < value.NumField(); idx++ {
+				field := value.Type().Field(idx)
+				tag := field.Tag.Get("cql")
+				switch {
+				case tag == "-":
+				case field.Anonymous && field.Type.Kind() == reflect.Struct && tag == "":
+					collect(value.Field(idx))
+				case !field.IsExported():
+				default:
+					if tag == "" {
+						tag = cassandraSnakeCase(field.Name)
+					}
+
+					columns = append(columns, tag)
+					values = append(values, value.Field(idx).Interface())
+				}
+			}
+		}
+
+		collect(value)
+		return columns, values, nil
+	default:
+		return nil, nil, fmt.Errorf("cassandra: row needs a struct or map, got %T", row)
+	}
+}
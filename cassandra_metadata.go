@@ -0,0 +1,83 @@
+package datastore
+
+import "time"
+
+// DefaultCassandraMetadataRefreshInterval reloads the column metadata of a CassandraOp periodically so
+// long-lived services notice ALTER TABLE changes, 0 loads it once per session.
+var DefaultCassandraMetadataRefreshInterval time.Duration
+
+func init() {
+	envMillis("GOTH_DEFAULT_CASSANDRA_METADATA_REFRESH_INTERVAL", &DefaultCassandraMetadataRefreshInterval)
+}
+
+// RefreshMetadata reloads the column metadata of the keyspace, e.g. after a schema change.
+func (c *CassandraOp) RefreshMetadata() error {
+	session := c.Session()
+	if session == nil {
+		return ErrCassandraSessionUnavailable
+	}
+
+	return c.columnMetadataInitialize(session)
+}
+
+// TableMetadata returns the column metadata of table in the operator keyspace.
+func (c *CassandraOp) TableMetadata(table string) (CassandraColumnMetadata, bool) {
+	c.metaLock.RLock()
+	defer c.metaLock.RUnlock()
+	metadata, ok := c.columnsMetadata[table]
+	return metadata, ok
+}
+
+// SetMetadataRefreshInterval sets the period of the background metadata reload, 0 disables it.
+// The reload runs while a session is open and restarts with the interval when one is.
+func (c *CassandraOp) SetMetadataRefreshInterval(interval time.Duration) {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+	c.stopMetadataRefresh()
+	c.metadataRefreshInterval = interval
+	if session := c.session.Load(); session != nil && !session.Closed() {
+		c.startMetadataRefresh()
+	}
+}
+
+// startMetadataRefresh starts the background reload of the current session, opLock must be held.
+func (c *CassandraOp) startMetadataRefresh() {
+	if c.metadataRefreshInterval <= 0 || c.metadataRefreshStop != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	c.metadataRefreshStop = stop
+	session := c.session.Load()
+	go func(interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if session.Closed() {
+					// Closed elsewhere, the next session starts its own reload
+					c.opLock.Lock()
+					if c.metadataRefreshStop == stop {
+						c.metadataRefreshStop = nil
+					}
+
+					c.opLock.Unlock()
+					return
+				}
+
+				c.columnMetadataInitialize(session)
+			}
+		}
+	}(c.metadataRefreshInterval)
+}
+
+// stopMetadataRefresh stops the background reload, opLock must be held.
+func (c *CassandraOp) stopMetadataRefresh() {
+	if c.metadataRefreshStop != nil {
+		close(c.metadataRefreshStop)
+		c.metadataRefreshStop = nil
+	}
+}
@@ -1,6 +1,7 @@
 package datastore
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -29,9 +30,14 @@ type MockCassandraOp struct {
 	newSessionResponse *gocql.Session
 	newSessionError    error
 	execError          error
+	queryRows          []CassandraRow
+	queryError         error
+	lwtResult          *CassandraLWTResult
+	lwtError           error
 	simulateFailure    bool
 	returnNilSession   bool
 	sessionClosed      bool
+	chaos              *mockChaos
 }
 
 // MockCassandraCall represents a recorded Cassandra operation call.
@@ -56,6 +62,8 @@ func NewMockCassandraOp() *MockCassandraOp {
 
 // Session returns the configured mock session.
 func (m *MockCassandraOp) Session() *gocql.Session {
+	chaosErr := m.injectChaos()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -66,9 +74,13 @@ func (m *MockCassandraOp) Session() *gocql.Session {
 		Result:    m.sessionResponse,
 		Error:     m.sessionError,
 	}
+	if chaosErr != nil {
+		call.Result = nil
+		call.Error = chaosErr
+	}
 	m.callHistory = append(m.callHistory, call)
 
-	if m.returnNilSession || m.simulateFailure {
+	if m.returnNilSession || m.simulateFailure || chaosErr != nil {
 		return nil
 	}
 
@@ -81,6 +93,8 @@ func (m *MockCassandraOp) Session() *gocql.Session {
 
 // NewSession creates a new mock session.
 func (m *MockCassandraOp) NewSession() (*gocql.Session, error) {
+	chaosErr := m.injectChaos()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -91,8 +105,16 @@ func (m *MockCassandraOp) NewSession() (*gocql.Session, error) {
 		Result:    m.newSessionResponse,
 		Error:     m.newSessionError,
 	}
+	if chaosErr != nil {
+		call.Result = nil
+		call.Error = chaosErr
+	}
 	m.callHistory = append(m.callHistory, call)
 
+	if chaosErr != nil {
+		return nil, chaosErr
+	}
+
 	if m.simulateFailure {
 		return nil, m.newSessionError
 	}
@@ -125,6 +147,8 @@ func (m *MockCassandraOp) Close() {
 
 // Exec executes a function with the mock session.
 func (m *MockCassandraOp) Exec(f func(session *gocql.Session)) error {
+	chaosErr := m.injectChaos()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -134,8 +158,15 @@ func (m *MockCassandraOp) Exec(f func(session *gocql.Session)) error {
 		Args:      []interface{}{},
 		Error:     m.execError,
 	}
+	if chaosErr != nil {
+		call.Error = chaosErr
+	}
 	m.callHistory = append(m.callHistory, call)
 
+	if chaosErr != nil {
+		return chaosErr
+	}
+
 	if m.execError != nil {
 		return m.execError
 	}
@@ -156,6 +187,192 @@ func (m *MockCassandraOp) Exec(f func(session *gocql.Session)) error {
 	return nil
 }
 
+// Query returns an iterator over the rows configured with SetQueryResponse.
+func (m *MockCassandraOp) Query(ctx context.Context, stmt string, binds ...interface{}) *CassandraIter {
+	chaosErr := m.injectChaos()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	err := m.queryError
+	if chaosErr != nil {
+		err = chaosErr
+	}
+
+	m.callHistory = append(m.callHistory, MockCassandraCall{
+		Timestamp: time.Now(),
+		Method:    "Query",
+		Args:      append([]interface{}{stmt}, binds...),
+		Result:    m.queryRows,
+		Error:     err,
+	})
+
+	if err != nil {
+		return NewCassandraIter(nil, err)
+	}
+
+	return NewCassandraIter(append([]CassandraRow(nil), m.queryRows...), nil)
+}
+
+// PageIterator returns an iterator paging over the rows configured with SetQueryResponse.
+// Each fetched page records a "PageIterator" call with the statement, page state and binds as arguments.
+func (m *MockCassandraOp) PageIterator(ctx context.Context, opts CassandraPageOptions, stmt string, binds ...interface{}) *CassandraPageIterator {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultCassandraReaderOptions.PageSize
+	}
+
+	return newCassandraPageIterator(opts.PageState, func(state []byte) *CassandraIter {
+		chaosErr := m.injectChaos()
+
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		err := m.queryError
+		if chaosErr != nil {
+			err = chaosErr
+		}
+
+		m.callHistory = append(m.callHistory, MockCassandraCall{
+			Timestamp: time.Now(),
+			Method:    "PageIterator",
+			Args:      append([]interface{}{stmt, state}, binds...),
+			Result:    m.queryRows,
+			Error:     err,
+		})
+
+		if err != nil {
+			return NewCassandraIter(nil, err)
+		}
+
+		return newCassandraStaticPage(m.queryRows, pageSize, state)
+	})
+}
+
+// Execute records the statement and returns the error configured with SetExecError.
+func (m *MockCassandraOp) Execute(ctx context.Context, stmt string, binds ...interface{}) error {
+	chaosErr := m.injectChaos()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	err := m.execError
+	if chaosErr != nil {
+		err = chaosErr
+	}
+
+	m.callHistory = append(m.callHistory, MockCassandraCall{
+		Timestamp: time.Now(),
+		Method:    "Execute",
+		Args:      append([]interface{}{stmt}, binds...),
+		Error:     err,
+	})
+
+	return err
+}
+
+// ExecuteLWT records the statement and returns the result configured with SetLWTResponse,
+// an applied result without row by default.
+func (m *MockCassandraOp) ExecuteLWT(ctx context.Context, stmt string, binds ...interface{}) (*CassandraLWTResult, error) {
+	chaosErr := m.injectChaos()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	err := m.lwtError
+	if chaosErr != nil {
+		err = chaosErr
+	}
+
+	result := &CassandraLWTResult{Applied: true, Current: CassandraRow{}}
+	if m.lwtResult != nil {
+		result = &CassandraLWTResult{Applied: m.lwtResult.Applied, Current: m.lwtResult.Current}
+	}
+
+	m.callHistory = append(m.callHistory, MockCassandraCall{
+		Timestamp: time.Now(),
+		Method:    "ExecuteLWT",
+		Args:      append([]interface{}{stmt}, binds...),
+		Result:    result,
+		Error:     err,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// InsertIfNotExists builds the INSERT statement and records it like ExecuteLWT.
+func (m *MockCassandraOp) InsertIfNotExists(ctx context.Context, table string, row interface{}) (*CassandraLWTResult, error) {
+	stmt, binds, err := cassandraInsertIfNotExistsStmt(table, row)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.ExecuteLWT(ctx, stmt, binds...)
+}
+
+// UpdateIf builds the UPDATE statement and records it like ExecuteLWT.
+func (m *MockCassandraOp) UpdateIf(ctx context.Context, table string, set, where, conditions CassandraRow) (*CassandraLWTResult, error) {
+	stmt, binds, err := cassandraUpdateIfStmt(table, set, where, conditions)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.ExecuteLWT(ctx, stmt, binds...)
+}
+
+// Batch records the statements like BatchWithOptions with default options.
+func (m *MockCassandraOp) Batch(ctx context.Context, stmts ...CassandraBatchStmt) error {
+	return m.BatchWithOptions(ctx, CassandraBatchOptions{}, stmts...)
+}
+
+// BatchWithOptions records one "Batch" call per batch the statements are split into, with the batch type
+// and statements as arguments, and returns the error configured with SetExecError. A LOGGED batch over the
+// limits returns ErrCassandraBatchTooLarge without recording a call.
+func (m *MockCassandraOp) BatchWithOptions(ctx context.Context, opts CassandraBatchOptions, stmts ...CassandraBatchStmt) error {
+	if len(stmts) == 0 {
+		return nil
+	}
+
+	chunks, err := cassandraBatchChunks(stmts, opts)
+	if err != nil {
+		return err
+	}
+
+	chaosErr := m.injectChaos()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	err = m.execError
+	if chaosErr != nil {
+		err = chaosErr
+	}
+
+	for _, chunk := range chunks {
+		m.callHistory = append(m.callHistory, MockCassandraCall{
+			Timestamp: time.Now(),
+			Method:    "Batch",
+			Args:      []interface{}{opts.Type, chunk},
+			Error:     err,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewBatch returns a batch builder executing on the mock.
+func (m *MockCassandraOp) NewBatch(opts CassandraBatchOptions) *CassandraBatch {
+	return NewCassandraBatch(m, opts)
+}
+
 // Keyspace returns the configured keyspace name.
 func (m *MockCassandraOp) Keyspace() string {
 	m.mutex.RLock()
@@ -209,7 +426,23 @@ func (m *MockCassandraOp) SetNewSessionResponse(session *gocql.Session, err erro
 	m.newSessionError = err
 }
 
-// SetExecError configures the Exec() method to return an error.
+// SetQueryResponse configures the rows and error returned by Query() and PageIterator().
+func (m *MockCassandraOp) SetQueryResponse(rows []CassandraRow, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.queryRows = rows
+	m.queryError = err
+}
+
+// SetLWTResponse configures the result and error returned by ExecuteLWT(), InsertIfNotExists() and UpdateIf().
+func (m *MockCassandraOp) SetLWTResponse(result *CassandraLWTResult, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lwtResult = result
+	m.lwtError = err
+}
+
+// SetExecError configures the Exec() and Execute() methods to return an error.
 func (m *MockCassandraOp) SetExecError(err error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -230,6 +463,35 @@ func (m *MockCassandraOp) SetConfig(config *gocql.ClusterConfig) {
 	m.mockConfig = config
 }
 
+// TableMetadata returns the metadata of table configured with SetColumnsMetadata.
+func (m *MockCassandraOp) TableMetadata(table string) (CassandraColumnMetadata, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	metadata, ok := m.mockColumnsMetadata[table]
+	return metadata, ok
+}
+
+// RefreshMetadata records the call, the metadata configured with SetColumnsMetadata is kept.
+func (m *MockCassandraOp) RefreshMetadata() error {
+	chaosErr := m.injectChaos()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	err := m.sessionError
+	if chaosErr != nil {
+		err = chaosErr
+	}
+
+	m.callHistory = append(m.callHistory, MockCassandraCall{
+		Timestamp: time.Now(),
+		Method:    "RefreshMetadata",
+		Error:     err,
+	})
+
+	return err
+}
+
 // SetColumnsMetadata sets the column metadata.
 func (m *MockCassandraOp) SetColumnsMetadata(metadata map[string]CassandraColumnMetadata) {
 	m.mutex.Lock()
@@ -244,6 +506,33 @@ func (m *MockCassandraOp) SimulateFailure(fail bool) {
 	m.simulateFailure = fail
 }
 
+// EnableChaos injects latency, random failures and outages into Session, NewSession and Exec as described by config.
+func (m *MockCassandraOp) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockCassandraOp) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockCassandraOp) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
 // SetReturnNilSession configures Session() to always return nil.
 func (m *MockCassandraOp) SetReturnNilSession(returnNil bool) {
 	m.mutex.Lock()
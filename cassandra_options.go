@@ -0,0 +1,120 @@
+package datastore
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// CassandraOptions are the query and connection defaults of a CassandraOp.
+type CassandraOptions struct {
+	Consistency gocql.Consistency
+	// SerialConsistency is used by lightweight transactions, 0 leaves it to the server
+	SerialConsistency gocql.SerialConsistency
+	PageSize          int
+	// Timeout bounds a single query, ConnectTimeout the initial connection to each host
+	Timeout        time.Duration
+	ConnectTimeout time.Duration
+}
+
+// DefaultCassandraWriterOptions are applied to the writer of NewCassandra, a typical setup uses QUORUM.
+var DefaultCassandraWriterOptions = CassandraOptions{
+	Consistency:    gocql.LocalQuorum,
+	PageSize:       5000,
+	Timeout:        11 * time.Second,
+	ConnectTimeout: 11 * time.Second,
+}
+
+// DefaultCassandraReaderOptions are applied to the reader of NewCassandra, a typical setup uses LOCAL_ONE.
+var DefaultCassandraReaderOptions = CassandraOptions{
+	Consistency:    gocql.LocalQuorum,
+	PageSize:       5000,
+	Timeout:        11 * time.Second,
+	ConnectTimeout: 11 * time.Second,
+}
+
+func init() {
+	envCassandraOptions("GOTH_DEFAULT_CASSANDRA_WRITER", &DefaultCassandraWriterOptions)
+	envCassandraOptions("GOTH_DEFAULT_CASSANDRA_READER", &DefaultCassandraReaderOptions)
+}
+
+// envCassandraOptions reads <prefix>_CONSISTENCY, _SERIAL_CONSISTENCY, _PAGE_SIZE, _TIMEOUT and _CONNECT_TIMEOUT,
+// timeouts in milliseconds.
+func envCassandraOptions(prefix string, dest *CassandraOptions) {
+	if v := os.Getenv(prefix + "_CONSISTENCY"); v != "" {
+		dest.Consistency = parseCassandraConsistency(v, dest.Consistency)
+	}
+
+	if v := os.Getenv(prefix + "_SERIAL_CONSISTENCY"); v != "" {
+		dest.SerialConsistency = parseCassandraSerialConsistency(v, dest.SerialConsistency)
+	}
+
+	envInt(prefix+"_PAGE_SIZE", &dest.PageSize)
+	envMillis(prefix+"_TIMEOUT", &dest.Timeout)
+	envMillis(prefix+"_CONNECT_TIMEOUT", &dest.ConnectTimeout)
+}
+
+func parseCassandraConsistency(value string, fallback gocql.Consistency) gocql.Consistency {
+	var consistency gocql.Consistency
+	if err := consistency.UnmarshalText([]byte(strings.ToUpper(strings.TrimSpace(value)))); err != nil {
+		kklogger.WarnJ("datastore:CassandraOptions", err.Error())
+		return fallback
+	}
+
+	return consistency
+}
+
+func parseCassandraSerialConsistency(value string, fallback gocql.SerialConsistency) gocql.SerialConsistency {
+	var consistency gocql.SerialConsistency
+	if err := consistency.UnmarshalText([]byte(strings.ToUpper(strings.TrimSpace(value)))); err != nil {
+		kklogger.WarnJ("datastore:CassandraOptions", err.Error())
+		return fallback
+	}
+
+	return consistency
+}
+
+// cassandraOptionsWithMeta overrides the options with the values set in the secret.
+func cassandraOptionsWithMeta(options CassandraOptions, meta secret.CassandraMeta) CassandraOptions {
+	if meta.Consistency != "" {
+		options.Consistency = parseCassandraConsistency(meta.Consistency, options.Consistency)
+	}
+
+	if meta.SerialConsistency != "" {
+		options.SerialConsistency = parseCassandraSerialConsistency(meta.SerialConsistency, options.SerialConsistency)
+	}
+
+	if meta.PageSize > 0 {
+		options.PageSize = meta.PageSize
+	}
+
+	if meta.Timeout > 0 {
+		options.Timeout = time.Duration(meta.Timeout) * time.Millisecond
+	}
+
+	if meta.ConnectTimeout > 0 {
+		options.ConnectTimeout = time.Duration(meta.ConnectTimeout) * time.Millisecond
+	}
+
+	return options
+}
+
+// Options returns the query and connection defaults of the operator.
+func (c *CassandraOp) Options() CassandraOptions {
+	return c.options
+}
+
+// SetOptions applies query and connection defaults to the cluster configuration.
+// Sessions created afterwards use them, queries can still override consistency and page size.
+func (c *CassandraOp) SetOptions(options CassandraOptions) {
+	c.options = options
+	c.cluster.Consistency = options.Consistency
+	c.cluster.SerialConsistency = options.SerialConsistency
+	c.cluster.PageSize = options.PageSize
+	c.cluster.Timeout = options.Timeout
+	c.cluster.ConnectTimeout = options.ConnectTimeout
+}
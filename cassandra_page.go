@@ -0,0 +1,168 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// CassandraPageOptions defines the paging of a PageIterator.
+type CassandraPageOptions struct {
+	// PageSize is the number of rows fetched per page, the operator page size when not positive
+	PageSize int
+	// PageState resumes the query from a state returned by NextPageState, nil starts from the first page
+	PageState []byte
+}
+
+// CassandraPageIterator iterates query results page by page, following the gocql page state.
+// Scan reads across pages transparently, NextPage reads a single page for stateless pagination, e.g.
+// an HTTP handler returning NextPageState to its client as a cursor.
+type CassandraPageIterator struct {
+	fetch   func(state []byte) *CassandraIter
+	page    *CassandraIter
+	state   []byte
+	started bool
+	err     error
+}
+
+// PageIterator runs a CQL statement on the operator session and returns an iterator fetching its rows
+// one page at a time. The iterator must be closed, its Close returns any query error.
+func (c *CassandraOp) PageIterator(ctx context.Context, opts CassandraPageOptions, stmt string, binds ...interface{}) *CassandraPageIterator {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = c.options.PageSize
+	}
+
+	return newCassandraPageIterator(opts.PageState, func(state []byte) *CassandraIter {
+		session := c.Session()
+		if session == nil {
+			return &CassandraIter{err: ErrCassandraSessionUnavailable}
+		}
+
+		query := session.Query(stmt, binds...).WithContext(ctx).PageSize(pageSize).PageState(state)
+		return &CassandraIter{iter: query.Iter()}
+	})
+}
+
+func newCassandraPageIterator(state []byte, fetch func(state []byte) *CassandraIter) *CassandraPageIterator {
+	return &CassandraPageIterator{fetch: fetch, state: state}
+}
+
+// Scan reads the next row into dest like CassandraIter.Scan, fetching the next page when the current one is
+// exhausted. It returns false when there are no more rows or on error, check Close for the error.
+func (p *CassandraPageIterator) Scan(dest interface{}) bool {
+	for p.err == nil {
+		if p.page == nil && !p.nextPage() {
+			return false
+		}
+
+		if p.page.Scan(dest) {
+			return true
+		}
+
+		p.closePage()
+	}
+
+	return false
+}
+
+// NextPage replaces the content of dest, a pointer to a slice like for CassandraIter.All, with the remaining
+// rows of the current page, or with the rows of the next page. dest is emptied when there are no more pages.
+func (p *CassandraPageIterator) NextPage(dest interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("cassandra: NextPage needs a pointer to a slice, got %T", dest)
+	}
+
+	slice.Elem().SetLen(0)
+	if p.err != nil {
+		return p.err
+	}
+
+	if p.page == nil && !p.nextPage() {
+		return p.err
+	}
+
+	page := p.page
+	p.page = nil
+	if err := page.All(dest); err != nil {
+		p.err = err
+	}
+
+	return p.err
+}
+
+// NextPageState returns the state resuming the query after the current page, nil once the last page is
+// fetched. Resuming skips rows of the current page that were not read yet.
+func (p *CassandraPageIterator) NextPageState() []byte {
+	return p.state
+}
+
+// HasNextPage reports whether another page can be fetched.
+func (p *CassandraPageIterator) HasNextPage() bool {
+	return p.err == nil && (!p.started || len(p.state) > 0)
+}
+
+// Close releases the current page and returns the query or scan error, if any.
+func (p *CassandraPageIterator) Close() error {
+	p.closePage()
+	return p.err
+}
+
+// nextPage fetches the page at the current state, it returns false when there is none or on error.
+func (p *CassandraPageIterator) nextPage() bool {
+	if !p.HasNextPage() {
+		return false
+	}
+
+	p.page = p.fetch(p.state)
+	p.started = true
+	p.state = p.page.PageState()
+	if p.page.err != nil {
+		p.closePage()
+		return false
+	}
+
+	return true
+}
+
+func (p *CassandraPageIterator) closePage() {
+	if p.page == nil {
+		return
+	}
+
+	if err := p.page.Close(); err != nil && p.err == nil {
+		p.err = err
+	}
+
+	p.page = nil
+}
+
+// newCassandraStaticPage returns the page of rows starting at the offset encoded in state,
+// the page state of mocked paging results.
+func newCassandraStaticPage(rows []CassandraRow, pageSize int, state []byte) *CassandraIter {
+	offset := 0
+	if len(state) > 0 {
+		var err error
+		if offset, err = strconv.Atoi(string(state)); err != nil || offset < 0 {
+			return NewCassandraIter(nil, fmt.Errorf("cassandra: invalid page state %q", state))
+		}
+	}
+
+	if offset > len(rows) {
+		offset = len(rows)
+	}
+
+	end := len(rows)
+	if pageSize > 0 && offset+pageSize < end {
+		end = offset + pageSize
+	}
+
+	iter := NewCassandraIter(append([]CassandraRow(nil), rows[offset:end]...), nil)
+	if end < len(rows) {
+		iter.pageState = []byte(strconv.Itoa(end))
+	}
+
+	return iter
+}
@@ -0,0 +1,9 @@
+package datastore
+
+// DefaultCassandraPreparedStatementCacheSize sizes the gocql prepared statement cache of the sessions of a
+// CassandraOp, the number of statement ids gocql keeps per session. 0 keeps the gocql default.
+var DefaultCassandraPreparedStatementCacheSize = 1000
+
+func init() {
+	envInt("GOTH_DEFAULT_CASSANDRA_PREPARED_STATEMENT_CACHE_SIZE", &DefaultCassandraPreparedStatementCacheSize)
+}
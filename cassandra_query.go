@@ -0,0 +1,319 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gocql/gocql"
+)
+
+// ErrCassandraSessionUnavailable is returned by Query and Execute when no session can be created.
+var ErrCassandraSessionUnavailable = errors.New("cassandra session not available")
+
+// CassandraRow is a result row keyed by column name, the row type of mocked query results.
+type CassandraRow map[string]interface{}
+
+// CassandraIter iterates query results, scanning rows into structs or maps.
+// Struct fields are matched to columns by the `cql` tag, or by their snake_case or lower-cased name.
+// A field tagged `cql:"-"` is skipped.
+type CassandraIter struct {
+	iter *gocql.Iter
+	rows []CassandraRow
+	pos  int
+	err  error
+	// pageState is the paging state of static rows
+	pageState []byte
+}
+
+// NewCassandraIter returns an iterator over static rows, used to mock query results.
+func NewCassandraIter(rows []CassandraRow, err error) *CassandraIter {
+	return &CassandraIter{rows: rows, err: err}
+}
+
+// Query runs a CQL statement on the operator session and returns an iterator over its rows.
+// The iterator must be closed, its Close returns any query error.
+func (c *CassandraOp) Query(ctx context.Context, stmt string, binds ...interface{}) *CassandraIter {
+	session := c.Session()
+	if session == nil {
+		return &CassandraIter{err: ErrCassandraSessionUnavailable}
+	}
+
+	return &CassandraIter{iter: session.Query(stmt, binds...).WithContext(ctx).Iter()}
+}
+
+// Execute runs a CQL statement without result rows, e.g. DDL, INSERT, UPDATE or DELETE.
+func (c *CassandraOp) Execute(ctx context.Context, stmt string, binds ...interface{}) error {
+	session := c.Session()
+	if session == nil {
+		return ErrCassandraSessionUnavailable
+	}
+
+	return session.Query(stmt, binds...).WithContext(ctx).Exec()
+}
+
+// Scan reads the next row into dest, a pointer to a struct or to a map[string]interface{}.
+// It returns false when there are no more rows or on error, check Close for the error.
+func (i *CassandraIter) Scan(dest interface{}) bool {
+	if i.err != nil {
+		return false
+	}
+
+	row, ok := i.next()
+	if !ok {
+		return false
+	}
+
+	if err := assignCassandraRow(dest, row); err != nil {
+		i.err = err
+		return false
+	}
+
+	return true
+}
+
+// All scans every remaining row into dest, a pointer to a slice of structs, struct pointers or maps,
+// and closes the iterator.
+func (i *CassandraIter) All(dest interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		i.Close()
+		return fmt.Errorf("cassandra: All needs a pointer to a slice, got %T", dest)
+	}
+
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	for {
+		elem := reflect.New(elemType)
+		if elemType.Kind() == reflect.Map {
+			elem.Elem().Set(reflect.MakeMap(elemType))
+		}
+
+		if !i.Scan(elem.Interface()) {
+			break
+		}
+
+		if isPtr {
+			slice.Set(reflect.Append(slice, elem))
+		} else {
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+
+	return i.Close()
+}
+
+// One scans the first row into dest and closes the iterator, gocql.ErrNotFound is returned without rows.
+func (i *CassandraIter) One(dest interface{}) error {
+	found := i.Scan(dest)
+	if err := i.Close(); err != nil {
+		return err
+	}
+
+	if !found {
+		return gocql.ErrNotFound
+	}
+
+	return nil
+}
+
+// PageState returns the paging state to resume the query from, nil for the last page.
+func (i *CassandraIter) PageState() []byte {
+	if i.iter == nil {
+		return i.pageState
+	}
+
+	return i.iter.PageState()
+}
+
+// Close releases the iterator and returns the query or scan error, if any.
+func (i *CassandraIter) Close() error {
+	if i.iter != nil {
+		if err := i.iter.Close(); err != nil && i.err == nil {
+			i.err = err
+		}
+
+		i.iter = nil
+	}
+
+	i.rows = nil
+	return i.err
+}
+
+func (i *CassandraIter) next() (CassandraRow, bool) {
+	if i.iter == nil {
+		if i.pos >= len(i.rows) {
+			return nil, false
+		}
+
+		i.pos++
+		return i.rows[i.pos-1], true
+	}
+
+	data, err := i.iter.RowData()
+	if err != nil {
+		i.err = err
+		return nil, false
+	}
+
+	if !i.iter.Scan(data.Values...) {
+		return nil, false
+	}
+
+	row := make(CassandraRow, len(data.Columns))
+	for idx, column := range data.Columns {
+		row[column] = reflect.ValueOf(data.Values[idx]).Elem().Interface()
+	}
+
+	return row, true
+}
+
+var cassandraStructFieldsCache sync.Map
+
+// cassandraStructFields maps column names to field indexes, including fields of embedded structs.
+func cassandraStructFields(t reflect.Type) map[string][]int {
+	if cached, ok := cassandraStructFieldsCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+
+	fields := map[string][]int{}
+	var collect func(t reflect.Type, index []int)
+	collect = func(t reflect.Type, index []int) {
+		for idx := 0; idx < t.NumField(); idx++ {
+			field := t.Field(idx)
+			fieldIndex := append(append([]int(nil), index...), idx)
+			tag := field.Tag.Get("cql")
+			if tag == "-" {
+				continue
+			}
+
+			if field.Anonymous && field.Type.Kind() == reflect.Struct && tag == "" {
+				collect(field.Type, fieldIndex)
+				continue
+			}
+
+			if !field.IsExported() {
+				continue
+			}
+
+			if tag != "" {
+				fields[tag] = fieldIndex
+				continue
+			}
+
+			for _, name := range []string{cassandraSnakeCase(field.Name), strings.ToLower(field.Name)} {
+				if _, ok := fields[name]; !ok {
+					fields[name] = fieldIndex
+				}
+			}
+		}
+	}
+
+	collect(t, nil)
+	cassandraStructFieldsCache.Store(t, fields)
+	return fields
+}
+
+func cassandraSnakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for idx, r := range runes {
+		if unicode.IsUpper(r) {
+			if idx > 0 && (unicode.IsLower(runes[idx-1]) || (idx+1 < len(runes) && unicode.IsLower(runes[idx+1]))) {
+				b.WriteByte('_')
+			}
+
+			r = unicode.ToLower(r)
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// assignCassandraRow copies the row into dest, columns without a matching field are ignored.
+func assignCassandraRow(dest interface{}, row CassandraRow) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("cassandra: scan needs a non-nil pointer, got %T", dest)
+	}
+
+	value = value.Elem()
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cassandra: scan needs a map with string keys, got %T", dest)
+		}
+
+		if value.IsNil() {
+			value.Set(reflect.MakeMap(value.Type()))
+		}
+
+		for column, data := range row {
+			v := reflect.ValueOf(data)
+			if !v.IsValid() {
+				v = reflect.Zero(value.Type().Elem())
+			} else if !v.Type().AssignableTo(value.Type().Elem()) {
+				return fmt.Errorf("cassandra: column %s of type %s can not be stored in %T", column, v.Type(), dest)
+			}
+
+			value.SetMapIndex(reflect.ValueOf(column), v)
+		}
+
+		return nil
+	case reflect.Struct:
+		fields := cassandraStructFields(value.Type())
+		for column, data := range row {
+			index, ok := fields[column]
+			if !ok {
+				continue
+			}
+
+			if err := setCassandraField(value.FieldByIndex(index), data); err != nil {
+				return fmt.Errorf("cassandra: column %s: %w", column, err)
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("cassandra: scan needs a pointer to a struct or map, got %T", dest)
+	}
+}
+
+func setCassandraField(field reflect.Value, data interface{}) error {
+	v := reflect.ValueOf(data)
+	if !v.IsValid() {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	target := field
+	if field.Kind() == reflect.Ptr && !v.Type().AssignableTo(field.Type()) {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+
+	switch {
+	case v.Type().AssignableTo(target.Type()):
+		target.Set(v)
+	case v.Type().ConvertibleTo(target.Type()) && v.Kind() != reflect.String && target.Kind() != reflect.String:
+		target.Set(v.Convert(target.Type()))
+	default:
+		return fmt.Errorf("%s is not assignable to %s", v.Type(), field.Type())
+	}
+
+	if target != field {
+		field.Set(target.Addr())
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultCassandraRetryIdempotentOnly makes new operators retry only queries marked idempotent.
+var DefaultCassandraRetryIdempotentOnly = false
+
+// DefaultCassandraRetryDowngradeConsistency lists the consistency levels of the successive retries of new
+// operators, empty keeps the query consistency.
+var DefaultCassandraRetryDowngradeConsistency []gocql.Consistency
+
+func init() {
+	envBool("GOTH_DEFAULT_CASSANDRA_RETRY_IDEMPOTENT_ONLY", &DefaultCassandraRetryIdempotentOnly)
+	if v := os.Getenv("GOTH_DEFAULT_CASSANDRA_RETRY_DOWNGRADE_CONSISTENCY"); v != "" {
+		DefaultCassandraRetryDowngradeConsistency = parseCassandraConsistencies(v)
+	}
+}
+
+// parseCassandraConsistencies parses a comma separated list of consistency names, invalid names are skipped.
+func parseCassandraConsistencies(value string) (levels []gocql.Consistency) {
+	for _, name := range strings.Split(value, ",") {
+		var consistency gocql.Consistency
+		if err := consistency.UnmarshalText([]byte(strings.ToUpper(strings.TrimSpace(name)))); err != nil {
+			kklogger.WarnJ("datastore:CassandraOp.RetryDowngradeConsistency", err.Error())
+			continue
+		}
+
+		levels = append(levels, consistency)
+	}
+
+	return
+}
+
+// Attempt implements gocql.RetryPolicy. It allows a retry while attempts are left and, with RetryIdempotentOnly,
+// the query is idempotent, then waits the RetryPolicy delay and downgrades the consistency if configured.
+func (c *CassandraOp) Attempt(query gocql.RetryableQuery) bool {
+	attempts := query.Attempts()
+	if attempts >= c.maxRetries() {
+		return false
+	}
+
+	if c.RetryIdempotentOnly {
+		if idempotent, ok := query.(interface{ IsIdempotent() bool }); !ok || !idempotent.IsIdempotent() {
+			return false
+		}
+	}
+
+	if delay := c.RetryPolicy.Delay(attempts); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		if ctx := query.Context(); ctx != nil {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-timer.C:
+			}
+		} else {
+			<-timer.C
+		}
+	}
+
+	if levels := c.RetryDowngradeConsistency; len(levels) > 0 && attempts > 0 {
+		if attempts > len(levels) {
+			attempts = len(levels)
+		}
+
+		query.SetConsistency(levels[attempts-1])
+	}
+
+	return true
+}
+
+// GetRetryType implements gocql.RetryPolicy. Timeouts are retried on the same host, errors the query itself
+// causes, like syntax or authorization errors, are returned and other errors are retried on the next host.
+func (c *CassandraOp) GetRetryType(err error) gocql.RetryType {
+	var requestErr gocql.RequestError
+	if !errors.As(err, &requestErr) {
+		return gocql.RetryNextHost
+	}
+
+	switch requestErr.Code() {
+	case gocql.ErrCodeReadTimeout, gocql.ErrCodeWriteTimeout:
+		return gocql.Retry
+	case gocql.ErrCodeSyntax, gocql.ErrCodeUnauthorized, gocql.ErrCodeInvalid, gocql.ErrCodeConfig,
+		gocql.ErrCodeAlreadyExists, gocql.ErrCodeCredentials, gocql.ErrCodeFunctionFailure, gocql.ErrCodeCASWriteUnknown:
+		return gocql.Rethrow
+	default:
+		return gocql.RetryNextHost
+	}
+}
+
+// maxRetries returns MaxRetryAttempt, or the retries of RetryPolicy when not set.
+func (c *CassandraOp) maxRetries() int {
+	if c.MaxRetryAttempt > 0 {
+		return c.MaxRetryAttempt
+	}
+
+	return c.RetryPolicy.Attempts - 1
+}
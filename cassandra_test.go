@@ -2,10 +2,15 @@ package datastore
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gocql/gocql"
 	"github.com/stretchr/testify/assert"
@@ -138,6 +143,32 @@ func TestCassandraOpBasic(t *testing.T) {
 		result = op.Attempt(q2)
 		assert.False(t, result)
 	})
+
+	t.Run("Session closed concurrently", func(t *testing.T) {
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"})
+		op.cluster.ConnectTimeout = 10 * time.Millisecond
+		session := &gocql.Session{}
+		op.session.Store(session)
+
+		// Close runs in the background on DNS changes, the fast path of Session must not see a half cleared session
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if s := op.Session(); s != nil {
+						assert.Same(t, session, s)
+					}
+				}
+			}()
+		}
+
+		op.Close()
+		wg.Wait()
+		assert.True(t, session.Closed())
+		assert.Nil(t, op.session.Load())
+	})
 }
 
 // TestNewCassandra tests creating a new Cassandra instance
@@ -368,3 +399,652 @@ func TestMockCassandraBuilder(t *testing.T) {
 		assert.Equal(t, profile, cass.Profile())
 	})
 }
+
+func TestMockCassandraOpChaos(t *testing.T) {
+	t.Run("Outage window", func(t *testing.T) {
+		mockOp := NewMockCassandraOp()
+		mockOp.EnableChaos(MockChaosConfig{Outages: []MockOutage{{Start: 0, Duration: time.Hour}}})
+
+		called := false
+		err := mockOp.Exec(func(session *gocql.Session) { called = true })
+		assert.Equal(t, ErrMockOutage, err)
+		assert.False(t, called)
+		assert.Nil(t, mockOp.Session())
+
+		_, err = mockOp.NewSession()
+		assert.Equal(t, ErrMockOutage, err)
+
+		mockOp.DisableChaos()
+		assert.NoError(t, mockOp.Exec(func(session *gocql.Session) { called = true }))
+		assert.True(t, called)
+	})
+
+	t.Run("Custom error", func(t *testing.T) {
+		customErr := errors.New("node unavailable")
+		mockOp := NewMockCassandraOp()
+		mockOp.EnableChaos(MockChaosConfig{ErrorRate: 1, Error: customErr})
+
+		assert.Equal(t, customErr, mockOp.Exec(func(session *gocql.Session) {}))
+	})
+}
+
+func TestCassandraOpTLS(t *testing.T) {
+	meta := secret.CassandraMeta{
+		Endpoints: []string{"127.0.0.1:9042"},
+		Keyspace:  "testkeyspace",
+	}
+
+	t.Run("Disabled without TLS settings", func(t *testing.T) {
+		op := configureCassandraOp(meta)
+		assert.Nil(t, op.cluster.SslOpts)
+	})
+
+	t.Run("From secret", func(t *testing.T) {
+		m := meta
+		m.CaPath = "/path/to/ca"
+		m.CertPath = "/path/to/cert"
+		m.KeyPath = "/path/to/key"
+		m.EnableHostVerification = true
+		op := configureCassandraOp(m)
+		if assert.NotNil(t, op.cluster.SslOpts) {
+			assert.Equal(t, "/path/to/ca", op.cluster.SslOpts.CaPath)
+			assert.Equal(t, "/path/to/cert", op.cluster.SslOpts.CertPath)
+			assert.Equal(t, "/path/to/key", op.cluster.SslOpts.KeyPath)
+			assert.True(t, op.cluster.SslOpts.EnableHostVerification)
+		}
+
+		m = meta
+		m.SSL = true
+		op = configureCassandraOp(m)
+		if assert.NotNil(t, op.cluster.SslOpts) {
+			assert.Empty(t, op.cluster.SslOpts.CaPath)
+			assert.False(t, op.cluster.SslOpts.EnableHostVerification)
+		}
+	})
+
+	t.Run("Programmatic override", func(t *testing.T) {
+		op := configureCassandraOp(meta)
+		opts := &gocql.SslOptions{Config: &tls.Config{ServerName: "cassandra.example.com"}, EnableHostVerification: true}
+		op.SetSslOptions(opts)
+		assert.Same(t, opts, op.Config().SslOpts)
+
+		op.SetSslOptions(nil)
+		assert.Nil(t, op.Config().SslOpts)
+	})
+}
+
+func TestCassandraOpOptions(t *testing.T) {
+	meta := secret.CassandraMeta{
+		Endpoints: []string{"127.0.0.1:9042"},
+		Keyspace:  "testkeyspace",
+	}
+
+	t.Run("Cluster defaults", func(t *testing.T) {
+		op := configureCassandraOp(meta)
+		assert.Equal(t, gocql.LocalQuorum, op.Options().Consistency)
+		assert.Equal(t, op.cluster.PageSize, op.Options().PageSize)
+		assert.Equal(t, op.cluster.Timeout, op.Options().Timeout)
+	})
+
+	t.Run("Set options", func(t *testing.T) {
+		op := configureCassandraOp(meta)
+		options := CassandraOptions{
+			Consistency:       gocql.LocalOne,
+			SerialConsistency: gocql.LocalSerial,
+			PageSize:          100,
+			Timeout:           time.Second,
+			ConnectTimeout:    2 * time.Second,
+		}
+
+		op.SetOptions(options)
+		assert.Equal(t, options, op.Options())
+		assert.Equal(t, gocql.LocalOne, op.Config().Consistency)
+		assert.Equal(t, gocql.LocalSerial, op.Config().SerialConsistency)
+		assert.Equal(t, 100, op.Config().PageSize)
+		assert.Equal(t, time.Second, op.Config().Timeout)
+		assert.Equal(t, 2*time.Second, op.Config().ConnectTimeout)
+	})
+
+	t.Run("Secret overrides", func(t *testing.T) {
+		m := meta
+		m.Consistency = "quorum"
+		m.SerialConsistency = "LOCAL_SERIAL"
+		m.PageSize = 200
+		m.Timeout = 1500
+		options := cassandraOptionsWithMeta(DefaultCassandraWriterOptions, m)
+		assert.Equal(t, gocql.Quorum, options.Consistency)
+		assert.Equal(t, gocql.LocalSerial, options.SerialConsistency)
+		assert.Equal(t, 200, options.PageSize)
+		assert.Equal(t, 1500*time.Millisecond, options.Timeout)
+		assert.Equal(t, DefaultCassandraWriterOptions.ConnectTimeout, options.ConnectTimeout)
+
+		m.Consistency = "invalid"
+		assert.Equal(t, DefaultCassandraWriterOptions.Consistency, cassandraOptionsWithMeta(DefaultCassandraWriterOptions, m).Consistency)
+	})
+
+	t.Run("Env overrides", func(t *testing.T) {
+		t.Setenv("_TEST_GOTH_CASSANDRA_CONSISTENCY", "LOCAL_ONE")
+		t.Setenv("_TEST_GOTH_CASSANDRA_SERIAL_CONSISTENCY", "SERIAL")
+		t.Setenv("_TEST_GOTH_CASSANDRA_PAGE_SIZE", "50")
+		t.Setenv("_TEST_GOTH_CASSANDRA_CONNECT_TIMEOUT", "500")
+		options := DefaultCassandraReaderOptions
+		envCassandraOptions("_TEST_GOTH_CASSANDRA", &options)
+		assert.Equal(t, gocql.LocalOne, options.Consistency)
+		assert.Equal(t, gocql.Serial, options.SerialConsistency)
+		assert.Equal(t, 50, options.PageSize)
+		assert.Equal(t, 500*time.Millisecond, options.ConnectTimeout)
+		assert.Equal(t, DefaultCassandraReaderOptions.Timeout, options.Timeout)
+	})
+
+	t.Run("NewCassandra applies writer and reader defaults", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		writer, reader := DefaultCassandraWriterOptions, DefaultCassandraReaderOptions
+		defer func() {
+			DefaultCassandraWriterOptions, DefaultCassandraReaderOptions = writer, reader
+		}()
+
+		DefaultCassandraWriterOptions.Consistency = gocql.Quorum
+		DefaultCassandraReaderOptions.Consistency = gocql.LocalOne
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		cassandra := NewCassandra("test")
+		if assert.NotNil(t, cassandra) {
+			assert.Equal(t, gocql.Quorum, cassandra.Writer().Config().Consistency)
+			assert.Equal(t, gocql.LocalOne, cassandra.Reader().Config().Consistency)
+		}
+	})
+}
+
+type cassandraTestAudit struct {
+	CreatedAt time.Time
+	Deleted   bool `cql:"-"`
+}
+
+type cassandraTestUser struct {
+	cassandraTestAudit
+	ID       gocql.UUID `cql:"user_id"`
+	Name     string
+	LoginIP  *string
+	Score    int64
+	Tags     []string
+	internal string
+}
+
+func TestCassandraIter(t *testing.T) {
+	id := gocql.TimeUUID()
+	now := time.Now().Truncate(time.Millisecond)
+	rows := []CassandraRow{
+		{"user_id": id, "name": "alice", "login_ip": "10.0.0.1", "score": int64(7), "tags": []string{"a"}, "created_at": now, "deleted": true, "unknown": 1},
+		{"user_id": id, "name": "bob", "login_ip": nil, "score": int(3), "tags": nil, "created_at": now},
+	}
+
+	mock := NewMockCassandraOp()
+	mock.SetQueryResponse(rows, nil)
+
+	t.Run("Scan into structs", func(t *testing.T) {
+		iter := mock.Query(context.Background(), "SELECT * FROM users WHERE user_id = ?", id)
+		var user cassandraTestUser
+		assert.True(t, iter.Scan(&user))
+		assert.Equal(t, id, user.ID)
+		assert.Equal(t, "alice", user.Name)
+		if assert.NotNil(t, user.LoginIP) {
+			assert.Equal(t, "10.0.0.1", *user.LoginIP)
+		}
+		assert.Equal(t, int64(7), user.Score)
+		assert.Equal(t, []string{"a"}, user.Tags)
+		assert.Equal(t, now, user.CreatedAt)
+		assert.False(t, user.Deleted)
+
+		assert.True(t, iter.Scan(&user))
+		assert.Equal(t, "bob", user.Name)
+		assert.Nil(t, user.LoginIP)
+		assert.Equal(t, int64(3), user.Score)
+		assert.False(t, iter.Scan(&user))
+		assert.NoError(t, iter.Close())
+
+		call := mock.GetCallsByMethod("Query")[0]
+		assert.Equal(t, []interface{}{"SELECT * FROM users WHERE user_id = ?", id}, call.Args)
+	})
+
+	t.Run("All and One", func(t *testing.T) {
+		var users []cassandraTestUser
+		assert.NoError(t, mock.Query(context.Background(), "SELECT * FROM users").All(&users))
+		assert.Len(t, users, 2)
+
+		var pointers []*cassandraTestUser
+		assert.NoError(t, mock.Query(context.Background(), "SELECT * FROM users").All(&pointers))
+		assert.Equal(t, "bob", pointers[1].Name)
+
+		var maps []map[string]interface{}
+		assert.NoError(t, mock.Query(context.Background(), "SELECT * FROM users").All(&maps))
+		assert.Equal(t, "alice", maps[0]["name"])
+		assert.Error(t, mock.Query(context.Background(), "SELECT * FROM users").All(users))
+
+		var user cassandraTestUser
+		assert.NoError(t, mock.Query(context.Background(), "SELECT * FROM users").One(&user))
+		assert.Equal(t, "alice", user.Name)
+
+		empty := NewMockCassandraOp()
+		assert.ErrorIs(t, empty.Query(context.Background(), "SELECT * FROM users").One(&user), gocql.ErrNotFound)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		var user cassandraTestUser
+		failing := NewMockCassandraOp()
+		failing.SetQueryResponse(nil, errors.New("unavailable"))
+		assert.EqualError(t, failing.Query(context.Background(), "SELECT * FROM users").One(&user), "unavailable")
+
+		iter := NewCassandraIter([]CassandraRow{{"name": 1}}, nil)
+		assert.False(t, iter.Scan(&user))
+		assert.Error(t, iter.Close())
+
+		assert.Error(t, NewCassandraIter(rows, nil).One(user))
+		var notStruct int
+		assert.Error(t, NewCassandraIter(rows, nil).One(&notStruct))
+
+		failing.SetExecError(errors.New("write timeout"))
+		assert.EqualError(t, failing.Execute(context.Background(), "DELETE FROM users WHERE user_id = ?", id), "write timeout")
+		assert.Equal(t, "Execute", failing.GetCallHistory()[1].Method)
+	})
+
+	t.Run("Snake case", func(t *testing.T) {
+		assert.Equal(t, "login_ip", cassandraSnakeCase("LoginIP"))
+		assert.Equal(t, "user_id", cassandraSnakeCase("UserID"))
+		assert.Equal(t, "http_server_url", cassandraSnakeCase("HTTPServerURL"))
+		assert.Equal(t, "name", cassandraSnakeCase("Name"))
+	})
+
+	t.Run("Without session", func(t *testing.T) {
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"})
+		op.cluster.ConnectTimeout = 100 * time.Millisecond
+		op.cluster.Timeout = 100 * time.Millisecond
+		assert.ErrorIs(t, op.Query(context.Background(), "SELECT * FROM users").Close(), ErrCassandraSessionUnavailable)
+		assert.ErrorIs(t, op.Execute(context.Background(), "TRUNCATE users"), ErrCassandraSessionUnavailable)
+	})
+}
+
+func TestCassandraBatch(t *testing.T) {
+	t.Run("Split by statements and size", func(t *testing.T) {
+		stmts := make([]CassandraBatchStmt, 5)
+		for i := range stmts {
+			stmts[i] = CassandraBatchStmt{Stmt: "INSERT INTO t (k, v) VALUES (?, ?)", Binds: []interface{}{int64(i), "0123456789"}}
+		}
+
+		chunks := splitCassandraBatch(stmts, CassandraBatchOptions{MaxStatements: 2})
+		assert.Len(t, chunks, 3)
+		assert.Len(t, chunks[2], 1)
+
+		stmtSize := cassandraBatchStmtSize(stmts[0])
+		assert.Equal(t, len(stmts[0].Stmt)+8+10, stmtSize)
+		chunks = splitCassandraBatch(stmts, CassandraBatchOptions{MaxBytes: stmtSize*3 + 1})
+		assert.Len(t, chunks, 2)
+		assert.Len(t, chunks[0], 3)
+
+		// A statement over the size limit is still sent, alone
+		chunks = splitCassandraBatch(stmts[:2], CassandraBatchOptions{MaxBytes: 1})
+		assert.Len(t, chunks, 2)
+		assert.Len(t, splitCassandraBatch(stmts, CassandraBatchOptions{}), 1)
+	})
+
+	t.Run("Builder", func(t *testing.T) {
+		mock := NewMockCassandraOp()
+		batch := mock.NewBatch(CassandraBatchOptions{Type: gocql.UnloggedBatch, MaxStatements: 2})
+		batch.Add("INSERT INTO t (k) VALUES (?)", 1).
+			Add("INSERT INTO t (k) VALUES (?)", 2).
+			Add("DELETE FROM t WHERE k = ?", 3)
+		assert.Equal(t, 3, batch.Len())
+		assert.NoError(t, batch.Exec(context.Background()))
+		assert.Equal(t, 0, batch.Len())
+
+		calls := mock.GetCallsByMethod("Batch")
+		assert.Len(t, calls, 2)
+		assert.Equal(t, gocql.UnloggedBatch, calls[0].Args[0])
+		assert.Equal(t, []CassandraBatchStmt{{Stmt: "DELETE FROM t WHERE k = ?", Binds: []interface{}{3}}}, calls[1].Args[1])
+
+		assert.NoError(t, mock.NewBatch(CassandraBatchOptions{}).Exec(context.Background()))
+		assert.Len(t, mock.GetCallsByMethod("Batch"), 2)
+
+		// A LOGGED batch is never split
+		logged := mock.NewBatch(CassandraBatchOptions{MaxStatements: 2}).
+			Add("INSERT INTO t (k) VALUES (?)", 1).
+			Add("INSERT INTO t (k) VALUES (?)", 2)
+		assert.NoError(t, logged.Exec(context.Background()))
+		assert.Len(t, mock.GetCallsByMethod("Batch"), 3)
+		logged.Add("INSERT INTO t (k) VALUES (?)", 1).
+			Add("INSERT INTO t (k) VALUES (?)", 2).
+			Add("INSERT INTO t (k) VALUES (?)", 3)
+		assert.ErrorIs(t, logged.Exec(context.Background()), ErrCassandraBatchTooLarge)
+		assert.Len(t, mock.GetCallsByMethod("Batch"), 3)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		mock := NewMockCassandraOp()
+		mock.SetExecError(errors.New("write timeout"))
+		err := mock.Batch(context.Background(), CassandraBatchStmt{Stmt: "INSERT INTO t (k) VALUES (1)"})
+		assert.EqualError(t, err, "write timeout")
+
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"})
+		op.cluster.ConnectTimeout = 100 * time.Millisecond
+		op.cluster.Timeout = 100 * time.Millisecond
+		assert.NoError(t, op.Batch(context.Background()))
+		err = op.BatchWithOptions(context.Background(), CassandraBatchOptions{MaxBytes: 1},
+			CassandraBatchStmt{Stmt: "INSERT INTO t (k) VALUES (1)"}, CassandraBatchStmt{Stmt: "INSERT INTO t (k) VALUES (2)"})
+		assert.ErrorIs(t, err, ErrCassandraBatchTooLarge)
+		err = op.NewBatch(CassandraBatchOptions{}).Add("INSERT INTO t (k) VALUES (1)").Exec(context.Background())
+		assert.ErrorIs(t, err, ErrCassandraSessionUnavailable)
+	})
+}
+
+func TestCassandraPreparedStatementCacheSize(t *testing.T) {
+	original := DefaultCassandraPreparedStatementCacheSize
+	defer func() {
+		DefaultCassandraPreparedStatementCacheSize = original
+	}()
+
+	meta := secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"}
+	DefaultCassandraPreparedStatementCacheSize = 10
+	assert.Equal(t, 10, configureCassandraOp(meta).Config().MaxPreparedStmts)
+
+	DefaultCassandraPreparedStatementCacheSize = 0
+	assert.Equal(t, gocql.NewCluster("127.0.0.1").MaxPreparedStmts, configureCassandraOp(meta).Config().MaxPreparedStmts)
+}
+
+func TestCassandraPageIterator(t *testing.T) {
+	type user struct {
+		ID int
+	}
+
+	rows := make([]CassandraRow, 5)
+	for i := range rows {
+		rows[i] = CassandraRow{"id": i}
+	}
+
+	t.Run("Scan across pages", func(t *testing.T) {
+		mock := NewMockCassandraOp()
+		mock.SetQueryResponse(rows, nil)
+		iter := mock.PageIterator(context.Background(), CassandraPageOptions{PageSize: 2}, "SELECT id FROM users")
+
+		var ids []int
+		var u user
+		for iter.Scan(&u) {
+			ids = append(ids, u.ID)
+		}
+
+		assert.NoError(t, iter.Close())
+		assert.Equal(t, []int{0, 1, 2, 3, 4}, ids)
+		assert.Nil(t, iter.NextPageState())
+		assert.False(t, iter.HasNextPage())
+		assert.Len(t, mock.GetCallsByMethod("PageIterator"), 3)
+	})
+
+	t.Run("Stateless pages", func(t *testing.T) {
+		mock := NewMockCassandraOp()
+		mock.SetQueryResponse(rows, nil)
+
+		var state []byte
+		var pages [][]int
+		for {
+			iter := mock.PageIterator(context.Background(), CassandraPageOptions{PageSize: 3, PageState: state}, "SELECT id FROM users")
+			var page []user
+			assert.NoError(t, iter.NextPage(&page))
+			ids := []int{}
+			for _, u := range page {
+				ids = append(ids, u.ID)
+			}
+
+			pages = append(pages, ids)
+			state = iter.NextPageState()
+			assert.NoError(t, iter.Close())
+			if state == nil {
+				break
+			}
+		}
+
+		assert.Equal(t, [][]int{{0, 1, 2}, {3, 4}}, pages)
+
+		iter := mock.PageIterator(context.Background(), CassandraPageOptions{PageSize: 5}, "SELECT id FROM users")
+		page := []user{{ID: 9}}
+		assert.NoError(t, iter.NextPage(&page))
+		assert.Len(t, page, 5)
+		assert.NoError(t, iter.NextPage(&page))
+		assert.Empty(t, page)
+		assert.Error(t, iter.NextPage(page))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		mock := NewMockCassandraOp()
+		mock.SetQueryResponse(nil, errors.New("read timeout"))
+		iter := mock.PageIterator(context.Background(), CassandraPageOptions{}, "SELECT id FROM users")
+		var u user
+		assert.False(t, iter.Scan(&u))
+		assert.EqualError(t, iter.Close(), "read timeout")
+
+		mock.SetQueryResponse(rows, nil)
+		iter = mock.PageIterator(context.Background(), CassandraPageOptions{PageState: []byte("x")}, "SELECT id FROM users")
+		var page []user
+		assert.Error(t, iter.NextPage(&page))
+
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"})
+		op.cluster.ConnectTimeout = 100 * time.Millisecond
+		op.cluster.Timeout = 100 * time.Millisecond
+		iter = op.PageIterator(context.Background(), CassandraPageOptions{PageSize: 10}, "SELECT id FROM users")
+		assert.False(t, iter.Scan(&u))
+		assert.ErrorIs(t, iter.Close(), ErrCassandraSessionUnavailable)
+	})
+}
+
+type cassandraTestHostPolicy struct {
+	gocql.HostSelectionPolicy
+	calls []string
+}
+
+func (p *cassandraTestHostPolicy) AddHost(host *gocql.HostInfo) {
+	p.calls = append(p.calls, "add")
+}
+
+func (p *cassandraTestHostPolicy) RemoveHost(host *gocql.HostInfo) {
+	p.calls = append(p.calls, "remove")
+}
+
+func (p *cassandraTestHostPolicy) HostUp(host *gocql.HostInfo) {
+	p.calls = append(p.calls, "up")
+}
+
+func (p *cassandraTestHostPolicy) HostDown(host *gocql.HostInfo) {
+	p.calls = append(p.calls, "down")
+}
+
+func TestCassandraHostPolicy(t *testing.T) {
+	t.Run("From secret", func(t *testing.T) {
+		meta := secret.CassandraMeta{Endpoints: []string{"127.0.0.1:9042"}, Keyspace: "testkeyspace"}
+		op := configureCassandraOp(meta)
+		assert.Nil(t, op.Config().HostFilter)
+		assert.NotNil(t, op.hostPolicy())
+
+		meta.LocalDC = "dc1"
+		meta.LocalDCOnly = true
+		meta.TokenAware = true
+		op = configureCassandraOp(meta)
+		assert.NotNil(t, op.Config().HostFilter)
+		policy := op.hostPolicy()
+		assert.NotSame(t, policy, op.hostPolicy())
+		assert.Contains(t, fmt.Sprintf("%T", policy), "tokenAware")
+	})
+
+	t.Run("Observers", func(t *testing.T) {
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:9042"}, Keyspace: "testkeyspace"})
+		var events []CassandraHostEvent
+		op.AddHostObserver(func(event CassandraHostEvent) {
+			events = append(events, event)
+		})
+
+		inner := &cassandraTestHostPolicy{}
+		policy := &cassandraObservedHostPolicy{HostSelectionPolicy: inner, op: op}
+		host := (&gocql.HostInfo{}).SetConnectAddress(net.ParseIP("10.0.0.1"))
+		policy.AddHosts([]*gocql.HostInfo{host, host})
+		policy.HostDown(host)
+		policy.HostUp(host)
+		policy.RemoveHost(host)
+		assert.False(t, policy.Ready())
+		assert.Equal(t, []string{"add", "add", "down", "up", "remove"}, inner.calls)
+
+		var types []string
+		for _, event := range events {
+			types = append(types, event.Type)
+		}
+
+		assert.Equal(t, "10.0.0.1:0", events[0].Host)
+		assert.Equal(t, []string{CassandraHostAdded, CassandraHostAdded, CassandraHostDown, CassandraHostUp, CassandraHostRemoved}, types)
+
+		start := time.Now()
+		op.ObserveConnect(gocql.ObservedConnect{Host: host, Start: start, End: start.Add(time.Millisecond), Err: errors.New("refused")})
+		last := events[len(events)-1]
+		assert.Equal(t, CassandraHostConnectFailed, last.Type)
+		assert.Equal(t, time.Millisecond, last.Latency)
+		assert.EqualError(t, last.Err, "refused")
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"})
+		op.cluster.ConnectTimeout = 100 * time.Millisecond
+		created := 0
+		op.SetHostSelectionPolicy(func() gocql.HostSelectionPolicy {
+			created++
+			return gocql.RoundRobinHostPolicy()
+		})
+
+		_, err := op.NewSession()
+		assert.Error(t, err)
+		assert.Equal(t, 1, created)
+		assert.Nil(t, op.Config().PoolConfig.HostSelectionPolicy)
+	})
+}
+
+func TestCassandraMetadata(t *testing.T) {
+	t.Run("Operator", func(t *testing.T) {
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"})
+		op.cluster.ConnectTimeout = 100 * time.Millisecond
+		op.columnsMetadata["users"] = CassandraColumnMetadata{
+			keyspaceName: "testkeyspace",
+			tableName:    "users",
+			Columns:      map[string]CassandraColumnMetadataColumn{"id": {Name: "id", Kind: "partition_key", Type: "uuid"}},
+		}
+
+		metadata, ok := op.TableMetadata("users")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"id"}, metadata.PartitionKeys())
+		_, ok = op.TableMetadata("orders")
+		assert.False(t, ok)
+
+		op.SetMetadataRefreshInterval(10 * time.Millisecond)
+		assert.Nil(t, op.metadataRefreshStop)
+		assert.ErrorIs(t, op.RefreshMetadata(), ErrCassandraSessionUnavailable)
+		op.SetMetadataRefreshInterval(0)
+
+		// The reload of a session closed elsewhere clears itself so the next session starts its own
+		session := &gocql.Session{}
+		op.session.Store(session)
+		op.SetMetadataRefreshInterval(20 * time.Millisecond)
+		session.Close()
+		assert.Eventually(t, func() bool {
+			op.opLock.Lock()
+			defer op.opLock.Unlock()
+			return op.metadataRefreshStop == nil
+		}, time.Second, 5*time.Millisecond)
+		op.SetMetadataRefreshInterval(0)
+	})
+
+	t.Run("Mock", func(t *testing.T) {
+		mock := NewMockCassandraOp()
+		mock.SetColumnsMetadata(map[string]CassandraColumnMetadata{"users": {tableName: "users"}})
+		metadata, ok := mock.TableMetadata("users")
+		assert.True(t, ok)
+		assert.Equal(t, "users", metadata.TableName())
+		assert.NoError(t, mock.RefreshMetadata())
+		assert.Len(t, mock.GetCallsByMethod("RefreshMetadata"), 1)
+
+		mock.SetSessionResponse(nil, errors.New("no hosts"))
+		assert.EqualError(t, mock.RefreshMetadata(), "no hosts")
+	})
+}
+
+func TestCassandraLWT(t *testing.T) {
+	type account struct {
+		ID      int `cql:"id"`
+		Name    string
+		Balance int64
+		secret  string
+	}
+
+	t.Run("Statements", func(t *testing.T) {
+		stmt, binds, err := cassandraInsertIfNotExistsStmt("accounts", &account{ID: 1, Name: "alice", Balance: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, "INSERT INTO accounts (id, name, balance) VALUES (?, ?, ?) IF NOT EXISTS", stmt)
+		assert.Equal(t, []interface{}{1, "alice", int64(10)}, binds)
+
+		stmt, binds, err = cassandraInsertIfNotExistsStmt("accounts", map[string]interface{}{"name": "bob", "id": 2})
+		assert.NoError(t, err)
+		assert.Equal(t, "INSERT INTO accounts (id, name) VALUES (?, ?) IF NOT EXISTS", stmt)
+		assert.Equal(t, []interface{}{2, "bob"}, binds)
+
+		_, _, err = cassandraInsertIfNotExistsStmt("accounts", 1)
+		assert.Error(t, err)
+		_, _, err = cassandraInsertIfNotExistsStmt("accounts", CassandraRow{})
+		assert.Error(t, err)
+
+		stmt, binds, err = cassandraUpdateIfStmt("accounts",
+			CassandraRow{"balance": 20, "name": "alice"}, CassandraRow{"id": 1}, CassandraRow{"balance": 10})
+		assert.NoError(t, err)
+		assert.Equal(t, "UPDATE accounts SET balance = ?, name = ? WHERE id = ? IF balance = ?", stmt)
+		assert.Equal(t, []interface{}{20, "alice", 1, 10}, binds)
+
+		_, _, err = cassandraUpdateIfStmt("accounts", CassandraRow{"balance": 20}, CassandraRow{"id": 1}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Result", func(t *testing.T) {
+		result, err := newCassandraLWTResult(map[string]interface{}{"[applied]": false, "id": 1, "balance": int64(10)})
+		assert.NoError(t, err)
+		assert.False(t, result.Applied)
+		assert.Equal(t, CassandraRow{"id": 1, "balance": int64(10)}, result.Current)
+
+		var current account
+		assert.NoError(t, result.Scan(&current))
+		assert.Equal(t, account{ID: 1, Balance: 10}, current)
+
+		_, err = newCassandraLWTResult(map[string]interface{}{"id": 1})
+		assert.ErrorIs(t, err, ErrCassandraNotLWT)
+	})
+
+	t.Run("Mock", func(t *testing.T) {
+		mock := NewMockCassandraOp()
+		result, err := mock.InsertIfNotExists(context.Background(), "accounts", account{ID: 1, Name: "alice"})
+		assert.NoError(t, err)
+		assert.True(t, result.Applied)
+
+		mock.SetLWTResponse(&CassandraLWTResult{Current: CassandraRow{"balance": int64(5)}}, nil)
+		result, err = mock.UpdateIf(context.Background(), "accounts", CassandraRow{"balance": 20}, CassandraRow{"id": 1}, CassandraRow{"balance": 10})
+		assert.NoError(t, err)
+		assert.False(t, result.Applied)
+		assert.Equal(t, int64(5), result.Current["balance"])
+
+		calls := mock.GetCallsByMethod("ExecuteLWT")
+		assert.Len(t, calls, 2)
+		assert.Equal(t, "UPDATE accounts SET balance = ? WHERE id = ? IF balance = ?", calls[1].Args[0])
+
+		mock.SetLWTResponse(nil, errors.New("cas timeout"))
+		_, err = mock.ExecuteLWT(context.Background(), "DELETE FROM accounts WHERE id = ? IF EXISTS", 1)
+		assert.EqualError(t, err, "cas timeout")
+	})
+
+	t.Run("No session", func(t *testing.T) {
+		op := configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:1"}, Keyspace: "testkeyspace"})
+		op.cluster.ConnectTimeout = 100 * time.Millisecond
+		_, err := op.InsertIfNotExists(context.Background(), "accounts", account{ID: 1})
+		assert.ErrorIs(t, err, ErrCassandraSessionUnavailable)
+	})
+}
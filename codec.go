@@ -0,0 +1,104 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec serializes the values stored by the typed helpers, see GetAs, SetAs and Cache.
+// Implementations must be safe for concurrent use.
+type Codec interface {
+	// Name identifies the codec in profiles and GOTH_DEFAULT_* variables, e.g. "json"
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Built-in codecs, registered under "json", "msgpack" and "gob".
+var (
+	JSONCodec    Codec = jsonCodec{}
+	MsgpackCodec Codec = msgpackCodec{}
+	// GobCodec is the fastest for Go only consumers, values are not readable from other languages
+	GobCodec Codec = gobCodec{}
+)
+
+// ErrCodecNotFound is returned by CodecByName for names that are not registered.
+var ErrCodecNotFound = errors.New("codec not found")
+
+var codecs = map[string]Codec{
+	JSONCodec.Name():    JSONCodec,
+	MsgpackCodec.Name(): MsgpackCodec,
+	GobCodec.Name():     GobCodec,
+}
+var codecsLock sync.RWMutex
+
+// RegisterCodec makes codec selectable by its name, replacing a codec registered with the same name.
+func RegisterCodec(codec Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// CodecByName returns the codec registered as name, ErrCodecNotFound if there is none.
+func CodecByName(name string) (Codec, error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	if codec, ok := codecs[name]; ok {
+		return codec, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrCodecNotFound, name)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return "gob"
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
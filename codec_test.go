@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+type codecTestRecord struct {
+	ID     int64
+	Name   string
+	Scores map[string]float64
+}
+
+func TestCodec(t *testing.T) {
+	record := codecTestRecord{ID: 1, Name: "alice", Scores: map[string]float64{"math": 9.5}}
+	for _, name := range []string{"json", "msgpack", "gob"} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := CodecByName(name)
+			assert.NoError(t, err)
+			assert.Equal(t, name, codec.Name())
+
+			data, err := codec.Marshal(record)
+			assert.NoError(t, err)
+
+			var got codecTestRecord
+			assert.NoError(t, codec.Unmarshal(data, &got))
+			assert.Equal(t, record, got)
+		})
+	}
+
+	t.Run("Register", func(t *testing.T) {
+		_, err := CodecByName("test-json")
+		assert.ErrorIs(t, err, ErrCodecNotFound)
+
+		RegisterCodec(testCodec{})
+		defer func() {
+			codecsLock.Lock()
+			delete(codecs, "test-json")
+			codecsLock.Unlock()
+		}()
+
+		codec, err := CodecByName("test-json")
+		assert.NoError(t, err)
+		assert.Equal(t, "test-json", codec.Name())
+	})
+
+	t.Run("Profile codec", func(t *testing.T) {
+		profile := &secret.Redis{Master: secret.RedisMeta{Host: "localhost", Port: 6379}, Codec: "msgpack"}
+		r := NewRedisWithProfile("codec", profile)
+		defer r.Close()
+		assert.Equal(t, MsgpackCodec, r.Master().Codec())
+		assert.Equal(t, MsgpackCodec, r.Slave().Codec())
+
+		profile = &secret.Redis{Master: secret.RedisMeta{Host: "localhost", Port: 6379}, Codec: "missing"}
+		r = NewRedisWithProfile("codec", profile)
+		defer r.Close()
+		assert.Equal(t, DefaultRedisCodec, r.Master().Codec())
+	})
+}
+
+type testCodec struct{}
+
+func (testCodec) Name() string {
+	return "test-json"
+}
+
+func (testCodec) Marshal(v interface{}) ([]byte, error) {
+	return JSONCodec.Marshal(v)
+}
+
+func (testCodec) Unmarshal(data []byte, v interface{}) error {
+	return JSONCodec.Unmarshal(data, v)
+}
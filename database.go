@@ -1,14 +1,23 @@
 package datastore
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"net/url"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	secret "github.com/yetiz-org/goth-datastore/secrets"
 	kklogger "github.com/yetiz-org/goth-kklogger"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm/logger"
@@ -21,6 +30,23 @@ var DefaultDatabaseMaxIdleConn = 2
 var DefaultDatabaseConnMaxLifetime = 20000
 var DefaultDatabaseConnMaxIdleTime = 0
 
+// DefaultDatabaseValidateInterval is the minimum interval in milliseconds between pings DB() uses to validate
+// the cached pool, a broken pool is drained and rebuilt. 0 disables validation.
+var DefaultDatabaseValidateInterval = 0
+
+// DefaultDatabasePoolDrainTimeout is the grace period in milliseconds a replaced pool stays open, e.g. after a failed
+// validation, so the holders of its *sql.DB finish their queries and fetch the new pool. It is closed once idle after.
+var DefaultDatabasePoolDrainTimeout = 30000
+
+// DefaultDatabasePrepareStmt caches prepared statements for every query, see gorm.Config.PrepareStmt.
+var DefaultDatabasePrepareStmt = false
+
+// DefaultDatabaseSkipDefaultTransaction stops gorm wrapping single create, update and delete calls in a transaction.
+var DefaultDatabaseSkipDefaultTransaction = false
+
+// DefaultDatabaseNowFunc is used by gorm to fill created and updated timestamps, nil means gorm's local time.
+var DefaultDatabaseNowFunc func() time.Time
+
 /* Params ref: https://gorm.io/docs/connecting_to_the_database.html */
 var DefaultDatabaseCharset = ""
 var DefaultDatabaseDialTimeout = "3s"
@@ -36,12 +62,17 @@ var DefaultDatabaseTransactionIsolation DatabaseIsolationLevel = ""
 
 var DefaultDatabasePostgresSSLMode = "disable"
 var DefaultDatabasePostgresTimeZone = "Local"
+var DefaultDatabasePostgresSearchPath = ""
 
 func init() {
 	envInt("GOTH_DEFAULT_DATABASE_MAX_OPEN_CONN", &DefaultDatabaseMaxOpenConn)
 	envInt("GOTH_DEFAULT_DATABASE_MAX_IDLE_CONN", &DefaultDatabaseMaxIdleConn)
 	envInt("GOTH_DEFAULT_DATABASE_CONN_MAX_LIFETIME", &DefaultDatabaseConnMaxLifetime)
 	envInt("GOTH_DEFAULT_DATABASE_CONN_MAX_IDLE_TIME", &DefaultDatabaseConnMaxIdleTime)
+	envInt("GOTH_DEFAULT_DATABASE_VALIDATE_INTERVAL", &DefaultDatabaseValidateInterval)
+	envInt("GOTH_DEFAULT_DATABASE_POOL_DRAIN_TIMEOUT", &DefaultDatabasePoolDrainTimeout)
+	envBool("GOTH_DEFAULT_DATABASE_PREPARE_STMT", &DefaultDatabasePrepareStmt)
+	envBool("GOTH_DEFAULT_DATABASE_SKIP_DEFAULT_TRANSACTION", &DefaultDatabaseSkipDefaultTransaction)
 	envStr("GOTH_DEFAULT_DATABASE_CHARSET", &DefaultDatabaseCharset)
 	envStr("GOTH_DEFAULT_DATABASE_DIAL_TIMEOUT", &DefaultDatabaseDialTimeout)
 	envStr("GOTH_DEFAULT_DATABASE_READ_TIMEOUT", &DefaultDatabaseReadTimeout)
@@ -55,6 +86,7 @@ func init() {
 	envStr("GOTH_DEFAULT_DATABASE_TRANSACTION_ISOLATION", &DefaultDatabaseTransactionIsolation)
 	envStr("GOTH_DEFAULT_DATABASE_POSTGRES_SSL_MODE", &DefaultDatabasePostgresSSLMode)
 	envStr("GOTH_DEFAULT_DATABASE_POSTGRES_TIME_ZONE", &DefaultDatabasePostgresTimeZone)
+	envStr("GOTH_DEFAULT_DATABASE_POSTGRES_SEARCH_PATH", &DefaultDatabasePostgresSearchPath)
 }
 
 // DatabaseIsolationLevel represents a SQL transaction isolation level.
@@ -100,15 +132,27 @@ func (l DatabaseIsolationLevel) postgresValue() string {
 }
 
 type Database struct {
-	writer DatabaseOperator
-	reader DatabaseOperator
+	name    string
+	writer  DatabaseOperator
+	reader  DatabaseOperator
+	readers []DatabaseOperator
+	balance databaseReaderBalance
+	// healthCancel stops the reader health check goroutine, which closes healthDone on exit
+	healthCancel context.CancelFunc
+	healthDone   chan struct{}
 }
 
 func (k *Database) Writer() DatabaseOperator {
 	return k.writer
 }
 
+// Reader returns the reader operator. When the profile lists multiple readers, each call picks one
+// according to DefaultDatabaseReaderBalance, skipping replicas ejected as unhealthy.
 func (k *Database) Reader() DatabaseOperator {
+	if len(k.readers) > 1 {
+		return k.balance.pick(k.readers)
+	}
+
 	return k.reader
 }
 
@@ -120,8 +164,31 @@ type DatabaseOp struct {
 	MysqlParams MysqlParams
 	GORMParams  gorm.Config
 	Logger      logger.Interface
+	// RetryPolicy is used to open the pool, DefaultDatabaseRetryPolicy when Attempts is 0
+	RetryPolicy RetryPolicy
+	// Dialer opens the TCP connections of the MySQL adapter, e.g. through an SSH bastion, the driver dials itself
+	// when nil. It is not used for unix sockets.
+	Dialer      DialContextFunc
+	dialNetwork string
+	dialOnce    sync.Once
+	// Plugins and Callbacks are applied to every pool before it is handed out, see Use and RegisterCallback
+	Plugins   []gorm.Plugin
+	Callbacks []DatabaseCallbackFunc
+	// replicas are routed SELECTs by gorm dbresolver, see DefaultDatabaseResolver
+	replicas []*DatabaseOp
+	// stats records query stats when enabled, see DefaultDatabaseQueryStats
+	stats atomic.Pointer[databaseQueryStats]
+	// opening shares the opening of the pool between the concurrent callers of DBContext
+	opening singleflight.Group
+	// validatedAt is the last time the pool was created or validated, see DefaultDatabaseValidateInterval
+	validatedAt time.Time
+	// dns resolves the host again to reopen the pool when its addresses change, see DefaultDNSRefreshInterval
+	dns *dnsResolver
 }
 
+// DatabaseCallbackFunc registers callbacks on a new pool, e.g. db.Callback().Create().Before("gorm:create").Register(...).
+type DatabaseCallbackFunc func(db *gorm.DB) error
+
 type MysqlParams struct {
 	DriverName                    string
 	ServerVersion                 string
@@ -156,6 +223,14 @@ type ConnParams struct {
 	SSLMode          string
 	TimeZone         string
 
+	// TLS sets the MySQL tls parameter, true, skip-verify, preferred or the name of a config
+	// registered with mysql.RegisterTLSConfig. The tls section of the profile overrides it.
+	TLS string
+
+	// SearchPath sets the PostgreSQL schema search path, e.g. "app,public".
+	// Empty means the server default and is not appended to the DSN.
+	SearchPath string
+
 	// TransactionIsolation sets the default transaction isolation level.
 	// The zero value (empty string) means "use database default" and is not
 	// appended to the DSN. Use the DatabaseIsolationLevel* constants.
@@ -178,24 +253,156 @@ type ConnParams struct {
 	ExtraParams map[string]string
 }
 
+// ErrDatabaseAdapterNotSupported is returned when a profile names an adapter that is neither built in nor registered.
+var ErrDatabaseAdapterNotSupported = errors.New("database adapter not support")
+
+// ErrDatabaseOpNil is returned when a pool is requested for a nil DatabaseOp.
+var ErrDatabaseOpNil = errors.New("DatabaseOp parameter is nil")
+
 func (o *DatabaseOp) DB() *gorm.DB {
+	db, err := o.DBContext(context.Background())
+	if err != nil {
+		kklogger.ErrorJ("datastore:DatabaseOp.DB", fmt.Sprintf("database pool create failed: %s", err.Error()))
+		return nil
+	}
+
+	return db
+}
+
+// DBContext returns the pool like DB(), waiting for pool creation and dial until ctx ends.
+// Instead of logging and returning nil it returns the error, ctx.Err() when ctx ends first,
+// ErrDatabaseAdapterNotSupported or a configuration error otherwise. Concurrent callers share one dial, which
+// goes on for the others when a caller gives up.
+func (o *DatabaseOp) DBContext(ctx context.Context) (*gorm.DB, error) {
+	o.opLock.RLock()
+	db := o.db
+	o.opLock.RUnlock()
+	if db != nil && o.validate(db) {
+		o.refreshDNS(db)
+		return db, nil
+	}
+
+	opened := o.opening.DoChan("pool", o.openPool)
+	select {
+	case result := <-opened:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+
+		return result.Val.(*gorm.DB), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// openPool opens the pool unless one is cached, without holding the lock while dialing. It runs once for the
+// concurrent callers of DBContext, so it is bounded by the RetryPolicy rather than by a caller's context.
+func (o *DatabaseOp) openPool() (interface{}, error) {
 	o.opLock.RLock()
 	db := o.db
 	o.opLock.RUnlock()
 	if db != nil {
-		return db
+		return db, nil
+	}
+
+	db, err := openDBPool(context.Background(), o)
+	if err != nil {
+		return nil, err
 	}
 
 	o.opLock.Lock()
 	defer o.opLock.Unlock()
-	if o.db == nil {
-		if o.db = newDBPool(o, 0); o.db == nil {
-			kklogger.ErrorJ("datastore:DatabaseOp.DB", "database pool create failed")
-			return nil
+	o.db = db
+	o.validatedAt = time.Now()
+	return db, nil
+}
+
+// validate pings the cached pool at most once per DefaultDatabaseValidateInterval.
+// A pool failing the ping is dropped and drained so DB() rebuilds it, false is returned in that case.
+func (o *DatabaseOp) validate(db *gorm.DB) bool {
+	if DefaultDatabaseValidateInterval <= 0 {
+		return true
+	}
+
+	interval := time.Duration(DefaultDatabaseValidateInterval) * time.Millisecond
+	o.opLock.Lock()
+	if time.Since(o.validatedAt) < interval {
+		o.opLock.Unlock()
+		return true
+	}
+
+	// Claim this validation round so concurrent callers keep using the pool meanwhile
+	o.validatedAt = time.Now()
+	o.opLock.Unlock()
+
+	err := pingGormDB(context.Background(), db)
+	if err == nil {
+		return true
+	}
+
+	kklogger.WarnJ("datastore:DatabaseOp.DB", fmt.Sprintf("database pool broken, rebuilding: %s", err.Error()))
+	o.opLock.Lock()
+	defer o.opLock.Unlock()
+	if o.db == db {
+		drainDBPool(db)
+		o.db = nil
+	}
+
+	return false
+}
+
+// refreshDNS resolves the host of the pool in the background at most once per DefaultDNSRefreshInterval. When its
+// addresses changed, the next DB() opens a new pool and the current one is drained, see drainDBPool.
+func (o *DatabaseOp) refreshDNS(db *gorm.DB) {
+	if o.dns == nil || !o.dns.due(time.Now()) {
+		return
+	}
+
+	go func() {
+		changed, err := o.dns.resolve(context.Background())
+		if err != nil {
+			kklogger.WarnJ("datastore:DatabaseOp.refreshDNS", fmt.Sprintf("resolve %s: %s", o.dns.host, err.Error()))
+			return
+		}
+
+		if !changed {
+			return
+		}
+
+		kklogger.InfoJ("datastore:DatabaseOp.refreshDNS", fmt.Sprintf("%s addresses changed, reopening the pool", o.dns.host))
+		o.opLock.Lock()
+		defer o.opLock.Unlock()
+		if o.db == db {
+			drainDBPool(db)
+			o.db = nil
 		}
+	}()
+}
+
+// Ping verifies a connection to the database can be established, opening the pool if needed.
+func (o *DatabaseOp) Ping(ctx context.Context) error {
+	db, err := o.DBContext(ctx)
+	if err != nil {
+		return err
 	}
 
-	return o.db
+	return pingGormDB(ctx, db)
+}
+
+// pingGormDB pings the pool, bounded by databasePingTimeout when ctx has no deadline.
+func pingGormDB(ctx context.Context, db *gorm.DB) error {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, databasePingTimeout)
+		defer cancel()
+	}
+
+	return sqlDb.PingContext(ctx)
 }
 
 func (o *DatabaseOp) Adapter() string {
@@ -247,6 +454,98 @@ func (o *DatabaseOp) SetLogger(logger logger.Interface) {
 	o.Logger = logger
 }
 
+// Use adds gorm plugins initialized on every pool inside newDBPool, before any query runs.
+// Plugins should be added before the first DB() call, an open pool initializes them in place for the queries started
+// afterwards.
+func (o *DatabaseOp) Use(plugins ...gorm.Plugin) {
+	o.opLock.Lock()
+	defer o.opLock.Unlock()
+	o.Plugins = append(o.Plugins, plugins...)
+	if o.db == nil {
+		return
+	}
+
+	for _, plugin := range plugins {
+		if err := o.db.Use(plugin); err != nil {
+			kklogger.ErrorJ("datastore:DatabaseOp.Use", fmt.Sprintf("plugin %s: %s", plugin.Name(), err.Error()))
+		}
+	}
+}
+
+// RegisterCallback adds a function registering gorm callbacks on every pool inside newDBPool, before any query runs.
+// Callbacks should be added before the first DB() call, an open pool registers them in place for the queries started
+// afterwards.
+func (o *DatabaseOp) RegisterCallback(callbacks ...DatabaseCallbackFunc) {
+	o.opLock.Lock()
+	defer o.opLock.Unlock()
+	o.Callbacks = append(o.Callbacks, callbacks...)
+	if o.db == nil {
+		return
+	}
+
+	for _, callback := range callbacks {
+		if err := callback(o.db); err != nil {
+			kklogger.ErrorJ("datastore:DatabaseOp.RegisterCallback", fmt.Sprintf("callback: %s", err.Error()))
+		}
+	}
+}
+
+// closePool closes the current pool, the next DB() call builds a new one.
+func (o *DatabaseOp) closePool() error {
+	o.opLock.Lock()
+	defer o.opLock.Unlock()
+	if o.db == nil {
+		return nil
+	}
+
+	sqlDb, err := o.db.DB()
+	o.db = nil
+	if err != nil {
+		return err
+	}
+
+	return sqlDb.Close()
+}
+
+// poolStats returns the stats of the current pool without opening one, false when no pool is open.
+func (o *DatabaseOp) poolStats() (sql.DBStats, bool) {
+	o.opLock.RLock()
+	db := o.db
+	o.opLock.RUnlock()
+	if db == nil {
+		return sql.DBStats{}, false
+	}
+
+	sqlDb, err := db.DB()
+	if err != nil {
+		return sql.DBStats{}, false
+	}
+
+	return sqlDb.Stats(), true
+}
+
+// drainDBPool closes a replaced pool once DefaultDatabasePoolDrainTimeout elapsed and no connection is in use, the
+// *sql.DB handed out by SQLDB keeps working meanwhile.
+func drainDBPool(db *gorm.DB) {
+	sqlDb, err := db.DB()
+	if err != nil {
+		return
+	}
+
+	grace := time.Duration(DefaultDatabasePoolDrainTimeout) * time.Millisecond
+	go func() {
+		time.Sleep(grace)
+		for sqlDb.Stats().InUse > 0 {
+			time.Sleep(databasePoolDrainPoll)
+		}
+
+		sqlDb.Close()
+	}()
+}
+
+// NewDatabase returns the Database of the profile, nil when it can not be loaded. With several readers it starts
+// a goroutine checking their health, see DefaultDatabaseReaderHealthCheckInterval, which only Close stops: a
+// Database created here rather than obtained from a Manager must be closed.
 func NewDatabase(profileName string) *Database {
 	profile := &secret.Database{}
 	if err := secret.Load("database", profileName, profile); err != nil {
@@ -254,62 +553,103 @@ func NewDatabase(profileName string) *Database {
 		return nil
 	}
 
-	database := new(Database)
+	database := &Database{name: profileName}
 	if profile.Writer.Adapter != "" {
-		database.writer = &DatabaseOp{
-			ConnParams: ConnParams{
-				Charset:              DefaultDatabaseCharset,
-				Timeout:              DefaultDatabaseDialTimeout,
-				ReadTimeout:          DefaultDatabaseReadTimeout,
-				WriteTimeout:         DefaultDatabaseWriteTimeout,
-				Collation:            DefaultDatabaseCollation,
-				Loc:                  DefaultDatabaseLoc,
-				ClientFoundRows:      DefaultDatabaseClientFoundRows,
-				ParseTime:            DefaultDatabaseParseTime,
-				MultiStatements:      DefaultDatabaseMultiStatements,
-				MaxAllowedPacket:     DefaultDatabaseMaxAllowedPacket,
-				MaxOpenConn:          DefaultDatabaseMaxOpenConn,
-				MaxIdleConn:          DefaultDatabaseMaxIdleConn,
-				ConnMaxLifetime:      DefaultDatabaseConnMaxLifetime,
-				ConnMaxIdleTime:      DefaultDatabaseConnMaxIdleTime,
-				TransactionIsolation: DefaultDatabaseTransactionIsolation,
-				SSLMode:              DefaultDatabasePostgresSSLMode,
-				TimeZone:             DefaultDatabasePostgresTimeZone,
-			},
-			meta: profile.Writer,
-		}
+		database.writer = newDatabaseOp(profile.Writer)
 	}
 
 	if profile.Reader.Adapter != "" {
-		database.reader = &DatabaseOp{
-			ConnParams: ConnParams{
-				Charset:              DefaultDatabaseCharset,
-				Timeout:              DefaultDatabaseDialTimeout,
-				ReadTimeout:          DefaultDatabaseReadTimeout,
-				WriteTimeout:         DefaultDatabaseWriteTimeout,
-				Collation:            DefaultDatabaseCollation,
-				Loc:                  DefaultDatabaseLoc,
-				ClientFoundRows:      DefaultDatabaseClientFoundRows,
-				ParseTime:            DefaultDatabaseParseTime,
-				MultiStatements:      DefaultDatabaseMultiStatements,
-				MaxAllowedPacket:     DefaultDatabaseMaxAllowedPacket,
-				MaxOpenConn:          DefaultDatabaseMaxOpenConn,
-				MaxIdleConn:          DefaultDatabaseMaxIdleConn,
-				ConnMaxLifetime:      DefaultDatabaseConnMaxLifetime,
-				ConnMaxIdleTime:      DefaultDatabaseConnMaxIdleTime,
-				TransactionIsolation: DefaultDatabaseTransactionIsolation,
-				SSLMode:              DefaultDatabasePostgresSSLMode,
-				TimeZone:             DefaultDatabasePostgresTimeZone,
-			},
-			meta: profile.Reader,
+		database.reader = newDatabaseOp(profile.Reader)
+	}
+
+	for _, meta := range profile.Readers {
+		if meta.Adapter != "" {
+			database.readers = append(database.readers, newDatabaseOp(meta))
+		}
+	}
+
+	if len(database.readers) > 0 {
+		database.reader = database.readers[0]
+		if len(database.readers) > 1 {
+			database.balance.strategy = DefaultDatabaseReaderBalance
+			database.startReaderHealthCheck()
 		}
 	}
 
+	if DefaultDatabaseResolver {
+		database.attachResolverReplicas()
+	}
+
 	return database
 }
 
+func newDatabaseOp(meta secret.DatabaseMeta) *DatabaseOp {
+	op := &DatabaseOp{
+		ConnParams: ConnParams{
+			Charset:              DefaultDatabaseCharset,
+			Timeout:              DefaultDatabaseDialTimeout,
+			ReadTimeout:          DefaultDatabaseReadTimeout,
+			WriteTimeout:         DefaultDatabaseWriteTimeout,
+			Collation:            DefaultDatabaseCollation,
+			Loc:                  DefaultDatabaseLoc,
+			ClientFoundRows:      DefaultDatabaseClientFoundRows,
+			ParseTime:            DefaultDatabaseParseTime,
+			MultiStatements:      DefaultDatabaseMultiStatements,
+			MaxAllowedPacket:     DefaultDatabaseMaxAllowedPacket,
+			MaxOpenConn:          DefaultDatabaseMaxOpenConn,
+			MaxIdleConn:          DefaultDatabaseMaxIdleConn,
+			ConnMaxLifetime:      DefaultDatabaseConnMaxLifetime,
+			ConnMaxIdleTime:      DefaultDatabaseConnMaxIdleTime,
+			TransactionIsolation: DefaultDatabaseTransactionIsolation,
+			SSLMode:              DefaultDatabasePostgresSSLMode,
+			TimeZone:             DefaultDatabasePostgresTimeZone,
+			SearchPath:           DefaultDatabasePostgresSearchPath,
+		},
+		RetryPolicy: DefaultDatabaseRetryPolicy,
+		Dialer:      DefaultDatabaseDialer,
+		GORMParams: gorm.Config{
+			PrepareStmt:            DefaultDatabasePrepareStmt,
+			SkipDefaultTransaction: DefaultDatabaseSkipDefaultTransaction,
+			NowFunc:                DefaultDatabaseNowFunc,
+		},
+		meta: meta,
+	}
+
+	if meta.Params.Socket == "" {
+		op.dns = newDNSResolver(meta.Params.Host)
+	}
+
+	if DefaultDatabaseQueryStats {
+		op.stats.Store(newDatabaseQueryStats())
+	}
+
+	return op
+}
+
+// mysqlDialNetwork registers the Dialer of the op with the MySQL driver, under a network name the DSN addresses
+// as name(host:port).
+func (o *DatabaseOp) mysqlDialNetwork() string {
+	o.dialOnce.Do(func() {
+		o.dialNetwork = fmt.Sprintf("datastore-dial-%p", o)
+		mysqldriver.RegisterDialContext(o.dialNetwork, func(ctx context.Context, addr string) (net.Conn, error) {
+			return o.Dialer(ctx, "tcp", addr)
+		})
+	})
+
+	return o.dialNetwork
+}
+
 func buildMysqlDSN(username, password, host string, port uint, dbName, charset string, params ConnParams) string {
-	dsn := fmt.Sprintf("%s:%s@(%s:%d)/%s?"+
+	return buildMysqlAddrDSN(username, password, fmt.Sprintf("(%s:%d)", host, port), dbName, charset, params)
+}
+
+// buildMysqlSocketDSN is buildMysqlDSN connecting through the unix socket at path.
+func buildMysqlSocketDSN(username, password, path, dbName, charset string, params ConnParams) string {
+	return buildMysqlAddrDSN(username, password, fmt.Sprintf("unix(%s)", path), dbName, charset, params)
+}
+
+func buildMysqlAddrDSN(username, password, addr, dbName, charset string, params ConnParams) string {
+	dsn := fmt.Sprintf("%s:%s@%s/%s?"+
 		"charset=%s"+
 		"&timeout=%s"+
 		"&readTimeout=%s"+
@@ -322,8 +662,7 @@ func buildMysqlDSN(username, password, host string, port uint, dbName, charset s
 		"&multiStatements=%v",
 		username,
 		password,
-		host,
-		port,
+		addr,
 		dbName,
 		charset,
 		params.Timeout,
@@ -337,6 +676,9 @@ func buildMysqlDSN(username, password, host string, port uint, dbName, charset s
 		params.MultiStatements,
 	)
 
+	if params.TLS != "" {
+		dsn += "&tls=" + url.QueryEscape(params.TLS)
+	}
 	if v := params.TransactionIsolation.mysqlValue(); v != "" {
 		dsn += "&transaction_isolation=" + v
 	}
@@ -365,7 +707,7 @@ func buildExtraParamsMysql(extra map[string]string) string {
 	return b.String()
 }
 
-func buildPostgresDSN(host, username, password, dbName string, port uint, sslMode, timeZone string, isolation DatabaseIsolationLevel, extraParams map[string]string) string {
+func buildPostgresDSN(host, username, password, dbName string, port uint, sslMode, timeZone, searchPath string, isolation DatabaseIsolationLevel, extraParams map[string]string) string {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
 		host,
@@ -377,6 +719,9 @@ func buildPostgresDSN(host, username, password, dbName string, port uint, sslMod
 		timeZone,
 	)
 
+	if searchPath != "" {
+		dsn += " search_path=" + postgresDSNValue(searchPath)
+	}
 	if v := isolation.postgresValue(); v != "" {
 		dsn += " default_transaction_isolation=" + v
 	}
@@ -384,6 +729,16 @@ func buildPostgresDSN(host, username, password, dbName string, port uint, sslMod
 	return dsn
 }
 
+// postgresDSNValue single-quotes values containing spaces or quotes, as required by the key=value DSN format.
+func postgresDSNValue(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, "'", `\'`) + "'"
+}
+
 func buildExtraParamsPostgres(extra map[string]string) string {
 	if len(extra) == 0 {
 		return ""
@@ -415,6 +770,7 @@ func buildPostgresDialectorConfig(meta secret.DatabaseMeta, params ConnParams, s
 			meta.Params.Port,
 			sslMode,
 			timeZone,
+			params.SearchPath,
 			params.TransactionIsolation,
 			params.ExtraParams,
 		),
@@ -422,15 +778,96 @@ func buildPostgresDialectorConfig(meta secret.DatabaseMeta, params ConnParams, s
 	}
 }
 
-func newDBPool(op *DatabaseOp, retry int) *gorm.DB {
-	// Add nil check for op parameter to prevent panic
-	if op == nil {
-		kklogger.ErrorJ("datastore:Database.newDBPool", "DatabaseOp parameter is nil")
-		return nil
+// DatabaseDialectorFunc builds the gorm dialector for a DatabaseOp, see RegisterDatabaseAdapter.
+type DatabaseDialectorFunc func(op *DatabaseOp) gorm.Dialector
+
+var databaseAdapters = map[string]DatabaseDialectorFunc{}
+var databaseAdaptersLock sync.RWMutex
+
+// RegisterDatabaseAdapter wires an adapter name used in secret.DatabaseMeta.Adapter to a gorm dialector,
+// so drivers like sqlserver or clickhouse can be used without changes to this package.
+// Registered adapters take precedence over the built-in mysql, postgres and sqlite adapters.
+// ConnParams pool settings are applied to the resulting connection pool for every adapter.
+func RegisterDatabaseAdapter(name string, dialector DatabaseDialectorFunc) {
+	databaseAdaptersLock.Lock()
+	defer databaseAdaptersLock.Unlock()
+	if dialector == nil {
+		delete(databaseAdapters, name)
+		return
 	}
 
-	var db *gorm.DB
-	var err error
+	databaseAdapters[name] = dialector
+}
+
+func lookupDatabaseAdapter(name string) DatabaseDialectorFunc {
+	databaseAdaptersLock.RLock()
+	defer databaseAdaptersLock.RUnlock()
+	return databaseAdapters[name]
+}
+
+// newSqliteDialector opens the built-in sqlite adapter, nil in builds without cgo or with the nosqlite tag, see
+// database_sqlite.go.
+var newSqliteDialector func(dsn string) gorm.Dialector
+
+// sqliteMemoryPath is the database name opening a private in-memory SQLite database.
+const sqliteMemoryPath = ":memory:"
+
+// buildSqliteDSN uses DBName as the database file path, an empty name opens an in-memory database.
+// Of the ConnParams only Timeout (as busy timeout), Loc and ExtraParams apply to SQLite.
+func buildSqliteDSN(dbName string, params ConnParams) string {
+	if dbName == "" {
+		dbName = sqliteMemoryPath
+	}
+
+	var query []string
+	if timeout, err := time.ParseDuration(params.Timeout); err == nil && timeout > 0 {
+		query = append(query, fmt.Sprintf("_busy_timeout=%d", timeout.Milliseconds()))
+	}
+
+	if strings.EqualFold(params.Loc, "local") {
+		query = append(query, "_loc=auto")
+	} else if params.Loc != "" {
+		query = append(query, "_loc="+params.Loc)
+	}
+
+	if extra := buildExtraParamsMysql(params.ExtraParams); extra != "" {
+		query = append(query, extra[1:])
+	}
+
+	if len(query) == 0 {
+		return dbName
+	}
+
+	separator := "?"
+	if strings.Contains(dbName, "?") {
+		separator = "&"
+	}
+
+	return dbName + separator + strings.Join(query, "&")
+}
+
+// isSqliteMemory reports whether the SQLite database name refers to an in-memory database.
+// Every connection to such a database sees its own empty database, so the pool is limited to one connection.
+func isSqliteMemory(dbName string) bool {
+	return dbName == "" || strings.HasPrefix(dbName, sqliteMemoryPath) || strings.Contains(dbName, "mode=memory")
+}
+
+// newDialector returns the dialector of a registered or built-in adapter,
+// ErrDatabaseAdapterNotSupported if the adapter is unknown.
+func newDialector(op *DatabaseOp) (gorm.Dialector, error) {
+	if adapter := lookupDatabaseAdapter(op.meta.Adapter); adapter != nil {
+		if dialector := adapter(op); dialector != nil {
+			return dialector, nil
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseAdapterNotSupported, op.meta.Adapter)
+	}
+
+	return newBuiltinDialector(op)
+}
+
+// newBuiltinDialector returns the dialector of the built-in adapters.
+func newBuiltinDialector(op *DatabaseOp) (gorm.Dialector, error) {
 	charset := func() string {
 		if op.ConnParams.Charset == "" {
 			return op.meta.Params.Charset
@@ -441,16 +878,40 @@ func newDBPool(op *DatabaseOp, retry int) *gorm.DB {
 
 	switch op.meta.Adapter {
 	case "mysql":
-		db, err = gorm.Open(mysql.New(mysql.Config{
-			DSN: buildMysqlDSN(
-				op.meta.Params.Username,
-				op.meta.Params.Password,
-				op.meta.Params.Host,
-				op.meta.Params.Port,
-				op.meta.Params.DBName,
-				charset,
-				op.ConnParams,
-			),
+		params := op.ConnParams
+		if tlsParam, fallback, err := mysqlTLSParam(op.meta); err != nil {
+			return nil, fmt.Errorf("mysql tls config: %w", err)
+		} else if tlsParam != "" {
+			params.TLS = tlsParam
+			if fallback {
+				params.ExtraParams = maps.Clone(params.ExtraParams)
+				if params.ExtraParams == nil {
+					params.ExtraParams = map[string]string{}
+				}
+
+				params.ExtraParams["allowFallbackToPlaintext"] = "true"
+			}
+		}
+
+		dsn := buildMysqlDSN(
+			op.meta.Params.Username,
+			op.meta.Params.Password,
+			op.meta.Params.Host,
+			op.meta.Params.Port,
+			op.meta.Params.DBName,
+			charset,
+			params,
+		)
+
+		if op.meta.Params.Socket != "" {
+			dsn = buildMysqlSocketDSN(op.meta.Params.Username, op.meta.Params.Password, op.meta.Params.Socket, op.meta.Params.DBName, charset, params)
+		} else if op.Dialer != nil {
+			addr := fmt.Sprintf("%s(%s:%d)", op.mysqlDialNetwork(), op.meta.Params.Host, op.meta.Params.Port)
+			dsn = buildMysqlAddrDSN(op.meta.Params.Username, op.meta.Params.Password, addr, op.meta.Params.DBName, charset, params)
+		}
+
+		return mysql.New(mysql.Config{
+			DSN:                           dsn,
 			DriverName:                    op.MysqlParams.DriverName,
 			ServerVersion:                 op.MysqlParams.ServerVersion,
 			SkipInitializeWithVersion:     op.MysqlParams.SkipInitializeWithVersion,
@@ -464,7 +925,7 @@ func newDBPool(op *DatabaseOp, retry int) *gorm.DB {
 			DontSupportNullAsDefaultValue: op.MysqlParams.DontSupportNullAsDefaultValue,
 			DontSupportRenameColumnUnique: op.MysqlParams.DontSupportRenameColumnUnique,
 			DontSupportDropConstraint:     op.MysqlParams.DontSupportDropConstraint,
-		}), &op.GORMParams)
+		}), nil
 	case "postgres", "postgresql":
 		sslMode := op.ConnParams.SSLMode
 		if sslMode == "" {
@@ -478,30 +939,74 @@ func newDBPool(op *DatabaseOp, retry int) *gorm.DB {
 			timeZone = "UTC"
 		}
 
-		db, err = gorm.Open(postgres.New(buildPostgresDialectorConfig(op.meta, op.ConnParams, sslMode, timeZone)), &op.GORMParams)
+		return postgres.New(buildPostgresDialectorConfig(op.meta, op.ConnParams, sslMode, timeZone)), nil
+	case "sqlite", "sqlite3":
+		if newSqliteDialector == nil {
+			return nil, fmt.Errorf("%w: %s requires cgo, register a pure Go driver with RegisterDatabaseAdapter",
+				ErrDatabaseAdapterNotSupported, op.meta.Adapter)
+		}
+
+		return newSqliteDialector(buildSqliteDSN(op.meta.Params.DBName, op.ConnParams)), nil
 	default:
-		kklogger.ErrorJ("datastore:Database.newDBPool", "database adapter not support")
-		return nil
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseAdapterNotSupported, op.meta.Adapter)
 	}
+}
 
+func newDBPool(op *DatabaseOp) *gorm.DB {
+	db, err := openDBPool(context.Background(), op)
 	if err != nil {
 		kklogger.ErrorJ("datastore:Database.newDBPool", err.Error())
-		fmt.Println(err.Error())
-		retry += 1
-		if retry >= 5 {
-			kklogger.ErrorJ("datastore:Database.newDBPool", "database retry too many times(> 5)")
-			fmt.Println("database retry too many times(> 5)")
-			return nil
+		return nil
+	}
+
+	return db
+}
+
+// openDBPool opens and configures a pool, retrying with the op RetryPolicy until ctx is done.
+// Opening is abandoned when ctx ends, a pool opened late is closed in the background.
+func openDBPool(ctx context.Context, op *DatabaseOp) (*gorm.DB, error) {
+	// Add nil check for op parameter to prevent panic
+	if op == nil {
+		return nil, ErrDatabaseOpNil
+	}
+
+	dialector, err := newDialector(op)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := op.RetryPolicy
+	if policy.Attempts == 0 {
+		policy = DefaultDatabaseRetryPolicy
+	}
+
+	var db *gorm.DB
+	if err := policy.Do(ctx, func() (err error) {
+		if db, err = openGormDB(ctx, dialector, &op.GORMParams); err != nil {
+			kklogger.ErrorJ("datastore:Database.newDBPool", err.Error())
+			fmt.Println(err.Error())
 		}
 
-		time.Sleep(time.Second * 1)
-		return newDBPool(op, retry)
+		return err
+	}); err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("database retry too many times(%d): %w", policy.Attempts, err)
 	}
 
-	if sqlDb, err := db.DB(); err != nil {
-		kklogger.ErrorJ("datastore:Database.newDBPool", err.Error())
-		fmt.Println(err.Error())
-		return nil
+	sqlDb, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	if (op.meta.Adapter == "sqlite" || op.meta.Adapter == "sqlite3") && isSqliteMemory(op.meta.Params.DBName) {
+		// Closing the only connection drops the in-memory database, keep it open for the pool lifetime
+		sqlDb.SetMaxOpenConns(1)
+		sqlDb.SetMaxIdleConns(1)
+		sqlDb.SetConnMaxLifetime(0)
+		sqlDb.SetConnMaxIdleTime(0)
 	} else {
 		sqlDb.SetMaxOpenConns(op.ConnParams.MaxOpenConn)
 		sqlDb.SetMaxIdleConns(op.ConnParams.MaxIdleConn)
@@ -513,5 +1018,69 @@ func newDBPool(op *DatabaseOp, retry int) *gorm.DB {
 		db.Logger = op.Logger
 	}
 
-	return db
+	// The stats logger is installed on every pool so EnableQueryStats applies to it without a rebuild
+	db.Logger = &databaseStatsLogger{Interface: db.Logger, stats: &op.stats}
+
+	if err := applyDatabaseExtensions(db, op); err != nil {
+		sqlDb.Close()
+		return nil, err
+	}
+
+	if len(op.replicas) > 0 {
+		if err := op.registerResolver(db); err != nil {
+			kklogger.ErrorJ("datastore:Database.newDBPool", fmt.Sprintf("read/write splitting disabled: %s", err.Error()))
+		}
+	}
+
+	return db, nil
+}
+
+// openGormDB runs gorm.Open, which dials and pings without a context, bounded by ctx.
+func openGormDB(ctx context.Context, dialector gorm.Dialector, config *gorm.Config) (*gorm.DB, error) {
+	if ctx.Done() == nil {
+		return gorm.Open(dialector, config)
+	}
+
+	type result struct {
+		db  *gorm.DB
+		err error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		db, err := gorm.Open(dialector, config)
+		done <- result{db: db, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.db, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				if sqlDb, err := r.db.DB(); err == nil {
+					sqlDb.Close()
+				}
+			}
+		}()
+
+		return nil, ctx.Err()
+	}
+}
+
+// applyDatabaseExtensions initializes the plugins and callbacks of the op on a new pool.
+func applyDatabaseExtensions(db *gorm.DB, op *DatabaseOp) error {
+	for _, plugin := range op.Plugins {
+		if err := db.Use(plugin); err != nil {
+			return fmt.Errorf("plugin %s: %w", plugin.Name(), err)
+		}
+	}
+
+	for _, callback := range op.Callbacks {
+		if err := callback(db); err != nil {
+			return fmt.Errorf("callback: %w", err)
+		}
+	}
+
+	return nil
 }
@@ -1,6 +1,9 @@
 package datastore
 
 import (
+	"context"
+	"database/sql"
+
 	secret "github.com/yetiz-org/goth-datastore/secrets"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -9,10 +12,15 @@ import (
 // DatabaseOperator defines the interface for database operations.
 // This interface allows for both real and mock implementations,
 // enabling comprehensive unit testing while maintaining API compatibility.
+// Storage layers should accept a DatabaseOperator (or DatabaseProvider) rather than *DatabaseOp,
+// so tests can pass a *MockDatabaseOp without type assertions.
 type DatabaseOperator interface {
 	// Core database access
 	DB() *gorm.DB
+	DBContext(ctx context.Context) (*gorm.DB, error)
+	SQLDB() (*sql.DB, error)
 	Adapter() string
+	Ping(ctx context.Context) error
 
 	// Configuration access
 	GetConnParams() ConnParams
@@ -34,3 +42,10 @@ type DatabaseProvider interface {
 	Writer() DatabaseOperator
 	Reader() DatabaseOperator
 }
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ DatabaseOperator = (*DatabaseOp)(nil)
+	_ DatabaseOperator = (*MockDatabaseOp)(nil)
+	_ DatabaseProvider = (*Database)(nil)
+)
@@ -0,0 +1,554 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// DefaultDatabaseMigrationTable is the table recording applied migration versions.
+var DefaultDatabaseMigrationTable = "schema_migrations"
+
+// DefaultDatabaseMigrationLockTimeout is the time in seconds a Migrator waits for the lock held by another instance.
+var DefaultDatabaseMigrationLockTimeout = 60
+
+// databaseMigrationLockInterval is the wait between two attempts of the PostgreSQL lock.
+var databaseMigrationLockInterval = 500 * time.Millisecond
+
+func init() {
+	envStr("GOTH_DEFAULT_DATABASE_MIGRATION_TABLE", &DefaultDatabaseMigrationTable)
+	envInt("GOTH_DEFAULT_DATABASE_MIGRATION_LOCK_TIMEOUT", &DefaultDatabaseMigrationLockTimeout)
+}
+
+// Migration is a versioned schema change. Up and Down take precedence over UpSQL and DownSQL.
+// Each migration runs in its own transaction together with the update of the migration table. MySQL commits DDL
+// statements implicitly, so a MySQL migration with DDL is not atomic: a failure leaves the statements before it
+// applied and the version unrecorded, keep such migrations to a single DDL statement or make them safe to rerun.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	UpSQL   string
+	DownSQL string
+}
+
+func (m Migration) hasUp() bool {
+	return m.Up != nil || strings.TrimSpace(m.UpSQL) != ""
+}
+
+func (m Migration) hasDown() bool {
+	return m.Down != nil || strings.TrimSpace(m.DownSQL) != ""
+}
+
+// schemaMigration is a row of the migration table.
+type schemaMigration struct {
+	Version   int64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// Migrator applies versioned migrations on a writer DatabaseOperator.
+// A lock (GET_LOCK on MySQL, advisory lock on PostgreSQL) prevents instances from migrating concurrently, the
+// migrations run on the connection holding it so a pool of a single connection does not wait for itself.
+type Migrator struct {
+	op         DatabaseOperator
+	table      string
+	migrations map[int64]Migration
+	// DryRun logs the migrations that would run without executing them
+	DryRun bool
+}
+
+// NewMigrator creates a Migrator on the operator, usually Database.Writer().
+func NewMigrator(op DatabaseOperator) *Migrator {
+	return &Migrator{
+		op:         op,
+		table:      DefaultDatabaseMigrationTable,
+		migrations: map[int64]Migration{},
+	}
+}
+
+// Register adds Go migrations, a version can only be registered once.
+func (m *Migrator) Register(migrations ...Migration) error {
+	for _, migration := range migrations {
+		if _, ok := m.migrations[migration.Version]; ok {
+			return fmt.Errorf("migration version %d registered twice", migration.Version)
+		}
+
+		m.migrations[migration.Version] = migration
+	}
+
+	return nil
+}
+
+// LoadFS registers SQL migrations in dir named <version>_<name>.up.sql and <version>_<name>.down.sql.
+func (m *Migrator) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	loaded := map[int64]Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		version, name, direction, err := parseMigrationFileName(entry.Name())
+		if err != nil {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		migration := loaded[version]
+		if migration.Name != "" && migration.Name != name {
+			return fmt.Errorf("migration version %d has different names %s and %s", version, migration.Name, name)
+		}
+
+		migration.Version, migration.Name = version, name
+		if direction == "up" {
+			migration.UpSQL = string(content)
+		} else {
+			migration.DownSQL = string(content)
+		}
+
+		loaded[version] = migration
+	}
+
+	versions := make([]int64, 0, len(loaded))
+	for version := range loaded {
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	for _, version := range versions {
+		if err := m.Register(loaded[version]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseMigrationFileName(fileName string) (int64, string, string, error) {
+	base := strings.TrimSuffix(fileName, ".sql")
+	direction := path.Ext(base)
+	if direction != ".up" && direction != ".down" {
+		return 0, "", "", fmt.Errorf("migration file %s must end with .up.sql or .down.sql", fileName)
+	}
+
+	base = strings.TrimSuffix(base, direction)
+	versionPart, name, _ := strings.Cut(base, "_")
+	version, err := strconv.ParseInt(versionPart, 10, 64)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("migration file %s must start with a numeric version", fileName)
+	}
+
+	return version, name, direction[1:], nil
+}
+
+// Up applies all pending migrations in version order and returns the applied ones.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.Steps(ctx, len(m.migrations))
+}
+
+// Down reverts the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) ([]Migration, error) {
+	return m.Steps(ctx, -1)
+}
+
+// Steps applies the next n pending migrations when n > 0, or reverts the last -n applied migrations when n < 0.
+func (m *Migrator) Steps(ctx context.Context, n int) ([]Migration, error) {
+	db, err := m.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db, unlock, err := m.lock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []Migration
+	if n >= 0 {
+		for _, migration := range m.sorted() {
+			if len(plan) == n {
+				break
+			}
+
+			if _, ok := applied[migration.Version]; !ok {
+				plan = append(plan, migration)
+			}
+		}
+	} else {
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		for _, version := range versions {
+			if len(plan) == -n {
+				break
+			}
+
+			migration, ok := m.migrations[version]
+			if !ok {
+				return nil, fmt.Errorf("applied migration version %d is not registered", version)
+			}
+
+			plan = append(plan, migration)
+		}
+	}
+
+	var done []Migration
+	for _, migration := range plan {
+		if err := m.run(db, migration, n >= 0); err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Pending returns the registered migrations not applied yet, in version order.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	db, err := m.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.sorted() {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) db(ctx context.Context) (*gorm.DB, error) {
+	db, err := m.op.DBContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The migration table must be read from the writer when read/write splitting is enabled
+	return db.WithContext(ctx).Clauses(dbresolver.Write).Session(&gorm.Session{}), nil
+}
+
+func (m *Migrator) sorted() []Migration {
+	migrations := make([]Migration, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+// applied reads the migration table in a transaction, which keeps the statements on the locked connection when
+// read/write splitting would send them to the pool otherwise.
+func (m *Migrator) applied(db *gorm.DB) (map[int64]schemaMigration, error) {
+	applied := map[int64]schemaMigration{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !tx.Migrator().HasTable(m.table) {
+			if m.DryRun {
+				return nil
+			}
+
+			if err := tx.Table(m.table).AutoMigrate(&schemaMigration{}); err != nil {
+				return err
+			}
+		}
+
+		var rows []schemaMigration
+		if err := tx.Table(m.table).Find(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			applied[row.Version] = row
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) run(db *gorm.DB, migration Migration, up bool) error {
+	direction, fn, script := "up", migration.Up, migration.UpSQL
+	if !up {
+		direction, fn, script = "down", migration.Down, migration.DownSQL
+	}
+
+	if (up && !migration.hasUp()) || (!up && !migration.hasDown()) {
+		return fmt.Errorf("migration %d_%s has no %s step", migration.Version, migration.Name, direction)
+	}
+
+	if m.DryRun {
+		kklogger.InfoJ("datastore:Migrator.run", fmt.Sprintf("dry-run %s %d_%s\n%s", direction, migration.Version, migration.Name, script))
+		return nil
+	}
+
+	kklogger.InfoJ("datastore:Migrator.run", fmt.Sprintf("%s %d_%s", direction, migration.Version, migration.Name))
+	return db.Transaction(func(tx *gorm.DB) error {
+		if fn != nil {
+			if err := fn(tx); err != nil {
+				return err
+			}
+		} else {
+			for _, statement := range splitSQLStatements(script, m.op.Adapter()) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return fmt.Errorf("migration %d_%s %s: %w", migration.Version, migration.Name, direction, err)
+				}
+			}
+		}
+
+		if up {
+			return tx.Table(m.table).Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		}
+
+		return tx.Table(m.table).Where("version = ?", migration.Version).Delete(&schemaMigration{}).Error
+	})
+}
+
+// lock takes the cross-instance migration lock on a dedicated connection, and returns db bound to the connection
+// with the release function. PostgreSQL polls pg_try_advisory_lock so it gives up after the timeout of GET_LOCK.
+func (m *Migrator) lock(ctx context.Context, db *gorm.DB) (*gorm.DB, func(), error) {
+	var lockSQL, unlockSQL string
+	var args []interface{}
+	lockName := "goth-datastore:" + m.table
+	switch m.op.Adapter() {
+	case "mysql":
+		lockSQL, unlockSQL = "SELECT GET_LOCK(?, ?)", "SELECT RELEASE_LOCK(?)"
+		args = []interface{}{lockName, DefaultDatabaseMigrationLockTimeout}
+	case "postgres", "postgresql":
+		// The lock runs on a raw connection, pgx only understands numbered placeholders
+		lockSQL, unlockSQL = "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+		args = []interface{}{int64(crc32.ChecksumIEEE([]byte(lockName)))}
+	default:
+		return db, func() {}, nil
+	}
+
+	sqlDb, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := sqlDb.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var acquired bool
+	if m.op.Adapter() == "mysql" {
+		var result sql.NullInt64
+		if err := conn.QueryRowContext(ctx, lockSQL, args...).Scan(&result); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+
+		acquired = result.Int64 == 1
+	} else {
+		deadline := time.Now().Add(time.Duration(DefaultDatabaseMigrationLockTimeout) * time.Second)
+		for {
+			if err := conn.QueryRowContext(ctx, lockSQL, args...).Scan(&acquired); err != nil {
+				conn.Close()
+				return nil, nil, err
+			}
+
+			if acquired || !time.Now().Before(deadline) {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				conn.Close()
+				return nil, nil, ctx.Err()
+			case <-time.After(databaseMigrationLockInterval):
+			}
+		}
+	}
+
+	if !acquired {
+		conn.Close()
+		return nil, nil, fmt.Errorf("migration lock %s not acquired within %d seconds", lockName, DefaultDatabaseMigrationLockTimeout)
+	}
+
+	locked := db.Session(&gorm.Session{Context: ctx})
+	locked.Statement.ConnPool = conn
+	return locked, func() {
+		unlockArgs := args[:1]
+		if _, err := conn.ExecContext(context.Background(), unlockSQL, unlockArgs...); err != nil {
+			kklogger.WarnJ("datastore:Migrator.lock", err.Error())
+		}
+
+		conn.Close()
+	}, nil
+}
+
+// splitSQLStatements splits a script on semicolons outside of quotes, comments and, on PostgreSQL, dollar-quoted
+// bodies, so functions and triggers are kept whole. Comments are dropped except MySQL executable comments and
+// optimizer hints (/*! ... */, /*+ ... */), which are kept in their statement. "#" starts a comment and backslashes
+// escape quotes on MySQL only, PostgreSQL only honors them in E'...' strings.
+func splitSQLStatements(script string, adapter string) []string {
+	mysql := adapter == "mysql"
+	postgres := adapter == "postgres" || adapter == "postgresql"
+	var statements []string
+	var current strings.Builder
+	var quote rune
+	var dollarTag string
+	backslash, lineComment, blockComment, keepComment := false, false, false, false
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+
+		switch {
+		case lineComment:
+			if c == '\n' {
+				lineComment = false
+				current.WriteRune(c)
+			}
+			continue
+		case blockComment:
+			if keepComment {
+				current.WriteRune(c)
+			}
+
+			if c == '*' && next == '/' {
+				if keepComment {
+					current.WriteRune(next)
+				}
+
+				blockComment = false
+				i++
+			}
+			continue
+		case dollarTag != "":
+			if strings.HasPrefix(string(runes[i:]), dollarTag) {
+				current.WriteString(dollarTag)
+				i += len([]rune(dollarTag)) - 1
+				dollarTag = ""
+			} else {
+				current.WriteRune(c)
+			}
+			continue
+		case quote != 0:
+			current.WriteRune(c)
+			if c == '\\' && backslash && next != 0 {
+				current.WriteRune(next)
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch {
+		case c == '-' && next == '-', c == '#' && mysql:
+			lineComment = true
+		case c == '/' && next == '*':
+			blockComment = true
+			keepComment = mysql && i+2 < len(runes) && (runes[i+2] == '!' || runes[i+2] == '+')
+			if keepComment {
+				current.WriteString("/*")
+			}
+
+			i++
+		case c == '$' && postgres:
+			if tag := sqlDollarTag(runes[i:]); tag != "" && !sqlIdentifierRune(sqlPreviousRune(runes, i)) {
+				dollarTag = tag
+				current.WriteString(tag)
+				i += len([]rune(tag)) - 1
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			// E'' strings are the only PostgreSQL strings with backslash escapes
+			previous := sqlPreviousRune(runes, i)
+			backslash = mysql && c != '`' ||
+				postgres && c == '\'' && (previous == 'E' || previous == 'e') && !sqlIdentifierRune(sqlPreviousRune(runes, i-1))
+			current.WriteRune(c)
+		case c == ';':
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
+
+// sqlDollarTag returns the PostgreSQL dollar quote opening runes, $$ or $tag$, empty when there is none.
+func sqlDollarTag(runes []rune) string {
+	for i := 1; i < len(runes); i++ {
+		switch c := runes[i]; {
+		case c == '$':
+			return string(runes[:i+1])
+		case c == '_' || unicode.IsLetter(c) || i > 1 && unicode.IsDigit(c):
+		default:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func sqlPreviousRune(runes []rune, i int) rune {
+	if i <= 0 {
+		return 0
+	}
+
+	return runes[i-1]
+}
+
+func sqlIdentifierRune(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
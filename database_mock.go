@@ -1,6 +1,9 @@
 package datastore
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"sync"
 	"time"
 
@@ -30,10 +33,12 @@ type MockDatabaseOp struct {
 	// Response configuration
 	dbResponse          *gorm.DB
 	dbError             error
+	pingError           error
 	adapterResponse     string
 	returnNilDB         bool
 	simulateDBFailure   bool
 	simulateConnFailure bool
+	chaos               *mockChaos
 }
 
 // MockDatabaseCall represents a recorded database operation call.
@@ -74,6 +79,8 @@ func NewMockDatabaseOp() *MockDatabaseOp {
 
 // DB returns the configured mock database instance.
 func (m *MockDatabaseOp) DB() *gorm.DB {
+	chaosErr := m.injectChaos()
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -85,8 +92,16 @@ func (m *MockDatabaseOp) DB() *gorm.DB {
 		Result:    m.dbResponse,
 		Error:     m.dbError,
 	}
+	if chaosErr != nil {
+		call.Result = nil
+		call.Error = chaosErr
+	}
 	m.callHistory = append(m.callHistory, call)
 
+	if chaosErr != nil {
+		return nil
+	}
+
 	if m.returnNilDB {
 		return nil
 	}
@@ -102,6 +117,82 @@ func (m *MockDatabaseOp) DB() *gorm.DB {
 	return m.mockDB
 }
 
+// DBContext returns the configured mock database instance like DB(), failing with an error instead of nil:
+// the chaos or SetDBResponse error, ctx.Err() when ctx is done, or an error when a failure is simulated.
+func (m *MockDatabaseOp) DBContext(ctx context.Context) (*gorm.DB, error) {
+	chaosErr := m.injectChaos()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.dbCallCount++
+	db, err := m.dbResponse, m.dbError
+	if db == nil {
+		db = m.mockDB
+	}
+
+	switch {
+	case chaosErr != nil:
+		err = chaosErr
+	case err != nil:
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case m.returnNilDB || m.simulateDBFailure || db == nil:
+		err = fmt.Errorf("database pool not available")
+	}
+
+	if err != nil {
+		db = nil
+	}
+
+	m.callHistory = append(m.callHistory, MockDatabaseCall{
+		Timestamp: time.Now(),
+		Method:    "DBContext",
+		Args:      []interface{}{ctx},
+		Result:    db,
+		Error:     err,
+	})
+
+	return db, err
+}
+
+// SQLDB returns the *sql.DB of the configured mock database instance, failing like DBContext.
+func (m *MockDatabaseOp) SQLDB() (*sql.DB, error) {
+	db, err := m.DBContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return db.DB()
+}
+
+// Ping returns the error configured with SetPingError, failing like DB() when a failure is simulated.
+func (m *MockDatabaseOp) Ping(ctx context.Context) error {
+	chaosErr := m.injectChaos()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	err := m.pingError
+	switch {
+	case chaosErr != nil:
+		err = chaosErr
+	case err == nil && (m.returnNilDB || m.simulateDBFailure):
+		err = fmt.Errorf("database pool not available")
+	case err == nil && m.mockDB == nil && m.dbResponse == nil:
+		err = fmt.Errorf("database pool not available")
+	}
+
+	m.callHistory = append(m.callHistory, MockDatabaseCall{
+		Timestamp: time.Now(),
+		Method:    "Ping",
+		Args:      []interface{}{ctx},
+		Error:     err,
+	})
+
+	return err
+}
+
 // Adapter returns the configured adapter name.
 func (m *MockDatabaseOp) Adapter() string {
 	m.mutex.RLock()
@@ -193,6 +284,13 @@ func (m *MockDatabaseOp) SetDBResponse(db *gorm.DB, err error) {
 	m.dbError = err
 }
 
+// SetPingError configures the error returned by Ping.
+func (m *MockDatabaseOp) SetPingError(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pingError = err
+}
+
 // SetAdapterResponse sets the adapter name to return.
 func (m *MockDatabaseOp) SetAdapterResponse(adapter string) {
 	m.mutex.Lock()
@@ -221,6 +319,34 @@ func (m *MockDatabaseOp) SetReturnNilDB(returnNil bool) {
 	m.returnNilDB = returnNil
 }
 
+// EnableChaos injects latency, random failures and outages into DB() as described by config.
+// A failed call returns nil like SimulateDBFailure and records the injected error in the call history.
+func (m *MockDatabaseOp) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockDatabaseOp) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockDatabaseOp) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
 // Test helper methods
 
 // GetCallHistory returns all recorded method calls.
@@ -262,6 +388,7 @@ func (m *MockDatabaseOp) GetCallsByMethod(method string) []MockDatabaseCall {
 // NewMockDatabase creates a Database instance with mock operators.
 func NewMockDatabase() *Database {
 	return &Database{
+		name:   "mock-database",
 		writer: NewMockDatabaseOp(),
 		reader: NewMockDatabaseOp(),
 	}
@@ -270,6 +397,7 @@ func NewMockDatabase() *Database {
 // NewMockDatabaseWithOps creates a Database instance with custom mock operators.
 func NewMockDatabaseWithOps(writer, reader *MockDatabaseOp) *Database {
 	return &Database{
+		name:   "custom-mock-database",
 		writer: writer,
 		reader: reader,
 	}
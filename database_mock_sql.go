@@ -0,0 +1,383 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrMockUnexpectedSQL is returned for a statement of a MockSQL that is not its next expectation.
+var ErrMockUnexpectedSQL = errors.New("mock sql: unexpected statement")
+
+// MockSQL answers the statements of the *gorm.DB of NewMockSQL with the rows, results and errors of its
+// expectations, which the statements must meet in the order they were set. Queries run through the MySQL dialect of
+// gorm, without the transaction gorm otherwise wraps writes in; transactions opened by the code under test are
+// expected with ExpectBegin, ExpectCommit and ExpectRollback.
+type MockSQL struct {
+	mutex        sync.Mutex
+	expectations []*MockSQLExpectation
+	next         int
+	unexpected   []error
+}
+
+// MockSQLExpectation is a statement expected by a MockSQL, see ExpectQuery and ExpectExec.
+type MockSQLExpectation struct {
+	kind         string
+	pattern      string
+	sql          *regexp.Regexp
+	patternErr   error
+	args         []interface{}
+	hasArgs      bool
+	columns      []string
+	rows         [][]interface{}
+	lastInsertID int64
+	rowsAffected int64
+	err          error
+}
+
+// NewMockSQL returns a MockSQL and the *gorm.DB whose statements it answers.
+func NewMockSQL() (*MockSQL, *gorm.DB, error) {
+	mockSQL := &MockSQL{}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sql.OpenDB(mockSQLConnector{sql: mockSQL}),
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mockSQL, db, nil
+}
+
+// UseMockSQL makes DB and DBContext return the *gorm.DB of a new MockSQL, returned to set the expected statements.
+func (m *MockDatabaseOp) UseMockSQL() (*MockSQL, error) {
+	mockSQL, db, err := NewMockSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	m.SetMockDB(db)
+	return mockSQL, nil
+}
+
+// ExpectQuery expects a query whose SQL matches the regular expression sqlPattern, e.g. regexp.QuoteMeta of the
+// statement.
+func (s *MockSQL) ExpectQuery(sqlPattern string) *MockSQLExpectation {
+	return s.expect("query", sqlPattern)
+}
+
+// ExpectExec expects a statement run without rows, like INSERT or UPDATE, whose SQL matches sqlPattern.
+func (s *MockSQL) ExpectExec(sqlPattern string) *MockSQLExpectation {
+	return s.expect("exec", sqlPattern)
+}
+
+// ExpectBegin expects the start of a transaction.
+func (s *MockSQL) ExpectBegin() *MockSQLExpectation {
+	return s.expect("begin", "")
+}
+
+// ExpectCommit expects the commit of a transaction.
+func (s *MockSQL) ExpectCommit() *MockSQLExpectation {
+	return s.expect("commit", "")
+}
+
+// ExpectRollback expects the rollback of a transaction.
+func (s *MockSQL) ExpectRollback() *MockSQLExpectation {
+	return s.expect("rollback", "")
+}
+
+func (s *MockSQL) expect(kind, sqlPattern string) *MockSQLExpectation {
+	e := &MockSQLExpectation{kind: kind, pattern: sqlPattern}
+	e.sql, e.patternErr = regexp.Compile(sqlPattern)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// WithArgs requires the arguments of the statement, compared by their string form. MockAnyArg matches any value,
+// MockGlob and MockRegex match by pattern.
+func (e *MockSQLExpectation) WithArgs(args ...interface{}) *MockSQLExpectation {
+	e.args, e.hasArgs = args, true
+	return e
+}
+
+// WillReturnRows sets the rows returned by the query, each row holding a value per column.
+func (e *MockSQLExpectation) WillReturnRows(columns []string, rows ...[]interface{}) *MockSQLExpectation {
+	e.columns, e.rows = columns, rows
+	return e
+}
+
+// WillReturnResult sets the last insert id and the number of rows affected by the statement.
+func (e *MockSQLExpectation) WillReturnResult(lastInsertID, rowsAffected int64) *MockSQLExpectation {
+	e.lastInsertID, e.rowsAffected = lastInsertID, rowsAffected
+	return e
+}
+
+// WillReturnError fails the statement with err.
+func (e *MockSQLExpectation) WillReturnError(err error) *MockSQLExpectation {
+	e.err = err
+	return e
+}
+
+func (e *MockSQLExpectation) String() string {
+	if e.pattern == "" {
+		return e.kind
+	}
+
+	if e.hasArgs {
+		return fmt.Sprintf("%s %q with %v", e.kind, e.pattern, e.args)
+	}
+
+	return fmt.Sprintf("%s %q", e.kind, e.pattern)
+}
+
+func (e *MockSQLExpectation) matches(kind, query string, args []interface{}) bool {
+	if e.kind != kind {
+		return false
+	}
+
+	if e.pattern != "" && (e.patternErr != nil || !e.sql.MatchString(query)) {
+		return false
+	}
+
+	return !e.hasArgs || mockArgsMatch(e.args, args, true)
+}
+
+// AssertExpectations reports the expectations not met and the unexpected statements to t, returning true when
+// every expectation was met in order.
+func (s *MockSQL) AssertExpectations(t MockTestingT) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	ok := true
+	for _, e := range s.expectations[s.next:] {
+		if e.patternErr != nil {
+			t.Errorf("mock sql: invalid pattern of %s: %s", e, e.patternErr)
+		} else {
+			t.Errorf("mock sql: expected %s", e)
+		}
+
+		ok = false
+	}
+
+	for _, err := range s.unexpected {
+		t.Errorf("%s", err)
+		ok = false
+	}
+
+	return ok
+}
+
+// take returns the next expectation when the statement meets it.
+func (s *MockSQL) take(kind, query string, named []driver.NamedValue) (*MockSQLExpectation, error) {
+	args := make([]interface{}, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.next < len(s.expectations) && s.expectations[s.next].matches(kind, query, args) {
+		e := s.expectations[s.next]
+		s.next++
+		return e, e.err
+	}
+
+	expected := "no further statement"
+	if s.next < len(s.expectations) {
+		expected = s.expectations[s.next].String()
+	}
+
+	err := fmt.Errorf("%w: %s %q with %v, expected %s", ErrMockUnexpectedSQL, kind, strings.TrimSpace(query), args, expected)
+	s.unexpected = append(s.unexpected, err)
+	return nil, err
+}
+
+// mockSQLConnector opens the connections of the *sql.DB of a MockSQL.
+type mockSQLConnector struct {
+	sql *MockSQL
+}
+
+func (c mockSQLConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &mockSQLConn{sql: c.sql}, nil
+}
+
+func (c mockSQLConnector) Driver() driver.Driver {
+	return mockSQLDriver{}
+}
+
+type mockSQLDriver struct{}
+
+func (mockSQLDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("mock sql: connections are opened by NewMockSQL")
+}
+
+type mockSQLConn struct {
+	sql *MockSQL
+}
+
+func (c *mockSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &mockSQLStmt{conn: c, query: query}, nil
+}
+
+func (c *mockSQLConn) Close() error {
+	return nil
+}
+
+func (c *mockSQLConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *mockSQLConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.sql.take("begin", "", nil); err != nil {
+		return nil, err
+	}
+
+	return mockSQLTx{sql: c.sql}, nil
+}
+
+func (c *mockSQLConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := c.sql.take("query", query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &mockSQLRows{columns: e.columns}
+	for _, row := range e.rows {
+		values := make([]driver.Value, len(row))
+		for i, value := range row {
+			if values[i], err = driver.DefaultParameterConverter.ConvertValue(value); err != nil {
+				return nil, err
+			}
+		}
+
+		rows.rows = append(rows.rows, values)
+	}
+
+	return rows, nil
+}
+
+func (c *mockSQLConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := c.sql.take("exec", query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return mockSQLResult{lastInsertID: e.lastInsertID, rowsAffected: e.rowsAffected}, nil
+}
+
+func (c *mockSQLConn) Ping(ctx context.Context) error {
+	return nil
+}
+
+// CheckNamedValue converts the arguments like the default converter, keeping the values it rejects.
+func (c *mockSQLConn) CheckNamedValue(value *driver.NamedValue) error {
+	if converted, err := driver.DefaultParameterConverter.ConvertValue(value.Value); err == nil {
+		value.Value = converted
+	}
+
+	return nil
+}
+
+type mockSQLStmt struct {
+	conn  *mockSQLConn
+	query string
+}
+
+func (s *mockSQLStmt) Close() error {
+	return nil
+}
+
+func (s *mockSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *mockSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, mockSQLNamedValues(args))
+}
+
+func (s *mockSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, mockSQLNamedValues(args))
+}
+
+func (s *mockSQLStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *mockSQLStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func mockSQLNamedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+
+	return named
+}
+
+type mockSQLTx struct {
+	sql *MockSQL
+}
+
+func (t mockSQLTx) Commit() error {
+	_, err := t.sql.take("commit", "", nil)
+	return err
+}
+
+func (t mockSQLTx) Rollback() error {
+	_, err := t.sql.take("rollback", "", nil)
+	return err
+}
+
+type mockSQLResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r mockSQLResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r mockSQLResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type mockSQLRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *mockSQLRows) Columns() []string {
+	return r.columns
+}
+
+func (r *mockSQLRows) Close() error {
+	return nil
+}
+
+func (r *mockSQLRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,423 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+var (
+	// DefaultDatabaseOutboxTable is the table recording the events of an Outbox
+	DefaultDatabaseOutboxTable = "outbox_events"
+	// DefaultDatabaseOutboxBatchSize is the number of events an Outbox relay publishes at once
+	DefaultDatabaseOutboxBatchSize = 100
+	// DefaultDatabaseOutboxPollInterval is how long Outbox.Run waits when no event is pending
+	DefaultDatabaseOutboxPollInterval = time.Second
+	// DefaultDatabaseOutboxLease is how long the events claimed by a relay are hidden from the other relays,
+	// the events of a relay stopped before publishing them are published by another one after it
+	DefaultDatabaseOutboxLease = time.Minute
+	// DefaultDatabaseOutboxRetryDelay is the delay before the first retry of an event failing to publish,
+	// doubled on each attempt
+	DefaultDatabaseOutboxRetryDelay = time.Second
+	// DefaultDatabaseOutboxMaxAttempts is the number of publications of an event before it is left failed
+	DefaultDatabaseOutboxMaxAttempts = 10
+)
+
+func init() {
+	envStr("GOTH_DEFAULT_DATABASE_OUTBOX_TABLE", &DefaultDatabaseOutboxTable)
+	envInt("GOTH_DEFAULT_DATABASE_OUTBOX_BATCH_SIZE", &DefaultDatabaseOutboxBatchSize)
+	envMillis("GOTH_DEFAULT_DATABASE_OUTBOX_POLL_INTERVAL", &DefaultDatabaseOutboxPollInterval)
+	envMillis("GOTH_DEFAULT_DATABASE_OUTBOX_LEASE", &DefaultDatabaseOutboxLease)
+	envMillis("GOTH_DEFAULT_DATABASE_OUTBOX_RETRY_DELAY", &DefaultDatabaseOutboxRetryDelay)
+	envInt("GOTH_DEFAULT_DATABASE_OUTBOX_MAX_ATTEMPTS", &DefaultDatabaseOutboxMaxAttempts)
+}
+
+// OutboxEvent is an event of an Outbox, a row of its table. Record only needs Topic, the destination of the
+// event, Key and Payload.
+type OutboxEvent struct {
+	ID            uint64 `gorm:"primaryKey;autoIncrement"`
+	Topic         string `gorm:"size:255;not null"`
+	Key           string `gorm:"size:255"`
+	Payload       []byte
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	PublishedAt   *time.Time
+	LastError     string
+}
+
+// OutboxStats are the number of events of an Outbox by state.
+type OutboxStats struct {
+	// Pending is the number of events waiting to be published
+	Pending int64
+	// Published is the number of events published and not purged
+	Published int64
+	// Failed is the number of events which failed MaxAttempts times, see Outbox.Retry
+	Failed int64
+}
+
+// OutboxPublisher publishes the events of an Outbox.
+type OutboxPublisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// OutboxPublisherFunc is a function publishing the events of an Outbox.
+type OutboxPublisherFunc func(ctx context.Context, event *OutboxEvent) error
+
+// Publish calls f.
+func (f OutboxPublisherFunc) Publish(ctx context.Context, event *OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// Outbox implements the transactional outbox pattern, see NewOutbox: events are recorded in a table of the
+// database by the transaction changing the data they describe, and published by a relay once committed, so an
+// event is published if and only if its transaction commits.
+//
+// Delivery is at least once: an event published but not marked as such, e.g. because the relay stopped, is
+// published again, consumers should be idempotent, keyed by the id of the event. Events are claimed in the order
+// they were recorded but an event failing to publish is retried after the following ones. On MySQL and PostgreSQL
+// relays claim events with SKIP LOCKED, so several can run concurrently.
+type Outbox struct {
+	database  *Database
+	publisher OutboxPublisher
+	table     string
+	// BatchSize is the number of events claimed at once, DefaultDatabaseOutboxBatchSize when created
+	BatchSize int
+	// PollInterval is how long Run waits when no event is pending, DefaultDatabaseOutboxPollInterval when created
+	PollInterval time.Duration
+	// Lease is how long claimed events are hidden from other relays, DefaultDatabaseOutboxLease when created
+	Lease time.Duration
+	// MaxAttempts is the number of publications of an event before it is left failed, DefaultDatabaseOutboxMaxAttempts
+	// when created, 0 retries forever
+	MaxAttempts int
+	// RetryDelay returns the delay before an event failing to publish is retried, doubling
+	// DefaultDatabaseOutboxRetryDelay with each attempt when nil
+	RetryDelay func(event *OutboxEvent, err error) time.Duration
+}
+
+// NewOutbox returns an Outbox recording its events on the writer of database and publishing them with publisher.
+// The table must be created with Migrate.
+func NewOutbox(database *Database, publisher OutboxPublisher) *Outbox {
+	return &Outbox{
+		database:     database,
+		publisher:    publisher,
+		table:        DefaultDatabaseOutboxTable,
+		BatchSize:    DefaultDatabaseOutboxBatchSize,
+		PollInterval: DefaultDatabaseOutboxPollInterval,
+		Lease:        DefaultDatabaseOutboxLease,
+		MaxAttempts:  DefaultDatabaseOutboxMaxAttempts,
+	}
+}
+
+// Table returns the table of the events.
+func (o *Outbox) Table() string {
+	return o.table
+}
+
+// Migrate creates or updates the table of the events.
+func (o *Outbox) Migrate(ctx context.Context) error {
+	db, err := o.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Table(o.table).AutoMigrate(&OutboxEvent{})
+}
+
+// Record inserts events in tx, the transaction whose commit publishes them.
+func (o *Outbox) Record(tx *gorm.DB, events ...OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for i := range events {
+		if events[i].Topic == "" {
+			return fmt.Errorf("outbox event %d: topic empty", i)
+		}
+
+		events[i].ID, events[i].Attempts, events[i].PublishedAt, events[i].LastError = 0, 0, nil, ""
+		events[i].CreatedAt, events[i].NextAttemptAt = now, now
+	}
+
+	return tx.Table(o.table).Create(&events).Error
+}
+
+// Transaction runs fn with Database.WithTransaction and records the events it returns in the same transaction.
+func (o *Outbox) Transaction(ctx context.Context, fn func(tx *gorm.DB) ([]OutboxEvent, error)) error {
+	return o.database.WithTransaction(ctx, func(tx *gorm.DB) error {
+		events, err := fn(tx)
+		if err != nil {
+			return err
+		}
+
+		return o.Record(tx, events...)
+	})
+}
+
+// Relay publishes a batch of pending events and returns the number published. An event failing to publish is
+// retried after RetryDelay, the error is recorded in its LastError.
+func (o *Outbox) Relay(ctx context.Context) (int, error) {
+	published, _, err := o.relay(ctx)
+	return published, err
+}
+
+// Run relays the events until ctx is done, the batches following each other while events are pending.
+func (o *Outbox) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		_, claimed, err := o.relay(ctx)
+		if err != nil && ctx.Err() == nil {
+			kklogger.WarnJ("datastore:Outbox.Run", fmt.Sprintf("outbox %s: %s", o.table, err.Error()))
+		}
+
+		if err == nil && claimed >= o.batchSize() {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(o.PollInterval):
+		}
+	}
+}
+
+func (o *Outbox) relay(ctx context.Context) (int, int, error) {
+	db, err := o.db(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	events, err := o.claim(db)
+	if err != nil || len(events) == 0 {
+		return 0, 0, err
+	}
+
+	// Publications are recorded even when ctx is done while publishing
+	db = db.WithContext(context.WithoutCancel(ctx))
+	published := 0
+	for i := range events {
+		if ctx.Err() != nil {
+			return published, len(events), ctx.Err()
+		}
+
+		event := &events[i]
+		if err := o.publish(ctx, event); err != nil {
+			// The events left are published again once the lease expired
+			if ctx.Err() != nil {
+				return published, len(events), ctx.Err()
+			}
+
+			if err := o.fail(db, event, err); err != nil {
+				return published, len(events), err
+			}
+
+			continue
+		}
+
+		now := time.Now()
+		if err := db.Table(o.table).Where("id = ?", event.ID).Updates(map[string]interface{}{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"published_at": now,
+			"last_error":   "",
+		}).Error; err != nil {
+			return published, len(events), err
+		}
+
+		published++
+	}
+
+	return published, len(events), nil
+}
+
+// claim hides the next batch of pending events from the other relays for the lease.
+func (o *Outbox) claim(db *gorm.DB) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		query := o.pending(tx.Table(o.table)).Where("next_attempt_at <= ?", now).Order("id").Limit(o.batchSize())
+		switch o.database.Writer().Adapter() {
+		case "mysql", "postgres", "postgresql":
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		if err := query.Find(&events).Error; err != nil || len(events) == 0 {
+			return err
+		}
+
+		ids := make([]uint64, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+
+		return tx.Table(o.table).Where("id IN ?", ids).Update("next_attempt_at", now.Add(o.Lease)).Error
+	})
+
+	return events, err
+}
+
+func (o *Outbox) publish(ctx context.Context, event *OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("outbox publish panic: %v", r)
+		}
+	}()
+
+	return o.publisher.Publish(ctx, event)
+}
+
+func (o *Outbox) fail(db *gorm.DB, event *OutboxEvent, err error) error {
+	event.Attempts++
+	kklogger.WarnJ("datastore:Outbox.publish", fmt.Sprintf("outbox %s event %d attempt %d: %s", o.table, event.ID, event.Attempts, err.Error()))
+	return db.Table(o.table).Where("id = ?", event.ID).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": time.Now().Add(o.retryDelay(event, err)),
+		"last_error":      err.Error(),
+	}).Error
+}
+
+func (o *Outbox) retryDelay(event *OutboxEvent, err error) time.Duration {
+	if o.RetryDelay != nil {
+		return o.RetryDelay(event, err)
+	}
+
+	return DefaultDatabaseOutboxRetryDelay << min(max(event.Attempts-1, 0), 16)
+}
+
+func (o *Outbox) batchSize() int {
+	return max(o.BatchSize, 1)
+}
+
+// pending restricts query to the events waiting to be published.
+func (o *Outbox) pending(query *gorm.DB) *gorm.DB {
+	query = query.Where("published_at IS NULL")
+	if o.MaxAttempts > 0 {
+		query = query.Where("attempts < ?", o.MaxAttempts)
+	}
+
+	return query
+}
+
+// Stats returns the number of events by state.
+func (o *Outbox) Stats(ctx context.Context) (OutboxStats, error) {
+	var stats OutboxStats
+	db, err := o.db(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	if err := o.pending(db.Table(o.table)).Count(&stats.Pending).Error; err != nil {
+		return stats, err
+	}
+
+	if err := db.Table(o.table).Where("published_at IS NOT NULL").Count(&stats.Published).Error; err != nil {
+		return stats, err
+	}
+
+	if o.MaxAttempts > 0 {
+		err = db.Table(o.table).Where("published_at IS NULL AND attempts >= ?", o.MaxAttempts).Count(&stats.Failed).Error
+	}
+
+	return stats, err
+}
+
+// Failed returns up to limit events which failed MaxAttempts times, the oldest first.
+func (o *Outbox) Failed(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	if o.MaxAttempts <= 0 {
+		return events, nil
+	}
+
+	db, err := o.db(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Table(o.table).Where("published_at IS NULL AND attempts >= ?", o.MaxAttempts).Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// Retry makes the failed events ids pending again with their attempts reset.
+func (o *Outbox) Retry(ctx context.Context, ids ...uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	db, err := o.db(ctx)
+	if err != nil {
+		return err
+	}
+
+	return db.Table(o.table).Where("id IN ? AND published_at IS NULL", ids).Updates(map[string]interface{}{
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}).Error
+}
+
+// Purge deletes the events published before before and returns their number.
+func (o *Outbox) Purge(ctx context.Context, before time.Time) (int64, error) {
+	db, err := o.db(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	result := db.Table(o.table).Where("published_at IS NOT NULL AND published_at < ?", before).Delete(&OutboxEvent{})
+	return result.RowsAffected, result.Error
+}
+
+func (o *Outbox) db(ctx context.Context) (*gorm.DB, error) {
+	if o.database == nil || o.database.Writer() == nil {
+		return nil, fmt.Errorf("database writer not configured")
+	}
+
+	db, err := o.database.Writer().DBContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Events must be read from the writer when read/write splitting is enabled
+	return db.WithContext(ctx).Clauses(dbresolver.Write).Session(&gorm.Session{}), nil
+}
+
+// NewRedisListOutboxPublisher returns an OutboxPublisher pushing the payload of the events to the list named by
+// their topic with RPUSH.
+func NewRedisListOutboxPublisher(op RedisOperator) OutboxPublisher {
+	return OutboxPublisherFunc(func(ctx context.Context, event *OutboxEvent) error {
+		return op.RPush(event.Topic, event.Payload).Error
+	})
+}
+
+// NewRedisStreamOutboxPublisher returns an OutboxPublisher adding the events to the stream named by their topic
+// with XADD, with the fields id, key and payload. A maxLen above 0 trims the stream to about maxLen entries.
+func NewRedisStreamOutboxPublisher(op RedisOperator, maxLen int64) OutboxPublisher {
+	return OutboxPublisherFunc(func(ctx context.Context, event *OutboxEvent) error {
+		args := []interface{}{event.Topic}
+		if maxLen > 0 {
+			args = append(args, "MAXLEN", "~", maxLen)
+		}
+
+		args = append(args, "*", "id", strconv.FormatUint(event.ID, 10), "key", event.Key, "payload", event.Payload)
+		return op.Do("XADD", args...).Error
+	})
+}
+
+// OutboxEventIDHeader is the Kafka header holding the id of the events of NewKafkaOutboxPublisher.
+const OutboxEventIDHeader = "outbox-event-id"
+
+// NewKafkaOutboxPublisher returns an OutboxPublisher sending the events to the topic named by their topic, with
+// their key and the OutboxEventIDHeader header.
+func NewKafkaOutboxPublisher(producer KafkaProducerOperator) OutboxPublisher {
+	return OutboxPublisherFunc(func(ctx context.Context, event *OutboxEvent) error {
+		return producer.Send(ctx, KafkaMessage{
+			Topic:   event.Topic,
+			Key:     []byte(event.Key),
+			Value:   event.Payload,
+			Headers: []KafkaHeader{{Key: OutboxEventIDHeader, Value: []byte(strconv.FormatUint(event.ID, 10))}},
+		})
+	})
+}
@@ -0,0 +1,323 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// Reader balancing strategies for DefaultDatabaseReaderBalance.
+const (
+	DatabaseReaderBalanceRoundRobin = "round_robin"
+	// DatabaseReaderBalanceLeastConn picks the reader with the fewest in-use connections
+	DatabaseReaderBalanceLeastConn = "least_conn"
+)
+
+// DefaultDatabaseReaderBalance selects how Reader() spreads reads across multiple readers.
+var DefaultDatabaseReaderBalance = DatabaseReaderBalanceRoundRobin
+
+// DefaultDatabaseReaderHealthCheckInterval is the interval in milliseconds between reader health checks
+// when multiple readers are configured, 0 disables them.
+var DefaultDatabaseReaderHealthCheckInterval = 5000
+
+// DefaultDatabaseResolver registers gorm dbresolver on the writer with the readers as replicas,
+// so SELECTs on Writer().DB() are routed to replicas while writes and transactions stay on the writer.
+// Replica pools use the first reader's ConnParams and DefaultDatabaseReaderBalance.
+// Use Clauses(dbresolver.Write) for reads that must see the latest writes, including AutoMigrate.
+var DefaultDatabaseResolver = false
+
+// DefaultDatabaseReaderEjectTime is the time in milliseconds an unhealthy reader is skipped by Reader().
+var DefaultDatabaseReaderEjectTime = 30000
+
+const databasePingTimeout = 3 * time.Second
+
+// databasePoolDrainPoll is how often a drained pool is checked for connections in use.
+const databasePoolDrainPoll = 100 * time.Millisecond
+
+func init() {
+	envStr("GOTH_DEFAULT_DATABASE_READER_BALANCE", &DefaultDatabaseReaderBalance)
+	envInt("GOTH_DEFAULT_DATABASE_READER_HEALTH_CHECK_INTERVAL", &DefaultDatabaseReaderHealthCheckInterval)
+	envInt("GOTH_DEFAULT_DATABASE_READER_EJECT_TIME", &DefaultDatabaseReaderEjectTime)
+	envBool("GOTH_DEFAULT_DATABASE_RESOLVER", &DefaultDatabaseResolver)
+}
+
+// databaseReaderBalance picks a reader among replicas and tracks temporarily ejected ones.
+type databaseReaderBalance struct {
+	mutex    sync.Mutex
+	strategy string
+	next     int
+	ejected  map[DatabaseOperator]time.Time
+}
+
+func (b *databaseReaderBalance) pick(readers []DatabaseOperator) DatabaseOperator {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	candidates := make([]DatabaseOperator, 0, len(readers))
+	for _, reader := range readers {
+		if until, ok := b.ejected[reader]; !ok || now.After(until) {
+			candidates = append(candidates, reader)
+		}
+	}
+
+	// Serving from an unhealthy replica beats failing every read
+	if len(candidates) == 0 {
+		candidates = readers
+	}
+
+	start := b.next % len(candidates)
+	b.next++
+	if b.strategy != DatabaseReaderBalanceLeastConn {
+		return candidates[start]
+	}
+
+	// Ties are broken in round-robin order so idle replicas share the load
+	picked, least := candidates[start], -1
+	for i := range candidates {
+		reader := candidates[(start+i)%len(candidates)]
+		if inUse := databaseOperatorInUse(reader); least < 0 || inUse < least {
+			picked, least = reader, inUse
+		}
+	}
+
+	return picked
+}
+
+func (b *databaseReaderBalance) eject(reader DatabaseOperator, d time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.ejected == nil {
+		b.ejected = map[DatabaseOperator]time.Time{}
+	}
+
+	b.ejected[reader] = time.Now().Add(d)
+}
+
+func (b *databaseReaderBalance) restore(reader DatabaseOperator) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.ejected, reader)
+}
+
+// databaseOperatorInUse returns the in-use connections of a reader, 0 for mocks or pools not opened yet.
+func databaseOperatorInUse(reader DatabaseOperator) int {
+	op, ok := reader.(*DatabaseOp)
+	if !ok {
+		return 0
+	}
+
+	op.opLock.RLock()
+	db := op.db
+	op.opLock.RUnlock()
+	if db == nil {
+		return 0
+	}
+
+	sqlDb, err := db.DB()
+	if err != nil {
+		return 0
+	}
+
+	return sqlDb.Stats().InUse
+}
+
+// EjectReader makes Reader() skip the reader for DefaultDatabaseReaderEjectTime,
+// for callers detecting a broken replica before the next health check does.
+func (k *Database) EjectReader(reader DatabaseOperator) {
+	k.balance.eject(reader, time.Duration(DefaultDatabaseReaderEjectTime)*time.Millisecond)
+}
+
+// CheckReaders pings every reader, ejecting failing ones and restoring recovered ones.
+func (k *Database) CheckReaders() {
+	k.checkReaders(context.Background())
+}
+
+// checkReaders runs CheckReaders until ctx ends, a reader whose ping is cut short is left as is. Each ping, the open
+// of the pool included, is bounded by databasePingTimeout so a reader down does not hold back the others or Close.
+func (k *Database) checkReaders(ctx context.Context) {
+	for _, reader := range k.readers {
+		pingCtx, cancel := context.WithTimeout(ctx, databasePingTimeout)
+		err := reader.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			kklogger.WarnJ("datastore:Database.CheckReaders", fmt.Sprintf("reader %s:%d ejected: %s",
+				reader.Meta().Params.Host, reader.Meta().Params.Port, err.Error()))
+			k.EjectReader(reader)
+		} else {
+			k.balance.restore(reader)
+		}
+	}
+}
+
+// Name returns "database/<profile>".
+func (k *Database) Name() string {
+	return "database/" + k.name
+}
+
+// Ping pings the writer, opening its pool if needed.
+func (k *Database) Ping(ctx context.Context) error {
+	if k.writer == nil {
+		return fmt.Errorf("database writer not available")
+	}
+
+	return k.writer.Ping(ctx)
+}
+
+// Stats returns the sql.DBStats of the open writer and reader pools, pools are not opened for it.
+func (k *Database) Stats() DataStoreStats {
+	stats := DataStoreStats{}
+	readers := 0
+	for _, op := range k.operators() {
+		prefix := "writer"
+		if op != k.writer {
+			prefix = fmt.Sprintf("reader.%d", readers)
+			readers++
+		}
+
+		pool, ok := op.(*DatabaseOp)
+		if !ok {
+			continue
+		}
+
+		dbStats, ok := pool.poolStats()
+		if !ok {
+			continue
+		}
+
+		stats[prefix+".open_conns"] = float64(dbStats.OpenConnections)
+		stats[prefix+".in_use_conns"] = float64(dbStats.InUse)
+		stats[prefix+".idle_conns"] = float64(dbStats.Idle)
+		stats[prefix+".wait_count"] = float64(dbStats.WaitCount)
+		stats[prefix+".wait_duration"] = float64(dbStats.WaitDuration.Milliseconds())
+	}
+
+	return stats
+}
+
+// Close stops the reader health check and closes the open pools of the writer and readers.
+func (k *Database) Close() error {
+	if k.healthCancel != nil {
+		k.healthCancel()
+		<-k.healthDone
+	}
+
+	var errs []error
+	for _, op := range k.operators() {
+		if pool, ok := op.(*DatabaseOp); ok {
+			errs = append(errs, pool.closePool())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// operators returns the writer followed by the distinct readers.
+func (k *Database) operators() []DatabaseOperator {
+	operators := make([]DatabaseOperator, 0, len(k.readers)+2)
+	seen := map[DatabaseOperator]bool{}
+	for _, op := range append([]DatabaseOperator{k.writer, k.reader}, k.readers...) {
+		if op == nil || seen[op] {
+			continue
+		}
+
+		seen[op] = true
+		operators = append(operators, op)
+	}
+
+	return operators
+}
+
+// startReaderHealthCheck runs CheckReaders every DefaultDatabaseReaderHealthCheckInterval until Close.
+func (k *Database) startReaderHealthCheck() {
+	if DefaultDatabaseReaderHealthCheckInterval <= 0 {
+		return
+	}
+
+	interval := time.Duration(DefaultDatabaseReaderHealthCheckInterval) * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	k.healthCancel, k.healthDone = cancel, make(chan struct{})
+	go func() {
+		defer close(k.healthDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				k.checkReaders(ctx)
+			}
+		}
+	}()
+}
+
+// attachResolverReplicas hands the readers to the writer, which registers dbresolver once its pool is opened.
+func (k *Database) attachResolverReplicas() {
+	writer, ok := k.writer.(*DatabaseOp)
+	if !ok {
+		return
+	}
+
+	readers := k.readers
+	if len(readers) == 0 && k.reader != nil {
+		readers = []DatabaseOperator{k.reader}
+	}
+
+	for _, reader := range readers {
+		if op, ok := reader.(*DatabaseOp); ok {
+			writer.replicas = append(writer.replicas, op)
+		}
+	}
+}
+
+func (o *DatabaseOp) registerResolver(db *gorm.DB) error {
+	dialectors := make([]gorm.Dialector, 0, len(o.replicas))
+	for _, replica := range o.replicas {
+		dialector, err := newDialector(replica)
+		if err != nil {
+			return err
+		}
+
+		dialectors = append(dialectors, dialector)
+	}
+
+	policy := dbresolver.StrictRoundRobinPolicy()
+	if DefaultDatabaseReaderBalance == DatabaseReaderBalanceLeastConn {
+		policy = dbresolver.PolicyFunc(databaseLeastConnPolicy)
+	}
+
+	params := o.replicas[0].ConnParams
+	return db.Use(dbresolver.Register(dbresolver.Config{Replicas: dialectors, Policy: policy}).
+		SetMaxOpenConns(params.MaxOpenConn).
+		SetMaxIdleConns(params.MaxIdleConn).
+		SetConnMaxLifetime(time.Millisecond * time.Duration(params.ConnMaxLifetime)).
+		SetConnMaxIdleTime(time.Millisecond * time.Duration(params.ConnMaxIdleTime)))
+}
+
+// databaseLeastConnPolicy resolves to the replica pool with the fewest in-use connections.
+func databaseLeastConnPolicy(pools []gorm.ConnPool) gorm.ConnPool {
+	picked, least := pools[0], -1
+	for _, pool := range pools {
+		inUse := 0
+		if sqlDb, ok := pool.(*sql.DB); ok {
+			inUse = sqlDb.Stats().InUse
+		}
+
+		if least < 0 || inUse < least {
+			picked, least = pool, inUse
+		}
+	}
+
+	return picked
+}
@@ -0,0 +1,74 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDatabaseConnectionNotFound is returned by DatabaseConnection for names that are not registered.
+var ErrDatabaseConnectionNotFound = errors.New("database connection not found")
+
+var databaseConnections = map[string]DatabaseOperator{}
+var databaseConnectionsLock sync.RWMutex
+
+// SQLDB returns the *sql.DB behind the gorm pool, creating the pool if needed.
+// Libraries like sqlx or squirrel can share it instead of opening a second set of connections,
+// the pool is owned by the DatabaseOp and must not be closed by them. The pool is replaced when it fails
+// validation or its host addresses change, so SQLDB is a getter to call per unit of work rather than a handle to
+// keep: a replaced pool keeps serving for DefaultDatabasePoolDrainTimeout and is closed once idle after.
+func (o *DatabaseOp) SQLDB() (*sql.DB, error) {
+	db, err := o.DBContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return db.DB()
+}
+
+// DriverName returns the database/sql driver name of the adapter, as expected by sqlx.NewDb.
+// Unknown adapters, e.g. registered with RegisterDatabaseAdapter, return the adapter name.
+func (o *DatabaseOp) DriverName() string {
+	switch o.meta.Adapter {
+	case "mysql":
+		if o.MysqlParams.DriverName != "" {
+			return o.MysqlParams.DriverName
+		}
+
+		return "mysql"
+	case "postgres", "postgresql":
+		return "pgx"
+	case "sqlite", "sqlite3":
+		return "sqlite3"
+	default:
+		return o.meta.Adapter
+	}
+}
+
+// RegisterDatabaseConnection makes the pool of op available under name through DatabaseConnection,
+// so code without access to the Database instance can reuse it. A nil op unregisters the name.
+func RegisterDatabaseConnection(name string, op DatabaseOperator) {
+	databaseConnectionsLock.Lock()
+	defer databaseConnectionsLock.Unlock()
+	if op == nil {
+		delete(databaseConnections, name)
+		return
+	}
+
+	databaseConnections[name] = op
+}
+
+// DatabaseConnection returns the *sql.DB of the operator registered under name, opening its pool if needed.
+// Like SQLDB it is a getter, the returned pool is drained once the operator replaces it.
+func DatabaseConnection(name string) (*sql.DB, error) {
+	databaseConnectionsLock.RLock()
+	op := databaseConnections[name]
+	databaseConnectionsLock.RUnlock()
+	if op == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseConnectionNotFound, name)
+	}
+
+	return op.SQLDB()
+}
@@ -0,0 +1,11 @@
+//go:build cgo && !nosqlite
+
+package datastore
+
+import "gorm.io/driver/sqlite"
+
+// The built-in sqlite adapter uses github.com/mattn/go-sqlite3, which requires cgo. Builds without cgo or with the
+// nosqlite tag leave it out, a pure Go driver can be registered with RegisterDatabaseAdapter instead.
+func init() {
+	newSqliteDialector = sqlite.Open
+}
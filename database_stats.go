@@ -0,0 +1,227 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DefaultDatabaseQueryStats records query counts, errors and latencies per table and operation,
+// retrievable with DatabaseOp.QueryStats().
+var DefaultDatabaseQueryStats = false
+
+// DefaultDatabaseSlowQueryThreshold is the latency in milliseconds above which a query is logged as slow
+// while query stats are enabled, 0 disables slow query logging.
+var DefaultDatabaseSlowQueryThreshold = 200
+
+// DatabaseQueryLatencyBuckets are the upper bounds of the latency histogram in DatabaseQueryStat.Buckets.
+var DatabaseQueryLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+func init() {
+	envBool("GOTH_DEFAULT_DATABASE_QUERY_STATS", &DefaultDatabaseQueryStats)
+	envInt("GOTH_DEFAULT_DATABASE_SLOW_QUERY_THRESHOLD", &DefaultDatabaseSlowQueryThreshold)
+}
+
+// DatabaseQueryStat aggregates the queries of one operation on one table.
+type DatabaseQueryStat struct {
+	Table     string
+	Operation string
+	Count     int64
+	// Errors excludes gorm.ErrRecordNotFound
+	Errors       int64
+	Rows         int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+	// Buckets counts queries per DatabaseQueryLatencyBuckets bound, the last entry counts slower queries
+	Buckets []int64
+}
+
+// AvgLatency returns the mean query latency.
+func (s DatabaseQueryStat) AvgLatency() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	return s.TotalLatency / time.Duration(s.Count)
+}
+
+type databaseQueryStatKey struct {
+	table     string
+	operation string
+}
+
+// databaseQueryStats is shared by every pool of a DatabaseOp, so stats survive pool rebuilds.
+type databaseQueryStats struct {
+	mutex sync.Mutex
+	stats map[databaseQueryStatKey]*DatabaseQueryStat
+}
+
+func newDatabaseQueryStats() *databaseQueryStats {
+	return &databaseQueryStats{stats: map[databaseQueryStatKey]*DatabaseQueryStat{}}
+}
+
+func (s *databaseQueryStats) record(table, operation string, elapsed time.Duration, rows int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := databaseQueryStatKey{table: table, operation: operation}
+	stat, ok := s.stats[key]
+	if !ok {
+		stat = &DatabaseQueryStat{Table: table, Operation: operation, Buckets: make([]int64, len(DatabaseQueryLatencyBuckets)+1)}
+		s.stats[key] = stat
+	}
+
+	stat.Count++
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		stat.Errors++
+	}
+
+	if rows > 0 {
+		stat.Rows += rows
+	}
+
+	stat.TotalLatency += elapsed
+	if elapsed > stat.MaxLatency {
+		stat.MaxLatency = elapsed
+	}
+
+	bucket := sort.Search(len(DatabaseQueryLatencyBuckets), func(i int) bool {
+		return elapsed <= DatabaseQueryLatencyBuckets[i]
+	})
+
+	if bucket < len(stat.Buckets) {
+		stat.Buckets[bucket]++
+	}
+}
+
+func (s *databaseQueryStats) snapshot() []DatabaseQueryStat {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := make([]DatabaseQueryStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		copied := *stat
+		copied.Buckets = append([]int64(nil), stat.Buckets...)
+		result = append(result, copied)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Table != result[j].Table {
+			return result[i].Table < result[j].Table
+		}
+
+		return result[i].Operation < result[j].Operation
+	})
+
+	return result
+}
+
+func (s *databaseQueryStats) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stats = map[databaseQueryStatKey]*DatabaseQueryStat{}
+}
+
+// databaseStatsLogger wraps the gorm logger of a pool, recording every traced query before delegating while the
+// query stats of its DatabaseOp are enabled.
+type databaseStatsLogger struct {
+	logger.Interface
+	stats *atomic.Pointer[databaseQueryStats]
+}
+
+func (l *databaseStatsLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &databaseStatsLogger{Interface: l.Interface.LogMode(level), stats: l.stats}
+}
+
+func (l *databaseStatsLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	stats := l.stats.Load()
+	if stats == nil {
+		l.Interface.Trace(ctx, begin, fc, err)
+		return
+	}
+
+	elapsed := time.Since(begin)
+	sql, rows := fc()
+	operation, table := parseQueryTarget(sql)
+	stats.record(table, operation, elapsed, rows, err)
+	if threshold := time.Duration(DefaultDatabaseSlowQueryThreshold) * time.Millisecond; threshold > 0 && elapsed > threshold {
+		kklogger.WarnJ("datastore:DatabaseOp.SlowQuery", fmt.Sprintf("%s [%s] rows:%d", sql, elapsed, rows))
+	}
+
+	l.Interface.Trace(ctx, begin, func() (string, int64) { return sql, rows }, err)
+}
+
+var (
+	queryTableFromPattern   = regexp.MustCompile("(?is)\\bFROM\\s+([`\"\\[\\]\\w$.]+)")
+	queryTableIntoPattern   = regexp.MustCompile("(?is)\\bINTO\\s+([`\"\\[\\]\\w$.]+)")
+	queryTableUpdatePattern = regexp.MustCompile("(?is)^\\s*UPDATE\\s+([`\"\\[\\]\\w$.]+)")
+)
+
+// parseQueryTarget returns the upper-cased statement keyword and the main table of a query,
+// the table is empty when it cannot be determined, e.g. for a subquery in FROM.
+func parseQueryTarget(sql string) (operation, table string) {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "", ""
+	}
+
+	operation = strings.ToUpper(fields[0])
+	var pattern *regexp.Regexp
+	switch operation {
+	case "SELECT", "DELETE":
+		pattern = queryTableFromPattern
+	case "INSERT", "REPLACE":
+		pattern = queryTableIntoPattern
+	case "UPDATE":
+		pattern = queryTableUpdatePattern
+	default:
+		return operation, ""
+	}
+
+	if match := pattern.FindStringSubmatch(sql); match != nil {
+		table = strings.NewReplacer("`", "", "\"", "", "[", "", "]", "").Replace(match[1])
+	}
+
+	return operation, table
+}
+
+// EnableQueryStats starts recording query stats, including on an open pool.
+func (o *DatabaseOp) EnableQueryStats() {
+	o.stats.CompareAndSwap(nil, newDatabaseQueryStats())
+}
+
+// QueryStats returns the recorded stats sorted by table and operation, nil when stats are not enabled.
+func (o *DatabaseOp) QueryStats() []DatabaseQueryStat {
+	stats := o.stats.Load()
+	if stats == nil {
+		return nil
+	}
+
+	return stats.snapshot()
+}
+
+// ResetQueryStats clears the recorded stats.
+func (o *DatabaseOp) ResetQueryStats() {
+	if stats := o.stats.Load(); stats != nil {
+		stats.reset()
+	}
+}
@@ -1,22 +1,42 @@
 package datastore
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"log"
+	"math/big"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"path/filepath"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 type databaseCRUDRecord struct {
@@ -208,7 +228,7 @@ func TestNewDatabase(t *testing.T) {
 func TestNewDBPool(t *testing.T) {
 	t.Run("returns nil for nil DatabaseOp", func(t *testing.T) {
 		// Test the memory issue: newDBPool should handle nil op parameter
-		result := newDBPool(nil, 0)
+		result := newDBPool(nil)
 		assert.Nil(t, result)
 	})
 
@@ -224,7 +244,7 @@ func TestNewDBPool(t *testing.T) {
 			},
 		}
 
-		result := newDBPool(op, 0)
+		result := newDBPool(op)
 		assert.Nil(t, result)
 	})
 
@@ -240,7 +260,7 @@ func TestNewDBPool(t *testing.T) {
 			},
 		}
 
-		result := newDBPool(op, 0)
+		result := newDBPool(op)
 		assert.Nil(t, result)
 	})
 
@@ -419,7 +439,7 @@ func TestNewDBPool_NilCheck(t *testing.T) {
 		defer os.Setenv("LOG_LEVEL", oldLevel)
 
 		// This should not panic and should return nil
-		result := newDBPool(nil, 0)
+		result := newDBPool(nil)
 		assert.Nil(t, result)
 	})
 }
@@ -455,7 +475,7 @@ func BenchmarkNewDBPool_FailureCase(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		newDBPool(op, 0)
+		newDBPool(op)
 	}
 }
 
@@ -684,6 +704,1287 @@ func TestDatabasePostgresCRUD(t *testing.T) {
 	assert.False(t, db.Migrator().HasTable(&databaseCRUDRecord{}))
 }
 
+func TestDatabaseSQLiteCRUD(t *testing.T) {
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+
+	database := NewDatabase("sqlite-test")
+	if database == nil || database.Writer() == nil {
+		t.Skip("database not configured")
+	}
+
+	db := database.Writer().DB()
+	if db == nil {
+		t.Skip("sqlite driver not available")
+	}
+
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	// In-memory databases are limited to a single long-lived connection
+	assert.Equal(t, 1, sqlDB.Stats().MaxOpenConnections)
+
+	err = db.AutoMigrate(&databaseCRUDRecord{})
+	assert.NoError(t, err)
+	assert.True(t, db.Migrator().HasTable(&databaseCRUDRecord{}))
+
+	rec := &databaseCRUDRecord{Name: "sqlite"}
+	err = db.Create(rec).Error
+	assert.NoError(t, err)
+	assert.NotZero(t, rec.ID)
+
+	// Tables survive across pool usage since the connection is kept open
+	var found databaseCRUDRecord
+	assert.NoError(t, database.Writer().DB().First(&found, rec.ID).Error)
+	assert.Equal(t, "sqlite", found.Name)
+
+	// Reader opens its own in-memory database
+	assert.False(t, database.Reader().DB().Migrator().HasTable(&databaseCRUDRecord{}))
+
+	err = db.Delete(&databaseCRUDRecord{}, rec.ID).Error
+	assert.NoError(t, err)
+
+	var cnt int64
+	err = db.Model(&databaseCRUDRecord{}).Where("id = ?", rec.ID).Count(&cnt).Error
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), cnt)
+}
+
+func TestRegisterDatabaseAdapter(t *testing.T) {
+	var called *DatabaseOp
+	RegisterDatabaseAdapter("test-memory", func(op *DatabaseOp) gorm.Dialector {
+		called = op
+		return sqlite.Open(":memory:")
+	})
+	defer RegisterDatabaseAdapter("test-memory", nil)
+
+	meta := secret.DatabaseMeta{Adapter: "test-memory"}
+	op := &DatabaseOp{meta: meta, ConnParams: ConnParams{MaxOpenConn: 1, MaxIdleConn: 1}}
+	db := op.DB()
+	assert.NotNil(t, db)
+	assert.Equal(t, op, called)
+	assert.Equal(t, "sqlite", db.Dialector.Name())
+
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sqlDB.Stats().MaxOpenConnections)
+
+	t.Run("unregistered adapter is not supported", func(t *testing.T) {
+		RegisterDatabaseAdapter("test-memory", nil)
+		op := &DatabaseOp{meta: meta}
+		assert.Nil(t, newDBPool(op))
+	})
+}
+
+func TestDatabaseReaderBalancing(t *testing.T) {
+	healthyDB := func() *gorm.DB {
+		db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+		assert.NoError(t, err)
+		return db
+	}
+
+	t.Run("Round robin across readers", func(t *testing.T) {
+		r1, r2, r3 := NewMockDatabaseOp(), NewMockDatabaseOp(), NewMockDatabaseOp()
+		db := &Database{readers: []DatabaseOperator{r1, r2, r3}, reader: r1}
+
+		assert.Same(t, r1, db.Reader())
+		assert.Same(t, r2, db.Reader())
+		assert.Same(t, r3, db.Reader())
+		assert.Same(t, r1, db.Reader())
+	})
+
+	t.Run("Unhealthy readers are ejected", func(t *testing.T) {
+		r1, r2 := NewMockDatabaseOp(), NewMockDatabaseOp()
+		r1.SetMockDB(healthyDB())
+		// r2 has no database and fails its health check
+		db := &Database{readers: []DatabaseOperator{r1, r2}, reader: r1}
+
+		db.CheckReaders()
+		for i := 0; i < 4; i++ {
+			assert.Same(t, r1, db.Reader())
+		}
+
+		r2.SetMockDB(healthyDB())
+		db.CheckReaders()
+		assert.NotSame(t, db.Reader(), db.Reader())
+
+		// The health check runs until Close
+		interval := DefaultDatabaseReaderHealthCheckInterval
+		defer func() {
+			DefaultDatabaseReaderHealthCheckInterval = interval
+		}()
+
+		DefaultDatabaseReaderHealthCheckInterval = 1
+		db.startReaderHealthCheck()
+		assert.Eventually(t, func() bool { return len(r1.GetCallsByMethod("Ping")) > 2 }, time.Second, time.Millisecond)
+		assert.NoError(t, db.Close())
+		pings := len(r1.GetCallsByMethod("Ping"))
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, pings, len(r1.GetCallsByMethod("Ping")))
+		assert.NoError(t, db.Close())
+
+		// All readers ejected falls back to using them anyway
+		db.EjectReader(r1)
+		db.EjectReader(r2)
+		assert.NotNil(t, db.Reader())
+	})
+
+	t.Run("Close does not wait for a reader down", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		RegisterDatabaseAdapter("blocking", func(op *DatabaseOp) gorm.Dialector {
+			return &databaseBlockingDialector{Dialector: sqlite.Open(sqliteMemoryPath), release: release}
+		})
+		defer RegisterDatabaseAdapter("blocking", nil)
+
+		interval := DefaultDatabaseReaderHealthCheckInterval
+		defer func() {
+			DefaultDatabaseReaderHealthCheckInterval = interval
+		}()
+
+		down := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "blocking"}, RetryPolicy: RetryPolicy{Attempts: 5, Interval: time.Second}}
+		db := &Database{readers: []DatabaseOperator{down}, reader: down}
+		DefaultDatabaseReaderHealthCheckInterval = 1
+		db.startReaderHealthCheck()
+		time.Sleep(20 * time.Millisecond)
+
+		start := time.Now()
+		assert.NoError(t, db.Close())
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Least connections", func(t *testing.T) {
+		busy := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}, ConnParams: ConnParams{MaxOpenConn: 2, MaxIdleConn: 1}}
+		idle := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}, ConnParams: ConnParams{MaxOpenConn: 2, MaxIdleConn: 1}}
+		sqlDB, err := busy.DB().DB()
+		assert.NoError(t, err)
+		conn, err := sqlDB.Conn(context.Background())
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		db := &Database{readers: []DatabaseOperator{busy, idle}, reader: busy}
+		db.balance.strategy = DatabaseReaderBalanceLeastConn
+		for i := 0; i < 4; i++ {
+			assert.Same(t, idle, db.Reader())
+		}
+	})
+
+	t.Run("Readers from profile", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+
+		database := NewDatabase("sqlite-test")
+		assert.NotNil(t, database)
+		defer database.Close()
+
+		assert.Len(t, database.readers, 2)
+		assert.Same(t, database.readers[0], database.reader)
+		assert.NotSame(t, database.Reader(), database.Reader())
+	})
+}
+
+func TestDatabaseResolver(t *testing.T) {
+	dir := t.TempDir()
+	fileOp := func(name string) *DatabaseOp {
+		meta := secret.DatabaseMeta{Adapter: "sqlite"}
+		meta.Params.DBName = filepath.Join(dir, name)
+		op := newDatabaseOp(meta)
+		op.ConnParams.MaxOpenConn = 1
+		return op
+	}
+
+	// Seed both databases directly so routed reads are distinguishable
+	for _, name := range []string{"writer", "replica"} {
+		seed := fileOp(name + ".db").DB()
+		assert.NoError(t, seed.AutoMigrate(&databaseCRUDRecord{}))
+		assert.NoError(t, seed.Create(&databaseCRUDRecord{Name: name}).Error)
+	}
+
+	writer := fileOp("writer.db")
+	database := &Database{writer: writer, reader: fileOp("replica.db")}
+	database.attachResolverReplicas()
+	assert.Len(t, writer.replicas, 1)
+
+	db := writer.DB()
+	assert.NotNil(t, db)
+	assert.NoError(t, db.Create(&databaseCRUDRecord{Name: "writer"}).Error)
+
+	var names []string
+	assert.NoError(t, db.Model(&databaseCRUDRecord{}).Pluck("name", &names).Error)
+	assert.Equal(t, []string{"replica"}, names)
+
+	// Transactions stick to the writer
+	err := db.Transaction(func(tx *gorm.DB) error {
+		names = nil
+		return tx.Model(&databaseCRUDRecord{}).Pluck("name", &names).Error
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"writer", "writer"}, names)
+
+	names = nil
+	assert.NoError(t, db.Clauses(dbresolver.Write).Model(&databaseCRUDRecord{}).Pluck("name", &names).Error)
+	assert.Equal(t, []string{"writer", "writer"}, names)
+
+	t.Run("Least connections policy", func(t *testing.T) {
+		idle, err := sql.Open("sqlite3", ":memory:")
+		assert.NoError(t, err)
+		defer idle.Close()
+		busy, err := sql.Open("sqlite3", ":memory:")
+		assert.NoError(t, err)
+		defer busy.Close()
+		conn, err := busy.Conn(context.Background())
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		assert.Same(t, idle, databaseLeastConnPolicy([]gorm.ConnPool{busy, idle}))
+	})
+}
+
+func TestDatabaseWithTransaction(t *testing.T) {
+	originalPolicy := DefaultDatabaseTransactionRetryPolicy
+	defer func() {
+		DefaultDatabaseTransactionRetryPolicy = originalPolicy
+	}()
+	DefaultDatabaseTransactionRetryPolicy = RetryPolicy{Attempts: 4, Backoff: RetryBackoffExponentialJitter, Interval: time.Millisecond}
+
+	database := &Database{writer: &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}}
+	db := database.Writer().DB()
+	assert.NotNil(t, db)
+	assert.NoError(t, db.AutoMigrate(&databaseCRUDRecord{}))
+
+	countRecords := func() int64 {
+		var cnt int64
+		assert.NoError(t, db.Model(&databaseCRUDRecord{}).Count(&cnt).Error)
+		return cnt
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		err := database.WithTransaction(context.Background(), func(tx *gorm.DB) error {
+			return tx.Create(&databaseCRUDRecord{Name: "commit"}).Error
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), countRecords())
+	})
+
+	t.Run("Retry on deadlock then commit", func(t *testing.T) {
+		attempts := 0
+		err := database.WithTransaction(context.Background(), func(tx *gorm.DB) error {
+			attempts++
+			if err := tx.Create(&databaseCRUDRecord{Name: "retry"}).Error; err != nil {
+				return err
+			}
+
+			if attempts < 3 {
+				return &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+			}
+
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+		// Failed attempts were rolled back
+		assert.Equal(t, int64(2), countRecords())
+	})
+
+	t.Run("Retries exhausted", func(t *testing.T) {
+		attempts := 0
+		err := database.WithTransaction(context.Background(), func(tx *gorm.DB) error {
+			attempts++
+			return &pgconn.PgError{Code: "40001"}
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 4, attempts)
+	})
+
+	t.Run("Non-retryable error", func(t *testing.T) {
+		attempts := 0
+		err := database.WithTransaction(context.Background(), func(tx *gorm.DB) error {
+			attempts++
+			tx.Create(&databaseCRUDRecord{Name: "rollback"})
+			return errors.New("business error")
+		})
+		assert.EqualError(t, err, "business error")
+		assert.Equal(t, 1, attempts)
+		assert.Equal(t, int64(2), countRecords())
+	})
+
+	t.Run("Context cancelled during backoff", func(t *testing.T) {
+		DefaultDatabaseTransactionRetryPolicy.Interval = time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := database.WithTransaction(ctx, func(tx *gorm.DB) error {
+			return &mysqldriver.MySQLError{Number: 1205}
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Writer open bounded by context", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		RegisterDatabaseAdapter("blocking", func(op *DatabaseOp) gorm.Dialector {
+			return &databaseBlockingDialector{Dialector: sqlite.Open(sqliteMemoryPath), release: release}
+		})
+		defer RegisterDatabaseAdapter("blocking", nil)
+
+		blocking := &Database{writer: &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "blocking"}, RetryPolicy: RetryPolicy{Attempts: 3, Interval: time.Second}}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		assert.ErrorIs(t, blocking.WithTransaction(ctx, func(tx *gorm.DB) error { return nil }), context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Writer not configured", func(t *testing.T) {
+		assert.Error(t, (&Database{}).WithTransaction(context.Background(), func(tx *gorm.DB) error { return nil }))
+	})
+}
+
+func TestDatabaseOpPingAndValidate(t *testing.T) {
+	originalInterval := DefaultDatabaseValidateInterval
+	defer func() {
+		DefaultDatabaseValidateInterval = originalInterval
+	}()
+
+	op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+	assert.NoError(t, op.Ping(context.Background()))
+
+	t.Run("Broken pool is kept without validation", func(t *testing.T) {
+		DefaultDatabaseValidateInterval = 0
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+		db := op.DB()
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+		assert.Same(t, db, op.DB())
+		assert.Error(t, op.Ping(context.Background()))
+	})
+
+	t.Run("Broken pool is rebuilt", func(t *testing.T) {
+		DefaultDatabaseValidateInterval = 1
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+		db := op.DB()
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+		time.Sleep(2 * time.Millisecond)
+
+		rebuilt := op.DB()
+		assert.NotNil(t, rebuilt)
+		assert.NotSame(t, db, rebuilt)
+		assert.NoError(t, op.Ping(context.Background()))
+
+		// Healthy pool is kept
+		time.Sleep(2 * time.Millisecond)
+		assert.Same(t, rebuilt, op.DB())
+	})
+
+	t.Run("Bounded by context", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		RegisterDatabaseAdapter("blocking", func(op *DatabaseOp) gorm.Dialector {
+			return &databaseBlockingDialector{Dialector: sqlite.Open(sqliteMemoryPath), release: release}
+		})
+		defer RegisterDatabaseAdapter("blocking", nil)
+
+		// The open of the pool is bounded by ctx as well as the ping
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "blocking"}, RetryPolicy: RetryPolicy{Attempts: 5, Interval: time.Second}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		assert.ErrorIs(t, op.Ping(ctx), context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Mock ping", func(t *testing.T) {
+		mockOp := NewMockDatabaseOp()
+		assert.Error(t, mockOp.Ping(context.Background()))
+
+		mockOp.SetMockDB(&gorm.DB{})
+		assert.NoError(t, mockOp.Ping(context.Background()))
+
+		pingErr := errors.New("connection refused")
+		mockOp.SetPingError(pingErr)
+		assert.Equal(t, pingErr, mockOp.Ping(context.Background()))
+		assert.Len(t, mockOp.GetCallsByMethod("Ping"), 3)
+	})
+}
+
+type databaseTestPlugin struct {
+	initialized int
+	err         error
+}
+
+func (p *databaseTestPlugin) Name() string {
+	return "datastore:test"
+}
+
+func (p *databaseTestPlugin) Initialize(db *gorm.DB) error {
+	p.initialized++
+	return p.err
+}
+
+func TestDatabaseOpPluginsAndCallbacks(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		prepareStmt, skipDefaultTransaction, nowFunc := DefaultDatabasePrepareStmt, DefaultDatabaseSkipDefaultTransaction, DefaultDatabaseNowFunc
+		defer func() {
+			DefaultDatabasePrepareStmt, DefaultDatabaseSkipDefaultTransaction, DefaultDatabaseNowFunc = prepareStmt, skipDefaultTransaction, nowFunc
+		}()
+
+		fixed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		DefaultDatabasePrepareStmt = true
+		DefaultDatabaseSkipDefaultTransaction = true
+		DefaultDatabaseNowFunc = func() time.Time { return fixed }
+		op := newDatabaseOp(secret.DatabaseMeta{Adapter: "sqlite"})
+		assert.True(t, op.GORMParams.PrepareStmt)
+		assert.True(t, op.GORMParams.SkipDefaultTransaction)
+
+		db := op.DB()
+		assert.NotNil(t, db)
+		assert.Equal(t, fixed, db.NowFunc())
+		_, ok := db.ConnPool.(*gorm.PreparedStmtDB)
+		assert.True(t, ok)
+	})
+
+	t.Run("Registered before first use", func(t *testing.T) {
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+		plugin := &databaseTestPlugin{}
+		var creates int
+		op.Use(plugin)
+		op.RegisterCallback(func(db *gorm.DB) error {
+			return db.Callback().Create().Before("gorm:create").Register("datastore:test_count", func(tx *gorm.DB) {
+				creates++
+			})
+		})
+
+		db := op.DB()
+		assert.NotNil(t, db)
+		assert.Equal(t, 1, plugin.initialized)
+		assert.Contains(t, db.Plugins, plugin.Name())
+
+		assert.NoError(t, db.AutoMigrate(&databaseCRUDRecord{}))
+		assert.NoError(t, db.Create(&databaseCRUDRecord{Name: "a"}).Error)
+		assert.Equal(t, 1, creates)
+
+		// An open pool is extended in place, the queries running on it are not interrupted
+		sqlDB, err := db.DB()
+		assert.NoError(t, err)
+		op.Use(&databaseTestPluginB{})
+		var updates int
+		op.RegisterCallback(func(db *gorm.DB) error {
+			return db.Callback().Update().Before("gorm:update").Register("datastore:test_update", func(tx *gorm.DB) {
+				updates++
+			})
+		})
+
+		assert.Same(t, db, op.DB())
+		assert.Equal(t, 1, plugin.initialized)
+		assert.Contains(t, db.Plugins, "datastore:test_b")
+		assert.NoError(t, db.Model(&databaseCRUDRecord{}).Where("name = ?", "a").Update("name", "b").Error)
+		assert.Equal(t, 1, updates)
+		assert.NoError(t, sqlDB.Ping())
+	})
+
+	t.Run("Failing plugin", func(t *testing.T) {
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+		op.Use(&databaseTestPlugin{err: errors.New("boom")})
+		assert.Nil(t, op.DB())
+
+		op = &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+		op.RegisterCallback(func(db *gorm.DB) error { return errors.New("boom") })
+		assert.Nil(t, op.DB())
+	})
+}
+
+type databaseTestPluginB struct{}
+
+func (databaseTestPluginB) Name() string {
+	return "datastore:test_b"
+}
+
+func (databaseTestPluginB) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+func TestDatabaseOpQueryStats(t *testing.T) {
+	op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+	assert.Nil(t, op.QueryStats())
+	db := op.DB()
+	assert.NotNil(t, db)
+	assert.NoError(t, db.AutoMigrate(&databaseCRUDRecord{}))
+
+	// Enabling stats on an open pool keeps it
+	op.EnableQueryStats()
+	assert.Same(t, db, op.DB())
+	assert.Empty(t, op.QueryStats())
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, db.Create(&databaseCRUDRecord{Name: fmt.Sprintf("r%d", i)}).Error)
+	}
+
+	var records []databaseCRUDRecord
+	assert.NoError(t, db.Find(&records).Error)
+	assert.ErrorIs(t, db.First(&databaseCRUDRecord{}, 100).Error, gorm.ErrRecordNotFound)
+	assert.Error(t, db.Exec("SELECT * FROM missing_table").Error)
+	assert.NoError(t, db.Model(&databaseCRUDRecord{}).Where("id = ?", 1).Update("name", "x").Error)
+
+	stats := map[string]DatabaseQueryStat{}
+	for _, stat := range op.QueryStats() {
+		stats[stat.Table+" "+stat.Operation] = stat
+	}
+
+	insert := stats[databaseCRUDRecord{}.TableName()+" INSERT"]
+	assert.Equal(t, int64(3), insert.Count)
+	assert.Equal(t, int64(3), insert.Rows)
+	assert.Len(t, insert.Buckets, len(DatabaseQueryLatencyBuckets)+1)
+	var bucketed int64
+	for _, n := range insert.Buckets {
+		bucketed += n
+	}
+	assert.Equal(t, insert.Count, bucketed)
+	assert.True(t, insert.MaxLatency >= insert.AvgLatency())
+
+	selects := stats[databaseCRUDRecord{}.TableName()+" SELECT"]
+	assert.Equal(t, int64(2), selects.Count)
+	assert.Equal(t, int64(0), selects.Errors)
+	assert.Equal(t, int64(1), stats["missing_table SELECT"].Errors)
+	assert.Equal(t, int64(1), stats[databaseCRUDRecord{}.TableName()+" UPDATE"].Count)
+
+	op.ResetQueryStats()
+	assert.Empty(t, op.QueryStats())
+
+	t.Run("Parse query target", func(t *testing.T) {
+		cases := []struct{ sql, operation, table string }{
+			{"SELECT * FROM `users` WHERE id = 1", "SELECT", "users"},
+			{"select count(*) from \"public\".\"users\"", "SELECT", "public.users"},
+			{"INSERT INTO [orders] (id) VALUES (1)", "INSERT", "orders"},
+			{"  UPDATE users SET name='a'", "UPDATE", "users"},
+			{"DELETE FROM users WHERE id=1", "DELETE", "users"},
+			{"SELECT * FROM (SELECT 1) t", "SELECT", ""},
+			{"BEGIN", "BEGIN", ""},
+			{"", "", ""},
+		}
+
+		for _, c := range cases {
+			operation, table := parseQueryTarget(c.sql)
+			assert.Equal(t, c.operation, operation, c.sql)
+			assert.Equal(t, c.table, table, c.sql)
+		}
+	})
+}
+
+type databaseBlockingDialector struct {
+	gorm.Dialector
+	release chan struct{}
+}
+
+func (d *databaseBlockingDialector) Initialize(db *gorm.DB) error {
+	<-d.release
+	return d.Dialector.Initialize(db)
+}
+
+func TestDatabaseOpDBContext(t *testing.T) {
+	t.Run("Opens the pool", func(t *testing.T) {
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+		db, err := op.DBContext(context.Background())
+		assert.NoError(t, err)
+		assert.NotNil(t, db)
+		assert.Same(t, db, op.DB())
+	})
+
+	t.Run("Misconfiguration", func(t *testing.T) {
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "unsupported"}}
+		db, err := op.DBContext(context.Background())
+		assert.Nil(t, db)
+		assert.ErrorIs(t, err, ErrDatabaseAdapterNotSupported)
+
+		_, err = openDBPool(context.Background(), nil)
+		assert.ErrorIs(t, err, ErrDatabaseOpNil)
+	})
+
+	t.Run("Bounded by context", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		RegisterDatabaseAdapter("blocking", func(op *DatabaseOp) gorm.Dialector {
+			return &databaseBlockingDialector{Dialector: sqlite.Open(sqliteMemoryPath), release: release}
+		})
+		defer RegisterDatabaseAdapter("blocking", nil)
+
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "blocking"}, RetryPolicy: RetryPolicy{Attempts: 3, Interval: time.Second}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		db, err := op.DBContext(ctx)
+		assert.Nil(t, db)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("Waiters share the dial", func(t *testing.T) {
+		release := make(chan struct{})
+		var opened atomic.Int32
+		RegisterDatabaseAdapter("blocking", func(op *DatabaseOp) gorm.Dialector {
+			opened.Add(1)
+			return &databaseBlockingDialector{Dialector: sqlite.Open(sqliteMemoryPath), release: release}
+		})
+		defer RegisterDatabaseAdapter("blocking", nil)
+
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "blocking"}}
+		waited := make(chan *gorm.DB)
+		go func() {
+			db, _ := op.DBContext(context.Background())
+			waited <- db
+		}()
+
+		// A caller giving up does not cancel the dial of the others
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := op.DBContext(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		close(release)
+		db := <-waited
+		assert.NotNil(t, db)
+		assert.Same(t, db, op.DB())
+		assert.Equal(t, int32(1), opened.Load())
+	})
+
+	t.Run("Mock", func(t *testing.T) {
+		mock := NewMockDatabaseOp()
+		_, err := mock.DBContext(context.Background())
+		assert.Error(t, err)
+
+		gormDB := &gorm.DB{}
+		mock.SetDBResponse(gormDB, nil)
+		db, err := mock.DBContext(context.Background())
+		assert.NoError(t, err)
+		assert.Same(t, gormDB, db)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = mock.DBContext(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, "DBContext", mock.GetCallHistory()[2].Method)
+	})
+}
+
+func TestDatabaseOpSQLDB(t *testing.T) {
+	op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+	sqlDB, err := op.SQLDB()
+	assert.NoError(t, err)
+	gormSQLDB, err := op.DB().DB()
+	assert.NoError(t, err)
+	assert.Same(t, gormSQLDB, sqlDB)
+	assert.Equal(t, "sqlite3", op.DriverName())
+	assert.Equal(t, "pgx", (&DatabaseOp{meta: secret.DatabaseMeta{Adapter: "postgres"}}).DriverName())
+	assert.Equal(t, "mysql", (&DatabaseOp{meta: secret.DatabaseMeta{Adapter: "mysql"}}).DriverName())
+
+	t.Run("Named connection", func(t *testing.T) {
+		RegisterDatabaseConnection("billing", op)
+		defer RegisterDatabaseConnection("billing", nil)
+
+		named, err := DatabaseConnection("billing")
+		assert.NoError(t, err)
+		assert.Same(t, sqlDB, named)
+
+		// Connections through the shared pool see the same in-memory database
+		assert.NoError(t, op.DB().AutoMigrate(&databaseCRUDRecord{}))
+		_, err = named.Exec("INSERT INTO goth_datastore_database_crud_records (name) VALUES (?)", "shared")
+		assert.NoError(t, err)
+		var record databaseCRUDRecord
+		assert.NoError(t, op.DB().First(&record).Error)
+		assert.Equal(t, "shared", record.Name)
+
+		RegisterDatabaseConnection("billing", nil)
+		_, err = DatabaseConnection("billing")
+		assert.ErrorIs(t, err, ErrDatabaseConnectionNotFound)
+	})
+
+	t.Run("Replaced pool", func(t *testing.T) {
+		timeout := DefaultDatabasePoolDrainTimeout
+		defer func() {
+			DefaultDatabasePoolDrainTimeout = timeout
+		}()
+
+		DefaultDatabasePoolDrainTimeout = 50
+		op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+		held, err := op.SQLDB()
+		assert.NoError(t, err)
+		conn, err := held.Conn(context.Background())
+		assert.NoError(t, err)
+
+		op.opLock.Lock()
+		drainDBPool(op.db)
+		op.db = nil
+		op.opLock.Unlock()
+		replaced, err := op.SQLDB()
+		assert.NoError(t, err)
+		assert.NotSame(t, held, replaced)
+
+		// The held pool outlives the grace period while a connection is in use
+		time.Sleep(150 * time.Millisecond)
+		assert.NoError(t, conn.PingContext(context.Background()))
+		assert.NoError(t, conn.Close())
+		assert.Eventually(t, func() bool { return held.Ping() != nil }, time.Second, 10*time.Millisecond)
+		assert.NoError(t, replaced.Ping())
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := (&DatabaseOp{meta: secret.DatabaseMeta{Adapter: "unsupported"}}).SQLDB()
+		assert.ErrorIs(t, err, ErrDatabaseAdapterNotSupported)
+
+		mock := NewMockDatabaseOp()
+		_, err = mock.SQLDB()
+		assert.Error(t, err)
+		mock.SetDBResponse(op.DB(), nil)
+		mockSQLDB, err := mock.SQLDB()
+		assert.NoError(t, err)
+		assert.Same(t, sqlDB, mockSQLDB)
+	})
+}
+
+func TestDatabaseMigrator(t *testing.T) {
+	migrations := fstest.MapFS{
+		"migrations/1_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\n-- seed; with semicolon in comment\nINSERT INTO users (name) VALUES ('a;b');")},
+		"migrations/1_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"migrations/2_create_posts.up.sql":   {Data: []byte("CREATE TABLE posts (id INTEGER PRIMARY KEY);")},
+		"migrations/2_create_posts.down.sql": {Data: []byte("DROP TABLE posts;")},
+		"migrations/README.md":               {Data: []byte("ignored")},
+	}
+
+	op := &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}
+	db := op.DB()
+	migrator := NewMigrator(op)
+	assert.NoError(t, migrator.LoadFS(migrations, "migrations"))
+	assert.NoError(t, migrator.Register(Migration{
+		Version: 3,
+		Name:    "add_posts_title",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE posts ADD COLUMN title TEXT").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE posts DROP COLUMN title").Error
+		},
+	}))
+	assert.Error(t, migrator.Register(Migration{Version: 3}))
+
+	t.Run("Dry run", func(t *testing.T) {
+		migrator.DryRun = true
+		defer func() { migrator.DryRun = false }()
+
+		planned, err := migrator.Up(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, planned, 3)
+		assert.False(t, db.Migrator().HasTable("users"))
+		assert.False(t, db.Migrator().HasTable(DefaultDatabaseMigrationTable))
+	})
+
+	t.Run("Steps and up", func(t *testing.T) {
+		applied, err := migrator.Steps(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Len(t, applied, 1)
+		assert.Equal(t, "create_users", applied[0].Name)
+
+		var names []string
+		assert.NoError(t, db.Table("users").Pluck("name", &names).Error)
+		assert.Equal(t, []string{"a;b"}, names)
+
+		pending, err := migrator.Pending(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, pending, 2)
+
+		applied, err = migrator.Up(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, applied, 2)
+		assert.True(t, db.Migrator().HasColumn("posts", "title"))
+
+		applied, err = migrator.Up(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, applied)
+	})
+
+	t.Run("Down", func(t *testing.T) {
+		reverted, err := migrator.Down(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), reverted[0].Version)
+		assert.False(t, db.Migrator().HasColumn("posts", "title"))
+
+		reverted, err = migrator.Steps(context.Background(), -5)
+		assert.NoError(t, err)
+		assert.Len(t, reverted, 2)
+		assert.False(t, db.Migrator().HasTable("users"))
+
+		var cnt int64
+		assert.NoError(t, db.Table(DefaultDatabaseMigrationTable).Count(&cnt).Error)
+		assert.Equal(t, int64(0), cnt)
+	})
+
+	t.Run("Failed migration is rolled back", func(t *testing.T) {
+		migrator := NewMigrator(op)
+		assert.NoError(t, migrator.Register(Migration{Version: 10, Name: "broken", UpSQL: "CREATE TABLE broken (id INTEGER); INSERT INTO missing VALUES (1);"}))
+		_, err := migrator.Up(context.Background())
+		assert.Error(t, err)
+		assert.False(t, db.Migrator().HasTable("broken"))
+
+		pending, err := migrator.Pending(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, pending, 1)
+	})
+
+	t.Run("Canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewMigrator(&DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}).Up(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("Invalid file names", func(t *testing.T) {
+		_, _, _, err := parseMigrationFileName("create_users.up.sql")
+		assert.Error(t, err)
+		_, _, _, err = parseMigrationFileName("1_create_users.sql")
+		assert.Error(t, err)
+	})
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	t.Run("MySQL", func(t *testing.T) {
+		script := "# comment; skipped\nCREATE TABLE t (id INT) /*!50100 ENGINE=InnoDB */;\n" +
+			"SELECT /*+ MAX_EXECUTION_TIME(1000) */ 'a\\';b' FROM t; -- trailing; comment\nINSERT INTO t VALUES (1) /* dropped; */"
+		assert.Equal(t, []string{
+			"CREATE TABLE t (id INT) /*!50100 ENGINE=InnoDB */",
+			"SELECT /*+ MAX_EXECUTION_TIME(1000) */ 'a\\';b' FROM t",
+			"INSERT INTO t VALUES (1)",
+		}, splitSQLStatements(script, "mysql"))
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		script := "CREATE FUNCTION f(a INT) RETURNS INT AS $$ BEGIN RETURN a; END; $$ LANGUAGE plpgsql;\n" +
+			"CREATE FUNCTION g() RETURNS TEXT AS $body$ SELECT '$$;'; $body$ LANGUAGE sql;\n" +
+			"SELECT a#b, 'c\\', E'd\\';' FROM t WHERE id = $1; SELECT 1"
+		assert.Equal(t, []string{
+			"CREATE FUNCTION f(a INT) RETURNS INT AS $$ BEGIN RETURN a; END; $$ LANGUAGE plpgsql",
+			"CREATE FUNCTION g() RETURNS TEXT AS $body$ SELECT '$$;'; $body$ LANGUAGE sql",
+			"SELECT a#b, 'c\\', E'd\\';' FROM t WHERE id = $1",
+			"SELECT 1",
+		}, splitSQLStatements(script, "postgres"))
+	})
+
+	t.Run("SQLite", func(t *testing.T) {
+		assert.Equal(t, []string{"SELECT '#;'", "SELECT $$"}, splitSQLStatements("SELECT '#;' /*! x; */; SELECT $$;", "sqlite"))
+	})
+}
+
+func TestDatabaseMigratorLock(t *testing.T) {
+	mockLock := func(t *testing.T, adapter string, dialector func(conn *sql.DB) gorm.Dialector, lockSQL, unlockSQL string, args ...driver.Value) {
+		conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		assert.NoError(t, err)
+		defer conn.Close()
+		db, err := gorm.Open(dialector(conn), &gorm.Config{Logger: logger.Discard})
+		assert.NoError(t, err)
+
+		if adapter == "mysql" {
+			mock.ExpectQuery(lockSQL).WithArgs(args...).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+		} else {
+			mock.ExpectQuery(lockSQL).WithArgs(args...).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(false))
+			mock.ExpectQuery(lockSQL).WithArgs(args...).WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(true))
+		}
+
+		mock.ExpectExec(unlockSQL).WithArgs(args[0]).WillReturnResult(sqlmock.NewResult(0, 0))
+		migrator := NewMigrator(&DatabaseOp{meta: secret.DatabaseMeta{Adapter: adapter}})
+		_, unlock, err := migrator.lock(context.Background(), db)
+		assert.NoError(t, err)
+		unlock()
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+
+	originalInterval := databaseMigrationLockInterval
+	databaseMigrationLockInterval = time.Millisecond
+	defer func() {
+		databaseMigrationLockInterval = originalInterval
+	}()
+
+	t.Run("Mock", func(t *testing.T) {
+		lockName := "goth-datastore:" + DefaultDatabaseMigrationTable
+		mockLock(t, "mysql", func(conn *sql.DB) gorm.Dialector {
+			return mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true})
+		}, "SELECT GET_LOCK(?, ?)", "SELECT RELEASE_LOCK(?)", lockName, int64(DefaultDatabaseMigrationLockTimeout))
+		mockLock(t, "postgres", func(conn *sql.DB) gorm.Dialector {
+			return postgres.New(postgres.Config{Conn: conn})
+		}, "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)", int64(crc32.ChecksumIEEE([]byte(lockName))))
+	})
+
+	t.Run("Postgres lock timeout", func(t *testing.T) {
+		originalTimeout := DefaultDatabaseMigrationLockTimeout
+		DefaultDatabaseMigrationLockTimeout = 0
+		defer func() {
+			DefaultDatabaseMigrationLockTimeout = originalTimeout
+		}()
+
+		conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		assert.NoError(t, err)
+		defer conn.Close()
+		db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{Logger: logger.Discard})
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT pg_try_advisory_lock($1)").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(false))
+		migrator := NewMigrator(&DatabaseOp{meta: secret.DatabaseMeta{Adapter: "postgres"}})
+		_, _, err = migrator.lock(context.Background(), db)
+		assert.ErrorContains(t, err, "not acquired")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Single connection pool", func(t *testing.T) {
+		conn, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		assert.NoError(t, err)
+		defer conn.Close()
+		conn.SetMaxOpenConns(1)
+		db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Discard})
+		assert.NoError(t, err)
+
+		mock.ExpectQuery("SELECT GET_LOCK(?, ?)").WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE t SET a = 1").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec("SELECT RELEASE_LOCK(?)").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		migrator := NewMigrator(&DatabaseOp{meta: secret.DatabaseMeta{Adapter: "mysql"}})
+		locked, unlock, err := migrator.lock(ctx, db)
+		assert.NoError(t, err)
+		assert.NoError(t, locked.Transaction(func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE t SET a = 1").Error
+		}))
+		unlock()
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	server := func(t *testing.T, profile string, migration Migration) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+
+		database := NewDatabase(profile)
+		if database == nil || database.Writer() == nil {
+			t.Skip("database not configured")
+		}
+
+		db := database.Writer().DB()
+		if db == nil {
+			t.Skip("database connection not available")
+		}
+
+		sqlDB, err := db.DB()
+		if err != nil {
+			t.Skipf("database sql DB not available: %v", err)
+		}
+		if err := sqlDB.Ping(); err != nil {
+			t.Skipf("database ping failed: %v", err)
+		}
+
+		migrator := NewMigrator(database.Writer())
+		migrator.table = "schema_migrations_lock_test"
+		defer func() {
+			_ = db.Migrator().DropTable(migrator.table)
+		}()
+
+		assert.NoError(t, migrator.Register(migration))
+		applied, err := migrator.Up(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, applied, 1)
+
+		var names []string
+		assert.NoError(t, db.Table("migrator_lock_test").Order("id").Pluck("name", &names).Error)
+		assert.Equal(t, []string{"a;b", "c"}, names)
+
+		reverted, err := migrator.Down(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, reverted, 1)
+		assert.False(t, db.Migrator().HasTable("migrator_lock_test"))
+	}
+
+	t.Run("MySQL", func(t *testing.T) {
+		server(t, "test", Migration{
+			Version: 1,
+			Name:    "lock_test",
+			UpSQL: "# comment; skipped\nCREATE TABLE migrator_lock_test (id INT PRIMARY KEY, name VARCHAR(16)) /*!50100 ENGINE=InnoDB */;\n" +
+				"INSERT /*+ MAX_EXECUTION_TIME(1000) */ INTO migrator_lock_test VALUES (1, 'a;b'), (2, 'c');",
+			DownSQL: "DROP TABLE migrator_lock_test;",
+		})
+	})
+
+	t.Run("Postgres", func(t *testing.T) {
+		server(t, "postgres-test", Migration{
+			Version: 1,
+			Name:    "lock_test",
+			UpSQL: "CREATE TABLE migrator_lock_test (id INT PRIMARY KEY, name TEXT);\n" +
+				"CREATE FUNCTION migrator_lock_test_name(i INT) RETURNS TEXT AS $$ BEGIN RETURN 'c'; END; $$ LANGUAGE plpgsql;\n" +
+				"INSERT INTO migrator_lock_test VALUES (1, 'a;b'), (2, migrator_lock_test_name(2));",
+			DownSQL: "DROP FUNCTION migrator_lock_test_name(INT); DROP TABLE migrator_lock_test;",
+		})
+	})
+}
+
+func TestDatabaseOutbox(t *testing.T) {
+	database := &Database{writer: &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}}
+	db := database.Writer().DB()
+	assert.NoError(t, db.AutoMigrate(&databaseCRUDRecord{}))
+
+	var mutex sync.Mutex
+	var published []string
+	failures := map[string]int{}
+	outbox := NewOutbox(database, OutboxPublisherFunc(func(ctx context.Context, event *OutboxEvent) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failures[event.Key] > 0 {
+			failures[event.Key]--
+			return errors.New("broker unavailable")
+		}
+
+		published = append(published, event.Key)
+		return nil
+	}))
+
+	outbox.RetryDelay = func(event *OutboxEvent, err error) time.Duration { return 0 }
+	outbox.MaxAttempts = 3
+	assert.Equal(t, DefaultDatabaseOutboxTable, outbox.Table())
+	assert.NoError(t, outbox.Migrate(context.Background()))
+
+	t.Run("Record", func(t *testing.T) {
+		err := outbox.Transaction(context.Background(), func(tx *gorm.DB) ([]OutboxEvent, error) {
+			record := &databaseCRUDRecord{Name: "outbox"}
+			if err := tx.Create(record).Error; err != nil {
+				return nil, err
+			}
+
+			return []OutboxEvent{
+				{Topic: "records", Key: "a", Payload: []byte("created")},
+				{Topic: "records", Key: "b", Payload: []byte("created")},
+			}, nil
+		})
+
+		assert.NoError(t, err)
+
+		// Events of a rolled back transaction are not recorded
+		err = outbox.Transaction(context.Background(), func(tx *gorm.DB) ([]OutboxEvent, error) {
+			return []OutboxEvent{{Topic: "records", Key: "rolled back"}}, errors.New("business error")
+		})
+
+		assert.EqualError(t, err, "business error")
+		assert.Error(t, outbox.Record(db, OutboxEvent{Key: "no topic"}))
+		stats, err := outbox.Stats(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, OutboxStats{Pending: 2}, stats)
+	})
+
+	t.Run("Relay", func(t *testing.T) {
+		failures["b"] = 1
+		n, err := outbox.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"a"}, published)
+
+		var event OutboxEvent
+		assert.NoError(t, db.Table(outbox.Table()).Where("`key` = ?", "b").First(&event).Error)
+		assert.Equal(t, 1, event.Attempts)
+		assert.Equal(t, "broker unavailable", event.LastError)
+		assert.Nil(t, event.PublishedAt)
+
+		n, err = outbox.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"a", "b"}, published)
+		n, err = outbox.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		stats, err := outbox.Stats(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, OutboxStats{Published: 2}, stats)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		failures["c"] = 3
+		assert.NoError(t, outbox.Record(db, OutboxEvent{Topic: "records", Key: "c"}))
+		for i := 0; i < 4; i++ {
+			_, err := outbox.Relay(context.Background())
+			assert.NoError(t, err)
+		}
+
+		failed, err := outbox.Failed(context.Background(), 10)
+		assert.NoError(t, err)
+		assert.Len(t, failed, 1)
+		assert.Equal(t, 3, failed[0].Attempts)
+		stats, err := outbox.Stats(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, OutboxStats{Published: 2, Failed: 1}, stats)
+
+		assert.NoError(t, outbox.Retry(context.Background(), failed[0].ID))
+		n, err := outbox.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []string{"a", "b", "c"}, published)
+	})
+
+	t.Run("Lease", func(t *testing.T) {
+		// Events claimed by a relay which stopped are published once the lease expired
+		outbox.Lease = 50 * time.Millisecond
+		assert.NoError(t, outbox.Record(db, OutboxEvent{Topic: "records", Key: "d"}))
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := NewOutbox(database, OutboxPublisherFunc(func(ctx context.Context, event *OutboxEvent) error {
+			cancel()
+			return ctx.Err()
+		}))
+
+		stopped.Lease = outbox.Lease
+		n, err := stopped.Relay(ctx)
+		assert.Equal(t, 0, n)
+		assert.ErrorIs(t, err, context.Canceled)
+		n, _ = outbox.Relay(context.Background())
+		assert.Equal(t, 0, n)
+
+		time.Sleep(60 * time.Millisecond)
+		n, err = outbox.Relay(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		outbox.BatchSize, outbox.PollInterval = 2, 10*time.Millisecond
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, outbox.Record(db, OutboxEvent{Topic: "records", Key: fmt.Sprintf("run%d", i)}))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			outbox.Run(ctx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			stats, err := outbox.Stats(context.Background())
+			return err == nil && stats.Pending == 0
+		}, time.Second, 10*time.Millisecond)
+
+		cancel()
+		<-done
+		mutex.Lock()
+		assert.Len(t, published, 9)
+		mutex.Unlock()
+
+		purged, err := outbox.Purge(context.Background(), time.Now().Add(time.Second))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(9), purged)
+	})
+
+	t.Run("Publishers", func(t *testing.T) {
+		event := &OutboxEvent{ID: 7, Topic: "records", Key: "a", Payload: []byte("created")}
+		redis := NewMockRedisOp()
+		redis.EnableStatefulMode()
+		assert.NoError(t, NewRedisListOutboxPublisher(redis).Publish(context.Background(), event))
+		assert.Equal(t, "created", redis.LPop("records").GetString())
+
+		stream := NewMockRedisOp()
+		stream.SetResponse("XADD", "*", "1-0", nil)
+		assert.NoError(t, NewRedisStreamOutboxPublisher(stream, 1000).Publish(context.Background(), event))
+		calls := stream.GetCallsByCommand("XADD")
+		assert.Len(t, calls, 1)
+		assert.Equal(t, []interface{}{"records", "MAXLEN", "~", int64(1000), "*", "id", "7", "key", "a", "payload", []byte("created")}, calls[0].Args)
+
+		producer := NewMockKafkaProducer()
+		assert.NoError(t, NewKafkaOutboxPublisher(producer).Publish(context.Background(), event))
+		messages := producer.MessagesByTopic("records")
+		assert.Len(t, messages, 1)
+		assert.Equal(t, []byte("a"), messages[0].Key)
+		id, ok := messages[0].Header(OutboxEventIDHeader)
+		assert.True(t, ok)
+		assert.Equal(t, "7", string(id))
+	})
+
+	t.Run("Run stops while the writer opens", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		RegisterDatabaseAdapter("blocking", func(op *DatabaseOp) gorm.Dialector {
+			return &databaseBlockingDialector{Dialector: sqlite.Open(sqliteMemoryPath), release: release}
+		})
+		defer RegisterDatabaseAdapter("blocking", nil)
+
+		blocking := NewOutbox(&Database{writer: &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "blocking"}, RetryPolicy: RetryPolicy{Attempts: 3, Interval: time.Second}}}, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := blocking.Stats(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			blocking.Run(ctx)
+			close(done)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not stop with its context")
+		}
+	})
+
+	t.Run("Writer not configured", func(t *testing.T) {
+		assert.Error(t, NewOutbox(&Database{}, nil).Migrate(context.Background()))
+		_, err := NewOutbox(&Database{}, nil).Relay(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestBuildSqliteDSN(t *testing.T) {
+	t.Run("empty name opens in-memory database", func(t *testing.T) {
+		assert.Equal(t, ":memory:", buildSqliteDSN("", ConnParams{}))
+		assert.True(t, isSqliteMemory(""))
+		assert.True(t, isSqliteMemory(":memory:"))
+		assert.True(t, isSqliteMemory("file:test?mode=memory&cache=shared"))
+		assert.False(t, isSqliteMemory("/tmp/test.db"))
+	})
+
+	t.Run("ConnParams subset", func(t *testing.T) {
+		params := ConnParams{
+			Timeout:     "3s",
+			Loc:         "Local",
+			ExtraParams: map[string]string{"_foreign_keys": "1", "_journal_mode": "WAL"},
+		}
+		dsn := buildSqliteDSN("/tmp/test.db", params)
+		assert.Equal(t, "/tmp/test.db?_busy_timeout=3000&_loc=auto&_foreign_keys=1&_journal_mode=WAL", dsn)
+	})
+
+	t.Run("existing query string", func(t *testing.T) {
+		dsn := buildSqliteDSN("file:test.db?cache=shared", ConnParams{Timeout: "500ms", Loc: "UTC"})
+		assert.Equal(t, "file:test.db?cache=shared&_busy_timeout=500&_loc=UTC", dsn)
+	})
+
+	t.Run("without the cgo driver", func(t *testing.T) {
+		dialector := newSqliteDialector
+		defer func() {
+			newSqliteDialector = dialector
+		}()
+
+		newSqliteDialector = nil
+		_, err := (&DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}).DBContext(context.Background())
+		assert.ErrorIs(t, err, ErrDatabaseAdapterNotSupported)
+	})
+}
+
 // TestMockDatabaseOp tests the mock Database operator functionality
 func TestMockDatabaseOp(t *testing.T) {
 	t.Run("Basic mock functionality", func(t *testing.T) {
@@ -771,6 +2072,63 @@ func TestMockDatabaseOp(t *testing.T) {
 	})
 }
 
+// TestMockSQL tests the statements run through the gorm.DB of a MockSQL
+func TestMockSQL(t *testing.T) {
+	type mockSQLUser struct {
+		ID   int64
+		Name string
+	}
+
+	t.Run("Queries and writes meet the expectations", func(t *testing.T) {
+		db := NewMockDatabase()
+		mockSQL, err := db.Writer().(*MockDatabaseOp).UseMockSQL()
+		assert.NoError(t, err)
+
+		mockSQL.ExpectQuery("SELECT \\* FROM `mock_sql_users` WHERE name = \\?").
+			WithArgs("alice", MockAnyArg).
+			WillReturnRows([]string{"id", "name"}, []interface{}{7, "alice"})
+		mockSQL.ExpectExec("UPDATE `mock_sql_users` SET `name`=\\? WHERE `id` = \\?").
+			WithArgs("bob", 7).
+			WillReturnResult(0, 1)
+		mockSQL.ExpectBegin()
+		mockSQL.ExpectExec("INSERT INTO `mock_sql_users`").WillReturnResult(8, 1)
+		mockSQL.ExpectRollback()
+
+		var user mockSQLUser
+		assert.NoError(t, db.Writer().DB().Where("name = ?", "alice").First(&user).Error)
+		assert.Equal(t, mockSQLUser{ID: 7, Name: "alice"}, user)
+		result := db.Writer().DB().Model(&user).Update("name", "bob")
+		assert.NoError(t, result.Error)
+		assert.Equal(t, int64(1), result.RowsAffected)
+
+		err = db.Writer().DB().Transaction(func(tx *gorm.DB) error {
+			created := mockSQLUser{Name: "carol"}
+			assert.NoError(t, tx.Create(&created).Error)
+			assert.Equal(t, int64(8), created.ID)
+			return errors.New("abort")
+		})
+		assert.EqualError(t, err, "abort")
+		assert.True(t, mockSQL.AssertExpectations(t))
+	})
+
+	t.Run("Unexpected statements fail", func(t *testing.T) {
+		mockSQL, db, err := NewMockSQL()
+		assert.NoError(t, err)
+		mockSQL.ExpectExec("DELETE FROM `mock_sql_users`").WillReturnError(sql.ErrConnDone)
+		mockSQL.ExpectQuery("SELECT count")
+
+		assert.ErrorIs(t, db.Delete(&mockSQLUser{}, 1).Error, sql.ErrConnDone)
+		var users []mockSQLUser
+		assert.ErrorIs(t, db.Find(&users).Error, ErrMockUnexpectedSQL)
+
+		recorder := &mockRecordingT{}
+		assert.False(t, mockSQL.AssertExpectations(recorder))
+		assert.Len(t, recorder.errors, 2)
+		assert.Contains(t, recorder.errors[0], "expected query \"SELECT count\"")
+		assert.Contains(t, recorder.errors[1], "query \"SELECT * FROM `mock_sql_users`\"")
+	})
+}
+
 // TestNewMockDatabase tests the mock Database constructor
 func TestNewMockDatabase(t *testing.T) {
 	t.Run("Creates valid mock Database instance", func(t *testing.T) {
@@ -826,6 +2184,39 @@ func TestMockDatabaseBuilder(t *testing.T) {
 	})
 }
 
+func TestMockDatabaseOpChaos(t *testing.T) {
+	t.Run("Seeded error rate is repeatable", func(t *testing.T) {
+		run := func() []bool {
+			mockOp := NewMockDatabaseOp()
+			mockOp.SetMockDB(&gorm.DB{})
+			mockOp.EnableChaos(MockChaosConfig{Seed: 7, ErrorRate: 0.5})
+			var results []bool
+			for i := 0; i < 20; i++ {
+				results = append(results, mockOp.DB() == nil)
+			}
+
+			return results
+		}
+
+		first := run()
+		assert.Equal(t, first, run())
+		assert.Contains(t, first, true)
+		assert.Contains(t, first, false)
+	})
+
+	t.Run("Failures are recorded", func(t *testing.T) {
+		mockOp := NewMockDatabaseOp()
+		mockOp.SetMockDB(&gorm.DB{})
+		mockOp.EnableChaos(MockChaosConfig{ErrorRate: 1})
+
+		assert.Nil(t, mockOp.DB())
+		assert.Equal(t, ErrMockChaos, mockOp.GetCallsByMethod("DB")[0].Error)
+
+		mockOp.DisableChaos()
+		assert.NotNil(t, mockOp.DB())
+	})
+}
+
 func TestBuildMysqlDSN_MultiStatements(t *testing.T) {
 	// Save original secret path and restore it after test
 	originalPath := secret.Path()
@@ -940,6 +2331,11 @@ func TestBuildMysqlDSN_TransactionIsolation(t *testing.T) {
 		assert.Equal(t, "u:p@(h:3306)/d?"+baseSuffix, dsn)
 	})
 
+	t.Run("unix socket", func(t *testing.T) {
+		dsn := buildMysqlSocketDSN("u", "p", "/var/run/mysqld/mysqld.sock", "d", "utf8mb4", base)
+		assert.Equal(t, "u:p@unix(/var/run/mysqld/mysqld.sock)/d?"+baseSuffix, dsn)
+	})
+
 	t.Run("ReadCommitted exact DSN", func(t *testing.T) {
 		params := base
 		params.TransactionIsolation = DatabaseIsolationLevelReadCommitted
@@ -1019,16 +2415,138 @@ func TestBuildMysqlDSN_ExtraParams(t *testing.T) {
 	})
 }
 
+func TestBuildMysqlDSN_TLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "datastore test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	meta := secret.DatabaseMeta{Adapter: "mysql"}
+	meta.Params.Host = "db.example.com"
+	meta.Params.Port = 3306
+
+	t.Run("Mode only", func(t *testing.T) {
+		m := meta
+		m.TLS.Mode = "Skip-Verify"
+		tlsParam, fallback, err := mysqlTLSParam(m)
+		assert.NoError(t, err)
+		assert.Equal(t, "skip-verify", tlsParam)
+		assert.False(t, fallback)
+
+		tlsParam, _, err = mysqlTLSParam(meta)
+		assert.NoError(t, err)
+		assert.Empty(t, tlsParam)
+	})
+
+	t.Run("Custom CA file", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		assert.NoError(t, os.WriteFile(caFile, []byte(caPEM), 0600))
+		m := meta
+		m.TLS.CAFile = caFile
+		tlsParam, fallback, err := mysqlTLSParam(m)
+		assert.NoError(t, err)
+		assert.False(t, fallback)
+		assert.Equal(t, mysqlTLSConfigName(m), tlsParam)
+		defer mysqldriver.DeregisterTLSConfig(tlsParam)
+
+		dsn := buildMysqlDSN("user", "pass", m.Params.Host, m.Params.Port, "db", "utf8mb4", ConnParams{TLS: tlsParam, Timeout: "5s", ReadTimeout: "5s", WriteTimeout: "5s", Loc: "UTC"})
+		assert.Contains(t, dsn, "&tls="+tlsParam)
+		assert.True(t, strings.HasPrefix(tlsParam, "datastore-db.example.com-3306-"))
+
+		cfg, err := mysqldriver.ParseDSN(dsn)
+		assert.NoError(t, err)
+		if assert.NotNil(t, cfg.TLS) {
+			assert.NotNil(t, cfg.TLS.RootCAs)
+			assert.Equal(t, "db.example.com", cfg.TLS.ServerName)
+			assert.False(t, cfg.TLS.InsecureSkipVerify)
+		}
+	})
+
+	t.Run("Client certificate", func(t *testing.T) {
+		m := meta
+		m.TLS = secret.DatabaseTLS{CA: caPEM, Cert: caPEM, Key: keyPEM, ServerName: "rds.example.com"}
+		config, err := buildMysqlTLSConfig(m.TLS, m.Params.Host)
+		assert.NoError(t, err)
+		assert.Len(t, config.Certificates, 1)
+		assert.Equal(t, "rds.example.com", config.ServerName)
+	})
+
+	t.Run("Profiles of one server", func(t *testing.T) {
+		// Different certificates for the same server get their own config
+		m := meta
+		m.TLS = secret.DatabaseTLS{CA: caPEM}
+		other := meta
+		other.TLS = secret.DatabaseTLS{CA: caPEM, Cert: caPEM, Key: keyPEM}
+		assert.NotEqual(t, mysqlTLSConfigName(m), mysqlTLSConfigName(other))
+		assert.Equal(t, mysqlTLSConfigName(m), mysqlTLSConfigName(m))
+	})
+
+	t.Run("Preferred with certificates", func(t *testing.T) {
+		m := meta
+		m.TLS = secret.DatabaseTLS{Mode: "preferred", CA: caPEM}
+		tlsParam, fallback, err := mysqlTLSParam(m)
+		assert.NoError(t, err)
+		assert.True(t, fallback)
+		defer mysqldriver.DeregisterTLSConfig(tlsParam)
+
+		dialector, err := newBuiltinDialector(newDatabaseOp(m))
+		assert.NoError(t, err)
+		cfg, err := mysqldriver.ParseDSN(dialector.(*mysql.Dialector).DSN)
+		assert.NoError(t, err)
+		assert.True(t, cfg.AllowFallbackToPlaintext)
+		if assert.NotNil(t, cfg.TLS) {
+			assert.True(t, cfg.TLS.InsecureSkipVerify)
+		}
+	})
+
+	t.Run("Invalid certificates", func(t *testing.T) {
+		m := meta
+		m.TLS.CA = "not a pem"
+		_, _, err := mysqlTLSParam(m)
+		assert.Error(t, err)
+
+		m.TLS = secret.DatabaseTLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")}
+		_, _, err = mysqlTLSParam(m)
+		assert.Error(t, err)
+
+		m.TLS = secret.DatabaseTLS{CA: caPEM, Cert: caPEM}
+		_, _, err = mysqlTLSParam(m)
+		assert.Error(t, err)
+
+		// A key without its certificate is not silently ignored
+		m.TLS = secret.DatabaseTLS{Key: keyPEM}
+		_, _, err = mysqlTLSParam(m)
+		assert.Error(t, err)
+
+		op := &DatabaseOp{meta: m}
+		dialector, err := newBuiltinDialector(op)
+		assert.Nil(t, dialector)
+		assert.Error(t, err)
+	})
+}
+
 func TestBuildPostgresDSN_TransactionIsolation(t *testing.T) {
 	baseDSN := "host=localhost user=u password=p dbname=d port=5432 sslmode=disable TimeZone=UTC"
 
 	t.Run("zero value does not add isolation param", func(t *testing.T) {
-		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "", nil)
+		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "", "", nil)
 		assert.Equal(t, baseDSN, dsn)
 	})
 
 	t.Run("ReadCommitted exact DSN", func(t *testing.T) {
-		dsn := buildPostgresDSN("pg.host", "admin", "secret", "mydb", 5432, "require", "Asia/Taipei",
+		dsn := buildPostgresDSN("pg.host", "admin", "secret", "mydb", 5432, "require", "Asia/Taipei", "",
 			DatabaseIsolationLevelReadCommitted, nil)
 		expected := "host=pg.host user=admin password=secret dbname=mydb port=5432 sslmode=require TimeZone=Asia/Taipei" +
 			" default_transaction_isolation='read committed'"
@@ -1037,7 +2555,7 @@ func TestBuildPostgresDSN_TransactionIsolation(t *testing.T) {
 	})
 
 	t.Run("Serializable exact DSN", func(t *testing.T) {
-		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC",
+		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "",
 			DatabaseIsolationLevelSerializable, nil)
 		assert.True(t, strings.HasSuffix(dsn, " default_transaction_isolation='serializable'"))
 		t.Logf("PostgreSQL DSN:\n%s", dsn)
@@ -1045,7 +2563,7 @@ func TestBuildPostgresDSN_TransactionIsolation(t *testing.T) {
 
 	t.Run("typed isolation appears before ExtraParams", func(t *testing.T) {
 		extra := map[string]string{"application_name": "myapp"}
-		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC",
+		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "",
 			DatabaseIsolationLevelReadCommitted, extra)
 		idxIso := strings.Index(dsn, " default_transaction_isolation=")
 		idxExtra := strings.Index(dsn, " application_name=")
@@ -1056,13 +2574,13 @@ func TestBuildPostgresDSN_TransactionIsolation(t *testing.T) {
 
 func TestBuildPostgresDSN_ExtraParams(t *testing.T) {
 	t.Run("nil ExtraParams exact match", func(t *testing.T) {
-		dsn := buildPostgresDSN("localhost", "user", "pass", "db", 5432, "disable", "UTC", "", nil)
+		dsn := buildPostgresDSN("localhost", "user", "pass", "db", 5432, "disable", "UTC", "", "", nil)
 		assert.Equal(t, "host=localhost user=user password=pass dbname=db port=5432 sslmode=disable TimeZone=UTC", dsn)
 	})
 
 	t.Run("empty map identical to nil", func(t *testing.T) {
-		dsnNil := buildPostgresDSN("h", "u", "p", "d", 5432, "disable", "UTC", "", nil)
-		dsnEmpty := buildPostgresDSN("h", "u", "p", "d", 5432, "disable", "UTC", "", map[string]string{})
+		dsnNil := buildPostgresDSN("h", "u", "p", "d", 5432, "disable", "UTC", "", "", nil)
+		dsnEmpty := buildPostgresDSN("h", "u", "p", "d", 5432, "disable", "UTC", "", "", map[string]string{})
 		assert.Equal(t, dsnNil, dsnEmpty)
 	})
 
@@ -1071,13 +2589,38 @@ func TestBuildPostgresDSN_ExtraParams(t *testing.T) {
 			"application_name":  "myapp",
 			"statement_timeout": "30000",
 		}
-		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "", extra)
+		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "", "", extra)
 		assert.True(t, strings.HasSuffix(dsn,
 			" application_name=myapp statement_timeout=30000"))
 		t.Logf("PostgreSQL DSN:\n%s", dsn)
 	})
 }
 
+func TestBuildPostgresDSN_SearchPath(t *testing.T) {
+	t.Run("empty search path is omitted", func(t *testing.T) {
+		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "", "", nil)
+		assert.NotContains(t, dsn, "search_path")
+	})
+
+	t.Run("search path appears before isolation and ExtraParams", func(t *testing.T) {
+		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", "app,public",
+			DatabaseIsolationLevelReadCommitted, map[string]string{"application_name": "myapp"})
+		expected := "host=localhost user=u password=p dbname=d port=5432 sslmode=disable TimeZone=UTC" +
+			" search_path=app,public default_transaction_isolation='read committed' application_name=myapp"
+		assert.Equal(t, expected, dsn)
+	})
+
+	t.Run("values with spaces are quoted", func(t *testing.T) {
+		dsn := buildPostgresDSN("localhost", "u", "p", "d", 5432, "disable", "UTC", `"$user", public`, "", nil)
+		assert.True(t, strings.HasSuffix(dsn, ` search_path='"$user", public'`))
+	})
+
+	t.Run("dialector config uses ConnParams.SearchPath", func(t *testing.T) {
+		cfg := buildPostgresDialectorConfig(secret.DatabaseMeta{}, ConnParams{SearchPath: "tenant_a"}, "disable", "UTC")
+		assert.Contains(t, cfg.DSN, " search_path=tenant_a")
+	})
+}
+
 func TestBuildPostgresDialectorConfig_ExtraParams(t *testing.T) {
 	originalPath := secret.Path()
 	defer func() {
@@ -1353,7 +2896,7 @@ func TestPostgresHighConcurrencyConnParams(t *testing.T) {
 	// Verify the recommended params produce the correct DSN segments.
 	dsn := buildPostgresDSN(
 		"pg.host", "user", "pass", "app", 5432,
-		params.SSLMode, params.TimeZone,
+		params.SSLMode, params.TimeZone, params.SearchPath,
 		params.TransactionIsolation, params.ExtraParams,
 	)
 	assert.Contains(t, dsn, " default_transaction_isolation='read committed'",
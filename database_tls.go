@@ -0,0 +1,109 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// mysqlTLSConfigName returns the name the custom TLS config of a profile is registered under.
+// It is keyed by the server and a hash of the TLS settings, so profiles of the same server with different
+// certificates do not overwrite each other's config, while rebuilding a pool replaces it instead of leaking a new one.
+func mysqlTLSConfigName(meta secret.DatabaseMeta) string {
+	t := meta.TLS
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(strings.TrimSpace(t.Mode)), t.CA, t.CAFile, t.Cert, t.CertFile, t.Key, t.KeyFile, t.ServerName,
+	}, "\x00")))
+
+	return fmt.Sprintf("datastore-%s-%d-%x", meta.Params.Host, meta.Params.Port, sum[:6])
+}
+
+// mysqlTLSParam resolves the tls DSN parameter of the profile, registering a custom config with the
+// driver when certificates are configured. An empty result leaves ConnParams.TLS untouched. fallback reports
+// a custom config in preferred mode, which the DSN pairs with allowFallbackToPlaintext.
+func mysqlTLSParam(meta secret.DatabaseMeta) (tlsParam string, fallback bool, err error) {
+	mode := strings.ToLower(strings.TrimSpace(meta.TLS.Mode))
+	if !meta.TLS.Custom() || mode == "false" {
+		return mode, false, nil
+	}
+
+	config, err := buildMysqlTLSConfig(meta.TLS, meta.Params.Host)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Like the driver's preferred mode, the server is not verified and a server without TLS is used in plaintext
+	config.InsecureSkipVerify = mode == "skip-verify" || mode == "preferred"
+	name := mysqlTLSConfigName(meta)
+	if err := mysqldriver.RegisterTLSConfig(name, config); err != nil {
+		return "", false, err
+	}
+
+	return name, mode == "preferred", nil
+}
+
+// buildMysqlTLSConfig loads the CA and client certificates of the profile.
+func buildMysqlTLSConfig(t secret.DatabaseTLS, host string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.ServerName,
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	ca, err := readTLSPEM(t.CA, t.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read ca: %w", err)
+	}
+
+	if ca != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in ca")
+		}
+
+		config.RootCAs = pool
+	}
+
+	cert, err := readTLSPEM(t.Cert, t.CertFile)
+	if err != nil {
+		return nil, fmt.Errorf("read cert: %w", err)
+	}
+
+	key, err := readTLSPEM(t.Key, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+
+	if cert != nil || key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return config, nil
+}
+
+// readTLSPEM returns the inline PEM content, or the content of the file when no inline PEM is given.
+func readTLSPEM(content, file string) ([]byte, error) {
+	if content != "" {
+		return []byte(content), nil
+	}
+
+	if file == "" {
+		return nil, nil
+	}
+
+	return os.ReadFile(file)
+}
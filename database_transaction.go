@@ -0,0 +1,71 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"gorm.io/gorm"
+)
+
+const (
+	mysqlErrLockWaitTimeout = 1205
+	mysqlErrLockDeadlock    = 1213
+
+	postgresErrSerializationFailure = "40001"
+	postgresErrDeadlockDetected     = "40P01"
+)
+
+// WithTransaction runs fn in a transaction on the writer, committing when fn returns nil and rolling back otherwise.
+// The whole transaction is retried by DefaultDatabaseTransactionRetryPolicy when it fails with a MySQL deadlock (1213)
+// or lock wait timeout (1205), or a PostgreSQL serialization failure or deadlock, so fn must be safe to run again.
+func (k *Database) WithTransaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	if k.writer == nil {
+		return fmt.Errorf("database writer not configured")
+	}
+
+	db, err := k.writer.DBContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Other errors end the retries, they are kept aside and returned once Do returns
+	var permanent error
+	attempt := 0
+	err = DefaultDatabaseTransactionRetryPolicy.Do(ctx, func() error {
+		attempt++
+		err := db.WithContext(ctx).Transaction(fn)
+		if err != nil && !isRetryableTransactionError(err) {
+			permanent = err
+			return nil
+		}
+
+		if err != nil {
+			kklogger.DebugJ("datastore:Database.WithTransaction", fmt.Sprintf("attempt %d: %s", attempt, err.Error()))
+		}
+
+		return err
+	})
+	if permanent != nil {
+		return permanent
+	}
+
+	return err
+}
+
+func isRetryableTransactionError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlErrLockDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == postgresErrSerializationFailure || pgErr.Code == postgresErrDeadlockDetected
+	}
+
+	return false
+}
@@ -0,0 +1,192 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// DataStore is the part common to every store of the package, so health checks, metrics export and
+// shutdown can be written once for Redis, Database, Cassandra, Mongo, Kafka, ObjectStore, Memcached, KV and Rabbit.
+type DataStore interface {
+	// Name returns "<kind>/<profile>", e.g. "redis/default", unique per store in a DataStoreRegistry
+	Name() string
+	// Ping checks the backend can be reached, it does not open connections the store would not open otherwise
+	// unless the backend has no other way to be checked
+	Ping(ctx context.Context) error
+	// Stats returns the current counters and gauges of the store
+	Stats() DataStoreStats
+}
+
+// closeDataStore closes store with its Close method, Close() error like io.Closer or Close(), and returns its
+// error. Stores without one are left open.
+func closeDataStore(store DataStore) error {
+	switch closer := store.(type) {
+	case io.Closer:
+		return closer.Close()
+	case interface{ Close() }:
+		closer.Close()
+	}
+
+	return nil
+}
+
+// DataStoreStats are metrics of a store by dotted name, e.g. "master.active_conns".
+// Durations are in milliseconds.
+type DataStoreStats map[string]float64
+
+// ErrDataStoreRegistered is returned by DataStoreRegistry.Register for a name that is already registered.
+var ErrDataStoreRegistered = errors.New("datastore already registered")
+
+// DataStoreRegistry keeps DataStores by Name for generic health checks, metrics export and shutdown.
+// Manager registers every instance it constructs in its own registry, see Manager.DataStores.
+type DataStoreRegistry struct {
+	mutex  sync.RWMutex
+	stores map[string]DataStore
+}
+
+// NewDataStoreRegistry returns an empty DataStoreRegistry.
+func NewDataStoreRegistry() *DataStoreRegistry {
+	return &DataStoreRegistry{stores: map[string]DataStore{}}
+}
+
+// Register adds store under its Name, ErrDataStoreRegistered if the name is taken.
+func (r *DataStoreRegistry) Register(store DataStore) error {
+	name := store.Name()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.stores[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDataStoreRegistered, name)
+	}
+
+	r.stores[name] = store
+	return nil
+}
+
+// Unregister removes and returns the store of name without closing it, nil if it is not registered.
+func (r *DataStoreRegistry) Unregister(name string) DataStore {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	store := r.stores[name]
+	delete(r.stores, name)
+	return store
+}
+
+// Get returns the store of name, nil if it is not registered.
+func (r *DataStoreRegistry) Get(name string) DataStore {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.stores[name]
+}
+
+// Names returns the sorted names of the registered stores.
+func (r *DataStoreRegistry) Names() []string {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.stores))
+	for name := range r.stores {
+		names = append(names, name)
+	}
+
+	r.mutex.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Stores returns the registered stores sorted by name.
+func (r *DataStoreRegistry) Stores() []DataStore {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	stores := make([]DataStore, 0, len(r.stores))
+	for _, store := range r.stores {
+		stores = append(stores, store)
+	}
+
+	sort.Slice(stores, func(i, j int) bool { return stores[i].Name() < stores[j].Name() })
+	return stores
+}
+
+// Ping pings every store concurrently and returns the outcome by name, nil for healthy stores.
+// Dial failures and timeouts are classified as ErrDial and ErrTimeout.
+func (r *DataStoreRegistry) Ping(ctx context.Context) map[string]error {
+	stores := r.Stores()
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func(i int, store DataStore) {
+			defer wg.Done()
+			errs[i] = classifyError(store.Name(), "ping", store.Ping(ctx))
+		}(i, store)
+	}
+
+	wg.Wait()
+	result := make(map[string]error, len(stores))
+	for i, store := range stores {
+		result[store.Name()] = errs[i]
+	}
+
+	return result
+}
+
+// Healthy returns an error joining the Ping failures of every store, nil when all of them are reachable.
+func (r *DataStoreRegistry) Healthy(ctx context.Context) error {
+	result := r.Ping(ctx)
+	var errs []error
+	for _, name := range r.Names() {
+		if err := result[name]; err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stats returns the stats of every store by name.
+func (r *DataStoreRegistry) Stats() map[string]DataStoreStats {
+	stores := r.Stores()
+	result := make(map[string]DataStoreStats, len(stores))
+	for _, store := range stores {
+		result[store.Name()] = store.Stats()
+	}
+
+	return result
+}
+
+// Close closes and unregisters every store, returning their errors joined.
+func (r *DataStoreRegistry) Close() error {
+	r.mutex.Lock()
+	stores := r.stores
+	r.stores = map[string]DataStore{}
+	r.mutex.Unlock()
+
+	names := make([]string, 0, len(stores))
+	for name := range stores {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if err := closeDataStore(stores[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Compile-time checks that every store implements DataStore.
+var (
+	_ DataStore = (*Redis)(nil)
+	_ DataStore = (*Database)(nil)
+	_ DataStore = (*Cassandra)(nil)
+	_ DataStore = (*Mongo)(nil)
+	_ DataStore = (*Kafka)(nil)
+	_ DataStore = (*ObjectStore)(nil)
+	_ DataStore = (*Memcached)(nil)
+	_ DataStore = (*KV)(nil)
+	_ DataStore = (*Rabbit)(nil)
+)
@@ -0,0 +1,81 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestDataStoreRegistry(t *testing.T) {
+	t.Run("Register and lookup", func(t *testing.T) {
+		registry := NewDataStoreRegistry()
+		r := NewMockRedis()
+		assert.NoError(t, registry.Register(r))
+		assert.NoError(t, registry.Register(NewMockCassandra()))
+		assert.ErrorIs(t, registry.Register(NewMockRedis()), ErrDataStoreRegistered)
+
+		assert.Equal(t, []string{"cassandra/mock-cassandra", "redis/mock"}, registry.Names())
+		assert.Same(t, r, registry.Get("redis/mock"))
+		assert.Nil(t, registry.Get("redis/missing"))
+
+		assert.Same(t, r, registry.Unregister("redis/mock"))
+		assert.Nil(t, registry.Get("redis/mock"))
+		assert.Len(t, registry.Stores(), 1)
+	})
+
+	t.Run("Ping", func(t *testing.T) {
+		registry := NewDataStoreRegistry()
+		writer := NewMockDatabaseOp()
+		writer.SetMockDB(&gorm.DB{})
+		assert.NoError(t, registry.Register(NewMockDatabaseWithOps(writer, NewMockDatabaseOp())))
+		assert.NoError(t, registry.Register(NewMockKV()))
+		assert.NoError(t, registry.Register(NewMockMongo()))
+		assert.NoError(t, registry.Register(NewMockObjectStore()))
+		assert.NoError(t, registry.Register(NewMockMemcached()))
+		assert.NoError(t, registry.Register(NewMockRabbit()))
+		assert.NoError(t, registry.Register(NewMockKafka()))
+		assert.NoError(t, registry.Healthy(context.Background()))
+
+		writer.SetPingError(errors.New("connection refused"))
+		result := registry.Ping(context.Background())
+		assert.Len(t, result, 7)
+		assert.EqualError(t, result["database/custom-mock-database"], "connection refused")
+		assert.NoError(t, result["kv/mock-kv"])
+
+		err := registry.Healthy(context.Background())
+		assert.EqualError(t, err, "database/custom-mock-database: connection refused")
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		registry := NewDataStoreRegistry()
+		kafka := NewMockKafka()
+		assert.NoError(t, kafka.Producer().Send(context.Background(), KafkaMessage{Topic: "events"}))
+		_, err := kafka.Consumer("group", "events")
+		assert.NoError(t, err)
+		assert.NoError(t, registry.Register(kafka))
+		assert.NoError(t, registry.Register(NewMockRedis()))
+
+		stats := registry.Stats()
+		assert.Equal(t, float64(1), stats["kafka/mock-kafka"]["producer.sent"])
+		assert.Equal(t, float64(1), stats["kafka/mock-kafka"]["consumers"])
+		assert.Contains(t, stats["redis/mock"], "master.active_conns")
+		assert.Contains(t, stats["redis/mock"], "slave.idle_conns")
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		registry := NewDataStoreRegistry()
+		writer, reader := NewMockCassandraOp(), NewMockCassandraOp()
+		kafka := NewMockKafka()
+		assert.NoError(t, registry.Register(NewMockCassandraWithOps(writer, reader)))
+		assert.NoError(t, registry.Register(kafka))
+
+		assert.NoError(t, registry.Close())
+		assert.True(t, writer.IsSessionClosed())
+		assert.True(t, reader.IsSessionClosed())
+		assert.ErrorIs(t, kafka.Ping(context.Background()), ErrKafkaProducerClosed)
+		assert.Empty(t, registry.Names())
+	})
+}
@@ -0,0 +1,91 @@
+package datastoretest
+
+import (
+	"strconv"
+	"testing"
+
+	datastore "github.com/yetiz-org/goth-datastore"
+)
+
+// AssertString checks that resp succeeded with the string reply expected, and returns whether it did.
+func AssertString(t testing.TB, resp *datastore.RedisResponse, expected string) bool {
+	t.Helper()
+	if !assertNoError(t, resp) {
+		return false
+	}
+
+	if actual := resp.GetString(); actual != expected {
+		t.Errorf("redis reply: expected %q, got %q", expected, actual)
+		return false
+	}
+
+	return true
+}
+
+// AssertInt checks that resp succeeded with the integer reply expected, or a string of it like the reply of GET,
+// and returns whether it did.
+func AssertInt(t testing.TB, resp *datastore.RedisResponse, expected int64) bool {
+	t.Helper()
+	if !assertNoError(t, resp) {
+		return false
+	}
+
+	if actual := resp.GetString(); actual != strconv.FormatInt(expected, 10) {
+		t.Errorf("redis reply: expected %d, got %q", expected, actual)
+		return false
+	}
+
+	return true
+}
+
+// AssertNotFound checks that resp failed with a not found error, the nil reply of a missing key, and returns
+// whether it did.
+func AssertNotFound(t testing.TB, resp *datastore.RedisResponse) bool {
+	t.Helper()
+	if resp == nil {
+		t.Errorf("redis reply: expected not found, got no response")
+		return false
+	}
+
+	if !datastore.IsNotFound(resp.Error) {
+		if resp.Error != nil {
+			t.Errorf("redis reply: expected not found, got error %s", resp.Error)
+		} else {
+			t.Errorf("redis reply: expected not found, got %q", resp.GetString())
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// AssertSliceLen checks that resp succeeded with an array reply of n elements, and returns whether it did.
+func AssertSliceLen(t testing.TB, resp *datastore.RedisResponse, n int) bool {
+	t.Helper()
+	if !assertNoError(t, resp) {
+		return false
+	}
+
+	if actual := len(resp.GetSlice()); actual != n {
+		t.Errorf("redis reply: expected %d elements, got %d", n, actual)
+		return false
+	}
+
+	return true
+}
+
+func assertNoError(t testing.TB, resp *datastore.RedisResponse) bool {
+	t.Helper()
+	if resp == nil {
+		t.Errorf("redis reply: no response")
+		return false
+	}
+
+	if resp.Error != nil {
+		t.Errorf("redis reply: unexpected error %s", resp.Error)
+		return false
+	}
+
+	return true
+}
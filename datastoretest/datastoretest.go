@@ -0,0 +1,88 @@
+// Package datastoretest provides Redis, MySQL and Cassandra stores to integration tests. The servers are found or
+// started by testserver, a server already listening at the ports of the docker-compose.yml of the repository by
+// default, or a container of testcontainers-go when built with the testcontainers tag. The test is skipped when
+// neither is available.
+//
+// The stores are created from a profile written to a temporary secret directory, and closed when the test ends.
+// Without Main every test starts its own containers, with it they are shared by the tests of the package:
+//
+//	func TestMain(m *testing.M) {
+//		datastoretest.Main(m)
+//	}
+//
+//	func TestCache(t *testing.T) {
+//		redis := datastoretest.Redis(t)
+//		...
+//	}
+//
+// AssertString, AssertInt, AssertNotFound and AssertSliceLen check the responses of Redis commands.
+package datastoretest
+
+import (
+	"testing"
+
+	datastore "github.com/yetiz-org/goth-datastore"
+	"github.com/yetiz-org/goth-datastore/datastoretest/testserver"
+)
+
+// Main runs the tests of m with the containers shared by the tests, removes them and exits.
+func Main(m *testing.M) {
+	testserver.Main(m)
+}
+
+// Redis returns a Redis of a ready server, closed when t ends.
+func Redis(t testing.TB) *datastore.Redis {
+	t.Helper()
+	profile := testserver.RedisProfile(t)
+	var r *datastore.Redis
+	testserver.WithProfile(t, "redis", profile, func(name string) {
+		r = datastore.NewRedis(name)
+	})
+
+	if r == nil {
+		t.Fatalf("create redis of %s", profile.Master.Addr())
+	}
+
+	t.Cleanup(func() {
+		r.Close()
+	})
+
+	return r
+}
+
+// Database returns a Database of a ready MySQL server, closed when t ends.
+func Database(t testing.TB) *datastore.Database {
+	t.Helper()
+	profile := testserver.DatabaseProfile(t)
+	var db *datastore.Database
+	testserver.WithProfile(t, "database", profile, func(name string) {
+		db = datastore.NewDatabase(name)
+	})
+
+	if db == nil {
+		t.Fatalf("create database of %s:%d", profile.Writer.Params.Host, profile.Writer.Params.Port)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+// Cassandra returns a Cassandra of a ready server, closed when t ends.
+func Cassandra(t testing.TB) *datastore.Cassandra {
+	t.Helper()
+	profile := testserver.CassandraProfile(t)
+	var c *datastore.Cassandra
+	testserver.WithProfile(t, "cassandra", profile, func(name string) {
+		c = datastore.NewCassandra(name)
+	})
+
+	if c == nil {
+		t.Fatalf("create cassandra of %s", profile.Writer.Endpoints[0])
+	}
+
+	t.Cleanup(c.Close)
+	return c
+}
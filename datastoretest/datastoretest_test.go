@@ -0,0 +1,70 @@
+package datastoretest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	datastore "github.com/yetiz-org/goth-datastore"
+	"github.com/yetiz-org/goth-datastore/datastoretest/testserver"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedis(t *testing.T) {
+	path := secret.PATH
+	redis := Redis(t)
+	assert.Equal(t, path, secret.PATH)
+	assert.Equal(t, "redis/"+testserver.ProfileName, redis.Name())
+	assert.NoError(t, redis.Master().Set("test_datastoretest", 1).Error)
+	assert.Equal(t, "1", redis.Slave().Get("test_datastoretest").GetString())
+	redis.Master().Delete("test_datastoretest")
+}
+
+func TestDatabase(t *testing.T) {
+	db := Database(t)
+	assert.NoError(t, db.Ping(context.Background()))
+}
+
+func TestCassandra(t *testing.T) {
+	c := Cassandra(t)
+	assert.NoError(t, c.Ping(context.Background()))
+}
+
+// recordingTB records the errors reported to it.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssert(t *testing.T) {
+	op := datastore.NewStatefulMockRedis().Master()
+	op.Set("name", "value")
+	op.Set("count", 3)
+	op.RPush("list", "a", "b")
+
+	assert.True(t, AssertString(t, op.Get("name"), "value"))
+	assert.True(t, AssertInt(t, op.Incr("count"), 4))
+	assert.True(t, AssertNotFound(t, op.Get("missing")))
+	assert.True(t, AssertSliceLen(t, op.LRange("list", 0, -1), 2))
+
+	r := &recordingTB{TB: t}
+	assert.False(t, AssertString(r, op.Get("name"), "other"))
+	assert.False(t, AssertString(r, op.Get("missing"), "value"))
+	assert.False(t, AssertInt(r, op.Get("count"), 3))
+	assert.False(t, AssertNotFound(r, op.Get("name")))
+	assert.False(t, AssertSliceLen(r, op.LRange("list", 0, -1), 3))
+	assert.Equal(t, []string{
+		`redis reply: expected "other", got "value"`,
+		"redis reply: unexpected error not_found",
+		`redis reply: expected 3, got "4"`,
+		`redis reply: expected not found, got "value"`,
+		"redis reply: expected 3 elements, got 2",
+	}, r.errors)
+}
@@ -0,0 +1,53 @@
+package testserver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+var (
+	// CassandraImage is the image of the Cassandra containers.
+	CassandraImage = "cassandra:4.1"
+	// CassandraKeyspace is the keyspace of the tests, created on the server when missing.
+	CassandraKeyspace = "datastoretest"
+)
+
+var cassandraBackend = &backend{
+	kind:  "cassandra",
+	env:   "GOTH_TEST_CASSANDRA_ADDR",
+	addr:  "127.0.0.1:9042",
+	image: &CassandraImage,
+	port:  9042,
+	vars: func() map[string]string {
+		return map[string]string{"MAX_HEAP_SIZE": "512M", "HEAP_NEWSIZE": "128M"}
+	},
+	timeout: 3 * time.Minute,
+	ready: func(ctx context.Context, addr string) error {
+		host, port := splitAddr(addr)
+		cluster := gocql.NewCluster(host)
+		cluster.Port, cluster.ProtoVersion = int(port), 3
+		cluster.ConnectTimeout, cluster.Timeout = ProbeTimeout, 10*time.Second
+		cluster.DisableInitialHostLookup = true
+		session, err := cluster.CreateSession()
+		if err != nil {
+			return err
+		}
+
+		defer session.Close()
+		return session.Query(fmt.Sprintf("CREATE KEYSPACE IF NOT EXISTS %s WITH replication = "+
+			"{'class': 'SimpleStrategy', 'replication_factor': 1}", CassandraKeyspace)).WithContext(ctx).Exec()
+	},
+}
+
+// CassandraProfile returns a profile of a ready Cassandra server and CassandraKeyspace, skipping t when there is
+// none.
+func CassandraProfile(t testing.TB) *secret.Cassandra {
+	t.Helper()
+	meta := secret.CassandraMeta{Endpoints: []string{cassandraBackend.address(t)}, Keyspace: CassandraKeyspace}
+	return &secret.Cassandra{Writer: meta, Reader: meta}
+}
@@ -0,0 +1,49 @@
+//go:build testcontainers
+
+package testserver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+// start starts a container of the image of the backend with testcontainers-go, and returns the address of its
+// port and the function terminating it.
+func (b *backend) start() (string, func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	request := testcontainers.ContainerRequest{
+		Image:        *b.image,
+		ExposedPorts: []string{fmt.Sprintf("%d/tcp", b.port)},
+	}
+
+	if b.vars != nil {
+		request.Env = b.vars()
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: request,
+		Started:          true,
+	})
+	if err != nil {
+		if container != nil {
+			container.Terminate(context.Background())
+		}
+
+		return "", nil, err
+	}
+
+	terminate := func() {
+		container.Terminate(context.Background())
+	}
+
+	addr, err := container.Endpoint(ctx, "")
+	if err != nil {
+		terminate()
+		return "", nil, err
+	}
+
+	return addr, terminate, nil
+}
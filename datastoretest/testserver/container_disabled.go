@@ -0,0 +1,12 @@
+//go:build !testcontainers
+
+package testserver
+
+import "errors"
+
+// errContainersDisabled is returned by start when the package is built without the testcontainers tag.
+var errContainersDisabled = errors.New("containers need the testcontainers build tag")
+
+func (b *backend) start() (string, func(), error) {
+	return "", nil, errContainersDisabled
+}
@@ -0,0 +1,59 @@
+package testserver
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+var (
+	// MySQLImage is the image of the MySQL containers.
+	MySQLImage = "mysql:8.0"
+	// MySQLDatabase, MySQLUsername and MySQLPassword are the schema and the account of the tests, created in the
+	// containers and expected on an existing server.
+	MySQLDatabase = "test"
+	MySQLUsername = "test"
+	MySQLPassword = "test"
+)
+
+var mysqlBackend = &backend{
+	kind:  "mysql",
+	env:   "GOTH_TEST_MYSQL_ADDR",
+	addr:  "127.0.0.1:3306",
+	image: &MySQLImage,
+	port:  3306,
+	vars: func() map[string]string {
+		return map[string]string{
+			"MYSQL_ROOT_PASSWORD": "rootpassword",
+			"MYSQL_DATABASE":      MySQLDatabase,
+			"MYSQL_USER":          MySQLUsername,
+			"MYSQL_PASSWORD":      MySQLPassword,
+		}
+	},
+	timeout: 2 * time.Minute,
+	ready: func(ctx context.Context, addr string) error {
+		config := mysql.NewConfig()
+		config.User, config.Passwd, config.Net, config.Addr, config.DBName = MySQLUsername, MySQLPassword, "tcp", addr, MySQLDatabase
+		db, err := sql.Open("mysql", config.FormatDSN())
+		if err != nil {
+			return err
+		}
+
+		defer db.Close()
+		return db.PingContext(ctx)
+	},
+}
+
+// DatabaseProfile returns a MySQL profile of a ready server, skipping t when there is none.
+func DatabaseProfile(t testing.TB) *secret.Database {
+	t.Helper()
+	host, port := splitAddr(mysqlBackend.address(t))
+	meta := secret.DatabaseMeta{Adapter: "mysql"}
+	meta.Params.Charset, meta.Params.Host, meta.Params.Port = "utf8mb4", host, port
+	meta.Params.DBName, meta.Params.Username, meta.Params.Password = MySQLDatabase, MySQLUsername, MySQLPassword
+	return &secret.Database{Writer: meta, Reader: meta}
+}
@@ -0,0 +1,58 @@
+package testserver
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// RedisImage is the image of the Redis containers.
+var RedisImage = "redis:7-alpine"
+
+var redisBackend = &backend{
+	kind:    "redis",
+	env:     "GOTH_TEST_REDIS_ADDR",
+	addr:    "127.0.0.1:6379",
+	image:   &RedisImage,
+	port:    6379,
+	timeout: 30 * time.Second,
+	ready:   redisReady,
+}
+
+// redisMigrateBackend is a second Redis server, the target of MIGRATE. It has no container: the first server
+// connects to it, which the port of a container mapped on the host does not allow.
+var redisMigrateBackend = &backend{
+	kind:    "redis migrate target",
+	env:     "GOTH_TEST_REDIS_MIGRATE_ADDR",
+	timeout: 30 * time.Second,
+	ready:   redisReady,
+}
+
+func redisReady(ctx context.Context, addr string) error {
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, DisableIdentity: true})
+	defer client.Close()
+	return client.Ping(ctx).Err()
+}
+
+// RedisProfile returns a single mode profile of a ready Redis server, skipping t when there is none.
+func RedisProfile(t testing.TB) *secret.Redis {
+	t.Helper()
+	host, port := splitAddr(redisBackend.address(t))
+	meta := secret.RedisMeta{Host: host, Port: port}
+	return &secret.Redis{Mode: secret.RedisModeSingle, Master: meta, Slave: meta}
+}
+
+// RedisMigrateAddr returns the address of a second ready Redis server, the target of MIGRATE, skipping t when
+// GOTH_TEST_REDIS_MIGRATE_ADDR does not point at one.
+func RedisMigrateAddr(t testing.TB) string {
+	t.Helper()
+	if os.Getenv(redisMigrateBackend.env) == "" {
+		t.Skipf("%s is not set", redisMigrateBackend.env)
+	}
+
+	return redisMigrateBackend.address(t)
+}
@@ -0,0 +1,198 @@
+// Package testserver finds the Redis, MySQL and Cassandra servers of integration tests and writes their profiles.
+// A server already listening at GOTH_TEST_REDIS_ADDR, GOTH_TEST_MYSQL_ADDR or GOTH_TEST_CASSANDRA_ADDR, the ports
+// of the docker-compose.yml of the repository by default, is used. Built with the testcontainers tag, a container is
+// started with testcontainers-go otherwise. The test is skipped when neither is available. The second Redis server
+// of the MIGRATE tests is only found at GOTH_TEST_REDIS_MIGRATE_ADDR.
+//
+// The package depends on the secrets only, so that the tests of the datastore package use it as well as
+// datastoretest, which creates the stores from its profiles:
+//
+//	func TestRedisServer(t *testing.T) {
+//		var redis *Redis
+//		testserver.WithProfile(t, "redis", testserver.RedisProfile(t), func(name string) {
+//			redis = NewRedis(name)
+//		})
+//		...
+//	}
+//
+// Without Main every test starts its own containers, with it they are shared by the tests of the package.
+package testserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// Docker enables starting containers when no server is found, disabled by GOTH_TEST_DOCKER=false.
+var Docker = os.Getenv("GOTH_TEST_DOCKER") != "false"
+
+// ProbeTimeout bounds the check of an existing server.
+var ProbeTimeout = 2 * time.Second
+
+// ProfileName is the name of the profiles written to the temporary secret directories.
+const ProfileName = "datastoretest"
+
+var (
+	// shared keeps the containers started until Main stops them.
+	shared bool
+	// pathMutex serializes the stores created from secret.PATH.
+	pathMutex sync.Mutex
+)
+
+// Main runs the tests of m with the containers shared by the tests, removes them and exits.
+func Main(m *testing.M) {
+	shared = true
+	code := m.Run()
+	for _, b := range []*backend{redisBackend, redisMigrateBackend, mysqlBackend, cassandraBackend} {
+		b.stop()
+	}
+
+	os.Exit(code)
+}
+
+// backend is a kind of server, found at an address or started in a container when it has an image.
+type backend struct {
+	kind    string
+	env     string
+	addr    string
+	image   *string
+	port    int
+	vars    func() map[string]string
+	timeout time.Duration
+	// ready returns nil when the server at addr accepts requests.
+	ready     func(ctx context.Context, addr string) error
+	mutex     sync.Mutex
+	found     string
+	terminate func()
+}
+
+// address returns the address of a ready server, skipping t when there is none.
+func (b *backend) address(t testing.TB) string {
+	t.Helper()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.found != "" {
+		return b.found
+	}
+
+	addr := b.addr
+	if env := os.Getenv(b.env); env != "" {
+		addr = env
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ProbeTimeout)
+	err := b.ready(ctx, addr)
+	cancel()
+	if err == nil {
+		b.found = addr
+		return addr
+	}
+
+	if !Docker || b.image == nil {
+		t.Skipf("%s unavailable at %s: %s", b.kind, addr, err)
+	}
+
+	addr, terminate, err := b.start()
+	if err != nil {
+		t.Skipf("%s unavailable, start container: %s", b.kind, err)
+	}
+
+	if err := b.wait(addr); err != nil {
+		terminate()
+		t.Fatalf("%s container at %s not ready: %s", b.kind, addr, err)
+	}
+
+	if shared {
+		b.found, b.terminate = addr, terminate
+	} else {
+		t.Cleanup(terminate)
+	}
+
+	return addr
+}
+
+// wait retries ready until the server accepts requests or the timeout of the backend elapses.
+func (b *backend) wait(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	for {
+		err := b.ready(ctx, addr)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+func (b *backend) stop() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.terminate != nil {
+		b.terminate()
+		b.found, b.terminate = "", nil
+	}
+}
+
+// WithProfile writes profile as the secret of kind in a temporary directory removed when t ends, and calls create
+// with the name of the profile while secret.PATH is at the directory. secret.PATH is restored when create returns.
+func WithProfile(t testing.TB, kind string, profile any, create func(name string)) {
+	t.Helper()
+	dir := writeProfile(t, kind, profile)
+	pathMutex.Lock()
+	defer pathMutex.Unlock()
+	original := secret.PATH
+	defer func() {
+		secret.PATH = original
+	}()
+
+	secret.PATH = dir
+	create(ProfileName)
+}
+
+// writeProfile writes profile as the secret of kind in a temporary directory removed when t ends, and returns the
+// directory.
+func writeProfile(t testing.TB, kind string, profile any) string {
+	t.Helper()
+	dir := t.TempDir()
+	bs, err := json.Marshal(profile)
+	if err != nil {
+		t.Fatalf("marshal %s profile: %s", kind, err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s", kind, ProfileName))
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatalf("create %s profile: %s", kind, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(path, "secret.json"), bs, 0o644); err != nil {
+		t.Fatalf("write %s profile: %s", kind, err)
+	}
+
+	return dir
+}
+
+// splitAddr splits host:port, the port is 0 when it is not a number.
+func splitAddr(addr string) (string, uint) {
+	i := strings.LastIndex(addr, ":")
+	if i < 0 {
+		return addr, 0
+	}
+
+	var port uint
+	fmt.Sscanf(addr[i+1:], "%d", &port)
+	return addr[:i], port
+}
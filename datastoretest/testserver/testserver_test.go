@@ -0,0 +1,55 @@
+package testserver
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestSplitAddr(t *testing.T) {
+	host, port := splitAddr("127.0.0.1:6379")
+	assert.Equal(t, "127.0.0.1", host)
+	assert.Equal(t, uint(6379), port)
+	host, port = splitAddr("[::1]:9042")
+	assert.Equal(t, "[::1]", host)
+	assert.Equal(t, uint(9042), port)
+}
+
+func TestWithProfile(t *testing.T) {
+	path := secret.PATH
+	meta := secret.RedisMeta{Host: "127.0.0.1", Port: 6379}
+	WithProfile(t, "redis", &secret.Redis{Mode: secret.RedisModeSingle, Master: meta, Slave: meta}, func(name string) {
+		assert.Equal(t, ProfileName, name)
+		assert.FileExists(t, filepath.Join(secret.PATH, "redis-"+ProfileName, "secret.json"))
+		profile := &secret.Redis{}
+		assert.NoError(t, secret.Load("redis", name, profile))
+		assert.Equal(t, meta, profile.Master)
+	})
+
+	assert.Equal(t, path, secret.PATH)
+}
+
+func TestRedisProfile(t *testing.T) {
+	profile := RedisProfile(t)
+	assert.Equal(t, secret.RedisModeSingle, profile.Mode)
+	assert.NotZero(t, profile.Master.Port)
+}
+
+func TestRedisMigrateAddr(t *testing.T) {
+	// The target is never started in a container, a test without one is skipped
+	for _, addr := range []string{"", "127.0.0.1:1"} {
+		t.Setenv("GOTH_TEST_REDIS_MIGRATE_ADDR", addr)
+		var sub *testing.T
+		t.Run("Unavailable", func(t *testing.T) {
+			sub = t
+			RedisMigrateAddr(t)
+		})
+
+		assert.True(t, sub.Skipped())
+	}
+
+	t.Setenv("GOTH_TEST_REDIS_MIGRATE_ADDR", redisBackend.address(t))
+	assert.Equal(t, redisBackend.address(t), RedisMigrateAddr(t))
+}
@@ -0,0 +1,26 @@
+package datastore
+
+import (
+	"context"
+	"net"
+)
+
+// DialContextFunc opens a connection of a store, e.g. through an SSH bastion with the DialContext of an ssh.Client,
+// or a SOCKS proxy with the dialer of golang.org/x/net/proxy. Network is "tcp", or "unix" for socket paths.
+// It implements gocql.Dialer.
+type DialContextFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// DialContext calls f.
+func (f DialContextFunc) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f(ctx, network, addr)
+}
+
+// DefaultRedisDialer opens the connections of the Redis clients created afterwards, a net.Dialer when nil.
+var DefaultRedisDialer DialContextFunc
+
+// DefaultDatabaseDialer is the Dialer of the DatabaseOp created afterwards.
+var DefaultDatabaseDialer DialContextFunc
+
+// DefaultCassandraDialer opens the connections of the Cassandra operators created afterwards, see
+// CassandraOp.SetDialer.
+var DefaultCassandraDialer DialContextFunc
@@ -0,0 +1,114 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"gorm.io/driver/mysql"
+)
+
+// recordingDialer records the addresses dialed, and dials them unless err is set.
+type recordingDialer struct {
+	mutex sync.Mutex
+	addrs []string
+	err   error
+}
+
+func (d *recordingDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mutex.Lock()
+	d.addrs = append(d.addrs, network+"://"+addr)
+	d.mutex.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+func (d *recordingDialer) dialed() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string(nil), d.addrs...)
+}
+
+func TestDialContextFunc(t *testing.T) {
+	t.Run("Redis", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func(dialer DialContextFunc, idle int) {
+			secret.PATH = originalPath
+			DefaultRedisDialer, DefaultRedisTestOnBorrowIdle = dialer, idle
+		}(DefaultRedisDialer, DefaultRedisTestOnBorrowIdle)
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		for _, idle := range []int{0, 1000} {
+			dialer := &recordingDialer{}
+			DefaultRedisDialer, DefaultRedisTestOnBorrowIdle = dialer.dial, idle
+			redis := NewRedis("test")
+			assert.NotNil(t, redis)
+			assert.NoError(t, redis.Master().Set("test_dialer", idle).Error)
+			assert.Equal(t, strconv.Itoa(idle), redis.Slave().Get("test_dialer").GetString())
+			redis.Master().Delete("test_dialer")
+			redis.Close()
+			assert.Equal(t, []string{"tcp://127.0.0.1:6379", "tcp://127.0.0.1:6379"}, dialer.dialed())
+		}
+	})
+
+	t.Run("MySQL", func(t *testing.T) {
+		defer func(dialer DialContextFunc) {
+			DefaultDatabaseDialer = dialer
+		}(DefaultDatabaseDialer)
+
+		failure := errors.New("bastion unreachable")
+		dialer := &recordingDialer{err: failure}
+		DefaultDatabaseDialer = dialer.dial
+		meta := secret.DatabaseMeta{Adapter: "mysql"}
+		meta.Params.Host, meta.Params.Port, meta.Params.DBName = "db.internal", 3306, "app"
+		op := newDatabaseOp(meta)
+		op.RetryPolicy = RetryPolicy{Attempts: 1}
+		assert.Contains(t, mysqlDialectorDSN(t, op), "@"+op.mysqlDialNetwork()+"(db.internal:3306)/app?")
+
+		_, err := op.DBContext(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, dialer.dialed(), "tcp://db.internal:3306")
+
+		// unix sockets are dialed by the driver
+		meta.Params.Socket = "/var/run/mysqld/mysqld.sock"
+		assert.Contains(t, mysqlDialectorDSN(t, newDatabaseOp(meta)), "@unix(/var/run/mysqld/mysqld.sock)/app?")
+	})
+
+	t.Run("Cassandra", func(t *testing.T) {
+		defer func(dialer DialContextFunc) {
+			DefaultCassandraDialer = dialer
+		}(DefaultCassandraDialer)
+
+		meta := secret.CassandraMeta{Endpoints: []string{"127.0.0.1:9042"}, Keyspace: "testkeyspace"}
+		assert.Nil(t, configureCassandraOp(meta).Config().Dialer)
+
+		dialer := &recordingDialer{err: errors.New("proxy refused")}
+		DefaultCassandraDialer = dialer.dial
+		op := configureCassandraOp(meta)
+		assert.NotNil(t, op.Config().Dialer)
+		_, err := op.NewSession()
+		assert.Error(t, err)
+		assert.Contains(t, dialer.dialed(), "tcp://127.0.0.1:9042")
+
+		op.SetDialer(nil)
+		assert.Nil(t, op.Config().Dialer)
+	})
+}
+
+// mysqlDialectorDSN returns the DSN of the MySQL dialector of op.
+func mysqlDialectorDSN(t *testing.T, op *DatabaseOp) string {
+	dialector, err := newBuiltinDialector(op)
+	assert.NoError(t, err)
+	return dialector.(*mysql.Dialector).DSN
+}
@@ -0,0 +1,83 @@
+package datastore
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDNSRefreshInterval is how often the hostnames of the Redis, database and Cassandra servers are resolved
+// again. When the addresses of a name change, e.g. a Kubernetes service moved to new pods, the connections to the
+// previous ones are recycled: Redis drops the pooled connections to the addresses gone, the database pool and the
+// Cassandra session are reopened. 0 disables re-resolution, new connections resolve the name anyway.
+var DefaultDNSRefreshInterval = time.Duration(0)
+
+func init() {
+	envMillis("GOTH_DEFAULT_DNS_REFRESH_INTERVAL", &DefaultDNSRefreshInterval)
+}
+
+// dnsLookupTimeout bounds a resolution, a slow resolver keeps the previous addresses.
+const dnsLookupTimeout = 5 * time.Second
+
+// dnsLookupHost resolves a hostname to its addresses.
+var dnsLookupHost = net.DefaultResolver.LookupHost
+
+// dnsResolver remembers the addresses a hostname resolved to, and reports when they change.
+type dnsResolver struct {
+	host       string
+	interval   time.Duration
+	mutex      sync.Mutex
+	addrs      []string
+	resolvedAt time.Time
+}
+
+// newDNSResolver returns the resolver of host, nil when DefaultDNSRefreshInterval is disabled or host is empty, an
+// IP address or a unix socket path.
+func newDNSResolver(host string) *dnsResolver {
+	if DefaultDNSRefreshInterval <= 0 || host == "" || net.ParseIP(host) != nil || strings.HasPrefix(host, "/") {
+		return nil
+	}
+
+	return &dnsResolver{host: host, interval: DefaultDNSRefreshInterval}
+}
+
+// due reports whether the interval elapsed since the last resolution, and claims the next one so concurrent
+// callers do not resolve the name again.
+func (r *dnsResolver) due(now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if now.Sub(r.resolvedAt) < r.interval {
+		return false
+	}
+
+	r.resolvedAt = now
+	return true
+}
+
+// resolve looks the name up and reports whether its addresses changed since the previous resolution. The first
+// resolution and a failed one are no change.
+func (r *dnsResolver) resolve(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	addrs, err := dnsLookupHost(ctx, r.host)
+	if err != nil {
+		return false, err
+	}
+
+	slices.Sort(addrs)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	previous := r.addrs
+	r.addrs = addrs
+	return previous != nil && !slices.Equal(previous, addrs), nil
+}
+
+// contains reports whether ip is one of the addresses of the last resolution, true before the first one.
+func (r *dnsResolver) contains(ip string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.addrs == nil || slices.Contains(r.addrs, ip)
+}
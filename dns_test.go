@@ -0,0 +1,171 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// setDNSLookup replaces the resolution of hostnames until the test ends.
+func setDNSLookup(t *testing.T, lookup func(ctx context.Context, host string) ([]string, error)) {
+	original, interval := dnsLookupHost, DefaultDNSRefreshInterval
+	t.Cleanup(func() {
+		dnsLookupHost, DefaultDNSRefreshInterval = original, interval
+	})
+
+	dnsLookupHost = lookup
+}
+
+func TestDNSResolver(t *testing.T) {
+	var mutex sync.Mutex
+	addrs := []string{"10.0.0.2", "10.0.0.1"}
+	failure := errors.New("no such host")
+	var lookupErr error
+	setDNSLookup(t, func(ctx context.Context, host string) ([]string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), addrs...), lookupErr
+	})
+
+	DefaultDNSRefreshInterval = 0
+	assert.Nil(t, newDNSResolver("redis.example"))
+
+	DefaultDNSRefreshInterval = time.Minute
+	assert.Nil(t, newDNSResolver(""))
+	assert.Nil(t, newDNSResolver("10.0.0.1"))
+	assert.Nil(t, newDNSResolver("::1"))
+
+	resolver := newDNSResolver("redis.example")
+	assert.NotNil(t, resolver)
+	now := time.Now()
+	assert.True(t, resolver.due(now))
+	assert.False(t, resolver.due(now.Add(time.Second)))
+	assert.True(t, resolver.due(now.Add(time.Minute)))
+
+	assert.True(t, resolver.contains("10.0.0.9"))
+	changed, err := resolver.resolve(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	assert.True(t, resolver.contains("10.0.0.1"))
+	assert.False(t, resolver.contains("10.0.0.9"))
+
+	addrs = []string{"10.0.0.1", "10.0.0.2"}
+	changed, _ = resolver.resolve(context.Background())
+	assert.False(t, changed)
+
+	lookupErr = failure
+	changed, err = resolver.resolve(context.Background())
+	assert.ErrorIs(t, err, failure)
+	assert.False(t, changed)
+
+	lookupErr, addrs = nil, []string{"10.0.0.3"}
+	changed, _ = resolver.resolve(context.Background())
+	assert.True(t, changed)
+	assert.False(t, resolver.contains("10.0.0.1"))
+}
+
+func TestRedisDNSRefresher(t *testing.T) {
+	var mutex sync.Mutex
+	var moved bool
+	setDNSLookup(t, func(ctx context.Context, host string) ([]string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if moved {
+			return []string{"10.0.0.1"}, nil
+		}
+
+		return net.DefaultResolver.LookupHost(ctx, host)
+	})
+
+	DefaultDNSRefreshInterval = time.Hour
+	assert.Nil(t, newRedisDNSRefresher([]string{"127.0.0.1:6379"}))
+
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+	profile, err := secret.LoadRedisProfile("test")
+	assert.NoError(t, err)
+	profile.Master.Host, profile.Slave.Host = "localhost", "localhost"
+	redis := NewRedisWithProfile("test", profile)
+	assert.NotNil(t, redis)
+	defer redis.Close()
+
+	counts := map[string]int{}
+	redis.AddConnObserver(func(event RedisConnEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		counts[event.Type]++
+	})
+
+	op := redis.Master().(*RedisOp)
+	assert.NotNil(t, op.dns)
+	defer op.Delete("test_dns")
+	assert.NoError(t, op.Set("test_dns", 1).Error)
+
+	// the refresher resolved the name on start, the connection is not recycled until the addresses change
+	op.dns.refresh(context.Background())
+	assert.NoError(t, op.Set("test_dns", 2).Error)
+	mutex.Lock()
+	assert.Equal(t, 1, counts[RedisConnDialed])
+	moved = true
+	mutex.Unlock()
+
+	op.dns.refresh(context.Background())
+	assert.Equal(t, "2", op.Get("test_dns").GetString())
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 2, counts[RedisConnDialed])
+	assert.Equal(t, 1, counts[RedisConnClosed])
+}
+
+func TestDatabaseDNSRefresh(t *testing.T) {
+	var mutex sync.Mutex
+	addrs := []string{"10.0.0.1"}
+	setDNSLookup(t, func(ctx context.Context, host string) ([]string, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return addrs, nil
+	})
+
+	drainTimeout := DefaultDatabasePoolDrainTimeout
+	defer func() {
+		DefaultDatabasePoolDrainTimeout = drainTimeout
+	}()
+
+	DefaultDatabasePoolDrainTimeout = 50
+	DefaultDNSRefreshInterval = time.Hour
+	assert.Nil(t, newDatabaseOp(secret.DatabaseMeta{Adapter: "sqlite"}).dns)
+
+	op := newDatabaseOp(secret.DatabaseMeta{Adapter: "sqlite"})
+	op.dns = &dnsResolver{host: "db.example", interval: time.Millisecond}
+	db := op.DB()
+	assert.NotNil(t, db)
+
+	// the first resolution records the addresses, the pool is kept
+	assert.Equal(t, db, op.DB())
+	assert.Eventually(t, func() bool { return op.dns.contains("10.0.0.1") && !op.dns.contains("10.0.0.2") }, time.Second, time.Millisecond)
+	assert.Equal(t, db, op.DB())
+
+	mutex.Lock()
+	addrs = []string{"10.0.0.2"}
+	mutex.Unlock()
+	assert.Eventually(t, func() bool { return op.DB() != db }, time.Second, 5*time.Millisecond)
+	// the replaced pool is drained, not closed under its holders
+	sqlDb, err := db.DB()
+	assert.NoError(t, err)
+	assert.NoError(t, sqlDb.Ping())
+	assert.Eventually(t, func() bool { return sqlDb.Ping() != nil }, time.Second, 10*time.Millisecond)
+	op.closePool()
+}
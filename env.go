@@ -3,6 +3,7 @@ package datastore
 import (
 	"os"
 	"strconv"
+	"time"
 )
 
 func envStr[T ~string](key string, dest *T) {
@@ -26,3 +27,19 @@ func envBool(key string, dest *bool) {
 		}
 	}
 }
+
+func envMillis(key string, dest *time.Duration) {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			*dest = time.Duration(n) * time.Millisecond
+		}
+	}
+}
+
+func envFloat(key string, dest *float64) {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			*dest = f
+		}
+	}
+}
@@ -3,6 +3,7 @@ package datastore
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -140,6 +141,42 @@ func TestEnvBool(t *testing.T) {
 	})
 }
 
+// ── envMillis ─────────────────────────────────────────────────────────────────
+
+func TestEnvMillis(t *testing.T) {
+	t.Run("overrides when env is a valid integer", func(t *testing.T) {
+		v := time.Second
+		t.Setenv("_TEST_GOTH_MILLIS", "250")
+		envMillis("_TEST_GOTH_MILLIS", &v)
+		assert.Equal(t, 250*time.Millisecond, v)
+	})
+
+	t.Run("preserves value when env is not an integer", func(t *testing.T) {
+		v := time.Second
+		t.Setenv("_TEST_GOTH_MILLIS_BAD", "1s")
+		envMillis("_TEST_GOTH_MILLIS_BAD", &v)
+		assert.Equal(t, time.Second, v)
+	})
+}
+
+// ── envFloat ──────────────────────────────────────────────────────────────────
+
+func TestEnvFloat(t *testing.T) {
+	t.Run("overrides when env is a valid float", func(t *testing.T) {
+		v := 0.0
+		t.Setenv("_TEST_GOTH_FLOAT", "0.25")
+		envFloat("_TEST_GOTH_FLOAT", &v)
+		assert.Equal(t, 0.25, v)
+	})
+
+	t.Run("preserves value when env is not a float", func(t *testing.T) {
+		v := 0.1
+		t.Setenv("_TEST_GOTH_FLOAT_BAD", "ten percent")
+		envFloat("_TEST_GOTH_FLOAT_BAD", &v)
+		assert.Equal(t, 0.1, v)
+	})
+}
+
 // ── init() env mapping integration ───────────────────────────────────────────
 
 // TestDatabaseEnvOverrides verifies that every GOTH_DEFAULT_DATABASE_* env var
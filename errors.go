@@ -0,0 +1,133 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+
+	"github.com/gocql/gocql"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// Kinds of the errors returned by the stores, match them with errors.Is.
+// The original error stays in the chain, so matching it or the error of the driver keeps working.
+var (
+	// ErrSecretLoad is wrapped by the errors of loading a profile from its secret file
+	ErrSecretLoad = secret.ErrLoad
+	// ErrDial is a failure to connect to the server
+	ErrDial = errors.New("dial failed")
+	// ErrPoolExhausted is a command that got no connection from the pool in time
+	ErrPoolExhausted = errors.New("connection pool exhausted")
+	// ErrReadOnly is a write rejected by a read-only operator or replica
+	ErrReadOnly = errors.New("read-only")
+	// ErrTimeout is a command or connection that timed out
+	ErrTimeout = errors.New("timeout")
+	// ErrClosed is a command sent through a closed client
+	ErrClosed = errors.New("client closed")
+)
+
+// notFoundErrors are the errors of the stores reporting a missing key, row or document.
+var notFoundErrors = []error{
+	RedisNotFound,
+	gorm.ErrRecordNotFound,
+	sql.ErrNoRows,
+	gocql.ErrNotFound,
+	mongo.ErrNoDocuments,
+	ErrMemcachedCacheMiss,
+	ErrKVNotFound,
+	ErrObjectNotFound,
+}
+
+// IsNotFound reports whether err means the key, row or document does not exist, whatever store returned it:
+// RedisNotFound, gorm.ErrRecordNotFound, sql.ErrNoRows, gocql.ErrNotFound, mongo.ErrNoDocuments,
+// ErrMemcachedCacheMiss, ErrKVNotFound or ErrObjectNotFound.
+func IsNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, notFound := range notFoundErrors {
+		if errors.Is(err, notFound) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DataStoreError classifies an error of a store by Kind, one of the error kinds such as ErrTimeout.
+// errors.Is matches both Kind and Err, and errors.As finds the DataStoreError to read Store and Op.
+type DataStoreError struct {
+	Kind error
+	// Store is the kind or name of the store, e.g. "redis"
+	Store string
+	// Op is the command or operation that failed
+	Op  string
+	Err error
+}
+
+// Error returns the message of Err, so classified errors read like the original ones.
+func (e *DataStoreError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DataStoreError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// classifyError wraps err in a DataStoreError when it is a dial failure or a timeout, otherwise it returns err.
+func classifyError(store, op string, err error) error {
+	return classify(store, op, err, errorKind(err))
+}
+
+// classifyRedisError also classifies the pool, closed client and READONLY errors of go-redis.
+func classifyRedisError(op string, err error) error {
+	var kind error
+	switch {
+	case err == nil:
+	case errors.Is(err, redis.ErrPoolTimeout), errors.Is(err, redis.ErrPoolExhausted):
+		kind = ErrPoolExhausted
+	case errors.Is(err, redis.ErrClosed):
+		kind = ErrClosed
+	case redis.IsReadOnlyError(err):
+		kind = ErrReadOnly
+	default:
+		kind = errorKind(err)
+	}
+
+	return classify("redis", op, err, kind)
+}
+
+func classify(store, op string, err error, kind error) error {
+	var classified *DataStoreError
+	if kind == nil || errors.As(err, &classified) || errors.Is(err, kind) {
+		return err
+	}
+
+	return &DataStoreError{Kind: kind, Store: store, Op: op, Err: err}
+}
+
+func errorKind(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return ErrDial
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return ErrTimeout
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+func TestIsNotFound(t *testing.T) {
+	for _, err := range []error{
+		RedisNotFound,
+		gorm.ErrRecordNotFound,
+		sql.ErrNoRows,
+		gocql.ErrNotFound,
+		mongo.ErrNoDocuments,
+		ErrMemcachedCacheMiss,
+		fmt.Errorf("%w: user/1", ErrKVNotFound),
+		fmt.Errorf("%w: NoSuchKey", ErrObjectNotFound),
+	} {
+		assert.True(t, IsNotFound(err), err.Error())
+	}
+
+	assert.False(t, IsNotFound(nil))
+	assert.False(t, IsNotFound(assert.AnError))
+	assert.False(t, IsNotFound(ErrKVSessionNotFound))
+
+	op := NewMockRedisOp()
+	op.EnableStatefulMode()
+	assert.True(t, IsNotFound(op.Get("missing").Error))
+	_, err := NewCache[string](op, "").Get("missing")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestDataStoreError(t *testing.T) {
+	t.Run("Classify", func(t *testing.T) {
+		dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+		err := classifyError("redis", "ping", fmt.Errorf("connect: %w", dial))
+		assert.ErrorIs(t, err, ErrDial)
+		assert.ErrorIs(t, err, dial)
+		assert.Equal(t, "connect: dial tcp: connection refused", err.Error())
+
+		var classified *DataStoreError
+		assert.True(t, errors.As(err, &classified))
+		assert.Equal(t, "redis", classified.Store)
+		assert.Equal(t, "ping", classified.Op)
+		assert.Same(t, err, classifyError("redis", "ping", err))
+
+		assert.ErrorIs(t, classifyError("kv", "get", context.DeadlineExceeded), ErrTimeout)
+		assert.ErrorIs(t, classifyError("kv", "get", os.ErrDeadlineExceeded), ErrTimeout)
+		assert.Equal(t, assert.AnError, classifyError("kv", "get", assert.AnError))
+		assert.Nil(t, classifyError("kv", "get", nil))
+
+		assert.ErrorIs(t, classifyRedisError("GET", redis.ErrPoolTimeout), ErrPoolExhausted)
+		assert.ErrorIs(t, classifyRedisError("GET", redis.ErrClosed), ErrClosed)
+		assert.ErrorIs(t, classifyRedisError("SET", redis.ErrClosed), redis.ErrClosed)
+		assert.ErrorIs(t, classifyRedisError("SET", errors.New("READONLY You can't write against a read only replica.")), ErrReadOnly)
+		assert.Equal(t, RedisNotFound, classifyRedisError("GET", RedisNotFound))
+	})
+
+	t.Run("Kinds", func(t *testing.T) {
+		assert.ErrorIs(t, ErrReadOnlyOperator, ErrReadOnly)
+		assert.Equal(t, "redis operator is read-only", ErrReadOnlyOperator.Error())
+		assert.ErrorIs(t, ErrMockOutage, ErrDial)
+		assert.Equal(t, "mock: simulated outage", ErrMockOutage.Error())
+
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		secret.PATH = t.TempDir()
+		_, err := secret.LoadRedisProfile("missing")
+		assert.ErrorIs(t, err, ErrSecretLoad)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("Redis", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		r := NewRedis("test")
+		assert.NotNil(t, r)
+		r.Close()
+		assert.ErrorIs(t, r.Master().Get("test_errors").Error, ErrClosed)
+
+		profile := &secret.RedisProfile{Master: secret.RedisMeta{Host: "127.0.0.1", Port: 1}}
+		unreachable := NewRedisWithProfile("unreachable", profile)
+		defer unreachable.Close()
+		assert.ErrorIs(t, unreachable.Master().Get("test_errors").Error, ErrDial)
+
+		registry := NewDataStoreRegistry()
+		registry.Register(unreachable)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.ErrorIs(t, registry.Ping(ctx)[unreachable.Name()], ErrDial)
+	})
+}
@@ -0,0 +1,622 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+var (
+	// DefaultKafkaDriver names the driver of profiles without one, empty uses the only registered driver
+	DefaultKafkaDriver = KafkaGoDriver
+	// DefaultKafkaProducerWorkers is the number of goroutines writing asynchronously sent messages
+	DefaultKafkaProducerWorkers = 4
+	// DefaultKafkaProducerQueueSize is the number of asynchronously sent messages buffered before SendAsync fails
+	DefaultKafkaProducerQueueSize = 1000
+	// DefaultKafkaProducerBatchSize is the maximum number of queued messages a worker writes at once
+	DefaultKafkaProducerBatchSize = 100
+	DefaultKafkaWriteTimeout      = 10 * time.Second
+	// DefaultKafkaShutdownTimeout bounds how long Close waits for the running handler of a consumer
+	DefaultKafkaShutdownTimeout = 30 * time.Second
+)
+
+func init() {
+	envStr("GOTH_DEFAULT_KAFKA_DRIVER", &DefaultKafkaDriver)
+	envInt("GOTH_DEFAULT_KAFKA_PRODUCER_WORKERS", &DefaultKafkaProducerWorkers)
+	envInt("GOTH_DEFAULT_KAFKA_PRODUCER_QUEUE_SIZE", &DefaultKafkaProducerQueueSize)
+	envInt("GOTH_DEFAULT_KAFKA_PRODUCER_BATCH_SIZE", &DefaultKafkaProducerBatchSize)
+	envMillis("GOTH_DEFAULT_KAFKA_WRITE_TIMEOUT", &DefaultKafkaWriteTimeout)
+	envMillis("GOTH_DEFAULT_KAFKA_SHUTDOWN_TIMEOUT", &DefaultKafkaShutdownTimeout)
+}
+
+var (
+	ErrKafkaDriverNotFound    = errors.New("kafka driver not found")
+	ErrKafkaProducerClosed    = errors.New("kafka producer closed")
+	ErrKafkaProducerQueueFull = errors.New("kafka producer queue full")
+	ErrKafkaConsumerClosed    = errors.New("kafka consumer closed")
+	ErrKafkaConsumerConsuming = errors.New("kafka consumer already consuming")
+)
+
+var (
+	kafkaDrivers     = map[string]KafkaDriver{}
+	kafkaDriversLock sync.RWMutex
+)
+
+// RegisterKafkaDriver makes a driver available to NewKafka under name, it panics if name is already registered.
+func RegisterKafkaDriver(name string, driver KafkaDriver) {
+	kafkaDriversLock.Lock()
+	defer kafkaDriversLock.Unlock()
+	if driver == nil {
+		panic("datastore: RegisterKafkaDriver driver is nil")
+	}
+
+	if _, dup := kafkaDrivers[name]; dup {
+		panic("datastore: RegisterKafkaDriver called twice for driver " + name)
+	}
+
+	kafkaDrivers[name] = driver
+}
+
+// KafkaDrivers returns the sorted names of the registered drivers.
+func KafkaDrivers() []string {
+	kafkaDriversLock.RLock()
+	defer kafkaDriversLock.RUnlock()
+	names := make([]string, 0, len(kafkaDrivers))
+	for name := range kafkaDrivers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// kafkaDriver returns the driver registered under name, DefaultKafkaDriver or the only one when name is empty.
+func kafkaDriver(name string) (KafkaDriver, error) {
+	if name == "" {
+		name = DefaultKafkaDriver
+	}
+
+	kafkaDriversLock.RLock()
+	defer kafkaDriversLock.RUnlock()
+	if name == "" && len(kafkaDrivers) == 1 {
+		for _, driver := range kafkaDrivers {
+			return driver, nil
+		}
+	}
+
+	if driver, ok := kafkaDrivers[name]; ok {
+		return driver, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrKafkaDriverNotFound, name)
+}
+
+// KafkaHeader is a message header.
+type KafkaHeader struct {
+	Key   string
+	Value []byte
+}
+
+// KafkaMessage is a message sent to or received from a topic.
+// Partition, Offset and Time are set by the driver on received messages.
+type KafkaMessage struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []KafkaHeader
+	Time      time.Time
+}
+
+// Header returns the value of the first header named key.
+func (m KafkaMessage) Header(key string) ([]byte, bool) {
+	for _, header := range m.Headers {
+		if header.Key == key {
+			return header.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// KafkaSendCallback receives the outcome of a message sent with SendAsync.
+type KafkaSendCallback func(msg KafkaMessage, err error)
+
+// KafkaHandlerFunc processes a consumed message, the message is committed when it returns nil.
+type KafkaHandlerFunc func(ctx context.Context, msg KafkaMessage) error
+
+// Kafka represents a Kafka cluster with a shared producer and consumer groups created on demand.
+type Kafka struct {
+	name        string
+	profile     secret.Kafka
+	producer    KafkaProducerOperator
+	newConsumer func(groupID string, topics []string) (KafkaConsumerOperator, error)
+
+	consumersLock sync.Mutex
+	consumers     []KafkaConsumerOperator
+}
+
+// Profile returns the loaded secret profile.
+func (k *Kafka) Profile() secret.Kafka {
+	return k.profile
+}
+
+// Producer returns the producer shared by the callers of this Kafka.
+func (k *Kafka) Producer() KafkaProducerOperator {
+	return k.producer
+}
+
+// Consumer creates a consumer reading topics as member of the consumer group groupID.
+// The consumer is closed with the Kafka unless closed before.
+func (k *Kafka) Consumer(groupID string, topics ...string) (KafkaConsumerOperator, error) {
+	if groupID == "" || len(topics) == 0 {
+		return nil, fmt.Errorf("kafka: consumer needs a group id and topics, got %q %v", groupID, topics)
+	}
+
+	consumer, err := k.newConsumer(groupID, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	k.consumersLock.Lock()
+	k.consumers = append(k.consumers, consumer)
+	k.consumersLock.Unlock()
+	return consumer, nil
+}
+
+// Name returns "kafka/<profile>".
+func (k *Kafka) Name() string {
+	return "kafka/" + k.name
+}
+
+// Ping fails once the producer is closed, it does not reach the brokers unless the KafkaWriter of the
+// driver implements Ping(ctx context.Context) error.
+func (k *Kafka) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if k.producer == nil {
+		return ErrKafkaProducerClosed
+	}
+
+	if producer, ok := k.producer.(interface{ IsClosed() bool }); ok && producer.IsClosed() {
+		return ErrKafkaProducerClosed
+	}
+
+	if producer, ok := k.producer.(*KafkaProducer); ok {
+		if pinger, ok := producer.writer.(kafkaPinger); ok {
+			return pinger.Ping(ctx)
+		}
+	}
+
+	return nil
+}
+
+// kafkaPinger is implemented by KafkaWriters able to check the brokers are reachable.
+type kafkaPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Stats returns the producer counters and the counters of the open consumers summed up.
+func (k *Kafka) Stats() DataStoreStats {
+	stats := DataStoreStats{}
+	if k.producer != nil {
+		producerStats := k.producer.Stats()
+		stats["producer.sent"] = float64(producerStats.Sent)
+		stats["producer.failed"] = float64(producerStats.Failed)
+		stats["producer.pending"] = float64(producerStats.Pending)
+	}
+
+	k.consumersLock.Lock()
+	consumers := append([]KafkaConsumerOperator(nil), k.consumers...)
+	k.consumersLock.Unlock()
+	var consumed, failed int64
+	for _, consumer := range consumers {
+		consumerStats := consumer.Stats()
+		consumed += consumerStats.Consumed
+		failed += consumerStats.Failed
+	}
+
+	stats["consumers"] = float64(len(consumers))
+	stats["consumer.consumed"] = float64(consumed)
+	stats["consumer.failed"] = float64(failed)
+	return stats
+}
+
+// Close stops the consumers, waiting for their running handlers, then flushes and closes the producer.
+func (k *Kafka) Close() error {
+	k.consumersLock.Lock()
+	consumers := k.consumers
+	k.consumers = nil
+	k.consumersLock.Unlock()
+
+	var errs []error
+	for _, consumer := range consumers {
+		errs = append(errs, consumer.Close())
+	}
+
+	if k.producer != nil {
+		errs = append(errs, k.producer.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// KafkaProducerStats are the counters of a producer.
+type KafkaProducerStats struct {
+	Sent    int64
+	Failed  int64
+	Pending int64
+}
+
+type kafkaAsyncMessage struct {
+	msg      KafkaMessage
+	callback KafkaSendCallback
+}
+
+// KafkaProducer sends messages with a KafkaWriter, synchronously with Send or through a pool of
+// DefaultKafkaProducerWorkers goroutines with SendAsync.
+type KafkaProducer struct {
+	meta   secret.KafkaMeta
+	writer KafkaWriter
+	queue  chan kafkaAsyncMessage
+
+	closeLock sync.RWMutex
+	closed    bool
+	workers   sync.WaitGroup
+
+	pendingLock sync.Mutex
+	pending     int64
+	flushed     []chan struct{}
+
+	sent   atomic.Int64
+	failed atomic.Int64
+}
+
+// NewKafkaProducer starts a producer writing with writer.
+func NewKafkaProducer(meta secret.KafkaMeta, writer KafkaWriter) *KafkaProducer {
+	workers := max(DefaultKafkaProducerWorkers, 1)
+	p := &KafkaProducer{
+		meta:   meta,
+		writer: writer,
+		queue:  make(chan kafkaAsyncMessage, max(DefaultKafkaProducerQueueSize, 1)),
+	}
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// Meta returns the connection metadata of the producer.
+func (p *KafkaProducer) Meta() secret.KafkaMeta {
+	return p.meta
+}
+
+// Send writes msgs and waits for the acknowledgement configured by the profile.
+func (p *KafkaProducer) Send(ctx context.Context, msgs ...KafkaMessage) error {
+	p.closeLock.RLock()
+	closed := p.closed
+	p.closeLock.RUnlock()
+	if closed {
+		return ErrKafkaProducerClosed
+	}
+
+	err := p.writer.WriteMessages(ctx, msgs...)
+	p.record(len(msgs), err)
+	return err
+}
+
+// SendAsync queues msg and returns immediately, callback is called with the outcome from a worker goroutine.
+// It fails with ErrKafkaProducerQueueFull when DefaultKafkaProducerQueueSize messages are waiting.
+func (p *KafkaProducer) SendAsync(msg KafkaMessage, callback KafkaSendCallback) error {
+	p.closeLock.RLock()
+	defer p.closeLock.RUnlock()
+	if p.closed {
+		return ErrKafkaProducerClosed
+	}
+
+	p.addPending(1)
+	select {
+	case p.queue <- kafkaAsyncMessage{msg: msg, callback: callback}:
+		return nil
+	default:
+		p.addPending(-1)
+		return ErrKafkaProducerQueueFull
+	}
+}
+
+// Flush waits until the messages queued by SendAsync are written.
+func (p *KafkaProducer) Flush(ctx context.Context) error {
+	p.pendingLock.Lock()
+	if p.pending == 0 {
+		p.pendingLock.Unlock()
+		return nil
+	}
+
+	flushed := make(chan struct{})
+	p.flushed = append(p.flushed, flushed)
+	p.pendingLock.Unlock()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the sent, failed and queued message counters.
+func (p *KafkaProducer) Stats() KafkaProducerStats {
+	p.pendingLock.Lock()
+	pending := p.pending
+	p.pendingLock.Unlock()
+	return KafkaProducerStats{Sent: p.sent.Load(), Failed: p.failed.Load(), Pending: pending}
+}
+
+// IsClosed returns whether Close was called.
+func (p *KafkaProducer) IsClosed() bool {
+	p.closeLock.RLock()
+	defer p.closeLock.RUnlock()
+	return p.closed
+}
+
+// Close stops accepting messages, writes the queued ones and closes the writer.
+func (p *KafkaProducer) Close() error {
+	p.closeLock.Lock()
+	if p.closed {
+		p.closeLock.Unlock()
+		return nil
+	}
+
+	p.closed = true
+	close(p.queue)
+	p.closeLock.Unlock()
+	p.workers.Wait()
+	return p.writer.Close()
+}
+
+func (p *KafkaProducer) work() {
+	defer p.workers.Done()
+	batch := make([]kafkaAsyncMessage, 0, max(DefaultKafkaProducerBatchSize, 1))
+	for first := range p.queue {
+		batch = append(batch[:0], first)
+	fill:
+		for len(batch) < cap(batch) {
+			select {
+			case next, ok := <-p.queue:
+				if !ok {
+					break fill
+				}
+
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+
+		msgs := make([]KafkaMessage, len(batch))
+		for idx, async := range batch {
+			msgs[idx] = async.msg
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultKafkaWriteTimeout)
+		err := p.writer.WriteMessages(ctx, msgs...)
+		cancel()
+		p.record(len(msgs), err)
+		for _, async := range batch {
+			if async.callback != nil {
+				async.callback(async.msg, err)
+			} else if err != nil {
+				kklogger.ErrorJ("datastore:KafkaProducer.SendAsync", fmt.Sprintf("topic %s: %s", async.msg.Topic, err.Error()))
+			}
+		}
+
+		p.addPending(-int64(len(batch)))
+	}
+}
+
+func (p *KafkaProducer) record(count int, err error) {
+	if err != nil {
+		p.failed.Add(int64(count))
+	} else {
+		p.sent.Add(int64(count))
+	}
+}
+
+func (p *KafkaProducer) addPending(delta int64) {
+	p.pendingLock.Lock()
+	defer p.pendingLock.Unlock()
+	p.pending += delta
+	if p.pending == 0 {
+		for _, flushed := range p.flushed {
+			close(flushed)
+		}
+
+		p.flushed = nil
+	}
+}
+
+// KafkaConsumerStats are the counters of a consumer.
+type KafkaConsumerStats struct {
+	Consumed int64
+	Failed   int64
+}
+
+// KafkaConsumer reads the messages of a consumer group with a KafkaReader and passes them to a handler.
+type KafkaConsumer struct {
+	meta    secret.KafkaMeta
+	groupID string
+	topics  []string
+	reader  KafkaReader
+
+	lock    sync.Mutex
+	closed  bool
+	cancel  context.CancelFunc
+	running chan struct{}
+
+	consumed atomic.Int64
+	failed   atomic.Int64
+}
+
+// NewKafkaConsumer creates a consumer of groupID reading topics with reader.
+func NewKafkaConsumer(meta secret.KafkaMeta, groupID string, topics []string, reader KafkaReader) *KafkaConsumer {
+	return &KafkaConsumer{meta: meta, groupID: groupID, topics: topics, reader: reader}
+}
+
+// Meta returns the connection metadata of the consumer.
+func (c *KafkaConsumer) Meta() secret.KafkaMeta {
+	return c.meta
+}
+
+// GroupID returns the consumer group.
+func (c *KafkaConsumer) GroupID() string {
+	return c.groupID
+}
+
+// Topics returns the consumed topics.
+func (c *KafkaConsumer) Topics() []string {
+	return c.topics
+}
+
+// Consume passes each message to handler and commits it once handler returns nil, until ctx is done or the
+// consumer is closed. A handler error stops consuming without committing, so the message is delivered again
+// to the group, and is returned. The handler context is not canceled by Close, which waits for it to return.
+// Consume returns nil after Close and the ctx error when ctx is done.
+func (c *KafkaConsumer) Consume(ctx context.Context, handler KafkaHandlerFunc) error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return ErrKafkaConsumerClosed
+	}
+
+	if c.running != nil {
+		c.lock.Unlock()
+		return ErrKafkaConsumerConsuming
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	running := make(chan struct{})
+	c.cancel, c.running = cancel, running
+	c.lock.Unlock()
+	defer func() {
+		cancel()
+		c.lock.Lock()
+		c.cancel, c.running = nil, nil
+		c.lock.Unlock()
+		close(running)
+	}()
+
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return c.stopErr(ctx)
+			}
+
+			return err
+		}
+
+		handlerCtx := context.WithoutCancel(ctx)
+		if err := handler(handlerCtx, msg); err != nil {
+			c.failed.Add(1)
+			kklogger.ErrorJ("datastore:KafkaConsumer.Consume", fmt.Sprintf("group %s topic %s partition %d offset %d: %s", c.groupID, msg.Topic, msg.Partition, msg.Offset, err.Error()))
+			return err
+		}
+
+		c.consumed.Add(1)
+		if err := c.reader.CommitMessages(handlerCtx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *KafkaConsumer) stopErr(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil
+	}
+
+	return ctx.Err()
+}
+
+// Stats returns the handled and failed message counters.
+func (c *KafkaConsumer) Stats() KafkaConsumerStats {
+	return KafkaConsumerStats{Consumed: c.consumed.Load(), Failed: c.failed.Load()}
+}
+
+// Close stops Consume, waits up to DefaultKafkaShutdownTimeout for the running handler and closes the reader.
+func (c *KafkaConsumer) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	cancel, running := c.cancel, c.running
+	c.lock.Unlock()
+	if cancel != nil {
+		cancel()
+		timer := time.NewTimer(DefaultKafkaShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-running:
+		case <-timer.C:
+			kklogger.WarnJ("datastore:KafkaConsumer.Close", fmt.Sprintf("group %s: handler still running after %s", c.groupID, DefaultKafkaShutdownTimeout))
+		}
+	}
+
+	return c.reader.Close()
+}
+
+// NewKafka creates a Kafka handler with the specified profile, connecting with the driver it names,
+// KafkaGoDriver by default. It fails if the profile name is empty, loading the profile fails or the driver is
+// not registered, with ErrKafkaDriverNotFound.
+func NewKafka(profileName string) (*Kafka, error) {
+	if profileName == "" {
+		return nil, errors.New("kafka: profile name is empty")
+	}
+
+	profile := &secret.Kafka{}
+	if err := secret.Load("kafka", profileName, profile); err != nil {
+		return nil, err
+	}
+
+	profile.Normalize()
+	driver, err := kafkaDriver(profile.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := driver.NewWriter(profile.Producer)
+	if err != nil {
+		return nil, err
+	}
+
+	consumerMeta := profile.Consumer
+	return &Kafka{
+		name:     profileName,
+		profile:  *profile,
+		producer: NewKafkaProducer(profile.Producer, writer),
+		newConsumer: func(groupID string, topics []string) (KafkaConsumerOperator, error) {
+			reader, err := driver.NewReader(consumerMeta, groupID, topics)
+			if err != nil {
+				return nil, err
+			}
+
+			return NewKafkaConsumer(consumerMeta, groupID, topics, reader), nil
+		},
+	}, nil
+}
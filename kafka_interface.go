@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"context"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// KafkaWriter is the producer connection a KafkaDriver provides, safe for concurrent use.
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...KafkaMessage) error
+	Close() error
+}
+
+// KafkaReader is the consumer group connection a KafkaDriver provides.
+// FetchMessage blocks until a message is available and does not commit it.
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (KafkaMessage, error)
+	CommitMessages(ctx context.Context, msgs ...KafkaMessage) error
+	Close() error
+}
+
+// KafkaDriver connects to Kafka with a client library, registered with RegisterKafkaDriver.
+type KafkaDriver interface {
+	NewWriter(meta secret.KafkaMeta) (KafkaWriter, error)
+	NewReader(meta secret.KafkaMeta, groupID string, topics []string) (KafkaReader, error)
+}
+
+// KafkaProducerOperator defines the interface for producing Kafka messages.
+// This interface allows for both real and mock implementations.
+type KafkaProducerOperator interface {
+	Send(ctx context.Context, msgs ...KafkaMessage) error
+	SendAsync(msg KafkaMessage, callback KafkaSendCallback) error
+	Flush(ctx context.Context) error
+	Stats() KafkaProducerStats
+	Close() error
+}
+
+// KafkaConsumerOperator defines the interface for consuming Kafka messages in a consumer group.
+// This interface allows for both real and mock implementations.
+type KafkaConsumerOperator interface {
+	Consume(ctx context.Context, handler KafkaHandlerFunc) error
+	GroupID() string
+	Topics() []string
+	Stats() KafkaConsumerStats
+	Close() error
+}
+
+// KafkaProvider defines the interface for Kafka instances.
+// This allows both real and mock Kafka implementations.
+type KafkaProvider interface {
+	Producer() KafkaProducerOperator
+	Consumer(groupID string, topics ...string) (KafkaConsumerOperator, error)
+	Profile() secret.Kafka
+}
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ KafkaProducerOperator = (*KafkaProducer)(nil)
+	_ KafkaProducerOperator = (*MockKafkaProducer)(nil)
+	_ KafkaConsumerOperator = (*KafkaConsumer)(nil)
+	_ KafkaConsumerOperator = (*MockKafkaConsumer)(nil)
+	_ KafkaProvider         = (*Kafka)(nil)
+)
@@ -0,0 +1,332 @@
+package datastore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/gzip"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/segmentio/kafka-go/snappy"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// KafkaGoDriver is the name of the built-in driver using github.com/segmentio/kafka-go. It supports gzip and
+// snappy compression, acks all and one, and reads topics without lz4 or zstd compressed messages.
+const KafkaGoDriver = "kafka-go"
+
+var (
+	// DefaultKafkaBatchTimeout is how long the kafka-go driver waits to fill a batch, for profiles without
+	// batch_timeout. Send waits for it, so it is kept short
+	DefaultKafkaBatchTimeout = 10 * time.Millisecond
+	// DefaultKafkaDialTimeout bounds the connection to a broker of the kafka-go driver
+	DefaultKafkaDialTimeout = 10 * time.Second
+)
+
+func init() {
+	envMillis("GOTH_DEFAULT_KAFKA_BATCH_TIMEOUT", &DefaultKafkaBatchTimeout)
+	envMillis("GOTH_DEFAULT_KAFKA_DIAL_TIMEOUT", &DefaultKafkaDialTimeout)
+	RegisterKafkaDriver(KafkaGoDriver, kafkaGoDriver{})
+}
+
+type kafkaGoDriver struct{}
+
+func (kafkaGoDriver) NewWriter(meta secret.KafkaMeta) (KafkaWriter, error) {
+	if len(meta.Brokers) == 0 {
+		return nil, errors.New("kafka-go: no brokers")
+	}
+
+	dialer, err := kafkaGoDialer(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	config := kafka.WriterConfig{
+		Brokers:      meta.Brokers,
+		Dialer:       dialer,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    meta.BatchSize,
+		BatchTimeout: time.Duration(meta.BatchTimeout) * time.Millisecond,
+	}
+
+	if config.BatchTimeout == 0 {
+		config.BatchTimeout = DefaultKafkaBatchTimeout
+	}
+
+	switch strings.ToLower(meta.Acks) {
+	case "", "all":
+		config.RequiredAcks = -1
+	case "one":
+		config.RequiredAcks = 1
+	default:
+		return nil, fmt.Errorf("kafka-go: acks %q not supported", meta.Acks)
+	}
+
+	switch strings.ToLower(meta.Compression) {
+	case "":
+	case "gzip":
+		config.CompressionCodec = gzip.NewCompressionCodec()
+	case "snappy":
+		config.CompressionCodec = snappy.NewCompressionCodec()
+	default:
+		return nil, fmt.Errorf("kafka-go: compression %q not supported", meta.Compression)
+	}
+
+	return &kafkaGoWriter{config: config, writers: map[string]*kafka.Writer{}}, nil
+}
+
+func (kafkaGoDriver) NewReader(meta secret.KafkaMeta, groupID string, topics []string) (KafkaReader, error) {
+	if len(meta.Brokers) == 0 {
+		return nil, errors.New("kafka-go: no brokers")
+	}
+
+	dialer, err := kafkaGoDialer(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	startOffset := kafka.FirstOffset
+	switch strings.ToLower(meta.StartOffset) {
+	case "", "earliest":
+	case "latest":
+		startOffset = kafka.LastOffset
+	default:
+		return nil, fmt.Errorf("kafka-go: start offset %q not supported", meta.StartOffset)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &kafkaGoReader{readers: map[string]*kafka.Reader{}, fetched: make(chan kafkaGoFetch), cancel: cancel}
+	for _, topic := range topics {
+		// kafka-go readers consume a single topic, their messages are merged
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     meta.Brokers,
+			GroupID:     groupID,
+			Topic:       topic,
+			Dialer:      dialer,
+			StartOffset: startOffset,
+		})
+
+		r.readers[topic] = reader
+		r.fetching.Add(1)
+		go r.fetch(ctx, reader)
+	}
+
+	return r, nil
+}
+
+func kafkaGoDialer(meta secret.KafkaMeta) (*kafka.Dialer, error) {
+	dialer := &kafka.Dialer{ClientID: meta.ClientID, Timeout: DefaultKafkaDialTimeout, DualStack: true}
+	if meta.TLS || meta.CAFile != "" {
+		dialer.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		if meta.CAFile != "" {
+			ca, err := readTLSPEM("", meta.CAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			dialer.TLS.RootCAs = x509.NewCertPool()
+			if !dialer.TLS.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("kafka-go: no certificate found in %s", meta.CAFile)
+			}
+		}
+	}
+
+	if meta.Username != "" {
+		var mechanism sasl.Mechanism
+		var err error
+		switch strings.ToUpper(meta.SASLMechanism) {
+		case "", "PLAIN":
+			mechanism = plain.Mechanism{Username: meta.Username, Password: meta.Password}
+		case "SCRAM-SHA-256":
+			mechanism, err = scram.Mechanism(scram.SHA256, meta.Username, meta.Password)
+		case "SCRAM-SHA-512":
+			mechanism, err = scram.Mechanism(scram.SHA512, meta.Username, meta.Password)
+		default:
+			err = fmt.Errorf("kafka-go: sasl mechanism %q not supported", meta.SASLMechanism)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		dialer.SASLMechanism = mechanism
+	}
+
+	return dialer, nil
+}
+
+// kafkaGoWriter writes with a kafka-go writer per topic, created on first use.
+type kafkaGoWriter struct {
+	config  kafka.WriterConfig
+	lock    sync.Mutex
+	closed  bool
+	writers map[string]*kafka.Writer
+}
+
+func (w *kafkaGoWriter) WriteMessages(ctx context.Context, msgs ...KafkaMessage) error {
+	var topics []string
+	byTopic := map[string][]kafka.Message{}
+	for _, msg := range msgs {
+		if _, ok := byTopic[msg.Topic]; !ok {
+			topics = append(topics, msg.Topic)
+		}
+
+		headers := make([]kafka.Header, len(msg.Headers))
+		for i, header := range msg.Headers {
+			headers[i] = kafka.Header{Key: header.Key, Value: header.Value}
+		}
+
+		byTopic[msg.Topic] = append(byTopic[msg.Topic], kafka.Message{Key: msg.Key, Value: msg.Value, Headers: headers, Time: msg.Time})
+	}
+
+	for _, topic := range topics {
+		writer, err := w.writer(topic)
+		if err != nil {
+			return err
+		}
+
+		if err := writer.WriteMessages(ctx, byTopic[topic]...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *kafkaGoWriter) writer(topic string) (*kafka.Writer, error) {
+	if topic == "" {
+		return nil, errors.New("kafka-go: message without topic")
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil, ErrKafkaProducerClosed
+	}
+
+	writer, ok := w.writers[topic]
+	if !ok {
+		config := w.config
+		config.Topic = topic
+		writer = kafka.NewWriter(config)
+		w.writers[topic] = writer
+	}
+
+	return writer, nil
+}
+
+// Ping connects to the first reachable broker.
+func (w *kafkaGoWriter) Ping(ctx context.Context) error {
+	var err error
+	for _, broker := range w.config.Brokers {
+		var conn *kafka.Conn
+		if conn, err = w.config.Dialer.DialContext(ctx, "tcp", broker); err == nil {
+			return conn.Close()
+		}
+	}
+
+	return err
+}
+
+func (w *kafkaGoWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.closed = true
+	var errs []error
+	for _, writer := range w.writers {
+		errs = append(errs, writer.Close())
+	}
+
+	w.writers = nil
+	return errors.Join(errs...)
+}
+
+type kafkaGoFetch struct {
+	msg kafka.Message
+	err error
+}
+
+// kafkaGoReader merges the messages of a kafka-go reader per topic.
+type kafkaGoReader struct {
+	readers  map[string]*kafka.Reader
+	fetched  chan kafkaGoFetch
+	cancel   context.CancelFunc
+	fetching sync.WaitGroup
+}
+
+func (r *kafkaGoReader) fetch(ctx context.Context, reader *kafka.Reader) {
+	defer r.fetching.Done()
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		select {
+		case r.fetched <- kafkaGoFetch{msg: msg, err: err}:
+		case <-ctx.Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (r *kafkaGoReader) FetchMessage(ctx context.Context) (KafkaMessage, error) {
+	select {
+	case fetched := <-r.fetched:
+		if fetched.err != nil {
+			return KafkaMessage{}, fetched.err
+		}
+
+		msg := fetched.msg
+		headers := make([]KafkaHeader, len(msg.Headers))
+		for i, header := range msg.Headers {
+			headers[i] = KafkaHeader{Key: header.Key, Value: header.Value}
+		}
+
+		return KafkaMessage{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Headers:   headers,
+			Time:      msg.Time,
+		}, nil
+	case <-ctx.Done():
+		return KafkaMessage{}, ctx.Err()
+	}
+}
+
+func (r *kafkaGoReader) CommitMessages(ctx context.Context, msgs ...KafkaMessage) error {
+	for _, msg := range msgs {
+		reader, ok := r.readers[msg.Topic]
+		if !ok {
+			return fmt.Errorf("kafka-go: topic %s not consumed", msg.Topic)
+		}
+
+		if err := reader.CommitMessages(ctx, kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *kafkaGoReader) Close() error {
+	r.cancel()
+	var errs []error
+	for _, reader := range r.readers {
+		errs = append(errs, reader.Close())
+	}
+
+	r.fetching.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,414 @@
+package datastore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// MockKafkaCall represents a recorded Kafka producer or consumer call.
+type MockKafkaCall struct {
+	Timestamp time.Time
+	Method    string
+	Messages  []KafkaMessage
+	Error     error
+}
+
+// MockKafkaProducer is a mock implementation of KafkaProducerOperator for testing.
+// Sent messages are captured with an offset per topic instead of being written to a broker.
+type MockKafkaProducer struct {
+	mutex sync.RWMutex
+
+	callHistory []MockKafkaCall
+	messages    []KafkaMessage
+	offsets     map[string]int64
+	sendError   error
+	closed      bool
+	chaos       *mockChaos
+}
+
+// NewMockKafkaProducer creates a new mock producer.
+func NewMockKafkaProducer() *MockKafkaProducer {
+	return &MockKafkaProducer{
+		callHistory: make([]MockKafkaCall, 0),
+		offsets:     map[string]int64{},
+	}
+}
+
+// Send captures msgs, or returns the error configured with SetSendError.
+func (m *MockKafkaProducer) Send(ctx context.Context, msgs ...KafkaMessage) error {
+	chaosErr := m.injectChaos()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	err := m.send(msgs, chaosErr)
+	m.callHistory = append(m.callHistory, MockKafkaCall{Timestamp: time.Now(), Method: "Send", Messages: msgs, Error: err})
+	return err
+}
+
+// SendAsync captures msg and calls callback before returning.
+func (m *MockKafkaProducer) SendAsync(msg KafkaMessage, callback KafkaSendCallback) error {
+	chaosErr := m.injectChaos()
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return ErrKafkaProducerClosed
+	}
+
+	err := m.send([]KafkaMessage{msg}, chaosErr)
+	m.callHistory = append(m.callHistory, MockKafkaCall{Timestamp: time.Now(), Method: "SendAsync", Messages: []KafkaMessage{msg}, Error: err})
+	m.mutex.Unlock()
+	if callback != nil {
+		callback(msg, err)
+	}
+
+	return nil
+}
+
+// send captures msgs unless an error is configured, the caller holds the mutex.
+func (m *MockKafkaProducer) send(msgs []KafkaMessage, chaosErr error) error {
+	switch {
+	case m.closed:
+		return ErrKafkaProducerClosed
+	case chaosErr != nil:
+		return chaosErr
+	case m.sendError != nil:
+		return m.sendError
+	}
+
+	for _, msg := range msgs {
+		msg.Offset = m.offsets[msg.Topic]
+		m.offsets[msg.Topic]++
+		if msg.Time.IsZero() {
+			msg.Time = time.Now()
+		}
+
+		m.messages = append(m.messages, msg)
+	}
+
+	return nil
+}
+
+// Flush returns immediately, SendAsync captures messages synchronously.
+func (m *MockKafkaProducer) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Stats returns the number of captured and failed messages.
+func (m *MockKafkaProducer) Stats() KafkaProducerStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	stats := KafkaProducerStats{Sent: int64(len(m.messages))}
+	for _, call := range m.callHistory {
+		if call.Error != nil {
+			stats.Failed += int64(len(call.Messages))
+		}
+	}
+
+	return stats
+}
+
+// Close marks the mock closed, later sends fail with ErrKafkaProducerClosed.
+func (m *MockKafkaProducer) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	m.callHistory = append(m.callHistory, MockKafkaCall{Timestamp: time.Now(), Method: "Close"})
+	return nil
+}
+
+// SetSendError configures Send and SendAsync to fail with err, nil captures messages again.
+func (m *MockKafkaProducer) SetSendError(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sendError = err
+}
+
+// Messages returns the captured messages in send order.
+func (m *MockKafkaProducer) Messages() []KafkaMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]KafkaMessage(nil), m.messages...)
+}
+
+// MessagesByTopic returns the captured messages of topic in send order.
+func (m *MockKafkaProducer) MessagesByTopic(topic string) []KafkaMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var filtered []KafkaMessage
+	for _, msg := range m.messages {
+		if msg.Topic == topic {
+			filtered = append(filtered, msg)
+		}
+	}
+
+	return filtered
+}
+
+// ClearMessages drops the captured messages and resets the offsets.
+func (m *MockKafkaProducer) ClearMessages() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = nil
+	m.offsets = map[string]int64{}
+}
+
+// IsClosed returns whether Close was called.
+func (m *MockKafkaProducer) IsClosed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.closed
+}
+
+// EnableChaos injects latency, random failures and outages into subsequent sends.
+func (m *MockKafkaProducer) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockKafkaProducer) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockKafkaProducer) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockKafkaProducer) GetCallHistory() []MockKafkaCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockKafkaCall(nil), m.callHistory...)
+}
+
+// ClearCallHistory clears all recorded method calls.
+func (m *MockKafkaProducer) ClearCallHistory() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.callHistory = make([]MockKafkaCall, 0)
+}
+
+// MockKafkaConsumer is a mock implementation of KafkaConsumerOperator for testing.
+// Messages added with Push are passed to the Consume handler in order and recorded as committed on success.
+type MockKafkaConsumer struct {
+	mutex sync.RWMutex
+
+	groupID     string
+	topics      []string
+	callHistory []MockKafkaCall
+	queue       []KafkaMessage
+	committed   []KafkaMessage
+	pushed      chan struct{}
+	stop        chan struct{}
+	consuming   bool
+	closed      bool
+	stats       KafkaConsumerStats
+	chaos       *mockChaos
+}
+
+// NewMockKafkaConsumer creates a new mock consumer of groupID reading topics.
+func NewMockKafkaConsumer(groupID string, topics ...string) *MockKafkaConsumer {
+	return &MockKafkaConsumer{
+		groupID:     groupID,
+		topics:      topics,
+		callHistory: make([]MockKafkaCall, 0),
+		pushed:      make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Push queues msgs for Consume.
+func (m *MockKafkaConsumer) Push(msgs ...KafkaMessage) {
+	m.mutex.Lock()
+	m.queue = append(m.queue, msgs...)
+	m.mutex.Unlock()
+	select {
+	case m.pushed <- struct{}{}:
+	default:
+	}
+}
+
+// Consume passes the pushed messages to handler until ctx is done or Close is called, waiting for more
+// when the queue is empty. Like KafkaConsumer, a handler error stops consuming, leaves the message queued
+// and is returned.
+func (m *MockKafkaConsumer) Consume(ctx context.Context, handler KafkaHandlerFunc) error {
+	m.mutex.Lock()
+	switch {
+	case m.closed:
+		m.mutex.Unlock()
+		return ErrKafkaConsumerClosed
+	case m.consuming:
+		m.mutex.Unlock()
+		return ErrKafkaConsumerConsuming
+	}
+
+	m.consuming = true
+	m.mutex.Unlock()
+	defer func() {
+		m.mutex.Lock()
+		m.consuming = false
+		m.mutex.Unlock()
+	}()
+
+	for {
+		msg, ok := m.next()
+		if !ok {
+			select {
+			case <-m.pushed:
+				continue
+			case <-m.stop:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err := m.injectChaos()
+		if err == nil {
+			err = handler(context.WithoutCancel(ctx), msg)
+		}
+
+		m.mutex.Lock()
+		m.callHistory = append(m.callHistory, MockKafkaCall{Timestamp: time.Now(), Method: "Consume", Messages: []KafkaMessage{msg}, Error: err})
+		if err != nil {
+			m.stats.Failed++
+			m.mutex.Unlock()
+			return err
+		}
+
+		m.stats.Consumed++
+		m.queue = m.queue[1:]
+		m.committed = append(m.committed, msg)
+		m.mutex.Unlock()
+	}
+}
+
+func (m *MockKafkaConsumer) next() (KafkaMessage, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if len(m.queue) == 0 {
+		return KafkaMessage{}, false
+	}
+
+	return m.queue[0], true
+}
+
+// GroupID returns the consumer group.
+func (m *MockKafkaConsumer) GroupID() string {
+	return m.groupID
+}
+
+// Topics returns the consumed topics.
+func (m *MockKafkaConsumer) Topics() []string {
+	return m.topics
+}
+
+// Stats returns the handled and failed message counters.
+func (m *MockKafkaConsumer) Stats() KafkaConsumerStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.stats
+}
+
+// Close stops Consume.
+func (m *MockKafkaConsumer) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.stop)
+	}
+
+	return nil
+}
+
+// Committed returns the messages handled successfully, in order.
+func (m *MockKafkaConsumer) Committed() []KafkaMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]KafkaMessage(nil), m.committed...)
+}
+
+// Pending returns the number of pushed messages not handled yet.
+func (m *MockKafkaConsumer) Pending() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.queue)
+}
+
+// IsClosed returns whether Close was called.
+func (m *MockKafkaConsumer) IsClosed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.closed
+}
+
+// EnableChaos injects latency, random failures and outages before the handler of subsequent messages.
+func (m *MockKafkaConsumer) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockKafkaConsumer) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockKafkaConsumer) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockKafkaConsumer) GetCallHistory() []MockKafkaCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockKafkaCall(nil), m.callHistory...)
+}
+
+// NewMockKafka creates a Kafka instance with a mock producer, Consumer returns a new mock consumer per call.
+func NewMockKafka() *Kafka {
+	return NewMockKafkaWithOps(NewMockKafkaProducer(), nil)
+}
+
+// NewMockKafkaWithOps creates a Kafka instance with custom mocks, Consumer returns consumer for every group
+// when it is not nil.
+func NewMockKafkaWithOps(producer *MockKafkaProducer, consumer *MockKafkaConsumer) *Kafka {
+	return &Kafka{
+		name:     "mock-kafka",
+		profile:  secret.Kafka{},
+		producer: producer,
+		newConsumer: func(groupID string, topics []string) (KafkaConsumerOperator, error) {
+			if consumer != nil {
+				return consumer, nil
+			}
+
+			return NewMockKafkaConsumer(groupID, topics...), nil
+		},
+	}
+}
@@ -0,0 +1,431 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// testKafkaWriter records written messages, failing with err when set.
+type testKafkaWriter struct {
+	mutex   sync.Mutex
+	batches [][]KafkaMessage
+	err     error
+	closed  bool
+}
+
+func (w *testKafkaWriter) WriteMessages(ctx context.Context, msgs ...KafkaMessage) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+
+	w.batches = append(w.batches, msgs)
+	return nil
+}
+
+func (w *testKafkaWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.closed = true
+	return nil
+}
+
+func (w *testKafkaWriter) count() (count int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, batch := range w.batches {
+		count += len(batch)
+	}
+
+	return
+}
+
+// testKafkaReader serves messages from a channel and records commits.
+type testKafkaReader struct {
+	messages  chan KafkaMessage
+	mutex     sync.Mutex
+	committed []KafkaMessage
+	closed    bool
+}
+
+func (r *testKafkaReader) FetchMessage(ctx context.Context) (KafkaMessage, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return KafkaMessage{}, ctx.Err()
+	}
+}
+
+func (r *testKafkaReader) CommitMessages(ctx context.Context, msgs ...KafkaMessage) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *testKafkaReader) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+	return nil
+}
+
+type testKafkaDriver struct {
+	writer *testKafkaWriter
+	meta   secret.KafkaMeta
+}
+
+func (d *testKafkaDriver) NewWriter(meta secret.KafkaMeta) (KafkaWriter, error) {
+	return d.writer, nil
+}
+
+func (d *testKafkaDriver) NewReader(meta secret.KafkaMeta, groupID string, topics []string) (KafkaReader, error) {
+	d.meta = meta
+	return &testKafkaReader{messages: make(chan KafkaMessage)}, nil
+}
+
+func TestKafkaProducer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Send and SendAsync", func(t *testing.T) {
+		writer := &testKafkaWriter{}
+		producer := NewKafkaProducer(secret.KafkaMeta{}, writer)
+		assert.NoError(t, producer.Send(ctx, KafkaMessage{Topic: "events", Value: []byte("a")}, KafkaMessage{Topic: "events", Value: []byte("b")}))
+
+		var mutex sync.Mutex
+		var acked []string
+		for _, value := range []string{"c", "d", "e"} {
+			assert.NoError(t, producer.SendAsync(KafkaMessage{Topic: "events", Value: []byte(value)}, func(msg KafkaMessage, err error) {
+				assert.NoError(t, err)
+				mutex.Lock()
+				acked = append(acked, string(msg.Value))
+				mutex.Unlock()
+			}))
+		}
+
+		assert.NoError(t, producer.Flush(ctx))
+		assert.ElementsMatch(t, []string{"c", "d", "e"}, acked)
+		assert.Equal(t, 5, writer.count())
+		assert.Equal(t, KafkaProducerStats{Sent: 5}, producer.Stats())
+
+		writer.err = errors.New("broker down")
+		assert.Error(t, producer.Send(ctx, KafkaMessage{Topic: "events"}))
+		failed := make(chan error, 1)
+		assert.NoError(t, producer.SendAsync(KafkaMessage{Topic: "events"}, func(msg KafkaMessage, err error) {
+			failed <- err
+		}))
+		assert.Error(t, <-failed)
+		assert.NoError(t, producer.Flush(ctx))
+		assert.Equal(t, int64(2), producer.Stats().Failed)
+
+		assert.NoError(t, producer.Close())
+		assert.True(t, writer.closed)
+		assert.ErrorIs(t, producer.Send(ctx, KafkaMessage{}), ErrKafkaProducerClosed)
+		assert.ErrorIs(t, producer.SendAsync(KafkaMessage{}, nil), ErrKafkaProducerClosed)
+	})
+
+	t.Run("Queue full", func(t *testing.T) {
+		originalWorkers, originalQueue := DefaultKafkaProducerWorkers, DefaultKafkaProducerQueueSize
+		defer func() {
+			DefaultKafkaProducerWorkers, DefaultKafkaProducerQueueSize = originalWorkers, originalQueue
+		}()
+
+		DefaultKafkaProducerWorkers, DefaultKafkaProducerQueueSize = 1, 1
+		writer := &testKafkaWriter{}
+		writer.mutex.Lock()
+		producer := NewKafkaProducer(secret.KafkaMeta{}, writer)
+		assert.NoError(t, producer.SendAsync(KafkaMessage{Topic: "events"}, nil))
+		assert.Eventually(t, func() bool {
+			return len(producer.queue) == 0
+		}, time.Second, time.Millisecond)
+		assert.NoError(t, producer.SendAsync(KafkaMessage{Topic: "events"}, nil))
+		assert.ErrorIs(t, producer.SendAsync(KafkaMessage{Topic: "events"}, nil), ErrKafkaProducerQueueFull)
+
+		flushCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, producer.Flush(flushCtx), context.DeadlineExceeded)
+		writer.mutex.Unlock()
+		assert.NoError(t, producer.Close())
+		assert.Equal(t, 2, writer.count())
+	})
+}
+
+func TestKafkaConsumer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Commits handled messages", func(t *testing.T) {
+		reader := &testKafkaReader{messages: make(chan KafkaMessage)}
+		consumer := NewKafkaConsumer(secret.KafkaMeta{}, "group", []string{"events"}, reader)
+		handled := make(chan KafkaMessage)
+		done := make(chan error)
+		go func() {
+			done <- consumer.Consume(ctx, func(ctx context.Context, msg KafkaMessage) error {
+				handled <- msg
+				return nil
+			})
+		}()
+
+		reader.messages <- KafkaMessage{Topic: "events", Offset: 1}
+		assert.Equal(t, int64(1), (<-handled).Offset)
+		assert.ErrorIs(t, consumer.Consume(ctx, nil), ErrKafkaConsumerConsuming)
+
+		assert.NoError(t, consumer.Close())
+		assert.NoError(t, <-done)
+		assert.Len(t, reader.committed, 1)
+		assert.True(t, reader.closed)
+		assert.Equal(t, KafkaConsumerStats{Consumed: 1}, consumer.Stats())
+		assert.ErrorIs(t, consumer.Consume(ctx, nil), ErrKafkaConsumerClosed)
+	})
+
+	t.Run("Handler error stops without commit", func(t *testing.T) {
+		reader := &testKafkaReader{messages: make(chan KafkaMessage, 1)}
+		consumer := NewKafkaConsumer(secret.KafkaMeta{}, "group", []string{"events"}, reader)
+		reader.messages <- KafkaMessage{Topic: "events"}
+		handlerErr := errors.New("bad message")
+		assert.ErrorIs(t, consumer.Consume(ctx, func(ctx context.Context, msg KafkaMessage) error {
+			return handlerErr
+		}), handlerErr)
+		assert.Empty(t, reader.committed)
+		assert.Equal(t, int64(1), consumer.Stats().Failed)
+	})
+
+	t.Run("Close waits for the running handler", func(t *testing.T) {
+		reader := &testKafkaReader{messages: make(chan KafkaMessage, 1)}
+		consumer := NewKafkaConsumer(secret.KafkaMeta{}, "group", []string{"events"}, reader)
+		reader.messages <- KafkaMessage{Topic: "events"}
+		started := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- consumer.Consume(ctx, func(ctx context.Context, msg KafkaMessage) error {
+				close(started)
+				time.Sleep(50 * time.Millisecond)
+				return ctx.Err()
+			})
+		}()
+
+		<-started
+		assert.NoError(t, consumer.Close())
+		assert.Len(t, reader.committed, 1)
+		assert.NoError(t, <-done)
+	})
+
+	t.Run("Context cancel returns its error", func(t *testing.T) {
+		consumer := NewKafkaConsumer(secret.KafkaMeta{}, "group", []string{"events"}, &testKafkaReader{messages: make(chan KafkaMessage)})
+		cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, consumer.Consume(cancelCtx, nil), context.DeadlineExceeded)
+	})
+}
+
+func TestNewKafka(t *testing.T) {
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+	_, err := NewKafka("")
+	assert.Error(t, err)
+	_, err = NewKafka("missing")
+	assert.Error(t, err)
+
+	originalDriver := DefaultKafkaDriver
+	defer func() {
+		DefaultKafkaDriver = originalDriver
+	}()
+
+	DefaultKafkaDriver = "unregistered"
+	kafka, err := NewKafka("test")
+	assert.ErrorIs(t, err, ErrKafkaDriverNotFound)
+	assert.Nil(t, kafka)
+
+	driver := &testKafkaDriver{writer: &testKafkaWriter{}}
+	RegisterKafkaDriver("test", driver)
+	assert.Contains(t, KafkaDrivers(), "test")
+	assert.Panics(t, func() {
+		RegisterKafkaDriver("test", driver)
+	})
+
+	DefaultKafkaDriver = "test"
+	kafka, err = NewKafka("test")
+	assert.NoError(t, err)
+	if assert.NotNil(t, kafka) {
+		assert.Equal(t, []string{"127.0.0.1:9092"}, kafka.Profile().Producer.Brokers)
+		assert.NoError(t, kafka.Producer().Send(context.Background(), KafkaMessage{Topic: "events"}))
+
+		_, err = kafka.Consumer("", "events")
+		assert.Error(t, err)
+		consumer, err := kafka.Consumer("group", "events")
+		assert.NoError(t, err)
+		assert.Equal(t, "group", consumer.GroupID())
+		assert.Equal(t, []string{"127.0.0.1:9092"}, driver.meta.Brokers)
+		assert.Equal(t, "earliest", driver.meta.StartOffset)
+
+		assert.NoError(t, kafka.Close())
+		assert.True(t, driver.writer.closed)
+	}
+}
+
+func TestKafkaGoDriver(t *testing.T) {
+	assert.Contains(t, KafkaDrivers(), KafkaGoDriver)
+	driver, err := kafkaDriver(KafkaGoDriver)
+	assert.NoError(t, err)
+
+	t.Run("Config", func(t *testing.T) {
+		meta := secret.KafkaMeta{
+			Brokers:       []string{"127.0.0.1:9092"},
+			ClientID:      "client",
+			Username:      "user",
+			Password:      "secret",
+			SASLMechanism: "SCRAM-SHA-512",
+			TLS:           true,
+			Acks:          "one",
+			Compression:   "gzip",
+			BatchSize:     10,
+		}
+
+		writer, err := driver.NewWriter(meta)
+		assert.NoError(t, err)
+		config := writer.(*kafkaGoWriter).config
+		assert.Equal(t, 1, config.RequiredAcks)
+		assert.Equal(t, 10, config.BatchSize)
+		assert.Equal(t, DefaultKafkaBatchTimeout, config.BatchTimeout)
+		assert.NotNil(t, config.CompressionCodec)
+		assert.Equal(t, "client", config.Dialer.ClientID)
+		assert.NotNil(t, config.Dialer.TLS)
+		assert.Equal(t, "SCRAM-SHA-512", config.Dialer.SASLMechanism.Name())
+		assert.Error(t, writer.WriteMessages(context.Background(), KafkaMessage{}))
+		assert.NoError(t, writer.Close())
+		assert.ErrorIs(t, writer.WriteMessages(context.Background(), KafkaMessage{Topic: "events"}), ErrKafkaProducerClosed)
+
+		for _, invalid := range []secret.KafkaMeta{
+			{},
+			{Brokers: meta.Brokers, Acks: "none"},
+			{Brokers: meta.Brokers, Compression: "lz4"},
+			{Brokers: meta.Brokers, Username: "user", SASLMechanism: "GSSAPI"},
+			{Brokers: meta.Brokers, CAFile: "missing.pem"},
+		} {
+			_, err := driver.NewWriter(invalid)
+			assert.Error(t, err)
+		}
+
+		_, err = driver.NewReader(secret.KafkaMeta{Brokers: meta.Brokers, StartOffset: "middle"}, "group", []string{"events"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		kafka, err := NewKafka("test")
+		assert.NoError(t, err)
+		defer kafka.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := kafka.Ping(ctx); err != nil {
+			t.Skipf("kafka not available: %v", err)
+		}
+
+		topic := "test_kafka_go"
+		msg := KafkaMessage{Topic: topic, Key: []byte("key"), Value: []byte(time.Now().String()), Headers: []KafkaHeader{{Key: "h", Value: []byte("v")}}}
+		assert.NoError(t, kafka.Producer().Send(ctx, msg))
+		consumer, err := kafka.Consumer("test_kafka_go", topic)
+		assert.NoError(t, err)
+		var got KafkaMessage
+		err = consumer.Consume(ctx, func(ctx context.Context, received KafkaMessage) error {
+			if string(received.Value) == string(msg.Value) {
+				got = received
+				cancel()
+			}
+
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, msg.Key, got.Key)
+		assert.Equal(t, msg.Headers, got.Headers)
+	})
+}
+
+func TestMockKafka(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Producer captures messages", func(t *testing.T) {
+		producer := NewMockKafkaProducer()
+		assert.NoError(t, producer.Send(ctx, KafkaMessage{Topic: "a", Value: []byte("1")}, KafkaMessage{Topic: "b"}))
+		var acked KafkaMessage
+		assert.NoError(t, producer.SendAsync(KafkaMessage{Topic: "a", Value: []byte("2")}, func(msg KafkaMessage, err error) {
+			acked = msg
+		}))
+		assert.Equal(t, "2", string(acked.Value))
+
+		messages := producer.MessagesByTopic("a")
+		assert.Len(t, messages, 2)
+		assert.Equal(t, int64(1), messages[1].Offset)
+		assert.Len(t, producer.Messages(), 3)
+
+		producer.SetSendError(errors.New("down"))
+		assert.Error(t, producer.Send(ctx, KafkaMessage{Topic: "a"}))
+		assert.Equal(t, KafkaProducerStats{Sent: 3, Failed: 1}, producer.Stats())
+		assert.Len(t, producer.GetCallHistory(), 3)
+
+		producer.SetSendError(nil)
+		producer.EnableChaos(MockChaosConfig{ErrorRate: 1})
+		assert.ErrorIs(t, producer.Send(ctx, KafkaMessage{Topic: "a"}), ErrMockChaos)
+		producer.DisableChaos()
+
+		producer.ClearMessages()
+		assert.Empty(t, producer.Messages())
+		assert.NoError(t, producer.Close())
+		assert.ErrorIs(t, producer.Send(ctx, KafkaMessage{Topic: "a"}), ErrKafkaProducerClosed)
+	})
+
+	t.Run("Consumer delivers pushed messages", func(t *testing.T) {
+		consumer := NewMockKafkaConsumer("group", "events")
+		mock := NewMockKafkaWithOps(NewMockKafkaProducer(), consumer)
+		got, err := mock.Consumer("group", "events")
+		assert.NoError(t, err)
+		assert.Same(t, consumer, got)
+
+		consumer.Push(KafkaMessage{Topic: "events", Value: []byte("1")}, KafkaMessage{Topic: "events", Value: []byte("2")})
+		done := make(chan error)
+		go func() {
+			done <- consumer.Consume(ctx, func(ctx context.Context, msg KafkaMessage) error {
+				return nil
+			})
+		}()
+
+		assert.Eventually(t, func() bool {
+			return len(consumer.Committed()) == 2
+		}, time.Second, time.Millisecond)
+		assert.NoError(t, mock.Close())
+		assert.NoError(t, <-done)
+		assert.True(t, consumer.IsClosed())
+
+		failing := NewMockKafkaConsumer("group", "events")
+		failing.Push(KafkaMessage{Topic: "events"})
+		assert.Error(t, failing.Consume(ctx, func(ctx context.Context, msg KafkaMessage) error {
+			return errors.New("bad message")
+		}))
+		assert.Equal(t, 1, failing.Pending())
+		assert.Equal(t, KafkaConsumerStats{Failed: 1}, failing.Stats())
+
+		other, err := NewMockKafka().Consumer("other", "events")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"events"}, other.Topics())
+	})
+}
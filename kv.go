@@ -0,0 +1,542 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+var (
+	DefaultKVTimeout = 10 * time.Second
+	// DefaultKVWatchWait is how long a watch query blocks waiting for a change before it is issued again
+	DefaultKVWatchWait = 5 * time.Minute
+	// DefaultKVWatchRetry is the delay before a failed watch query is retried
+	DefaultKVWatchRetry = time.Second
+	// DefaultKVSessionTTL is the TTL of leader election sessions, Consul accepts 10s to 24h
+	DefaultKVSessionTTL = 15 * time.Second
+	// DefaultKVElectionRetry is the longest a candidate waits between attempts to acquire leadership
+	DefaultKVElectionRetry = 5 * time.Second
+)
+
+func init() {
+	envMillis("GOTH_DEFAULT_KV_TIMEOUT", &DefaultKVTimeout)
+	envMillis("GOTH_DEFAULT_KV_WATCH_WAIT", &DefaultKVWatchWait)
+	envMillis("GOTH_DEFAULT_KV_WATCH_RETRY", &DefaultKVWatchRetry)
+	envMillis("GOTH_DEFAULT_KV_SESSION_TTL", &DefaultKVSessionTTL)
+	envMillis("GOTH_DEFAULT_KV_ELECTION_RETRY", &DefaultKVElectionRetry)
+}
+
+// Errors returned by kv operators, shared with the mock.
+var (
+	ErrKVNotFound        = errors.New("kv key not found")
+	ErrKVSessionNotFound = errors.New("kv session not found")
+	ErrKVClosed          = errors.New("kv closed")
+)
+
+// KVPair is a stored value with its revision, the revision changes on every write of the key.
+type KVPair struct {
+	Key      string
+	Value    []byte
+	Revision uint64
+	// Session is the id of the session holding the lock of the key, empty when it is not locked
+	Session string
+}
+
+// KVEventType is the kind of change reported by Watch.
+type KVEventType int
+
+const (
+	KVEventPut KVEventType = iota
+	KVEventDelete
+)
+
+func (t KVEventType) String() string {
+	switch t {
+	case KVEventPut:
+		return "PUT"
+	case KVEventDelete:
+		return "DELETE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// KVEvent is a change observed by Watch, Pair holds the last known value of a deleted key.
+type KVEvent struct {
+	Type KVEventType
+	Pair KVPair
+}
+
+// KV represents a key value store for configuration and coordination between services.
+type KV struct {
+	name    string
+	profile secret.KV
+	op      KVOperator
+}
+
+// Profile returns the loaded secret profile.
+func (k *KV) Profile() secret.KV {
+	return k.profile
+}
+
+// Operator returns the KVOperator of the store.
+func (k *KV) Operator() KVOperator {
+	return k.op
+}
+
+// NewLeaderElection returns a LeaderElection campaigning on key with value as the leader identity.
+func (k *KV) NewLeaderElection(key string, value []byte) *LeaderElection {
+	return NewLeaderElection(k.op, key, value)
+}
+
+// Name returns "kv/<profile>".
+func (k *KV) Name() string {
+	return "kv/" + k.name
+}
+
+// Ping checks the cluster is reachable and has a leader.
+func (k *KV) Ping(ctx context.Context) error {
+	return k.op.Ping(ctx)
+}
+
+// Stats returns no metrics, the HTTP client keeps no counters.
+func (k *KV) Stats() DataStoreStats {
+	return DataStoreStats{}
+}
+
+// Close stops the watches and closes the idle connections.
+func (k *KV) Close() error {
+	return k.op.Close()
+}
+
+// KVOp represents operations on a Consul KV store through its HTTP API.
+// Keys are relative to the Prefix of the profile, which is added on requests and removed from results.
+type KVOp struct {
+	profile   secret.KV
+	base      *url.URL
+	client    *http.Client
+	timeout   time.Duration
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// consulKVEntry is an entry of the /v1/kv responses, Value is base64 encoded by Consul.
+type consulKVEntry struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+	Session     string
+}
+
+// Client returns the underlying http client.
+func (o *KVOp) Client() *http.Client {
+	return o.client
+}
+
+// Ping checks the cluster is reachable and has a leader.
+func (o *KVOp) Ping(ctx context.Context) error {
+	data, _, _, err := o.call(ctx, http.MethodGet, "/v1/status/leader", nil, nil, 0)
+	if err == nil && strings.Trim(string(data), "\" \n") == "" {
+		err = errors.New("kv cluster has no leader")
+	}
+
+	return err
+}
+
+// Close stops the watches and closes the idle connections.
+func (o *KVOp) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.closed)
+		o.client.CloseIdleConnections()
+	})
+
+	return nil
+}
+
+// Get returns the pair of key, ErrKVNotFound if it does not exist.
+func (o *KVOp) Get(ctx context.Context, key string) (*KVPair, error) {
+	data, _, found, err := o.call(ctx, http.MethodGet, o.path(key), nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, err := o.decode(data, found)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKVNotFound, key)
+	}
+
+	return &pairs[0], nil
+}
+
+// List returns the pairs of the keys starting with prefix in key order.
+func (o *KVOp) List(ctx context.Context, prefix string) ([]KVPair, error) {
+	pairs, _, err := o.list(ctx, prefix, 0, 0)
+	return pairs, err
+}
+
+// Put stores value under key.
+func (o *KVOp) Put(ctx context.Context, key string, value []byte) error {
+	return o.write(ctx, key, value, nil)
+}
+
+// CompareAndSwap stores value under key only if its revision is still revision, false when it changed.
+// A revision of 0 only creates the key when it does not exist.
+func (o *KVOp) CompareAndSwap(ctx context.Context, key string, value []byte, revision uint64) (bool, error) {
+	return o.put(ctx, key, value, url.Values{"cas": {strconv.FormatUint(revision, 10)}})
+}
+
+// Delete removes key, deleting a missing key succeeds.
+func (o *KVOp) Delete(ctx context.Context, key string) error {
+	_, _, _, err := o.call(ctx, http.MethodDelete, o.path(key), nil, nil, 0)
+	return err
+}
+
+// DeletePrefix removes every key starting with prefix.
+func (o *KVOp) DeletePrefix(ctx context.Context, prefix string) error {
+	_, _, _, err := o.call(ctx, http.MethodDelete, o.path(prefix), url.Values{"recurse": {"true"}}, nil, 0)
+	return err
+}
+
+// Watch reports the changes of the keys starting with prefix made after it returns, until ctx is done
+// or the operator is closed, then the channel is closed.
+// Changes are found with blocking queries, several writes between two queries are seen as the last one.
+func (o *KVOp) Watch(ctx context.Context, prefix string) (<-chan KVEvent, error) {
+	pairs, index, err := o.list(ctx, prefix, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-o.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	events := make(chan KVEvent)
+	go func() {
+		defer close(events)
+		defer cancel()
+		last := pairs
+		for {
+			pairs, next, err := o.list(ctx, prefix, index, DefaultKVWatchWait)
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, ErrKVClosed) {
+					return
+				}
+
+				kklogger.WarnJ("datastore.KVOp#Watch", err.Error())
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(DefaultKVWatchRetry):
+				}
+
+				continue
+			}
+
+			// The index goes backwards when the cluster state is restored, start over from the current state
+			if next < index {
+				next = 0
+			}
+
+			index = next
+			for _, event := range kvDiff(last, pairs) {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			last = pairs
+		}
+	}()
+
+	return events, nil
+}
+
+// CreateSession creates a session which has to be renewed within ttl, its locks are released when it expires.
+func (o *KVOp) CreateSession(ctx context.Context, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = DefaultKVSessionTTL
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"Name":     "goth-datastore",
+		"TTL":      fmt.Sprintf("%ds", int64(ttl.Seconds())),
+		"Behavior": "release",
+	})
+	data, _, _, err := o.call(ctx, http.MethodPut, "/v1/session/create", nil, body, 0)
+	if err != nil {
+		return "", err
+	}
+
+	var session struct {
+		ID string
+	}
+
+	if err := json.Unmarshal(data, &session); err != nil {
+		return "", err
+	}
+
+	return session.ID, nil
+}
+
+// RenewSession resets the TTL of the session, ErrKVSessionNotFound if it expired or was destroyed.
+func (o *KVOp) RenewSession(ctx context.Context, id string) error {
+	data, _, found, err := o.call(ctx, http.MethodPut, "/v1/session/renew/"+id, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	if !found || strings.TrimSpace(string(data)) == "null" {
+		return fmt.Errorf("%w: %s", ErrKVSessionNotFound, id)
+	}
+
+	return nil
+}
+
+// DestroySession destroys the session and releases its locks.
+func (o *KVOp) DestroySession(ctx context.Context, id string) error {
+	_, _, _, err := o.call(ctx, http.MethodPut, "/v1/session/destroy/"+id, nil, nil, 0)
+	return err
+}
+
+// Acquire stores value under key and locks it with the session, false when another session holds the lock.
+func (o *KVOp) Acquire(ctx context.Context, key string, value []byte, session string) (bool, error) {
+	return o.put(ctx, key, value, url.Values{"acquire": {session}})
+}
+
+// Release unlocks key if the session holds its lock, the value is kept.
+func (o *KVOp) Release(ctx context.Context, key string, session string) (bool, error) {
+	pair, err := o.Get(ctx, key)
+	if errors.Is(err, ErrKVNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return o.put(ctx, key, pair.Value, url.Values{"release": {session}})
+}
+
+func (o *KVOp) write(ctx context.Context, key string, value []byte, query url.Values) error {
+	ok, err := o.put(ctx, key, value, query)
+	if err == nil && !ok {
+		err = fmt.Errorf("kv put %s was rejected", key)
+	}
+
+	return err
+}
+
+func (o *KVOp) put(ctx context.Context, key string, value []byte, query url.Values) (bool, error) {
+	data, _, _, err := o.call(ctx, http.MethodPut, o.path(key), query, value, 0)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(string(data)) == "true", nil
+}
+
+// list returns the pairs under prefix and the index of the response, blocking up to wait for a change
+// past index when wait is set.
+func (o *KVOp) list(ctx context.Context, prefix string, index uint64, wait time.Duration) ([]KVPair, uint64, error) {
+	query := url.Values{"recurse": {"true"}}
+	if wait > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int64(wait.Seconds())))
+	}
+
+	data, header, found, err := o.call(ctx, http.MethodGet, o.path(prefix), query, nil, wait)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pairs, err := o.decode(data, found)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	next, _ := strconv.ParseUint(header.Get("X-Consul-Index"), 10, 64)
+	return pairs, next, nil
+}
+
+func (o *KVOp) decode(data []byte, found bool) ([]KVPair, error) {
+	if !found {
+		return nil, nil
+	}
+
+	var entries []consulKVEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	pairs := make([]KVPair, len(entries))
+	for idx, entry := range entries {
+		pairs[idx] = KVPair{
+			Key:      strings.TrimPrefix(entry.Key, o.profile.Prefix),
+			Value:    entry.Value,
+			Revision: entry.ModifyIndex,
+			Session:  entry.Session,
+		}
+	}
+
+	return pairs, nil
+}
+
+func (o *KVOp) path(key string) string {
+	return "/v1/kv/" + o.profile.Prefix + key
+}
+
+// call sends the request and returns the response body, found is false on 404 which is not an error.
+// wait extends the request timeout of blocking queries.
+func (o *KVOp) call(ctx context.Context, method, path string, query url.Values, body []byte, wait time.Duration) (data []byte, header http.Header, found bool, err error) {
+	select {
+	case <-o.closed:
+		return nil, nil, false, ErrKVClosed
+	default:
+	}
+
+	if query == nil {
+		query = url.Values{}
+	}
+
+	if o.profile.Datacenter != "" {
+		query.Set("dc", o.profile.Datacenter)
+	}
+
+	endpoint := *o.base
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + path
+	endpoint.RawQuery = query.Encode()
+	ctx, cancel := context.WithTimeout(ctx, o.timeout+wait+wait/16)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if o.profile.Token != "" {
+		request.Header.Set("X-Consul-Token", o.profile.Token)
+	}
+
+	response, err := o.client.Do(request)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	defer response.Body.Close()
+	data, err = io.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusNotFound:
+		return data, response.Header, false, nil
+	case response.StatusCode >= 300:
+		return nil, nil, false, fmt.Errorf("kv %s %s: %s: %s", method, path, response.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, response.Header, true, nil
+}
+
+// kvDiff returns the events turning last into current, both in key order.
+func kvDiff(last, current []KVPair) []KVEvent {
+	previous := make(map[string]KVPair, len(last))
+	for _, pair := range last {
+		previous[pair.Key] = pair
+	}
+
+	var events []KVEvent
+	for _, pair := range current {
+		old, ok := previous[pair.Key]
+		delete(previous, pair.Key)
+		if !ok || old.Revision != pair.Revision || old.Session != pair.Session {
+			events = append(events, KVEvent{Type: KVEventPut, Pair: pair})
+		}
+	}
+
+	deleted := make([]string, 0, len(previous))
+	for key := range previous {
+		deleted = append(deleted, key)
+	}
+
+	sort.Strings(deleted)
+	for _, key := range deleted {
+		events = append(events, KVEvent{Type: KVEventDelete, Pair: previous[key]})
+	}
+
+	return events
+}
+
+func newKVOp(profile secret.KV) (*KVOp, error) {
+	base, err := url.Parse(profile.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("kv address %q is not scheme://host:port", profile.Address)
+	}
+
+	timeout := DefaultKVTimeout
+	if profile.Timeout > 0 {
+		timeout = time.Duration(profile.Timeout) * time.Millisecond
+	}
+
+	return &KVOp{
+		profile: profile,
+		base:    base,
+		client:  &http.Client{},
+		timeout: timeout,
+		closed:  make(chan struct{}),
+	}, nil
+}
+
+// NewKV creates a KV handler with the specified profile.
+// Returns nil if the profile name is empty, loading the profile fails or its address is invalid.
+func NewKV(profileName string) *KV {
+	if profileName == "" {
+		kklogger.ErrorJ("datastore.NewKV#profileName", "profile name is empty")
+		return nil
+	}
+
+	profile := &secret.KV{}
+	if err := secret.Load("kv", profileName, profile); err != nil {
+		kklogger.ErrorJ("datastore.NewKV#Load", err.Error())
+		return nil
+	}
+
+	op, err := newKVOp(*profile)
+	if err != nil {
+		kklogger.ErrorJ("datastore.NewKV#Client", err.Error())
+		return nil
+	}
+
+	return &KV{
+		name:    profileName,
+		profile: *profile,
+		op:      op,
+	}
+}
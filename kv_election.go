@@ -0,0 +1,200 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// ErrKVNoLeader is returned by LeaderElection.Leader when no candidate holds the election key.
+var ErrKVNoLeader = errors.New("kv election has no leader")
+
+// LeaderElection elects one leader among the candidates campaigning on the same key.
+// The leader holds the key locked by a session which is renewed in the background, leadership ends on
+// Resign or when the session can not be renewed within its TTL.
+type LeaderElection struct {
+	op    KVOperator
+	key   string
+	value []byte
+	// TTL of the candidate session, DefaultKVSessionTTL when 0
+	TTL time.Duration
+
+	campaign sync.Mutex
+	mutex    sync.Mutex
+	session  string
+	done     chan struct{}
+	stop     chan struct{}
+}
+
+// NewLeaderElection returns a LeaderElection on key of op, value identifies the candidate and is stored
+// under key while it leads.
+func NewLeaderElection(op KVOperator, key string, value []byte) *LeaderElection {
+	return &LeaderElection{op: op, key: key, value: value}
+}
+
+// Key returns the election key.
+func (e *LeaderElection) Key() string {
+	return e.key
+}
+
+// Campaign blocks until the candidate becomes leader or ctx is done, the returned channel is closed when
+// leadership ends. Calling it while leading returns the channel of the current leadership.
+func (e *LeaderElection) Campaign(ctx context.Context) (<-chan struct{}, error) {
+	e.campaign.Lock()
+	defer e.campaign.Unlock()
+	e.mutex.Lock()
+	if e.session != "" {
+		done := e.done
+		e.mutex.Unlock()
+		return done, nil
+	}
+
+	e.mutex.Unlock()
+	ttl := e.ttl()
+	session, err := e.op.CreateSession(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := e.op.Watch(watchCtx, e.key)
+	if err != nil {
+		e.destroy(session)
+		return nil, err
+	}
+
+	retry := min(DefaultKVElectionRetry, ttl/2)
+	for {
+		// Waiting candidates renew their session too, a leader stepping down must find it alive
+		if err := e.op.RenewSession(ctx, session); err != nil {
+			e.destroy(session)
+			return nil, err
+		}
+
+		acquired, err := e.op.Acquire(ctx, e.key, e.value, session)
+		if err != nil {
+			e.destroy(session)
+			return nil, err
+		}
+
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			e.destroy(session)
+			return nil, ctx.Err()
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		case <-time.After(retry):
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.session, e.done, e.stop = session, make(chan struct{}), make(chan struct{})
+	go e.keepAlive(session, ttl, e.stop)
+	return e.done, nil
+}
+
+// IsLeader reports whether the candidate currently leads.
+func (e *LeaderElection) IsLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.session != ""
+}
+
+// Leader returns the value of the current leader, ErrKVNoLeader when nobody leads.
+func (e *LeaderElection) Leader(ctx context.Context) ([]byte, error) {
+	pair, err := e.op.Get(ctx, e.key)
+	if errors.Is(err, ErrKVNotFound) || (err == nil && pair.Session == "") {
+		return nil, fmt.Errorf("%w: %s", ErrKVNoLeader, e.key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pair.Value, nil
+}
+
+// Resign releases the leadership so another candidate can take it, nothing happens when not leading.
+func (e *LeaderElection) Resign(ctx context.Context) error {
+	e.mutex.Lock()
+	session := e.session
+	if session == "" {
+		e.mutex.Unlock()
+		return nil
+	}
+
+	e.end()
+	e.mutex.Unlock()
+	_, err := e.op.Release(ctx, e.key, session)
+	return errors.Join(err, e.op.DestroySession(ctx, session))
+}
+
+// keepAlive renews the session at half of its TTL until stop is closed, leadership ends when renewing fails
+// for a whole TTL or the session is gone.
+func (e *LeaderElection) keepAlive(session string, ttl time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ttl/2)
+		err := e.op.RenewSession(ctx, session)
+		cancel()
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+
+		kklogger.WarnJ("datastore.LeaderElection#keepAlive", err.Error())
+		if errors.Is(err, ErrKVSessionNotFound) || time.Since(renewed) >= ttl {
+			e.mutex.Lock()
+			if e.session == session {
+				e.end()
+			}
+
+			e.mutex.Unlock()
+			e.destroy(session)
+			return
+		}
+	}
+}
+
+// end stops the keep alive and signals the end of leadership, the caller holds the mutex.
+func (e *LeaderElection) end() {
+	close(e.stop)
+	close(e.done)
+	e.session = ""
+}
+
+func (e *LeaderElection) destroy(session string) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultKVTimeout)
+	defer cancel()
+	if err := e.op.DestroySession(ctx, session); err != nil {
+		kklogger.WarnJ("datastore.LeaderElection#destroy", err.Error())
+	}
+}
+
+func (e *LeaderElection) ttl() time.Duration {
+	if e.TTL > 0 {
+		return e.TTL
+	}
+
+	return DefaultKVSessionTTL
+}
@@ -0,0 +1,48 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// KVOperator defines the interface for key value store operations.
+// This interface allows for both real and mock implementations.
+type KVOperator interface {
+	// Connection management
+	Ping(ctx context.Context) error
+	Close() error
+
+	// Values
+	Get(ctx context.Context, key string) (*KVPair, error)
+	List(ctx context.Context, prefix string) ([]KVPair, error)
+	Put(ctx context.Context, key string, value []byte) error
+	CompareAndSwap(ctx context.Context, key string, value []byte, revision uint64) (bool, error)
+	Delete(ctx context.Context, key string) error
+	DeletePrefix(ctx context.Context, prefix string) error
+
+	// Watch
+	Watch(ctx context.Context, prefix string) (<-chan KVEvent, error)
+
+	// Sessions and locks
+	CreateSession(ctx context.Context, ttl time.Duration) (string, error)
+	RenewSession(ctx context.Context, id string) error
+	DestroySession(ctx context.Context, id string) error
+	Acquire(ctx context.Context, key string, value []byte, session string) (bool, error)
+	Release(ctx context.Context, key string, session string) (bool, error)
+}
+
+// KVProvider defines the interface for KV instances.
+// This allows both real and mock KV implementations.
+type KVProvider interface {
+	Operator() KVOperator
+	Profile() secret.KV
+}
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ KVOperator = (*KVOp)(nil)
+	_ KVOperator = (*MockKVOp)(nil)
+	_ KVProvider = (*KV)(nil)
+)
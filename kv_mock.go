@@ -0,0 +1,478 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockKVOp is a mock implementation of KVOperator for testing.
+// Pairs, sessions and locks are kept in memory, watches see every write, and all operations are recorded
+// for test verification.
+type MockKVOp struct {
+	mutex sync.RWMutex
+
+	pairs       map[string]KVPair
+	sessions    map[string]bool
+	revision    uint64
+	watchers    map[*mockKVWatcher]bool
+	callHistory []MockKVCall
+	errors      map[string]error
+	chaos       *mockChaos
+	closed      bool
+}
+
+// MockKVCall represents a recorded kv operation call.
+type MockKVCall struct {
+	Timestamp time.Time
+	Method    string
+	Key       string
+	Error     error
+}
+
+// mockKVWatcher queues the events of a watch, so writers never block on slow readers.
+type mockKVWatcher struct {
+	prefix string
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+	queue  []KVEvent
+	notify chan struct{}
+}
+
+// NewMockKVOp creates a new mock operator with an empty store.
+func NewMockKVOp() *MockKVOp {
+	return &MockKVOp{
+		pairs:       map[string]KVPair{},
+		sessions:    map[string]bool{},
+		watchers:    map[*mockKVWatcher]bool{},
+		callHistory: make([]MockKVCall, 0),
+		errors:      map[string]error{},
+	}
+}
+
+// begin injects chaos, locks the mock and returns the error to fail method with, the caller unlocks.
+func (m *MockKVOp) begin(method string) error {
+	chaosErr := m.injectChaos()
+	m.mutex.Lock()
+	switch {
+	case chaosErr != nil:
+		return chaosErr
+	case m.closed:
+		return ErrKVClosed
+	}
+
+	return m.errors[method]
+}
+
+func (m *MockKVOp) record(method, key string, err error) {
+	m.callHistory = append(m.callHistory, MockKVCall{Timestamp: time.Now(), Method: method, Key: key, Error: err})
+}
+
+// Ping returns the error configured for "Ping" with SetError.
+func (m *MockKVOp) Ping(ctx context.Context) error {
+	err := m.begin("Ping")
+	defer m.mutex.Unlock()
+	m.record("Ping", "", err)
+	return err
+}
+
+// Close ends the watches, later calls fail with ErrKVClosed.
+func (m *MockKVOp) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	for watcher := range m.watchers {
+		watcher.cancel()
+	}
+
+	return nil
+}
+
+// Get returns a copy of the pair of key, ErrKVNotFound if it does not exist.
+func (m *MockKVOp) Get(ctx context.Context, key string) (*KVPair, error) {
+	err := m.begin("Get")
+	defer m.mutex.Unlock()
+	var pair *KVPair
+	if err == nil {
+		if stored, ok := m.pairs[key]; ok {
+			stored.Value = append([]byte(nil), stored.Value...)
+			pair = &stored
+		} else {
+			err = fmt.Errorf("%w: %s", ErrKVNotFound, key)
+		}
+	}
+
+	m.record("Get", key, err)
+	return pair, err
+}
+
+// List returns copies of the pairs of the keys starting with prefix in key order.
+func (m *MockKVOp) List(ctx context.Context, prefix string) ([]KVPair, error) {
+	err := m.begin("List")
+	defer m.mutex.Unlock()
+	m.record("List", prefix, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []KVPair
+	for _, key := range m.keys(prefix) {
+		pair := m.pairs[key]
+		pair.Value = append([]byte(nil), pair.Value...)
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, nil
+}
+
+// Put stores a copy of value under key, keeping its lock.
+func (m *MockKVOp) Put(ctx context.Context, key string, value []byte) error {
+	err := m.begin("Put")
+	defer m.mutex.Unlock()
+	if err == nil {
+		m.store(key, value, m.pairs[key].Session)
+	}
+
+	m.record("Put", key, err)
+	return err
+}
+
+// CompareAndSwap stores value under key only if its revision is still revision, 0 for a missing key.
+func (m *MockKVOp) CompareAndSwap(ctx context.Context, key string, value []byte, revision uint64) (bool, error) {
+	err := m.begin("CompareAndSwap")
+	defer m.mutex.Unlock()
+	swapped := false
+	if err == nil && m.pairs[key].Revision == revision {
+		m.store(key, value, m.pairs[key].Session)
+		swapped = true
+	}
+
+	m.record("CompareAndSwap", key, err)
+	return swapped, err
+}
+
+// Delete removes key, deleting a missing key succeeds.
+func (m *MockKVOp) Delete(ctx context.Context, key string) error {
+	err := m.begin("Delete")
+	defer m.mutex.Unlock()
+	if err == nil {
+		m.remove(key)
+	}
+
+	m.record("Delete", key, err)
+	return err
+}
+
+// DeletePrefix removes every key starting with prefix.
+func (m *MockKVOp) DeletePrefix(ctx context.Context, prefix string) error {
+	err := m.begin("DeletePrefix")
+	defer m.mutex.Unlock()
+	if err == nil {
+		for _, key := range m.keys(prefix) {
+			m.remove(key)
+		}
+	}
+
+	m.record("DeletePrefix", prefix, err)
+	return err
+}
+
+// Watch reports every later write of the keys starting with prefix, until ctx is done or the mock is closed.
+func (m *MockKVOp) Watch(ctx context.Context, prefix string) (<-chan KVEvent, error) {
+	err := m.begin("Watch")
+	defer m.mutex.Unlock()
+	m.record("Watch", prefix, err)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	watcher := &mockKVWatcher{prefix: prefix, cancel: cancel, notify: make(chan struct{}, 1)}
+	m.watchers[watcher] = true
+	events := make(chan KVEvent)
+	go func() {
+		defer close(events)
+		defer func() {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			delete(m.watchers, watcher)
+		}()
+
+		for {
+			watcher.mutex.Lock()
+			queue := watcher.queue
+			watcher.queue = nil
+			watcher.mutex.Unlock()
+			for _, event := range queue {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-watcher.notify:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// CreateSession creates a session, it lives until it is destroyed or expired with ExpireSession.
+func (m *MockKVOp) CreateSession(ctx context.Context, ttl time.Duration) (string, error) {
+	err := m.begin("CreateSession")
+	defer m.mutex.Unlock()
+	var id string
+	if err == nil {
+		m.revision++
+		id = "mock-session-" + strconv.FormatUint(m.revision, 10)
+		m.sessions[id] = true
+	}
+
+	m.record("CreateSession", id, err)
+	return id, err
+}
+
+// RenewSession returns ErrKVSessionNotFound if the session was destroyed or expired.
+func (m *MockKVOp) RenewSession(ctx context.Context, id string) error {
+	err := m.begin("RenewSession")
+	defer m.mutex.Unlock()
+	if err == nil && !m.sessions[id] {
+		err = fmt.Errorf("%w: %s", ErrKVSessionNotFound, id)
+	}
+
+	m.record("RenewSession", id, err)
+	return err
+}
+
+// DestroySession destroys the session and releases its locks.
+func (m *MockKVOp) DestroySession(ctx context.Context, id string) error {
+	err := m.begin("DestroySession")
+	defer m.mutex.Unlock()
+	if err == nil {
+		m.invalidate(id)
+	}
+
+	m.record("DestroySession", id, err)
+	return err
+}
+
+// Acquire stores value under key and locks it with the session, false when another session holds the lock.
+func (m *MockKVOp) Acquire(ctx context.Context, key string, value []byte, session string) (bool, error) {
+	err := m.begin("Acquire")
+	defer m.mutex.Unlock()
+	if err == nil && !m.sessions[session] {
+		err = fmt.Errorf("%w: %s", ErrKVSessionNotFound, session)
+	}
+
+	acquired := false
+	if holder := m.pairs[key].Session; err == nil && (holder == "" || holder == session) {
+		m.store(key, value, session)
+		acquired = true
+	}
+
+	m.record("Acquire", key, err)
+	return acquired, err
+}
+
+// Release unlocks key if the session holds its lock, the value is kept.
+func (m *MockKVOp) Release(ctx context.Context, key string, session string) (bool, error) {
+	err := m.begin("Release")
+	defer m.mutex.Unlock()
+	released := false
+	if pair, ok := m.pairs[key]; err == nil && ok && pair.Session == session {
+		m.store(key, pair.Value, "")
+		released = true
+	}
+
+	m.record("Release", key, err)
+	return released, err
+}
+
+// store writes the pair and notifies the watches, the caller holds the mutex.
+func (m *MockKVOp) store(key string, value []byte, session string) {
+	m.revision++
+	pair := KVPair{Key: key, Value: append([]byte(nil), value...), Revision: m.revision, Session: session}
+	m.pairs[key] = pair
+	m.notify(KVEvent{Type: KVEventPut, Pair: pair})
+}
+
+// remove deletes the pair and notifies the watches, the caller holds the mutex.
+func (m *MockKVOp) remove(key string) {
+	if pair, ok := m.pairs[key]; ok {
+		delete(m.pairs, key)
+		m.notify(KVEvent{Type: KVEventDelete, Pair: pair})
+	}
+}
+
+// invalidate removes the session and releases its locks, the caller holds the mutex.
+func (m *MockKVOp) invalidate(id string) {
+	delete(m.sessions, id)
+	for _, key := range m.keys("") {
+		if pair := m.pairs[key]; pair.Session == id {
+			m.store(key, pair.Value, "")
+		}
+	}
+}
+
+func (m *MockKVOp) notify(event KVEvent) {
+	for watcher := range m.watchers {
+		if !strings.HasPrefix(event.Pair.Key, watcher.prefix) {
+			continue
+		}
+
+		watcher.mutex.Lock()
+		event.Pair.Value = append([]byte(nil), event.Pair.Value...)
+		watcher.queue = append(watcher.queue, event)
+		watcher.mutex.Unlock()
+		select {
+		case watcher.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// keys returns the stored keys starting with prefix in order, the caller holds the mutex.
+func (m *MockKVOp) keys(prefix string) []string {
+	var keys []string
+	for key := range m.pairs {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Mock configuration methods
+
+// ExpireSession invalidates the session as if it was not renewed in time, releasing its locks.
+func (m *MockKVOp) ExpireSession(id string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.invalidate(id)
+}
+
+// Sessions returns the ids of the live sessions in order.
+func (m *MockKVOp) Sessions() []string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	sessions := make([]string, 0, len(m.sessions))
+	for id := range m.sessions {
+		sessions = append(sessions, id)
+	}
+
+	sort.Strings(sessions)
+	return sessions
+}
+
+// SetError configures the named method, like "Put" or "RenewSession", to fail with err, nil clears it.
+func (m *MockKVOp) SetError(method string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err == nil {
+		delete(m.errors, method)
+	} else {
+		m.errors[method] = err
+	}
+}
+
+// Pairs returns a copy of the stored values by key.
+func (m *MockKVOp) Pairs() map[string][]byte {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	pairs := make(map[string][]byte, len(m.pairs))
+	for key, pair := range m.pairs {
+		pairs[key] = append([]byte(nil), pair.Value...)
+	}
+
+	return pairs
+}
+
+// Reset removes all pairs, sessions and recorded calls, watches stay open.
+func (m *MockKVOp) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pairs = map[string]KVPair{}
+	m.sessions = map[string]bool{}
+	m.callHistory = make([]MockKVCall, 0)
+}
+
+// IsClosed returns whether Close was called.
+func (m *MockKVOp) IsClosed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.closed
+}
+
+// EnableChaos injects latency, random failures and outages into subsequent calls.
+func (m *MockKVOp) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockKVOp) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockKVOp) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// Call tracking methods
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockKVOp) GetCallHistory() []MockKVCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockKVCall(nil), m.callHistory...)
+}
+
+// GetCallsByMethod returns all calls for a specific method.
+func (m *MockKVOp) GetCallsByMethod(method string) []MockKVCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var filtered []MockKVCall
+	for _, call := range m.callHistory {
+		if call.Method == method {
+			filtered = append(filtered, call)
+		}
+	}
+
+	return filtered
+}
+
+// NewMockKV creates a KV instance with a mock operator.
+func NewMockKV() *KV {
+	return NewMockKVWithOp(NewMockKVOp())
+}
+
+// NewMockKVWithOp creates a KV instance with a custom mock operator.
+func NewMockKVWithOp(op *MockKVOp) *KV {
+	return &KV{
+		name: "mock-kv",
+		op:   op,
+	}
+}
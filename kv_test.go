@@ -0,0 +1,405 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// testConsulServer serves the KV, session and blocking query endpoints used by KVOp.
+func testConsulServer() *httptest.Server {
+	var mutex sync.Mutex
+	changed := sync.NewCond(&mutex)
+	entries := map[string]consulKVEntry{}
+	sessions := map[string]bool{}
+	var index uint64 = 1
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		query := r.URL.Query()
+		path := r.URL.Path
+		write := func(value any) {
+			w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+			json.NewEncoder(w).Encode(value)
+		}
+
+		switch {
+		case path == "/v1/status/leader":
+			write("127.0.0.1:8300")
+		case strings.HasPrefix(path, "/v1/session/"):
+			action, id, _ := strings.Cut(strings.TrimPrefix(path, "/v1/session/"), "/")
+			switch action {
+			case "create":
+				index++
+				id = "session-" + strconv.FormatUint(index, 10)
+				sessions[id] = true
+				write(map[string]string{"ID": id})
+			case "renew":
+				if !sessions[id] {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				write([]map[string]string{{"ID": id}})
+			case "destroy":
+				delete(sessions, id)
+				for key, entry := range entries {
+					if entry.Session == id {
+						index++
+						entry.Session, entry.ModifyIndex = "", index
+						entries[key] = entry
+					}
+				}
+
+				changed.Broadcast()
+				write(true)
+			}
+		case r.Method == http.MethodGet:
+			key := strings.TrimPrefix(path, "/v1/kv/")
+			if wait := query.Get("wait"); wait != "" {
+				after, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+				timeout, _ := time.ParseDuration(wait)
+				wake := func() {
+					mutex.Lock()
+					defer mutex.Unlock()
+					changed.Broadcast()
+				}
+
+				deadline := time.AfterFunc(timeout, wake)
+				defer deadline.Stop()
+				canceled := context.AfterFunc(r.Context(), wake)
+				defer canceled()
+				for start := time.Now(); index <= after && time.Since(start) < timeout && r.Context().Err() == nil; {
+					changed.Wait()
+				}
+			}
+
+			var found []consulKVEntry
+			for name, entry := range entries {
+				if name == key || (query.Has("recurse") && strings.HasPrefix(name, key)) {
+					found = append(found, entry)
+				}
+			}
+
+			sort.Slice(found, func(i, j int) bool {
+				return found[i].Key < found[j].Key
+			})
+
+			if len(found) == 0 {
+				w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			write(found)
+		case r.Method == http.MethodPut:
+			key := strings.TrimPrefix(path, "/v1/kv/")
+			value, _ := io.ReadAll(r.Body)
+			entry, exists := entries[key]
+			switch {
+			case query.Has("cas") && query.Get("cas") != strconv.FormatUint(entry.ModifyIndex, 10):
+				write(false)
+				return
+			case query.Has("acquire"):
+				if !sessions[query.Get("acquire")] || (entry.Session != "" && entry.Session != query.Get("acquire")) {
+					write(false)
+					return
+				}
+
+				entry.Session = query.Get("acquire")
+			case query.Has("release"):
+				if !exists || entry.Session != query.Get("release") {
+					write(false)
+					return
+				}
+
+				entry.Session = ""
+			}
+
+			index++
+			entry.Key, entry.Value, entry.ModifyIndex = key, value, index
+			entries[key] = entry
+			changed.Broadcast()
+			write(true)
+		case r.Method == http.MethodDelete:
+			key := strings.TrimPrefix(path, "/v1/kv/")
+			for name := range entries {
+				if name == key || (query.Has("recurse") && strings.HasPrefix(name, key)) {
+					delete(entries, name)
+				}
+			}
+
+			index++
+			changed.Broadcast()
+			write(true)
+		}
+	}))
+}
+
+func TestKV(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("NewKV loads profile", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		assert.Nil(t, NewKV(""))
+		assert.Nil(t, NewKV("missing"))
+
+		kv := NewKV("test")
+		if assert.NotNil(t, kv) {
+			defer kv.Close()
+			assert.Equal(t, "goth/", kv.Profile().Prefix)
+			assert.Equal(t, 3*time.Second, kv.Operator().(*KVOp).timeout)
+		}
+
+		_, err := newKVOp(secret.KV{Address: "127.0.0.1:8500"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Values and sessions", func(t *testing.T) {
+		server := testConsulServer()
+		defer server.Close()
+
+		op, err := newKVOp(secret.KV{Address: server.URL, Prefix: "app/"})
+		assert.NoError(t, err)
+		defer op.Close()
+
+		assert.NoError(t, op.Ping(ctx))
+		_, err = op.Get(ctx, "config/a")
+		assert.ErrorIs(t, err, ErrKVNotFound)
+
+		swapped, err := op.CompareAndSwap(ctx, "config/a", []byte("1"), 0)
+		assert.NoError(t, err)
+		assert.True(t, swapped)
+		assert.NoError(t, op.Put(ctx, "config/b", []byte("2")))
+
+		pair, err := op.Get(ctx, "config/a")
+		assert.NoError(t, err)
+		assert.Equal(t, "config/a", pair.Key)
+		assert.Equal(t, "1", string(pair.Value))
+
+		swapped, err = op.CompareAndSwap(ctx, "config/a", []byte("stale"), pair.Revision-1)
+		assert.NoError(t, err)
+		assert.False(t, swapped)
+
+		pairs, err := op.List(ctx, "config/")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"config/a", "config/b"}, kvKeys(pairs))
+
+		session, err := op.CreateSession(ctx, 0)
+		assert.NoError(t, err)
+		other, _ := op.CreateSession(ctx, 0)
+		acquired, err := op.Acquire(ctx, "lock", []byte("me"), session)
+		assert.NoError(t, err)
+		assert.True(t, acquired)
+		acquired, _ = op.Acquire(ctx, "lock", []byte("other"), other)
+		assert.False(t, acquired)
+
+		released, err := op.Release(ctx, "lock", session)
+		assert.NoError(t, err)
+		assert.True(t, released)
+		pair, _ = op.Get(ctx, "lock")
+		assert.Equal(t, "me", string(pair.Value))
+		assert.Empty(t, pair.Session)
+
+		assert.NoError(t, op.RenewSession(ctx, session))
+		assert.NoError(t, op.DestroySession(ctx, session))
+		assert.ErrorIs(t, op.RenewSession(ctx, session), ErrKVSessionNotFound)
+
+		assert.NoError(t, op.Delete(ctx, "config/a"))
+		assert.NoError(t, op.DeletePrefix(ctx, "config/"))
+		pairs, err = op.List(ctx, "")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"lock"}, kvKeys(pairs))
+
+		op.Close()
+		assert.ErrorIs(t, op.Ping(ctx), ErrKVClosed)
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		server := testConsulServer()
+		defer server.Close()
+
+		op, _ := newKVOp(secret.KV{Address: server.URL})
+		assert.NoError(t, op.Put(ctx, "config/before", []byte("0")))
+		watchCtx, cancel := context.WithCancel(ctx)
+		events, err := op.Watch(watchCtx, "config/")
+		assert.NoError(t, err)
+
+		assert.NoError(t, op.Put(ctx, "config/a", []byte("1")))
+		event := <-events
+		assert.Equal(t, KVEventPut, event.Type)
+		assert.Equal(t, "config/a", event.Pair.Key)
+		assert.Equal(t, "1", string(event.Pair.Value))
+
+		assert.NoError(t, op.Put(ctx, "other", []byte("ignored")))
+		assert.NoError(t, op.Delete(ctx, "config/before"))
+		event = <-events
+		assert.Equal(t, KVEventDelete, event.Type)
+		assert.Equal(t, "config/before", event.Pair.Key)
+
+		cancel()
+		for range events {
+		}
+	})
+}
+
+func TestLeaderElection(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Failover", func(t *testing.T) {
+		mock := NewMockKVOp()
+		first := NewLeaderElection(mock, "leader", []byte("first"))
+		second := NewMockKVWithOp(mock).NewLeaderElection("leader", []byte("second"))
+
+		_, err := first.Leader(ctx)
+		assert.ErrorIs(t, err, ErrKVNoLeader)
+
+		done, err := first.Campaign(ctx)
+		assert.NoError(t, err)
+		assert.True(t, first.IsLeader())
+		again, _ := first.Campaign(ctx)
+		assert.Equal(t, done, again)
+
+		elected := make(chan error)
+		go func() {
+			_, err := second.Campaign(ctx)
+			elected <- err
+		}()
+
+		leader, err := second.Leader(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", string(leader))
+
+		assert.NoError(t, first.Resign(ctx))
+		assert.False(t, first.IsLeader())
+		<-done
+		assert.NoError(t, <-elected)
+		assert.True(t, second.IsLeader())
+		leader, _ = first.Leader(ctx)
+		assert.Equal(t, "second", string(leader))
+		assert.NoError(t, first.Resign(ctx))
+		assert.NoError(t, second.Resign(ctx))
+	})
+
+	t.Run("Session loss ends leadership", func(t *testing.T) {
+		mock := NewMockKVOp()
+		election := NewLeaderElection(mock, "leader", []byte("me"))
+		election.TTL = 20 * time.Millisecond
+		done, err := election.Campaign(ctx)
+		assert.NoError(t, err)
+
+		mock.ExpireSession(mock.Sessions()[0])
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("leadership did not end")
+		}
+
+		assert.False(t, election.IsLeader())
+		_, err = election.Leader(ctx)
+		assert.ErrorIs(t, err, ErrKVNoLeader)
+	})
+
+	t.Run("Campaign stops with ctx", func(t *testing.T) {
+		mock := NewMockKVOp()
+		holder := NewLeaderElection(mock, "leader", []byte("holder"))
+		_, err := holder.Campaign(ctx)
+		assert.NoError(t, err)
+
+		candidate := NewLeaderElection(mock, "leader", []byte("candidate"))
+		timeout, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+		defer cancel()
+		_, err = candidate.Campaign(timeout)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Len(t, mock.Sessions(), 1)
+		assert.NoError(t, holder.Resign(ctx))
+		assert.Empty(t, mock.Sessions())
+	})
+}
+
+func TestMockKVOp(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Values and watch", func(t *testing.T) {
+		mock := NewMockKVOp()
+		events, err := mock.Watch(ctx, "config/")
+		assert.NoError(t, err)
+
+		assert.NoError(t, mock.Put(ctx, "config/a", []byte("1")))
+		assert.NoError(t, mock.Put(ctx, "other", []byte("x")))
+		swapped, err := mock.CompareAndSwap(ctx, "config/a", []byte("2"), 1)
+		assert.NoError(t, err)
+		assert.True(t, swapped)
+		swapped, _ = mock.CompareAndSwap(ctx, "config/a", []byte("3"), 1)
+		assert.False(t, swapped)
+		assert.NoError(t, mock.DeletePrefix(ctx, "config/"))
+
+		for _, expected := range []string{"PUT config/a 1", "PUT config/a 2", "DELETE config/a 2"} {
+			event := <-events
+			assert.Equal(t, expected, event.Type.String()+" "+event.Pair.Key+" "+string(event.Pair.Value))
+		}
+
+		_, err = mock.Get(ctx, "config/a")
+		assert.ErrorIs(t, err, ErrKVNotFound)
+		pairs, _ := mock.List(ctx, "")
+		assert.Equal(t, []string{"other"}, kvKeys(pairs))
+		assert.Equal(t, map[string][]byte{"other": []byte("x")}, mock.Pairs())
+
+		assert.NoError(t, mock.Close())
+		_, open := <-events
+		assert.False(t, open)
+		assert.True(t, mock.IsClosed())
+		assert.ErrorIs(t, mock.Put(ctx, "a", nil), ErrKVClosed)
+	})
+
+	t.Run("Errors and chaos", func(t *testing.T) {
+		mock := NewMockKVOp()
+		down := errors.New("down")
+		mock.SetError("Put", down)
+		assert.ErrorIs(t, mock.Put(ctx, "a", nil), down)
+		mock.SetError("Put", nil)
+		assert.NoError(t, mock.Put(ctx, "a", nil))
+
+		mock.EnableChaos(MockChaosConfig{ErrorRate: 1})
+		assert.ErrorIs(t, mock.Ping(ctx), ErrMockChaos)
+		mock.DisableChaos()
+		assert.NoError(t, mock.Ping(ctx))
+		assert.Len(t, mock.GetCallsByMethod("Put"), 2)
+
+		_, err := mock.Acquire(ctx, "lock", nil, "unknown")
+		assert.ErrorIs(t, err, ErrKVSessionNotFound)
+
+		mock.Reset()
+		assert.Empty(t, mock.Pairs())
+		assert.Empty(t, mock.GetCallHistory())
+	})
+}
+
+func kvKeys(pairs []KVPair) []string {
+	keys := make([]string, len(pairs))
+	for idx, pair := range pairs {
+		keys[idx] = pair.Key
+	}
+
+	return keys
+}
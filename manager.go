@@ -0,0 +1,292 @@
+package datastore
+
+import (
+	"fmt"
+	"sync"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultManager is the process wide Manager used by the package level GetRedis, GetDatabase and
+// the other Get functions.
+var DefaultManager = NewManager()
+
+// Manager lazily constructs and caches Redis, Database, Cassandra, Mongo, Kafka, ObjectStore,
+// Memcached, KV and Rabbit instances by profile name, so services share one handle per profile
+// instead of keeping their own global maps.
+// A failed construction is not cached and is attempted again on the next call.
+// Constructed instances are registered in the DataStoreRegistry returned by DataStores.
+type Manager struct {
+	mutex     sync.Mutex
+	stores    *DataStoreRegistry
+	redis     map[string]*Redis
+	databases map[string]*Database
+	cassandra map[string]*Cassandra
+	mongo     map[string]*Mongo
+	kafka     map[string]*Kafka
+	objects   map[string]*ObjectStore
+	memcached map[string]*Memcached
+	kv        map[string]*KV
+	rabbit    map[string]*Rabbit
+
+	newRedis       func(profileName string) *Redis
+	newDatabase    func(profileName string) *Database
+	newCassandra   func(profileName string) *Cassandra
+	newMongo       func(profileName string) *Mongo
+	newKafka       func(profileName string) (*Kafka, error)
+	newObjectStore func(profileName string) *ObjectStore
+	newMemcached   func(profileName string) *Memcached
+	newKV          func(profileName string) *KV
+	newRabbit      func(profileName string) *Rabbit
+
+	// constructing shares the construction of a profile between concurrent calls
+	constructing singleflight.Group
+}
+
+// NewManager returns an empty Manager loading profiles with NewRedis, NewDatabase, NewCassandra,
+// NewMongo, NewKafka, NewObjectStore, NewMemcached, NewKV and NewRabbit.
+func NewManager() *Manager {
+	return &Manager{
+		stores:         NewDataStoreRegistry(),
+		redis:          map[string]*Redis{},
+		databases:      map[string]*Database{},
+		cassandra:      map[string]*Cassandra{},
+		mongo:          map[string]*Mongo{},
+		kafka:          map[string]*Kafka{},
+		objects:        map[string]*ObjectStore{},
+		memcached:      map[string]*Memcached{},
+		kv:             map[string]*KV{},
+		rabbit:         map[string]*Rabbit{},
+		newRedis:       NewRedis,
+		newDatabase:    NewDatabase,
+		newCassandra:   NewCassandra,
+		newMongo:       NewMongo,
+		newKafka:       NewKafka,
+		newObjectStore: NewObjectStore,
+		newMemcached:   NewMemcached,
+		newKV:          NewKV,
+		newRabbit:      NewRabbit,
+	}
+}
+
+// GetRedis returns the Redis of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetRedis(profileName string) *Redis {
+	return managerGet(m, "Redis", profileName, func() map[string]*Redis { return m.redis }, func(profileName string) (*Redis, error) {
+		return m.newRedis(profileName), nil
+	})
+}
+
+// GetDatabase returns the Database of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetDatabase(profileName string) *Database {
+	return managerGet(m, "Database", profileName, func() map[string]*Database { return m.databases }, func(profileName string) (*Database, error) {
+		return m.newDatabase(profileName), nil
+	})
+}
+
+// GetCassandra returns the Cassandra of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetCassandra(profileName string) *Cassandra {
+	return managerGet(m, "Cassandra", profileName, func() map[string]*Cassandra { return m.cassandra }, func(profileName string) (*Cassandra, error) {
+		return m.newCassandra(profileName), nil
+	})
+}
+
+// GetMongo returns the Mongo of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetMongo(profileName string) *Mongo {
+	return managerGet(m, "Mongo", profileName, func() map[string]*Mongo { return m.mongo }, func(profileName string) (*Mongo, error) {
+		return m.newMongo(profileName), nil
+	})
+}
+
+// GetKafka returns the Kafka of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetKafka(profileName string) *Kafka {
+	return managerGet(m, "Kafka", profileName, func() map[string]*Kafka { return m.kafka }, m.newKafka)
+}
+
+// GetObjectStore returns the ObjectStore of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetObjectStore(profileName string) *ObjectStore {
+	return managerGet(m, "ObjectStore", profileName, func() map[string]*ObjectStore { return m.objects }, func(profileName string) (*ObjectStore, error) {
+		return m.newObjectStore(profileName), nil
+	})
+}
+
+// GetMemcached returns the Memcached of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetMemcached(profileName string) *Memcached {
+	return managerGet(m, "Memcached", profileName, func() map[string]*Memcached { return m.memcached }, func(profileName string) (*Memcached, error) {
+		return m.newMemcached(profileName), nil
+	})
+}
+
+// GetKV returns the KV of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetKV(profileName string) *KV {
+	return managerGet(m, "KV", profileName, func() map[string]*KV { return m.kv }, func(profileName string) (*KV, error) {
+		return m.newKV(profileName), nil
+	})
+}
+
+// GetRabbit returns the Rabbit of the profile, constructing it on first use. nil if the profile fails to load.
+func (m *Manager) GetRabbit(profileName string) *Rabbit {
+	return managerGet(m, "Rabbit", profileName, func() map[string]*Rabbit { return m.rabbit }, func(profileName string) (*Rabbit, error) {
+		return m.newRabbit(profileName), nil
+	})
+}
+
+// managerGet returns the instance of profileName cached in the map returned by cache, constructing it with create
+// on first use. The lock is only held to access the maps: concurrent calls for the same profile share one
+// construction, while other profiles are served meanwhile.
+func managerGet[T interface {
+	comparable
+	DataStore
+}](m *Manager, kind string, profileName string, cache func() map[string]T, create func(profileName string) (T, error)) T {
+	lookup := func() (T, bool) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		v, ok := cache()[profileName]
+		return v, ok
+	}
+
+	if v, ok := lookup(); ok {
+		return v
+	}
+
+	v, _, _ := m.constructing.Do(kind+"/"+profileName, func() (interface{}, error) {
+		if v, ok := lookup(); ok {
+			return v, nil
+		}
+
+		v, err := create(profileName)
+		if err != nil {
+			kklogger.ErrorJ("datastore:Manager.Get"+kind, fmt.Sprintf("profile %s: %s", profileName, err.Error()))
+		}
+
+		var zero T
+		if v != zero {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			cache()[profileName] = v
+			m.register(v)
+		}
+
+		return v, nil
+	})
+
+	return v.(T)
+}
+
+// DataStores returns the registry of the instances constructed by the Manager.
+func (m *Manager) DataStores() *DataStoreRegistry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.stores
+}
+
+// register adds store to the registry, the lock must be held.
+func (m *Manager) register(store DataStore) {
+	if err := m.stores.Register(store); err != nil {
+		kklogger.WarnJ("datastore:Manager.register", err.Error())
+	}
+}
+
+// Close closes every cached instance and empties the cache, later calls construct new instances.
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	redis, databases, cassandra, mongo, kafka := m.redis, m.databases, m.cassandra, m.mongo, m.kafka
+	objects, memcached, kv, rabbit := m.objects, m.memcached, m.kv, m.rabbit
+	m.stores = NewDataStoreRegistry()
+	m.redis = map[string]*Redis{}
+	m.databases = map[string]*Database{}
+	m.cassandra = map[string]*Cassandra{}
+	m.mongo = map[string]*Mongo{}
+	m.kafka = map[string]*Kafka{}
+	m.objects = map[string]*ObjectStore{}
+	m.memcached = map[string]*Memcached{}
+	m.kv = map[string]*KV{}
+	m.rabbit = map[string]*Rabbit{}
+	m.mutex.Unlock()
+
+	for _, r := range redis {
+		r.Close()
+	}
+
+	for _, db := range databases {
+		db.Close()
+	}
+
+	for _, c := range cassandra {
+		c.Close()
+	}
+
+	for _, mg := range mongo {
+		mg.Close()
+	}
+
+	for _, k := range kafka {
+		k.Close()
+	}
+
+	for _, s := range objects {
+		s.Close()
+	}
+
+	for _, mc := range memcached {
+		mc.Close()
+	}
+
+	for _, k := range kv {
+		k.Close()
+	}
+
+	for _, r := range rabbit {
+		r.Close()
+	}
+}
+
+// GetRedis returns the Redis of the profile from DefaultManager.
+func GetRedis(profileName string) *Redis {
+	return DefaultManager.GetRedis(profileName)
+}
+
+// GetDatabase returns the Database of the profile from DefaultManager.
+func GetDatabase(profileName string) *Database {
+	return DefaultManager.GetDatabase(profileName)
+}
+
+// GetCassandra returns the Cassandra of the profile from DefaultManager.
+func GetCassandra(profileName string) *Cassandra {
+	return DefaultManager.GetCassandra(profileName)
+}
+
+// GetMongo returns the Mongo of the profile from DefaultManager.
+func GetMongo(profileName string) *Mongo {
+	return DefaultManager.GetMongo(profileName)
+}
+
+// GetKafka returns the Kafka of the profile from DefaultManager.
+func GetKafka(profileName string) *Kafka {
+	return DefaultManager.GetKafka(profileName)
+}
+
+// GetObjectStore returns the ObjectStore of the profile from DefaultManager.
+func GetObjectStore(profileName string) *ObjectStore {
+	return DefaultManager.GetObjectStore(profileName)
+}
+
+// GetMemcached returns the Memcached of the profile from DefaultManager.
+func GetMemcached(profileName string) *Memcached {
+	return DefaultManager.GetMemcached(profileName)
+}
+
+// GetKV returns the KV of the profile from DefaultManager.
+func GetKV(profileName string) *KV {
+	return DefaultManager.GetKV(profileName)
+}
+
+// GetRabbit returns the Rabbit of the profile from DefaultManager.
+func GetRabbit(profileName string) *Rabbit {
+	return DefaultManager.GetRabbit(profileName)
+}
+
+// DataStores returns the registry of the instances constructed by DefaultManager.
+func DataStores() *DataStoreRegistry {
+	return DefaultManager.DataStores()
+}
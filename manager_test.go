@@ -0,0 +1,156 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestManager(t *testing.T) {
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+
+	t.Run("Caches instances by profile", func(t *testing.T) {
+		manager := NewManager()
+		defer manager.Close()
+
+		db := manager.GetDatabase("sqlite-test")
+		assert.NotNil(t, db)
+		assert.Same(t, db, manager.GetDatabase("sqlite-test"))
+		assert.NotSame(t, db, manager.GetDatabase("postgres-test"))
+
+		r := manager.GetRedis("test")
+		assert.NotNil(t, r)
+		assert.Same(t, r, manager.GetRedis("test"))
+
+		c := manager.GetCassandra("test")
+		assert.NotNil(t, c)
+		assert.Same(t, c, manager.GetCassandra("test"))
+
+		mg := manager.GetMongo("test")
+		assert.NotNil(t, mg)
+		assert.Same(t, mg, manager.GetMongo("test"))
+
+		s := manager.GetObjectStore("test")
+		assert.NotNil(t, s)
+		assert.Same(t, s, manager.GetObjectStore("test"))
+
+		mc := manager.GetMemcached("test")
+		assert.NotNil(t, mc)
+		assert.Same(t, mc, manager.GetMemcached("test"))
+
+		kv := manager.GetKV("test")
+		assert.NotNil(t, kv)
+		assert.Same(t, kv, manager.GetKV("test"))
+
+		rb := manager.GetRabbit("test")
+		assert.NotNil(t, rb)
+		assert.Same(t, rb, manager.GetRabbit("test"))
+
+		assert.Equal(t, []string{"cassandra/test", "database/postgres-test", "database/sqlite-test", "kv/test",
+			"memcached/test", "mongo/test", "objectstore/test", "rabbit/test", "redis/test"}, manager.DataStores().Names())
+		assert.Same(t, r, manager.DataStores().Get("redis/test"))
+
+		manager.Close()
+		assert.Empty(t, manager.DataStores().Names())
+		assert.NotSame(t, db, manager.GetDatabase("sqlite-test"))
+		assert.Equal(t, []string{"database/sqlite-test"}, manager.DataStores().Names())
+	})
+
+	t.Run("Failed profiles are not cached", func(t *testing.T) {
+		manager := NewManager()
+		calls := 0
+		manager.newDatabase = func(profileName string) *Database {
+			calls++
+			return nil
+		}
+
+		assert.Nil(t, manager.GetDatabase("missing"))
+		assert.Nil(t, manager.GetDatabase("missing"))
+		assert.Equal(t, 2, calls)
+		assert.Nil(t, manager.GetRedis("missing"))
+		assert.Nil(t, manager.GetCassandra("missing"))
+		assert.Nil(t, manager.GetMongo("missing"))
+		assert.Nil(t, manager.GetKafka("missing"))
+		assert.Nil(t, manager.GetObjectStore("missing"))
+		assert.Nil(t, manager.GetMemcached("missing"))
+		assert.Nil(t, manager.GetKV("missing"))
+		assert.Nil(t, manager.GetRabbit("missing"))
+	})
+
+	t.Run("Constructs once under concurrency", func(t *testing.T) {
+		manager := NewManager()
+		var mutex sync.Mutex
+		calls := 0
+		manager.newRedis = func(profileName string) *Redis {
+			mutex.Lock()
+			calls++
+			mutex.Unlock()
+			return &Redis{name: profileName, master: NewMockRedisOp(), slave: NewMockRedisOp()}
+		}
+
+		var wg sync.WaitGroup
+		results := make([]*Redis, 20)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = manager.GetRedis("session")
+			}(i)
+		}
+
+		wg.Wait()
+		assert.Equal(t, 1, calls)
+		for _, r := range results {
+			assert.Same(t, results[0], r)
+		}
+	})
+
+	t.Run("Slow profiles do not block others", func(t *testing.T) {
+		manager := NewManager()
+		release := make(chan struct{})
+		manager.newRedis = func(profileName string) *Redis {
+			if profileName == "slow" {
+				<-release
+			}
+
+			return &Redis{name: profileName, master: NewMockRedisOp(), slave: NewMockRedisOp()}
+		}
+
+		slow := make(chan *Redis)
+		go func() {
+			slow <- manager.GetRedis("slow")
+		}()
+
+		fast := make(chan *Redis)
+		go func() {
+			fast <- manager.GetRedis("fast")
+		}()
+
+		select {
+		case r := <-fast:
+			assert.Equal(t, "fast", r.name)
+		case <-time.After(time.Second):
+			t.Fatal("fast profile blocked by the slow one")
+		}
+
+		close(release)
+		assert.Equal(t, "slow", (<-slow).name)
+		assert.Same(t, manager.GetRedis("slow"), manager.GetRedis("slow"))
+	})
+
+	t.Run("Default manager", func(t *testing.T) {
+		defer DefaultManager.Close()
+		assert.Same(t, GetDatabase("sqlite-test"), GetDatabase("sqlite-test"))
+	})
+}
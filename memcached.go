@@ -0,0 +1,405 @@
+package datastore
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+var (
+	DefaultMemcachedTimeout      = 500 * time.Millisecond
+	DefaultMemcachedMaxIdleConns = 16
+	// DefaultMemcachedVirtualNodes is the number of points of each server on the consistent hashing ring
+	DefaultMemcachedVirtualNodes = 160
+	// DefaultMemcachedCASRetries is the number of times Update retries after a compare-and-swap conflict
+	DefaultMemcachedCASRetries = 10
+)
+
+func init() {
+	envMillis("GOTH_DEFAULT_MEMCACHED_TIMEOUT", &DefaultMemcachedTimeout)
+	envInt("GOTH_DEFAULT_MEMCACHED_MAX_IDLE_CONNS", &DefaultMemcachedMaxIdleConns)
+	envInt("GOTH_DEFAULT_MEMCACHED_VIRTUAL_NODES", &DefaultMemcachedVirtualNodes)
+	envInt("GOTH_DEFAULT_MEMCACHED_CAS_RETRIES", &DefaultMemcachedCASRetries)
+}
+
+// Errors returned by memcached operators, shared with the mock.
+var (
+	ErrMemcachedCacheMiss   = memcache.ErrCacheMiss
+	ErrMemcachedCASConflict = memcache.ErrCASConflict
+	ErrMemcachedNotStored   = memcache.ErrNotStored
+)
+
+// MemcachedItem is a stored value with its flags, expiration in seconds and compare-and-swap token.
+type MemcachedItem struct {
+	Key   string
+	Value []byte
+	Flags uint32
+	TTL   int32
+	// CAS is set by Gets and must be kept for CompareAndSwap
+	CAS uint64
+}
+
+// Memcached represents a memcached tier with a master operator for writes and a slave operator for reads.
+type Memcached struct {
+	name    string
+	profile secret.Memcached
+	master  MemcachedOperator
+	slave   MemcachedOperator
+}
+
+// Profile returns the loaded secret profile.
+func (m *Memcached) Profile() secret.Memcached {
+	return m.profile
+}
+
+// Master returns the MemcachedOperator for writes.
+func (m *Memcached) Master() MemcachedOperator {
+	return m.master
+}
+
+// Slave returns the MemcachedOperator for reads.
+func (m *Memcached) Slave() MemcachedOperator {
+	return m.slave
+}
+
+// Name returns "memcached/<profile>".
+func (m *Memcached) Name() string {
+	return "memcached/" + m.name
+}
+
+// Ping checks every server of the master is reachable.
+func (m *Memcached) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return m.master.Ping()
+}
+
+// Stats returns no metrics, the memcache client keeps no counters.
+func (m *Memcached) Stats() DataStoreStats {
+	return DataStoreStats{}
+}
+
+// Close closes the idle connections of both operators.
+func (m *Memcached) Close() error {
+	var errs []error
+	for _, op := range []MemcachedOperator{m.master, m.slave} {
+		if op != nil {
+			errs = append(errs, op.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MemcachedOp represents operations on a set of memcached servers, keys are placed by a MemcachedRing.
+type MemcachedOp struct {
+	meta   secret.MemcachedMeta
+	ring   *MemcachedRing
+	client *memcache.Client
+}
+
+// Meta returns the connection metadata of the operator.
+func (o *MemcachedOp) Meta() secret.MemcachedMeta {
+	return o.meta
+}
+
+// Client returns the underlying gomemcache client.
+func (o *MemcachedOp) Client() *memcache.Client {
+	return o.client
+}
+
+// Ring returns the server selector, servers can be changed at runtime with SetServers.
+func (o *MemcachedOp) Ring() *MemcachedRing {
+	return o.ring
+}
+
+// Ping checks every server is reachable.
+func (o *MemcachedOp) Ping() error {
+	return o.client.Ping()
+}
+
+// Close closes the idle connections.
+func (o *MemcachedOp) Close() error {
+	return o.client.Close()
+}
+
+// Get returns the value of key, ErrMemcachedCacheMiss if it is not stored.
+func (o *MemcachedOp) Get(key string) ([]byte, error) {
+	item, err := o.client.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return item.Value, nil
+}
+
+// GetMulti returns the values of the stored keys, missing keys are absent from the map.
+func (o *MemcachedOp) GetMulti(keys []string) (map[string][]byte, error) {
+	items, err := o.client.GetMulti(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(items))
+	for key, item := range items {
+		values[key] = item.Value
+	}
+
+	return values, nil
+}
+
+// Gets returns the item of key with its compare-and-swap token, ErrMemcachedCacheMiss if it is not stored.
+func (o *MemcachedOp) Gets(key string) (*MemcachedItem, error) {
+	item, err := o.client.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemcachedItem{Key: item.Key, Value: item.Value, Flags: item.Flags, TTL: item.Expiration, CAS: item.CasID}, nil
+}
+
+// Set stores value under key for ttl seconds, 0 never expires.
+func (o *MemcachedOp) Set(key string, value []byte, ttl int32) error {
+	return o.client.Set(&memcache.Item{Key: key, Value: value, Expiration: ttl})
+}
+
+// Add stores value under key only if it is not stored, ErrMemcachedNotStored otherwise.
+func (o *MemcachedOp) Add(key string, value []byte, ttl int32) error {
+	return o.client.Add(&memcache.Item{Key: key, Value: value, Expiration: ttl})
+}
+
+// Delete removes key, ErrMemcachedCacheMiss if it is not stored.
+func (o *MemcachedOp) Delete(key string) error {
+	return o.client.Delete(key)
+}
+
+// Touch resets the expiration of key to ttl seconds, ErrMemcachedCacheMiss if it is not stored.
+func (o *MemcachedOp) Touch(key string, ttl int32) error {
+	return o.client.Touch(key, ttl)
+}
+
+// Incr adds delta to the decimal value of key, ErrMemcachedCacheMiss if it is not stored.
+func (o *MemcachedOp) Incr(key string, delta uint64) (uint64, error) {
+	return o.client.Increment(key, delta)
+}
+
+// Decr subtracts delta from the decimal value of key down to 0, ErrMemcachedCacheMiss if it is not stored.
+func (o *MemcachedOp) Decr(key string, delta uint64) (uint64, error) {
+	return o.client.Decrement(key, delta)
+}
+
+// CompareAndSwap stores item if the value was not changed since Gets returned it,
+// ErrMemcachedCASConflict if it was and ErrMemcachedNotStored if it was deleted.
+func (o *MemcachedOp) CompareAndSwap(item *MemcachedItem) error {
+	return o.client.CompareAndSwap(&memcache.Item{Key: item.Key, Value: item.Value, Flags: item.Flags, Expiration: item.TTL, CasID: item.CAS})
+}
+
+// Update replaces the value of key with the result of fn using compare-and-swap, retrying up to
+// DefaultMemcachedCASRetries times on conflicts.
+func (o *MemcachedOp) Update(key string, ttl int32, fn func(old []byte) ([]byte, error)) error {
+	return memcachedUpdate(o, key, ttl, fn)
+}
+
+// memcachedUpdate implements Update with Gets, Add and CompareAndSwap of op, a missing key is added.
+func memcachedUpdate(op MemcachedOperator, key string, ttl int32, fn func(old []byte) ([]byte, error)) error {
+	for attempt := 0; ; attempt++ {
+		item, err := op.Gets(key)
+		switch {
+		case errors.Is(err, ErrMemcachedCacheMiss):
+			value, err := fn(nil)
+			if err != nil {
+				return err
+			}
+
+			err = op.Add(key, value, ttl)
+			if !errors.Is(err, ErrMemcachedNotStored) || attempt >= DefaultMemcachedCASRetries {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			value, err := fn(item.Value)
+			if err != nil {
+				return err
+			}
+
+			item.Value, item.TTL = value, ttl
+			err = op.CompareAndSwap(item)
+			if (!errors.Is(err, ErrMemcachedCASConflict) && !errors.Is(err, ErrMemcachedNotStored)) || attempt >= DefaultMemcachedCASRetries {
+				return err
+			}
+		}
+	}
+}
+
+// MemcachedRing is a memcache.ServerSelector placing keys on servers by ketama consistent hashing, so adding
+// or removing a server only moves the keys of its share of the ring.
+type MemcachedRing struct {
+	lock    sync.RWMutex
+	points  []uint32
+	owners  map[uint32]net.Addr
+	addrs   []net.Addr
+	servers []string
+}
+
+// NewMemcachedRing returns a ring of servers, host:port addresses or unix socket paths.
+func NewMemcachedRing(servers ...string) (*MemcachedRing, error) {
+	ring := &MemcachedRing{}
+	if err := ring.SetServers(servers...); err != nil {
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// SetServers replaces the servers of the ring, nothing changes if one of them fails to resolve.
+func (r *MemcachedRing) SetServers(servers ...string) error {
+	addrs := make([]net.Addr, len(servers))
+	for idx, server := range servers {
+		var err error
+		if strings.Contains(server, "/") {
+			addrs[idx], err = net.ResolveUnixAddr("unix", server)
+		} else {
+			addrs[idx], err = net.ResolveTCPAddr("tcp", server)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	vnodes := max(DefaultMemcachedVirtualNodes/4, 1)
+	owners := make(map[uint32]net.Addr, len(servers)*vnodes*4)
+	points := make([]uint32, 0, len(servers)*vnodes*4)
+	for idx, server := range servers {
+		for vnode := 0; vnode < vnodes; vnode++ {
+			digest := md5.Sum([]byte(server + "-" + strconv.Itoa(vnode)))
+			for part := 0; part < 4; part++ {
+				point := binary.LittleEndian.Uint32(digest[part*4:])
+				if _, taken := owners[point]; taken {
+					continue
+				}
+
+				owners[point] = addrs[idx]
+				points = append(points, point)
+			}
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.points, r.owners, r.addrs, r.servers = points, owners, addrs, append([]string(nil), servers...)
+	return nil
+}
+
+// Servers returns the servers of the ring.
+func (r *MemcachedRing) Servers() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]string(nil), r.servers...)
+}
+
+// PickServer returns the server owning the first ring point at or after the hash of key.
+func (r *MemcachedRing) PickServer(key string) (net.Addr, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if len(r.points) == 0 {
+		return nil, memcache.ErrNoServers
+	}
+
+	digest := md5.Sum([]byte(key))
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	idx := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if idx == len(r.points) {
+		idx = 0
+	}
+
+	return r.owners[r.points[idx]], nil
+}
+
+// Each calls fn with every server.
+func (r *MemcachedRing) Each(fn func(net.Addr) error) error {
+	r.lock.RLock()
+	addrs := r.addrs
+	r.lock.RUnlock()
+	for _, addr := range addrs {
+		if err := fn(addr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newMemcachedOp(meta secret.MemcachedMeta, profile secret.Memcached) (*MemcachedOp, error) {
+	if len(meta.Servers) == 0 {
+		return nil, memcache.ErrNoServers
+	}
+
+	ring, err := NewMemcachedRing(meta.Servers...)
+	if err != nil {
+		return nil, err
+	}
+
+	client := memcache.NewFromSelector(ring)
+	client.Timeout = DefaultMemcachedTimeout
+	if profile.Timeout > 0 {
+		client.Timeout = time.Duration(profile.Timeout) * time.Millisecond
+	}
+
+	client.MaxIdleConns = DefaultMemcachedMaxIdleConns
+	if profile.MaxIdleConns > 0 {
+		client.MaxIdleConns = profile.MaxIdleConns
+	}
+
+	return &MemcachedOp{meta: meta, ring: ring, client: client}, nil
+}
+
+// NewMemcached creates a Memcached handler with the specified profile.
+// Returns nil if the profile name is empty, loading the profile fails or a server does not resolve.
+func NewMemcached(profileName string) *Memcached {
+	if profileName == "" {
+		kklogger.ErrorJ("datastore.NewMemcached#profileName", "profile name is empty")
+		return nil
+	}
+
+	profile := &secret.Memcached{}
+	if err := secret.Load("memcached", profileName, profile); err != nil {
+		kklogger.ErrorJ("datastore.NewMemcached#Load", err.Error())
+		return nil
+	}
+
+	profile.Normalize()
+	master, err := newMemcachedOp(profile.Master, *profile)
+	if err != nil {
+		kklogger.ErrorJ("datastore.NewMemcached#Master", err.Error())
+		return nil
+	}
+
+	slave, err := newMemcachedOp(profile.Slave, *profile)
+	if err != nil {
+		kklogger.ErrorJ("datastore.NewMemcached#Slave", err.Error())
+		return nil
+	}
+
+	return &Memcached{
+		name:    profileName,
+		profile: *profile,
+		master:  master,
+		slave:   slave,
+	}
+}
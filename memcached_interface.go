@@ -0,0 +1,44 @@
+package datastore
+
+import (
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// MemcachedOperator defines the interface for memcached operations.
+// This interface allows for both real and mock implementations.
+type MemcachedOperator interface {
+	// Connection management
+	Meta() secret.MemcachedMeta
+	Ping() error
+	Close() error
+
+	// Values
+	Get(key string) ([]byte, error)
+	GetMulti(keys []string) (map[string][]byte, error)
+	Set(key string, value []byte, ttl int32) error
+	Add(key string, value []byte, ttl int32) error
+	Delete(key string) error
+	Touch(key string, ttl int32) error
+	Incr(key string, delta uint64) (uint64, error)
+	Decr(key string, delta uint64) (uint64, error)
+
+	// Compare-and-swap
+	Gets(key string) (*MemcachedItem, error)
+	CompareAndSwap(item *MemcachedItem) error
+	Update(key string, ttl int32, fn func(old []byte) ([]byte, error)) error
+}
+
+// MemcachedProvider defines the interface for Memcached instances.
+// This allows both real and mock Memcached implementations.
+type MemcachedProvider interface {
+	Master() MemcachedOperator
+	Slave() MemcachedOperator
+	Profile() secret.Memcached
+}
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ MemcachedOperator = (*MemcachedOp)(nil)
+	_ MemcachedOperator = (*MockMemcachedOp)(nil)
+	_ MemcachedProvider = (*Memcached)(nil)
+)
@@ -0,0 +1,417 @@
+package datastore
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// MockMemcachedOp is a mock implementation of MemcachedOperator for testing.
+// Items are kept in an in-memory map with expirations and CAS tokens, and all operations are recorded.
+type MockMemcachedOp struct {
+	mutex sync.RWMutex
+
+	mockMeta    secret.MemcachedMeta
+	items       map[string]mockMemcachedItem
+	cas         uint64
+	callHistory []MockMemcachedCall
+	errors      map[string]error
+	closed      bool
+	chaos       *mockChaos
+	now         func() time.Time
+}
+
+type mockMemcachedItem struct {
+	value    []byte
+	flags    uint32
+	cas      uint64
+	expireAt time.Time
+}
+
+// MockMemcachedCall represents a recorded memcached operation call.
+type MockMemcachedCall struct {
+	Timestamp time.Time
+	Method    string
+	Keys      []string
+	Error     error
+}
+
+// NewMockMemcachedOp creates a new mock operator with no items.
+func NewMockMemcachedOp() *MockMemcachedOp {
+	return &MockMemcachedOp{
+		mockMeta:    secret.MemcachedMeta{Servers: []string{"127.0.0.1:11211"}},
+		items:       map[string]mockMemcachedItem{},
+		callHistory: make([]MockMemcachedCall, 0),
+		errors:      map[string]error{},
+		now:         time.Now,
+	}
+}
+
+// begin injects chaos, locks the mock and returns the error to fail method with, the caller unlocks.
+func (m *MockMemcachedOp) begin(method string) error {
+	chaosErr := m.injectChaos()
+	m.mutex.Lock()
+	if chaosErr != nil {
+		return chaosErr
+	}
+
+	return m.errors[method]
+}
+
+func (m *MockMemcachedOp) record(method string, keys []string, err error) {
+	m.callHistory = append(m.callHistory, MockMemcachedCall{Timestamp: time.Now(), Method: method, Keys: keys, Error: err})
+}
+
+// lookup returns the unexpired item of key, the caller holds the mutex.
+func (m *MockMemcachedOp) lookup(key string) (mockMemcachedItem, bool) {
+	item, ok := m.items[key]
+	if ok && !item.expireAt.IsZero() && !m.now().Before(item.expireAt) {
+		delete(m.items, key)
+		return item, false
+	}
+
+	return item, ok
+}
+
+// store saves value under key with a new CAS token, the caller holds the mutex.
+func (m *MockMemcachedOp) store(key string, value []byte, flags uint32, ttl int32) {
+	m.cas++
+	item := mockMemcachedItem{value: append([]byte(nil), value...), flags: flags, cas: m.cas}
+	if ttl > 0 {
+		item.expireAt = m.now().Add(time.Duration(ttl) * time.Second)
+	}
+
+	m.items[key] = item
+}
+
+// Meta returns the configured metadata.
+func (m *MockMemcachedOp) Meta() secret.MemcachedMeta {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.mockMeta
+}
+
+// Ping returns the error configured for "Ping" with SetError.
+func (m *MockMemcachedOp) Ping() error {
+	err := m.begin("Ping")
+	defer m.mutex.Unlock()
+	m.record("Ping", nil, err)
+	return err
+}
+
+// Close marks the mock closed.
+func (m *MockMemcachedOp) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	m.record("Close", nil, nil)
+	return nil
+}
+
+// Get returns a copy of the value of key, ErrMemcachedCacheMiss if it is not stored.
+func (m *MockMemcachedOp) Get(key string) ([]byte, error) {
+	err := m.begin("Get")
+	defer m.mutex.Unlock()
+	var value []byte
+	if err == nil {
+		if item, ok := m.lookup(key); ok {
+			value = append([]byte(nil), item.value...)
+		} else {
+			err = ErrMemcachedCacheMiss
+		}
+	}
+
+	m.record("Get", []string{key}, err)
+	return value, err
+}
+
+// GetMulti returns the values of the stored keys.
+func (m *MockMemcachedOp) GetMulti(keys []string) (map[string][]byte, error) {
+	err := m.begin("GetMulti")
+	defer m.mutex.Unlock()
+	var values map[string][]byte
+	if err == nil {
+		values = map[string][]byte{}
+		for _, key := range keys {
+			if item, ok := m.lookup(key); ok {
+				values[key] = append([]byte(nil), item.value...)
+			}
+		}
+	}
+
+	m.record("GetMulti", keys, err)
+	return values, err
+}
+
+// Gets returns the item of key with its CAS token, ErrMemcachedCacheMiss if it is not stored.
+func (m *MockMemcachedOp) Gets(key string) (*MemcachedItem, error) {
+	err := m.begin("Gets")
+	defer m.mutex.Unlock()
+	var result *MemcachedItem
+	if err == nil {
+		if item, ok := m.lookup(key); ok {
+			result = &MemcachedItem{Key: key, Value: append([]byte(nil), item.value...), Flags: item.flags, CAS: item.cas}
+		} else {
+			err = ErrMemcachedCacheMiss
+		}
+	}
+
+	m.record("Gets", []string{key}, err)
+	return result, err
+}
+
+// Set stores value under key for ttl seconds.
+func (m *MockMemcachedOp) Set(key string, value []byte, ttl int32) error {
+	err := m.begin("Set")
+	defer m.mutex.Unlock()
+	if err == nil {
+		m.store(key, value, 0, ttl)
+	}
+
+	m.record("Set", []string{key}, err)
+	return err
+}
+
+// Add stores value under key if it is not stored, ErrMemcachedNotStored otherwise.
+func (m *MockMemcachedOp) Add(key string, value []byte, ttl int32) error {
+	err := m.begin("Add")
+	defer m.mutex.Unlock()
+	if err == nil {
+		if _, ok := m.lookup(key); ok {
+			err = ErrMemcachedNotStored
+		} else {
+			m.store(key, value, 0, ttl)
+		}
+	}
+
+	m.record("Add", []string{key}, err)
+	return err
+}
+
+// Delete removes key, ErrMemcachedCacheMiss if it is not stored.
+func (m *MockMemcachedOp) Delete(key string) error {
+	err := m.begin("Delete")
+	defer m.mutex.Unlock()
+	if err == nil {
+		if _, ok := m.lookup(key); ok {
+			delete(m.items, key)
+		} else {
+			err = ErrMemcachedCacheMiss
+		}
+	}
+
+	m.record("Delete", []string{key}, err)
+	return err
+}
+
+// Touch resets the expiration of key, ErrMemcachedCacheMiss if it is not stored.
+func (m *MockMemcachedOp) Touch(key string, ttl int32) error {
+	err := m.begin("Touch")
+	defer m.mutex.Unlock()
+	if err == nil {
+		if item, ok := m.lookup(key); ok {
+			item.expireAt = time.Time{}
+			if ttl > 0 {
+				item.expireAt = m.now().Add(time.Duration(ttl) * time.Second)
+			}
+
+			m.items[key] = item
+		} else {
+			err = ErrMemcachedCacheMiss
+		}
+	}
+
+	m.record("Touch", []string{key}, err)
+	return err
+}
+
+// Incr adds delta to the decimal value of key.
+func (m *MockMemcachedOp) Incr(key string, delta uint64) (uint64, error) {
+	return m.incrDecr("Incr", key, func(value uint64) uint64 {
+		return value + delta
+	})
+}
+
+// Decr subtracts delta from the decimal value of key down to 0.
+func (m *MockMemcachedOp) Decr(key string, delta uint64) (uint64, error) {
+	return m.incrDecr("Decr", key, func(value uint64) uint64 {
+		if value < delta {
+			return 0
+		}
+
+		return value - delta
+	})
+}
+
+func (m *MockMemcachedOp) incrDecr(method, key string, fn func(uint64) uint64) (uint64, error) {
+	err := m.begin(method)
+	defer m.mutex.Unlock()
+	var result uint64
+	if err == nil {
+		item, ok := m.lookup(key)
+		if !ok {
+			err = ErrMemcachedCacheMiss
+		} else if value, parseErr := strconv.ParseUint(string(item.value), 10, 64); parseErr != nil {
+			err = ErrMemcachedNotStored
+		} else {
+			result = fn(value)
+			m.cas++
+			item.value, item.cas = []byte(strconv.FormatUint(result, 10)), m.cas
+			m.items[key] = item
+		}
+	}
+
+	m.record(method, []string{key}, err)
+	return result, err
+}
+
+// CompareAndSwap stores item if its CAS token is current, ErrMemcachedCASConflict if the value changed
+// and ErrMemcachedNotStored if it was deleted.
+func (m *MockMemcachedOp) CompareAndSwap(item *MemcachedItem) error {
+	err := m.begin("CompareAndSwap")
+	defer m.mutex.Unlock()
+	if err == nil {
+		current, ok := m.lookup(item.Key)
+		switch {
+		case !ok:
+			err = ErrMemcachedNotStored
+		case current.cas != item.CAS:
+			err = ErrMemcachedCASConflict
+		default:
+			m.store(item.Key, item.Value, item.Flags, item.TTL)
+		}
+	}
+
+	m.record("CompareAndSwap", []string{item.Key}, err)
+	return err
+}
+
+// Update replaces the value of key with the result of fn like MemcachedOp.Update.
+func (m *MockMemcachedOp) Update(key string, ttl int32, fn func(old []byte) ([]byte, error)) error {
+	return memcachedUpdate(m, key, ttl, fn)
+}
+
+// Mock configuration methods
+
+// SetMeta configures the metadata returned by Meta().
+func (m *MockMemcachedOp) SetMeta(meta secret.MemcachedMeta) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.mockMeta = meta
+}
+
+// SetError configures the named method, like "Get" or "Set", to fail with err, nil clears it.
+func (m *MockMemcachedOp) SetError(method string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err == nil {
+		delete(m.errors, method)
+	} else {
+		m.errors[method] = err
+	}
+}
+
+// SetNow replaces the clock used for expirations, so tests can expire items without sleeping.
+func (m *MockMemcachedOp) SetNow(now func() time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.now = now
+}
+
+// Keys returns the number of unexpired items.
+func (m *MockMemcachedOp) Keys() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	count := 0
+	for key := range m.items {
+		if _, ok := m.lookup(key); ok {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Reset removes all items and recorded calls.
+func (m *MockMemcachedOp) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.items = map[string]mockMemcachedItem{}
+	m.callHistory = make([]MockMemcachedCall, 0)
+}
+
+// IsClosed returns whether Close was called.
+func (m *MockMemcachedOp) IsClosed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.closed
+}
+
+// EnableChaos injects latency, random failures and outages into subsequent calls.
+func (m *MockMemcachedOp) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockMemcachedOp) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockMemcachedOp) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// Call tracking methods
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockMemcachedOp) GetCallHistory() []MockMemcachedCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockMemcachedCall(nil), m.callHistory...)
+}
+
+// GetCallsByMethod returns all calls for a specific method.
+func (m *MockMemcachedOp) GetCallsByMethod(method string) []MockMemcachedCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var filtered []MockMemcachedCall
+	for _, call := range m.callHistory {
+		if call.Method == method {
+			filtered = append(filtered, call)
+		}
+	}
+
+	return filtered
+}
+
+// NewMockMemcached creates a Memcached instance whose master and slave share one mock operator,
+// so written values can be read from the slave.
+func NewMockMemcached() *Memcached {
+	op := NewMockMemcachedOp()
+	return NewMockMemcachedWithOps(op, op)
+}
+
+// NewMockMemcachedWithOps creates a Memcached instance with custom mock operators.
+func NewMockMemcachedWithOps(master, slave *MockMemcachedOp) *Memcached {
+	return &Memcached{
+		name:    "mock-memcached",
+		profile: secret.Memcached{},
+		master:  master,
+		slave:   slave,
+	}
+}
@@ -0,0 +1,316 @@
+package datastore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// testMemcachedServer speaks enough of the memcached text protocol for MemcachedOp.
+func testMemcachedServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	var mutex sync.Mutex
+	type entry struct {
+		value []byte
+		flags string
+		cas   uint64
+	}
+
+	items := map[string]entry{}
+	var cas uint64
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+				for {
+					line, err := rw.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					fields := strings.Fields(line)
+					mutex.Lock()
+					switch fields[0] {
+					case "version":
+						rw.WriteString("VERSION 1.6.0\r\n")
+					case "get", "gets":
+						for _, key := range fields[1:] {
+							if item, ok := items[key]; ok {
+								fmt.Fprintf(rw, "VALUE %s %s %d %d\r\n%s\r\n", key, item.flags, len(item.value), item.cas, item.value)
+							}
+						}
+
+						rw.WriteString("END\r\n")
+					case "set", "add", "cas":
+						size, _ := strconv.Atoi(fields[4])
+						data := make([]byte, size+2)
+						io.ReadFull(rw, data)
+						current, exists := items[fields[1]]
+						switch {
+						case fields[0] == "add" && exists, fields[0] == "cas" && !exists:
+							rw.WriteString("NOT_STORED\r\n")
+						case fields[0] == "cas" && strconv.FormatUint(current.cas, 10) != fields[5]:
+							rw.WriteString("EXISTS\r\n")
+						default:
+							cas++
+							items[fields[1]] = entry{value: data[:size], flags: fields[2], cas: cas}
+							rw.WriteString("STORED\r\n")
+						}
+					case "delete", "touch":
+						if _, ok := items[fields[1]]; !ok {
+							rw.WriteString("NOT_FOUND\r\n")
+						} else if fields[0] == "delete" {
+							delete(items, fields[1])
+							rw.WriteString("DELETED\r\n")
+						} else {
+							rw.WriteString("TOUCHED\r\n")
+						}
+					case "incr":
+						item, ok := items[fields[1]]
+						if !ok {
+							rw.WriteString("NOT_FOUND\r\n")
+							break
+						}
+
+						value, _ := strconv.ParseUint(string(item.value), 10, 64)
+						delta, _ := strconv.ParseUint(fields[2], 10, 64)
+						item.value = []byte(strconv.FormatUint(value+delta, 10))
+						items[fields[1]] = item
+						fmt.Fprintf(rw, "%s\r\n", item.value)
+					default:
+						rw.WriteString("ERROR\r\n")
+					}
+
+					mutex.Unlock()
+					rw.Flush()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestMemcached(t *testing.T) {
+	t.Run("NewMemcached loads profile", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		assert.Nil(t, NewMemcached(""))
+		assert.Nil(t, NewMemcached("missing"))
+
+		mc := NewMemcached("test")
+		if assert.NotNil(t, mc) {
+			defer mc.Close()
+			assert.Equal(t, []string{"127.0.0.1:11211", "127.0.0.1:11212"}, mc.Slave().Meta().Servers)
+			assert.Equal(t, 200*time.Millisecond, mc.Master().(*MemcachedOp).Client().Timeout)
+			assert.Equal(t, DefaultMemcachedMaxIdleConns, mc.Master().(*MemcachedOp).Client().MaxIdleConns)
+		}
+	})
+
+	t.Run("Operations", func(t *testing.T) {
+		op, err := newMemcachedOp(secret.MemcachedMeta{Servers: []string{testMemcachedServer(t)}}, secret.Memcached{})
+		assert.NoError(t, err)
+		defer op.Close()
+
+		assert.NoError(t, op.Ping())
+		_, err = op.Get("missing")
+		assert.ErrorIs(t, err, ErrMemcachedCacheMiss)
+
+		assert.NoError(t, op.Set("a", []byte("1"), 60))
+		assert.ErrorIs(t, op.Add("a", []byte("2"), 60), ErrMemcachedNotStored)
+		value, err := op.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(value))
+
+		count, err := op.Incr("a", 4)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(5), count)
+
+		item, err := op.Gets("a")
+		assert.NoError(t, err)
+		assert.NotZero(t, item.CAS)
+		assert.NoError(t, op.Set("a", []byte("changed"), 0))
+		item.Value = []byte("stale")
+		assert.ErrorIs(t, op.CompareAndSwap(item), ErrMemcachedCASConflict)
+
+		assert.NoError(t, op.Update("a", 0, func(old []byte) ([]byte, error) {
+			return append(old, '!'), nil
+		}))
+		assert.NoError(t, op.Update("b", 0, func(old []byte) ([]byte, error) {
+			assert.Nil(t, old)
+			return []byte("new"), nil
+		}))
+
+		values, err := op.GetMulti([]string{"a", "b", "c"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"a": []byte("changed!"), "b": []byte("new")}, values)
+
+		assert.NoError(t, op.Touch("a", 10))
+		assert.NoError(t, op.Delete("a"))
+		assert.ErrorIs(t, op.Delete("a"), ErrMemcachedCacheMiss)
+		assert.ErrorIs(t, op.Touch("a", 10), ErrMemcachedCacheMiss)
+	})
+}
+
+func TestMemcachedRing(t *testing.T) {
+	servers := []string{"127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213"}
+	ring, err := NewMemcachedRing(servers...)
+	assert.NoError(t, err)
+	assert.Equal(t, servers, ring.Servers())
+
+	placement := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		addr, err := ring.PickServer(key)
+		assert.NoError(t, err)
+		placement[key] = addr.String()
+		counts[addr.String()]++
+	}
+
+	for _, server := range servers {
+		assert.Greater(t, counts[server], 600, server)
+	}
+
+	// Removing a server only moves its own keys
+	assert.NoError(t, ring.SetServers(servers[:2]...))
+	for key, server := range placement {
+		addr, _ := ring.PickServer(key)
+		if server != servers[2] {
+			assert.Equal(t, server, addr.String(), key)
+		}
+	}
+
+	var each []string
+	assert.NoError(t, ring.Each(func(addr net.Addr) error {
+		each = append(each, addr.String())
+		return nil
+	}))
+	assert.Equal(t, servers[:2], each)
+
+	assert.Error(t, ring.SetServers("not a host:port:x"))
+	assert.Equal(t, servers[:2], ring.Servers())
+
+	empty, err := NewMemcachedRing()
+	assert.NoError(t, err)
+	_, err = empty.PickServer("key")
+	assert.Error(t, err)
+}
+
+func TestMockMemcachedOp(t *testing.T) {
+	t.Run("Values and expiration", func(t *testing.T) {
+		mock := NewMockMemcachedOp()
+		now := time.Now()
+		mock.SetNow(func() time.Time {
+			return now
+		})
+
+		assert.NoError(t, mock.Set("a", []byte("1"), 10))
+		assert.NoError(t, mock.Set("b", []byte("2"), 0))
+		assert.ErrorIs(t, mock.Add("a", []byte("x"), 0), ErrMemcachedNotStored)
+		value, err := mock.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(value))
+
+		count, err := mock.Incr("a", 9)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(10), count)
+		count, err = mock.Decr("a", 20)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), count)
+
+		now = now.Add(11 * time.Second)
+		_, err = mock.Get("a")
+		assert.ErrorIs(t, err, ErrMemcachedCacheMiss)
+		assert.Equal(t, 1, mock.Keys())
+
+		assert.NoError(t, mock.Touch("b", 1))
+		now = now.Add(time.Second)
+		assert.ErrorIs(t, mock.Delete("b"), ErrMemcachedCacheMiss)
+		assert.Len(t, mock.GetCallsByMethod("Delete"), 1)
+	})
+
+	t.Run("Compare and swap", func(t *testing.T) {
+		mock := NewMockMemcachedOp()
+		assert.NoError(t, mock.Set("a", []byte("1"), 0))
+		item, err := mock.Gets("a")
+		assert.NoError(t, err)
+		stale := *item
+
+		item.Value = []byte("2")
+		assert.NoError(t, mock.CompareAndSwap(item))
+		assert.ErrorIs(t, mock.CompareAndSwap(&stale), ErrMemcachedCASConflict)
+		assert.NoError(t, mock.Delete("a"))
+		assert.ErrorIs(t, mock.CompareAndSwap(item), ErrMemcachedNotStored)
+
+		conflicts := 0
+		assert.NoError(t, mock.Update("counter", 0, func(old []byte) ([]byte, error) {
+			if conflicts < 2 {
+				conflicts++
+				assert.NoError(t, mock.Set("counter", []byte(strconv.Itoa(conflicts)), 0))
+			}
+
+			return append(old, '+'), nil
+		}))
+		value, _ := mock.Get("counter")
+		assert.Equal(t, "2+", string(value))
+
+		failed := errors.New("bad value")
+		assert.ErrorIs(t, mock.Update("counter", 0, func(old []byte) ([]byte, error) {
+			return nil, failed
+		}), failed)
+	})
+
+	t.Run("Errors, chaos and provider", func(t *testing.T) {
+		mock := NewMockMemcachedOp()
+		down := errors.New("down")
+		mock.SetError("Get", down)
+		_, err := mock.Get("a")
+		assert.ErrorIs(t, err, down)
+		mock.SetError("Get", nil)
+
+		mock.EnableChaos(MockChaosConfig{ErrorRate: 1})
+		assert.ErrorIs(t, mock.Set("a", nil, 0), ErrMockChaos)
+		mock.DisableChaos()
+		assert.NoError(t, mock.Ping())
+
+		mc := NewMockMemcached()
+		assert.NoError(t, mc.Master().Set("shared", []byte("1"), 0))
+		value, err := mc.Slave().Get("shared")
+		assert.NoError(t, err)
+		assert.Equal(t, "1", string(value))
+		assert.NoError(t, mc.Close())
+		assert.True(t, mc.Master().(*MockMemcachedOp).IsClosed())
+	})
+}
@@ -0,0 +1,123 @@
+package datastore
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrMockChaos is returned by mocks when a call is selected for failure by MockChaosConfig.ErrorRate.
+var ErrMockChaos = errors.New("mock: injected failure")
+
+// ErrMockOutage is returned by mocks for calls made during a MockChaosConfig outage window, it matches ErrDial.
+var ErrMockOutage error = &DataStoreError{Kind: ErrDial, Store: "mock", Err: errors.New("mock: simulated outage")}
+
+// MockLatencyFunc draws a latency from rng, used to inject delays into mock calls.
+type MockLatencyFunc func(rng *rand.Rand) time.Duration
+
+// MockUniformLatency returns latencies uniformly distributed in [min, max].
+func MockUniformLatency(min, max time.Duration) MockLatencyFunc {
+	return func(rng *rand.Rand) time.Duration {
+		if max <= min {
+			return min
+		}
+
+		return min + time.Duration(rng.Int63n(int64(max-min)+1))
+	}
+}
+
+// MockNormalLatency returns normally distributed latencies, negative draws are clamped to zero.
+func MockNormalLatency(mean, stddev time.Duration) MockLatencyFunc {
+	return func(rng *rand.Rand) time.Duration {
+		latency := time.Duration(rng.NormFloat64()*float64(stddev)) + mean
+		if latency < 0 {
+			return 0
+		}
+
+		return latency
+	}
+}
+
+// MockExponentialLatency returns exponentially distributed latencies, modelling a long tail.
+func MockExponentialLatency(mean time.Duration) MockLatencyFunc {
+	return func(rng *rand.Rand) time.Duration {
+		return time.Duration(rng.ExpFloat64() * float64(mean))
+	}
+}
+
+// MockOutage is a window, relative to when chaos was enabled, during which every call fails.
+type MockOutage struct {
+	Start    time.Duration
+	Duration time.Duration
+}
+
+// MockChaosConfig configures fault injection on mock operators.
+// Given the same Seed and call order, the same calls are delayed and fail, so resilience tests are repeatable.
+type MockChaosConfig struct {
+	Seed int64
+	// Latency draws the delay added to each call, nil means no delay
+	Latency MockLatencyFunc
+	// ErrorRate is the probability in [0, 1] that a call fails with Error
+	ErrorRate float64
+	// Error is returned for injected failures, ErrMockChaos if nil
+	Error error
+	// Outages are time windows in which every call fails with ErrMockOutage
+	Outages []MockOutage
+}
+
+// mockChaos evaluates a MockChaosConfig for each call.
+type mockChaos struct {
+	mutex  sync.Mutex
+	config MockChaosConfig
+	rng    *rand.Rand
+	start  time.Time
+	now    func() time.Time
+}
+
+func newMockChaos(config MockChaosConfig) *mockChaos {
+	if config.Error == nil {
+		config.Error = ErrMockChaos
+	}
+
+	return &mockChaos{
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		start:  time.Now(),
+		now:    time.Now,
+	}
+}
+
+// setNow replaces the time source, outages start from its current time.
+func (c *mockChaos) setNow(now func() time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.start, c.now = now(), now
+}
+
+// inject returns the delay to apply to the call and the error to fail it with, if any.
+func (c *mockChaos) inject() (time.Duration, error) {
+	if c == nil {
+		return 0, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elapsed := c.now().Sub(c.start)
+	for _, outage := range c.config.Outages {
+		if elapsed >= outage.Start && elapsed < outage.Start+outage.Duration {
+			return 0, ErrMockOutage
+		}
+	}
+
+	var delay time.Duration
+	if c.config.Latency != nil {
+		delay = c.config.Latency(c.rng)
+	}
+
+	if c.config.ErrorRate > 0 && c.rng.Float64() < c.config.ErrorRate {
+		return delay, c.config.Error
+	}
+
+	return delay, nil
+}
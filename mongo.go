@@ -0,0 +1,488 @@
+package datastore
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+var (
+	DefaultMongoMaxPoolSize            = 100
+	DefaultMongoMinPoolSize            = 0
+	DefaultMongoMaxConnIdleTime        = 5 * time.Minute
+	DefaultMongoConnectTimeout         = 10 * time.Second
+	DefaultMongoServerSelectionTimeout = 10 * time.Second
+)
+
+func init() {
+	envInt("GOTH_DEFAULT_MONGO_MAX_POOL_SIZE", &DefaultMongoMaxPoolSize)
+	envInt("GOTH_DEFAULT_MONGO_MIN_POOL_SIZE", &DefaultMongoMinPoolSize)
+	envMillis("GOTH_DEFAULT_MONGO_MAX_CONN_IDLE_TIME", &DefaultMongoMaxConnIdleTime)
+	envMillis("GOTH_DEFAULT_MONGO_CONNECT_TIMEOUT", &DefaultMongoConnectTimeout)
+	envMillis("GOTH_DEFAULT_MONGO_SERVER_SELECTION_TIMEOUT", &DefaultMongoServerSelectionTimeout)
+}
+
+// ErrMongoClientUnavailable is returned when the operator can not create its client.
+var ErrMongoClientUnavailable = errors.New("mongo client not available")
+
+// Mongo represents a MongoDB deployment with a primary operator for writes and a secondary operator for reads.
+type Mongo struct {
+	name      string
+	profile   secret.Mongo
+	primary   MongoOperator
+	secondary MongoOperator
+}
+
+// Profile returns the loaded secret profile.
+func (m *Mongo) Profile() secret.Mongo {
+	return m.profile
+}
+
+// Primary returns the MongoOperator reading from and writing to the primary.
+func (m *Mongo) Primary() MongoOperator {
+	return m.primary
+}
+
+// Secondary returns the MongoOperator for reads, using the read preference of the secondary profile.
+func (m *Mongo) Secondary() MongoOperator {
+	return m.secondary
+}
+
+// Name returns "mongo/<profile>".
+func (m *Mongo) Name() string {
+	return "mongo/" + m.name
+}
+
+// Ping pings the primary.
+func (m *Mongo) Ping(ctx context.Context) error {
+	if m.primary == nil {
+		return ErrMongoClientUnavailable
+	}
+
+	return m.primary.Ping(ctx)
+}
+
+// Stats returns the command and connection counters of the primary and secondary operators.
+func (m *Mongo) Stats() DataStoreStats {
+	stats := DataStoreStats{}
+	for prefix, op := range map[string]MongoOperator{"primary": m.primary, "secondary": m.secondary} {
+		if op == nil {
+			continue
+		}
+
+		mongoStats := op.Stats()
+		stats[prefix+".commands"] = float64(mongoStats.Commands)
+		stats[prefix+".failures"] = float64(mongoStats.Failures)
+		stats[prefix+".avg_latency"] = float64(mongoStats.AvgLatency().Milliseconds())
+		stats[prefix+".max_latency"] = float64(mongoStats.MaxLatency.Milliseconds())
+		stats[prefix+".open_conns"] = float64(mongoStats.OpenConnections)
+		stats[prefix+".in_use_conns"] = float64(mongoStats.InUseConnections)
+	}
+
+	return stats
+}
+
+// Close disconnects both operators.
+func (m *Mongo) Close() error {
+	var errs []error
+	for _, op := range []MongoOperator{m.primary, m.secondary} {
+		if op != nil {
+			errs = append(errs, op.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// MongoStats are the command and connection counters of a MongoOp.
+type MongoStats struct {
+	Commands     int64
+	Failures     int64
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+	// OpenConnections and InUseConnections describe the driver connection pools of all servers
+	OpenConnections  int64
+	InUseConnections int64
+}
+
+// AvgLatency returns the mean command latency, 0 without commands.
+func (s MongoStats) AvgLatency() time.Duration {
+	if s.Commands == 0 {
+		return 0
+	}
+
+	return s.TotalLatency / time.Duration(s.Commands)
+}
+
+// MongoOp represents operations for a MongoDB connection pool, created lazily with the official driver.
+type MongoOp struct {
+	meta    secret.MongoMeta
+	options *options.ClientOptions
+	client  *mongo.Client
+	opLock  sync.Mutex
+
+	statsLock sync.Mutex
+	stats     MongoStats
+}
+
+// Meta returns the connection metadata of the operator.
+func (o *MongoOp) Meta() secret.MongoMeta {
+	return o.meta
+}
+
+// Options returns the driver client options, changes apply to clients created afterwards.
+func (o *MongoOp) Options() *options.ClientOptions {
+	return o.options
+}
+
+// DatabaseName returns the database of the profile used by the collection helpers.
+func (o *MongoOp) DatabaseName() string {
+	return o.meta.Database
+}
+
+// Client returns the driver client, connecting it on first use.
+func (o *MongoOp) Client(ctx context.Context) (*mongo.Client, error) {
+	o.opLock.Lock()
+	defer o.opLock.Unlock()
+	if o.client != nil {
+		return o.client, nil
+	}
+
+	client, err := mongo.Connect(ctx, o.options)
+	if err != nil {
+		kklogger.ErrorJ("datastore:MongoOp.Client", err.Error())
+		return nil, fmt.Errorf("%w: %w", ErrMongoClientUnavailable, err)
+	}
+
+	o.client = client
+	return client, nil
+}
+
+// Collection returns the named collection of the profile database.
+func (o *MongoOp) Collection(ctx context.Context, name string) (*mongo.Collection, error) {
+	client, err := o.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Database(o.meta.Database).Collection(name), nil
+}
+
+// Ping verifies a server matching the read preference is reachable.
+func (o *MongoOp) Ping(ctx context.Context) error {
+	client, err := o.Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	return client.Ping(ctx, o.options.ReadPreference)
+}
+
+// Stats returns the command and connection counters.
+func (o *MongoOp) Stats() MongoStats {
+	o.statsLock.Lock()
+	defer o.statsLock.Unlock()
+	return o.stats
+}
+
+// Close disconnects the client, the next call connects a new one.
+func (o *MongoOp) Close() error {
+	o.opLock.Lock()
+	defer o.opLock.Unlock()
+	if o.client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultMongoConnectTimeout)
+	defer cancel()
+	err := o.client.Disconnect(ctx)
+	o.client = nil
+	return err
+}
+
+// FindOne decodes the first document matching filter into dest, mongo.ErrNoDocuments without match.
+func (o *MongoOp) FindOne(ctx context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOneOptions) error {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return err
+	}
+
+	return coll.FindOne(ctx, filter, opts...).Decode(dest)
+}
+
+// Find decodes the documents matching filter into dest, a pointer to a slice.
+func (o *MongoOp) Find(ctx context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOptions) error {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+
+	return cursor.All(ctx, dest)
+}
+
+// InsertOne inserts document and returns its _id.
+func (o *MongoOp) InsertOne(ctx context.Context, collection string, document interface{}) (interface{}, error) {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := coll.InsertOne(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedID, nil
+}
+
+// InsertMany inserts documents and returns their _id in order.
+func (o *MongoOp) InsertMany(ctx context.Context, collection string, documents []interface{}) ([]interface{}, error) {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := coll.InsertMany(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.InsertedIDs, nil
+}
+
+// UpdateOne applies update to the first document matching filter.
+func (o *MongoOp) UpdateOne(ctx context.Context, collection string, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return coll.UpdateOne(ctx, filter, update, opts...)
+}
+
+// UpdateMany applies update to every document matching filter.
+func (o *MongoOp) UpdateMany(ctx context.Context, collection string, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return coll.UpdateMany(ctx, filter, update, opts...)
+}
+
+// DeleteOne deletes the first document matching filter and returns the number deleted.
+func (o *MongoOp) DeleteOne(ctx context.Context, collection string, filter interface{}) (int64, error) {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// DeleteMany deletes every document matching filter and returns the number deleted.
+func (o *MongoOp) DeleteMany(ctx context.Context, collection string, filter interface{}) (int64, error) {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := coll.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// CountDocuments returns the number of documents matching filter.
+func (o *MongoOp) CountDocuments(ctx context.Context, collection string, filter interface{}) (int64, error) {
+	coll, err := o.Collection(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+
+	return coll.CountDocuments(ctx, filter)
+}
+
+// MongoFindOne returns the first document of collection matching filter decoded as T.
+func MongoFindOne[T any](ctx context.Context, op MongoOperator, collection string, filter interface{}) (T, error) {
+	var document T
+	err := op.FindOne(ctx, collection, filter, &document)
+	return document, err
+}
+
+// MongoFind returns the documents of collection matching filter decoded as T.
+func MongoFind[T any](ctx context.Context, op MongoOperator, collection string, filter interface{}, opts ...*options.FindOptions) ([]T, error) {
+	documents := []T{}
+	if err := op.Find(ctx, collection, filter, &documents, opts...); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+func (o *MongoOp) recordCommand(duration time.Duration, failed bool) {
+	o.statsLock.Lock()
+	defer o.statsLock.Unlock()
+	o.stats.Commands++
+	if failed {
+		o.stats.Failures++
+	}
+
+	o.stats.TotalLatency += duration
+	if duration > o.stats.MaxLatency {
+		o.stats.MaxLatency = duration
+	}
+}
+
+func (o *MongoOp) recordPoolEvent(evt *event.PoolEvent) {
+	o.statsLock.Lock()
+	defer o.statsLock.Unlock()
+	switch evt.Type {
+	case event.ConnectionCreated:
+		o.stats.OpenConnections++
+	case event.ConnectionClosed:
+		o.stats.OpenConnections--
+	case event.GetSucceeded:
+		o.stats.InUseConnections++
+	case event.ConnectionReturned:
+		o.stats.InUseConnections--
+	}
+}
+
+// buildMongoClientOptions converts the profile into driver options, monitored by op.
+func buildMongoClientOptions(meta secret.MongoMeta, op *MongoOp) (*options.ClientOptions, error) {
+	opts := options.Client()
+	if meta.URI != "" {
+		opts.ApplyURI(meta.URI)
+	} else {
+		opts.SetHosts(meta.Hosts)
+		if meta.Username != "" {
+			opts.SetAuth(options.Credential{Username: meta.Username, Password: meta.Password, AuthSource: meta.AuthSource})
+		}
+
+		if meta.ReplicaSet != "" {
+			opts.SetReplicaSet(meta.ReplicaSet)
+		}
+	}
+
+	if meta.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(meta.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+
+		preference, err := readpref.New(mode)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.SetReadPreference(preference)
+	}
+
+	if opts.ReadPreference == nil {
+		opts.SetReadPreference(readpref.Primary())
+	}
+
+	if meta.TLS || meta.CAFile != "" {
+		config := &tls.Config{MinVersion: tls.VersionTLS12}
+		if meta.CAFile != "" {
+			ca, err := readTLSPEM("", meta.CAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			config.RootCAs = x509.NewCertPool()
+			if !config.RootCAs.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("mongo: no certificate found in %s", meta.CAFile)
+			}
+		}
+
+		opts.SetTLSConfig(config)
+	}
+
+	opts.SetMaxPoolSize(uint64(DefaultMongoMaxPoolSize)).
+		SetMinPoolSize(uint64(DefaultMongoMinPoolSize)).
+		SetMaxConnIdleTime(DefaultMongoMaxConnIdleTime).
+		SetConnectTimeout(DefaultMongoConnectTimeout).
+		SetServerSelectionTimeout(DefaultMongoServerSelectionTimeout).
+		SetMonitor(&event.CommandMonitor{
+			Succeeded: func(_ context.Context, evt *event.CommandSucceededEvent) {
+				op.recordCommand(evt.Duration, false)
+			},
+			Failed: func(_ context.Context, evt *event.CommandFailedEvent) {
+				op.recordCommand(evt.Duration, true)
+			},
+		}).
+		SetPoolMonitor(&event.PoolMonitor{Event: op.recordPoolEvent})
+
+	return opts, opts.Validate()
+}
+
+func newMongoOp(meta secret.MongoMeta) (*MongoOp, error) {
+	op := &MongoOp{meta: meta}
+	opts, err := buildMongoClientOptions(meta, op)
+	if err != nil {
+		return nil, err
+	}
+
+	op.options = opts
+	return op, nil
+}
+
+// NewMongo creates a Mongo handler with the specified profile.
+// Returns nil if the profile name is empty or if loading the profile fails.
+func NewMongo(profileName string) *Mongo {
+	if profileName == "" {
+		kklogger.ErrorJ("datastore.NewMongo#profileName", "profile name is empty")
+		return nil
+	}
+
+	profile := &secret.Mongo{}
+	if err := secret.Load("mongo", profileName, profile); err != nil {
+		kklogger.ErrorJ("datastore.NewMongo#Load", err.Error())
+		return nil
+	}
+
+	profile.Normalize()
+	primary, err := newMongoOp(profile.Primary)
+	if err != nil {
+		kklogger.ErrorJ("datastore.NewMongo#Primary", err.Error())
+		return nil
+	}
+
+	secondary, err := newMongoOp(profile.Secondary)
+	if err != nil {
+		kklogger.ErrorJ("datastore.NewMongo#Secondary", err.Error())
+		return nil
+	}
+
+	return &Mongo{
+		name:      profileName,
+		profile:   *profile,
+		primary:   primary,
+		secondary: secondary,
+	}
+}
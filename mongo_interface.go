@@ -0,0 +1,50 @@
+package datastore
+
+import (
+	"context"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoOperator defines the interface for MongoDB operations.
+// This interface allows for both real and mock implementations.
+type MongoOperator interface {
+	// Client management
+	Client(ctx context.Context) (*mongo.Client, error)
+	Collection(ctx context.Context, name string) (*mongo.Collection, error)
+	Ping(ctx context.Context) error
+	Stats() MongoStats
+	Close() error
+
+	// Documents
+	FindOne(ctx context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOneOptions) error
+	Find(ctx context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOptions) error
+	InsertOne(ctx context.Context, collection string, document interface{}) (interface{}, error)
+	InsertMany(ctx context.Context, collection string, documents []interface{}) ([]interface{}, error)
+	UpdateOne(ctx context.Context, collection string, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, collection string, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, collection string, filter interface{}) (int64, error)
+	DeleteMany(ctx context.Context, collection string, filter interface{}) (int64, error)
+	CountDocuments(ctx context.Context, collection string, filter interface{}) (int64, error)
+
+	// Configuration access
+	DatabaseName() string
+	Meta() secret.MongoMeta
+}
+
+// MongoProvider defines the interface for Mongo instances.
+// This allows both real and mock Mongo implementations.
+type MongoProvider interface {
+	Primary() MongoOperator
+	Secondary() MongoOperator
+	Profile() secret.Mongo
+}
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ MongoOperator = (*MongoOp)(nil)
+	_ MongoOperator = (*MockMongoOp)(nil)
+	_ MongoProvider = (*Mongo)(nil)
+)
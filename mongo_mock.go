@@ -0,0 +1,412 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MockMongoOp is a mock implementation of MongoOperator for testing.
+// It provides configurable responses and tracks all operations for test verification.
+type MockMongoOp struct {
+	mutex sync.RWMutex
+
+	// Mock configuration
+	mockMeta  secret.MongoMeta
+	mockStats MongoStats
+
+	// Call tracking
+	callHistory []MockMongoCall
+
+	// Response configuration
+	findDocuments []interface{}
+	findError     error
+	writeError    error
+	pingError     error
+	affected      int64
+	closed        bool
+	chaos         *mockChaos
+}
+
+// MockMongoCall represents a recorded Mongo operation call.
+type MockMongoCall struct {
+	Timestamp  time.Time
+	Method     string
+	Collection string
+	Args       []interface{}
+	Result     interface{}
+	Error      error
+}
+
+// NewMockMongoOp creates a new mock Mongo operator with default settings.
+func NewMockMongoOp() *MockMongoOp {
+	return &MockMongoOp{
+		mockMeta:    secret.MongoMeta{Hosts: []string{"127.0.0.1:27017"}, Database: "test_database"},
+		callHistory: make([]MockMongoCall, 0),
+		affected:    1,
+	}
+}
+
+// record appends a call and updates the mock stats, the caller holds the mutex.
+func (m *MockMongoOp) record(method, collection string, args []interface{}, result interface{}, err error) {
+	m.callHistory = append(m.callHistory, MockMongoCall{
+		Timestamp:  time.Now(),
+		Method:     method,
+		Collection: collection,
+		Args:       args,
+		Result:     result,
+		Error:      err,
+	})
+
+	m.mockStats.Commands++
+	if err != nil {
+		m.mockStats.Failures++
+	}
+}
+
+// begin injects chaos and locks the mock, returning the error to fail the call with.
+func (m *MockMongoOp) begin(configured error) error {
+	chaosErr := m.injectChaos()
+	m.mutex.Lock()
+	if chaosErr != nil {
+		return chaosErr
+	}
+
+	return configured
+}
+
+// Client returns an error, the mock has no driver client.
+func (m *MockMongoOp) Client(ctx context.Context) (*mongo.Client, error) {
+	return nil, fmt.Errorf("%w: mock operator", ErrMongoClientUnavailable)
+}
+
+// Collection returns an error, the mock has no driver client.
+func (m *MockMongoOp) Collection(ctx context.Context, name string) (*mongo.Collection, error) {
+	return nil, fmt.Errorf("%w: mock operator", ErrMongoClientUnavailable)
+}
+
+// Ping returns the error configured with SetPingError.
+func (m *MockMongoOp) Ping(ctx context.Context) error {
+	err := m.begin(m.getPingError())
+	defer m.mutex.Unlock()
+	m.record("Ping", "", nil, nil, err)
+	return err
+}
+
+func (m *MockMongoOp) getPingError() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.pingError
+}
+
+// Stats returns the number of recorded calls and failures.
+func (m *MockMongoOp) Stats() MongoStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.mockStats
+}
+
+// Close marks the mock closed.
+func (m *MockMongoOp) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	m.callHistory = append(m.callHistory, MockMongoCall{Timestamp: time.Now(), Method: "Close"})
+	return nil
+}
+
+// FindOne decodes the first document configured with SetFindResponse into dest, mongo.ErrNoDocuments without one.
+func (m *MockMongoOp) FindOne(ctx context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOneOptions) error {
+	err := m.begin(m.getFindError())
+	defer m.mutex.Unlock()
+	if err == nil {
+		if len(m.findDocuments) == 0 {
+			err = mongo.ErrNoDocuments
+		} else {
+			err = mongoMockDecode(m.findDocuments[0], dest)
+		}
+	}
+
+	m.record("FindOne", collection, []interface{}{filter}, dest, err)
+	return err
+}
+
+// Find decodes the documents configured with SetFindResponse into dest, a pointer to a slice.
+func (m *MockMongoOp) Find(ctx context.Context, collection string, filter interface{}, dest interface{}, opts ...*options.FindOptions) error {
+	err := m.begin(m.getFindError())
+	defer m.mutex.Unlock()
+	if err == nil {
+		err = mongoMockDecodeAll(m.findDocuments, dest)
+	}
+
+	m.record("Find", collection, []interface{}{filter}, dest, err)
+	return err
+}
+
+// InsertOne records the document and returns a new ObjectID, or the error configured with SetWriteError.
+func (m *MockMongoOp) InsertOne(ctx context.Context, collection string, document interface{}) (interface{}, error) {
+	err := m.begin(m.getWriteError())
+	defer m.mutex.Unlock()
+	var id interface{}
+	if err == nil {
+		id = primitive.NewObjectID()
+	}
+
+	m.record("InsertOne", collection, []interface{}{document}, id, err)
+	return id, err
+}
+
+// InsertMany records the documents and returns a new ObjectID for each.
+func (m *MockMongoOp) InsertMany(ctx context.Context, collection string, documents []interface{}) ([]interface{}, error) {
+	err := m.begin(m.getWriteError())
+	defer m.mutex.Unlock()
+	var ids []interface{}
+	if err == nil {
+		for range documents {
+			ids = append(ids, primitive.NewObjectID())
+		}
+	}
+
+	m.record("InsertMany", collection, documents, ids, err)
+	return ids, err
+}
+
+// UpdateOne records the update and reports the count configured with SetAffectedCount as matched and modified.
+func (m *MockMongoOp) UpdateOne(ctx context.Context, collection string, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return m.update("UpdateOne", collection, filter, update)
+}
+
+// UpdateMany records the update like UpdateOne.
+func (m *MockMongoOp) UpdateMany(ctx context.Context, collection string, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return m.update("UpdateMany", collection, filter, update)
+}
+
+func (m *MockMongoOp) update(method, collection string, filter, update interface{}) (*mongo.UpdateResult, error) {
+	err := m.begin(m.getWriteError())
+	defer m.mutex.Unlock()
+	var result *mongo.UpdateResult
+	if err == nil {
+		result = &mongo.UpdateResult{MatchedCount: m.affected, ModifiedCount: m.affected}
+	}
+
+	m.record(method, collection, []interface{}{filter, update}, result, err)
+	return result, err
+}
+
+// DeleteOne records the filter and returns the count configured with SetAffectedCount.
+func (m *MockMongoOp) DeleteOne(ctx context.Context, collection string, filter interface{}) (int64, error) {
+	return m.delete("DeleteOne", collection, filter)
+}
+
+// DeleteMany records the filter like DeleteOne.
+func (m *MockMongoOp) DeleteMany(ctx context.Context, collection string, filter interface{}) (int64, error) {
+	return m.delete("DeleteMany", collection, filter)
+}
+
+func (m *MockMongoOp) delete(method, collection string, filter interface{}) (int64, error) {
+	err := m.begin(m.getWriteError())
+	defer m.mutex.Unlock()
+	var deleted int64
+	if err == nil {
+		deleted = m.affected
+	}
+
+	m.record(method, collection, []interface{}{filter}, deleted, err)
+	return deleted, err
+}
+
+// CountDocuments returns the number of documents configured with SetFindResponse.
+func (m *MockMongoOp) CountDocuments(ctx context.Context, collection string, filter interface{}) (int64, error) {
+	err := m.begin(m.getFindError())
+	defer m.mutex.Unlock()
+	var count int64
+	if err == nil {
+		count = int64(len(m.findDocuments))
+	}
+
+	m.record("CountDocuments", collection, []interface{}{filter}, count, err)
+	return count, err
+}
+
+// DatabaseName returns the database of the configured metadata.
+func (m *MockMongoOp) DatabaseName() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.mockMeta.Database
+}
+
+// Meta returns the configured metadata.
+func (m *MockMongoOp) Meta() secret.MongoMeta {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.mockMeta
+}
+
+func (m *MockMongoOp) getFindError() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.findError
+}
+
+func (m *MockMongoOp) getWriteError() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.writeError
+}
+
+// Mock configuration methods
+
+// SetMeta configures the metadata returned by Meta() and DatabaseName().
+func (m *MockMongoOp) SetMeta(meta secret.MongoMeta) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.mockMeta = meta
+}
+
+// SetFindResponse configures the documents and error of FindOne(), Find() and CountDocuments().
+// Documents are structs or maps, decoded into the destination through BSON like driver results.
+func (m *MockMongoOp) SetFindResponse(documents []interface{}, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.findDocuments = documents
+	m.findError = err
+}
+
+// SetWriteError configures the insert, update and delete methods to return an error.
+func (m *MockMongoOp) SetWriteError(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.writeError = err
+}
+
+// SetAffectedCount configures the matched, modified and deleted counts of updates and deletes, 1 by default.
+func (m *MockMongoOp) SetAffectedCount(count int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.affected = count
+}
+
+// SetPingError configures Ping() to return an error.
+func (m *MockMongoOp) SetPingError(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pingError = err
+}
+
+// EnableChaos injects latency, random failures and outages into subsequent calls.
+func (m *MockMongoOp) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockMongoOp) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockMongoOp) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// Call tracking methods
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockMongoOp) GetCallHistory() []MockMongoCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockMongoCall(nil), m.callHistory...)
+}
+
+// ClearCallHistory clears all recorded method calls.
+func (m *MockMongoOp) ClearCallHistory() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.callHistory = make([]MockMongoCall, 0)
+}
+
+// GetCallsByMethod returns all calls for a specific method.
+func (m *MockMongoOp) GetCallsByMethod(method string) []MockMongoCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var filtered []MockMongoCall
+	for _, call := range m.callHistory {
+		if call.Method == method {
+			filtered = append(filtered, call)
+		}
+	}
+
+	return filtered
+}
+
+// IsClosed returns whether Close was called.
+func (m *MockMongoOp) IsClosed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.closed
+}
+
+// NewMockMongo creates a Mongo instance with mock operators.
+func NewMockMongo() *Mongo {
+	return NewMockMongoWithOps(NewMockMongoOp(), NewMockMongoOp())
+}
+
+// NewMockMongoWithOps creates a Mongo instance with custom mock operators.
+func NewMockMongoWithOps(primary, secondary *MockMongoOp) *Mongo {
+	return &Mongo{
+		name:      "mock-mongo",
+		profile:   secret.Mongo{},
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+// mongoMockDecode copies src into dest through BSON, so mocked documents decode like driver results.
+func mongoMockDecode(src, dest interface{}) error {
+	data, err := bson.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(data, dest)
+}
+
+// mongoMockDecodeAll decodes every document into a new element of the slice dest points to.
+func mongoMockDecodeAll(documents []interface{}, dest interface{}) error {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("mongo: Find needs a pointer to a slice, got %T", dest)
+	}
+
+	slice = slice.Elem()
+	slice.SetLen(0)
+	for _, document := range documents {
+		elem := reflect.New(slice.Type().Elem())
+		if err := mongoMockDecode(document, elem.Interface()); err != nil {
+			return err
+		}
+
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type testMongoUser struct {
+	Name string `bson:"name"`
+	Age  int    `bson:"age"`
+}
+
+func TestMongo(t *testing.T) {
+	t.Run("Client options from profile", func(t *testing.T) {
+		op := &MongoOp{}
+		opts, err := buildMongoClientOptions(secret.MongoMeta{
+			Hosts:      []string{"127.0.0.1:27017", "127.0.0.2:27017"},
+			Username:   "user",
+			Password:   "pass",
+			AuthSource: "admin",
+			ReplicaSet: "rs0",
+		}, op)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"127.0.0.1:27017", "127.0.0.2:27017"}, opts.Hosts)
+		assert.Equal(t, "user", opts.Auth.Username)
+		assert.Equal(t, "admin", opts.Auth.AuthSource)
+		assert.Equal(t, "rs0", *opts.ReplicaSet)
+		assert.Equal(t, readpref.PrimaryMode, opts.ReadPreference.Mode())
+		assert.Equal(t, uint64(DefaultMongoMaxPoolSize), *opts.MaxPoolSize)
+		assert.Nil(t, opts.TLSConfig)
+
+		opts, err = buildMongoClientOptions(secret.MongoMeta{URI: "mongodb://127.0.0.1:27017/?replicaSet=rs1", ReadPreference: "secondaryPreferred"}, op)
+		assert.NoError(t, err)
+		assert.Equal(t, "rs1", *opts.ReplicaSet)
+		assert.Equal(t, readpref.SecondaryPreferredMode, opts.ReadPreference.Mode())
+
+		_, err = buildMongoClientOptions(secret.MongoMeta{Hosts: []string{"127.0.0.1:27017"}, ReadPreference: "anywhere"}, op)
+		assert.Error(t, err)
+
+		_, err = buildMongoClientOptions(secret.MongoMeta{Hosts: []string{"127.0.0.1:27017"}, CAFile: filepath.Join(t.TempDir(), "missing.pem")}, op)
+		assert.Error(t, err)
+
+		opts, err = buildMongoClientOptions(secret.MongoMeta{Hosts: []string{"127.0.0.1:27017"}, TLS: true}, op)
+		assert.NoError(t, err)
+		assert.NotNil(t, opts.TLSConfig)
+	})
+
+	t.Run("Secondary defaults to primary", func(t *testing.T) {
+		profile := secret.Mongo{Primary: secret.MongoMeta{Hosts: []string{"127.0.0.1:27017"}, Database: "app"}}
+		profile.Normalize()
+		assert.Equal(t, []string{"127.0.0.1:27017"}, profile.Secondary.Hosts)
+		assert.Equal(t, "app", profile.Secondary.Database)
+		assert.Equal(t, "secondaryPreferred", profile.Secondary.ReadPreference)
+		assert.Equal(t, "", profile.Primary.ReadPreference)
+
+		profile = secret.Mongo{
+			Primary:   secret.MongoMeta{Hosts: []string{"127.0.0.1:27017"}},
+			Secondary: secret.MongoMeta{Hosts: []string{"127.0.0.2:27017"}, ReadPreference: "nearest"},
+		}
+		profile.Normalize()
+		assert.Equal(t, []string{"127.0.0.2:27017"}, profile.Secondary.Hosts)
+		assert.Equal(t, "nearest", profile.Secondary.ReadPreference)
+	})
+
+	t.Run("NewMongo loads profile", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		assert.Nil(t, NewMongo(""))
+		assert.Nil(t, NewMongo("missing"))
+
+		mg := NewMongo("test")
+		if assert.NotNil(t, mg) {
+			defer mg.Close()
+			assert.Equal(t, "mongo", mg.Primary().DatabaseName())
+			assert.Equal(t, "secondaryPreferred", mg.Secondary().Meta().ReadPreference)
+			assert.Equal(t, readpref.SecondaryPreferredMode, mg.Secondary().(*MongoOp).Options().ReadPreference.Mode())
+		}
+	})
+
+	t.Run("Stats record commands and pool events", func(t *testing.T) {
+		op := &MongoOp{}
+		op.recordCommand(10*time.Millisecond, false)
+		op.recordCommand(30*time.Millisecond, true)
+		op.recordPoolEvent(&event.PoolEvent{Type: event.ConnectionCreated})
+		op.recordPoolEvent(&event.PoolEvent{Type: event.ConnectionCreated})
+		op.recordPoolEvent(&event.PoolEvent{Type: event.GetSucceeded})
+		op.recordPoolEvent(&event.PoolEvent{Type: event.ConnectionClosed})
+
+		stats := op.Stats()
+		assert.Equal(t, int64(2), stats.Commands)
+		assert.Equal(t, int64(1), stats.Failures)
+		assert.Equal(t, 30*time.Millisecond, stats.MaxLatency)
+		assert.Equal(t, 20*time.Millisecond, stats.AvgLatency())
+		assert.Equal(t, int64(1), stats.OpenConnections)
+		assert.Equal(t, int64(1), stats.InUseConnections)
+		assert.Equal(t, time.Duration(0), MongoStats{}.AvgLatency())
+	})
+}
+
+func TestMockMongoOp(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Find decodes configured documents", func(t *testing.T) {
+		mock := NewMockMongoOp()
+		var user testMongoUser
+		assert.ErrorIs(t, mock.FindOne(ctx, "users", bson.M{"name": "alice"}, &user), mongo.ErrNoDocuments)
+
+		mock.SetFindResponse([]interface{}{bson.M{"name": "alice", "age": 30}, testMongoUser{Name: "bob", Age: 40}}, nil)
+		assert.NoError(t, mock.FindOne(ctx, "users", bson.M{"name": "alice"}, &user))
+		assert.Equal(t, testMongoUser{Name: "alice", Age: 30}, user)
+
+		users, err := MongoFind[testMongoUser](ctx, mock, "users", bson.M{})
+		assert.NoError(t, err)
+		assert.Equal(t, []testMongoUser{{Name: "alice", Age: 30}, {Name: "bob", Age: 40}}, users)
+
+		first, err := MongoFindOne[testMongoUser](ctx, mock, "users", bson.M{})
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", first.Name)
+
+		count, err := mock.CountDocuments(ctx, "users", bson.M{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		calls := mock.GetCallsByMethod("FindOne")
+		assert.Len(t, calls, 3)
+		assert.Equal(t, "users", calls[0].Collection)
+		assert.Equal(t, bson.M{"name": "alice"}, calls[0].Args[0])
+
+		var notSlice testMongoUser
+		assert.Error(t, mock.Find(ctx, "users", bson.M{}, &notSlice))
+	})
+
+	t.Run("Writes", func(t *testing.T) {
+		mock := NewMockMongoOp()
+		id, err := mock.InsertOne(ctx, "users", testMongoUser{Name: "alice"})
+		assert.NoError(t, err)
+		assert.NotNil(t, id)
+
+		ids, err := mock.InsertMany(ctx, "users", []interface{}{testMongoUser{Name: "a"}, testMongoUser{Name: "b"}})
+		assert.NoError(t, err)
+		assert.Len(t, ids, 2)
+
+		mock.SetAffectedCount(3)
+		result, err := mock.UpdateMany(ctx, "users", bson.M{}, bson.M{"$set": bson.M{"age": 1}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), result.ModifiedCount)
+
+		deleted, err := mock.DeleteOne(ctx, "users", bson.M{"name": "alice"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), deleted)
+
+		writeErr := errors.New("duplicate key")
+		mock.SetWriteError(writeErr)
+		_, err = mock.InsertOne(ctx, "users", testMongoUser{Name: "alice"})
+		assert.ErrorIs(t, err, writeErr)
+		_, err = mock.UpdateOne(ctx, "users", bson.M{}, bson.M{})
+		assert.ErrorIs(t, err, writeErr)
+		_, err = mock.DeleteMany(ctx, "users", bson.M{})
+		assert.ErrorIs(t, err, writeErr)
+
+		stats := mock.Stats()
+		assert.Equal(t, int64(7), stats.Commands)
+		assert.Equal(t, int64(3), stats.Failures)
+	})
+
+	t.Run("Ping, client and chaos", func(t *testing.T) {
+		mock := NewMockMongoOp()
+		assert.NoError(t, mock.Ping(ctx))
+		mock.SetPingError(errors.New("down"))
+		assert.Error(t, mock.Ping(ctx))
+
+		_, err := mock.Collection(ctx, "users")
+		assert.ErrorIs(t, err, ErrMongoClientUnavailable)
+
+		mock.EnableChaos(MockChaosConfig{ErrorRate: 1})
+		_, err = mock.InsertOne(ctx, "users", testMongoUser{})
+		assert.Error(t, err)
+		mock.DisableChaos()
+		_, err = mock.InsertOne(ctx, "users", testMongoUser{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Mock Mongo", func(t *testing.T) {
+		primary, secondary := NewMockMongoOp(), NewMockMongoOp()
+		mg := NewMockMongoWithOps(primary, secondary)
+		assert.Same(t, primary, mg.Primary())
+		assert.Same(t, secondary, mg.Secondary())
+		assert.NoError(t, mg.Close())
+		assert.True(t, primary.IsClosed())
+		assert.True(t, secondary.IsClosed())
+		assert.Equal(t, "test_database", NewMockMongo().Primary().DatabaseName())
+	})
+}
@@ -0,0 +1,329 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+var (
+	// DefaultObjectStorePresignExpiry is the validity of presigned URLs requested without one
+	DefaultObjectStorePresignExpiry = 15 * time.Minute
+	// DefaultObjectStorePartSize is the multipart upload part size in bytes of streaming uploads
+	DefaultObjectStorePartSize = 16 << 20
+)
+
+func init() {
+	envMillis("GOTH_DEFAULT_OBJECT_STORE_PRESIGN_EXPIRY", &DefaultObjectStorePresignExpiry)
+	envInt("GOTH_DEFAULT_OBJECT_STORE_PART_SIZE", &DefaultObjectStorePartSize)
+}
+
+// ErrObjectNotFound is returned when the key does not exist in the bucket.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+// ObjectPutOptions are the optional attributes of uploaded objects.
+type ObjectPutOptions struct {
+	ContentType  string
+	CacheControl string
+	Metadata     map[string]string
+}
+
+// ObjectListOptions select the objects returned by List.
+type ObjectListOptions struct {
+	Prefix string
+	// Recursive lists every key under Prefix, otherwise keys are grouped by the next "/" like directories
+	Recursive  bool
+	StartAfter string
+	// MaxKeys limits the number of returned objects, 0 returns all
+	MaxKeys int
+}
+
+// ObjectStore represents an S3 compatible bucket.
+type ObjectStore struct {
+	name    string
+	profile secret.ObjectStore
+	op      ObjectStoreOperator
+}
+
+// Profile returns the loaded secret profile.
+func (s *ObjectStore) Profile() secret.ObjectStore {
+	return s.profile
+}
+
+// Operator returns the ObjectStoreOperator of the bucket.
+func (s *ObjectStore) Operator() ObjectStoreOperator {
+	return s.op
+}
+
+// Name returns "objectstore/<profile>".
+func (s *ObjectStore) Name() string {
+	return "objectstore/" + s.name
+}
+
+// Ping verifies the bucket exists and can be accessed.
+func (s *ObjectStore) Ping(ctx context.Context) error {
+	return s.op.Ping(ctx)
+}
+
+// Stats returns no metrics, the S3 client keeps no counters.
+func (s *ObjectStore) Stats() DataStoreStats {
+	return DataStoreStats{}
+}
+
+// Close does nothing, the S3 client holds no connections to release.
+func (s *ObjectStore) Close() error {
+	return nil
+}
+
+// ObjectStoreOp represents operations on a bucket with the minio S3 client.
+type ObjectStoreOp struct {
+	profile secret.ObjectStore
+	client  *minio.Client
+}
+
+// Client returns the underlying minio client.
+func (o *ObjectStoreOp) Client() *minio.Client {
+	return o.client
+}
+
+// Bucket returns the name of the bucket.
+func (o *ObjectStoreOp) Bucket() string {
+	return o.profile.Bucket
+}
+
+// Ping verifies the bucket exists and the credentials can access it.
+func (o *ObjectStoreOp) Ping(ctx context.Context) error {
+	exists, err := o.client.BucketExists(ctx, o.profile.Bucket)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("object store: bucket %s does not exist", o.profile.Bucket)
+	}
+
+	return nil
+}
+
+// Put uploads data to key, replacing an existing object.
+func (o *ObjectStoreOp) Put(ctx context.Context, key string, data []byte, opts *ObjectPutOptions) (ObjectInfo, error) {
+	return o.Upload(ctx, key, bytes.NewReader(data), int64(len(data)), opts)
+}
+
+// Upload streams reader to key, size is the number of bytes to read or -1 when unknown.
+// Objects larger than DefaultObjectStorePartSize are sent as multipart uploads.
+func (o *ObjectStoreOp) Upload(ctx context.Context, key string, reader io.Reader, size int64, opts *ObjectPutOptions) (ObjectInfo, error) {
+	putOpts := minio.PutObjectOptions{PartSize: uint64(DefaultObjectStorePartSize)}
+	if opts != nil {
+		putOpts.ContentType = opts.ContentType
+		putOpts.CacheControl = opts.CacheControl
+		putOpts.UserMetadata = opts.Metadata
+	}
+
+	info, err := o.client.PutObject(ctx, o.profile.Bucket, key, reader, size, putOpts)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{Key: info.Key, Size: info.Size, ETag: info.ETag, ContentType: putOpts.ContentType, LastModified: info.LastModified, Metadata: opts.metadata()}, nil
+}
+
+// Get returns the content of key, ErrObjectNotFound if it does not exist.
+func (o *ObjectStoreOp) Get(ctx context.Context, key string) ([]byte, error) {
+	reader, _, err := o.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	return data, objectStoreError(err)
+}
+
+// Download opens a stream of the content of key, the caller closes it. ErrObjectNotFound if it does not exist.
+func (o *ObjectStoreOp) Download(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	object, err := o.client.GetObject(ctx, o.profile.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, objectStoreError(err)
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, ObjectInfo{}, objectStoreError(err)
+	}
+
+	return object, newObjectInfo(info), nil
+}
+
+// Stat returns the attributes of key, ErrObjectNotFound if it does not exist.
+func (o *ObjectStoreOp) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := o.client.StatObject(ctx, o.profile.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, objectStoreError(err)
+	}
+
+	return newObjectInfo(info), nil
+}
+
+// Delete removes key, deleting a missing key succeeds.
+func (o *ObjectStoreOp) Delete(ctx context.Context, key string) error {
+	return o.client.RemoveObject(ctx, o.profile.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+// List returns the objects selected by opts in key order.
+func (o *ObjectStoreOp) List(ctx context.Context, opts ObjectListOptions) ([]ObjectInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var objects []ObjectInfo
+	for info := range o.client.ListObjects(ctx, o.profile.Bucket, minio.ListObjectsOptions{
+		Prefix:     opts.Prefix,
+		Recursive:  opts.Recursive,
+		StartAfter: opts.StartAfter,
+		MaxKeys:    opts.MaxKeys,
+	}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+
+		objects = append(objects, newObjectInfo(info))
+		if opts.MaxKeys > 0 && len(objects) == opts.MaxKeys {
+			break
+		}
+	}
+
+	return objects, nil
+}
+
+// PresignedGetURL returns a URL downloading key without credentials until expiry,
+// DefaultObjectStorePresignExpiry when expiry is 0.
+func (o *ObjectStoreOp) PresignedGetURL(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return o.client.PresignedGetObject(ctx, o.profile.Bucket, key, presignExpiry(expiry), nil)
+}
+
+// PresignedPutURL returns a URL uploading key with an HTTP PUT without credentials until expiry,
+// DefaultObjectStorePresignExpiry when expiry is 0.
+func (o *ObjectStoreOp) PresignedPutURL(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return o.client.PresignedPutObject(ctx, o.profile.Bucket, key, presignExpiry(expiry))
+}
+
+func presignExpiry(expiry time.Duration) time.Duration {
+	if expiry <= 0 {
+		return DefaultObjectStorePresignExpiry
+	}
+
+	return expiry
+}
+
+func (opts *ObjectPutOptions) metadata() map[string]string {
+	if opts == nil {
+		return nil
+	}
+
+	return opts.Metadata
+}
+
+func newObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	metadata := map[string]string{}
+	for key, value := range info.UserMetadata {
+		metadata[key] = value
+	}
+
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+		Metadata:     metadata,
+	}
+}
+
+// objectStoreError wraps missing key and bucket responses with ErrObjectNotFound.
+func objectStoreError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	response := minio.ToErrorResponse(err)
+	if response.Code == "NoSuchKey" || response.Code == "NoSuchBucket" || response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, err.Error())
+	}
+
+	return err
+}
+
+func newObjectStoreOp(profile secret.ObjectStore) (*ObjectStoreOp, error) {
+	lookup := minio.BucketLookupAuto
+	if profile.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(profile.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(profile.AccessKey, profile.SecretKey, profile.SessionToken),
+		Secure:       profile.UseSSL,
+		Region:       profile.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectStoreOp{profile: profile, client: client}, nil
+}
+
+// NewObjectStore creates an ObjectStore handler with the specified profile.
+// Returns nil if the profile name is empty, loading the profile fails or it has no bucket.
+func NewObjectStore(profileName string) *ObjectStore {
+	if profileName == "" {
+		kklogger.ErrorJ("datastore.NewObjectStore#profileName", "profile name is empty")
+		return nil
+	}
+
+	profile := &secret.ObjectStore{}
+	if err := secret.Load("objectstore", profileName, profile); err != nil {
+		kklogger.ErrorJ("datastore.NewObjectStore#Load", err.Error())
+		return nil
+	}
+
+	if profile.Bucket == "" {
+		kklogger.ErrorJ("datastore.NewObjectStore#Bucket", "bucket is empty")
+		return nil
+	}
+
+	op, err := newObjectStoreOp(*profile)
+	if err != nil {
+		kklogger.ErrorJ("datastore.NewObjectStore#Client", err.Error())
+		return nil
+	}
+
+	return &ObjectStore{
+		name:    profileName,
+		profile: *profile,
+		op:      op,
+	}
+}
@@ -0,0 +1,46 @@
+package datastore
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// ObjectStoreOperator defines the interface for object storage operations on a bucket.
+// This interface allows for both real and mock implementations.
+type ObjectStoreOperator interface {
+	Bucket() string
+	Ping(ctx context.Context) error
+
+	// Objects
+	Put(ctx context.Context, key string, data []byte, opts *ObjectPutOptions) (ObjectInfo, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context, opts ObjectListOptions) ([]ObjectInfo, error)
+
+	// Streaming
+	Upload(ctx context.Context, key string, reader io.Reader, size int64, opts *ObjectPutOptions) (ObjectInfo, error)
+	Download(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error)
+
+	// Presigned URLs
+	PresignedGetURL(ctx context.Context, key string, expiry time.Duration) (*url.URL, error)
+	PresignedPutURL(ctx context.Context, key string, expiry time.Duration) (*url.URL, error)
+}
+
+// ObjectStoreProvider defines the interface for ObjectStore instances.
+// This allows both real and mock ObjectStore implementations.
+type ObjectStoreProvider interface {
+	Operator() ObjectStoreOperator
+	Profile() secret.ObjectStore
+}
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ ObjectStoreOperator = (*ObjectStoreOp)(nil)
+	_ ObjectStoreOperator = (*MockObjectStoreOp)(nil)
+	_ ObjectStoreProvider = (*ObjectStore)(nil)
+)
@@ -0,0 +1,389 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// MockObjectStoreOp is a mock implementation of ObjectStoreOperator for testing.
+// Objects are kept in an in-memory map and all operations are recorded for test verification.
+type MockObjectStoreOp struct {
+	mutex sync.RWMutex
+
+	bucket      string
+	objects     map[string]mockObject
+	callHistory []MockObjectStoreCall
+	errors      map[string]error
+	chaos       *mockChaos
+}
+
+type mockObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// MockObjectStoreCall represents a recorded object store operation call.
+type MockObjectStoreCall struct {
+	Timestamp time.Time
+	Method    string
+	Key       string
+	Error     error
+}
+
+// NewMockObjectStoreOp creates a new mock operator with an empty bucket.
+func NewMockObjectStoreOp() *MockObjectStoreOp {
+	return &MockObjectStoreOp{
+		bucket:      "mock-bucket",
+		objects:     map[string]mockObject{},
+		callHistory: make([]MockObjectStoreCall, 0),
+		errors:      map[string]error{},
+	}
+}
+
+// begin injects chaos, locks the mock and returns the error to fail method with, the caller unlocks.
+func (m *MockObjectStoreOp) begin(method string) error {
+	chaosErr := m.injectChaos()
+	m.mutex.Lock()
+	if chaosErr != nil {
+		return chaosErr
+	}
+
+	return m.errors[method]
+}
+
+func (m *MockObjectStoreOp) record(method, key string, err error) {
+	m.callHistory = append(m.callHistory, MockObjectStoreCall{Timestamp: time.Now(), Method: method, Key: key, Error: err})
+}
+
+// Bucket returns the name of the mock bucket.
+func (m *MockObjectStoreOp) Bucket() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.bucket
+}
+
+// Ping returns the error configured for "Ping" with SetError.
+func (m *MockObjectStoreOp) Ping(ctx context.Context) error {
+	err := m.begin("Ping")
+	defer m.mutex.Unlock()
+	m.record("Ping", "", err)
+	return err
+}
+
+// Put stores a copy of data under key.
+func (m *MockObjectStoreOp) Put(ctx context.Context, key string, data []byte, opts *ObjectPutOptions) (ObjectInfo, error) {
+	err := m.begin("Put")
+	defer m.mutex.Unlock()
+	var info ObjectInfo
+	if err == nil {
+		info = m.store(key, data, opts)
+	}
+
+	m.record("Put", key, err)
+	return info, err
+}
+
+// Upload reads reader to the end, or size bytes when not -1, and stores the content under key.
+func (m *MockObjectStoreOp) Upload(ctx context.Context, key string, reader io.Reader, size int64, opts *ObjectPutOptions) (ObjectInfo, error) {
+	if size >= 0 {
+		reader = io.LimitReader(reader, size)
+	}
+
+	data, readErr := io.ReadAll(reader)
+	err := m.begin("Upload")
+	defer m.mutex.Unlock()
+	if err == nil {
+		err = readErr
+	}
+
+	var info ObjectInfo
+	if err == nil {
+		info = m.store(key, data, opts)
+	}
+
+	m.record("Upload", key, err)
+	return info, err
+}
+
+// store saves the object, the caller holds the mutex.
+func (m *MockObjectStoreOp) store(key string, data []byte, opts *ObjectPutOptions) ObjectInfo {
+	sum := md5.Sum(data)
+	info := ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		ETag:         hex.EncodeToString(sum[:]),
+		ContentType:  "application/octet-stream",
+		LastModified: time.Now(),
+	}
+
+	if opts != nil {
+		if opts.ContentType != "" {
+			info.ContentType = opts.ContentType
+		}
+
+		if len(opts.Metadata) > 0 {
+			info.Metadata = map[string]string{}
+			for name, value := range opts.Metadata {
+				info.Metadata[name] = value
+			}
+		}
+	}
+
+	m.objects[key] = mockObject{data: append([]byte(nil), data...), info: info}
+	return info
+}
+
+// Get returns a copy of the content of key, ErrObjectNotFound if it does not exist.
+func (m *MockObjectStoreOp) Get(ctx context.Context, key string) ([]byte, error) {
+	err := m.begin("Get")
+	defer m.mutex.Unlock()
+	var data []byte
+	if err == nil {
+		object, ok := m.objects[key]
+		if ok {
+			data = append([]byte(nil), object.data...)
+		} else {
+			err = m.notFound(key)
+		}
+	}
+
+	m.record("Get", key, err)
+	return data, err
+}
+
+// Download returns a reader of the content of key, ErrObjectNotFound if it does not exist.
+func (m *MockObjectStoreOp) Download(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	err := m.begin("Download")
+	defer m.mutex.Unlock()
+	var reader io.ReadCloser
+	var info ObjectInfo
+	if err == nil {
+		object, ok := m.objects[key]
+		if ok {
+			reader, info = io.NopCloser(bytes.NewReader(object.data)), object.info
+		} else {
+			err = m.notFound(key)
+		}
+	}
+
+	m.record("Download", key, err)
+	return reader, info, err
+}
+
+// Stat returns the attributes of key, ErrObjectNotFound if it does not exist.
+func (m *MockObjectStoreOp) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	err := m.begin("Stat")
+	defer m.mutex.Unlock()
+	var info ObjectInfo
+	if err == nil {
+		object, ok := m.objects[key]
+		if ok {
+			info = object.info
+		} else {
+			err = m.notFound(key)
+		}
+	}
+
+	m.record("Stat", key, err)
+	return info, err
+}
+
+// Delete removes key, deleting a missing key succeeds like on S3.
+func (m *MockObjectStoreOp) Delete(ctx context.Context, key string) error {
+	err := m.begin("Delete")
+	defer m.mutex.Unlock()
+	if err == nil {
+		delete(m.objects, key)
+	}
+
+	m.record("Delete", key, err)
+	return err
+}
+
+// List returns the objects selected by opts in key order, grouping keys by "/" when not recursive like S3.
+func (m *MockObjectStoreOp) List(ctx context.Context, opts ObjectListOptions) ([]ObjectInfo, error) {
+	err := m.begin("List")
+	defer m.mutex.Unlock()
+	m.record("List", opts.Prefix, err)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	var objects []ObjectInfo
+	prefixes := map[string]bool{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, opts.Prefix) || key <= opts.StartAfter {
+			continue
+		}
+
+		if !opts.Recursive {
+			if idx := strings.Index(key[len(opts.Prefix):], "/"); idx >= 0 {
+				prefix := key[:len(opts.Prefix)+idx+1]
+				if !prefixes[prefix] {
+					prefixes[prefix] = true
+					objects = append(objects, ObjectInfo{Key: prefix})
+				}
+
+				continue
+			}
+		}
+
+		objects = append(objects, m.objects[key].info)
+	}
+
+	if opts.MaxKeys > 0 && len(objects) > opts.MaxKeys {
+		objects = objects[:opts.MaxKeys]
+	}
+
+	return objects, nil
+}
+
+// PresignedGetURL returns a mock:// URL of key carrying the method and expiry.
+func (m *MockObjectStoreOp) PresignedGetURL(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return m.presign("PresignedGetURL", http.MethodGet, key, expiry)
+}
+
+// PresignedPutURL returns a mock:// URL of key carrying the method and expiry.
+func (m *MockObjectStoreOp) PresignedPutURL(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return m.presign("PresignedPutURL", http.MethodPut, key, expiry)
+}
+
+func (m *MockObjectStoreOp) presign(method, httpMethod, key string, expiry time.Duration) (*url.URL, error) {
+	err := m.begin(method)
+	defer m.mutex.Unlock()
+	m.record(method, key, err)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("method", httpMethod)
+	query.Set("expires", fmt.Sprint(int64(presignExpiry(expiry).Seconds())))
+	return &url.URL{Scheme: "mock", Host: m.bucket, Path: "/" + key, RawQuery: query.Encode()}, nil
+}
+
+func (m *MockObjectStoreOp) notFound(key string) error {
+	return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, m.bucket, key)
+}
+
+// Mock configuration methods
+
+// SetBucket configures the name returned by Bucket().
+func (m *MockObjectStoreOp) SetBucket(bucket string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.bucket = bucket
+}
+
+// SetError configures the named method, like "Put" or "Get", to fail with err, nil clears it.
+func (m *MockObjectStoreOp) SetError(method string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err == nil {
+		delete(m.errors, method)
+	} else {
+		m.errors[method] = err
+	}
+}
+
+// Objects returns a copy of the stored contents by key.
+func (m *MockObjectStoreOp) Objects() map[string][]byte {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	objects := make(map[string][]byte, len(m.objects))
+	for key, object := range m.objects {
+		objects[key] = append([]byte(nil), object.data...)
+	}
+
+	return objects
+}
+
+// Reset removes all objects and recorded calls.
+func (m *MockObjectStoreOp) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.objects = map[string]mockObject{}
+	m.callHistory = make([]MockObjectStoreCall, 0)
+}
+
+// EnableChaos injects latency, random failures and outages into subsequent calls.
+func (m *MockObjectStoreOp) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockObjectStoreOp) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockObjectStoreOp) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// Call tracking methods
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockObjectStoreOp) GetCallHistory() []MockObjectStoreCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockObjectStoreCall(nil), m.callHistory...)
+}
+
+// GetCallsByMethod returns all calls for a specific method.
+func (m *MockObjectStoreOp) GetCallsByMethod(method string) []MockObjectStoreCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var filtered []MockObjectStoreCall
+	for _, call := range m.callHistory {
+		if call.Method == method {
+			filtered = append(filtered, call)
+		}
+	}
+
+	return filtered
+}
+
+// NewMockObjectStore creates an ObjectStore instance with a mock operator.
+func NewMockObjectStore() *ObjectStore {
+	return NewMockObjectStoreWithOp(NewMockObjectStoreOp())
+}
+
+// NewMockObjectStoreWithOp creates an ObjectStore instance with a custom mock operator.
+func NewMockObjectStoreWithOp(op *MockObjectStoreOp) *ObjectStore {
+	return &ObjectStore{
+		name:    "mock-objectstore",
+		profile: secret.ObjectStore{Bucket: op.Bucket()},
+		op:      op,
+	}
+}
@@ -0,0 +1,232 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// testS3Server serves single part PUT, GET and HEAD of path style objects.
+func testS3Server() *httptest.Server {
+	var mutex sync.Mutex
+	objects := map[string][]byte{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+				data = testS3Unchunk(data)
+			}
+
+			objects[r.URL.Path] = data
+			w.Header().Set("ETag", `"etag"`)
+		case http.MethodGet, http.MethodHead:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusNotFound)
+				if r.Method == http.MethodGet {
+					io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+				}
+
+				return
+			}
+
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("X-Amz-Meta-Owner", "alice")
+			http.ServeContent(w, r, "", time.Now(), bytes.NewReader(data))
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+}
+
+// testS3Unchunk decodes an aws-chunked body of "size;chunk-signature=...\r\ndata\r\n" chunks.
+func testS3Unchunk(body []byte) (data []byte) {
+	for len(body) > 0 {
+		header, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		size, _ := strconv.ParseInt(string(bytes.SplitN(header, []byte(";"), 2)[0]), 16, 64)
+		if size == 0 {
+			return
+		}
+
+		data = append(data, rest[:size]...)
+		body = rest[size+2:]
+	}
+
+	return
+}
+
+func TestObjectStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("NewObjectStore loads profile", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		assert.Nil(t, NewObjectStore(""))
+		assert.Nil(t, NewObjectStore("missing"))
+
+		store := NewObjectStore("test")
+		if assert.NotNil(t, store) {
+			assert.Equal(t, "objectstore", store.Operator().Bucket())
+			assert.Equal(t, "us-east-1", store.Profile().Region)
+
+			presigned, err := store.Operator().PresignedGetURL(ctx, "reports/a.csv", 0)
+			assert.NoError(t, err)
+			assert.Equal(t, "/objectstore/reports/a.csv", presigned.Path)
+			assert.Equal(t, "900", presigned.Query().Get("X-Amz-Expires"))
+
+			presigned, err = store.Operator().PresignedPutURL(ctx, "reports/a.csv", time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, "60", presigned.Query().Get("X-Amz-Expires"))
+		}
+	})
+
+	t.Run("Put, Get and missing keys", func(t *testing.T) {
+		server := testS3Server()
+		defer server.Close()
+
+		op, err := newObjectStoreOp(secret.ObjectStore{
+			Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+			Region:    "us-east-1",
+			Bucket:    "bucket",
+			AccessKey: "key",
+			SecretKey: "secret",
+			PathStyle: true,
+		})
+		assert.NoError(t, err)
+
+		info, err := op.Put(ctx, "a.txt", []byte("hello"), &ObjectPutOptions{ContentType: "text/plain"})
+		assert.NoError(t, err)
+		assert.Equal(t, "a.txt", info.Key)
+
+		data, err := op.Get(ctx, "a.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(data))
+
+		info, err = op.Stat(ctx, "a.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), info.Size)
+		assert.Equal(t, "alice", info.Metadata["Owner"])
+
+		_, err = op.Get(ctx, "missing.txt")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+		_, err = op.Stat(ctx, "missing.txt")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+	})
+}
+
+func TestMockObjectStoreOp(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Objects", func(t *testing.T) {
+		mock := NewMockObjectStoreOp()
+		info, err := mock.Put(ctx, "docs/a.txt", []byte("a"), &ObjectPutOptions{ContentType: "text/plain", Metadata: map[string]string{"owner": "alice"}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), info.Size)
+		assert.NotEmpty(t, info.ETag)
+
+		_, err = mock.Upload(ctx, "docs/sub/b.txt", strings.NewReader("bbbb-ignored"), 4, nil)
+		assert.NoError(t, err)
+		_, err = mock.Upload(ctx, "c.txt", strings.NewReader("ccc"), -1, nil)
+		assert.NoError(t, err)
+
+		data, err := mock.Get(ctx, "docs/sub/b.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "bbbb", string(data))
+
+		reader, info, err := mock.Download(ctx, "docs/a.txt")
+		assert.NoError(t, err)
+		data, _ = io.ReadAll(reader)
+		assert.Equal(t, "a", string(data))
+		assert.Equal(t, "alice", info.Metadata["owner"])
+		assert.Equal(t, "text/plain", info.ContentType)
+
+		objects, err := mock.List(ctx, ObjectListOptions{Prefix: "docs/"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"docs/a.txt", "docs/sub/"}, objectKeys(objects))
+
+		objects, err = mock.List(ctx, ObjectListOptions{Recursive: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"c.txt", "docs/a.txt", "docs/sub/b.txt"}, objectKeys(objects))
+
+		objects, err = mock.List(ctx, ObjectListOptions{Recursive: true, StartAfter: "c.txt", MaxKeys: 1})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"docs/a.txt"}, objectKeys(objects))
+
+		assert.NoError(t, mock.Delete(ctx, "docs/a.txt"))
+		assert.NoError(t, mock.Delete(ctx, "docs/a.txt"))
+		_, err = mock.Get(ctx, "docs/a.txt")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+		_, err = mock.Stat(ctx, "docs/a.txt")
+		assert.ErrorIs(t, err, ErrObjectNotFound)
+		assert.Len(t, mock.Objects(), 2)
+		assert.Len(t, mock.GetCallsByMethod("Delete"), 2)
+	})
+
+	t.Run("Presigned URLs", func(t *testing.T) {
+		mock := NewMockObjectStoreOp()
+		presigned, err := mock.PresignedPutURL(ctx, "a.txt", time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, "mock://mock-bucket/a.txt?expires=3600&method=PUT", presigned.String())
+
+		presigned, err = mock.PresignedGetURL(ctx, "a.txt", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "900", presigned.Query().Get("expires"))
+	})
+
+	t.Run("Errors and chaos", func(t *testing.T) {
+		mock := NewMockObjectStoreOp()
+		denied := errors.New("access denied")
+		mock.SetError("Put", denied)
+		_, err := mock.Put(ctx, "a.txt", nil, nil)
+		assert.ErrorIs(t, err, denied)
+		mock.SetError("Put", nil)
+		_, err = mock.Put(ctx, "a.txt", nil, nil)
+		assert.NoError(t, err)
+
+		mock.EnableChaos(MockChaosConfig{ErrorRate: 1})
+		assert.ErrorIs(t, mock.Ping(ctx), ErrMockChaos)
+		mock.DisableChaos()
+		assert.NoError(t, mock.Ping(ctx))
+
+		mock.Reset()
+		assert.Empty(t, mock.Objects())
+		assert.Empty(t, mock.GetCallHistory())
+
+		store := NewMockObjectStoreWithOp(mock)
+		assert.Same(t, mock, store.Operator())
+		assert.Equal(t, "mock-bucket", store.Profile().Bucket)
+	})
+}
+
+func objectKeys(objects []ObjectInfo) []string {
+	keys := make([]string, len(objects))
+	for idx, object := range objects {
+		keys[idx] = object.Key
+	}
+
+	return keys
+}
@@ -0,0 +1,800 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+var (
+	// DefaultRabbitPrefetch is the number of unacknowledged deliveries of a consumer without a configured prefetch
+	DefaultRabbitPrefetch = 10
+	// DefaultRabbitReconnectDelay is the first delay before reconnecting, doubled after every failed attempt
+	DefaultRabbitReconnectDelay    = 500 * time.Millisecond
+	DefaultRabbitMaxReconnectDelay = 30 * time.Second
+	// DefaultRabbitPublishTimeout bounds Publish waiting for confirmations when its ctx has no deadline
+	DefaultRabbitPublishTimeout = 10 * time.Second
+	// DefaultRabbitShutdownTimeout bounds how long Close waits for the running handler of a consumer
+	DefaultRabbitShutdownTimeout = 30 * time.Second
+)
+
+func init() {
+	envInt("GOTH_DEFAULT_RABBIT_PREFETCH", &DefaultRabbitPrefetch)
+	envMillis("GOTH_DEFAULT_RABBIT_RECONNECT_DELAY", &DefaultRabbitReconnectDelay)
+	envMillis("GOTH_DEFAULT_RABBIT_MAX_RECONNECT_DELAY", &DefaultRabbitMaxReconnectDelay)
+	envMillis("GOTH_DEFAULT_RABBIT_PUBLISH_TIMEOUT", &DefaultRabbitPublishTimeout)
+	envMillis("GOTH_DEFAULT_RABBIT_SHUTDOWN_TIMEOUT", &DefaultRabbitShutdownTimeout)
+}
+
+var (
+	ErrRabbitClosed            = errors.New("rabbit closed")
+	ErrRabbitNacked            = errors.New("rabbit message nacked by broker")
+	ErrRabbitConsumerConsuming = errors.New("rabbit consumer already consuming")
+	ErrRabbitNotConnected      = errors.New("rabbit not connected")
+)
+
+// RabbitMessage is a message published to an exchange or delivered from a queue.
+// Redelivered and DeliveryTag are set on delivered messages.
+type RabbitMessage struct {
+	Exchange      string
+	RoutingKey    string
+	Body          []byte
+	ContentType   string
+	Headers       map[string]any
+	MessageID     string
+	CorrelationID string
+	ReplyTo       string
+	// Persistent messages survive a broker restart when their queue is durable
+	Persistent bool
+	Priority   uint8
+	// Expiration is the time to live of the message in its queue, none when 0
+	Expiration  time.Duration
+	Timestamp   time.Time
+	Redelivered bool
+	DeliveryTag uint64
+}
+
+func (m RabbitMessage) publishing() amqp.Publishing {
+	publishing := amqp.Publishing{
+		Headers:       amqp.Table(m.Headers),
+		ContentType:   m.ContentType,
+		DeliveryMode:  amqp.Transient,
+		Priority:      m.Priority,
+		CorrelationId: m.CorrelationID,
+		ReplyTo:       m.ReplyTo,
+		MessageId:     m.MessageID,
+		Timestamp:     m.Timestamp,
+		Body:          m.Body,
+	}
+
+	if m.Persistent {
+		publishing.DeliveryMode = amqp.Persistent
+	}
+
+	if m.Expiration > 0 {
+		publishing.Expiration = fmt.Sprint(m.Expiration.Milliseconds())
+	}
+
+	return publishing
+}
+
+func rabbitDeliveryMessage(delivery amqp.Delivery) RabbitMessage {
+	msg := RabbitMessage{
+		Exchange:      delivery.Exchange,
+		RoutingKey:    delivery.RoutingKey,
+		Body:          delivery.Body,
+		ContentType:   delivery.ContentType,
+		Headers:       delivery.Headers,
+		MessageID:     delivery.MessageId,
+		CorrelationID: delivery.CorrelationId,
+		ReplyTo:       delivery.ReplyTo,
+		Persistent:    delivery.DeliveryMode == amqp.Persistent,
+		Priority:      delivery.Priority,
+		Timestamp:     delivery.Timestamp,
+		Redelivered:   delivery.Redelivered,
+		DeliveryTag:   delivery.DeliveryTag,
+	}
+
+	if expiration, err := time.ParseDuration(delivery.Expiration + "ms"); err == nil {
+		msg.Expiration = expiration
+	}
+
+	return msg
+}
+
+// RabbitHandlerFunc processes a delivered message, the message is acknowledged when it returns nil.
+type RabbitHandlerFunc func(ctx context.Context, msg RabbitMessage) error
+
+// RabbitRequeuePolicy decides what happens to a delivery whose handler failed.
+type RabbitRequeuePolicy int
+
+const (
+	// RabbitRequeueOnce requeues a failed delivery, and rejects it when it fails again after redelivery
+	RabbitRequeueOnce RabbitRequeuePolicy = iota
+	// RabbitRequeueAlways requeues every failed delivery
+	RabbitRequeueAlways
+	// RabbitRequeueNever rejects failed deliveries, the broker dead letters them when the queue has a dead
+	// letter exchange
+	RabbitRequeueNever
+)
+
+// Requeue reports whether a failed delivery of msg goes back to its queue.
+func (p RabbitRequeuePolicy) Requeue(msg RabbitMessage) bool {
+	switch p {
+	case RabbitRequeueAlways:
+		return true
+	case RabbitRequeueNever:
+		return false
+	default:
+		return !msg.Redelivered
+	}
+}
+
+// RabbitConsumerOptions configures a consumer, zero values use the profile and package defaults.
+type RabbitConsumerOptions struct {
+	Prefetch int
+	Requeue  RabbitRequeuePolicy
+	// Tag identifies the consumer on the broker, generated when empty
+	Tag string
+}
+
+// Rabbit represents a RabbitMQ broker with a shared publisher and consumers created on demand.
+// One connection is kept open and reopened with backoff when it is lost.
+type Rabbit struct {
+	name        string
+	profile     secret.Rabbit
+	connector   *rabbitConnector
+	publisher   RabbitPublisherOperator
+	newConsumer func(queue string, opts RabbitConsumerOptions) (RabbitConsumerOperator, error)
+
+	consumersLock sync.Mutex
+	consumers     []RabbitConsumerOperator
+}
+
+// Profile returns the loaded secret profile.
+func (r *Rabbit) Profile() secret.Rabbit {
+	return r.profile
+}
+
+// Publisher returns the publisher shared by the callers of this Rabbit.
+func (r *Rabbit) Publisher() RabbitPublisherOperator {
+	return r.publisher
+}
+
+// Connected reports whether the connection to the broker is currently open.
+func (r *Rabbit) Connected() bool {
+	return r.connector == nil || r.connector.connected()
+}
+
+// Consumer creates a consumer of queue, opts may be nil. The consumer is closed with the Rabbit unless
+// closed before.
+func (r *Rabbit) Consumer(queue string, opts *RabbitConsumerOptions) (RabbitConsumerOperator, error) {
+	if queue == "" {
+		return nil, errors.New("rabbit: consumer needs a queue")
+	}
+
+	options := RabbitConsumerOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	if options.Prefetch <= 0 {
+		options.Prefetch = r.profile.Prefetch
+	}
+
+	if options.Prefetch <= 0 {
+		options.Prefetch = DefaultRabbitPrefetch
+	}
+
+	consumer, err := r.newConsumer(queue, options)
+	if err != nil {
+		return nil, err
+	}
+
+	r.consumersLock.Lock()
+	r.consumers = append(r.consumers, consumer)
+	r.consumersLock.Unlock()
+	return consumer, nil
+}
+
+// Name returns "rabbit/<profile>".
+func (r *Rabbit) Name() string {
+	return "rabbit/" + r.name
+}
+
+// Ping fails while the connection to the broker is lost.
+func (r *Rabbit) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !r.Connected() {
+		return ErrRabbitNotConnected
+	}
+
+	return nil
+}
+
+// Stats returns the publisher counters and the counters of the open consumers summed up.
+func (r *Rabbit) Stats() DataStoreStats {
+	stats := DataStoreStats{}
+	if r.publisher != nil {
+		publisherStats := r.publisher.Stats()
+		stats["publisher.published"] = float64(publisherStats.Published)
+		stats["publisher.nacked"] = float64(publisherStats.Nacked)
+		stats["publisher.failed"] = float64(publisherStats.Failed)
+	}
+
+	r.consumersLock.Lock()
+	consumers := append([]RabbitConsumerOperator(nil), r.consumers...)
+	r.consumersLock.Unlock()
+	var acked, requeued, rejected int64
+	for _, consumer := range consumers {
+		consumerStats := consumer.Stats()
+		acked += consumerStats.Acked
+		requeued += consumerStats.Requeued
+		rejected += consumerStats.Rejected
+	}
+
+	stats["consumers"] = float64(len(consumers))
+	stats["consumer.acked"] = float64(acked)
+	stats["consumer.requeued"] = float64(requeued)
+	stats["consumer.rejected"] = float64(rejected)
+	return stats
+}
+
+// Close stops the consumers, waiting for their running handlers, then closes the publisher and the connection.
+func (r *Rabbit) Close() error {
+	r.consumersLock.Lock()
+	consumers := r.consumers
+	r.consumers = nil
+	r.consumersLock.Unlock()
+
+	var errs []error
+	for _, consumer := range consumers {
+		errs = append(errs, consumer.Close())
+	}
+
+	if r.publisher != nil {
+		errs = append(errs, r.publisher.Close())
+	}
+
+	if r.connector != nil {
+		errs = append(errs, r.connector.close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// rabbitConnection and rabbitChannel are the parts of the amqp connection and channel used by this package.
+type rabbitConnection interface {
+	Channel() (rabbitChannel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+type rabbitChannel interface {
+	Confirm(noWait bool) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (rabbitConfirmation, error)
+	Consume(queue, consumer string) (<-chan amqp.Delivery, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
+	Close() error
+}
+
+// rabbitConfirmation is the broker acknowledgement of a published message.
+type rabbitConfirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (rabbitChannel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	return amqpChannel{ch}, nil
+}
+
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+func (c amqpChannel) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) (rabbitConfirmation, error) {
+	confirmation, err := c.Channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, false, false, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return confirmation, nil
+}
+
+func (c amqpChannel) Consume(queue, consumer string) (<-chan amqp.Delivery, error) {
+	return c.Channel.Consume(queue, consumer, false, false, false, false, nil)
+}
+
+// rabbitDial opens broker connections, replaced in tests.
+var rabbitDial = func(url string) (rabbitConnection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return amqpConnection{conn}, nil
+}
+
+// rabbitConnector keeps one connection open, reconnecting with backoff when the broker closes it.
+type rabbitConnector struct {
+	url  string
+	dial func(url string) (rabbitConnection, error)
+
+	mutex  sync.Mutex
+	conn   rabbitConnection
+	ready  chan struct{}
+	closed chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newRabbitConnector(url string, dial func(url string) (rabbitConnection, error)) *rabbitConnector {
+	c := &rabbitConnector{
+		url:    url,
+		dial:   dial,
+		ready:  make(chan struct{}),
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go c.run()
+	return c
+}
+
+func (c *rabbitConnector) run() {
+	defer close(c.done)
+	delay := DefaultRabbitReconnectDelay
+	for {
+		conn, err := c.dial(c.url)
+		if err != nil {
+			kklogger.WarnJ("datastore:Rabbit.connect", err.Error())
+			select {
+			case <-c.closed:
+				return
+			case <-time.After(delay):
+			}
+
+			delay = min(delay*2, DefaultRabbitMaxReconnectDelay)
+			continue
+		}
+
+		delay = DefaultRabbitReconnectDelay
+		lost := conn.NotifyClose(make(chan *amqp.Error, 1))
+		c.mutex.Lock()
+		c.conn = conn
+		close(c.ready)
+		c.mutex.Unlock()
+		select {
+		case <-c.closed:
+			conn.Close()
+			return
+		case err := <-lost:
+			c.forget(conn)
+			kklogger.WarnJ("datastore:Rabbit.connect", fmt.Sprintf("connection lost: %v", err))
+		}
+	}
+}
+
+// channel opens a channel, waiting for the connection while it is being reopened.
+func (c *rabbitConnector) channel(ctx context.Context) (rabbitChannel, error) {
+	for {
+		select {
+		case <-c.closed:
+			return nil, ErrRabbitClosed
+		default:
+		}
+
+		c.mutex.Lock()
+		conn, ready := c.conn, c.ready
+		c.mutex.Unlock()
+		if conn != nil {
+			ch, err := conn.Channel()
+			if !errors.Is(err, amqp.ErrClosed) {
+				return ch, err
+			}
+
+			// The connection is lost but run has not noticed yet, wait for the next one
+			c.forget(conn)
+			continue
+		}
+
+		select {
+		case <-ready:
+		case <-c.closed:
+			return nil, ErrRabbitClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// forget drops conn when it is still the current connection, so callers wait for the next one.
+func (c *rabbitConnector) forget(conn rabbitConnection) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == conn {
+		c.conn, c.ready = nil, make(chan struct{})
+	}
+}
+
+func (c *rabbitConnector) connected() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.conn != nil
+}
+
+// close closes the connection and stops reconnecting.
+func (c *rabbitConnector) close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+
+	<-c.done
+	return nil
+}
+
+// RabbitPublisherStats are the counters of a publisher.
+type RabbitPublisherStats struct {
+	Published int64
+	Nacked    int64
+	Failed    int64
+}
+
+// RabbitPublisher publishes messages on a confirm mode channel, waiting for the broker to confirm them.
+type RabbitPublisher struct {
+	connector *rabbitConnector
+
+	mutex   sync.Mutex
+	channel rabbitChannel
+	lost    chan *amqp.Error
+	closed  bool
+
+	published atomic.Int64
+	nacked    atomic.Int64
+	failed    atomic.Int64
+}
+
+// newRabbitPublisher creates a publisher opening its channel on the connection of connector.
+func newRabbitPublisher(connector *rabbitConnector) *RabbitPublisher {
+	return &RabbitPublisher{connector: connector}
+}
+
+// Publish publishes msgs and waits until the broker confirms them, ErrRabbitNacked when it refused some.
+// Messages are not published again after a failure, retrying it may deliver the confirmed ones twice.
+func (p *RabbitPublisher) Publish(ctx context.Context, msgs ...RabbitMessage) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultRabbitPublishTimeout)
+		defer cancel()
+	}
+
+	ch, err := p.acquire(ctx)
+	if err != nil {
+		p.failed.Add(int64(len(msgs)))
+		return err
+	}
+
+	confirmations := make([]rabbitConfirmation, 0, len(msgs))
+	for _, msg := range msgs {
+		confirmation, err := ch.Publish(ctx, msg.Exchange, msg.RoutingKey, msg.publishing())
+		if err != nil {
+			p.reset(ch)
+			p.failed.Add(int64(len(msgs)))
+			return err
+		}
+
+		confirmations = append(confirmations, confirmation)
+	}
+
+	nacked := 0
+	for idx, confirmation := range confirmations {
+		acked, err := confirmation.WaitContext(ctx)
+		if err != nil {
+			p.failed.Add(int64(len(msgs) - idx))
+			return err
+		}
+
+		if acked {
+			p.published.Add(1)
+		} else {
+			p.nacked.Add(1)
+			nacked++
+		}
+	}
+
+	if nacked > 0 {
+		return fmt.Errorf("%w: %d of %d messages", ErrRabbitNacked, nacked, len(msgs))
+	}
+
+	return nil
+}
+
+// acquire returns the confirm mode channel, opening a new one when it was closed.
+func (p *RabbitPublisher) acquire(ctx context.Context) (rabbitChannel, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return nil, ErrRabbitClosed
+	}
+
+	if p.channel != nil {
+		select {
+		case <-p.lost:
+			p.channel = nil
+		default:
+			return p.channel, nil
+		}
+	}
+
+	ch, err := p.connector.channel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	p.channel, p.lost = ch, ch.NotifyClose(make(chan *amqp.Error, 1))
+	return ch, nil
+}
+
+func (p *RabbitPublisher) reset(ch rabbitChannel) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.channel == ch {
+		p.channel.Close()
+		p.channel = nil
+	}
+}
+
+// Stats returns the confirmed, nacked and failed message counters.
+func (p *RabbitPublisher) Stats() RabbitPublisherStats {
+	return RabbitPublisherStats{Published: p.published.Load(), Nacked: p.nacked.Load(), Failed: p.failed.Load()}
+}
+
+// Close closes the channel, later publishes fail with ErrRabbitClosed.
+func (p *RabbitPublisher) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.closed = true
+	if p.channel != nil {
+		p.channel.Close()
+		p.channel = nil
+	}
+
+	return nil
+}
+
+// RabbitConsumerStats are the counters of a consumer.
+type RabbitConsumerStats struct {
+	Acked    int64
+	Requeued int64
+	Rejected int64
+}
+
+// RabbitConsumer passes the deliveries of a queue to a handler, consuming again after reconnecting.
+type RabbitConsumer struct {
+	connector *rabbitConnector
+	queue     string
+	options   RabbitConsumerOptions
+
+	lock    sync.Mutex
+	closed  bool
+	cancel  context.CancelFunc
+	running chan struct{}
+
+	acked    atomic.Int64
+	requeued atomic.Int64
+	rejected atomic.Int64
+}
+
+func newRabbitConsumer(connector *rabbitConnector, queue string, options RabbitConsumerOptions) *RabbitConsumer {
+	return &RabbitConsumer{connector: connector, queue: queue, options: options}
+}
+
+// Queue returns the consumed queue.
+func (c *RabbitConsumer) Queue() string {
+	return c.queue
+}
+
+// Options returns the options of the consumer.
+func (c *RabbitConsumer) Options() RabbitConsumerOptions {
+	return c.options
+}
+
+// Consume passes each delivery to handler until ctx is done or the consumer is closed. A delivery is acked
+// when handler returns nil, otherwise it is nacked and requeued according to the requeue policy and consuming
+// goes on. Consuming resumes on a new channel when the channel or connection is lost, unacknowledged
+// deliveries are then redelivered by the broker.
+// The handler context is not canceled by Close, which waits for it to return.
+// Consume returns nil after Close and the ctx error when ctx is done.
+func (c *RabbitConsumer) Consume(ctx context.Context, handler RabbitHandlerFunc) error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return ErrRabbitClosed
+	}
+
+	if c.running != nil {
+		c.lock.Unlock()
+		return ErrRabbitConsumerConsuming
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	running := make(chan struct{})
+	c.cancel, c.running = cancel, running
+	c.lock.Unlock()
+	defer func() {
+		cancel()
+		c.lock.Lock()
+		c.cancel, c.running = nil, nil
+		c.lock.Unlock()
+		close(running)
+	}()
+
+	for {
+		err := c.consume(ctx, handler)
+		if ctx.Err() != nil {
+			return c.stopErr(ctx)
+		}
+
+		if !errors.Is(err, amqp.ErrClosed) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return c.stopErr(ctx)
+		case <-time.After(DefaultRabbitReconnectDelay):
+		}
+	}
+}
+
+// consume handles the deliveries of one channel, amqp.ErrClosed when the channel is lost.
+func (c *RabbitConsumer) consume(ctx context.Context, handler RabbitHandlerFunc) error {
+	ch, err := c.connector.channel(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer ch.Close()
+	if err := ch.Qos(c.options.Prefetch, 0, false); err != nil {
+		return err
+	}
+
+	deliveries, err := ch.Consume(c.queue, c.options.Tag)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return amqp.ErrClosed
+			}
+
+			c.handle(ctx, handler, delivery)
+		}
+	}
+}
+
+func (c *RabbitConsumer) handle(ctx context.Context, handler RabbitHandlerFunc, delivery amqp.Delivery) {
+	msg := rabbitDeliveryMessage(delivery)
+	err := handler(context.WithoutCancel(ctx), msg)
+	if err == nil {
+		if err := delivery.Ack(false); err != nil {
+			kklogger.WarnJ("datastore:RabbitConsumer.Consume", fmt.Sprintf("queue %s ack %d: %s", c.queue, msg.DeliveryTag, err.Error()))
+			return
+		}
+
+		c.acked.Add(1)
+		return
+	}
+
+	requeue := c.options.Requeue.Requeue(msg)
+	kklogger.ErrorJ("datastore:RabbitConsumer.Consume", fmt.Sprintf("queue %s delivery %d requeue %t: %s", c.queue, msg.DeliveryTag, requeue, err.Error()))
+	if err := delivery.Nack(false, requeue); err != nil {
+		kklogger.WarnJ("datastore:RabbitConsumer.Consume", fmt.Sprintf("queue %s nack %d: %s", c.queue, msg.DeliveryTag, err.Error()))
+		return
+	}
+
+	if requeue {
+		c.requeued.Add(1)
+	} else {
+		c.rejected.Add(1)
+	}
+}
+
+func (c *RabbitConsumer) stopErr(ctx context.Context) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil
+	}
+
+	return ctx.Err()
+}
+
+// Stats returns the acked, requeued and rejected delivery counters.
+func (c *RabbitConsumer) Stats() RabbitConsumerStats {
+	return RabbitConsumerStats{Acked: c.acked.Load(), Requeued: c.requeued.Load(), Rejected: c.rejected.Load()}
+}
+
+// Close stops Consume and waits up to DefaultRabbitShutdownTimeout for the running handler.
+func (c *RabbitConsumer) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	cancel, running := c.cancel, c.running
+	c.lock.Unlock()
+	if cancel != nil {
+		cancel()
+		timer := time.NewTimer(DefaultRabbitShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-running:
+		case <-timer.C:
+			kklogger.WarnJ("datastore:RabbitConsumer.Close", fmt.Sprintf("queue %s: handler still running after %s", c.queue, DefaultRabbitShutdownTimeout))
+		}
+	}
+
+	return nil
+}
+
+// NewRabbit creates a Rabbit handler with the specified profile, connecting in the background.
+// Returns nil if the profile name is empty or loading the profile fails.
+func NewRabbit(profileName string) *Rabbit {
+	if profileName == "" {
+		kklogger.ErrorJ("datastore.NewRabbit#profileName", "profile name is empty")
+		return nil
+	}
+
+	profile := &secret.Rabbit{}
+	if err := secret.Load("rabbit", profileName, profile); err != nil {
+		kklogger.ErrorJ("datastore.NewRabbit#Load", err.Error())
+		return nil
+	}
+
+	return newRabbit(profileName, *profile, rabbitDial)
+}
+
+func newRabbit(profileName string, profile secret.Rabbit, dial func(url string) (rabbitConnection, error)) *Rabbit {
+	connector := newRabbitConnector(profile.ConnectionURL(), dial)
+	return &Rabbit{
+		name:      profileName,
+		profile:   profile,
+		connector: connector,
+		publisher: newRabbitPublisher(connector),
+		newConsumer: func(queue string, opts RabbitConsumerOptions) (RabbitConsumerOperator, error) {
+			return newRabbitConsumer(connector, queue, opts), nil
+		},
+	}
+}
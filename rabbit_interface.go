@@ -0,0 +1,43 @@
+package datastore
+
+import (
+	"context"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// RabbitPublisherOperator defines the interface for publishing RabbitMQ messages.
+// This interface allows for both real and mock implementations.
+type RabbitPublisherOperator interface {
+	Publish(ctx context.Context, msgs ...RabbitMessage) error
+	Stats() RabbitPublisherStats
+	Close() error
+}
+
+// RabbitConsumerOperator defines the interface for consuming a RabbitMQ queue.
+// This interface allows for both real and mock implementations.
+type RabbitConsumerOperator interface {
+	Consume(ctx context.Context, handler RabbitHandlerFunc) error
+	Queue() string
+	Stats() RabbitConsumerStats
+	Close() error
+}
+
+// RabbitProvider defines the interface for Rabbit instances.
+// This allows both real and mock Rabbit implementations.
+type RabbitProvider interface {
+	Publisher() RabbitPublisherOperator
+	Consumer(queue string, opts *RabbitConsumerOptions) (RabbitConsumerOperator, error)
+	Profile() secret.Rabbit
+}
+
+// Compile-time checks that the real and mock implementations stay in sync with the interfaces.
+var (
+	_ RabbitPublisherOperator = (*RabbitPublisher)(nil)
+	_ RabbitPublisherOperator = (*MockRabbitPublisher)(nil)
+	_ RabbitConsumerOperator  = (*RabbitConsumer)(nil)
+	_ RabbitConsumerOperator  = (*MockRabbitConsumer)(nil)
+	_ RabbitProvider          = (*Rabbit)(nil)
+	_ rabbitChannel           = amqpChannel{}
+	_ rabbitConnection        = amqpConnection{}
+)
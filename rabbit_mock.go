@@ -0,0 +1,409 @@
+package datastore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// MockRabbitCall represents a recorded Rabbit publisher or consumer call.
+type MockRabbitCall struct {
+	Timestamp time.Time
+	Method    string
+	Messages  []RabbitMessage
+	Error     error
+}
+
+// MockRabbitPublisher is a mock implementation of RabbitPublisherOperator for testing.
+// Published messages are captured instead of being sent to a broker.
+type MockRabbitPublisher struct {
+	mutex sync.RWMutex
+
+	callHistory  []MockRabbitCall
+	messages     []RabbitMessage
+	publishError error
+	nack         bool
+	closed       bool
+	stats        RabbitPublisherStats
+	chaos        *mockChaos
+}
+
+// NewMockRabbitPublisher creates a new mock publisher.
+func NewMockRabbitPublisher() *MockRabbitPublisher {
+	return &MockRabbitPublisher{callHistory: make([]MockRabbitCall, 0)}
+}
+
+// Publish captures msgs, or returns the error configured with SetPublishError or SetNack.
+func (m *MockRabbitPublisher) Publish(ctx context.Context, msgs ...RabbitMessage) error {
+	chaosErr := m.injectChaos()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var err error
+	switch {
+	case m.closed:
+		err = ErrRabbitClosed
+	case chaosErr != nil:
+		err = chaosErr
+	case m.publishError != nil:
+		err = m.publishError
+	case m.nack:
+		err = ErrRabbitNacked
+		m.stats.Nacked += int64(len(msgs))
+	default:
+		m.messages = append(m.messages, msgs...)
+		m.stats.Published += int64(len(msgs))
+	}
+
+	if err != nil && !m.nack {
+		m.stats.Failed += int64(len(msgs))
+	}
+
+	m.callHistory = append(m.callHistory, MockRabbitCall{Timestamp: time.Now(), Method: "Publish", Messages: msgs, Error: err})
+	return err
+}
+
+// Stats returns the captured, nacked and failed message counters.
+func (m *MockRabbitPublisher) Stats() RabbitPublisherStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.stats
+}
+
+// Close marks the mock closed, later publishes fail with ErrRabbitClosed.
+func (m *MockRabbitPublisher) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	m.callHistory = append(m.callHistory, MockRabbitCall{Timestamp: time.Now(), Method: "Close"})
+	return nil
+}
+
+// SetPublishError configures Publish to fail with err, nil captures messages again.
+func (m *MockRabbitPublisher) SetPublishError(err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.publishError = err
+}
+
+// SetNack configures Publish to fail with ErrRabbitNacked as if the broker refused the messages.
+func (m *MockRabbitPublisher) SetNack(nack bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.nack = nack
+}
+
+// Messages returns the captured messages in publish order.
+func (m *MockRabbitPublisher) Messages() []RabbitMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]RabbitMessage(nil), m.messages...)
+}
+
+// MessagesByRoutingKey returns the captured messages published with key, in publish order.
+func (m *MockRabbitPublisher) MessagesByRoutingKey(key string) []RabbitMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	var filtered []RabbitMessage
+	for _, msg := range m.messages {
+		if msg.RoutingKey == key {
+			filtered = append(filtered, msg)
+		}
+	}
+
+	return filtered
+}
+
+// ClearMessages drops the captured messages.
+func (m *MockRabbitPublisher) ClearMessages() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messages = nil
+}
+
+// IsClosed returns whether Close was called.
+func (m *MockRabbitPublisher) IsClosed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.closed
+}
+
+// EnableChaos injects latency, random failures and outages into subsequent publishes.
+func (m *MockRabbitPublisher) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockRabbitPublisher) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockRabbitPublisher) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockRabbitPublisher) GetCallHistory() []MockRabbitCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockRabbitCall(nil), m.callHistory...)
+}
+
+// ClearCallHistory clears all recorded method calls.
+func (m *MockRabbitPublisher) ClearCallHistory() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.callHistory = make([]MockRabbitCall, 0)
+}
+
+// MockRabbitConsumer is a mock implementation of RabbitConsumerOperator for testing.
+// Messages added with Push are passed to the Consume handler in order, failed deliveries are requeued at the
+// end of the queue as redelivered or rejected following the requeue policy of the options.
+type MockRabbitConsumer struct {
+	mutex sync.RWMutex
+
+	queue       string
+	options     RabbitConsumerOptions
+	callHistory []MockRabbitCall
+	pending     []RabbitMessage
+	acked       []RabbitMessage
+	rejected    []RabbitMessage
+	tag         uint64
+	pushed      chan struct{}
+	stop        chan struct{}
+	consuming   bool
+	closed      bool
+	stats       RabbitConsumerStats
+	chaos       *mockChaos
+}
+
+// NewMockRabbitConsumer creates a new mock consumer of queue, opts may be nil.
+func NewMockRabbitConsumer(queue string, opts *RabbitConsumerOptions) *MockRabbitConsumer {
+	options := RabbitConsumerOptions{}
+	if opts != nil {
+		options = *opts
+	}
+
+	return &MockRabbitConsumer{
+		queue:       queue,
+		options:     options,
+		callHistory: make([]MockRabbitCall, 0),
+		pushed:      make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Push queues msgs for Consume.
+func (m *MockRabbitConsumer) Push(msgs ...RabbitMessage) {
+	m.mutex.Lock()
+	m.pending = append(m.pending, msgs...)
+	m.mutex.Unlock()
+	select {
+	case m.pushed <- struct{}{}:
+	default:
+	}
+}
+
+// Consume passes the pushed messages to handler until ctx is done or Close is called, waiting for more
+// when the queue is empty. Like RabbitConsumer, a handler error nacks the delivery and consuming goes on.
+func (m *MockRabbitConsumer) Consume(ctx context.Context, handler RabbitHandlerFunc) error {
+	m.mutex.Lock()
+	switch {
+	case m.closed:
+		m.mutex.Unlock()
+		return ErrRabbitClosed
+	case m.consuming:
+		m.mutex.Unlock()
+		return ErrRabbitConsumerConsuming
+	}
+
+	m.consuming = true
+	m.mutex.Unlock()
+	defer func() {
+		m.mutex.Lock()
+		m.consuming = false
+		m.mutex.Unlock()
+	}()
+
+	for {
+		msg, ok := m.next()
+		if !ok {
+			select {
+			case <-m.pushed:
+				continue
+			case <-m.stop:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		err := m.injectChaos()
+		if err == nil {
+			err = handler(context.WithoutCancel(ctx), msg)
+		}
+
+		m.mutex.Lock()
+		m.callHistory = append(m.callHistory, MockRabbitCall{Timestamp: time.Now(), Method: "Consume", Messages: []RabbitMessage{msg}, Error: err})
+		switch {
+		case err == nil:
+			m.stats.Acked++
+			m.acked = append(m.acked, msg)
+		case m.options.Requeue.Requeue(msg):
+			m.stats.Requeued++
+			msg.Redelivered = true
+			m.pending = append(m.pending, msg)
+		default:
+			m.stats.Rejected++
+			m.rejected = append(m.rejected, msg)
+		}
+
+		m.mutex.Unlock()
+	}
+}
+
+// next removes the first pending message and assigns its delivery tag.
+func (m *MockRabbitConsumer) next() (RabbitMessage, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.pending) == 0 {
+		return RabbitMessage{}, false
+	}
+
+	msg := m.pending[0]
+	m.pending = m.pending[1:]
+	m.tag++
+	msg.DeliveryTag = m.tag
+	if msg.RoutingKey == "" {
+		msg.RoutingKey = m.queue
+	}
+
+	return msg, true
+}
+
+// Queue returns the consumed queue.
+func (m *MockRabbitConsumer) Queue() string {
+	return m.queue
+}
+
+// Options returns the options of the consumer.
+func (m *MockRabbitConsumer) Options() RabbitConsumerOptions {
+	return m.options
+}
+
+// Stats returns the acked, requeued and rejected delivery counters.
+func (m *MockRabbitConsumer) Stats() RabbitConsumerStats {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.stats
+}
+
+// Close stops Consume.
+func (m *MockRabbitConsumer) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.stop)
+	}
+
+	return nil
+}
+
+// Acked returns the messages handled successfully, in order.
+func (m *MockRabbitConsumer) Acked() []RabbitMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]RabbitMessage(nil), m.acked...)
+}
+
+// Rejected returns the failed messages which were not requeued, in order.
+func (m *MockRabbitConsumer) Rejected() []RabbitMessage {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]RabbitMessage(nil), m.rejected...)
+}
+
+// Pending returns the number of pushed or requeued messages not delivered yet.
+func (m *MockRabbitConsumer) Pending() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.pending)
+}
+
+// IsClosed returns whether Close was called.
+func (m *MockRabbitConsumer) IsClosed() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.closed
+}
+
+// EnableChaos injects latency, random failures and outages before the handler of subsequent messages.
+func (m *MockRabbitConsumer) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+}
+
+// DisableChaos stops fault injection.
+func (m *MockRabbitConsumer) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+// injectChaos sleeps for the injected latency and returns the injected error, if any.
+func (m *MockRabbitConsumer) injectChaos() error {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	delay, err := chaos.inject()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	return err
+}
+
+// GetCallHistory returns all recorded method calls.
+func (m *MockRabbitConsumer) GetCallHistory() []MockRabbitCall {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return append([]MockRabbitCall(nil), m.callHistory...)
+}
+
+// NewMockRabbit creates a Rabbit instance with a mock publisher, Consumer returns a new mock consumer per call.
+func NewMockRabbit() *Rabbit {
+	return NewMockRabbitWithOps(NewMockRabbitPublisher(), nil)
+}
+
+// NewMockRabbitWithOps creates a Rabbit instance with custom mocks, Consumer returns consumer for every queue
+// when it is not nil.
+func NewMockRabbitWithOps(publisher *MockRabbitPublisher, consumer *MockRabbitConsumer) *Rabbit {
+	return &Rabbit{
+		name:      "mock-rabbit",
+		profile:   secret.Rabbit{},
+		publisher: publisher,
+		newConsumer: func(queue string, opts RabbitConsumerOptions) (RabbitConsumerOperator, error) {
+			if consumer != nil {
+				return consumer, nil
+			}
+
+			return NewMockRabbitConsumer(queue, &opts), nil
+		},
+	}
+}
@@ -1,11 +1,17 @@
 package datastore
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	secret "github.com/yetiz-org/goth-datastore/secrets"
@@ -32,6 +38,28 @@ var DefaultRedisMaxActive = 0
 // DefaultRedisWait controls whether Get() waits for a connection when the pool is exhausted.
 var DefaultRedisWait = false
 
+// DefaultRedisClientNamePrefix is the prefix of the connection name sent via CLIENT SETNAME on every new connection.
+// The profile name is appended as "<prefix>:<profile>"; set to empty string to disable connection naming.
+var DefaultRedisClientNamePrefix = "goth-datastore"
+
+// DefaultRedisAutoPipeline enables automatic pipelining, coalescing concurrent single commands into one pipeline round trip.
+// It trades up to DefaultRedisAutoPipelineWindow of latency per command for less pool contention under high concurrency.
+var DefaultRedisAutoPipeline = false
+
+// DefaultRedisAutoPipelineWindow is the time window in microseconds used to collect commands into one batch.
+var DefaultRedisAutoPipelineWindow = 100
+
+// DefaultRedisAutoPipelineMaxBatch is the maximum number of commands sent in one batch; the batch is flushed early when reached.
+var DefaultRedisAutoPipelineMaxBatch = 100
+
+// DefaultRedisAutoPipelineConcurrency is the maximum number of batches executed at the same time, each on its own
+// connection; commands keep being collected while batches are in flight.
+var DefaultRedisAutoPipelineConcurrency = 4
+
+// DefaultRedisTestOnBorrowIdle is the idle time in milliseconds after which a pooled connection is checked with PING before reuse.
+// It applies when the profile does not set test_on_borrow_idle; 0 disables the check.
+var DefaultRedisTestOnBorrowIdle = 0
+
 const (
 	redisModeSingle      = secret.RedisModeSingle
 	redisModeReplication = secret.RedisModeReplication
@@ -52,6 +80,11 @@ func redisMetaFromAddrs(addrs []string) secret.RedisMeta {
 		return secret.RedisMeta{}
 	}
 
+	// go-redis dials addresses starting with a slash over a unix socket
+	if strings.HasPrefix(addrs[0], "/") {
+		return secret.RedisMeta{Socket: addrs[0]}
+	}
+
 	host, port := splitRedisAddr(addrs[0])
 	return secret.RedisMeta{
 		Host: host,
@@ -83,12 +116,154 @@ func (r *Redis) Slave() RedisOperator {
 	return r.slave
 }
 
+// Name returns "redis/<profile>".
+func (r *Redis) Name() string {
+	return "redis/" + r.name
+}
+
+// Ping sends PING to the master.
+func (r *Redis) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if r.master == nil {
+		return fmt.Errorf("redis master not available")
+	}
+
+	return r.master.Ping().Error
+}
+
+// Stats returns the active and idle connections of the master and slave pools, and their idle limits when
+// DefaultRedisPoolAutoTune is enabled.
+func (r *Redis) Stats() DataStoreStats {
+	stats := DataStoreStats{}
+	for prefix, op := range map[string]RedisOperator{"master": r.master, "slave": r.slave} {
+		if op == nil {
+			continue
+		}
+
+		stats[prefix+".active_conns"] = float64(op.ActiveCount())
+		stats[prefix+".idle_conns"] = float64(op.IdleCount())
+		if o, ok := op.(*RedisOp); ok && o.tuner != nil {
+			maxIdle, tunings := o.tuner.stats()
+			stats[prefix+".pool_max_idle"] = float64(maxIdle)
+			stats[prefix+".pool_tunings"] = float64(tunings)
+		}
+	}
+
+	return stats
+}
+
+// AddPoolTuneObserver registers fn to be called on the decisions of the adaptive pools of the master and slave,
+// see DefaultRedisPoolAutoTune. The current idle limits and the number of changes are also reported by Stats as
+// pool_max_idle and pool_tunings.
+func (r *Redis) AddPoolTuneObserver(fn RedisPoolTuneObserverFunc) {
+	for _, op := range []RedisOperator{r.master, r.slave} {
+		if o, ok := op.(*RedisOp); ok && o.tuner != nil {
+			o.tuner.addObserver(fn)
+		}
+	}
+}
+
+// AddConnObserver registers fn to be called when the pools of the master and slave dial or close a connection,
+// and when a command fails with a network error.
+func (r *Redis) AddConnObserver(fn RedisConnObserverFunc) {
+	for _, op := range []RedisOperator{r.master, r.slave} {
+		if o, ok := op.(*RedisOp); ok && o.events != nil {
+			o.events.addObserver(fn)
+		}
+	}
+}
+
+// SetRecorder records the commands of the master and slave operators and their replies with recorder, nil stops
+// recording, see RedisOp.SetRecorder.
+func (r *Redis) SetRecorder(recorder *RedisRecorder) {
+	for _, op := range []RedisOperator{r.master, r.slave} {
+		if o, ok := op.(*RedisOp); ok {
+			o.SetRecorder(recorder)
+		}
+	}
+}
+
+// SetAudit logs the commands of the master and slave operators with audit, nil stops logging, see
+// RedisOp.SetAudit.
+func (r *Redis) SetAudit(audit *RedisAudit) {
+	for _, op := range []RedisOperator{r.master, r.slave} {
+		if o, ok := op.(*RedisOp); ok {
+			o.SetAudit(audit)
+		}
+	}
+}
+
+// SetCodec sets the Codec of the master and slave operators.
+func (r *Redis) SetCodec(codec Codec) {
+	for _, op := range []RedisOperator{r.master, r.slave} {
+		if op != nil {
+			op.SetCodec(codec)
+		}
+	}
+}
+
+// SetEncryption sets the RedisEncryption of the master and slave operators.
+func (r *Redis) SetEncryption(encryption *RedisEncryption) {
+	for _, op := range []RedisOperator{r.master, r.slave} {
+		if op != nil {
+			op.SetEncryption(encryption)
+		}
+	}
+}
+
+// SetCommandGuard sets the RedisCommandGuard of the master and slave operators, a read-only slave stays read-only.
+func (r *Redis) SetCommandGuard(guard *RedisCommandGuard) {
+	if r.master != nil {
+		r.master.SetCommandGuard(guard)
+	}
+
+	if r.slave != nil {
+		if r.slave.CommandGuard().ReadOnly() {
+			r.slave.SetCommandGuard(guard.WithReadOnly())
+		} else {
+			r.slave.SetCommandGuard(guard)
+		}
+	}
+}
+
+// Close closes the master and slave pools.
+func (r *Redis) Close() error {
+	var err error
+	for _, op := range []RedisOperator{r.master, r.slave} {
+		if op == nil {
+			continue
+		}
+
+		if e := op.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
 // RedisOp wraps a redis.Pool and exposes typed Redis command helpers.
 // Obtain instances via Redis.Master() and Redis.Slave().
 // Each method executes a single Redis command and returns a RedisResponse.
 type RedisOp struct {
-	meta   secret.RedisMeta
-	client redis.UniversalClient
+	meta    secret.RedisMeta
+	client  redis.UniversalClient
+	batcher *redisAutoPipeline
+	cache   *redisClientCache
+	codec   Codec
+	crypt   *RedisEncryption
+	guard   *RedisCommandGuard
+	tuner   *redisPoolTuner
+	timeout *redisTimeouts
+	events  *redisConnEvents
+	dns     *redisDNSRefresher
+	// recorder writes the commands and their replies to a fixture, see SetRecorder
+	recorder atomic.Pointer[RedisRecorder]
+	// audit logs a sample of the commands, see SetAudit
+	audit atomic.Pointer[RedisAudit]
 }
 
 // Meta returns the Redis connection metadata (host and port) loaded from secret.
@@ -96,6 +271,62 @@ func (o *RedisOp) Meta() secret.RedisMeta {
 	return o.meta
 }
 
+// Cluster reports whether the operator sends its commands to a cluster, whose multi-key commands must not span
+// hash slots, see CheckRedisSlots.
+func (o *RedisOp) Cluster() bool {
+	_, ok := o.client.(*redis.ClusterClient)
+	return ok
+}
+
+// Codec returns the Codec of the typed helpers, DefaultRedisCodec unless set with SetCodec.
+func (o *RedisOp) Codec() Codec {
+	if o.codec == nil {
+		return DefaultRedisCodec
+	}
+
+	return o.codec
+}
+
+// SetCodec sets the Codec used by GetAs, SetAs and Cache on this operator, nil restores DefaultRedisCodec.
+// It should be set before the operator is shared.
+func (o *RedisOp) SetCodec(codec Codec) {
+	o.codec = codec
+}
+
+// Encryption returns the RedisEncryption of the typed helpers, nil when values are stored in plaintext.
+func (o *RedisOp) Encryption() *RedisEncryption {
+	return o.crypt
+}
+
+// SetEncryption sets the RedisEncryption used by GetAs, SetAs and Cache on this operator, nil disables it.
+// It should be set before the operator is shared.
+func (o *RedisOp) SetEncryption(encryption *RedisEncryption) {
+	o.crypt = encryption
+}
+
+// CommandGuard returns the RedisCommandGuard restricting the commands of the operator, nil when unrestricted.
+func (o *RedisOp) CommandGuard() *RedisCommandGuard {
+	return o.guard
+}
+
+// SetCommandGuard restricts the commands of the operator, nil allows every command.
+// It should be set before the operator is shared.
+func (o *RedisOp) SetCommandGuard(guard *RedisCommandGuard) {
+	o.guard = guard
+}
+
+// SetRecorder records the commands of the operator and their replies with recorder, nil stops recording. It can
+// be set while the operator is in use, e.g. to capture a window of staging traffic.
+func (o *RedisOp) SetRecorder(recorder *RedisRecorder) {
+	o.recorder.Store(recorder)
+}
+
+// SetAudit logs the commands of the operator with audit, nil stops logging. It can be set while the operator is
+// in use, e.g. for the time of an investigation.
+func (o *RedisOp) SetAudit(audit *RedisAudit) {
+	o.audit.Store(audit)
+}
+
 // ActiveCount returns the number of active connections in the pool.
 func (o *RedisOp) ActiveCount() int {
 	if o.client == nil {
@@ -137,15 +368,84 @@ type RedisPipelineCmd struct {
 	Args []interface{}
 }
 
+// RedisPipelineOptions defines options for the PipelineWithOptions command.
+type RedisPipelineOptions struct {
+	// Transaction - Wrap the batch in MULTI/EXEC so the commands are executed atomically
+	Transaction bool
+}
+
+// RedisTx queues the commands of a transaction run by ExecCtx.
+type RedisTx struct {
+	cmds []RedisPipelineCmd
+}
+
+// Do queues cmd with args, its response is at the same index in the responses of ExecCtx.
+func (t *RedisTx) Do(cmd string, args ...interface{}) {
+	t.cmds = append(t.cmds, RedisPipelineCmd{Cmd: cmd, Args: args})
+}
+
+// Len returns the number of queued commands.
+func (t *RedisTx) Len() int {
+	return len(t.cmds)
+}
+
 // Usage guarantees 1:1 mapping between cmds[i] and responses[i].
 // Pipeline sends multiple commands in a single batch and returns responses in the same order.
 func (o *RedisOp) Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse {
+	return o.PipelineWithOptions(RedisPipelineOptions{}, cmds...)
+}
+
+// PipelineWithOptions sends multiple commands in a single batch with additional options.
+// With Transaction, the EXEC array reply is mapped back to per-command responses; when a command
+// is rejected while queueing, the transaction is discarded and every response carries the EXECABORT error.
+// When the RedisCommandGuard rejects a command, nothing is sent and every response carries its error.
+func (o *RedisOp) PipelineWithOptions(opts RedisPipelineOptions, cmds ...RedisPipelineCmd) []*RedisResponse {
+	return o.pipelineCtx(context.Background(), opts, cmds)
+}
+
+// PipelineCtx is Pipeline bounded by ctx: its deadline or cancellation stops waiting for a pooled connection and
+// for the replies, the responses not read by then carry ErrTimeout or the error of ctx.
+func (o *RedisOp) PipelineCtx(ctx context.Context, cmds ...RedisPipelineCmd) []*RedisResponse {
+	return o.pipelineCtx(ctx, RedisPipelineOptions{}, cmds)
+}
+
+// ExecCtx sends the commands queued by f in one MULTI/EXEC transaction bounded by ctx like PipelineCtx, and
+// returns their responses. Nothing is sent when f returns an error, which is returned.
+func (o *RedisOp) ExecCtx(ctx context.Context, f func(tx *RedisTx) error) ([]*RedisResponse, error) {
+	tx := &RedisTx{}
+	if err := f(tx); err != nil {
+		return nil, err
+	}
+
+	return o.pipelineCtx(ctx, RedisPipelineOptions{Transaction: true}, tx.cmds), nil
+}
+
+func (o *RedisOp) pipelineCtx(ctx context.Context, opts RedisPipelineOptions, cmds []RedisPipelineCmd) []*RedisResponse {
 	if len(cmds) == 0 {
 		return nil
 	}
 
-	ctx := context.Background()
-	pipe := o.client.Pipeline()
+	if err := o.guard.checkAll(cmds); err != nil {
+		responses := make([]*RedisResponse, len(cmds))
+		for i := range responses {
+			responses[i] = &RedisResponse{Error: err}
+		}
+
+		return responses
+	}
+
+	audit := o.audit.Load()
+	var start time.Time
+	if audit != nil {
+		start = time.Now()
+	}
+
+	var pipe redis.Pipeliner
+	if opts.Transaction {
+		pipe = o.client.TxPipeline()
+	} else {
+		pipe = o.client.Pipeline()
+	}
 
 	n := len(cmds)
 	responses := make([]*RedisResponse, n)
@@ -158,23 +458,33 @@ func (o *RedisOp) Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse {
 
 	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
 		kklogger.ErrorJ("datastore:RedisOp.Pipeline#exec!io", err.Error())
+		o.events.commandError(o.meta, "pipeline", classifyRedisError("pipeline", err))
 	}
 
+	recorder := o.recorder.Load()
 	for i := 0; i < n; i++ {
 		err := redisCmds[i].Err()
 		if errors.Is(err, redis.Nil) {
+			recorder.record(cmds[i].Cmd, cmds[i].Args, nil, RedisNotFound)
+			audit.log(o.meta.Addr(), cmds[i].Cmd, cmds[i].Args, start, RedisNotFound)
 			responses[i] = &RedisResponse{Error: RedisNotFound}
 			continue
 		}
 		if err != nil {
-			responses[i] = &RedisResponse{Error: err}
+			responses[i] = &RedisResponse{Error: classifyRedisError(cmds[i].Cmd, err)}
+			recorder.record(cmds[i].Cmd, cmds[i].Args, nil, responses[i].Error)
+			audit.log(o.meta.Addr(), cmds[i].Cmd, cmds[i].Args, start, responses[i].Error)
 			continue
 		}
 
 		r := redisCmds[i].Val()
 		if r == nil {
+			recorder.record(cmds[i].Cmd, cmds[i].Args, nil, RedisNotFound)
+			audit.log(o.meta.Addr(), cmds[i].Cmd, cmds[i].Args, start, RedisNotFound)
 			responses[i] = &RedisResponse{Error: RedisNotFound}
 		} else {
+			recorder.record(cmds[i].Cmd, cmds[i].Args, r, nil)
+			audit.log(o.meta.Addr(), cmds[i].Cmd, cmds[i].Args, start, nil)
 			responses[i] = &RedisResponse{
 				RedisResponseEntity: RedisResponseEntity{data: r},
 				Error:               nil,
@@ -189,34 +499,294 @@ func (o *RedisOp) Do(cmd string, args ...interface{}) *RedisResponse {
 	return o._Do(cmd, args...)
 }
 
+// DoWithTimeout is Do waiting at most timeout for the reply, overriding the read timeout of the command. The
+// connection read deadline is capped by the longest read timeout of the operator, see DefaultRedisCommandTimeouts.
+func (o *RedisOp) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) *RedisResponse {
+	return o.doTimeout(timeout, cmd, args...)
+}
+
 func (o *RedisOp) _Do(cmd string, args ...interface{}) *RedisResponse {
-	cmdArgs := append([]interface{}{cmd}, args...)
-	r, err := o.client.Do(context.Background(), cmdArgs...).Result()
-	if errors.Is(err, redis.Nil) {
-		return &RedisResponse{
-			Error: RedisNotFound,
-		}
+	return o.doTimeout(o.timeout.command(cmd), cmd, args...)
+}
+
+// doTimeout sends cmd bounded by timeout, or by the read timeout of the client when 0. Commands with a timeout
+// are not auto pipelined, the batch is read with a single deadline.
+func (o *RedisOp) doTimeout(timeout time.Duration, cmd string, args ...interface{}) *RedisResponse {
+	if err := o.guard.Check(cmd, args...); err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	audit := o.audit.Load()
+	var start time.Time
+	if audit != nil {
+		start = time.Now()
+	}
+
+	pooled := redisArgsPool.Get().(*[]interface{})
+	cmdArgs := append(append(*pooled, redisCommandName(cmd)), args...)
+	var redisCmd *redis.Cmd
+	switch {
+	case timeout > 0:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		redisCmd = o.client.Do(ctx, cmdArgs...)
+		cancel()
+	case o.batcher != nil && !redisBlockingCommands[strings.ToUpper(cmd)]:
+		redisCmd = o.batcher.do(cmdArgs)
+	default:
+		redisCmd = o.client.Do(context.Background(), cmdArgs...)
+	}
+
+	r, err := redisCmd.Result()
+	if cap(cmdArgs) <= redisPooledArgsCap {
+		clear(cmdArgs)
+		*pooled = cmdArgs[:0]
+		redisArgsPool.Put(pooled)
+	}
+
+	switch {
+	case errors.Is(err, redis.Nil):
+		err = RedisNotFound
+	case err != nil:
+		err = classifyRedisError(cmd, err)
+		o.events.commandError(o.meta, cmd, err)
+	case r == nil:
+		err = RedisNotFound
 	}
+
+	o.recorder.Load().record(cmd, args, r, err)
+	audit.log(o.meta.Addr(), cmd, args, start, err)
 	if err != nil {
-		return &RedisResponse{
-			Error: err,
+		return newRedisResponse(nil, err)
+	}
+
+	return newRedisResponse(r, nil)
+}
+
+// redisPooledArgsCap is the capacity above which argument slices are left to the garbage collector.
+const redisPooledArgsCap = 64
+
+// redisArgsPool recycles the argument slices of the commands sent by _Do, go-redis does not keep them once the
+// reply is read.
+var redisArgsPool = sync.Pool{New: func() interface{} {
+	args := make([]interface{}, 0, 8)
+	return &args
+}}
+
+// redisResponsePool recycles the responses handed back with RedisResponse.Release.
+var redisResponsePool = sync.Pool{New: func() interface{} {
+	return new(RedisResponse)
+}}
+
+func newRedisResponse(data interface{}, err error) *RedisResponse {
+	response := redisResponsePool.Get().(*RedisResponse)
+	response.data, response.Error = data, err
+	return response
+}
+
+// redisCommandNames are the names of the common commands converted to interface values once, converting the
+// name of every command sent would allocate.
+var redisCommandNames = func() map[string]interface{} {
+	names := map[string]interface{}{}
+	for _, set := range []map[string]bool{redisWriteCommands, redisKeylessCommands, redisMultiKeyCommands} {
+		for name := range set {
+			names[name] = name
+		}
+	}
+
+	for _, name := range []string{
+		"GET", "MGET", "GETRANGE", "STRLEN", "EXISTS", "TTL", "PTTL", "TYPE", "HGET", "HMGET", "HGETALL", "HEXISTS",
+		"HLEN", "HKEYS", "HVALS", "HSTRLEN", "LLEN", "LRANGE", "LINDEX", "SCARD", "SISMEMBER", "SMEMBERS", "ZSCORE",
+		"ZRANGE", "ZCARD", "ZRANK", "ZCOUNT", "EVAL_RO", "EVALSHA_RO", "FCALL_RO",
+	} {
+		names[name] = name
+	}
+
+	return names
+}()
+
+func redisCommandName(cmd string) interface{} {
+	if name, ok := redisCommandNames[cmd]; ok {
+		return name
+	}
+
+	return cmd
+}
+
+// redisBlockingCommands are never auto pipelined, a blocked command would hold back every command batched with it.
+var redisBlockingCommands = map[string]bool{
+	"BLPOP":      true,
+	"BRPOP":      true,
+	"BRPOPLPUSH": true,
+	"BLMOVE":     true,
+	"BLMPOP":     true,
+	"BZPOPMIN":   true,
+	"BZPOPMAX":   true,
+	"BZMPOP":     true,
+	"WAIT":       true,
+	"WAITAOF":    true,
+	"XREAD":      true,
+	"XREADGROUP": true,
+}
+
+// redisAutoPipeline collects commands issued concurrently within a small window and
+// sends them to the server as one pipeline.
+type redisAutoPipeline struct {
+	client   redis.UniversalClient
+	window   time.Duration
+	maxBatch int
+	queue    chan *redisAutoPipelineCall
+	// flushing holds a slot per batch in flight
+	flushing chan struct{}
+	closed   chan struct{}
+	once     sync.Once
+	wg       sync.WaitGroup
+}
+
+type redisAutoPipelineCall struct {
+	args []interface{}
+	cmd  *redis.Cmd
+	done chan struct{}
+}
+
+func newRedisAutoPipeline(client redis.UniversalClient, window time.Duration, maxBatch, concurrency int) *redisAutoPipeline {
+	if maxBatch <= 0 {
+		maxBatch = 1
+	}
+
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	p := &redisAutoPipeline{
+		client:   client,
+		window:   window,
+		maxBatch: maxBatch,
+		queue:    make(chan *redisAutoPipelineCall),
+		flushing: make(chan struct{}, concurrency),
+		closed:   make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.loop()
+	return p
+}
+
+// do enqueues the command and blocks until its batch has been executed.
+// Once the pipeline is closed, commands are sent directly through the client.
+func (p *redisAutoPipeline) do(args []interface{}) *redis.Cmd {
+	call := &redisAutoPipelineCall{args: args, done: make(chan struct{})}
+	select {
+	case p.queue <- call:
+		<-call.done
+		return call.cmd
+	case <-p.closed:
+		return p.client.Do(context.Background(), args...)
+	}
+}
+
+// loop collects the batches and executes each in its own goroutine, waiting for a free slot when as many batches
+// as the concurrency are in flight.
+func (p *redisAutoPipeline) loop() {
+	defer p.wg.Done()
+	for {
+		select {
+		case call := <-p.queue:
+			batch := p.collect(call)
+			p.flushing <- struct{}{}
+			p.wg.Add(1)
+			go func() {
+				defer p.wg.Done()
+				p.exec(batch)
+				<-p.flushing
+			}()
+		case <-p.closed:
+			return
 		}
 	}
-	if r == nil {
-		return &RedisResponse{
-			Error: RedisNotFound,
+}
+
+func (p *redisAutoPipeline) collect(first *redisAutoPipelineCall) []*redisAutoPipelineCall {
+	batch := []*redisAutoPipelineCall{first}
+	if p.maxBatch == 1 {
+		return batch
+	}
+
+	timer := time.NewTimer(p.window)
+	defer timer.Stop()
+	for len(batch) < p.maxBatch {
+		select {
+		case call := <-p.queue:
+			batch = append(batch, call)
+		case <-timer.C:
+			return batch
+		case <-p.closed:
+			return batch
 		}
 	}
 
-	return &RedisResponse{
-		RedisResponseEntity: RedisResponseEntity{data: r},
-		Error:               nil,
+	return batch
+}
+
+func (p *redisAutoPipeline) exec(batch []*redisAutoPipelineCall) {
+	ctx := context.Background()
+	if len(batch) == 1 {
+		batch[0].cmd = p.client.Do(ctx, batch[0].args...)
+		close(batch[0].done)
+		return
+	}
+
+	pipe := p.client.Pipeline()
+	for _, call := range batch {
+		call.cmd = pipe.Do(ctx, call.args...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		kklogger.DebugJ("datastore:RedisOp.AutoPipeline#exec!io", err.Error())
+	}
+
+	for _, call := range batch {
+		close(call.done)
 	}
 }
 
+// close stops collecting commands and waits for the batches in flight to finish.
+func (p *redisAutoPipeline) close() {
+	p.once.Do(func() {
+		close(p.closed)
+	})
+
+	p.wg.Wait()
+}
+
 // Get retrieves the string value of a key.
+// When client-side caching is enabled, cached replies are served without a round trip.
 func (o *RedisOp) Get(key interface{}) *RedisResponse {
-	return o._Do("GET", key)
+	if o.cache == nil {
+		return o._Do("GET", key)
+	}
+
+	cacheKey := redisClientCacheKey(key)
+	if !o.cache.cacheable(cacheKey) {
+		return o._Do("GET", key)
+	}
+
+	// A hit is checked by the guard and audited like the GET it saves
+	if err := o.guard.Check("GET", key); err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	data, seq, ok := o.cache.get(cacheKey)
+	if ok {
+		o.audit.Load().log(o.meta.Addr(), "GET", []interface{}{key}, time.Now(), nil)
+		return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: data}}
+	}
+
+	response := o._Do("GET", key)
+	if response.Error == nil {
+		o.cache.set(cacheKey, response.data, seq)
+	}
+
+	return response
 }
 
 // Set sets the string value of a key.
@@ -246,6 +816,11 @@ type SetOptions struct {
 
 // SetWithOptions sets the string value of a key with additional options.
 func (o *RedisOp) SetWithOptions(key interface{}, val interface{}, opts SetOptions) *RedisResponse {
+	return o._Do("SET", setArgs(key, val, opts)...)
+}
+
+// setArgs returns the arguments of SET for key, val and opts.
+func setArgs(key interface{}, val interface{}, opts SetOptions) []interface{} {
 	args := []interface{}{key, val}
 
 	// Add condition options (mutually exclusive)
@@ -273,7 +848,7 @@ func (o *RedisOp) SetWithOptions(key interface{}, val interface{}, opts SetOptio
 		args = append(args, "KEEPTTL")
 	}
 
-	return o._Do("SET", args...)
+	return args
 }
 
 // Expire sets a timeout on key. After the TTL expires, the key is deleted.
@@ -281,6 +856,119 @@ func (o *RedisOp) Expire(key interface{}, ttl int64) *RedisResponse {
 	return o._Do("EXPIRE", key, ttl)
 }
 
+// ErrRedisOptionsConflict is returned for options Redis rejects together, like NX with XX.
+var ErrRedisOptionsConflict = errors.New("redis options conflict")
+
+// ExpireOptions defines the condition flags for the EXPIRE family of commands.
+// NX cannot be combined with the other flags, nor GT with LT.
+type ExpireOptions struct {
+	// NX - Set expiry only when the key has no expiry
+	NX bool
+	// XX - Set expiry only when the key has an existing expiry
+	XX bool
+	// GT - Set expiry only when the new expiry is greater than current one
+	GT bool
+	// LT - Set expiry only when the new expiry is less than current one
+	LT bool
+}
+
+// ExpireWithOptions sets a timeout in seconds on key with NX/XX/GT/LT conditions.
+func (o *RedisOp) ExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, ttl, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return o._Do("EXPIRE", args...)
+}
+
+// PExpire sets a timeout on key in milliseconds.
+func (o *RedisOp) PExpire(key interface{}, ttl int64) *RedisResponse {
+	return o._Do("PEXPIRE", key, ttl)
+}
+
+// PExpireWithOptions sets a timeout in milliseconds on key with NX/XX/GT/LT conditions.
+func (o *RedisOp) PExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, ttl, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return o._Do("PEXPIRE", args...)
+}
+
+// ExpireAt sets the expiration of key as a Unix timestamp in seconds.
+func (o *RedisOp) ExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return o._Do("EXPIREAT", key, timestamp)
+}
+
+// ExpireAtWithOptions sets the expiration of key as a Unix timestamp in seconds with NX/XX/GT/LT conditions.
+func (o *RedisOp) ExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, timestamp, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return o._Do("EXPIREAT", args...)
+}
+
+// PExpireAt sets the expiration of key as a Unix timestamp in milliseconds.
+func (o *RedisOp) PExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return o._Do("PEXPIREAT", key, timestamp)
+}
+
+// PExpireAtWithOptions sets the expiration of key as a Unix timestamp in milliseconds with NX/XX/GT/LT conditions.
+func (o *RedisOp) PExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, timestamp, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return o._Do("PEXPIREAT", args...)
+}
+
+// ExpireTime returns the absolute Unix timestamp in seconds at which key will expire.
+// Returns -1 if the key has no expiry and -2 if the key does not exist.
+func (o *RedisOp) ExpireTime(key interface{}) *RedisResponse {
+	return o._Do("EXPIRETIME", key)
+}
+
+// PExpireTime returns the absolute Unix timestamp in milliseconds at which key will expire.
+// Returns -1 if the key has no expiry and -2 if the key does not exist.
+func (o *RedisOp) PExpireTime(key interface{}) *RedisResponse {
+	return o._Do("PEXPIRETIME", key)
+}
+
+// expireArgs returns the arguments of the EXPIRE family, failing like Redis on the flags it does not combine.
+func expireArgs(key interface{}, value int64, opts ExpireOptions) ([]interface{}, error) {
+	if opts.NX && (opts.XX || opts.GT || opts.LT) {
+		return nil, fmt.Errorf("%w: NX and XX, GT or LT options at the same time are not compatible", ErrRedisOptionsConflict)
+	}
+
+	if opts.GT && opts.LT {
+		return nil, fmt.Errorf("%w: GT and LT options at the same time are not compatible", ErrRedisOptionsConflict)
+	}
+
+	args := []interface{}{key, value}
+	if opts.NX {
+		args = append(args, "NX")
+	}
+
+	if opts.XX {
+		args = append(args, "XX")
+	}
+
+	if opts.GT {
+		args = append(args, "GT")
+	}
+
+	if opts.LT {
+		args = append(args, "LT")
+	}
+
+	return args, nil
+}
+
 // Delete removes one or more keys.
 func (o *RedisOp) Delete(key ...interface{}) *RedisResponse {
 	return o._Do("DEL", key...)
@@ -301,6 +989,12 @@ func (o *RedisOp) SetExpire(key interface{}, val interface{}, ttl int64) *RedisR
 	return o._Do("SETEX", key, ttl, val)
 }
 
+// SetExpireJitter sets value and an expiration of ttl seconds plus a random part of up to jitterFraction of ttl,
+// so keys cached together do not expire together.
+func (o *RedisOp) SetExpireJitter(key interface{}, val interface{}, ttl int64, jitterFraction float64) *RedisResponse {
+	return o._Do("SETEX", key, jitterTTL(ttl, jitterFraction), val)
+}
+
 // SetNX sets the value of a key, only if the key does not exist.
 func (o *RedisOp) SetNX(key interface{}, val interface{}) *RedisResponse {
 	return o._Do("SETNX", key, val)
@@ -313,22 +1007,20 @@ func (o *RedisOp) MSetNX(keyvals ...interface{}) *RedisResponse {
 
 // HMSet sets multiple hash fields to multiple values.
 func (o *RedisOp) HMSet(key interface{}, val map[interface{}]interface{}) *RedisResponse {
-	vals := []interface{}{key}
-	for mk, mv := range val {
-		vals = append(vals, mk, mv)
-	}
+	return hmSet(o, key, redisHashPairs(val))
+}
 
-	return o._Do("HMSET", vals...)
+// HMSetOrdered sets the fields of the hash stored at key in the order of pairs, each a field and its value,
+// unlike HMSet whose argument order follows the map iteration.
+// More than DefaultRedisHashChunkSize pairs are split into several HMSET sent in one MULTI/EXEC transaction.
+func (o *RedisOp) HMSetOrdered(key interface{}, pairs [][2]interface{}) *RedisResponse {
+	return hmSet(o, key, pairs)
 }
 
 // HMGet gets the values of all specified fields in a hash.
+// More than DefaultRedisHashChunkSize fields are split into several HMGET sent in one MULTI/EXEC transaction.
 func (o *RedisOp) HMGet(key interface{}, field ...interface{}) *RedisResponse {
-	vals := []interface{}{key}
-	for _, f := range field {
-		vals = append(vals, f)
-	}
-
-	return o._Do("HMGET", vals...)
+	return hmGet(o, key, field)
 }
 
 // HSet sets field in the hash stored at key to value.
@@ -398,6 +1090,27 @@ func (o *RedisOp) HScan(key interface{}, cursor int64, match string, count int64
 	return o._Do("HSCAN", args...)
 }
 
+// HRandField returns a random field from the hash stored at key.
+func (o *RedisOp) HRandField(key interface{}) *RedisResponse {
+	return o._Do("HRANDFIELD", key)
+}
+
+// HRandFieldN returns up to count random fields from the hash stored at key.
+// A negative count allows the same field to be returned multiple times.
+// With withValues, the reply alternates field and value.
+func (o *RedisOp) HRandFieldN(key interface{}, count int64, withValues bool) *RedisResponse {
+	args := []interface{}{key, count}
+	if withValues {
+		args = append(args, "WITHVALUES")
+	}
+	return o._Do("HRANDFIELD", args...)
+}
+
+// HStrLen returns the string length of the value associated with field in the hash stored at key.
+func (o *RedisOp) HStrLen(key, field interface{}) *RedisResponse {
+	return o._Do("HSTRLEN", key, field)
+}
+
 // Incr increments the integer value of a key by one.
 func (o *RedisOp) Incr(key interface{}) *RedisResponse {
 	return o._Do("INCR", key)
@@ -413,13 +1126,85 @@ func (o *RedisOp) Publish(key interface{}, val interface{}) *RedisResponse {
 	return o._Do("PUBLISH", key, val)
 }
 
-// String commands (supplementary)
-// Append appends a value to a key's string value.
-func (o *RedisOp) Append(key interface{}, val interface{}) *RedisResponse {
-	return o._Do("APPEND", key, val)
+// RedisMessage is a message received by Subscribe.
+type RedisMessage struct {
+	Channel string
+	Payload string
+	// Subscribed marks the confirmation of a (re)subscription to Channel instead of a message,
+	// messages published while the connection was down are lost.
+	Subscribed bool
 }
 
-// StrLen returns the length of the string value stored at key.
+// Subscribe listens to channels on a dedicated connection until ctx is done, then the returned channel is closed.
+// Every subscription to a channel is reported with Subscribed set, including those after the connection is
+// re-established.
+func (o *RedisOp) Subscribe(ctx context.Context, channels ...string) (<-chan *RedisMessage, error) {
+	if o.client == nil {
+		return nil, fmt.Errorf("redis client not available")
+	}
+
+	if err := o.guard.Check("SUBSCRIBE"); err != nil {
+		return nil, err
+	}
+
+	pubsub := o.client.Subscribe(ctx, channels...)
+	confirmation, err := pubsub.Receive(ctx)
+	if err != nil {
+		pubsub.Close()
+		return nil, classifyRedisError("SUBSCRIBE", err)
+	}
+
+	messages := make(chan *RedisMessage, 100)
+	if subscription, ok := confirmation.(*redis.Subscription); ok {
+		messages <- &RedisMessage{Channel: subscription.Channel, Subscribed: true}
+	}
+
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+		in := pubsub.ChannelWithSubscriptions()
+		for {
+			var message *RedisMessage
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-in:
+				if !ok {
+					return
+				}
+
+				switch msg := msg.(type) {
+				case *redis.Subscription:
+					if msg.Kind != "subscribe" {
+						continue
+					}
+
+					message = &RedisMessage{Channel: msg.Channel, Subscribed: true}
+				case *redis.Message:
+					message = &RedisMessage{Channel: msg.Channel, Payload: msg.Payload}
+				default:
+					continue
+				}
+			}
+
+			select {
+			case messages <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// String commands (supplementary)
+// Append appends a value to a key's string value.
+func (o *RedisOp) Append(key interface{}, val interface{}) *RedisResponse {
+	return o._Do("APPEND", key, val)
+}
+
+// StrLen returns the length of the string value stored at key.
 func (o *RedisOp) StrLen(key interface{}) *RedisResponse {
 	return o._Do("STRLEN", key)
 }
@@ -455,6 +1240,65 @@ func (o *RedisOp) Dump(key interface{}) *RedisResponse {
 	return o._Do("DUMP", key)
 }
 
+// Restore creates a key from a payload produced by Dump.
+// ttl is in milliseconds, 0 creates the key without expiry; replace overwrites an existing key.
+func (o *RedisOp) Restore(key interface{}, ttl int64, payload []byte, replace bool) *RedisResponse {
+	args := []interface{}{key, ttl, payload}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+
+	return o._Do("RESTORE", args...)
+}
+
+// MigrateOptions defines options for the Migrate command.
+type MigrateOptions struct {
+	// Copy - Do not remove the key from the local instance
+	Copy bool
+	// Replace - Replace existing key on the remote instance
+	Replace bool
+	// Username - Authenticate with AUTH2 when set together with Password
+	Username string
+	// Password - Authenticate with AUTH on the remote instance
+	Password string
+	// Keys - Migrate multiple keys at once, the key argument is sent as empty string when set
+	Keys []interface{}
+}
+
+// Migrate atomically transfers a key to a destination Redis instance.
+// timeout is the maximum idle time in milliseconds for the transfer.
+func (o *RedisOp) Migrate(host string, port uint, key interface{}, db int, timeout int64, opts MigrateOptions) *RedisResponse {
+	return o._Do("MIGRATE", migrateArgs(host, port, key, db, timeout, opts)...)
+}
+
+func migrateArgs(host string, port uint, key interface{}, db int, timeout int64, opts MigrateOptions) []interface{} {
+	if len(opts.Keys) > 0 {
+		key = ""
+	}
+
+	args := []interface{}{host, port, key, db, timeout}
+	if opts.Copy {
+		args = append(args, "COPY")
+	}
+
+	if opts.Replace {
+		args = append(args, "REPLACE")
+	}
+
+	if opts.Username != "" {
+		args = append(args, "AUTH2", opts.Username, opts.Password)
+	} else if opts.Password != "" {
+		args = append(args, "AUTH", opts.Password)
+	}
+
+	if len(opts.Keys) > 0 {
+		args = append(args, "KEYS")
+		args = append(args, opts.Keys...)
+	}
+
+	return args
+}
+
 // TTL returns the remaining time to live of a key in seconds.
 func (o *RedisOp) TTL(key interface{}) *RedisResponse {
 	return o._Do("TTL", key)
@@ -495,6 +1339,60 @@ func (o *RedisOp) Unlink(key ...interface{}) *RedisResponse {
 	return o._Do("UNLINK", key...)
 }
 
+// DeleteByPattern UNLINKs the keys matching pattern, found with SCAN in batches of batchSize keys.
+// The response holds the number of deleted keys.
+func (o *RedisOp) DeleteByPattern(pattern string, batchSize int64) *RedisResponse {
+	return o.DeleteByPatternWithOptions(pattern, DeleteByPatternOptions{BatchSize: batchSize})
+}
+
+// DeleteByPatternWithOptions UNLINKs the keys matching pattern with rate limiting and progress callbacks,
+// on every master of a cluster. The response holds the number of deleted keys, also when it fails halfway.
+func (o *RedisOp) DeleteByPatternWithOptions(pattern string, opts DeleteByPatternOptions) *RedisResponse {
+	scanners, err := o.scanners()
+	if err != nil {
+		return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: int64(0)}, Error: err}
+	}
+
+	return deleteByPattern(o, scanners, pattern, opts)
+}
+
+// scanners returns a SCAN of each master of a cluster, whose nodes each SCAN their own keys, or of the operator.
+func (o *RedisOp) scanners() ([]redisScanner, error) {
+	cluster, ok := o.client.(*redis.ClusterClient)
+	if !ok {
+		return []redisScanner{func(args ...interface{}) *RedisResponse {
+			return o._Do("SCAN", args...)
+		}}, nil
+	}
+
+	var mutex sync.Mutex
+	var scanners []redisScanner
+	err := cluster.ForEachMaster(context.Background(), func(ctx context.Context, master *redis.Client) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		scanners = append(scanners, func(args ...interface{}) *RedisResponse {
+			if err := o.guard.Check("SCAN", args...); err != nil {
+				return &RedisResponse{Error: err}
+			}
+
+			r, err := master.Do(context.Background(), append([]interface{}{"SCAN"}, args...)...).Result()
+			if err != nil {
+				return &RedisResponse{Error: classifyRedisError("SCAN", err)}
+			}
+
+			return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: r}}
+		})
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, classifyRedisError("SCAN", err)
+	}
+
+	return scanners, nil
+}
+
 // Persist removes the existing timeout on a key.
 func (o *RedisOp) Persist(key interface{}) *RedisResponse {
 	return o._Do("PERSIST", key)
@@ -540,11 +1438,51 @@ func (o *RedisOp) LPop(key interface{}) *RedisResponse {
 	return o._Do("LPOP", key)
 }
 
+// LPopN removes and returns up to count elements from the head of the list stored at key.
+func (o *RedisOp) LPopN(key interface{}, count int64) *RedisResponse {
+	return o._Do("LPOP", key, count)
+}
+
 // LPos returns the index of the first occurrence of element in the list stored at key.
 func (o *RedisOp) LPos(key, element interface{}) *RedisResponse {
 	return o._Do("LPOS", key, element)
 }
 
+// LPosOptions defines options for the LPosWithOptions command.
+type LPosOptions struct {
+	// Rank - Start from the Nth match, negative values search from the tail; 0 omits RANK
+	Rank int64
+	// Count - Return up to Count matching indexes as an array; negative values return all matches (COUNT 0)
+	Count int64
+	// MaxLen - Compare at most MaxLen elements; 0 omits MAXLEN
+	MaxLen int64
+}
+
+// LPosWithOptions returns the index of matching elements in the list stored at key with additional options.
+// When Count is set the reply is an array of indexes instead of a single index.
+func (o *RedisOp) LPosWithOptions(key, element interface{}, opts LPosOptions) *RedisResponse {
+	return o._Do("LPOS", lposArgs(key, element, opts)...)
+}
+
+func lposArgs(key, element interface{}, opts LPosOptions) []interface{} {
+	args := []interface{}{key, element}
+	if opts.Rank != 0 {
+		args = append(args, "RANK", opts.Rank)
+	}
+
+	if opts.Count > 0 {
+		args = append(args, "COUNT", opts.Count)
+	} else if opts.Count < 0 {
+		args = append(args, "COUNT", 0)
+	}
+
+	if opts.MaxLen > 0 {
+		args = append(args, "MAXLEN", opts.MaxLen)
+	}
+
+	return args
+}
+
 // LPush inserts all the specified values at the head of the list stored at key.
 func (o *RedisOp) LPush(key interface{}, val ...interface{}) *RedisResponse {
 	args := []interface{}{key}
@@ -584,6 +1522,11 @@ func (o *RedisOp) RPop(key interface{}) *RedisResponse {
 	return o._Do("RPOP", key)
 }
 
+// RPopN removes and returns up to count elements from the tail of the list stored at key.
+func (o *RedisOp) RPopN(key interface{}, count int64) *RedisResponse {
+	return o._Do("RPOP", key, count)
+}
+
 // RPopLPush removes the last element in the source list and pushes it to the head of the destination list.
 func (o *RedisOp) RPopLPush(source, destination interface{}) *RedisResponse {
 	return o._Do("RPOPLPUSH", source, destination)
@@ -681,6 +1624,17 @@ func (o *RedisOp) SRandMember(key interface{}) *RedisResponse {
 	return o._Do("SRANDMEMBER", key)
 }
 
+// SPopN removes and returns up to count random members from the set stored at key.
+func (o *RedisOp) SPopN(key interface{}, count int64) *RedisResponse {
+	return o._Do("SPOP", key, count)
+}
+
+// SRandMemberN returns up to count random members from the set stored at key without removing them.
+// A negative count allows the same member to be returned multiple times.
+func (o *RedisOp) SRandMemberN(key interface{}, count int64) *RedisResponse {
+	return o._Do("SRANDMEMBER", key, count)
+}
+
 // SRem removes one or more members from a set.
 func (o *RedisOp) SRem(key interface{}, member ...interface{}) *RedisResponse {
 	args := []interface{}{key}
@@ -760,15 +1714,123 @@ func (o *RedisOp) Scan(cursor int64, match string, count int64) *RedisResponse {
 	}
 }
 
+// ScanTyped returns one page of the keys in the current database from cursor, unlike Scan which iterates them all.
+func (o *RedisOp) ScanTyped(cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(o._Do("SCAN", scanArgs(nil, cursor, match, count)...))
+}
+
+// HScanTyped returns one page of the fields and values of the hash stored at key from cursor.
+func (o *RedisOp) HScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(o._Do("HSCAN", scanArgs([]interface{}{key}, cursor, match, count)...))
+}
+
+// SScanTyped returns one page of the members of the set stored at key from cursor.
+func (o *RedisOp) SScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(o._Do("SSCAN", scanArgs([]interface{}{key}, cursor, match, count)...))
+}
+
+// ZScanTyped returns one page of the members and scores of the sorted set stored at key from cursor.
+func (o *RedisOp) ZScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(o._Do("ZSCAN", scanArgs([]interface{}{key}, cursor, match, count)...))
+}
+
 // Ping checks if the server is alive and responding.
 func (o *RedisOp) Ping() *RedisResponse {
 	return o._Do("PING")
 }
 
+// Connection commands
+// ClientList returns information and statistics about the client connections server.
+func (o *RedisOp) ClientList() *RedisResponse {
+	return o._Do("CLIENT", "LIST")
+}
+
+// ClientKill closes client connections matching the given arguments.
+// Accepts either the legacy "ip:port" form or filter/value pairs such as "ID", 12, "USER", "app".
+func (o *RedisOp) ClientKill(args ...interface{}) *RedisResponse {
+	cmdArgs := []interface{}{"KILL"}
+	cmdArgs = append(cmdArgs, args...)
+	return o._Do("CLIENT", cmdArgs...)
+}
+
+// ClientGetName returns the name of the connection that served this command.
+func (o *RedisOp) ClientGetName() *RedisResponse {
+	return o._Do("CLIENT", "GETNAME")
+}
+
+// ClientSetName assigns a name to the connection that served this command.
+// Pooled connections are already named on dial (see DefaultRedisClientNamePrefix),
+// so this only renames a single connection of the pool.
+func (o *RedisOp) ClientSetName(name string) *RedisResponse {
+	return o._Do("CLIENT", "SETNAME", name)
+}
+
+// Replication commands
+// Wait blocks until the preceding writes on the connection are acknowledged by at least numreplicas replicas,
+// or until timeout milliseconds elapse (0 blocks forever). Returns the number of acknowledging replicas.
+func (o *RedisOp) Wait(numreplicas int64, timeout int64) *RedisResponse {
+	return o._Do("WAIT", numreplicas, timeout)
+}
+
+// FailoverOptions defines options for the Failover command.
+type FailoverOptions struct {
+	// Host - Target replica host; when empty the server picks a replica
+	Host string
+	// Port - Target replica port, used together with Host
+	Port uint
+	// Force - Force the failover after Timeout even if the target replica is not in sync (requires Host and Timeout)
+	Force bool
+	// Abort - Abort an ongoing failover; other options are ignored
+	Abort bool
+	// Timeout - Maximum time in milliseconds the primary waits for the replica to catch up
+	Timeout int64
+}
+
+// Failover starts a coordinated failover from the connected primary to one of its replicas.
+func (o *RedisOp) Failover(opts FailoverOptions) *RedisResponse {
+	return o._Do("FAILOVER", failoverArgs(opts)...)
+}
+
+func failoverArgs(opts FailoverOptions) []interface{} {
+	if opts.Abort {
+		return []interface{}{"ABORT"}
+	}
+
+	args := []interface{}{}
+	if opts.Host != "" {
+		args = append(args, "TO", opts.Host, opts.Port)
+		if opts.Force {
+			args = append(args, "FORCE")
+		}
+	}
+
+	if opts.Timeout > 0 {
+		args = append(args, "TIMEOUT", opts.Timeout)
+	}
+
+	return args
+}
+
 // Close closes the underlying connection pool if present.
 // This is not a Redis command; it releases local resources.
 // Safe to call multiple times.
 func (o *RedisOp) Close() error {
+	if o.tuner != nil {
+		o.tuner.close()
+	}
+
+	if o.dns != nil {
+		o.dns.close()
+	}
+
+	if o.batcher != nil {
+		o.batcher.close()
+	}
+
+	if o.cache != nil {
+		o.cache.close()
+	}
+
 	if o.client != nil {
 		return o.client.Close()
 	}
@@ -786,6 +1848,19 @@ func (o *RedisOp) Eval(script string, keys []interface{}, args []interface{}) *R
 	return o._Do("EVAL", cmdArgs...)
 }
 
+// EvalSha executes a Lua script cached on the server by its SHA1 digest, see ScriptLoad.
+func (o *RedisOp) EvalSha(sha string, keys []interface{}, args []interface{}) *RedisResponse {
+	cmdArgs := []interface{}{sha, int64(len(keys))}
+	cmdArgs = append(cmdArgs, keys...)
+	cmdArgs = append(cmdArgs, args...)
+	return o._Do("EVALSHA", cmdArgs...)
+}
+
+// ScriptLoad caches a Lua script on the server, and returns its SHA1 digest to run it with EvalSha.
+func (o *RedisOp) ScriptLoad(script string) *RedisResponse {
+	return o._Do("SCRIPT", "LOAD", script)
+}
+
 // RedisResponseEntity holds a single Redis reply value and provides typed accessors.
 // It wraps the raw reply so callers can convert to int64/string/bytes safely.
 type RedisResponseEntity struct {
@@ -813,10 +1888,12 @@ func (k *RedisResponseEntity) GetInt64() int64 {
 // For []byte, it converts bytes to string; for numeric values, it formats as decimal string.
 func (k *RedisResponseEntity) GetString() string {
 	switch v := k.data.(type) {
+	case string:
+		return v
 	case []byte:
 		return string(v)
 	case int64:
-		return fmt.Sprintf("%d", v)
+		return strconv.FormatInt(v, 10)
 	default:
 		return fmt.Sprintf("%v", v)
 	}
@@ -864,6 +1941,88 @@ func (k *RedisResponseEntity) GetFloat64() float64 {
 	return 0.0
 }
 
+// ErrRedisConversion is returned, wrapped with the reply, by the TryGet accessors when the reply does not convert.
+var ErrRedisConversion = errors.New("redis reply conversion failed")
+
+// TryGetInt64 converts the underlying reply to int64 like GetInt64, but returns ErrRedisConversion instead of 0
+// when the reply is not an integer.
+func (k *RedisResponseEntity) TryGetInt64() (int64, error) {
+	switch v := k.data.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		if n := int64(v); float64(n) == v {
+			return n, nil
+		}
+	case []byte:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n, nil
+		}
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+
+	return 0, k.conversionError("int64")
+}
+
+// TryGetFloat64 converts the underlying reply to float64 like GetFloat64, but returns ErrRedisConversion
+// instead of 0 when the reply is not a number.
+func (k *RedisResponseEntity) TryGetFloat64() (float64, error) {
+	switch v := k.data.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case []byte:
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return f, nil
+		}
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, nil
+		}
+	}
+
+	return 0, k.conversionError("float64")
+}
+
+// TryGetString returns the underlying reply as a string like GetString, but returns ErrRedisConversion
+// instead of a formatted value when the reply is nil, an array or a map.
+func (k *RedisResponseEntity) TryGetString() (string, error) {
+	switch v := k.data.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	return "", k.conversionError("string")
+}
+
+func (k *RedisResponseEntity) conversionError(target string) error {
+	if k.data == nil {
+		return fmt.Errorf("%w: nil reply to %s", ErrRedisConversion, target)
+	}
+
+	return fmt.Errorf("%w: %T %.64v to %s", ErrRedisConversion, k.data, k.data, target)
+}
+
 // GetSlice converts an array reply into a slice of RedisResponseEntity for typed access.
 // Returns an empty slice if the reply is not an array.
 func (k *RedisResponseEntity) GetSlice() []RedisResponseEntity {
@@ -890,6 +2049,76 @@ func (k *RedisResponseEntity) GetSlice() []RedisResponseEntity {
 	return entities
 }
 
+// ZMember is a sorted set member paired with its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// GetZMembers converts a WITHSCORES array reply into member/score pairs.
+// Both flat RESP2 replies (member, score, ...) and nested RESP3 replies ([member, score], ...) are supported.
+func (k *RedisResponseEntity) GetZMembers() []ZMember {
+	var members []ZMember
+	entities := k.GetSlice()
+	if len(entities) > 0 {
+		if _, nested := entities[0].data.([]interface{}); nested {
+			for _, entity := range entities {
+				if pair := entity.GetSlice(); len(pair) == 2 {
+					members = append(members, ZMember{Member: pair[0].GetString(), Score: pair[1].GetFloat64()})
+				}
+			}
+
+			return members
+		}
+	}
+
+	for i := 0; i+1 < len(entities); i += 2 {
+		members = append(members, ZMember{Member: entities[i].GetString(), Score: entities[i+1].GetFloat64()})
+	}
+
+	return members
+}
+
+// GetMap converts a field/value reply into a map, such as the reply of HGETALL or CONFIG GET.
+// The map replies of RESP3, the cursor replies of HSCAN and ZSCAN and the WITHSCORES replies, flat or nested,
+// are supported, the latter mapping each member to its score. Returns an empty map if the reply is not one of them.
+func (k *RedisResponseEntity) GetMap() map[string]string {
+	entities := k.GetSlice()
+	if _, ok := k.data.([]interface{}); ok && len(entities) == 2 {
+		if _, cursor := entities[1].data.([]interface{}); cursor && entities[0].isScalar() {
+			entities = entities[1].GetSlice()
+		}
+	}
+
+	fields := make(map[string]string, len(entities)/2)
+	if len(entities) > 0 {
+		if _, nested := entities[0].data.([]interface{}); nested {
+			for _, entity := range entities {
+				if pair := entity.GetSlice(); len(pair) == 2 {
+					fields[pair[0].GetString()] = pair[1].GetString()
+				}
+			}
+
+			return fields
+		}
+	}
+
+	for i := 0; i+1 < len(entities); i += 2 {
+		fields[entities[i].GetString()] = entities[i+1].GetString()
+	}
+
+	return fields
+}
+
+func (k *RedisResponseEntity) isScalar() bool {
+	switch k.data.(type) {
+	case []interface{}, []string, map[interface{}]interface{}, map[string]string, nil:
+		return false
+	}
+
+	return true
+}
+
 // RedisResponse wraps a Redis reply and an optional error.
 // It embeds RedisResponseEntity to provide typed accessors for the reply payload.
 type RedisResponse struct {
@@ -897,6 +2126,67 @@ type RedisResponse struct {
 	Error error
 }
 
+// TryGetInt64 returns the error of the command, or converts the reply like RedisResponseEntity.TryGetInt64.
+func (k *RedisResponse) TryGetInt64() (int64, error) {
+	if k.Error != nil {
+		return 0, k.Error
+	}
+
+	return k.RedisResponseEntity.TryGetInt64()
+}
+
+// TryGetFloat64 returns the error of the command, or converts the reply like RedisResponseEntity.TryGetFloat64.
+func (k *RedisResponse) TryGetFloat64() (float64, error) {
+	if k.Error != nil {
+		return 0, k.Error
+	}
+
+	return k.RedisResponseEntity.TryGetFloat64()
+}
+
+// TryGetString returns the error of the command, or converts the reply like RedisResponseEntity.TryGetString.
+func (k *RedisResponse) TryGetString() (string, error) {
+	if k.Error != nil {
+		return "", k.Error
+	}
+
+	return k.RedisResponseEntity.TryGetString()
+}
+
+// Bind returns the error of the command, or sets dest from the fields of the reply converted by GetMap.
+// dest is a *map[string]string, a *map[string]float64 for WITHSCORES replies, or a struct pointer whose fields are
+// matched by the redis tag, the json tag or the field name, like FTDocument.Decode.
+func (k *RedisResponse) Bind(dest interface{}) error {
+	if k.Error != nil {
+		return k.Error
+	}
+
+	fields := k.GetMap()
+	if scores, ok := dest.(*map[string]float64); ok {
+		*scores = make(map[string]float64, len(fields))
+		for member, score := range fields {
+			f, err := strconv.ParseFloat(score, 64)
+			if err != nil {
+				return fmt.Errorf("%w: score %q of %s to float64", ErrRedisConversion, score, member)
+			}
+
+			(*scores)[member] = f
+		}
+
+		return nil
+	}
+
+	return bindRedisFields(fields, dest)
+}
+
+// Release returns the response to a pool reused by the next commands, saving its allocation on hot paths.
+// Release is opt-in, responses never released are collected by the garbage collector as usual. Using the response,
+// or the entities of its reply, after Release is undefined: it may already hold the reply of another command.
+func (k *RedisResponse) Release() {
+	*k = RedisResponse{}
+	redisResponsePool.Put(k)
+}
+
 func (k *RedisResponse) RecordNotFound() bool {
 	return errors.Is(k.Error, RedisNotFound)
 }
@@ -919,31 +2209,114 @@ func NewRedisWithProfile(profileName string, profile *secret.RedisProfile) *Redi
 	}
 
 	profile.Normalize()
+	encryption, err := NewRedisEncryption(profile.Encryption)
+	if err != nil {
+		kklogger.ErrorJ("datastore.redis#Encryption", err.Error())
+		return nil
+	}
 
 	r := &Redis{
 		name: profileName,
 	}
 
-	r.master = &RedisOp{
-		meta:   redisMetaFromAddrs(profile.MasterAddrs()),
-		client: newRedisClient(profile, profile.MasterAddrs(), false),
+	masterTuner, slaveTuner := newRedisPoolTuner(), newRedisPoolTuner()
+	masterEvents, slaveEvents := newRedisConnEvents(RedisRoleMaster), newRedisConnEvents(RedisRoleSlave)
+	masterDNS, slaveDNS := newRedisDNSRefresher(profile.MasterAddrs()), newRedisDNSRefresher(profile.SlaveAddrs())
+	master := newRedisOp(
+		redisMetaFromAddrs(profile.MasterAddrs()),
+		newRedisClient(profile, profile.MasterAddrs(), false, redisClientName(profileName), masterTuner, masterEvents, masterDNS),
+	)
+
+	slave := newRedisOp(
+		redisMetaFromAddrs(profile.SlaveAddrs()),
+		newRedisClient(profile, profile.SlaveAddrs(), profile.Mode == redisModeCluster, redisClientName(profileName), slaveTuner, slaveEvents, slaveDNS),
+	)
+
+	master.setPoolTuner(masterTuner)
+	slave.setPoolTuner(slaveTuner)
+	master.setDNSRefresher(masterDNS)
+	slave.setDNSRefresher(slaveDNS)
+	master.timeout, slave.timeout = newRedisTimeouts(profile), newRedisTimeouts(profile)
+	master.events, slave.events = masterEvents, slaveEvents
+
+	if DefaultRedisClientCache {
+		enableRedisClientCache(master, profile, profile.MasterAddrs())
+		enableRedisClientCache(slave, profile, profile.SlaveAddrs())
+	}
+
+	r.master = master
+	r.slave = slave
+	if DefaultRedisSlaveReadOnly && !profile.SlaveWritable {
+		slave.SetCommandGuard(slave.CommandGuard().WithReadOnly())
+	}
+
+	if profile.Codec != "" {
+		if codec, err := CodecByName(profile.Codec); err != nil {
+			kklogger.WarnJ("datastore:NewRedisWithProfile", err.Error())
+		} else {
+			r.SetCodec(codec)
+		}
+	}
+
+	if encryption != nil {
+		r.SetEncryption(encryption)
+	}
+
+	maxValueSize, forbidden := DefaultRedisMaxValueSize, DefaultRedisKeyForbiddenChars
+	if profile.MaxValueSize > 0 {
+		maxValueSize = profile.MaxValueSize
 	}
 
-	r.slave = &RedisOp{
-		meta:   redisMetaFromAddrs(profile.SlaveAddrs()),
-		client: newRedisClient(profile, profile.SlaveAddrs(), profile.Mode == redisModeCluster),
+	if profile.KeyForbiddenChars != "" {
+		forbidden = profile.KeyForbiddenChars
+	}
+
+	guard := NewRedisCommandGuard(profile.AllowCommands, profile.DenyCommands).WithLimits(maxValueSize, forbidden)
+	if guard != nil {
+		r.SetCommandGuard(guard)
 	}
 
 	return r
 }
 
-func newRedisClient(profile *secret.RedisProfile, addrs []string, readOnly bool) redis.UniversalClient {
+func newRedisOp(meta secret.RedisMeta, client redis.UniversalClient) *RedisOp {
+	op := &RedisOp{
+		meta:   meta,
+		client: client,
+	}
+
+	if DefaultRedisAutoPipeline && client != nil {
+		window := time.Duration(DefaultRedisAutoPipelineWindow) * time.Microsecond
+		op.batcher = newRedisAutoPipeline(client, window, DefaultRedisAutoPipelineMaxBatch, DefaultRedisAutoPipelineConcurrency)
+	}
+
+	return op
+}
+
+// redisClientName builds the CLIENT SETNAME value for the given profile.
+// Redis rejects names containing spaces, so they are replaced with underscores.
+func redisClientName(profileName string) string {
+	if DefaultRedisClientNamePrefix == "" {
+		return ""
+	}
+
+	name := DefaultRedisClientNamePrefix
+	if profileName != "" {
+		name = fmt.Sprintf("%s:%s", name, profileName)
+	}
+
+	return strings.ReplaceAll(name, " ", "_")
+}
+
+func newRedisClient(profile *secret.RedisProfile, addrs []string, readOnly bool, clientName string, tuner *redisPoolTuner, events *redisConnEvents, dns *redisDNSRefresher) redis.UniversalClient {
 	if len(addrs) == 0 {
 		return nil
 	}
 
 	options := &redis.UniversalOptions{
 		Addrs:           addrs,
+		ClientName:      clientName,
+		Protocol:        DefaultRedisProtocol,
 		Username:        profile.Username,
 		Password:        profile.Password,
 		DB:              profile.DB,
@@ -955,15 +2328,319 @@ func newRedisClient(profile *secret.RedisProfile, addrs []string, readOnly bool)
 		ReadOnly:        readOnly,
 		RouteByLatency:  profile.Cluster.RouteByLatency,
 		RouteRandomly:   profile.Cluster.RouteRandomly,
+		// the deadlines of the contexts passed to PipelineCtx and ExecCtx also bound the socket reads and writes
+		ContextTimeoutEnabled: true,
 	}
 
+	timeouts := newRedisTimeouts(profile)
+	options.ReadTimeout, options.WriteTimeout = timeouts.longest, timeouts.write
 	if DefaultRedisWait {
 		options.PoolTimeout = time.Duration(DefaultRedisDialTimeout) * time.Millisecond
 	}
 
+	applyRedisRetryPolicy(options, DefaultRedisRetryPolicy)
+
+	testOnBorrowIdle := profile.TestOnBorrowIdle
+	if testOnBorrowIdle == 0 {
+		testOnBorrowIdle = DefaultRedisTestOnBorrowIdle
+	}
+
+	if DefaultRedisDialer != nil {
+		options.Dialer = DefaultRedisDialer
+	}
+
+	if testOnBorrowIdle > 0 {
+		options.Dialer = newRedisTestOnBorrowDialer(
+			time.Duration(testOnBorrowIdle)*time.Millisecond,
+			time.Duration(DefaultRedisDialTimeout)*time.Millisecond,
+			DefaultRedisDialer,
+		)
+	}
+
+	if tuner != nil || events != nil || dns != nil {
+		if options.Dialer == nil {
+			options.Dialer = (&net.Dialer{Timeout: options.DialTimeout, KeepAlive: 5 * time.Minute}).DialContext
+		}
+
+		if events != nil {
+			options.Dialer = events.wrapDialer(options.Dialer)
+		}
+
+		if dns != nil {
+			options.Dialer = dns.wrapDialer(options.Dialer)
+		}
+
+		if tuner != nil {
+			options.Dialer = tuner.wrapDialer(options.Dialer)
+			options.MaxIdleConns = tuner.maxIdle
+		}
+	}
+
 	return redis.NewUniversalClient(options)
 }
 
+// setPoolTuner starts tuner on the pool of the operator, a nil tuner or client keeps the static pool.
+func (o *RedisOp) setPoolTuner(tuner *redisPoolTuner) {
+	if tuner == nil || o.client == nil {
+		return
+	}
+
+	o.tuner = tuner
+	tuner.start()
+}
+
+// setDNSRefresher starts dns on the pool of the operator, a nil refresher or client keeps the connections until
+// they fail or expire.
+func (o *RedisOp) setDNSRefresher(dns *redisDNSRefresher) {
+	if dns == nil || o.client == nil {
+		return
+	}
+
+	o.dns = dns
+	dns.start()
+}
+
+// applyRedisRetryPolicy maps a RetryPolicy onto the go-redis retry options, zero fields keep the go-redis defaults.
+func applyRedisRetryPolicy(options *redis.UniversalOptions, policy RetryPolicy) {
+	if policy.Attempts == 1 {
+		options.MaxRetries = -1
+	} else if policy.Attempts > 1 {
+		options.MaxRetries = policy.Attempts - 1
+	}
+
+	if policy.Interval > 0 {
+		options.MinRetryBackoff = policy.Interval
+	}
+
+	if policy.MaxInterval > 0 {
+		options.MaxRetryBackoff = policy.MaxInterval
+	}
+}
+
+// newRedisTestOnBorrowDialer returns a dialer whose connections send PING before the next command
+// once they have been idle longer than idle, so connections silently dropped by NAT/VPN idle timeouts
+// fail the check and are replaced by the client retry instead of failing the command. The connections are
+// opened by dial, a net.Dialer when nil.
+func newRedisTestOnBorrowDialer(idle, timeout time.Duration, dial DialContextFunc) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: timeout, KeepAlive: 5 * time.Minute}).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &redisTestOnBorrowConn{Conn: conn, idle: idle, timeout: timeout, lastUsed: time.Now()}, nil
+	}
+}
+
+var redisPingCommand = []byte("*1\r\n$4\r\nPING\r\n")
+
+// redisSubscribeCommands switch a connection into push mode where PING replies differ, those connections are never checked.
+var redisSubscribeCommands = [][]byte{[]byte("subscribe"), []byte("psubscribe"), []byte("ssubscribe"), []byte("monitor")}
+
+type redisTestOnBorrowConn struct {
+	net.Conn
+	idle          time.Duration
+	timeout       time.Duration
+	lastUsed      time.Time
+	writeDeadline time.Time
+	subscribed    bool
+	// pending holds the push messages received before the reply of the check, read by the client first.
+	pending []byte
+}
+
+func (c *redisTestOnBorrowConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+
+	n, err := c.Conn.Read(b)
+	c.lastUsed = time.Now()
+	return n, err
+}
+
+func (c *redisTestOnBorrowConn) Write(b []byte) (int, error) {
+	if !c.subscribed && redisIsSubscribeCommand(b) {
+		c.subscribed = true
+	}
+
+	if !c.subscribed && time.Since(c.lastUsed) > c.idle {
+		if err := c.ping(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.Conn.Write(b)
+	c.lastUsed = time.Now()
+	return n, err
+}
+
+func (c *redisTestOnBorrowConn) SetDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *redisTestOnBorrowConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// SyscallConn exposes the underlying socket so the pool can keep running its own liveness check.
+func (c *redisTestOnBorrowConn) SyscallConn() (syscall.RawConn, error) {
+	if conn, ok := c.Conn.(syscall.Conn); ok {
+		return conn.SyscallConn()
+	}
+
+	return nil, errors.New("redis: underlying connection does not support SyscallConn")
+}
+
+// ping runs a PING round trip on the raw connection and restores the caller's write deadline afterwards. The
+// reply is a simple or bulk string in RESP2 and RESP3, push messages of RESP3 received before it, like the
+// invalidations of client side caching, are kept for the client.
+func (c *redisTestOnBorrowConn) ping() error {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+
+	if _, err := c.Conn.Write(redisPingCommand); err != nil {
+		return err
+	}
+
+	for {
+		reply, err := redisReadReply(c.Conn)
+		if err != nil {
+			return err
+		}
+
+		if reply[0] == '>' {
+			c.pending = append(c.pending, reply...)
+			continue
+		}
+
+		if !redisIsPong(reply) {
+			return fmt.Errorf("redis: test on borrow got unexpected reply %q: %w", reply, io.ErrUnexpectedEOF)
+		}
+
+		break
+	}
+
+	if err := c.Conn.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	return c.Conn.SetWriteDeadline(c.writeDeadline)
+}
+
+// redisIsPong reports whether reply is PONG as a simple or a bulk string.
+func redisIsPong(reply []byte) bool {
+	return bytes.Equal(reply, []byte("+PONG\r\n")) || bytes.Equal(reply, []byte("$4\r\nPONG\r\n"))
+}
+
+// redisReadReply reads the raw bytes of one RESP2 or RESP3 reply from r, without reading past its end since the
+// rest of the stream belongs to the client.
+func redisReadReply(r io.Reader) ([]byte, error) {
+	line, err := redisReadLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 {
+		return nil, fmt.Errorf("redis: invalid reply %q: %w", line, io.ErrUnexpectedEOF)
+	}
+
+	switch line[0] {
+	case '+', '-', ':', ',', '#', '_', '(':
+		return line, nil
+	case '$', '!', '=':
+		n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+		if err != nil {
+			return nil, err
+		}
+
+		if n < 0 {
+			return line, nil
+		}
+
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+
+		return append(line, data...), nil
+	case '*', '~', '>', '%', '|':
+		n, err := strconv.Atoi(string(line[1 : len(line)-2]))
+		if err != nil {
+			return nil, err
+		}
+
+		if line[0] == '%' || line[0] == '|' {
+			n *= 2
+		}
+
+		reply := line
+		for i := 0; i < n; i++ {
+			element, err := redisReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+
+			reply = append(reply, element...)
+		}
+
+		if line[0] == '|' {
+			// Attributes precede the reply they describe
+			next, err := redisReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return next, nil
+		}
+
+		return reply, nil
+	default:
+		return nil, fmt.Errorf("redis: invalid reply %q: %w", line, io.ErrUnexpectedEOF)
+	}
+}
+
+// redisReadLine reads up to and including the next CRLF from r one byte at a time.
+func redisReadLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+
+		line = append(line, b[0])
+	}
+
+	return line, nil
+}
+
+// redisIsSubscribeCommand reports whether the first command of a RESP request is a subscribe style command.
+func redisIsSubscribeCommand(b []byte) bool {
+	// *<argc>\r\n$<len>\r\n<name>\r\n
+	parts := bytes.SplitN(b, []byte("\r\n"), 4)
+	if len(parts) < 3 {
+		return false
+	}
+
+	name := bytes.ToLower(parts[2])
+	for _, cmd := range redisSubscribeCommands {
+		if bytes.Equal(name, cmd) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Sorted Set commands
 // ZAdd adds all the specified members with the specified scores to the sorted set stored at key.
 func (o *RedisOp) ZAdd(key interface{}, score float64, member interface{}, pairs ...interface{}) *RedisResponse {
@@ -972,6 +2649,76 @@ func (o *RedisOp) ZAdd(key interface{}, score float64, member interface{}, pairs
 	return o._Do("ZADD", args...)
 }
 
+// ZAddOptions defines options for the ZAddWithOptions command.
+// NX cannot be combined with XX, GT or LT, nor GT with LT.
+type ZAddOptions struct {
+	// NX - Only add new elements, never update existing ones
+	NX bool
+	// XX - Only update existing elements, never add new ones
+	XX bool
+	// GT - Only update existing elements if the new score is greater than the current score
+	GT bool
+	// LT - Only update existing elements if the new score is less than the current score
+	LT bool
+	// CH - Return the number of changed elements (added and updated) instead of added ones
+	CH bool
+	// INCR - Increment the score like ZINCRBY and return the new score; only one score/member pair is allowed
+	INCR bool
+}
+
+// ZAddWithOptions adds the specified members with scores to the sorted set stored at key with additional options.
+func (o *RedisOp) ZAddWithOptions(key interface{}, opts ZAddOptions, score float64, member interface{}, pairs ...interface{}) *RedisResponse {
+	args, err := zaddArgs(key, opts, score, member, pairs)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return o._Do("ZADD", args...)
+}
+
+// zaddArgs returns the arguments of ZADD, failing like Redis on the flags it does not combine.
+func zaddArgs(key interface{}, opts ZAddOptions, score float64, member interface{}, pairs []interface{}) ([]interface{}, error) {
+	if opts.NX && opts.XX {
+		return nil, fmt.Errorf("%w: XX and NX options at the same time are not compatible", ErrRedisOptionsConflict)
+	}
+
+	if (opts.GT && opts.LT) || (opts.NX && (opts.GT || opts.LT)) {
+		return nil, fmt.Errorf("%w: GT, LT, and/or NX options at the same time are not compatible", ErrRedisOptionsConflict)
+	}
+
+	if opts.INCR && len(pairs) > 0 {
+		return nil, fmt.Errorf("%w: INCR option supports a single increment-element pair", ErrRedisOptionsConflict)
+	}
+
+	args := []interface{}{key}
+	if opts.NX {
+		args = append(args, "NX")
+	}
+
+	if opts.XX {
+		args = append(args, "XX")
+	}
+
+	if opts.GT {
+		args = append(args, "GT")
+	}
+
+	if opts.LT {
+		args = append(args, "LT")
+	}
+
+	if opts.CH {
+		args = append(args, "CH")
+	}
+
+	if opts.INCR {
+		args = append(args, "INCR")
+	}
+
+	args = append(args, score, member)
+	return append(args, pairs...), nil
+}
+
 // ZCard returns the sorted set cardinality (number of elements) of the sorted set stored at key.
 func (o *RedisOp) ZCard(key interface{}) *RedisResponse {
 	return o._Do("ZCARD", key)
@@ -1073,11 +2820,67 @@ func (o *RedisOp) ZRandMember(key interface{}) *RedisResponse {
 	return o._Do("ZRANDMEMBER", key)
 }
 
+// ZRandMemberN returns up to count random members from the sorted set without removing them.
+// A negative count allows the same member to be returned multiple times.
+// With withScores, each member is followed by its score.
+func (o *RedisOp) ZRandMemberN(key interface{}, count int64, withScores bool) *RedisResponse {
+	args := []interface{}{key, count}
+	if withScores {
+		args = append(args, "WITHSCORES")
+	}
+	return o._Do("ZRANDMEMBER", args...)
+}
+
 // ZRange returns the specified range of members in the sorted set stored at key by index.
 func (o *RedisOp) ZRange(key interface{}, start, stop int64) *RedisResponse {
 	return o._Do("ZRANGE", key, start, stop)
 }
 
+// ZRangeOptions defines options for the ZRangeWithOptions command.
+type ZRangeOptions struct {
+	// ByScore - Treat start and stop as score ranges, e.g. "(1" or "+inf"
+	ByScore bool
+	// ByLex - Treat start and stop as lexicographical ranges, e.g. "[a" or "-"
+	ByLex bool
+	// Rev - Reverse the ordering, returning elements from highest to lowest
+	Rev bool
+	// Offset - Number of matching elements to skip, only used when Count is non-zero
+	Offset int64
+	// Count - Maximum number of elements to return (LIMIT), 0 means no limit and negative means all from Offset
+	Count int64
+	// WithScores - Return the score of each element, use GetZMembers to read the pairs
+	WithScores bool
+}
+
+// ZRangeWithOptions returns the specified range of elements in the sorted set stored at key with additional options.
+// LIMIT is only valid together with ByScore or ByLex.
+func (o *RedisOp) ZRangeWithOptions(key interface{}, start, stop string, opts ZRangeOptions) *RedisResponse {
+	return o._Do("ZRANGE", zrangeArgs(key, start, stop, opts)...)
+}
+
+func zrangeArgs(key interface{}, start, stop string, opts ZRangeOptions) []interface{} {
+	args := []interface{}{key, start, stop}
+	if opts.ByScore {
+		args = append(args, "BYSCORE")
+	} else if opts.ByLex {
+		args = append(args, "BYLEX")
+	}
+
+	if opts.Rev {
+		args = append(args, "REV")
+	}
+
+	if opts.Count != 0 {
+		args = append(args, "LIMIT", opts.Offset, opts.Count)
+	}
+
+	if opts.WithScores {
+		args = append(args, "WITHSCORES")
+	}
+
+	return args
+}
+
 // ZRangeByLex returns all the elements in the sorted set with a value between min and max, lexicographically.
 func (o *RedisOp) ZRangeByLex(key interface{}, min, max string) *RedisResponse {
 	return o._Do("ZRANGEBYLEX", key, min, max)
@@ -0,0 +1,271 @@
+package datastore
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TTL buckets of KeyPrefixStats.TTL, a key falls in the first bucket its remaining time is below.
+const (
+	KeyTTLPersistent = "persistent"
+	KeyTTLMinute     = "<1m"
+	KeyTTLHour       = "<1h"
+	KeyTTLDay        = "<1d"
+	KeyTTLWeek       = "<7d"
+	KeyTTLLonger     = ">=7d"
+)
+
+// KeyAnalyzer scans the keyspace and aggregates key counts, memory usage, TTLs and types by key prefix,
+// e.g. "user" for "user:1:profile" with the default Separator and Depth.
+// Like Scan, it iterates the keyspace of a single node and does not block it, keys are inspected in pipelines.
+type KeyAnalyzer struct {
+	op RedisOperator
+	// Pattern limits the scanned keys, e.g. "session:*", every key when empty
+	Pattern string
+	// Separator splits keys into segments, ":" when created
+	Separator string
+	// Depth is the number of leading segments forming the prefix, keys without Separator have the empty prefix
+	Depth int
+	// BatchSize is the SCAN COUNT hint and the number of keys inspected per pipeline
+	BatchSize int64
+	// MemorySample measures MEMORY USAGE of every Nth key of a prefix and extrapolates it to the others,
+	// 1 measures every key and 0 disables memory estimates
+	MemorySample int
+	// Progress is called with the stats so far after each batch, returning an error stops the scan with that error
+	Progress func(analysis KeyAnalysis) error
+}
+
+// KeyPrefixStats are the stats of the keys sharing a prefix.
+type KeyPrefixStats struct {
+	Prefix string
+	Keys   int64
+	// Memory is the estimated size in bytes, extrapolated from the sampled keys
+	Memory int64
+	// Types counts the keys by TYPE, e.g. "string" or "hash"
+	Types map[string]int64
+	// TTL counts the keys by remaining time, see KeyTTLPersistent and the other buckets
+	TTL map[string]int64
+
+	// seen counts the scanned keys choosing the sampled ones, measured and measuredMemory the MEMORY USAGE replies
+	seen           int64
+	measured       int64
+	measuredMemory int64
+}
+
+// KeyAnalysis are the stats of the scanned keys by prefix.
+type KeyAnalysis struct {
+	Keys     int64
+	Memory   int64
+	Prefixes map[string]*KeyPrefixStats
+}
+
+// Sorted returns the prefix stats ordered by estimated memory, then by key count, largest first.
+func (a KeyAnalysis) Sorted() []*KeyPrefixStats {
+	stats := make([]*KeyPrefixStats, 0, len(a.Prefixes))
+	for _, s := range a.Prefixes {
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Memory != stats[j].Memory {
+			return stats[i].Memory > stats[j].Memory
+		}
+
+		if stats[i].Keys != stats[j].Keys {
+			return stats[i].Keys > stats[j].Keys
+		}
+
+		return stats[i].Prefix < stats[j].Prefix
+	})
+
+	return stats
+}
+
+// NewKeyAnalyzer returns a KeyAnalyzer of op grouping keys by their first ":" separated segment.
+func NewKeyAnalyzer(op RedisOperator) *KeyAnalyzer {
+	return &KeyAnalyzer{
+		op:           op,
+		Separator:    ":",
+		Depth:        1,
+		BatchSize:    int64(max(DefaultRedisDeleteBatchSize, 1)),
+		MemorySample: 10,
+	}
+}
+
+// Analyze scans the keys and returns their stats, the stats so far are returned with an error.
+func (a *KeyAnalyzer) Analyze() (KeyAnalysis, error) {
+	analysis := KeyAnalysis{Prefixes: map[string]*KeyPrefixStats{}}
+	pattern := a.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	batchSize := max(a.BatchSize, 1)
+	cursor := int64(0)
+	for {
+		resp := a.op.Do("SCAN", cursor, "MATCH", pattern, "COUNT", batchSize)
+		if resp.Error != nil {
+			return analysis, resp.Error
+		}
+
+		parts := resp.GetSlice()
+		if len(parts) != 2 {
+			return analysis, errors.New("invalid scan response")
+		}
+
+		// The cursor is a bulk string, GetInt64 only parses []byte
+		next, err := strconv.ParseInt(parts[0].GetString(), 10, 64)
+		if err != nil {
+			return analysis, err
+		}
+
+		keys := make([]string, 0, batchSize)
+		for _, key := range parts[1].GetSlice() {
+			keys = append(keys, key.GetString())
+		}
+
+		for len(keys) > 0 {
+			n := min(int64(len(keys)), batchSize)
+			if err := a.inspect(&analysis, keys[:n]); err != nil {
+				return analysis, err
+			}
+
+			keys = keys[n:]
+		}
+
+		if a.Progress != nil {
+			if err := a.Progress(analysis.snapshot()); err != nil {
+				return analysis, err
+			}
+		}
+
+		if cursor = next; cursor == 0 {
+			return analysis, nil
+		}
+	}
+}
+
+// inspect reads the type, TTL and sampled memory usage of keys in one pipeline.
+func (a *KeyAnalyzer) inspect(analysis *KeyAnalysis, keys []string) error {
+	type inspected struct {
+		stats   *KeyPrefixStats
+		measure bool
+	}
+
+	items := make([]inspected, len(keys))
+	cmds := make([]RedisPipelineCmd, 0, len(keys)*3)
+	for i, key := range keys {
+		prefix := a.prefix(key)
+		stats := analysis.Prefixes[prefix]
+		if stats == nil {
+			stats = &KeyPrefixStats{Prefix: prefix, Types: map[string]int64{}, TTL: map[string]int64{}}
+			analysis.Prefixes[prefix] = stats
+		}
+
+		stats.seen++
+		items[i] = inspected{stats: stats, measure: a.MemorySample > 0 && (stats.seen-1)%int64(a.MemorySample) == 0}
+		cmds = append(cmds, RedisPipelineCmd{Cmd: "TYPE", Args: []interface{}{key}}, RedisPipelineCmd{Cmd: "PTTL", Args: []interface{}{key}})
+		if items[i].measure {
+			cmds = append(cmds, RedisPipelineCmd{Cmd: "MEMORY", Args: []interface{}{"USAGE", key}})
+		}
+	}
+
+	responses := a.op.Pipeline(cmds...)
+	if len(responses) != len(cmds) {
+		return errors.New("invalid pipeline response")
+	}
+
+	for _, item := range items {
+		kind, ttl := responses[0], responses[1]
+		responses = responses[2:]
+		var memory *RedisResponse
+		if item.measure {
+			memory, responses = responses[0], responses[1:]
+		}
+
+		if kind.Error != nil {
+			return kind.Error
+		}
+
+		// Skip keys expired or deleted since SCAN returned them
+		if kind.GetString() == "none" {
+			continue
+		}
+
+		item.stats.Keys++
+		item.stats.Types[kind.GetString()]++
+		item.stats.TTL[keyTTLBucket(ttl.GetInt64())]++
+		analysis.Keys++
+		// MEMORY is not available on every server, e.g. when renamed, keys are counted without estimate
+		if memory != nil && memory.Error == nil && memory.GetInt64() > 0 {
+			item.stats.measured++
+			item.stats.measuredMemory += memory.GetInt64()
+		}
+	}
+
+	analysis.Memory = 0
+	for _, stats := range analysis.Prefixes {
+		if stats.measured > 0 {
+			stats.Memory = stats.measuredMemory * stats.Keys / stats.measured
+		}
+
+		analysis.Memory += stats.Memory
+	}
+
+	return nil
+}
+
+func (a *KeyAnalyzer) prefix(key string) string {
+	if a.Separator == "" {
+		return ""
+	}
+
+	segments := strings.SplitN(key, a.Separator, max(a.Depth, 1)+1)
+	if len(segments) == 1 {
+		return ""
+	}
+
+	return strings.Join(segments[:min(len(segments)-1, max(a.Depth, 1))], a.Separator)
+}
+
+func (a KeyAnalysis) snapshot() KeyAnalysis {
+	snapshot := KeyAnalysis{Keys: a.Keys, Memory: a.Memory, Prefixes: make(map[string]*KeyPrefixStats, len(a.Prefixes))}
+	for prefix, stats := range a.Prefixes {
+		copied := *stats
+		copied.Types = make(map[string]int64, len(stats.Types))
+		for k, v := range stats.Types {
+			copied.Types[k] = v
+		}
+
+		copied.TTL = make(map[string]int64, len(stats.TTL))
+		for k, v := range stats.TTL {
+			copied.TTL[k] = v
+		}
+
+		snapshot.Prefixes[prefix] = &copied
+	}
+
+	return snapshot
+}
+
+func keyTTLBucket(pttl int64) string {
+	if pttl < 0 {
+		return KeyTTLPersistent
+	}
+
+	switch ttl := time.Duration(pttl) * time.Millisecond; {
+	case ttl < time.Minute:
+		return KeyTTLMinute
+	case ttl < time.Hour:
+		return KeyTTLHour
+	case ttl < 24*time.Hour:
+		return KeyTTLDay
+	case ttl < 7*24*time.Hour:
+		return KeyTTLWeek
+	default:
+		return KeyTTLLonger
+	}
+}
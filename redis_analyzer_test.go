@@ -0,0 +1,142 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestKeyAnalyzer(t *testing.T) {
+	t.Run("Mock", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		for i := 0; i < 20; i++ {
+			op.Set(fmt.Sprintf("session:%d", i), "token")
+		}
+
+		for i := 0; i < 5; i++ {
+			op.SetExpire(fmt.Sprintf("user:%d:profile", i), "profile", 3600*48)
+			op.HSet(fmt.Sprintf("user:%d:roles", i), "admin", "1")
+		}
+
+		op.Set("config", "1")
+
+		var reports []KeyAnalysis
+		analyzer := NewKeyAnalyzer(op)
+		analyzer.MemorySample = 1
+		analyzer.Progress = func(analysis KeyAnalysis) error {
+			reports = append(reports, analysis)
+			return nil
+		}
+
+		analysis, err := analyzer.Analyze()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(31), analysis.Keys)
+		assert.Len(t, reports, 1)
+		assert.Equal(t, analysis.Keys, reports[0].Keys)
+
+		session := analysis.Prefixes["session"]
+		assert.Equal(t, int64(20), session.Keys)
+		assert.Equal(t, map[string]int64{"string": 20}, session.Types)
+		assert.Equal(t, map[string]int64{KeyTTLPersistent: 20}, session.TTL)
+		assert.Greater(t, session.Memory, int64(0))
+
+		user := analysis.Prefixes["user"]
+		assert.Equal(t, int64(10), user.Keys)
+		assert.Equal(t, map[string]int64{"string": 5, "hash": 5}, user.Types)
+		assert.Equal(t, map[string]int64{KeyTTLPersistent: 5, KeyTTLWeek: 5}, user.TTL)
+		assert.Equal(t, int64(1), analysis.Prefixes[""].Keys)
+		assert.Equal(t, session.Memory+user.Memory+analysis.Prefixes[""].Memory, analysis.Memory)
+		assert.Equal(t, "session", analysis.Sorted()[0].Prefix)
+	})
+
+	t.Run("Depth and pattern", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		op.Set("user:1:profile", "a")
+		op.Set("user:2:profile", "b")
+		op.Set("user:1", "c")
+		op.Set("session:1", "d")
+
+		analyzer := NewKeyAnalyzer(op)
+		analyzer.Pattern = "user:*"
+		analyzer.Depth = 2
+		analyzer.MemorySample = 0
+		analysis, err := analyzer.Analyze()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), analysis.Keys)
+		assert.Len(t, analysis.Prefixes, 3)
+		assert.Equal(t, int64(1), analysis.Prefixes["user:1"].Keys)
+		assert.Equal(t, int64(1), analysis.Prefixes["user"].Keys)
+		assert.Equal(t, int64(0), analysis.Memory)
+	})
+
+	t.Run("Memory sampling", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		for i := 0; i < 30; i++ {
+			op.Set(fmt.Sprintf("item:%02d", i), "value")
+		}
+
+		analyzer := NewKeyAnalyzer(op)
+		analyzer.MemorySample = 1
+		full, err := analyzer.Analyze()
+		assert.NoError(t, err)
+
+		analyzer.MemorySample = 10
+		sampled, err := analyzer.Analyze()
+		assert.NoError(t, err)
+		assert.Equal(t, full.Memory, sampled.Memory)
+		assert.Equal(t, int64(3), sampled.Prefixes["item"].measured)
+	})
+
+	t.Run("Progress stops", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		op.Set("a:1", 1)
+		stop := errors.New("stop")
+		analyzer := NewKeyAnalyzer(op)
+		analyzer.Progress = func(analysis KeyAnalysis) error {
+			return stop
+		}
+
+		analysis, err := analyzer.Analyze()
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, int64(1), analysis.Keys)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		op := redis.Master()
+		defer op.DeleteByPattern("key_analyzer:*", 100)
+		for i := 0; i < 50; i++ {
+			op.SetExpire(fmt.Sprintf("key_analyzer:session:%d", i), "token", 120)
+		}
+
+		op.HSet("key_analyzer:user:1", "name", "goth")
+
+		analyzer := NewKeyAnalyzer(op)
+		analyzer.Pattern = "key_analyzer:*"
+		analyzer.Depth = 2
+		analyzer.BatchSize = 7
+		analysis, err := analyzer.Analyze()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(51), analysis.Keys)
+		session := analysis.Prefixes["key_analyzer:session"]
+		assert.Equal(t, int64(50), session.Keys)
+		assert.Equal(t, map[string]int64{KeyTTLHour: 50}, session.TTL)
+		assert.Greater(t, session.Memory, int64(0))
+		assert.Equal(t, map[string]int64{"hash": 1}, analysis.Prefixes["key_analyzer:user"].Types)
+	})
+}
@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// RedisAuditRedacted replaces the values redacted by a RedisAuditRule in the entries of a RedisAudit.
+const RedisAuditRedacted = "[redacted]"
+
+// RedisAuditEntry is a command logged by a RedisAudit, with the arguments in the form sent to the server unless
+// redacted.
+type RedisAuditEntry struct {
+	Time     time.Time     `json:"time"`
+	Addr     string        `json:"addr"`
+	Cmd      string        `json:"cmd"`
+	Args     []string      `json:"args,omitempty"`
+	Duration time.Duration `json:"duration"`
+	// Error is the message of the error of the command, "not_found" for RedisNotFound
+	Error string `json:"error,omitempty"`
+}
+
+// RedisAuditRule applies to the commands on the keys matching Pattern, a glob like the pattern of KEYS. The
+// first rule matching a key applies to it.
+type RedisAuditRule struct {
+	Pattern string
+	// Always logs every command on the keys, whatever the sample rate of the audit
+	Always bool
+	// RedactKeys replaces the keys with "sha256:" and the start of their digest, the commands on a key can still be
+	// correlated
+	RedactKeys bool
+	// RedactValues replaces the arguments other than keys with RedisAuditRedacted
+	RedactValues bool
+}
+
+// RedisAudit logs the commands sent by the operators it is set on, see RedisOp.SetAudit, for compliance
+// investigations on sensitive keys. A sample of the commands is logged, every command on the keys of the rules
+// with Always, and the rules redact the keys and values not to be written to the log.
+type RedisAudit struct {
+	rate     float64
+	handler  func(entry RedisAuditEntry)
+	rules    []RedisAuditRule
+	commands map[string]bool
+}
+
+// NewRedisAudit returns an audit logging the fraction rate of the commands, 0.01 for one percent and 1 for
+// every command, passed to handler. A nil handler logs the entries with kklogger.
+func NewRedisAudit(rate float64, handler func(entry RedisAuditEntry)) *RedisAudit {
+	if handler == nil {
+		handler = func(entry RedisAuditEntry) {
+			kklogger.InfoJ("datastore:RedisAudit", entry)
+		}
+	}
+
+	return &RedisAudit{rate: rate, handler: handler}
+}
+
+// WithRules returns a copy of the audit also applying rules, after the rules it already has.
+func (a *RedisAudit) WithRules(rules ...RedisAuditRule) *RedisAudit {
+	audit := *a
+	audit.rules = append(append([]RedisAuditRule(nil), a.rules...), rules...)
+	return &audit
+}
+
+// WithCommands returns a copy of the audit only logging commands, case-insensitive. Empty logs every command.
+func (a *RedisAudit) WithCommands(commands ...string) *RedisAudit {
+	audit := *a
+	audit.commands = nil
+	if len(commands) > 0 {
+		audit.commands = redisCommandSet(commands)
+	}
+
+	return &audit
+}
+
+// rule returns the first rule matching key, nil when none does.
+func (a *RedisAudit) rule(key string) *RedisAuditRule {
+	for i := range a.rules {
+		if mockGlobMatch(a.rules[i].Pattern, key) {
+			return &a.rules[i]
+		}
+	}
+
+	return nil
+}
+
+// log passes the entry of cmd, sent to addr at start, to the handler when it is sampled.
+func (a *RedisAudit) log(addr, cmd string, args []interface{}, start time.Time, err error) {
+	if a == nil {
+		return
+	}
+
+	name := strings.ToUpper(cmd)
+	if len(a.commands) > 0 && !a.commands[name] {
+		return
+	}
+
+	always, redactValues := false, false
+	var keys map[int]*RedisAuditRule
+	if len(a.rules) > 0 {
+		indexes := redisCommandKeyIndexes(name, args)
+		keys = make(map[int]*RedisAuditRule, len(indexes))
+		for _, i := range indexes {
+			rule := a.rule(redisClientCacheKey(args[i]))
+			keys[i] = rule
+			if rule != nil {
+				always = always || rule.Always
+				redactValues = redactValues || rule.RedactValues
+			}
+		}
+	}
+
+	if !always && (a.rate <= 0 || a.rate < 1 && rand.Float64() >= a.rate) {
+		return
+	}
+
+	entry := RedisAuditEntry{Time: start, Addr: addr, Cmd: cmd, Duration: time.Since(start)}
+	if len(args) > 0 {
+		entry.Args = make([]string, len(args))
+	}
+
+	for i, arg := range args {
+		rule, isKey := keys[i]
+		switch {
+		case isKey && rule != nil && rule.RedactKeys:
+			sum := sha256.Sum256([]byte(mockArgString(arg)))
+			entry.Args[i] = "sha256:" + hex.EncodeToString(sum[:8])
+		case !isKey && redactValues:
+			entry.Args[i] = RedisAuditRedacted
+		default:
+			entry.Args[i] = mockArgString(arg)
+		}
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	a.handler(entry)
+}
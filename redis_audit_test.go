@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisAudit(t *testing.T) {
+	var mutex sync.Mutex
+	var entries []RedisAuditEntry
+	handler := func(entry RedisAuditEntry) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		entries = append(entries, entry)
+	}
+
+	logged := func() []RedisAuditEntry {
+		mutex.Lock()
+		defer mutex.Unlock()
+		defer func() {
+			entries = nil
+		}()
+
+		return entries
+	}
+
+	t.Run("Sampling", func(t *testing.T) {
+		start := time.Now()
+		NewRedisAudit(0, handler).log("addr", "GET", []interface{}{"k"}, start, nil)
+		assert.Empty(t, logged())
+
+		audit := NewRedisAudit(0.5, handler)
+		for i := 0; i < 1000; i++ {
+			audit.log("addr", "GET", []interface{}{"k"}, start, nil)
+		}
+
+		assert.InDelta(t, 500, len(logged()), 100)
+
+		// Rules with Always log every command on their keys
+		audit = NewRedisAudit(0, handler).WithRules(RedisAuditRule{Pattern: "pii:*", Always: true})
+		audit.log("addr", "GET", []interface{}{"pii:1"}, start, nil)
+		audit.log("addr", "GET", []interface{}{"public:1"}, start, nil)
+		audit.log("addr", "MGET", []interface{}{"public:1", "pii:2"}, start, nil)
+		assert.Len(t, logged(), 2)
+
+		audit = NewRedisAudit(1, handler).WithCommands("set")
+		audit.log("addr", "GET", []interface{}{"k"}, start, nil)
+		audit.log("addr", "SET", []interface{}{"k", "v"}, start, nil)
+		assert.Len(t, logged(), 1)
+	})
+
+	t.Run("Redaction", func(t *testing.T) {
+		audit := NewRedisAudit(1, handler).WithRules(
+			RedisAuditRule{Pattern: "card:*", RedactKeys: true, RedactValues: true},
+			RedisAuditRule{Pattern: "user:*", RedactValues: true},
+		)
+
+		start := time.Now()
+		audit.log("addr", "SET", []interface{}{"card:1", "4111111111111111"}, start, nil)
+		audit.log("addr", "HSET", []interface{}{"user:1", "email", "a@b.c"}, start, RedisNotFound)
+		audit.log("addr", "MSET", []interface{}{"card:1", "1", "other", "2"}, start, nil)
+		audit.log("addr", "SET", []interface{}{"other", "v"}, start, nil)
+
+		entries := logged()
+		assert.Len(t, entries, 4)
+		assert.Equal(t, []string{"sha256:6912a3f4acee3359", RedisAuditRedacted}, entries[0].Args)
+		assert.Equal(t, []string{"user:1", RedisAuditRedacted, RedisAuditRedacted}, entries[1].Args)
+		assert.Equal(t, "not_found", entries[1].Error)
+		assert.Equal(t, []string{"sha256:6912a3f4acee3359", RedisAuditRedacted, "other", RedisAuditRedacted}, entries[2].Args)
+		assert.Equal(t, []string{"other", "v"}, entries[3].Args)
+		assert.Equal(t, "addr", entries[3].Addr)
+		assert.Equal(t, start, entries[3].Time)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		redis.SetAudit(NewRedisAudit(1, handler).WithRules(RedisAuditRule{Pattern: "test_audit*", RedactValues: true}))
+		op := redis.Master()
+		op.Set("test_audit", "secret")
+		op.Get("test_audit")
+		op.Pipeline(RedisPipelineCmd{Cmd: "DEL", Args: []interface{}{"test_audit"}})
+		op.Get("test_audit")
+		redis.SetAudit(nil)
+		op.Get("test_audit")
+
+		entries := logged()
+		assert.Len(t, entries, 4)
+		assert.Equal(t, "SET", entries[0].Cmd)
+		assert.Equal(t, []string{"test_audit", RedisAuditRedacted}, entries[0].Args)
+		assert.Equal(t, "127.0.0.1:6379", entries[0].Addr)
+		assert.Equal(t, "DEL", entries[2].Cmd)
+		assert.Equal(t, "not_found", entries[3].Error)
+	})
+}
@@ -0,0 +1,171 @@
+package datastore
+
+// RedisBloomFilter is a Bloom filter of RedisBloom stored at a key, see NewRedisBloomFilter.
+// The commands fail with ErrRedisModuleNotLoaded when the server does not provide RedisBloom,
+// detected once on first use, so keep the filter instead of creating one per call.
+type RedisBloomFilter struct {
+	op     RedisOperator
+	key    string
+	module redisModule
+}
+
+// BFReserveOptions configures RedisBloomFilter.Reserve.
+type BFReserveOptions struct {
+	// Expansion is the capacity growth factor of the sub-filters added when the filter is full, 2 by the server when 0
+	Expansion int64
+	// NonScaling fails adds once the filter is full instead of adding a sub-filter
+	NonScaling bool
+}
+
+// NewRedisBloomFilter returns the Bloom filter stored at key of op.
+func NewRedisBloomFilter(op RedisOperator, key string) *RedisBloomFilter {
+	return &RedisBloomFilter{op: op, key: key, module: redisModule{name: "bf", command: "BF.ADD"}}
+}
+
+// Key returns the key of the filter.
+func (f *RedisBloomFilter) Key() string {
+	return f.key
+}
+
+// Reserve creates the filter for capacity items with the false positive errorRate, e.g. 0.001.
+// Filters created by a first Add have the capacity and error rate of the server defaults.
+func (f *RedisBloomFilter) Reserve(errorRate float64, capacity int64, opts BFReserveOptions) error {
+	args := []interface{}{f.key, errorRate, capacity}
+	if opts.Expansion > 0 {
+		args = append(args, "EXPANSION", opts.Expansion)
+	}
+
+	if opts.NonScaling {
+		args = append(args, "NONSCALING")
+	}
+
+	return f.do("BF.RESERVE", args...).Error
+}
+
+// Add adds item and reports whether it was added, false when it may have been added before.
+func (f *RedisBloomFilter) Add(item interface{}) (bool, error) {
+	resp := f.do("BF.ADD", f.key, item)
+	return redisBool(resp.RedisResponseEntity), resp.Error
+}
+
+// MAdd adds items and reports for each whether it was added.
+func (f *RedisBloomFilter) MAdd(items ...interface{}) ([]bool, error) {
+	resp := f.do("BF.MADD", append([]interface{}{f.key}, items...)...)
+	return redisBools(resp), resp.Error
+}
+
+// Exists reports whether item may have been added, false means it was certainly not.
+func (f *RedisBloomFilter) Exists(item interface{}) (bool, error) {
+	resp := f.do("BF.EXISTS", f.key, item)
+	return redisBool(resp.RedisResponseEntity), resp.Error
+}
+
+// MExists reports for each of items whether it may have been added.
+func (f *RedisBloomFilter) MExists(items ...interface{}) ([]bool, error) {
+	resp := f.do("BF.MEXISTS", append([]interface{}{f.key}, items...)...)
+	return redisBools(resp), resp.Error
+}
+
+// Card returns the number of items added to the filter.
+func (f *RedisBloomFilter) Card() (int64, error) {
+	resp := f.do("BF.CARD", f.key)
+	return resp.GetInt64(), resp.Error
+}
+
+func (f *RedisBloomFilter) do(cmd string, args ...interface{}) *RedisResponse {
+	if err := f.module.check(f.op); err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return f.op.Do(cmd, args...)
+}
+
+// RedisCuckooFilter is a Cuckoo filter of RedisBloom stored at a key, see NewRedisCuckooFilter.
+// Unlike a Bloom filter, items can be deleted and counted. Like RedisBloomFilter, commands fail with
+// ErrRedisModuleNotLoaded without RedisBloom.
+type RedisCuckooFilter struct {
+	op     RedisOperator
+	key    string
+	module redisModule
+}
+
+// CFReserveOptions configures RedisCuckooFilter.Reserve, zero values use the server defaults.
+type CFReserveOptions struct {
+	// BucketSize is the number of items per bucket, larger buckets raise the error rate and the fill rate
+	BucketSize int64
+	// MaxIterations is the number of swaps before the filter is considered full
+	MaxIterations int64
+	// Expansion is the capacity growth factor of the sub-filters added when the filter is full
+	Expansion int64
+}
+
+// NewRedisCuckooFilter returns the Cuckoo filter stored at key of op.
+func NewRedisCuckooFilter(op RedisOperator, key string) *RedisCuckooFilter {
+	return &RedisCuckooFilter{op: op, key: key, module: redisModule{name: "bf", command: "CF.ADD"}}
+}
+
+// Key returns the key of the filter.
+func (f *RedisCuckooFilter) Key() string {
+	return f.key
+}
+
+// Reserve creates the filter for capacity items.
+func (f *RedisCuckooFilter) Reserve(capacity int64, opts CFReserveOptions) error {
+	args := []interface{}{f.key, capacity}
+	if opts.BucketSize > 0 {
+		args = append(args, "BUCKETSIZE", opts.BucketSize)
+	}
+
+	if opts.MaxIterations > 0 {
+		args = append(args, "MAXITERATIONS", opts.MaxIterations)
+	}
+
+	if opts.Expansion > 0 {
+		args = append(args, "EXPANSION", opts.Expansion)
+	}
+
+	return f.do("CF.RESERVE", args...).Error
+}
+
+// Add adds item, also when it was added before.
+func (f *RedisCuckooFilter) Add(item interface{}) error {
+	return f.do("CF.ADD", f.key, item).Error
+}
+
+// AddNX adds item unless it may have been added before and reports whether it was added.
+func (f *RedisCuckooFilter) AddNX(item interface{}) (bool, error) {
+	resp := f.do("CF.ADDNX", f.key, item)
+	return redisBool(resp.RedisResponseEntity), resp.Error
+}
+
+// Exists reports whether item may have been added, false means it was certainly not.
+func (f *RedisCuckooFilter) Exists(item interface{}) (bool, error) {
+	resp := f.do("CF.EXISTS", f.key, item)
+	return redisBool(resp.RedisResponseEntity), resp.Error
+}
+
+// MExists reports for each of items whether it may have been added.
+func (f *RedisCuckooFilter) MExists(items ...interface{}) ([]bool, error) {
+	resp := f.do("CF.MEXISTS", append([]interface{}{f.key}, items...)...)
+	return redisBools(resp), resp.Error
+}
+
+// Delete removes one occurrence of item and reports whether it was found.
+func (f *RedisCuckooFilter) Delete(item interface{}) (bool, error) {
+	resp := f.do("CF.DEL", f.key, item)
+	return redisBool(resp.RedisResponseEntity), resp.Error
+}
+
+// Count returns an estimate of the number of times item was added.
+func (f *RedisCuckooFilter) Count(item interface{}) (int64, error) {
+	resp := f.do("CF.COUNT", f.key, item)
+	return resp.GetInt64(), resp.Error
+}
+
+func (f *RedisCuckooFilter) do(cmd string, args ...interface{}) *RedisResponse {
+	if err := f.module.check(f.op); err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return f.op.Do(cmd, args...)
+}
@@ -0,0 +1,130 @@
+package datastore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisBloomFilter(t *testing.T) {
+	t.Run("Commands", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.SetResponse("COMMAND", "INFO", []interface{}{[]interface{}{"bf.add"}}, nil)
+		op.SetResponse("BF.ADD", "dedup", true, nil)
+		op.SetResponse("BF.MADD", "dedup", []interface{}{int64(1), int64(0)}, nil)
+		op.SetResponse("BF.EXISTS", "dedup", int64(0), nil)
+		op.SetResponse("BF.CARD", "dedup", int64(2), nil)
+
+		filter := NewRedisBloomFilter(op, "dedup")
+		assert.NoError(t, filter.Reserve(0.001, 1000, BFReserveOptions{Expansion: 4, NonScaling: true}))
+		added, err := filter.Add("a")
+		assert.NoError(t, err)
+		assert.True(t, added)
+		madded, err := filter.MAdd("b", "a")
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, false}, madded)
+		exists, err := filter.Exists("c")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+		card, err := filter.Card()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), card)
+
+		assert.Equal(t, 1, op.GetCallCount("COMMAND"))
+		assert.Equal(t, []interface{}{"dedup", 0.001, int64(1000), "EXPANSION", int64(4), "NONSCALING"},
+			op.GetCallsByCommand("BF.RESERVE")[0].Args)
+	})
+
+	t.Run("Cuckoo", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.SetResponse("COMMAND", "INFO", []interface{}{[]interface{}{"cf.add"}}, nil)
+		op.SetResponse("CF.ADDNX", "seen", int64(1), nil)
+		op.SetResponse("CF.MEXISTS", "seen", []interface{}{true, false}, nil)
+		op.SetResponse("CF.DEL", "seen", int64(1), nil)
+		op.SetResponse("CF.COUNT", "seen", int64(3), nil)
+
+		filter := NewRedisCuckooFilter(op, "seen")
+		assert.NoError(t, filter.Reserve(1000, CFReserveOptions{BucketSize: 4}))
+		assert.NoError(t, filter.Add("a"))
+		added, err := filter.AddNX("a")
+		assert.NoError(t, err)
+		assert.True(t, added)
+		exists, err := filter.MExists("a", "b")
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, false}, exists)
+		deleted, err := filter.Delete("a")
+		assert.NoError(t, err)
+		assert.True(t, deleted)
+		count, err := filter.Count("a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+		assert.Equal(t, []interface{}{"seen", int64(1000), "BUCKETSIZE", int64(4)}, op.GetCallsByCommand("CF.RESERVE")[0].Args)
+	})
+
+	t.Run("Detection error is retried", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.SetSequentialResponses("COMMAND", "INFO", []MockResponse{
+			{Error: errors.New("timeout")},
+			{Data: []interface{}{[]interface{}{"bf.add"}}},
+		})
+
+		filter := NewRedisBloomFilter(op, "dedup")
+		_, err := filter.Add("a")
+		assert.EqualError(t, err, "timeout")
+		_, err = filter.Add("a")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, op.GetCallCount("BF.ADD"))
+	})
+
+	t.Run("Module not loaded", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.SetResponse("COMMAND", "INFO", []interface{}{nil}, nil)
+		filter := NewRedisBloomFilter(op, "dedup")
+		_, err := filter.Add("a")
+		assert.ErrorIs(t, err, ErrRedisModuleNotLoaded)
+		_, err = filter.Exists("a")
+		assert.ErrorIs(t, err, ErrRedisModuleNotLoaded)
+		assert.Equal(t, 1, op.GetCallCount("COMMAND"))
+		assert.Equal(t, 0, op.GetCallCount("BF.ADD"))
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		loaded, err := RedisHasCommand(redis.Master(), "BF.ADD")
+		if err != nil {
+			t.Skipf("COMMAND INFO not supported: %s", err.Error())
+		}
+
+		known, err := RedisHasCommand(redis.Master(), "GET")
+		assert.NoError(t, err)
+		assert.True(t, known)
+
+		filter := NewRedisBloomFilter(redis.Master(), "test_bloom")
+		defer redis.Master().Delete("test_bloom")
+		added, err := filter.Add("a")
+		if !loaded {
+			assert.ErrorIs(t, err, ErrRedisModuleNotLoaded)
+			return
+		}
+
+		assert.NoError(t, err)
+		assert.True(t, added)
+		exists, err := filter.Exists("a")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	})
+}
@@ -0,0 +1,118 @@
+package datastore
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// DefaultRedisDeleteBatchSize is the SCAN COUNT hint and the maximum number of keys per UNLINK of DeleteByPattern.
+var DefaultRedisDeleteBatchSize = 500
+
+func init() {
+	envInt("GOTH_DEFAULT_REDIS_DELETE_BATCH_SIZE", &DefaultRedisDeleteBatchSize)
+}
+
+// ErrRedisPatternEmpty is returned by DeleteByPattern for an empty pattern, "*" has to be passed explicitly.
+var ErrRedisPatternEmpty = errors.New("redis pattern empty")
+
+// DeleteByPatternOptions configures DeleteByPatternWithOptions.
+type DeleteByPatternOptions struct {
+	// BatchSize is the SCAN COUNT hint and the maximum number of keys per UNLINK, DefaultRedisDeleteBatchSize when 0
+	BatchSize int64
+	// Rate limits the deleted keys per second, 0 is unlimited
+	Rate int
+	// Progress is called after each UNLINK, returning an error stops the deletion with that error
+	Progress func(progress DeleteByPatternProgress) error
+}
+
+// DeleteByPatternProgress is the progress of DeleteByPattern reported after each batch.
+type DeleteByPatternProgress struct {
+	// Scanned is the number of matching keys returned by SCAN so far
+	Scanned int64
+	// Deleted is the number of keys UNLINK removed so far, keys expiring meanwhile are not counted
+	Deleted int64
+	Batches int
+}
+
+// redisScanner sends SCAN with args to one node.
+type redisScanner func(args ...interface{}) *RedisResponse
+
+// deleteByPattern SCANs the keys matching pattern on the node of each scanner, the masters of a cluster, and
+// UNLINKs them batch by batch, so the server is never blocked like with KEYS and DEL. On a cluster operator the keys
+// of a batch are UNLINKed with one command per slot. The response holds the number of deleted keys, also on error.
+func deleteByPattern(op RedisOperator, scanners []redisScanner, pattern string, opts DeleteByPatternOptions) *RedisResponse {
+	progress := DeleteByPatternProgress{}
+	result := func(err error) *RedisResponse {
+		return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: progress.Deleted}, Error: err}
+	}
+
+	if pattern == "" {
+		return result(ErrRedisPatternEmpty)
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = int64(max(DefaultRedisDeleteBatchSize, 1))
+	}
+
+	start := time.Now()
+	for _, scan := range scanners {
+		cursor := int64(0)
+		for {
+			resp := scan(cursor, "MATCH", pattern, "COUNT", batchSize)
+			if resp.Error != nil {
+				return result(resp.Error)
+			}
+
+			parts := resp.GetSlice()
+			if len(parts) != 2 {
+				return result(errors.New("invalid scan response"))
+			}
+
+			// The cursor is a bulk string, GetInt64 only parses []byte
+			next, err := strconv.ParseInt(parts[0].GetString(), 10, 64)
+			if err != nil {
+				return result(err)
+			}
+
+			cursor = next
+
+			keys := make([]interface{}, 0, batchSize)
+			for _, key := range parts[1].GetSlice() {
+				keys = append(keys, key.GetString())
+			}
+
+			progress.Scanned += int64(len(keys))
+			for len(keys) > 0 {
+				n := min(int64(len(keys)), batchSize)
+				resp := CountBySlot(op, "UNLINK", keys[:n]...)
+				if resp.Error != nil {
+					return result(resp.Error)
+				}
+
+				keys = keys[n:]
+				progress.Deleted += resp.GetInt64()
+				progress.Batches++
+				if opts.Progress != nil {
+					if err := opts.Progress(progress); err != nil {
+						return result(err)
+					}
+				}
+
+				if opts.Rate > 0 {
+					due := start.Add(time.Duration(float64(progress.Deleted) / float64(opts.Rate) * float64(time.Second)))
+					if wait := time.Until(due); wait > 0 {
+						time.Sleep(wait)
+					}
+				}
+			}
+
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+
+	return result(nil)
+}
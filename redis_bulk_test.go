@@ -0,0 +1,108 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisDeleteByPattern(t *testing.T) {
+	seed := func(op RedisOperator, prefix string, n int) {
+		for i := 0; i < n; i++ {
+			op.Set(fmt.Sprintf("%s:%d", prefix, i), i)
+		}
+	}
+
+	t.Run("Mock", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		seed(op, "session", 25)
+		seed(op, "user", 3)
+
+		var batches []DeleteByPatternProgress
+		resp := op.DeleteByPatternWithOptions("session:*", DeleteByPatternOptions{
+			BatchSize: 10,
+			Progress: func(progress DeleteByPatternProgress) error {
+				batches = append(batches, progress)
+				return nil
+			},
+		})
+
+		assert.NoError(t, resp.Error)
+		assert.Equal(t, int64(25), resp.GetInt64())
+		assert.Len(t, batches, 3)
+		assert.Equal(t, DeleteByPatternProgress{Scanned: 25, Deleted: 25, Batches: 3}, batches[2])
+		assert.Equal(t, int64(0), op.Exists("session:0").GetInt64())
+		assert.Equal(t, int64(1), op.Exists("user:0").GetInt64())
+	})
+
+	t.Run("Cluster", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		op.SetClusterMode(true)
+		seed(op, "session", 25)
+		resp := op.DeleteByPattern("session:*", 10)
+		assert.NoError(t, resp.Error)
+		assert.Equal(t, int64(25), resp.GetInt64())
+		assert.Equal(t, int64(0), op.Exists("session:0").GetInt64())
+		assert.ErrorIs(t, op.Unlink("session:0", "session:1").Error, ErrMockCrossSlot)
+	})
+
+	t.Run("Progress stops", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		seed(op, "session", 25)
+		stop := errors.New("stop")
+		resp := op.DeleteByPatternWithOptions("session:*", DeleteByPatternOptions{
+			BatchSize: 10,
+			Progress: func(progress DeleteByPatternProgress) error {
+				return stop
+			},
+		})
+
+		assert.ErrorIs(t, resp.Error, stop)
+		assert.Equal(t, int64(10), resp.GetInt64())
+	})
+
+	t.Run("Rate", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		seed(op, "session", 20)
+		start := time.Now()
+		resp := op.DeleteByPatternWithOptions("session:*", DeleteByPatternOptions{BatchSize: 5, Rate: 200})
+		assert.NoError(t, resp.Error)
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	})
+
+	t.Run("Empty pattern", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		assert.ErrorIs(t, op.DeleteByPattern("", 10).Error, ErrRedisPatternEmpty)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		op := redis.Master()
+		seed(op, "bulk_delete", 120)
+		op.Set("bulk_keep", 1)
+		defer op.Delete("bulk_keep")
+
+		resp := op.DeleteByPattern("bulk_delete:*", 7)
+		assert.NoError(t, resp.Error)
+		assert.Equal(t, int64(120), resp.GetInt64())
+		assert.Equal(t, int64(0), op.Exists("bulk_delete:0", "bulk_delete:119").GetInt64())
+		assert.Equal(t, int64(1), op.Exists("bulk_keep").GetInt64())
+	})
+}
@@ -0,0 +1,206 @@
+package datastore
+
+import (
+	"errors"
+	"strings"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultRedisCodec is the Codec of RedisOps without one, see RedisOp.SetCodec and the codec field of the profile.
+var DefaultRedisCodec = JSONCodec
+
+func init() {
+	var name string
+	envStr("GOTH_DEFAULT_REDIS_CODEC", &name)
+	if name == "" {
+		return
+	}
+
+	codec, err := CodecByName(name)
+	if err != nil {
+		kklogger.WarnJ("datastore:DefaultRedisCodec", err.Error())
+		return
+	}
+
+	DefaultRedisCodec = codec
+}
+
+// GetAs reads key and decodes it into a T with the Codec of op, RedisNotFound if key does not exist.
+// Encrypted and compressed values are decrypted and decompressed first.
+func GetAs[T any](op RedisOperator, key interface{}) (T, error) {
+	return getAs[T](op, key, op.Codec())
+}
+
+// SetAs encodes v with the Codec of op and stores it at key, expiring after ttl seconds, 0 never expires.
+// The value is compressed according to DefaultRedisCompression, then encrypted when op has a RedisEncryption.
+func SetAs[T any](op RedisOperator, key interface{}, v T, ttl int64) error {
+	return setAs(op, key, v, ttl, op.Codec(), DefaultRedisCompression)
+}
+
+// Cache stores values of type T under a key prefix, so call sites read and write T instead of
+// unmarshalling RedisResponseEntity themselves.
+type Cache[T any] struct {
+	op RedisOperator
+	// Prefix is prepended to every key
+	Prefix string
+	// Codec serializes the values, the Codec of the operator when nil
+	Codec Codec
+	// Compression of the values written by Set, DefaultRedisCompression when created
+	Compression RedisCompression
+	// Jitter adds a random part of up to this fraction of the TTL to the TTLs of Set and GetOrLoad,
+	// DefaultRedisTTLJitter when created
+	Jitter float64
+	// Bus, when set, publishes the keys changed by Set and Delete so other instances drop their local copies
+	Bus *InvalidationBus
+}
+
+// NewCache returns a Cache of T on op with keys prefixed by prefix.
+func NewCache[T any](op RedisOperator, prefix string) *Cache[T] {
+	return &Cache[T]{op: op, Prefix: prefix, Compression: DefaultRedisCompression, Jitter: DefaultRedisTTLJitter}
+}
+
+// Operator returns the RedisOperator of the cache.
+func (c *Cache[T]) Operator() RedisOperator {
+	return c.op
+}
+
+// Get returns the value of key, RedisNotFound if it is not cached.
+func (c *Cache[T]) Get(key string) (T, error) {
+	return getAs[T](c.op, c.Prefix+key, c.codec())
+}
+
+// Set caches v at key, expiring after ttl seconds, 0 never expires.
+// With a Bus, the error of publishing the invalidation is returned after v is cached.
+func (c *Cache[T]) Set(key string, v T, ttl int64) error {
+	if err := c.set(key, v, ttl); err != nil {
+		return err
+	}
+
+	return c.invalidate(key)
+}
+
+// Delete removes key from the cache.
+func (c *Cache[T]) Delete(key string) error {
+	if err := c.op.Delete(c.Prefix + key).Error; err != nil {
+		return err
+	}
+
+	return c.invalidate(key)
+}
+
+// OnInvalidate calls handler with the keys of the cache, without Prefix, invalidated on the Bus by any instance.
+// The key is empty when every key must be dropped. The returned function removes the handler.
+func (c *Cache[T]) OnInvalidate(handler InvalidationHandler) func() {
+	if c.Bus == nil {
+		return func() {}
+	}
+
+	return c.Bus.OnInvalidate(c.Prefix, func(key string) {
+		handler(strings.TrimPrefix(key, c.Prefix))
+	})
+}
+
+// GetOrLoad returns the value of key, calling load and caching its result for ttl seconds when it is not cached.
+// The loaded value is returned even if caching it fails.
+func (c *Cache[T]) GetOrLoad(key string, ttl int64, load func() (T, error)) (T, error) {
+	v, err := c.Get(key)
+	if err == nil || !errors.Is(err, RedisNotFound) {
+		return v, err
+	}
+
+	if v, err = load(); err != nil {
+		return v, err
+	}
+
+	// A loaded value replaces nothing, other instances have no copy to invalidate
+	c.set(key, v, ttl)
+	return v, nil
+}
+
+func (c *Cache[T]) set(key string, v T, ttl int64) error {
+	return setAs(c.op, c.Prefix+key, v, jitterTTL(ttl, c.Jitter), c.codec(), c.Compression)
+}
+
+func (c *Cache[T]) invalidate(key string) error {
+	if c.Bus == nil {
+		return nil
+	}
+
+	return c.Bus.Publish(c.Prefix + key)
+}
+
+func (c *Cache[T]) codec() Codec {
+	if c.Codec != nil {
+		return c.Codec
+	}
+
+	return c.op.Codec()
+}
+
+func getAs[T any](op RedisOperator, key interface{}, codec Codec) (T, error) {
+	var v T
+	resp := op.Get(key)
+	if resp.Error != nil {
+		return v, resp.Error
+	}
+
+	data := resp.GetBytes()
+	if data == nil {
+		return v, RedisNotFound
+	}
+
+	data, err := decryptRedisValue(op, key, data)
+	if err != nil {
+		return v, err
+	}
+
+	if data, err = decompressRedisValue(data); err != nil {
+		return v, err
+	}
+
+	if err := codec.Unmarshal(data, &v); err != nil {
+		return v, err
+	}
+
+	return v, nil
+}
+
+func setAs(op RedisOperator, key interface{}, v interface{}, ttl int64, codec Codec, compression RedisCompression) error {
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if data, err = compression.compress(data); err != nil {
+		return err
+	}
+
+	if encryption := op.Encryption(); encryption != nil {
+		if name := redisClientCacheKey(key); encryption.Matches(name) {
+			if data, err = encryption.Encrypt(name, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	if ttl > 0 {
+		return op.SetExpire(key, data, ttl).Error
+	}
+
+	return op.Set(key, data).Error
+}
+
+// decryptRedisValue decrypts data read from key, ErrRedisValueEncrypted when op has no RedisEncryption.
+func decryptRedisValue(op RedisOperator, key interface{}, data []byte) ([]byte, error) {
+	if !redisValueEncrypted(data) {
+		return data, nil
+	}
+
+	encryption := op.Encryption()
+	if encryption == nil {
+		return nil, ErrRedisValueEncrypted
+	}
+
+	return encryption.Decrypt(redisClientCacheKey(key), data)
+}
@@ -0,0 +1,96 @@
+package datastore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type redisCacheUser struct {
+	ID    int64    `json:"id" msgpack:"id"`
+	Name  string   `json:"name" msgpack:"name"`
+	Roles []string `json:"roles" msgpack:"roles"`
+}
+
+func TestRedisCache(t *testing.T) {
+	user := redisCacheUser{ID: 7, Name: "alice", Roles: []string{"admin"}}
+
+	t.Run("GetAs and SetAs", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		assert.NoError(t, SetAs(op, "user:7", user, 0))
+		assert.Equal(t, `{"id":7,"name":"alice","roles":["admin"]}`, op.Get("user:7").GetString())
+
+		got, err := GetAs[redisCacheUser](op, "user:7")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		_, err = GetAs[redisCacheUser](op, "user:8")
+		assert.ErrorIs(t, err, RedisNotFound)
+
+		assert.NoError(t, SetAs(op, "count", 42, 60))
+		count, err := GetAs[int](op, "count")
+		assert.NoError(t, err)
+		assert.Equal(t, 42, count)
+		assert.Equal(t, int64(60), op.TTL("count").GetInt64())
+	})
+
+	t.Run("Cache codec", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		cache := NewCache[redisCacheUser](op, "user:")
+		cache.Codec = MsgpackCodec
+		assert.NoError(t, cache.Set("7", user, 0))
+
+		got, err := cache.Get("7")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		_, err = GetAs[redisCacheUser](op, "user:7")
+		assert.Error(t, err, "msgpack is not json")
+
+		assert.NoError(t, cache.Delete("7"))
+		_, err = cache.Get("7")
+		assert.ErrorIs(t, err, RedisNotFound)
+	})
+
+	t.Run("GetOrLoad", func(t *testing.T) {
+		cache := NewCache[redisCacheUser](NewStatefulMockRedis().Master(), "user:")
+		loads := 0
+		load := func() (redisCacheUser, error) {
+			loads++
+			return user, nil
+		}
+
+		for i := 0; i < 3; i++ {
+			got, err := cache.GetOrLoad("7", 60, load)
+			assert.NoError(t, err)
+			assert.Equal(t, user, got)
+		}
+
+		assert.Equal(t, 1, loads)
+
+		_, err := cache.GetOrLoad("8", 60, func() (redisCacheUser, error) {
+			return redisCacheUser{}, errors.New("not in database")
+		})
+		assert.EqualError(t, err, "not in database")
+		_, err = cache.Get("8")
+		assert.ErrorIs(t, err, RedisNotFound)
+	})
+
+	t.Run("Operator codec", func(t *testing.T) {
+		r := NewStatefulMockRedis()
+		r.SetCodec(GobCodec)
+		assert.Equal(t, GobCodec, r.Slave().Codec())
+
+		cache := NewCache[redisCacheUser](r.Master(), "user:")
+		assert.NoError(t, cache.Set("7", user, 0))
+		got, err := GetAs[redisCacheUser](r.Slave(), "user:7")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		r.SetCodec(nil)
+		assert.Equal(t, DefaultRedisCodec, r.Master().Codec())
+		_, err = cache.Get("7")
+		assert.Error(t, err, "gob is not json")
+	})
+}
@@ -0,0 +1,260 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	kklogger "github.com/yetiz-org/goth-kklogger"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisProtocol is the RESP protocol version used to dial Redis, 3 for RESP3 and 2 for RESP2.
+var DefaultRedisProtocol = 3
+
+// DefaultRedisClientCache enables client-side caching of GET replies using CLIENT TRACKING.
+// Invalidation messages are received on a dedicated connection and evict local entries as soon as keys change.
+// Not supported in cluster mode.
+var DefaultRedisClientCache = false
+
+// DefaultRedisClientCacheTTL is the maximum time in milliseconds a cached value is served without asking Redis.
+var DefaultRedisClientCacheTTL = 60000
+
+// DefaultRedisClientCacheMaxEntries is the maximum number of keys kept in the client-side cache.
+var DefaultRedisClientCacheMaxEntries = 10000
+
+// DefaultRedisClientCachePrefixes limits client-side caching to keys with one of these prefixes.
+// Redis only broadcasts invalidations for matching keys, empty means every key is tracked.
+var DefaultRedisClientCachePrefixes []string
+
+const redisInvalidateChannel = "__redis__:invalidate"
+
+// redisClientCacheRetryInterval throttles resubscribing while the invalidation connection is down.
+const redisClientCacheRetryInterval = 100 * time.Millisecond
+
+type redisClientCacheEntry struct {
+	data     interface{}
+	expireAt time.Time
+}
+
+// redisClientCache is an in-process cache kept coherent by Redis CLIENT TRACKING in BCAST mode.
+// The tracking connection redirects invalidations to itself, so it is re-armed on every reconnect.
+type redisClientCache struct {
+	ttl        time.Duration
+	maxEntries int
+	prefixes   []string
+	mutex      sync.Mutex
+	entries    map[string]redisClientCacheEntry
+	// seq is increased on every invalidation, a fill started before an invalidation is discarded
+	seq    uint64
+	client *redis.Client
+	pubsub *redis.PubSub
+	wg     sync.WaitGroup
+}
+
+func newRedisClientCache(ttl time.Duration, maxEntries int, prefixes []string) *redisClientCache {
+	return &redisClientCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		prefixes:   prefixes,
+		entries:    map[string]redisClientCacheEntry{},
+	}
+}
+
+// connect opens the invalidation connection and subscribes to the tracking channel.
+func (c *redisClientCache) connect(profile *secret.RedisProfile, addr string) error {
+	c.client = redis.NewClient(&redis.Options{
+		Addr:        addr,
+		Username:    profile.Username,
+		Password:    profile.Password,
+		DB:          profile.DB,
+		Protocol:    2,
+		DialTimeout: time.Duration(DefaultRedisDialTimeout) * time.Millisecond,
+		Dialer:      DefaultRedisDialer,
+		PoolSize:    1,
+		OnConnect:   c.onConnect,
+	})
+
+	ctx := context.Background()
+	c.pubsub = c.client.Subscribe(ctx, redisInvalidateChannel)
+	if _, err := c.pubsub.Receive(ctx); err != nil {
+		c.pubsub.Close()
+		c.client.Close()
+		return err
+	}
+
+	c.wg.Add(1)
+	go c.receive()
+	return nil
+}
+
+func (c *redisClientCache) onConnect(ctx context.Context, cn *redis.Conn) error {
+	id, err := cn.ClientID(ctx).Result()
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{"CLIENT", "TRACKING", "ON", "REDIRECT", id, "BCAST"}
+	for _, prefix := range c.prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+
+	if err := cn.Do(ctx, args...).Err(); err != nil {
+		return err
+	}
+
+	// Invalidations may have been missed while disconnected
+	c.flush()
+	return nil
+}
+
+func (c *redisClientCache) receive() {
+	defer c.wg.Done()
+	ctx := context.Background()
+	for {
+		msg, err := c.pubsub.Receive(ctx)
+		if err != nil {
+			if err == redis.ErrClosed {
+				return
+			}
+
+			// A FLUSHDB/FLUSHALL invalidation carries a nil payload which is reported as an error,
+			// any receive error is handled the same conservative way
+			kklogger.DebugJ("datastore:RedisOp.ClientCache#receive", err.Error())
+			c.flush()
+			time.Sleep(redisClientCacheRetryInterval)
+			continue
+		}
+
+		if message, ok := msg.(*redis.Message); ok {
+			if len(message.PayloadSlice) > 0 {
+				c.invalidate(message.PayloadSlice...)
+			} else {
+				c.invalidate(message.Payload)
+			}
+		}
+	}
+}
+
+// redisClientCacheKey converts a key argument to the key name used in invalidation messages.
+func redisClientCacheKey(key interface{}) string {
+	switch v := key.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (c *redisClientCache) cacheable(key string) bool {
+	if len(c.prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range c.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *redisClientCache) get(key string) (interface{}, uint64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().Before(entry.expireAt) {
+		return entry.data, c.seq, true
+	}
+
+	if ok {
+		delete(c.entries, key)
+	}
+
+	return nil, c.seq, false
+}
+
+// set stores the value unless an invalidation was received after seq was taken.
+func (c *redisClientCache) set(key string, data interface{}, seq uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if seq != c.seq {
+		return
+	}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+
+	c.entries[key] = redisClientCacheEntry{data: data, expireAt: time.Now().Add(c.ttl)}
+}
+
+func (c *redisClientCache) invalidate(keys ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.seq++
+	for _, key := range keys {
+		delete(c.entries, key)
+	}
+}
+
+func (c *redisClientCache) flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.seq++
+	c.entries = map[string]redisClientCacheEntry{}
+}
+
+func (c *redisClientCache) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.entries)
+}
+
+func (c *redisClientCache) close() {
+	if c.pubsub != nil {
+		c.pubsub.Close()
+	}
+
+	if c.client != nil {
+		c.client.Close()
+	}
+
+	c.wg.Wait()
+}
+
+// enableRedisClientCache attaches a client-side cache to the op, falling back to uncached reads
+// when the server rejects CLIENT TRACKING.
+func enableRedisClientCache(op *RedisOp, profile *secret.RedisProfile, addrs []string) {
+	if op.client == nil || len(addrs) == 0 {
+		return
+	}
+
+	if profile.Mode == redisModeCluster {
+		kklogger.WarnJ("datastore:RedisOp.ClientCache", "client-side caching is not supported in cluster mode")
+		return
+	}
+
+	cache := newRedisClientCache(
+		time.Duration(DefaultRedisClientCacheTTL)*time.Millisecond,
+		DefaultRedisClientCacheMaxEntries,
+		DefaultRedisClientCachePrefixes,
+	)
+
+	if err := cache.connect(profile, addrs[0]); err != nil {
+		kklogger.WarnJ("datastore:RedisOp.ClientCache", fmt.Sprintf("client-side caching disabled: %s", err.Error()))
+		return
+	}
+
+	op.cache = cache
+}
@@ -0,0 +1,130 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// TestRedisClientCacheEntries Local cache bookkeeping without a server
+func TestRedisClientCacheEntries(t *testing.T) {
+	t.Run("SetGetInvalidate", func(t *testing.T) {
+		cache := newRedisClientCache(time.Minute, 10, nil)
+
+		_, seq, ok := cache.get("key1")
+		assert.False(t, ok)
+
+		cache.set("key1", "value1", seq)
+		data, _, ok := cache.get("key1")
+		assert.True(t, ok)
+		assert.Equal(t, "value1", data)
+
+		cache.invalidate("key1")
+		_, _, ok = cache.get("key1")
+		assert.False(t, ok)
+	})
+
+	t.Run("StaleFillDiscarded", func(t *testing.T) {
+		cache := newRedisClientCache(time.Minute, 10, nil)
+
+		// An invalidation between the read and the fill must win
+		_, seq, _ := cache.get("key1")
+		cache.invalidate("key1")
+		cache.set("key1", "stale", seq)
+
+		_, _, ok := cache.get("key1")
+		assert.False(t, ok)
+	})
+
+	t.Run("TTLAndMaxEntries", func(t *testing.T) {
+		cache := newRedisClientCache(10*time.Millisecond, 2, nil)
+		_, seq, _ := cache.get("key1")
+		cache.set("key1", "value1", seq)
+		cache.set("key2", "value2", seq)
+		cache.set("key3", "value3", seq)
+		assert.Equal(t, 2, cache.len())
+
+		time.Sleep(20 * time.Millisecond)
+		_, _, ok := cache.get("key3")
+		assert.False(t, ok)
+
+		cache.flush()
+		assert.Equal(t, 0, cache.len())
+	})
+
+	t.Run("Prefixes", func(t *testing.T) {
+		cache := newRedisClientCache(time.Minute, 10, []string{"user:", "item:"})
+		assert.True(t, cache.cacheable("user:1"))
+		assert.True(t, cache.cacheable("item:1"))
+		assert.False(t, cache.cacheable("session:1"))
+		assert.Equal(t, "user:1", redisClientCacheKey([]byte("user:1")))
+	})
+}
+
+// TestRedisClientCacheHit A GET served locally is guarded and audited
+func TestRedisClientCacheHit(t *testing.T) {
+	op := &RedisOp{cache: newRedisClientCache(time.Minute, 10, nil)}
+	op.cache.set("cc_key", "value", 0)
+	var entries []RedisAuditEntry
+	op.SetAudit(NewRedisAudit(1, func(entry RedisAuditEntry) {
+		entries = append(entries, entry)
+	}))
+
+	assert.Equal(t, "value", op.Get("cc_key").GetString())
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "GET", entries[0].Cmd)
+		assert.Equal(t, []string{"cc_key"}, entries[0].Args)
+	}
+
+	op.SetCommandGuard(NewRedisCommandGuard(nil, []string{"GET"}))
+	assert.ErrorIs(t, op.Get("cc_key").Error, ErrRedisCommandDenied)
+	assert.Len(t, entries, 1)
+}
+
+// TestRedisClientCache GET served locally and invalidated by CLIENT TRACKING
+func TestRedisClientCache(t *testing.T) {
+	// Save original secret path and cache settings, restore them after test
+	originalPath := secret.Path()
+	originalClientCache := DefaultRedisClientCache
+	defer func() {
+		secret.PATH = originalPath
+		DefaultRedisClientCache = originalClientCache
+	}()
+
+	// Set secret path to the example directory
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+
+	DefaultRedisClientCache = true
+	r := NewRedis("test")
+	defer r.Master().Close()
+
+	op := r.Master().(*RedisOp)
+	if op.cache == nil {
+		t.Skip("Skipping test - CLIENT TRACKING not supported by server")
+		return
+	}
+
+	writer := NewRedis("test")
+	defer writer.Master().Close()
+
+	writer.Master().Set("cc_key", "value1")
+	defer writer.Master().Delete("cc_key")
+
+	assert.Equal(t, "value1", r.Master().Get("cc_key").GetString())
+	_, _, ok := op.cache.get("cc_key")
+	assert.True(t, ok)
+
+	// A write from another client invalidates the local entry
+	writer.Master().Set("cc_key", "value2")
+	assert.Eventually(t, func() bool {
+		_, _, ok := op.cache.get("cc_key")
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "value2", r.Master().Get("cc_key").GetString())
+}
@@ -0,0 +1,101 @@
+package datastore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms of RedisCompression.
+const (
+	RedisCompressionSnappy = "snappy"
+	RedisCompressionZstd   = "zstd"
+)
+
+// RedisCompression compresses the values written by the typed helpers once they reach Threshold bytes.
+// Compressed values start with a 4 byte header naming the algorithm, reads detect it whatever the setting,
+// so compression can be enabled or changed without rewriting existing keys.
+type RedisCompression struct {
+	// Algorithm is RedisCompressionSnappy or RedisCompressionZstd, empty disables compression
+	Algorithm string
+	// Threshold is the encoded size in bytes from which values are compressed
+	Threshold int
+}
+
+// DefaultRedisCompression is the compression of GetAs and SetAs and of new Caches, disabled by default.
+var DefaultRedisCompression = RedisCompression{Threshold: 1024}
+
+func init() {
+	envStr("GOTH_DEFAULT_REDIS_COMPRESSION", &DefaultRedisCompression.Algorithm)
+	envInt("GOTH_DEFAULT_REDIS_COMPRESSION_THRESHOLD", &DefaultRedisCompression.Threshold)
+}
+
+// ErrRedisCompressionNotSupported is returned for an unknown RedisCompression algorithm or header.
+var ErrRedisCompressionNotSupported = errors.New("redis compression not supported")
+
+// redisCompressionMagic starts compressed values, followed by the algorithm byte.
+// 0xff never starts a JSON document nor a gob stream with a length of 'G', and a msgpack -1 has no trailing bytes.
+var redisCompressionMagic = []byte{0xff, 'G', 'C'}
+
+const (
+	redisCompressionSnappyByte = 's'
+	redisCompressionZstdByte   = 'z'
+)
+
+var (
+	redisZstdOnce    sync.Once
+	redisZstdEncoder *zstd.Encoder
+	redisZstdDecoder *zstd.Decoder
+)
+
+func redisZstd() (*zstd.Encoder, *zstd.Decoder) {
+	redisZstdOnce.Do(func() {
+		redisZstdEncoder, _ = zstd.NewWriter(nil)
+		redisZstdDecoder, _ = zstd.NewReader(nil)
+	})
+
+	return redisZstdEncoder, redisZstdDecoder
+}
+
+// compress returns data with the compression header when it reaches the threshold, data as is otherwise.
+func (c RedisCompression) compress(data []byte) ([]byte, error) {
+	if c.Algorithm == "" || len(data) < c.Threshold {
+		return data, nil
+	}
+
+	switch c.Algorithm {
+	case RedisCompressionSnappy:
+		return append(redisCompressionHeader(redisCompressionSnappyByte), snappy.Encode(nil, data)...), nil
+	case RedisCompressionZstd:
+		encoder, _ := redisZstd()
+		return encoder.EncodeAll(data, redisCompressionHeader(redisCompressionZstdByte)), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrRedisCompressionNotSupported, c.Algorithm)
+	}
+}
+
+func redisCompressionHeader(algorithm byte) []byte {
+	return append(append([]byte{}, redisCompressionMagic...), algorithm)
+}
+
+// decompressRedisValue returns the uncompressed value when data has the compression header, data as is otherwise.
+func decompressRedisValue(data []byte) ([]byte, error) {
+	header := len(redisCompressionMagic) + 1
+	if len(data) < header || !bytes.HasPrefix(data, redisCompressionMagic) {
+		return data, nil
+	}
+
+	switch data[header-1] {
+	case redisCompressionSnappyByte:
+		return snappy.Decode(nil, data[header:])
+	case redisCompressionZstdByte:
+		_, decoder := redisZstd()
+		return decoder.DecodeAll(data[header:], nil)
+	default:
+		return nil, fmt.Errorf("%w: header %q", ErrRedisCompressionNotSupported, data[header-1])
+	}
+}
@@ -0,0 +1,62 @@
+package datastore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisCompression(t *testing.T) {
+	large := strings.Repeat("payload ", 512)
+
+	for _, algorithm := range []string{RedisCompressionSnappy, RedisCompressionZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			op := NewStatefulMockRedis().Master()
+			cache := NewCache[string](op, "page:")
+			cache.Compression = RedisCompression{Algorithm: algorithm, Threshold: 1024}
+
+			assert.NoError(t, cache.Set("large", large, 0))
+			stored := op.Get("page:large").GetBytes()
+			assert.True(t, bytes.HasPrefix(stored, redisCompressionMagic))
+			assert.Less(t, len(stored), len(large)/4)
+
+			got, err := cache.Get("large")
+			assert.NoError(t, err)
+			assert.Equal(t, large, got)
+
+			assert.NoError(t, cache.Set("small", "short", 0))
+			assert.Equal(t, `"short"`, op.Get("page:small").GetString())
+		})
+	}
+
+	t.Run("Reads whatever the setting", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		writer := NewCache[string](op, "page:")
+		writer.Compression = RedisCompression{Algorithm: RedisCompressionZstd}
+		assert.NoError(t, writer.Set("large", large, 0))
+
+		got, err := GetAs[string](op, "page:large")
+		assert.NoError(t, err)
+		assert.Equal(t, large, got)
+	})
+
+	t.Run("Msgpack values are not mistaken for headers", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		op.SetCodec(MsgpackCodec)
+		assert.NoError(t, SetAs(op, "minus", -1, 0))
+
+		got, err := GetAs[int](op, "minus")
+		assert.NoError(t, err)
+		assert.Equal(t, -1, got)
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := RedisCompression{Algorithm: "lz4"}.compress([]byte(large))
+		assert.ErrorIs(t, err, ErrRedisCompressionNotSupported)
+
+		_, err = decompressRedisValue(append(redisCompressionHeader('x'), 1, 2, 3))
+		assert.ErrorIs(t, err, ErrRedisCompressionNotSupported)
+	})
+}
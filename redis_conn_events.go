@@ -0,0 +1,134 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// Connection event types of RedisConnEvent.
+const (
+	RedisConnDialed     = "dialed"
+	RedisConnDialFailed = "dial_failed"
+	RedisConnClosed     = "closed"
+	RedisConnError      = "error"
+)
+
+// Pool roles of RedisConnEvent.
+const (
+	RedisRoleMaster = "master"
+	RedisRoleSlave  = "slave"
+)
+
+// RedisConnEvent describes a connection dialed or closed by the pool of an operator, or a command that failed
+// with a network error.
+type RedisConnEvent struct {
+	Type string
+	// Role is RedisRoleMaster or RedisRoleSlave, the operator owning the pool
+	Role string
+	Host string
+	Port uint
+	// Latency is the dial duration of dial events
+	Latency time.Duration
+	// Cmd is the command of RedisConnError events, "pipeline" for pipelines and transactions
+	Cmd string
+	// Err is the error of RedisConnDialFailed and RedisConnError events
+	Err error
+}
+
+// RedisConnObserverFunc is called for every connection event, from the goroutine dialing, closing or sending the
+// command, so it should return quickly.
+type RedisConnObserverFunc func(event RedisConnEvent)
+
+// redisConnEvents reports the connection events of the pool of one operator to its observers.
+type redisConnEvents struct {
+	role      string
+	mutex     sync.RWMutex
+	observers []RedisConnObserverFunc
+}
+
+func newRedisConnEvents(role string) *redisConnEvents {
+	return &redisConnEvents{role: role}
+}
+
+func (e *redisConnEvents) addObserver(fn RedisConnObserverFunc) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.observers = append(e.observers, fn)
+}
+
+func (e *redisConnEvents) notify(event RedisConnEvent) {
+	e.mutex.RLock()
+	observers := e.observers
+	e.mutex.RUnlock()
+	event.Role = e.role
+	for _, fn := range observers {
+		fn(event)
+	}
+}
+
+// wrapDialer returns a dialer reporting the connections of dial, and their closing.
+func (e *redisConnEvents) wrapDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port := splitRedisAddr(addr)
+		start := time.Now()
+		conn, err := dial(ctx, network, addr)
+		event := RedisConnEvent{Type: RedisConnDialed, Host: host, Port: port, Latency: time.Since(start)}
+		if err != nil {
+			event.Type, event.Err = RedisConnDialFailed, err
+			e.notify(event)
+			return nil, err
+		}
+
+		e.notify(event)
+		return &redisEventConn{Conn: conn, events: e, host: host, port: port}, nil
+	}
+}
+
+// commandError reports err of cmd when it is a network error: a dial failure, a timeout, or a connection reset or
+// closed by the server. Nothing is reported without events.
+func (e *redisConnEvents) commandError(meta secret.RedisMeta, cmd string, err error) {
+	if e == nil || !isRedisNetworkError(err) {
+		return
+	}
+
+	e.notify(RedisConnEvent{Type: RedisConnError, Host: meta.Host, Port: meta.Port, Cmd: cmd, Err: err})
+}
+
+func isRedisNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, ErrDial) || errors.Is(err, ErrTimeout) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// redisEventConn reports its closing once. It keeps the health check go-redis runs through SyscallConn.
+type redisEventConn struct {
+	net.Conn
+	events *redisConnEvents
+	host   string
+	port   uint
+	once   sync.Once
+}
+
+func (c *redisEventConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.events.notify(RedisConnEvent{Type: RedisConnClosed, Host: c.host, Port: c.port})
+	})
+
+	return err
+}
+
+func (c *redisEventConn) SyscallConn() (syscall.RawConn, error) {
+	if conn, ok := c.Conn.(syscall.Conn); ok {
+		return conn.SyscallConn()
+	}
+
+	return redisNoopRawConn{}, nil
+}
@@ -0,0 +1,122 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisConnEvents(t *testing.T) {
+	t.Run("Dialer", func(t *testing.T) {
+		events := newRedisConnEvents(RedisRoleSlave)
+		var received []RedisConnEvent
+		events.addObserver(func(event RedisConnEvent) {
+			received = append(received, event)
+		})
+
+		failure := errors.New("refused")
+		dial := events.wrapDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == "down:6379" {
+				return nil, failure
+			}
+
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		})
+
+		conn, err := dial(context.Background(), "tcp", "redis:6380")
+		assert.NoError(t, err)
+		_, err = conn.(*redisEventConn).SyscallConn()
+		assert.NoError(t, err)
+		assert.NoError(t, conn.Close())
+		conn.Close()
+
+		_, err = dial(context.Background(), "tcp", "down:6379")
+		assert.ErrorIs(t, err, failure)
+
+		assert.Len(t, received, 3)
+		assert.Equal(t, RedisConnDialed, received[0].Type)
+		assert.Equal(t, RedisRoleSlave, received[0].Role)
+		assert.Equal(t, "redis", received[0].Host)
+		assert.Equal(t, uint(6380), received[0].Port)
+		assert.Equal(t, RedisConnClosed, received[1].Type)
+		assert.Equal(t, RedisConnDialFailed, received[2].Type)
+		assert.Equal(t, failure, received[2].Err)
+
+		meta := secret.RedisMeta{Host: "redis", Port: 6380}
+		events.commandError(meta, "GET", RedisNotFound)
+		events.commandError(meta, "GET", errors.New("WRONGTYPE"))
+		events.commandError(meta, "GET", classifyRedisError("GET", context.DeadlineExceeded))
+		assert.Len(t, received, 4)
+		assert.Equal(t, RedisConnError, received[3].Type)
+		assert.Equal(t, "GET", received[3].Cmd)
+		assert.ErrorIs(t, received[3].Err, ErrTimeout)
+
+		var none *redisConnEvents
+		none.commandError(meta, "GET", ErrTimeout)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+
+		var mutex sync.Mutex
+		counts := map[string]int{}
+		redis.AddConnObserver(func(event RedisConnEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			counts[event.Role+":"+event.Type]++
+		})
+
+		assert.NoError(t, redis.Master().Set("test_conn_events", 1).Error)
+		assert.NoError(t, redis.Slave().Get("test_conn_events").Error)
+		redis.Master().Delete("test_conn_events")
+		redis.Close()
+
+		mutex.Lock()
+		assert.Equal(t, 1, counts["master:dialed"])
+		assert.Equal(t, 1, counts["master:closed"])
+		assert.Equal(t, 1, counts["slave:dialed"])
+		assert.Equal(t, 1, counts["slave:closed"])
+		mutex.Unlock()
+
+		profile, err := secret.LoadRedisProfile("test")
+		assert.NoError(t, err)
+		profile.Master.Port, profile.Slave.Port = 1, 1
+		down := NewRedisWithProfile("test", profile)
+		assert.NotNil(t, down)
+		defer down.Close()
+
+		var received []RedisConnEvent
+		down.AddConnObserver(func(event RedisConnEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			received = append(received, event)
+		})
+
+		assert.ErrorIs(t, down.Master().Get("test_conn_events").Error, ErrDial)
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.NotEmpty(t, received)
+		assert.Equal(t, RedisConnDialFailed, received[0].Type)
+		assert.Equal(t, RedisConnError, received[len(received)-1].Type)
+		assert.Equal(t, "GET", received[len(received)-1].Cmd)
+		assert.Equal(t, uint(1), received[len(received)-1].Port)
+		assert.Equal(t, RedisRoleMaster, received[len(received)-1].Role)
+	})
+}
@@ -0,0 +1,163 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// errRedisConnStale fails the health check go-redis runs on idle connections to an address the hostname of the
+// server no longer resolves to, so they are discarded.
+var errRedisConnStale = errors.New("redis connection to a stale address")
+
+// redisDNSRefresher resolves the hostnames of the servers of a client every DefaultDNSRefreshInterval, and drops
+// the connections to the addresses a name no longer resolves to. A connection in use completes its command and
+// fails the health check when go-redis next hands it out, new connections dial the current addresses.
+type redisDNSRefresher struct {
+	resolvers map[string]*dnsResolver
+	interval  time.Duration
+	mutex     sync.Mutex
+	conns     map[*redisDNSConn]struct{}
+	closed    chan struct{}
+	once      sync.Once
+}
+
+// newRedisDNSRefresher returns the refresher of the servers at addrs, nil when DefaultDNSRefreshInterval is
+// disabled or every server is addressed by IP.
+func newRedisDNSRefresher(addrs []string) *redisDNSRefresher {
+	resolvers := map[string]*dnsResolver{}
+	for _, addr := range addrs {
+		host, _ := splitRedisAddr(addr)
+		if resolver := newDNSResolver(host); resolver != nil {
+			resolvers[host] = resolver
+		}
+	}
+
+	if len(resolvers) == 0 {
+		return nil
+	}
+
+	return &redisDNSRefresher{
+		resolvers: resolvers,
+		interval:  DefaultDNSRefreshInterval,
+		conns:     map[*redisDNSConn]struct{}{},
+		closed:    make(chan struct{}),
+	}
+}
+
+func (r *redisDNSRefresher) start() {
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		r.refresh(context.Background())
+		for {
+			select {
+			case <-ticker.C:
+				r.refresh(context.Background())
+			case <-r.closed:
+				return
+			}
+		}
+	}()
+}
+
+func (r *redisDNSRefresher) close() {
+	r.once.Do(func() {
+		close(r.closed)
+	})
+}
+
+// wrapDialer returns a dialer tracking the address every connection of dial reached.
+func (r *redisDNSRefresher) wrapDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		host, _ := splitRedisAddr(addr)
+		if _, ok := r.resolvers[host]; !ok {
+			return conn, nil
+		}
+
+		ip := ""
+		if remote, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			ip = remote.IP.String()
+		}
+
+		tracked := &redisDNSConn{Conn: conn, refresher: r, host: host, ip: ip}
+		r.mutex.Lock()
+		r.conns[tracked] = struct{}{}
+		r.mutex.Unlock()
+		return tracked, nil
+	}
+}
+
+// refresh resolves every hostname, and marks stale the connections to the addresses of a changed name that are
+// gone.
+func (r *redisDNSRefresher) refresh(ctx context.Context) {
+	for host, resolver := range r.resolvers {
+		changed, err := resolver.resolve(ctx)
+		if err != nil {
+			kklogger.WarnJ("datastore:RedisDNSRefresher.refresh", fmt.Sprintf("resolve %s: %s", host, err.Error()))
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		stale := 0
+		r.mutex.Lock()
+		for conn := range r.conns {
+			if conn.host == host && !resolver.contains(conn.ip) {
+				conn.stale.Store(true)
+				delete(r.conns, conn)
+				stale++
+			}
+		}
+
+		r.mutex.Unlock()
+		kklogger.InfoJ("datastore:RedisDNSRefresher.refresh", fmt.Sprintf("%s addresses changed, %d connections recycled", host, stale))
+	}
+}
+
+func (r *redisDNSRefresher) remove(conn *redisDNSConn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.conns, conn)
+}
+
+// redisDNSConn is a connection tracked by a redisDNSRefresher, a stale one fails the health check go-redis runs
+// through SyscallConn before handing out an idle connection.
+type redisDNSConn struct {
+	net.Conn
+	refresher *redisDNSRefresher
+	host      string
+	ip        string
+	stale     atomic.Bool
+}
+
+func (c *redisDNSConn) SyscallConn() (syscall.RawConn, error) {
+	if c.stale.Load() {
+		return nil, errRedisConnStale
+	}
+
+	if conn, ok := c.Conn.(syscall.Conn); ok {
+		return conn.SyscallConn()
+	}
+
+	return redisNoopRawConn{}, nil
+}
+
+func (c *redisDNSConn) Close() error {
+	c.refresher.remove(c)
+	return c.Conn.Close()
+}
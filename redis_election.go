@@ -0,0 +1,219 @@
+package datastore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultRedisLeaderTTL is the TTL of the leader key of elections started with a ttl of 0.
+var DefaultRedisLeaderTTL = 15 * time.Second
+
+func init() {
+	envMillis("GOTH_DEFAULT_REDIS_LEADER_TTL", &DefaultRedisLeaderTTL)
+}
+
+// ErrRedisNoLeader is returned by RedisLeadership.Leader when nobody holds the leader key.
+var ErrRedisNoLeader = errors.New("redis election has no leader")
+
+// Scripts changing the leader key only while it holds the id of the candidate.
+const (
+	redisLeaderRenewScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`
+	redisLeaderReleaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+)
+
+// RedisLeadership campaigns for the leader key of an election until Resign, see Elect.
+// The leader holds the key with SET NX PX and renews it at a third of the TTL, leadership is considered lost
+// when the key holds another id or it could not be renewed for two thirds of the TTL, before the key expires
+// and another candidate can take it.
+type RedisLeadership struct {
+	op  RedisOperator
+	key string
+	id  string
+	ttl time.Duration
+
+	mutex   sync.Mutex
+	leader  bool
+	elected chan struct{}
+	changes chan bool
+	stop    chan struct{}
+	done    chan struct{}
+	resign  sync.Once
+	err     error
+}
+
+// Elect starts campaigning for key of op with a random candidate id, a ttl of 0 uses DefaultRedisLeaderTTL.
+func Elect(op RedisOperator, key string, ttl time.Duration) *RedisLeadership {
+	if ttl <= 0 {
+		ttl = DefaultRedisLeaderTTL
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	l := &RedisLeadership{
+		op:      op,
+		key:     key,
+		id:      hex.EncodeToString(id),
+		ttl:     ttl,
+		elected: make(chan struct{}),
+		changes: make(chan bool, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go l.campaign()
+	return l
+}
+
+// Elect starts campaigning for key on the master, see Elect.
+func (r *Redis) Elect(key string, ttl time.Duration) *RedisLeadership {
+	return Elect(r.Master(), key, ttl)
+}
+
+// Key returns the leader key.
+func (l *RedisLeadership) Key() string {
+	return l.key
+}
+
+// ID returns the candidate id, stored under the key while leading.
+func (l *RedisLeadership) ID() string {
+	return l.id
+}
+
+// IsLeader reports whether the candidate currently leads.
+func (l *RedisLeadership) IsLeader() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.leader
+}
+
+// Changes notifies leadership changes, true when elected and false when lost.
+// Pending notifications are replaced by newer ones, so a slow reader gets the latest state.
+func (l *RedisLeadership) Changes() <-chan bool {
+	return l.changes
+}
+
+// Wait blocks until the candidate leads or ctx is done.
+func (l *RedisLeadership) Wait(ctx context.Context) error {
+	l.mutex.Lock()
+	elected := l.elected
+	l.mutex.Unlock()
+	select {
+	case <-elected:
+		return nil
+	case <-l.done:
+		return fmt.Errorf("redis election %s resigned", l.key)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Leader returns the id of the current leader, ErrRedisNoLeader when nobody leads.
+func (l *RedisLeadership) Leader() (string, error) {
+	resp := l.op.Get(l.key)
+	if errors.Is(resp.Error, RedisNotFound) {
+		return "", fmt.Errorf("%w: %s", ErrRedisNoLeader, l.key)
+	}
+
+	if resp.Error != nil {
+		return "", resp.Error
+	}
+
+	return resp.GetString(), nil
+}
+
+// Resign stops campaigning and releases the key when leading, so another candidate can take it at once.
+func (l *RedisLeadership) Resign() error {
+	l.resign.Do(func() {
+		close(l.stop)
+		<-l.done
+	})
+
+	return l.err
+}
+
+func (l *RedisLeadership) campaign() {
+	defer close(l.done)
+	interval := l.ttl / 3
+	renewed := time.Time{}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-l.stop:
+			if l.IsLeader() {
+				l.err = l.op.Eval(redisLeaderReleaseScript, []interface{}{l.key}, []interface{}{l.id}).Error
+				l.set(false)
+			}
+
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		if l.IsLeader() {
+			resp := l.op.Eval(redisLeaderRenewScript, []interface{}{l.key}, []interface{}{l.id, l.ttl.Milliseconds()})
+			switch {
+			case resp.Error == nil && resp.GetInt64() == 1:
+				renewed = start
+			case resp.Error == nil:
+				kklogger.WarnJ("datastore:RedisLeadership.campaign", fmt.Sprintf("leadership of %s taken over", l.key))
+				l.set(false)
+			default:
+				kklogger.WarnJ("datastore:RedisLeadership.campaign", resp.Error.Error())
+				if time.Since(renewed) >= l.ttl*2/3 {
+					l.set(false)
+				}
+			}
+		} else {
+			resp := l.op.SetWithOptions(l.key, l.id, SetOptions{NX: true, PX: l.ttl.Milliseconds()})
+			if resp.Error == nil {
+				renewed = start
+				l.set(true)
+			} else if !errors.Is(resp.Error, RedisNotFound) {
+				kklogger.WarnJ("datastore:RedisLeadership.campaign", resp.Error.Error())
+			}
+		}
+
+		timer.Reset(interval)
+	}
+}
+
+// set records the leadership state and notifies a change.
+func (l *RedisLeadership) set(leader bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.leader == leader {
+		return
+	}
+
+	l.leader = leader
+	if leader {
+		close(l.elected)
+	} else {
+		l.elected = make(chan struct{})
+	}
+
+	select {
+	case <-l.changes:
+	default:
+	}
+
+	l.changes <- leader
+}
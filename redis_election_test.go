@@ -0,0 +1,67 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisElect(t *testing.T) {
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+	redis := NewRedis("test")
+	assert.NotNil(t, redis)
+	defer redis.Close()
+
+	key := "test_redis_elect"
+	redis.Master().Delete(key)
+	defer redis.Master().Delete(key)
+
+	first := redis.Elect(key, 300*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, first.Wait(ctx))
+	assert.True(t, first.IsLeader())
+	assert.True(t, <-first.Changes())
+
+	second := redis.Elect(key, 300*time.Millisecond)
+	time.Sleep(400 * time.Millisecond)
+	assert.True(t, first.IsLeader())
+	assert.False(t, second.IsLeader())
+	leader, err := second.Leader()
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID(), leader)
+
+	assert.NoError(t, first.Resign())
+	assert.False(t, first.IsLeader())
+	assert.False(t, <-first.Changes())
+	assert.NoError(t, first.Resign())
+	assert.Error(t, first.Wait(context.Background()))
+	assert.NoError(t, second.Wait(ctx))
+
+	// Another client overwriting the key ends the leadership at the next renewal
+	assert.True(t, <-second.Changes())
+	redis.Master().Set(key, "other")
+	select {
+	case leader := <-second.Changes():
+		assert.False(t, leader)
+	case <-time.After(time.Second):
+		assert.Fail(t, "leadership not lost")
+	}
+
+	assert.NoError(t, second.Resign())
+	assert.Equal(t, "other", redis.Master().Get(key).GetString())
+	redis.Master().Delete(key)
+	_, err = second.Leader()
+	assert.ErrorIs(t, err, ErrRedisNoLeader)
+}
@@ -0,0 +1,235 @@
+package datastore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// KeyProvider supplies the key encryption keys of RedisEncryption, e.g. from a KMS or a secret profile.
+// Keys are 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the id and key wrapping the data keys of new values
+	CurrentKey() (string, []byte, error)
+	// Key returns the key of id, to read values written before a rotation
+	Key(id string) ([]byte, error)
+}
+
+var (
+	// ErrEncryptionKeyNotFound is returned by a KeyProvider for an unknown key id.
+	ErrEncryptionKeyNotFound = errors.New("encryption key not found")
+	// ErrRedisValueEncrypted is returned when reading an encrypted value from an operator without RedisEncryption.
+	ErrRedisValueEncrypted = errors.New("redis value encrypted, no encryption configured")
+	// ErrRedisDecrypt is returned for encrypted values that are malformed or fail authentication.
+	ErrRedisDecrypt = errors.New("redis value decryption failed")
+)
+
+// StaticKeyProvider is a KeyProvider with fixed keys, see NewStaticKeyProvider.
+type StaticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider returns a KeyProvider encrypting with the key of current and decrypting with any of keys.
+func NewStaticKeyProvider(current string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrEncryptionKeyNotFound, current)
+	}
+
+	provider := &StaticKeyProvider{current: current, keys: map[string][]byte{}}
+	for id, key := range keys {
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+
+		if len(id) > 255 {
+			return nil, fmt.Errorf("encryption key id %s longer than 255 bytes", id)
+		}
+
+		provider.keys[id] = append([]byte(nil), key...)
+	}
+
+	return provider, nil
+}
+
+// CurrentKey returns the key of the current id.
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.current, p.keys[p.current], nil
+}
+
+// Key returns the key of id, ErrEncryptionKeyNotFound if there is none.
+func (p *StaticKeyProvider) Key(id string) ([]byte, error) {
+	if key, ok := p.keys[id]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrEncryptionKeyNotFound, id)
+}
+
+// RedisEncryption encrypts the values written by the typed helpers with AES-GCM before they reach Redis.
+// Every value has its own random data key, wrapped with the current key of Keys and stored with the id of that key,
+// so keys can be rotated without rewriting existing values. The Redis key is authenticated with the value,
+// a ciphertext copied to another key fails to decrypt.
+// Commands other than the typed helpers can use Encrypt and Decrypt directly, e.g. for hash fields.
+type RedisEncryption struct {
+	Keys KeyProvider
+	// Patterns selects the keys encrypted by the typed helpers with path.Match patterns, e.g. "user:*:pii", empty encrypts every key
+	Patterns []string
+}
+
+// NewRedisEncryption returns a RedisEncryption with the keys of the profile,
+// nil when the profile has no keys.
+func NewRedisEncryption(profile secret.RedisEncryption) (*RedisEncryption, error) {
+	if len(profile.Keys) == 0 {
+		return nil, nil
+	}
+
+	keys := map[string][]byte{}
+	for id, encoded := range profile.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+
+		keys[id] = key
+	}
+
+	provider, err := NewStaticKeyProvider(profile.Current, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisEncryption{Keys: provider, Patterns: profile.Patterns}, nil
+}
+
+// redisEncryptionMagic starts encrypted values, followed by the format version, see redisCompressionMagic.
+var redisEncryptionMagic = []byte{0xff, 'G', 'E'}
+
+const (
+	redisEncryptionVersion = 1
+	redisDataKeySize       = 32
+)
+
+// Matches reports whether the typed helpers encrypt the values of key.
+func (e *RedisEncryption) Matches(key string) bool {
+	if len(e.Patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range e.Patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encrypt seals plaintext stored at key.
+// The layout is the header, the key id length and id, the wrapped data key and the sealed value.
+func (e *RedisEncryption) Encrypt(key string, plaintext []byte) ([]byte, error) {
+	id, kek, err := e.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, redisDataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	out := append(append([]byte{}, redisEncryptionMagic...), redisEncryptionVersion, byte(len(id)))
+	out = append(out, id...)
+	if out, err = redisSeal(out, kek, dataKey, []byte(key)); err != nil {
+		return nil, err
+	}
+
+	return redisSeal(out, dataKey, plaintext, []byte(key))
+}
+
+// Decrypt opens data stored at key, data without the encryption header is returned as is.
+func (e *RedisEncryption) Decrypt(key string, data []byte) ([]byte, error) {
+	if !redisValueEncrypted(data) {
+		return data, nil
+	}
+
+	rest := data[len(redisEncryptionMagic):]
+	if len(rest) < 2 || rest[0] != redisEncryptionVersion || len(rest) < 2+int(rest[1]) {
+		return nil, ErrRedisDecrypt
+	}
+
+	id := string(rest[2 : 2+int(rest[1])])
+	rest = rest[2+int(rest[1]):]
+	kek, err := e.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, rest, err := redisOpen(kek, rest, redisDataKeySize, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, _, err := redisOpen(dataKey, rest, -1, []byte(key))
+	return plaintext, err
+}
+
+func redisValueEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, redisEncryptionMagic)
+}
+
+// redisSeal appends the nonce and the sealed plaintext to out.
+func redisSeal(out, key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := redisGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, plaintext, aad), nil
+}
+
+// redisOpen opens a nonce and sealed value of size bytes from the start of data, the rest of data when size is -1.
+func redisOpen(key, data []byte, size int, aad []byte) ([]byte, []byte, error) {
+	gcm, err := redisGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	end := len(data)
+	if size >= 0 {
+		end = gcm.NonceSize() + size + gcm.Overhead()
+	}
+
+	if len(data) < end || end < gcm.NonceSize()+gcm.Overhead() {
+		return nil, nil, ErrRedisDecrypt
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():end], aad)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrRedisDecrypt, err.Error())
+	}
+
+	return plaintext, data[end:], nil
+}
+
+func redisGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,132 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisEncryption(t *testing.T) {
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 16)
+	user := redisCacheUser{ID: 7, Name: "alice", Roles: []string{"admin"}}
+
+	newEncryption := func(t *testing.T, current string, patterns ...string) *RedisEncryption {
+		provider, err := NewStaticKeyProvider(current, map[string][]byte{"k1": key1, "k2": key2})
+		assert.NoError(t, err)
+		return &RedisEncryption{Keys: provider, Patterns: patterns}
+	}
+
+	t.Run("Typed helpers", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		op.SetEncryption(newEncryption(t, "k1"))
+		assert.NoError(t, SetAs(op, "user:7", user, 0))
+
+		stored := op.Get("user:7").GetBytes()
+		assert.True(t, redisValueEncrypted(stored))
+		assert.NotContains(t, string(stored), "alice")
+
+		got, err := GetAs[redisCacheUser](op, "user:7")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		op.SetEncryption(nil)
+		_, err = GetAs[redisCacheUser](op, "user:7")
+		assert.ErrorIs(t, err, ErrRedisValueEncrypted)
+	})
+
+	t.Run("Patterns", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		op.SetEncryption(newEncryption(t, "k1", "user:*:pii"))
+		assert.NoError(t, SetAs(op, "user:7:pii", user, 0))
+		assert.NoError(t, SetAs(op, "user:7:name", user.Name, 0))
+
+		assert.True(t, redisValueEncrypted(op.Get("user:7:pii").GetBytes()))
+		assert.Equal(t, `"alice"`, op.Get("user:7:name").GetString())
+
+		got, err := GetAs[redisCacheUser](op, "user:7:pii")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+	})
+
+	t.Run("Key rotation", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		op.SetEncryption(newEncryption(t, "k1"))
+		assert.NoError(t, SetAs(op, "user:7", user, 0))
+
+		op.SetEncryption(newEncryption(t, "k2"))
+		got, err := GetAs[redisCacheUser](op, "user:7")
+		assert.NoError(t, err)
+		assert.Equal(t, user, got)
+
+		provider, err := NewStaticKeyProvider("k2", map[string][]byte{"k2": key2})
+		assert.NoError(t, err)
+		op.SetEncryption(&RedisEncryption{Keys: provider})
+		_, err = GetAs[redisCacheUser](op, "user:7")
+		assert.ErrorIs(t, err, ErrEncryptionKeyNotFound)
+	})
+
+	t.Run("Compressed and encrypted", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		op.SetEncryption(newEncryption(t, "k1"))
+		cache := NewCache[string](op, "page:")
+		cache.Compression = RedisCompression{Algorithm: RedisCompressionZstd, Threshold: 16}
+		large := strings.Repeat("payload ", 512)
+		assert.NoError(t, cache.Set("1", large, 0))
+		assert.Less(t, len(op.Get("page:1").GetBytes()), len(large)/4)
+
+		got, err := cache.Get("1")
+		assert.NoError(t, err)
+		assert.Equal(t, large, got)
+	})
+
+	t.Run("Ciphertext is bound to its key", func(t *testing.T) {
+		encryption := newEncryption(t, "k1")
+		data, err := encryption.Encrypt("user:7", []byte("secret"))
+		assert.NoError(t, err)
+
+		_, err = encryption.Decrypt("user:8", data)
+		assert.ErrorIs(t, err, ErrRedisDecrypt)
+
+		data[len(data)-1] ^= 1
+		_, err = encryption.Decrypt("user:7", data)
+		assert.ErrorIs(t, err, ErrRedisDecrypt)
+
+		_, err = encryption.Decrypt("user:7", data[:8])
+		assert.ErrorIs(t, err, ErrRedisDecrypt)
+
+		plaintext, err := encryption.Decrypt("user:7", []byte("plain"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("plain"), plaintext)
+	})
+
+	t.Run("Profile", func(t *testing.T) {
+		encryption, err := NewRedisEncryption(secret.RedisEncryption{})
+		assert.NoError(t, err)
+		assert.Nil(t, encryption)
+
+		_, err = NewStaticKeyProvider("k1", map[string][]byte{"k1": []byte("short")})
+		assert.Error(t, err)
+
+		profile := &secret.Redis{Master: secret.RedisMeta{Host: "localhost", Port: 6379}}
+		profile.Encryption = secret.RedisEncryption{
+			Keys:     map[string]string{"k1": base64.StdEncoding.EncodeToString(key1)},
+			Current:  "k1",
+			Patterns: []string{"user:*"},
+		}
+
+		r := NewRedisWithProfile("encryption", profile)
+		defer r.Close()
+		assert.NotNil(t, r.Master().Encryption())
+		assert.Same(t, r.Master().Encryption(), r.Slave().Encryption())
+		assert.True(t, r.Master().Encryption().Matches("user:7"))
+		assert.False(t, r.Master().Encryption().Matches("session:7"))
+
+		profile.Encryption.Current = "missing"
+		assert.Nil(t, NewRedisWithProfile("encryption", profile))
+	})
+}
@@ -0,0 +1,348 @@
+package datastore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// RedisFixtureEntry is a command and its reply in a fixture, written by a RedisRecorder one JSON object a line.
+// Arguments are recorded as the strings sent to the server. A reply keeps its RESP type: strings are JSON strings,
+// integers JSON numbers, arrays JSON arrays, and doubles, maps and error entries the objects {"f": 1.5},
+// {"m": [[key, value]]} and {"e": "message"}.
+type RedisFixtureEntry struct {
+	Cmd   string      `json:"cmd"`
+	Args  []string    `json:"args,omitempty"`
+	Reply interface{} `json:"reply,omitempty"`
+	// Error is the message of the error of the command, "not_found" for RedisNotFound
+	Error string `json:"error,omitempty"`
+	// Kind is the message of the error kind, e.g. "timeout" for ErrTimeout
+	Kind string `json:"kind,omitempty"`
+}
+
+// redisFixtureKinds are the error kinds restored by a replayed fixture.
+var redisFixtureKinds = []error{ErrDial, ErrPoolExhausted, ErrReadOnly, ErrTimeout, ErrClosed}
+
+// RedisRecorder writes the commands sent by the RedisOp it is set on and their replies to a fixture, loaded by
+// MockRedisOp.LoadFixture to replay realistic traffic in tests.
+type RedisRecorder struct {
+	mutex   sync.Mutex
+	writer  *bufio.Writer
+	closer  io.Closer
+	err     error
+	entries int
+}
+
+// NewRedisRecorder returns a recorder writing the fixture to w.
+func NewRedisRecorder(w io.Writer) *RedisRecorder {
+	return &RedisRecorder{writer: bufio.NewWriter(w)}
+}
+
+// CreateRedisRecorder returns a recorder writing the fixture to the file at path, created or truncated.
+func CreateRedisRecorder(path string) (*RedisRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := NewRedisRecorder(file)
+	recorder.closer = file
+	return recorder, nil
+}
+
+// Entries returns the number of entries written.
+func (r *RedisRecorder) Entries() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.entries
+}
+
+// Flush writes the buffered entries, and returns the first write error.
+func (r *RedisRecorder) Flush() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err == nil {
+		r.err = r.writer.Flush()
+	}
+
+	return r.err
+}
+
+// Close flushes the entries and closes the file of CreateRedisRecorder. Commands recorded afterwards are dropped.
+func (r *RedisRecorder) Close() error {
+	err := r.Flush()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closer != nil {
+		if closeErr := r.closer.Close(); err == nil {
+			err = closeErr
+		}
+
+		r.closer = nil
+	}
+
+	if r.err == nil {
+		r.err = ErrClosed
+	}
+
+	return err
+}
+
+func (r *RedisRecorder) record(cmd string, args []interface{}, data interface{}, err error) {
+	if r == nil {
+		return
+	}
+
+	entry := RedisFixtureEntry{Cmd: cmd}
+	for _, arg := range args {
+		entry.Args = append(entry.Args, mockArgString(arg))
+	}
+
+	if err == nil {
+		entry.Reply = encodeRedisFixtureValue(data)
+	} else {
+		entry.Error = err.Error()
+		for _, kind := range redisFixtureKinds {
+			if errors.Is(err, kind) {
+				entry.Kind = kind.Error()
+				break
+			}
+		}
+	}
+
+	bs, marshalErr := json.Marshal(entry)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return
+	}
+
+	if marshalErr != nil {
+		kklogger.WarnJ("datastore:RedisRecorder.record", fmt.Sprintf("%s: %s", cmd, marshalErr.Error()))
+		return
+	}
+
+	if _, r.err = r.writer.Write(append(bs, '\n')); r.err == nil {
+		r.entries++
+	}
+}
+
+// encodeRedisFixtureValue converts a reply of go-redis to its JSON form in a fixture.
+func encodeRedisFixtureValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = encodeRedisFixtureValue(value)
+		}
+
+		return values
+	case map[interface{}]interface{}:
+		pairs := make([][]interface{}, 0, len(v))
+		for key, value := range v {
+			pairs = append(pairs, []interface{}{encodeRedisFixtureValue(key), encodeRedisFixtureValue(value)})
+		}
+
+		// map iteration is random, sorted pairs keep fixtures diffable
+		sort.Slice(pairs, func(i, j int) bool {
+			return fmt.Sprint(pairs[i][0]) < fmt.Sprint(pairs[j][0])
+		})
+
+		return map[string]interface{}{"m": pairs}
+	case float64:
+		return map[string]interface{}{"f": v}
+	case error:
+		return map[string]interface{}{"e": v.Error()}
+	default:
+		return v
+	}
+}
+
+// decodeRedisFixtureValue converts the JSON form of a reply, decoded with json.Number, back to the types of
+// go-redis.
+func decodeRedisFixtureValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return v.Int64()
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			decoded, err := decodeRedisFixtureValue(value)
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = decoded
+		}
+
+		return values, nil
+	case map[string]interface{}:
+		if f, ok := v["f"].(json.Number); ok {
+			return f.Float64()
+		}
+
+		if e, ok := v["e"].(string); ok {
+			return errors.New(e), nil
+		}
+
+		pairs, ok := v["m"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unknown fixture value %v", v)
+		}
+
+		values := make(map[interface{}]interface{}, len(pairs))
+		for _, pair := range pairs {
+			kv, ok := pair.([]interface{})
+			if !ok || len(kv) != 2 {
+				return nil, fmt.Errorf("invalid fixture map entry %v", pair)
+			}
+
+			key, err := decodeRedisFixtureValue(kv[0])
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeRedisFixtureValue(kv[1])
+			if err != nil {
+				return nil, err
+			}
+
+			values[key] = value
+		}
+
+		return values, nil
+	default:
+		return v, nil
+	}
+}
+
+// response returns the mock response replaying the entry.
+func (e RedisFixtureEntry) response() (MockResponse, error) {
+	if e.Error != "" {
+		if e.Error == RedisNotFound.Error() {
+			return MockResponse{Error: RedisNotFound}, nil
+		}
+
+		err := errors.New(e.Error)
+		for _, kind := range redisFixtureKinds {
+			if kind.Error() == e.Kind {
+				return MockResponse{Error: &DataStoreError{Kind: kind, Store: "redis", Op: e.Cmd, Err: err}}, nil
+			}
+		}
+
+		return MockResponse{Error: err}, nil
+	}
+
+	data, err := decodeRedisFixtureValue(e.Reply)
+	return MockResponse{Data: data}, err
+}
+
+// mockFixtureKey identifies the calls replaying the same entries, by command and arguments.
+func mockFixtureKey(cmd string, args []interface{}) string {
+	var key strings.Builder
+	key.WriteString(strings.ToUpper(cmd))
+	for _, arg := range args {
+		key.WriteByte(0)
+		key.WriteString(mockArgString(arg))
+	}
+
+	return key.String()
+}
+
+// LoadFixture configures the mock to replay the entries read from r, written by a RedisRecorder. A call with the
+// command and arguments of entries returns their replies in order, the last one once exhausted. Responses set
+// with SetResponse and the other setters take precedence over the fixture, loading a fixture again adds its
+// entries after the ones already loaded.
+func (m *MockRedisOp) LoadFixture(r io.Reader) error {
+	fixtures := map[string][]MockResponse{}
+	var keys []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var entry RedisFixtureEntry
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&entry); err != nil {
+			return fmt.Errorf("fixture line %d: %w", line, err)
+		}
+
+		response, err := entry.response()
+		if err != nil {
+			return fmt.Errorf("fixture line %d: %w", line, err)
+		}
+
+		args := make([]interface{}, len(entry.Args))
+		for i, arg := range entry.Args {
+			args[i] = arg
+		}
+
+		key := mockFixtureKey(entry.Cmd, args)
+		if _, ok := fixtures[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		fixtures[key] = append(fixtures[key], response)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.fixtures == nil {
+		m.fixtures, m.fixtureIndexes = map[string][]MockResponse{}, map[string]int{}
+	}
+
+	for _, key := range keys {
+		m.fixtures[key] = append(m.fixtures[key], fixtures[key]...)
+	}
+
+	return nil
+}
+
+// LoadFixtureFile configures the mock to replay the fixture at path, see LoadFixture.
+func (m *MockRedisOp) LoadFixtureFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	return m.LoadFixture(file)
+}
+
+// findFixtureResponse returns the next reply of the fixture entries of the call.
+func (m *MockRedisOp) findFixtureResponse(cmd string, args []interface{}) (MockResponse, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.fixtures) == 0 {
+		return MockResponse{}, false
+	}
+
+	key := mockFixtureKey(cmd, args)
+	responses := m.fixtures[key]
+	if len(responses) == 0 {
+		return MockResponse{}, false
+	}
+
+	index := m.fixtureIndexes[key]
+	if index < len(responses)-1 {
+		m.fixtureIndexes[key] = index + 1
+	}
+
+	return responses[index], true
+}
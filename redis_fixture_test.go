@@ -0,0 +1,95 @@
+package datastore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisFixtureValue(t *testing.T) {
+	recorder := NewRedisRecorder(&bytes.Buffer{})
+	buffer := &bytes.Buffer{}
+	recorder.writer.Reset(buffer)
+	reply := []interface{}{"a", int64(2), 1.5, nil, map[interface{}]interface{}{"k": int64(1), "j": "v"}, errors.New("ERR wrong type")}
+	recorder.record("CUSTOM", []interface{}{"key", 7, []byte("raw")}, reply, nil)
+	recorder.record("GET", []interface{}{"missing"}, nil, RedisNotFound)
+	recorder.record("GET", []interface{}{"slow"}, nil, &DataStoreError{Kind: ErrTimeout, Store: "redis", Op: "GET", Err: errors.New("i/o timeout")})
+	assert.NoError(t, recorder.Close())
+	assert.Equal(t, 3, recorder.Entries())
+	assert.Contains(t, buffer.String(), `{"cmd":"CUSTOM","args":["key","7","raw"],"reply":["a",2,{"f":1.5},null,{"m":[["j","v"],["k",1]]},{"e":"ERR wrong type"}]}`)
+
+	// closed recorders drop the commands
+	recorder.record("GET", []interface{}{"late"}, "v", nil)
+	assert.Equal(t, 3, recorder.Entries())
+
+	mock := NewMockRedisOp()
+	assert.NoError(t, mock.LoadFixture(bytes.NewReader(buffer.Bytes())))
+	response := mock.Do("CUSTOM", "key", int64(7), "raw")
+	assert.NoError(t, response.Error)
+	values := response.data.([]interface{})
+	assert.Equal(t, []interface{}{"a", int64(2), 1.5, nil, map[interface{}]interface{}{"k": int64(1), "j": "v"}}, values[:5])
+	assert.EqualError(t, values[5].(error), "ERR wrong type")
+	assert.ErrorIs(t, mock.Get("missing").Error, RedisNotFound)
+	err := mock.Get("slow").Error
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.EqualError(t, err, "i/o timeout")
+
+	assert.Error(t, mock.LoadFixture(bytes.NewBufferString(`{"cmd":"GET","reply":{"x":1}}`)))
+}
+
+func TestRedisRecorder(t *testing.T) {
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+	redis := NewRedis("test")
+	assert.NotNil(t, redis)
+	defer redis.Close()
+
+	path := filepath.Join(t.TempDir(), "redis.fixture")
+	recorder, err := CreateRedisRecorder(path)
+	assert.NoError(t, err)
+	redis.SetRecorder(recorder)
+	op := redis.Master()
+	defer op.Delete("test_fixture", "test_fixture_hash", "test_fixture_missing")
+	op.Delete("test_fixture_missing")
+	assert.NoError(t, op.Set("test_fixture", 1).Error)
+	op.Incr("test_fixture")
+	assert.Equal(t, "2", op.Get("test_fixture").GetString())
+	assert.NoError(t, op.Set("test_fixture", "b").Error)
+	assert.Equal(t, "b", op.Get("test_fixture").GetString())
+	op.HSet("test_fixture_hash", "f", "v")
+	pipelined := op.Pipeline(RedisPipelineCmd{Cmd: "HGET", Args: []interface{}{"test_fixture_hash", "f"}},
+		RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"test_fixture_missing"}})
+	redis.SetRecorder(nil)
+	op.Get("test_fixture")
+	assert.NoError(t, recorder.Close())
+	assert.Equal(t, 9, recorder.Entries())
+
+	mock := NewMockRedisOp()
+	assert.NoError(t, mock.LoadFixtureFile(path))
+	assert.Equal(t, int64(2), mock.Incr("test_fixture").GetInt64())
+	assert.Equal(t, "2", mock.Get("test_fixture").GetString())
+	assert.Equal(t, "b", mock.Get("test_fixture").GetString())
+	// the last reply is repeated once exhausted
+	assert.Equal(t, "b", mock.Get("test_fixture").GetString())
+	replayed := mock.Pipeline(RedisPipelineCmd{Cmd: "HGET", Args: []interface{}{"test_fixture_hash", "f"}},
+		RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"test_fixture_missing"}})
+	assert.Equal(t, pipelined[0].GetString(), replayed[0].GetString())
+	assert.ErrorIs(t, replayed[1].Error, RedisNotFound)
+
+	// configured responses take precedence
+	mock.SetResponse("GET", "test_fixture", "c", nil)
+	assert.Equal(t, "c", mock.Get("test_fixture").GetString())
+
+	mock.Reset()
+	assert.Nil(t, mock.Incr("test_fixture").data)
+}
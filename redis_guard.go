@@ -0,0 +1,303 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// ErrRedisCommandDenied is returned, wrapped with the command name, for commands rejected by a RedisCommandGuard.
+var ErrRedisCommandDenied = errors.New("redis command denied")
+
+// ErrReadOnlyOperator is returned, wrapped with the command name, for write commands sent through a read-only
+// operator such as Redis.Slave.
+var ErrReadOnlyOperator = fmt.Errorf("redis operator is %w", ErrReadOnly)
+
+// DefaultRedisSlaveReadOnly makes the slave operator reject write commands with ErrReadOnlyOperator, unless its
+// profile sets slave_writable.
+var DefaultRedisSlaveReadOnly = true
+
+// ErrRedisValueTooLarge is returned, wrapped with the command and argument, for arguments above the value size
+// limit of a RedisCommandGuard.
+var ErrRedisValueTooLarge = errors.New("redis value too large")
+
+// ErrRedisInvalidKey is returned, wrapped with the command and key, for keys containing a forbidden character
+// of a RedisCommandGuard.
+var ErrRedisInvalidKey = errors.New("redis key invalid")
+
+// DefaultRedisMaxValueSize is the size in bytes above which command arguments are rejected, unless the profile
+// sets max_value_size. 0 does not limit the size.
+var DefaultRedisMaxValueSize = 0
+
+// DefaultRedisKeyForbiddenChars are the characters rejected in keys, unless the profile sets key_forbidden_chars,
+// e.g. "\r\n " to catch keys built from unsanitized input. Empty allows any key.
+var DefaultRedisKeyForbiddenChars = ""
+
+func init() {
+	envBool("GOTH_DEFAULT_REDIS_SLAVE_READ_ONLY", &DefaultRedisSlaveReadOnly)
+	envInt("GOTH_DEFAULT_REDIS_MAX_VALUE_SIZE", &DefaultRedisMaxValueSize)
+	envStr("GOTH_DEFAULT_REDIS_KEY_FORBIDDEN_CHARS", &DefaultRedisKeyForbiddenChars)
+}
+
+// redisWriteCommands are the commands rejected by read-only guards, the core commands changing the data set
+// and the scripts, which may write. Module commands are not listed.
+var redisWriteCommands = redisCommandSet([]string{
+	"SET", "SETNX", "SETEX", "PSETEX", "MSET", "MSETNX", "GETSET", "GETDEL", "GETEX", "APPEND", "SETRANGE",
+	"INCR", "INCRBY", "INCRBYFLOAT", "DECR", "DECRBY",
+	"DEL", "UNLINK", "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "PERSIST", "RENAME", "RENAMENX", "MOVE", "COPY",
+	"RESTORE", "MIGRATE", "SORT",
+	"HSET", "HSETNX", "HMSET", "HDEL", "HINCRBY", "HINCRBYFLOAT", "HEXPIRE", "HPEXPIRE", "HEXPIREAT", "HPEXPIREAT",
+	"HPERSIST", "HGETDEL", "HGETEX", "HSETEX",
+	"LPUSH", "LPUSHX", "RPUSH", "RPUSHX", "LPOP", "RPOP", "LINSERT", "LSET", "LREM", "LTRIM", "RPOPLPUSH", "LMOVE",
+	"LMPOP", "BLPOP", "BRPOP", "BRPOPLPUSH", "BLMOVE", "BLMPOP",
+	"SADD", "SREM", "SPOP", "SMOVE", "SDIFFSTORE", "SINTERSTORE", "SUNIONSTORE",
+	"ZADD", "ZINCRBY", "ZREM", "ZREMRANGEBYLEX", "ZREMRANGEBYRANK", "ZREMRANGEBYSCORE", "ZPOPMIN", "ZPOPMAX", "ZMPOP",
+	"BZPOPMIN", "BZPOPMAX", "BZMPOP", "ZDIFFSTORE", "ZINTERSTORE", "ZUNIONSTORE", "ZRANGESTORE",
+	"XADD", "XDEL", "XTRIM", "XGROUP", "XACK", "XCLAIM", "XAUTOCLAIM", "XSETID", "XREADGROUP",
+	"GEOADD", "GEOSEARCHSTORE", "PFADD", "PFMERGE", "SETBIT", "BITOP", "BITFIELD",
+	"FLUSHDB", "FLUSHALL", "SWAPDB", "EVAL", "EVALSHA", "FCALL",
+})
+
+// redisKeylessCommands do not take a key as first argument, the keys of scripts follow their number of keys.
+var redisKeylessCommands = redisCommandSet([]string{
+	"PING", "ECHO", "INFO", "CONFIG", "CLIENT", "COMMAND", "SCAN", "KEYS", "RANDOMKEY", "DBSIZE", "TIME", "FLUSHDB",
+	"FLUSHALL", "SWAPDB", "SELECT", "AUTH", "HELLO", "QUIT", "RESET", "MULTI", "EXEC", "DISCARD", "UNWATCH", "WAIT",
+	"WAITAOF", "FAILOVER", "REPLICAOF", "SLAVEOF", "ROLE", "LASTSAVE", "SAVE", "BGSAVE", "BGREWRITEAOF", "SHUTDOWN",
+	"SLOWLOG", "LATENCY", "MEMORY", "OBJECT", "DEBUG", "MONITOR", "SCRIPT", "FUNCTION", "MODULE", "ACL", "CLUSTER",
+	"READONLY", "READWRITE", "PUBLISH", "SPUBLISH", "SUBSCRIBE", "PSUBSCRIBE", "SSUBSCRIBE", "UNSUBSCRIBE",
+	"PUNSUBSCRIBE", "SUNSUBSCRIBE", "PUBSUB", "XREAD", "XREADGROUP", "LMPOP", "BLMPOP", "ZMPOP", "BZMPOP", "SINTERCARD",
+	"ZINTERCARD", "ZINTER", "ZUNION", "ZDIFF", "MIGRATE",
+})
+
+// redisMultiKeyCommands take keys as every argument.
+var redisMultiKeyCommands = redisCommandSet([]string{
+	"DEL", "UNLINK", "EXISTS", "TOUCH", "MGET", "WATCH", "SINTER", "SUNION", "SDIFF", "PFCOUNT",
+	"SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE", "PFMERGE",
+})
+
+// redisTwoKeyCommands take a source and a destination key as first arguments.
+var redisTwoKeyCommands = redisCommandSet([]string{
+	"RENAME", "RENAMENX", "SMOVE", "RPOPLPUSH", "BRPOPLPUSH", "LMOVE", "BLMOVE", "COPY", "ZRANGESTORE",
+	"GEOSEARCHSTORE",
+})
+
+// RedisCommandGuard restricts the commands an operator sends, see RedisOp.SetCommandGuard and the
+// allow_commands, deny_commands, max_value_size and key_forbidden_chars fields of the profile.
+// Rejected commands are logged and never reach the server.
+//
+// Entries are command names, or a command and its subcommand in ACL form such as "CONFIG|SET", case-insensitive.
+type RedisCommandGuard struct {
+	allow        map[string]bool
+	deny         map[string]bool
+	readOnly     bool
+	maxValueSize int
+	forbidden    string
+}
+
+// NewRedisCommandGuard returns a guard rejecting the commands of deny, and every command missing from allow
+// when it is not empty. It returns nil, allowing every command, when both are empty.
+func NewRedisCommandGuard(allow, deny []string) *RedisCommandGuard {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+
+	return &RedisCommandGuard{allow: redisCommandSet(allow), deny: redisCommandSet(deny)}
+}
+
+// WithReadOnly returns a copy of the guard also rejecting write commands with ErrReadOnlyOperator,
+// read-only scripts run with EVAL_RO or FCALL_RO.
+func (g *RedisCommandGuard) WithReadOnly() *RedisCommandGuard {
+	guard := &RedisCommandGuard{}
+	if g != nil {
+		*guard = *g
+	}
+
+	guard.readOnly = true
+	return guard
+}
+
+// WithLimits returns a copy of the guard also rejecting arguments longer than maxValueSize bytes with
+// ErrRedisValueTooLarge, and keys containing one of the characters of forbidden with ErrRedisInvalidKey.
+// A maxValueSize of 0 and an empty forbidden disable the checks, the guard itself is returned when both are.
+func (g *RedisCommandGuard) WithLimits(maxValueSize int, forbidden string) *RedisCommandGuard {
+	if maxValueSize <= 0 && forbidden == "" {
+		return g
+	}
+
+	guard := &RedisCommandGuard{}
+	if g != nil {
+		*guard = *g
+	}
+
+	guard.maxValueSize, guard.forbidden = max(maxValueSize, 0), forbidden
+	return guard
+}
+
+// ReadOnly reports whether the guard rejects write commands.
+func (g *RedisCommandGuard) ReadOnly() bool {
+	return g != nil && g.readOnly
+}
+
+// Check returns ErrRedisCommandDenied when cmd with args is rejected, or ErrReadOnlyOperator when the guard is
+// read-only and cmd writes. A nil guard allows every command.
+func (g *RedisCommandGuard) Check(cmd string, args ...interface{}) error {
+	if g == nil {
+		return nil
+	}
+
+	name := strings.ToUpper(cmd)
+	if g.readOnly && redisWriteCommands[name] {
+		kklogger.WarnJ("datastore:RedisCommandGuard.Check", fmt.Sprintf("write command %s on a read-only operator", name))
+		return fmt.Errorf("%w: %s", ErrReadOnlyOperator, name)
+	}
+
+	full := name
+	if len(args) > 0 {
+		full = name + "|" + strings.ToUpper(redisClientCacheKey(args[0]))
+	}
+
+	denied := g.deny[name] || g.deny[full]
+	if len(g.allow) > 0 && !g.allow[name] && !g.allow[full] {
+		denied = true
+	}
+
+	if denied {
+		kklogger.WarnJ("datastore:RedisCommandGuard.Check", fmt.Sprintf("command %s denied", name))
+		return fmt.Errorf("%w: %s", ErrRedisCommandDenied, name)
+	}
+
+	return g.checkArgs(name, args)
+}
+
+// checkArgs validates the size of the arguments and the characters of the keys of the command name.
+func (g *RedisCommandGuard) checkArgs(name string, args []interface{}) error {
+	if g.maxValueSize > 0 {
+		for i, arg := range args {
+			if size := redisArgSize(arg); size > g.maxValueSize {
+				err := fmt.Errorf("%w: argument %d of %s is %d bytes, above the limit of %d bytes",
+					ErrRedisValueTooLarge, i+1, name, size, g.maxValueSize)
+				kklogger.WarnJ("datastore:RedisCommandGuard.Check", err.Error())
+				return err
+			}
+		}
+	}
+
+	if g.forbidden == "" {
+		return nil
+	}
+
+	for _, key := range redisCommandKeys(name, args) {
+		if key := redisClientCacheKey(key); strings.ContainsAny(key, g.forbidden) {
+			err := fmt.Errorf("%w: key %q of %s contains a forbidden character", ErrRedisInvalidKey, key, name)
+			kklogger.WarnJ("datastore:RedisCommandGuard.Check", err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+func redisArgSize(arg interface{}) int {
+	switch v := arg.(type) {
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	default:
+		return 0
+	}
+}
+
+// redisCommandKeys returns the key arguments of the command name, the first argument unless it is keyless.
+func redisCommandKeys(name string, args []interface{}) []interface{} {
+	indexes := redisCommandKeyIndexes(name, args)
+	keys := make([]interface{}, len(indexes))
+	for i, index := range indexes {
+		keys[i] = args[index]
+	}
+
+	return keys
+}
+
+// redisCommandKeyIndexes returns the indexes in args of the key arguments of the command name.
+func redisCommandKeyIndexes(name string, args []interface{}) []int {
+	first, step, end := 0, 1, 1
+	switch {
+	case len(args) == 0:
+		return nil
+	case redisMultiKeyCommands[name]:
+		end = len(args)
+	case name == "MSET" || name == "MSETNX":
+		step, end = 2, len(args)
+	case redisTwoKeyCommands[name]:
+		end = min(2, len(args))
+	case name == "BITOP":
+		first, end = 1, len(args)
+	case name == "ZUNIONSTORE" || name == "ZINTERSTORE" || name == "ZDIFFSTORE":
+		// the destination, then numkeys keys
+		if len(args) < 2 {
+			return []int{0}
+		}
+
+		numkeys, err := strconv.Atoi(redisClientCacheKey(args[1]))
+		if err != nil || numkeys < 0 || numkeys > len(args)-2 {
+			return []int{0}
+		}
+
+		indexes := []int{0}
+		for i := 2; i < 2+numkeys; i++ {
+			indexes = append(indexes, i)
+		}
+
+		return indexes
+	case strings.HasPrefix(name, "EVAL") || strings.HasPrefix(name, "FCALL"):
+		if len(args) < 2 {
+			return nil
+		}
+
+		numkeys, err := strconv.Atoi(redisClientCacheKey(args[1]))
+		if err != nil || numkeys < 0 || numkeys > len(args)-2 {
+			return nil
+		}
+
+		first, end = 2, 2+numkeys
+	case redisKeylessCommands[name]:
+		return nil
+	}
+
+	indexes := make([]int, 0, (end-first+step-1)/step)
+	for i := first; i < end; i += step {
+		indexes = append(indexes, i)
+	}
+
+	return indexes
+}
+
+// checkAll returns the error of the first rejected command of cmds.
+func (g *RedisCommandGuard) checkAll(cmds []RedisPipelineCmd) error {
+	if g == nil {
+		return nil
+	}
+
+	for _, c := range cmds {
+		if err := g.Check(c.Cmd, c.Args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func redisCommandSet(commands []string) map[string]bool {
+	set := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		if command = strings.ToUpper(strings.TrimSpace(command)); command != "" {
+			set[command] = true
+		}
+	}
+
+	return set
+}
@@ -0,0 +1,169 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisCommandGuard(t *testing.T) {
+	t.Run("Check", func(t *testing.T) {
+		assert.Nil(t, NewRedisCommandGuard(nil, nil))
+		assert.NoError(t, (*RedisCommandGuard)(nil).Check("FLUSHALL"))
+
+		deny := NewRedisCommandGuard(nil, []string{"flushall", "KEYS", "config|set"})
+		assert.ErrorIs(t, deny.Check("FLUSHALL"), ErrRedisCommandDenied)
+		assert.ErrorIs(t, deny.Check("keys", "*"), ErrRedisCommandDenied)
+		assert.ErrorIs(t, deny.Check("CONFIG", "set", "maxmemory", "1"), ErrRedisCommandDenied)
+		assert.NoError(t, deny.Check("CONFIG", "GET", "maxmemory"))
+		assert.NoError(t, deny.Check("GET", "keys"))
+
+		allow := NewRedisCommandGuard([]string{"GET", "SET", "CONFIG|GET"}, []string{"SET"})
+		assert.NoError(t, allow.Check("get", "key"))
+		assert.NoError(t, allow.Check("CONFIG", "GET", "maxmemory"))
+		assert.ErrorIs(t, allow.Check("SET", "key", "value"), ErrRedisCommandDenied)
+		assert.ErrorIs(t, allow.Check("DEL", "key"), ErrRedisCommandDenied)
+		assert.EqualError(t, allow.Check("CONFIG", "SET"), "redis command denied: CONFIG")
+	})
+
+	t.Run("Mock", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.SetCommandGuard(NewRedisCommandGuard(nil, []string{"FLUSHALL", "SUBSCRIBE"}))
+		assert.ErrorIs(t, op.FlushAll().Error, ErrRedisCommandDenied)
+		assert.NoError(t, op.Set("key", "value").Error)
+		assert.Equal(t, 0, op.GetCallCount("FLUSHALL"))
+
+		responses := op.Pipeline(RedisPipelineCmd{Cmd: "SET", Args: []interface{}{"key", "value"}}, RedisPipelineCmd{Cmd: "FLUSHALL"})
+		assert.ErrorIs(t, responses[0].Error, ErrRedisCommandDenied)
+		assert.ErrorIs(t, responses[1].Error, ErrRedisCommandDenied)
+		assert.Equal(t, 0, op.GetCallCount("PIPELINE"))
+
+		_, err := op.Subscribe(context.Background(), "channel")
+		assert.ErrorIs(t, err, ErrRedisCommandDenied)
+	})
+
+	t.Run("Profile", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		profile, err := secret.LoadRedisProfile("test")
+		assert.NoError(t, err)
+		profile.DenyCommands = []string{"FLUSHALL", "FLUSHDB", "KEYS"}
+		redis := NewRedisWithProfile("test", profile)
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		assert.ErrorIs(t, redis.Master().FlushAll().Error, ErrRedisCommandDenied)
+		assert.ErrorIs(t, redis.Master().Do("flushdb").Error, ErrRedisCommandDenied)
+		for _, op := range []RedisOperator{redis.Master(), redis.Slave()} {
+			assert.ErrorIs(t, op.Keys("*").Error, ErrRedisCommandDenied)
+			assert.NoError(t, op.Ping().Error)
+		}
+
+		responses := redis.Master().Pipeline(RedisPipelineCmd{Cmd: "PING"}, RedisPipelineCmd{Cmd: "FLUSHDB"})
+		assert.ErrorIs(t, responses[0].Error, ErrRedisCommandDenied)
+
+		redis.SetCommandGuard(nil)
+		assert.Nil(t, redis.Master().CommandGuard())
+		assert.NoError(t, redis.Master().Keys("test_guard_*").Error)
+	})
+
+	t.Run("Read-only slave", func(t *testing.T) {
+		guard := NewRedisCommandGuard(nil, []string{"KEYS"}).WithReadOnly()
+		assert.True(t, guard.ReadOnly())
+		assert.False(t, (*RedisCommandGuard)(nil).ReadOnly())
+		assert.ErrorIs(t, guard.Check("zadd", "key", 1, "member"), ErrReadOnlyOperator)
+		assert.ErrorIs(t, guard.Check("KEYS", "*"), ErrRedisCommandDenied)
+		assert.NoError(t, guard.Check("EVAL_RO", "return 1", 0))
+		assert.NoError(t, guard.Check("ZRANGE", "key", 0, -1))
+
+		mock := NewStatefulMockRedis()
+		assert.NoError(t, mock.Master().Set("key", "value").Error)
+		assert.ErrorIs(t, mock.Slave().Set("key", "other").Error, ErrReadOnlyOperator)
+		assert.ErrorIs(t, mock.Slave().Delete("key").Error, ErrReadOnlyOperator)
+		assert.Equal(t, "value", mock.Slave().Get("key").GetString())
+
+		mock.SetCommandGuard(NewRedisCommandGuard(nil, []string{"FLUSHALL"}))
+		assert.False(t, mock.Master().CommandGuard().ReadOnly())
+		assert.True(t, mock.Slave().CommandGuard().ReadOnly())
+		assert.ErrorIs(t, mock.Slave().FlushAll().Error, ErrReadOnlyOperator)
+		assert.NoError(t, mock.Slave().Keys("*").Error)
+
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+		assert.ErrorIs(t, redis.Slave().Set("test_read_only", "value").Error, ErrReadOnlyOperator)
+		assert.ErrorIs(t, redis.Slave().Pipeline(RedisPipelineCmd{Cmd: "DEL", Args: []interface{}{"test_read_only"}})[0].Error,
+			ErrReadOnlyOperator)
+		assert.ErrorIs(t, redis.Slave().Get("test_read_only").Error, RedisNotFound)
+
+		profile, err := secret.LoadRedisProfile("test")
+		assert.NoError(t, err)
+		profile.SlaveWritable = true
+		writable := NewRedisWithProfile("test", profile)
+		defer writable.Close()
+		assert.Nil(t, writable.Slave().CommandGuard())
+		assert.NoError(t, writable.Slave().Delete("test_read_only").Error)
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		assert.Nil(t, (*RedisCommandGuard)(nil).WithLimits(0, ""))
+		guard := NewRedisCommandGuard(nil, []string{"KEYS"}).WithLimits(8, "\r\n ")
+		assert.ErrorIs(t, guard.Check("KEYS", "*"), ErrRedisCommandDenied)
+		assert.NoError(t, guard.Check("SET", "key", "12345678"))
+		assert.NoError(t, guard.Check("INCRBY", "key", int64(123456789012)))
+		err := guard.Check("SET", "key", []byte("123456789"))
+		assert.ErrorIs(t, err, ErrRedisValueTooLarge)
+		assert.EqualError(t, err, "redis value too large: argument 2 of SET is 9 bytes, above the limit of 8 bytes")
+
+		err = guard.Check("get", "user 1")
+		assert.ErrorIs(t, err, ErrRedisInvalidKey)
+		assert.EqualError(t, err, `redis key invalid: key "user 1" of GET contains a forbidden character`)
+		assert.ErrorIs(t, guard.Check("DEL", "a", "b\n"), ErrRedisInvalidKey)
+		assert.ErrorIs(t, guard.Check("MSET", "a", "1", "b\r", "2"), ErrRedisInvalidKey)
+		assert.NoError(t, guard.Check("MSET", "a", "x y", "b", "2"))
+		assert.ErrorIs(t, guard.Check("EVAL", "return 1", 1, "a b", "c"), ErrRedisInvalidKey)
+		assert.NoError(t, guard.Check("EVAL", "return 1", 1, "a", "c d"))
+		assert.NoError(t, guard.Check("PUBLISH", "a b", "hi"))
+		assert.NoError(t, guard.Check("HSET", "hash", "f g", "value"))
+
+		op := NewMockRedisOp()
+		op.SetCommandGuard(guard.WithReadOnly())
+		assert.ErrorIs(t, op.Get("a\nb").Error, ErrRedisInvalidKey)
+		assert.ErrorIs(t, op.Set("a", "b").Error, ErrReadOnlyOperator)
+		assert.Equal(t, 0, op.GetCallCount("GET"))
+
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		profile, err := secret.LoadRedisProfile("test")
+		assert.NoError(t, err)
+		profile.MaxValueSize = 1024
+		profile.KeyForbiddenChars = "\n"
+		redis := NewRedisWithProfile("test", profile)
+		assert.NotNil(t, redis)
+		defer redis.Close()
+		assert.ErrorIs(t, redis.Master().Set("test_limits", make([]byte, 1025)).Error, ErrRedisValueTooLarge)
+		assert.ErrorIs(t, redis.Slave().Get("test\nlimits").Error, ErrRedisInvalidKey)
+		assert.ErrorIs(t, redis.Master().Get("test_limits").Error, RedisNotFound)
+	})
+}
@@ -0,0 +1,79 @@
+package datastore
+
+// DefaultRedisHashChunkSize is the maximum number of fields per HMSET and HMGET, larger field sets are split into
+// several commands sent in one MULTI/EXEC transaction. 0 never splits them.
+var DefaultRedisHashChunkSize = 1000
+
+func init() {
+	envInt("GOTH_DEFAULT_REDIS_HASH_CHUNK_SIZE", &DefaultRedisHashChunkSize)
+}
+
+// hmSet sets the fields of the hash key in the order of pairs, with one HMSET unless there are more than
+// DefaultRedisHashChunkSize pairs.
+func hmSet(op RedisOperator, key interface{}, pairs [][2]interface{}) *RedisResponse {
+	args := make([]interface{}, 0, 2*len(pairs))
+	for _, pair := range pairs {
+		args = append(args, pair[0], pair[1])
+	}
+
+	cmds := redisHashChunks("HMSET", key, args, 2)
+	if len(cmds) == 1 {
+		return op.Do("HMSET", cmds[0].Args...)
+	}
+
+	for _, response := range op.PipelineWithOptions(RedisPipelineOptions{Transaction: true}, cmds...) {
+		if response.Error != nil {
+			return response
+		}
+	}
+
+	return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: "OK"}}
+}
+
+// hmGet gets the values of fields of the hash key in order, with one HMGET unless there are more than
+// DefaultRedisHashChunkSize fields.
+func hmGet(op RedisOperator, key interface{}, fields []interface{}) *RedisResponse {
+	cmds := redisHashChunks("HMGET", key, fields, 1)
+	if len(cmds) == 1 {
+		return op.Do("HMGET", cmds[0].Args...)
+	}
+
+	values := make([]interface{}, 0, len(fields))
+	for _, response := range op.PipelineWithOptions(RedisPipelineOptions{Transaction: true}, cmds...) {
+		if response.Error != nil {
+			return response
+		}
+
+		if reply, ok := response.data.([]interface{}); ok {
+			values = append(values, reply...)
+		}
+	}
+
+	return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: values}}
+}
+
+// redisHashChunks splits args, in units of unit arguments, into commands cmd on key of at most
+// DefaultRedisHashChunkSize units each. A single command is returned when they fit or splitting is disabled.
+func redisHashChunks(cmd string, key interface{}, args []interface{}, unit int) []RedisPipelineCmd {
+	size := DefaultRedisHashChunkSize * unit
+	if size <= 0 || len(args) <= size {
+		return []RedisPipelineCmd{{Cmd: cmd, Args: append([]interface{}{key}, args...)}}
+	}
+
+	cmds := make([]RedisPipelineCmd, 0, (len(args)+size-1)/size)
+	for start := 0; start < len(args); start += size {
+		chunk := args[start:min(start+size, len(args))]
+		cmds = append(cmds, RedisPipelineCmd{Cmd: cmd, Args: append([]interface{}{key}, chunk...)})
+	}
+
+	return cmds
+}
+
+func redisHashPairs(val map[interface{}]interface{}) [][2]interface{} {
+	pairs := make([][2]interface{}, 0, len(val))
+	for mk, mv := range val {
+		pairs = append(pairs, [2]interface{}{mk, mv})
+	}
+
+	return pairs
+}
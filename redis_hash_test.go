@@ -0,0 +1,87 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisHashChunks(t *testing.T) {
+	defer func(size int) {
+		DefaultRedisHashChunkSize = size
+	}(DefaultRedisHashChunkSize)
+
+	DefaultRedisHashChunkSize = 4
+	pairs := make([][2]interface{}, 10)
+	fields := make([]interface{}, 11)
+	for i := range pairs {
+		pairs[i] = [2]interface{}{fmt.Sprintf("f%d", i), i}
+		fields[i] = fmt.Sprintf("f%d", i)
+	}
+
+	fields[10] = "missing"
+	check := func(t *testing.T, op RedisOperator, key string) {
+		assert.NoError(t, op.HMSetOrdered(key, pairs).Error)
+		values := op.HMGet(key, fields...).GetSlice()
+		assert.Len(t, values, 11)
+		for i, value := range values[:10] {
+			assert.Equal(t, fmt.Sprint(i), value.GetString())
+		}
+
+		assert.Nil(t, values[10].data)
+		assert.Equal(t, int64(10), op.HLen(key).GetInt64())
+	}
+
+	t.Run("Mock", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		check(t, op, "hash")
+
+		calls := op.GetCallsByCommand("TXPIPELINE")
+		assert.Len(t, calls, 2)
+		cmds := calls[0].Args[0].([]RedisPipelineCmd)
+		assert.Len(t, cmds, 3)
+		assert.Equal(t, RedisPipelineCmd{Cmd: "HMSET", Args: []interface{}{"hash", "f0", 0, "f1", 1, "f2", 2, "f3", 3}}, cmds[0])
+		assert.Equal(t, RedisPipelineCmd{Cmd: "HMSET", Args: []interface{}{"hash", "f8", 8, "f9", 9}}, cmds[2])
+		assert.Len(t, calls[1].Args[0].([]RedisPipelineCmd), 3)
+
+		// Small field sets are sent as one command, in order
+		assert.NoError(t, op.HMSetOrdered("small", pairs[:2]).Error)
+		assert.Equal(t, []interface{}{"small", "f0", 0, "f1", 1}, op.GetCallsByCommand("HMSET")[0].Args)
+		assert.NoError(t, op.HMSet("small", map[interface{}]interface{}{"f2": 2}).Error)
+		assert.Equal(t, "2", op.HGet("small", "f2").GetString())
+
+		DefaultRedisHashChunkSize = 0
+		assert.NoError(t, op.HMSetOrdered("unsplit", pairs).Error)
+		assert.Len(t, op.GetCallsByCommand("HMSET")[2].Args, 21)
+		DefaultRedisHashChunkSize = 4
+
+		failure := errors.New("failure")
+		op.SetResponse("HMSET", "failing", nil, failure)
+		assert.ErrorIs(t, op.HMSetOrdered("failing", pairs).Error, failure)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+		defer redis.Master().Delete("test_hash_chunks")
+
+		check(t, redis.Master(), "test_hash_chunks")
+		guard := NewRedisCommandGuard(nil, nil).WithLimits(0, " ")
+		redis.Master().SetCommandGuard(guard)
+		assert.ErrorIs(t, redis.Master().HMSetOrdered("test hash", pairs).Error, ErrRedisInvalidKey)
+	})
+}
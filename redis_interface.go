@@ -1,6 +1,9 @@
 package datastore
 
 import (
+	"context"
+	"time"
+
 	secret "github.com/yetiz-org/goth-datastore/secrets"
 )
 
@@ -10,19 +13,35 @@ import (
 type RedisOperator interface {
 	// Connection and pool management
 	Meta() secret.RedisMeta
+	Cluster() bool
 	ActiveCount() int
 	IdleCount() int
 	Close() error
 
+	// Serialization and encryption of the typed helpers, see GetAs, SetAs and Cache
+	Codec() Codec
+	SetCodec(codec Codec)
+	Encryption() *RedisEncryption
+	SetEncryption(encryption *RedisEncryption)
+
+	// Command restriction, see RedisCommandGuard
+	CommandGuard() *RedisCommandGuard
+	SetCommandGuard(guard *RedisCommandGuard)
+
 	// Pipeline operations
 	Do(cmd string, args ...interface{}) *RedisResponse
+	DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) *RedisResponse
 	Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse
+	PipelineWithOptions(opts RedisPipelineOptions, cmds ...RedisPipelineCmd) []*RedisResponse
+	PipelineCtx(ctx context.Context, cmds ...RedisPipelineCmd) []*RedisResponse
+	ExecCtx(ctx context.Context, f func(tx *RedisTx) error) ([]*RedisResponse, error)
 
 	// String operations
 	Get(key interface{}) *RedisResponse
 	Set(key interface{}, val interface{}) *RedisResponse
 	SetWithOptions(key interface{}, val interface{}, opts SetOptions) *RedisResponse
 	SetExpire(key interface{}, val interface{}, ttl int64) *RedisResponse
+	SetExpireJitter(key interface{}, val interface{}, ttl int64, jitterFraction float64) *RedisResponse
 	SetNX(key interface{}, val interface{}) *RedisResponse
 	MSetNX(keyvals ...interface{}) *RedisResponse
 	Incr(key interface{}) *RedisResponse
@@ -36,6 +55,7 @@ type RedisOperator interface {
 
 	// Hash operations
 	HMSet(key interface{}, val map[interface{}]interface{}) *RedisResponse
+	HMSetOrdered(key interface{}, pairs [][2]interface{}) *RedisResponse
 	HMGet(key interface{}, field ...interface{}) *RedisResponse
 	HSet(key, field, val interface{}) *RedisResponse
 	HSetNX(key, field, val interface{}) *RedisResponse
@@ -48,14 +68,29 @@ type RedisOperator interface {
 	HIncrBy(key interface{}, field interface{}, val int64) *RedisResponse
 	HVals(key interface{}) *RedisResponse
 	HScan(key interface{}, cursor int64, match string, count int64) *RedisResponse
+	HScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error)
+	HRandField(key interface{}) *RedisResponse
+	HRandFieldN(key interface{}, count int64, withValues bool) *RedisResponse
+	HStrLen(key, field interface{}) *RedisResponse
 
 	// Key operations
 	Expire(key interface{}, ttl int64) *RedisResponse
+	ExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse
+	PExpire(key interface{}, ttl int64) *RedisResponse
+	PExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse
+	ExpireAt(key interface{}, timestamp int64) *RedisResponse
+	ExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse
+	PExpireAt(key interface{}, timestamp int64) *RedisResponse
+	PExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse
+	ExpireTime(key interface{}) *RedisResponse
+	PExpireTime(key interface{}) *RedisResponse
 	Delete(key ...interface{}) *RedisResponse
 	Keys(key interface{}) *RedisResponse
 	Exists(key ...interface{}) *RedisResponse
 	Copy(src, dst interface{}) *RedisResponse
 	Dump(key interface{}) *RedisResponse
+	Restore(key interface{}, ttl int64, payload []byte, replace bool) *RedisResponse
+	Migrate(host string, port uint, key interface{}, db int, timeout int64, opts MigrateOptions) *RedisResponse
 	TTL(key interface{}) *RedisResponse
 	PTTL(key interface{}) *RedisResponse
 	Type(key interface{}) *RedisResponse
@@ -64,6 +99,8 @@ type RedisOperator interface {
 	RenameNX(oldKey, newKey interface{}) *RedisResponse
 	Touch(key ...interface{}) *RedisResponse
 	Unlink(key ...interface{}) *RedisResponse
+	DeleteByPattern(pattern string, batchSize int64) *RedisResponse
+	DeleteByPatternWithOptions(pattern string, opts DeleteByPatternOptions) *RedisResponse
 	Persist(key interface{}) *RedisResponse
 
 	// List operations
@@ -73,7 +110,9 @@ type RedisOperator interface {
 	LMove(source, destination interface{}, srcWhere, dstWhere string) *RedisResponse
 	LMPop(count int64, where string, key ...interface{}) *RedisResponse
 	LPop(key interface{}) *RedisResponse
+	LPopN(key interface{}, count int64) *RedisResponse
 	LPos(key, element interface{}) *RedisResponse
+	LPosWithOptions(key, element interface{}, opts LPosOptions) *RedisResponse
 	LPush(key interface{}, val ...interface{}) *RedisResponse
 	LPushX(key interface{}, val ...interface{}) *RedisResponse
 	LRange(key interface{}, start, stop int64) *RedisResponse
@@ -81,6 +120,7 @@ type RedisOperator interface {
 	LSet(key interface{}, index int64, element interface{}) *RedisResponse
 	LTrim(key interface{}, start, stop int64) *RedisResponse
 	RPop(key interface{}) *RedisResponse
+	RPopN(key interface{}, count int64) *RedisResponse
 	RPopLPush(source, destination interface{}) *RedisResponse
 	RPush(key interface{}, val ...interface{}) *RedisResponse
 	RPushX(key interface{}, val ...interface{}) *RedisResponse
@@ -99,13 +139,17 @@ type RedisOperator interface {
 	SMove(source, destination, member interface{}) *RedisResponse
 	SPop(key interface{}) *RedisResponse
 	SRandMember(key interface{}) *RedisResponse
+	SPopN(key interface{}, count int64) *RedisResponse
+	SRandMemberN(key interface{}, count int64) *RedisResponse
 	SRem(key interface{}, member ...interface{}) *RedisResponse
 	SScan(key interface{}, cursor int64, match string, count int64) *RedisResponse
+	SScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error)
 	SUnion(key ...interface{}) *RedisResponse
 	SUnionStore(destination interface{}, key ...interface{}) *RedisResponse
 
 	// Sorted Set operations
 	ZAdd(key interface{}, score float64, member interface{}, pairs ...interface{}) *RedisResponse
+	ZAddWithOptions(key interface{}, opts ZAddOptions, score float64, member interface{}, pairs ...interface{}) *RedisResponse
 	ZCard(key interface{}) *RedisResponse
 	ZCount(key interface{}, min, max string) *RedisResponse
 	ZDiff(key ...interface{}) *RedisResponse
@@ -120,7 +164,9 @@ type RedisOperator interface {
 	ZPopMax(key interface{}) *RedisResponse
 	ZPopMin(key interface{}) *RedisResponse
 	ZRandMember(key interface{}) *RedisResponse
+	ZRandMemberN(key interface{}, count int64, withScores bool) *RedisResponse
 	ZRange(key interface{}, start, stop int64) *RedisResponse
+	ZRangeWithOptions(key interface{}, start, stop string, opts ZRangeOptions) *RedisResponse
 	ZRangeByLex(key interface{}, min, max string) *RedisResponse
 	ZRangeByScore(key interface{}, min, max string) *RedisResponse
 	ZRangeStore(dst interface{}, src interface{}, min, max int64) *RedisResponse
@@ -134,6 +180,7 @@ type RedisOperator interface {
 	ZRemRangeByScore(key interface{}, min, max string) *RedisResponse
 	ZRevRank(key, member interface{}) *RedisResponse
 	ZScan(key interface{}, cursor int64, match string, count int64) *RedisResponse
+	ZScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error)
 	ZScore(key, member interface{}) *RedisResponse
 	ZUnion(key ...interface{}) *RedisResponse
 	ZUnionStore(destination interface{}, key ...interface{}) *RedisResponse
@@ -142,9 +189,29 @@ type RedisOperator interface {
 	FlushDB() *RedisResponse
 	FlushAll() *RedisResponse
 	Scan(cursor int64, match string, count int64) *RedisResponse
+	ScanTyped(cursor int64, match string, count int64) (*ScanResult, error)
 	Ping() *RedisResponse
 	Publish(key interface{}, val interface{}) *RedisResponse
+	Subscribe(ctx context.Context, channels ...string) (<-chan *RedisMessage, error)
+
+	// Connection operations
+	ClientList() *RedisResponse
+	ClientKill(args ...interface{}) *RedisResponse
+	ClientGetName() *RedisResponse
+	ClientSetName(name string) *RedisResponse
+
+	// Replication operations
+	Wait(numreplicas int64, timeout int64) *RedisResponse
+	Failover(opts FailoverOptions) *RedisResponse
 
 	// Script operations
 	Eval(script string, keys []interface{}, args []interface{}) *RedisResponse
+	EvalSha(sha string, keys []interface{}, args []interface{}) *RedisResponse
+	ScriptLoad(script string) *RedisResponse
 }
+
+// Compile-time checks that the real and mock operators stay in sync with RedisOperator.
+var (
+	_ RedisOperator = (*RedisOp)(nil)
+	_ RedisOperator = (*MockRedisOp)(nil)
+)
@@ -0,0 +1,216 @@
+package datastore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultRedisInvalidationChannel is the channel of invalidation buses created with an empty channel.
+var DefaultRedisInvalidationChannel = "goth:invalidation"
+
+// DefaultRedisInvalidationRetry is the delay before an invalidation bus subscribes again after a failure.
+var DefaultRedisInvalidationRetry = time.Second
+
+func init() {
+	envStr("GOTH_DEFAULT_REDIS_INVALIDATION_CHANNEL", &DefaultRedisInvalidationChannel)
+	envMillis("GOTH_DEFAULT_REDIS_INVALIDATION_RETRY", &DefaultRedisInvalidationRetry)
+}
+
+// InvalidationHandler is called with an invalidated key, or with an empty key when every key of its prefix
+// must be dropped because invalidations may have been missed while the subscription was down.
+type InvalidationHandler func(key string)
+
+// InvalidationBus broadcasts key invalidations to every instance subscribed to the same channel, see
+// NewInvalidationBus. Writers call Publish, and each instance evicts its local copies of the keys from the
+// handlers registered with OnInvalidate.
+type InvalidationBus struct {
+	op      RedisOperator
+	channel string
+	id      string
+
+	mutex      sync.RWMutex
+	handlers   map[uint64]invalidationEntry
+	next       uint64
+	subscribed chan struct{}
+	cancel     context.CancelFunc
+	done       chan struct{}
+	close      sync.Once
+}
+
+type invalidationEntry struct {
+	prefix  string
+	handler InvalidationHandler
+}
+
+type invalidationMessage struct {
+	Source string   `json:"source"`
+	Keys   []string `json:"keys"`
+}
+
+// NewInvalidationBus subscribes to channel of op in the background until Close,
+// an empty channel uses DefaultRedisInvalidationChannel.
+func NewInvalidationBus(op RedisOperator, channel string) *InvalidationBus {
+	if channel == "" {
+		channel = DefaultRedisInvalidationChannel
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &InvalidationBus{
+		op:         op,
+		channel:    channel,
+		id:         hex.EncodeToString(id),
+		handlers:   map[uint64]invalidationEntry{},
+		subscribed: make(chan struct{}),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+
+	go b.subscribe(ctx)
+	return b
+}
+
+// NewInvalidationBus subscribes to channel on the master, see NewInvalidationBus.
+func (r *Redis) NewInvalidationBus(channel string) *InvalidationBus {
+	return NewInvalidationBus(r.Master(), channel)
+}
+
+// Channel returns the channel the invalidations are published on.
+func (b *InvalidationBus) Channel() string {
+	return b.channel
+}
+
+// OnInvalidate calls handler for the invalidated keys starting with prefix, an empty prefix matches every key.
+// Handlers run on the goroutine of the subscriber or of Publish, so they should be quick.
+// The returned function removes the handler.
+func (b *InvalidationBus) OnInvalidate(prefix string, handler InvalidationHandler) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.next++
+	id := b.next
+	b.handlers[id] = invalidationEntry{prefix: prefix, handler: handler}
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish invalidates keys on this instance, then on the other instances subscribed to the channel.
+func (b *InvalidationBus) Publish(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for _, key := range keys {
+		b.invalidate(key)
+	}
+
+	payload, err := json.Marshal(invalidationMessage{Source: b.id, Keys: keys})
+	if err != nil {
+		return err
+	}
+
+	return b.op.Publish(b.channel, payload).Error
+}
+
+// Wait blocks until the bus is subscribed or ctx is done, invalidations published before are not received.
+func (b *InvalidationBus) Wait(ctx context.Context) error {
+	select {
+	case <-b.subscribed:
+		return nil
+	case <-b.done:
+		return fmt.Errorf("invalidation bus %s closed", b.channel)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops the subscription, handlers are no longer called for invalidations of other instances.
+func (b *InvalidationBus) Close() error {
+	b.close.Do(b.cancel)
+	<-b.done
+	return nil
+}
+
+func (b *InvalidationBus) subscribe(ctx context.Context) {
+	defer close(b.done)
+	first := true
+	for {
+		messages, err := b.op.Subscribe(ctx, b.channel)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			kklogger.WarnJ("datastore:InvalidationBus.subscribe", fmt.Sprintf("subscribe %s: %s", b.channel, err.Error()))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(DefaultRedisInvalidationRetry):
+				continue
+			}
+		}
+
+		for message := range messages {
+			if message.Subscribed {
+				if first {
+					first = false
+					close(b.subscribed)
+				} else {
+					b.invalidate("")
+				}
+
+				continue
+			}
+
+			b.receive(message.Payload)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (b *InvalidationBus) receive(payload string) {
+	var message invalidationMessage
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		kklogger.WarnJ("datastore:InvalidationBus.receive", fmt.Sprintf("invalid message on %s: %s", b.channel, err.Error()))
+		return
+	}
+
+	// Publish already invalidated the keys of this instance
+	if message.Source == b.id {
+		return
+	}
+
+	for _, key := range message.Keys {
+		b.invalidate(key)
+	}
+}
+
+// invalidate calls the handlers matching key, every handler when key is empty.
+func (b *InvalidationBus) invalidate(key string) {
+	b.mutex.RLock()
+	handlers := make([]InvalidationHandler, 0, len(b.handlers))
+	for _, entry := range b.handlers {
+		if key == "" || strings.HasPrefix(key, entry.prefix) {
+			handlers = append(handlers, entry.handler)
+		}
+	}
+
+	b.mutex.RUnlock()
+	for _, handler := range handlers {
+		handler(key)
+	}
+}
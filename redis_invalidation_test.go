@@ -0,0 +1,145 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+type invalidationRecorder struct {
+	mutex sync.Mutex
+	keys  []string
+}
+
+func (r *invalidationRecorder) record(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.keys = append(r.keys, key)
+}
+
+func (r *invalidationRecorder) get() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.keys...)
+}
+
+func TestInvalidationBus(t *testing.T) {
+	waitBus := func(t *testing.T, bus *InvalidationBus) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.NoError(t, bus.Wait(ctx))
+	}
+
+	t.Run("Instances", func(t *testing.T) {
+		first := NewMockRedisOp()
+		first.EnableStatefulMode()
+		second := NewMockRedisOp()
+		second.shareStore(first)
+
+		local, remote := NewInvalidationBus(first, ""), NewInvalidationBus(second, "")
+		defer local.Close()
+		defer remote.Close()
+		waitBus(t, local)
+		waitBus(t, remote)
+		assert.Equal(t, DefaultRedisInvalidationChannel, local.Channel())
+
+		localKeys, remoteKeys, otherKeys := &invalidationRecorder{}, &invalidationRecorder{}, &invalidationRecorder{}
+		local.OnInvalidate("user:", localKeys.record)
+		remote.OnInvalidate("user:", remoteKeys.record)
+		unregister := remote.OnInvalidate("order:", otherKeys.record)
+
+		assert.NoError(t, local.Publish("user:1", "order:1"))
+		assert.Equal(t, []string{"user:1"}, localKeys.get())
+		assert.Eventually(t, func() bool { return len(remoteKeys.get()) == 1 && len(otherKeys.get()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, []string{"user:1"}, remoteKeys.get())
+
+		unregister()
+		assert.NoError(t, local.Publish("order:2", "user:2"))
+		assert.Eventually(t, func() bool { return len(remoteKeys.get()) == 2 }, time.Second, time.Millisecond)
+		assert.Equal(t, []string{"order:1"}, otherKeys.get())
+		// Own messages are not applied twice
+		assert.Equal(t, []string{"user:1", "user:2"}, localKeys.get())
+
+		remote.Close()
+		assert.NoError(t, local.Publish("user:3"))
+		time.Sleep(10 * time.Millisecond)
+		assert.Len(t, remoteKeys.get(), 2)
+	})
+
+	t.Run("Subscribe failure", func(t *testing.T) {
+		originalRetry := DefaultRedisInvalidationRetry
+		DefaultRedisInvalidationRetry = time.Millisecond
+		defer func() {
+			DefaultRedisInvalidationRetry = originalRetry
+		}()
+
+		op := NewMockRedisOp()
+		op.SetSequentialResponses("SUBSCRIBE", "test", []MockResponse{{Error: assert.AnError}, {Data: int64(1)}})
+		bus := NewInvalidationBus(op, "test")
+		defer bus.Close()
+		waitBus(t, bus)
+		assert.Equal(t, 2, op.GetCallCount("SUBSCRIBE"))
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		first := NewMockRedisOp()
+		first.EnableStatefulMode()
+		second := NewMockRedisOp()
+		second.shareStore(first)
+
+		local, remote := NewInvalidationBus(first, "cache"), NewInvalidationBus(second, "cache")
+		defer local.Close()
+		defer remote.Close()
+		waitBus(t, local)
+		waitBus(t, remote)
+
+		writer := NewCache[string](first, "name:")
+		writer.Bus = local
+		reader := NewCache[string](second, "name:")
+		reader.Bus = remote
+		keys := &invalidationRecorder{}
+		reader.OnInvalidate(keys.record)
+
+		assert.NoError(t, writer.Set("1", "alice", 0))
+		assert.NoError(t, writer.Delete("2"))
+		assert.Eventually(t, func() bool { return len(keys.get()) == 2 }, time.Second, time.Millisecond)
+		assert.Equal(t, []string{"1", "2"}, keys.get())
+
+		v, err := writer.GetOrLoad("3", 0, func() (string, error) { return "bob", nil })
+		assert.NoError(t, err)
+		assert.Equal(t, "bob", v)
+		assert.Equal(t, 2, first.GetCallCount("PUBLISH"))
+		assert.NotNil(t, NewCache[string](first, "").OnInvalidate(keys.record))
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		local, remote := redis.NewInvalidationBus("test_invalidation"), NewInvalidationBus(redis.Master(), "test_invalidation")
+		defer local.Close()
+		defer remote.Close()
+		waitBus(t, local)
+		waitBus(t, remote)
+
+		keys := &invalidationRecorder{}
+		remote.OnInvalidate("", keys.record)
+		assert.NoError(t, local.Publish("test_key"))
+		assert.Eventually(t, func() bool { return len(keys.get()) == 1 }, time.Second, time.Millisecond)
+		assert.Equal(t, []string{"test_key"}, keys.get())
+	})
+}
@@ -0,0 +1,29 @@
+package datastore
+
+import (
+	"math/rand"
+)
+
+// DefaultRedisTTLJitter adds a random part of up to this fraction of the TTL to the TTLs of the values set by new
+// Caches, so keys cached together do not expire together and hit the database at once. Expire, SetExpire and the
+// other commands keep their TTL exact, locks and sessions rely on it. 0 disables it, 0.1 turns a TTL of 600 seconds
+// into one between 600 and 660.
+var DefaultRedisTTLJitter = 0.0
+
+func init() {
+	envFloat("GOTH_DEFAULT_REDIS_TTL_JITTER", &DefaultRedisTTLJitter)
+}
+
+// jitterTTL returns ttl plus a random part of up to fraction of it, ttl as is when it does not expire.
+func jitterTTL(ttl int64, fraction float64) int64 {
+	if ttl <= 0 || fraction <= 0 {
+		return ttl
+	}
+
+	spread := int64(float64(ttl) * fraction)
+	if spread <= 0 {
+		return ttl
+	}
+
+	return ttl + rand.Int63n(spread+1)
+}
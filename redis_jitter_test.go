@@ -0,0 +1,58 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisTTLJitter(t *testing.T) {
+	t.Run("jitterTTL", func(t *testing.T) {
+		assert.Equal(t, int64(600), jitterTTL(600, 0))
+		assert.Equal(t, int64(0), jitterTTL(0, 0.5))
+		assert.Equal(t, int64(-1), jitterTTL(-1, 0.5))
+		assert.Equal(t, int64(5), jitterTTL(5, 0.1), "spread below one second")
+
+		seen := map[int64]bool{}
+		for i := 0; i < 200; i++ {
+			ttl := jitterTTL(600, 0.1)
+			assert.GreaterOrEqual(t, ttl, int64(600))
+			assert.LessOrEqual(t, ttl, int64(660))
+			seen[ttl] = true
+		}
+
+		assert.Greater(t, len(seen), 10)
+	})
+
+	t.Run("SetExpireJitter", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		assert.NoError(t, op.SetExpireJitter("key", "value", 600, 0.5).Error)
+		ttl := op.TTL("key").GetInt64()
+		assert.GreaterOrEqual(t, ttl, int64(600))
+		assert.LessOrEqual(t, ttl, int64(900))
+		assert.Equal(t, "value", op.Get("key").GetString())
+	})
+
+	t.Run("Default jitter", func(t *testing.T) {
+		original := DefaultRedisTTLJitter
+		defer func() {
+			DefaultRedisTTLJitter = original
+		}()
+
+		DefaultRedisTTLJitter = 0.5
+		op := NewStatefulMockRedis().Master()
+		assert.NoError(t, NewCache[int](op, "cache:").Set("typed", 1, 600))
+		ttl := op.TTL("cache:typed").GetInt64()
+		assert.GreaterOrEqual(t, ttl, int64(600))
+		assert.LessOrEqual(t, ttl, int64(900))
+
+		// Raw commands and SetAs keep the TTL exact, locks and sessions rely on it
+		assert.NoError(t, SetAs(op, "exact", 1, 600))
+		assert.NoError(t, op.Set("plain", "value").Error)
+		assert.NoError(t, op.Expire("plain", 600).Error)
+		assert.NoError(t, op.SetExpire("set", "value", 600).Error)
+		for _, key := range []string{"exact", "plain", "set"} {
+			assert.Equal(t, int64(600), op.TTL(key).GetInt64(), key)
+		}
+	})
+}
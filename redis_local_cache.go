@@ -0,0 +1,722 @@
+package datastore
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultRedisLocalCacheSize is the number of GET and HGET replies kept by a RedisLocalCache created with a size of 0.
+var DefaultRedisLocalCacheSize = 10000
+
+// DefaultRedisLocalCacheTTL is the maximum time a RedisLocalCache created with a TTL of 0 serves a reply from memory.
+var DefaultRedisLocalCacheTTL = time.Minute
+
+func init() {
+	envInt("GOTH_DEFAULT_REDIS_LOCAL_CACHE_SIZE", &DefaultRedisLocalCacheSize)
+	envMillis("GOTH_DEFAULT_REDIS_LOCAL_CACHE_TTL", &DefaultRedisLocalCacheTTL)
+}
+
+// RedisKeyEvents are the keyevent notifications evicting keys from a RedisLocalCache, the events changing or
+// removing string and hash values. FLUSHDB and FLUSHALL send no notification.
+var RedisKeyEvents = []string{
+	"set", "setrange", "append", "incrby", "incrbyfloat", "hset", "hdel", "hincrby", "hincrbyfloat",
+	"del", "expired", "evicted", "rename_from", "rename_to", "move_from", "move_to", "copy_to", "restore",
+}
+
+// RedisLocalCacheOptions configures NewRedisLocalCache.
+type RedisLocalCacheOptions struct {
+	// Size is the maximum number of cached replies, DefaultRedisLocalCacheSize when 0
+	Size int
+	// TTL is the maximum time a reply is served from memory, DefaultRedisLocalCacheTTL when 0
+	TTL time.Duration
+	// KeyspaceNotifications evicts the keys changed by any client from the RedisKeyEvents of database DB.
+	// The server must be configured to send them, e.g. with notify-keyspace-events "Eg$hx".
+	KeyspaceNotifications bool
+	DB                    int
+	// Bus evicts the keys invalidated by other instances, and receives the keys written through the cache
+	Bus *InvalidationBus
+}
+
+// RedisLocalCacheStats are the counters of a RedisLocalCache.
+type RedisLocalCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Size      int
+	Capacity  int
+}
+
+// HitRate returns the share of lookups served from memory, 0 without lookups.
+func (s RedisLocalCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// RedisLocalCache is a bounded in-process LRU tier in front of a RedisOperator, see NewRedisLocalCache.
+// Get and HGet are served from memory when cached and populate it on a miss, every other command goes to the
+// operator. The commands changing strings and hashes, including the write commands sent with Do, Pipeline, ExecCtx
+// and the scripts, evict the keys they change. Changes made by other clients, or through the operator itself, are
+// only seen through keyspace notifications, the Bus or once the TTL elapsed.
+type RedisLocalCache struct {
+	RedisOperator
+	ttl      time.Duration
+	capacity int
+	bus      *InvalidationBus
+
+	mutex   sync.Mutex
+	keys    map[string]*redisLocalCacheKey
+	order   *list.List
+	seq     uint64
+	hits    int64
+	misses  int64
+	evicted int64
+
+	unregister func()
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// redisLocalCacheKey holds the cached GET reply and HGET replies by field of a key.
+type redisLocalCacheKey struct {
+	value  *list.Element
+	fields map[string]*list.Element
+}
+
+type redisLocalCacheEntry struct {
+	key      string
+	field    string
+	hash     bool
+	data     interface{}
+	expireAt time.Time
+}
+
+// NewRedisLocalCache returns op with a local cache tier in front of it.
+// With KeyspaceNotifications, it subscribes in the background until Close.
+func NewRedisLocalCache(op RedisOperator, opts RedisLocalCacheOptions) *RedisLocalCache {
+	if opts.Size <= 0 {
+		opts.Size = DefaultRedisLocalCacheSize
+	}
+
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultRedisLocalCacheTTL
+	}
+
+	c := &RedisLocalCache{
+		RedisOperator: op,
+		ttl:           opts.TTL,
+		capacity:      opts.Size,
+		bus:           opts.Bus,
+		keys:          map[string]*redisLocalCacheKey{},
+		order:         list.New(),
+	}
+
+	if c.bus != nil {
+		c.unregister = c.bus.OnInvalidate("", func(key string) {
+			if key == "" {
+				c.Flush()
+				return
+			}
+
+			c.evict(key)
+		})
+	}
+
+	if opts.KeyspaceNotifications {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.cancel, c.done = cancel, make(chan struct{})
+		go c.subscribe(ctx, opts.DB)
+	}
+
+	return c
+}
+
+// Get returns the value of key from memory, or from the operator when it is not cached.
+func (c *RedisLocalCache) Get(key interface{}) *RedisResponse {
+	name := redisClientCacheKey(key)
+	if data, ok := c.get(name, "", false); ok {
+		return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: data}}
+	}
+
+	seq := c.sequence()
+	response := c.RedisOperator.Get(key)
+	if response.Error == nil {
+		c.set(name, "", false, response.data, seq)
+	}
+
+	return response
+}
+
+// HGet returns the value of field of the hash key from memory, or from the operator when it is not cached.
+func (c *RedisLocalCache) HGet(key, field interface{}) *RedisResponse {
+	name, fieldName := redisClientCacheKey(key), redisClientCacheKey(field)
+	if data, ok := c.get(name, fieldName, true); ok {
+		return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: data}}
+	}
+
+	seq := c.sequence()
+	response := c.RedisOperator.HGet(key, field)
+	if response.Error == nil {
+		c.set(name, fieldName, true, response.data, seq)
+	}
+
+	return response
+}
+
+// Set sets the value of key and evicts it.
+func (c *RedisLocalCache) Set(key interface{}, val interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Set(key, val), key)
+}
+
+// SetWithOptions sets the value of key with opts and evicts it.
+func (c *RedisLocalCache) SetWithOptions(key interface{}, val interface{}, opts SetOptions) *RedisResponse {
+	return c.written(c.RedisOperator.SetWithOptions(key, val, opts), key)
+}
+
+// SetExpire sets the value of key expiring after ttl seconds and evicts it.
+func (c *RedisLocalCache) SetExpire(key interface{}, val interface{}, ttl int64) *RedisResponse {
+	return c.written(c.RedisOperator.SetExpire(key, val, ttl), key)
+}
+
+// HSet sets field of the hash key and evicts the key.
+func (c *RedisLocalCache) HSet(key, field, val interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.HSet(key, field, val), key)
+}
+
+// HMSet sets fields of the hash key and evicts the key.
+func (c *RedisLocalCache) HMSet(key interface{}, val map[interface{}]interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.HMSet(key, val), key)
+}
+
+// HMSetOrdered sets fields of the hash key in order and evicts the key.
+func (c *RedisLocalCache) HMSetOrdered(key interface{}, pairs [][2]interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.HMSetOrdered(key, pairs), key)
+}
+
+// HDel removes fields of the hash key and evicts the key.
+func (c *RedisLocalCache) HDel(key interface{}, field ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.HDel(key, field...), key)
+}
+
+// SetExpireJitter sets the value of key expiring after about ttl seconds and evicts it.
+func (c *RedisLocalCache) SetExpireJitter(key interface{}, val interface{}, ttl int64, jitterFraction float64) *RedisResponse {
+	return c.written(c.RedisOperator.SetExpireJitter(key, val, ttl, jitterFraction), key)
+}
+
+// SetNX sets the value of key when it does not exist and evicts it.
+func (c *RedisLocalCache) SetNX(key interface{}, val interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.SetNX(key, val), key)
+}
+
+// MSetNX sets the values of keys when none exists and evicts them.
+func (c *RedisLocalCache) MSetNX(keyvals ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.MSetNX(keyvals...), redisCommandKeys("MSETNX", keyvals)...)
+}
+
+// Incr increments the value of key and evicts it.
+func (c *RedisLocalCache) Incr(key interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Incr(key), key)
+}
+
+// IncrBy increments the value of key by val and evicts it.
+func (c *RedisLocalCache) IncrBy(key interface{}, val int64) *RedisResponse {
+	return c.written(c.RedisOperator.IncrBy(key, val), key)
+}
+
+// Decr decrements the value of key and evicts it.
+func (c *RedisLocalCache) Decr(key interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Decr(key), key)
+}
+
+// DecrBy decrements the value of key by val and evicts it.
+func (c *RedisLocalCache) DecrBy(key interface{}, val int64) *RedisResponse {
+	return c.written(c.RedisOperator.DecrBy(key, val), key)
+}
+
+// Append appends val to the value of key and evicts it.
+func (c *RedisLocalCache) Append(key interface{}, val interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Append(key, val), key)
+}
+
+// SetRange overwrites the value of key from offset and evicts it.
+func (c *RedisLocalCache) SetRange(key interface{}, offset int64, val interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.SetRange(key, offset, val), key)
+}
+
+// HSetNX sets field of the hash key when it does not exist and evicts the key.
+func (c *RedisLocalCache) HSetNX(key, field, val interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.HSetNX(key, field, val), key)
+}
+
+// HIncrBy increments field of the hash key by val and evicts the key.
+func (c *RedisLocalCache) HIncrBy(key interface{}, field interface{}, val int64) *RedisResponse {
+	return c.written(c.RedisOperator.HIncrBy(key, field, val), key)
+}
+
+// Expire sets the TTL of key and evicts it, a cached value would outlive a shorter TTL.
+func (c *RedisLocalCache) Expire(key interface{}, ttl int64) *RedisResponse {
+	return c.written(c.RedisOperator.Expire(key, ttl), key)
+}
+
+// ExpireWithOptions sets the TTL of key with opts and evicts it.
+func (c *RedisLocalCache) ExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	return c.written(c.RedisOperator.ExpireWithOptions(key, ttl, opts), key)
+}
+
+// PExpire sets the TTL of key in milliseconds and evicts it.
+func (c *RedisLocalCache) PExpire(key interface{}, ttl int64) *RedisResponse {
+	return c.written(c.RedisOperator.PExpire(key, ttl), key)
+}
+
+// PExpireWithOptions sets the TTL of key in milliseconds with opts and evicts it.
+func (c *RedisLocalCache) PExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	return c.written(c.RedisOperator.PExpireWithOptions(key, ttl, opts), key)
+}
+
+// ExpireAt sets the expiration time of key and evicts it.
+func (c *RedisLocalCache) ExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return c.written(c.RedisOperator.ExpireAt(key, timestamp), key)
+}
+
+// ExpireAtWithOptions sets the expiration time of key with opts and evicts it.
+func (c *RedisLocalCache) ExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	return c.written(c.RedisOperator.ExpireAtWithOptions(key, timestamp, opts), key)
+}
+
+// PExpireAt sets the expiration time of key in milliseconds and evicts it.
+func (c *RedisLocalCache) PExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return c.written(c.RedisOperator.PExpireAt(key, timestamp), key)
+}
+
+// PExpireAtWithOptions sets the expiration time of key in milliseconds with opts and evicts it.
+func (c *RedisLocalCache) PExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	return c.written(c.RedisOperator.PExpireAtWithOptions(key, timestamp, opts), key)
+}
+
+// Delete removes keys and evicts them.
+func (c *RedisLocalCache) Delete(key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Delete(key...), key...)
+}
+
+// Unlink removes keys in the background and evicts them.
+func (c *RedisLocalCache) Unlink(key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Unlink(key...), key...)
+}
+
+// DeleteByPattern removes the keys matching pattern and flushes the cache, the deleted keys are not known.
+func (c *RedisLocalCache) DeleteByPattern(pattern string, batchSize int64) *RedisResponse {
+	response := c.RedisOperator.DeleteByPattern(pattern, batchSize)
+	c.flushed()
+	return response
+}
+
+// DeleteByPatternWithOptions removes the keys matching pattern with opts and flushes the cache.
+func (c *RedisLocalCache) DeleteByPatternWithOptions(pattern string, opts DeleteByPatternOptions) *RedisResponse {
+	response := c.RedisOperator.DeleteByPatternWithOptions(pattern, opts)
+	c.flushed()
+	return response
+}
+
+// Copy copies src to dst and evicts dst.
+func (c *RedisLocalCache) Copy(src, dst interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Copy(src, dst), dst)
+}
+
+// Restore creates key from a DUMP payload and evicts it.
+func (c *RedisLocalCache) Restore(key interface{}, ttl int64, payload []byte, replace bool) *RedisResponse {
+	return c.written(c.RedisOperator.Restore(key, ttl, payload, replace), key)
+}
+
+// Migrate moves keys to another server and evicts them.
+func (c *RedisLocalCache) Migrate(host string, port uint, key interface{}, db int, timeout int64, opts MigrateOptions) *RedisResponse {
+	return c.written(c.RedisOperator.Migrate(host, port, key, db, timeout, opts), append([]interface{}{key}, opts.Keys...)...)
+}
+
+// Rename renames oldKey to newKey and evicts both.
+func (c *RedisLocalCache) Rename(oldKey, newKey interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Rename(oldKey, newKey), oldKey, newKey)
+}
+
+// RenameNX renames oldKey to newKey when newKey does not exist and evicts both.
+func (c *RedisLocalCache) RenameNX(oldKey, newKey interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.RenameNX(oldKey, newKey), oldKey, newKey)
+}
+
+// SDiffStore stores a set difference in destination, replacing any value, and evicts it.
+func (c *RedisLocalCache) SDiffStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.SDiffStore(destination, key...), destination)
+}
+
+// SInterStore stores a set intersection in destination, replacing any value, and evicts it.
+func (c *RedisLocalCache) SInterStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.SInterStore(destination, key...), destination)
+}
+
+// SUnionStore stores a set union in destination, replacing any value, and evicts it.
+func (c *RedisLocalCache) SUnionStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.SUnionStore(destination, key...), destination)
+}
+
+// ZDiffStore stores a sorted set difference in destination, replacing any value, and evicts it.
+func (c *RedisLocalCache) ZDiffStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.ZDiffStore(destination, key...), destination)
+}
+
+// ZInterStore stores a sorted set intersection in destination, replacing any value, and evicts it.
+func (c *RedisLocalCache) ZInterStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.ZInterStore(destination, key...), destination)
+}
+
+// ZUnionStore stores a sorted set union in destination, replacing any value, and evicts it.
+func (c *RedisLocalCache) ZUnionStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.ZUnionStore(destination, key...), destination)
+}
+
+// ZRangeStore stores a range of src in dst, replacing any value, and evicts dst.
+func (c *RedisLocalCache) ZRangeStore(dst interface{}, src interface{}, min, max int64) *RedisResponse {
+	return c.written(c.RedisOperator.ZRangeStore(dst, src, min, max), dst)
+}
+
+// FlushDB removes every key of the database and flushes the cache.
+func (c *RedisLocalCache) FlushDB() *RedisResponse {
+	response := c.RedisOperator.FlushDB()
+	c.flushed()
+	return response
+}
+
+// FlushAll removes every key of every database and flushes the cache.
+func (c *RedisLocalCache) FlushAll() *RedisResponse {
+	response := c.RedisOperator.FlushAll()
+	c.flushed()
+	return response
+}
+
+// Eval runs script and evicts keys, scripts may write them.
+func (c *RedisLocalCache) Eval(script string, keys []interface{}, args []interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.Eval(script, keys, args), keys...)
+}
+
+// EvalSha runs the script sha and evicts keys, scripts may write them.
+func (c *RedisLocalCache) EvalSha(sha string, keys []interface{}, args []interface{}) *RedisResponse {
+	return c.written(c.RedisOperator.EvalSha(sha, keys, args), keys...)
+}
+
+// Do sends cmd and evicts the keys it changes when it is one of the write commands.
+func (c *RedisLocalCache) Do(cmd string, args ...interface{}) *RedisResponse {
+	response := c.RedisOperator.Do(cmd, args...)
+	c.writtenCmds(RedisPipelineCmd{Cmd: cmd, Args: args})
+	return response
+}
+
+// DoWithTimeout is Do bounded by timeout.
+func (c *RedisLocalCache) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) *RedisResponse {
+	response := c.RedisOperator.DoWithTimeout(timeout, cmd, args...)
+	c.writtenCmds(RedisPipelineCmd{Cmd: cmd, Args: args})
+	return response
+}
+
+// Pipeline sends cmds and evicts the keys changed by its write commands.
+func (c *RedisLocalCache) Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse {
+	responses := c.RedisOperator.Pipeline(cmds...)
+	c.writtenCmds(cmds...)
+	return responses
+}
+
+// PipelineWithOptions sends cmds with opts and evicts the keys changed by its write commands.
+func (c *RedisLocalCache) PipelineWithOptions(opts RedisPipelineOptions, cmds ...RedisPipelineCmd) []*RedisResponse {
+	responses := c.RedisOperator.PipelineWithOptions(opts, cmds...)
+	c.writtenCmds(cmds...)
+	return responses
+}
+
+// PipelineCtx sends cmds bounded by ctx and evicts the keys changed by its write commands.
+func (c *RedisLocalCache) PipelineCtx(ctx context.Context, cmds ...RedisPipelineCmd) []*RedisResponse {
+	responses := c.RedisOperator.PipelineCtx(ctx, cmds...)
+	c.writtenCmds(cmds...)
+	return responses
+}
+
+// ExecCtx runs the transaction queued by f and evicts the keys changed by its write commands.
+func (c *RedisLocalCache) ExecCtx(ctx context.Context, f func(tx *RedisTx) error) ([]*RedisResponse, error) {
+	var cmds []RedisPipelineCmd
+	responses, err := c.RedisOperator.ExecCtx(ctx, func(tx *RedisTx) error {
+		if err := f(tx); err != nil {
+			return err
+		}
+
+		cmds = tx.cmds
+		return nil
+	})
+
+	c.writtenCmds(cmds...)
+	return responses, err
+}
+
+// Invalidate evicts keys from memory, and from the other instances when the cache has a Bus. An empty key flushes
+// the caches.
+func (c *RedisLocalCache) Invalidate(keys ...string) error {
+	if c.bus != nil {
+		return c.bus.Publish(keys...)
+	}
+
+	for _, key := range keys {
+		if key == "" {
+			c.Flush()
+			continue
+		}
+
+		c.evict(key)
+	}
+
+	return nil
+}
+
+// Flush evicts every key from memory.
+func (c *RedisLocalCache) Flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.seq++
+	c.keys = map[string]*redisLocalCacheKey{}
+	c.order.Init()
+}
+
+// Stats returns the cache counters.
+func (c *RedisLocalCache) Stats() RedisLocalCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return RedisLocalCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evicted,
+		Size:      c.order.Len(),
+		Capacity:  c.capacity,
+	}
+}
+
+// Close stops the invalidation of the cache, then closes the operator.
+func (c *RedisLocalCache) Close() error {
+	if c.unregister != nil {
+		c.unregister()
+	}
+
+	if c.cancel != nil {
+		c.cancel()
+		<-c.done
+	}
+
+	return c.RedisOperator.Close()
+}
+
+// written evicts keys once the command changing them succeeded.
+func (c *RedisLocalCache) written(response *RedisResponse, keys ...interface{}) *RedisResponse {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		// an empty key would flush the caches, MIGRATE sends one with KEYS
+		if name := redisClientCacheKey(key); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	if err := c.Invalidate(names...); err != nil {
+		kklogger.WarnJ("datastore:RedisLocalCache.Invalidate", err.Error())
+	}
+
+	return response
+}
+
+// writtenCmds evicts the keys changed by the write commands of cmds, every key when one flushes the database.
+func (c *RedisLocalCache) writtenCmds(cmds ...RedisPipelineCmd) {
+	var keys []interface{}
+	for _, cmd := range cmds {
+		name := strings.ToUpper(cmd.Cmd)
+		switch {
+		case !redisWriteCommands[name]:
+		case name == "FLUSHDB" || name == "FLUSHALL" || name == "SWAPDB":
+			c.flushed()
+			return
+		case name == "MIGRATE" || name == "SORT":
+			// the key, the keys following KEYS or the destination following STORE
+			keys = append(keys, redisCommandKeys(name, cmd.Args)...)
+			for i, arg := range cmd.Args {
+				switch strings.ToUpper(redisClientCacheKey(arg)) {
+				case "KEYS":
+					keys = append(keys, cmd.Args[i+1:]...)
+				case "STORE":
+					if i+1 < len(cmd.Args) {
+						keys = append(keys, cmd.Args[i+1])
+					}
+				}
+			}
+
+			if name == "MIGRATE" && len(cmd.Args) > 2 {
+				keys = append(keys, cmd.Args[2])
+			}
+		default:
+			keys = append(keys, redisCommandKeys(name, cmd.Args)...)
+		}
+	}
+
+	if len(keys) > 0 {
+		c.written(nil, keys...)
+	}
+}
+
+// flushed evicts every key, from the other instances too when the cache has a Bus.
+func (c *RedisLocalCache) flushed() {
+	if err := c.Invalidate(""); err != nil {
+		kklogger.WarnJ("datastore:RedisLocalCache.Invalidate", err.Error())
+	}
+}
+
+func (c *RedisLocalCache) subscribe(ctx context.Context, db int) {
+	defer close(c.done)
+	channels := make([]string, len(RedisKeyEvents))
+	for i, event := range RedisKeyEvents {
+		channels[i] = fmt.Sprintf("__keyevent@%d__:%s", db, event)
+	}
+
+	for {
+		messages, err := c.RedisOperator.Subscribe(ctx, channels...)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			kklogger.WarnJ("datastore:RedisLocalCache.subscribe", err.Error())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(DefaultRedisInvalidationRetry):
+				continue
+			}
+		}
+
+		for message := range messages {
+			// Notifications may have been missed before the subscription
+			if message.Subscribed {
+				c.Flush()
+				continue
+			}
+
+			c.evict(message.Payload)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (c *RedisLocalCache) sequence() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.seq
+}
+
+func (c *RedisLocalCache) get(key, field string, hash bool) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element := c.element(key, field, hash); element != nil {
+		entry := element.Value.(*redisLocalCacheEntry)
+		if time.Now().Before(entry.expireAt) {
+			c.order.MoveToFront(element)
+			c.hits++
+			return entry.data, true
+		}
+
+		c.remove(element)
+	}
+
+	c.misses++
+	return nil, false
+}
+
+// set stores a reply read when the sequence was seq, unless keys were evicted since.
+func (c *RedisLocalCache) set(key, field string, hash bool, data interface{}, seq uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if seq != c.seq {
+		return
+	}
+
+	if element := c.element(key, field, hash); element != nil {
+		c.remove(element)
+	}
+
+	entry := &redisLocalCacheEntry{key: key, field: field, hash: hash, data: data, expireAt: time.Now().Add(c.ttl)}
+	element := c.order.PushFront(entry)
+	cached := c.keys[key]
+	if cached == nil {
+		cached = &redisLocalCacheKey{}
+		c.keys[key] = cached
+	}
+
+	if hash {
+		if cached.fields == nil {
+			cached.fields = map[string]*list.Element{}
+		}
+
+		cached.fields[field] = element
+	} else {
+		cached.value = element
+	}
+
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evicted++
+	}
+}
+
+func (c *RedisLocalCache) evict(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.seq++
+	cached := c.keys[key]
+	if cached == nil {
+		return
+	}
+
+	if cached.value != nil {
+		c.order.Remove(cached.value)
+	}
+
+	for _, element := range cached.fields {
+		c.order.Remove(element)
+	}
+
+	delete(c.keys, key)
+}
+
+func (c *RedisLocalCache) element(key, field string, hash bool) *list.Element {
+	cached := c.keys[key]
+	switch {
+	case cached == nil:
+		return nil
+	case hash:
+		return cached.fields[field]
+	default:
+		return cached.value
+	}
+}
+
+func (c *RedisLocalCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*redisLocalCacheEntry)
+	cached := c.keys[entry.key]
+	if entry.hash {
+		delete(cached.fields, entry.field)
+	} else {
+		cached.value = nil
+	}
+
+	if cached.value == nil && len(cached.fields) == 0 {
+		delete(c.keys, entry.key)
+	}
+}
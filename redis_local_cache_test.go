@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisLocalCache(t *testing.T) {
+	t.Run("Get and HGet", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		cache := NewRedisLocalCache(op, RedisLocalCacheOptions{})
+		defer cache.Close()
+
+		op.Set("user:1", "alice")
+		op.HSet("profile:1", "name", "alice")
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "alice", cache.Get("user:1").GetString())
+			assert.Equal(t, "alice", cache.HGet("profile:1", "name").GetString())
+		}
+
+		assert.Equal(t, 1, op.GetCallCount("GET"))
+		assert.Equal(t, 1, op.GetCallCount("HGET"))
+		assert.ErrorIs(t, cache.Get("user:2").Error, RedisNotFound)
+		assert.ErrorIs(t, cache.Get("user:2").Error, RedisNotFound)
+		assert.Equal(t, 3, op.GetCallCount("GET"))
+
+		stats := cache.Stats()
+		assert.Equal(t, RedisLocalCacheStats{Hits: 4, Misses: 4, Size: 2, Capacity: DefaultRedisLocalCacheSize}, stats)
+		assert.Equal(t, 0.5, stats.HitRate())
+	})
+
+	t.Run("Writes evict", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		cache := NewRedisLocalCache(op, RedisLocalCacheOptions{})
+		defer cache.Close()
+
+		cache.Set("user:1", "alice")
+		cache.HSet("profile:1", "name", "alice")
+		cache.Get("user:1")
+		cache.HGet("profile:1", "name")
+
+		cache.Set("user:1", "bob")
+		assert.Equal(t, "bob", cache.Get("user:1").GetString())
+		cache.HSet("profile:1", "name", "bob")
+		assert.Equal(t, "bob", cache.HGet("profile:1", "name").GetString())
+		cache.Delete("user:1", "profile:1")
+		assert.ErrorIs(t, cache.Get("user:1").Error, RedisNotFound)
+		assert.ErrorIs(t, cache.HGet("profile:1", "name").Error, RedisNotFound)
+
+		op.Set("user:1", "carol")
+		cache.Get("user:1")
+		op.Set("user:1", "dave")
+		assert.Equal(t, "carol", cache.Get("user:1").GetString())
+		assert.NoError(t, cache.Invalidate("user:1"))
+		assert.Equal(t, "dave", cache.Get("user:1").GetString())
+
+		// Every write evicts, typed or sent with Do, Pipeline and ExecCtx
+		cache.Set("counter", 1)
+		cache.Get("counter")
+		cache.Incr("counter")
+		assert.Equal(t, "2", cache.Get("counter").GetString())
+		cache.Do("INCRBY", "counter", 3)
+		assert.Equal(t, "5", cache.Get("counter").GetString())
+		cache.Pipeline(RedisPipelineCmd{Cmd: "SET", Args: []interface{}{"counter", 6}})
+		assert.Equal(t, "6", cache.Get("counter").GetString())
+		_, err := cache.ExecCtx(context.Background(), func(tx *RedisTx) error {
+			tx.Do("SET", "counter", 7)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "7", cache.Get("counter").GetString())
+		cache.Rename("counter", "renamed")
+		assert.ErrorIs(t, cache.Get("counter").Error, RedisNotFound)
+		assert.Equal(t, "7", cache.Get("renamed").GetString())
+		cache.Unlink("renamed")
+		assert.ErrorIs(t, cache.Get("renamed").Error, RedisNotFound)
+
+		cache.Set("user:2", "erin")
+		cache.Get("user:2")
+		cache.DeleteByPattern("user:*", 10)
+		assert.ErrorIs(t, cache.Get("user:2").Error, RedisNotFound)
+	})
+
+	t.Run("LRU and TTL", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		cache := NewRedisLocalCache(op, RedisLocalCacheOptions{Size: 2, TTL: 50 * time.Millisecond})
+		defer cache.Close()
+
+		op.Set("a", "1")
+		op.Set("b", "2")
+		op.Set("c", "3")
+		cache.Get("a")
+		cache.Get("b")
+		cache.Get("a")
+		cache.Get("c")
+		assert.Equal(t, RedisLocalCacheStats{Hits: 1, Misses: 3, Evictions: 1, Size: 2, Capacity: 2}, cache.Stats())
+
+		cache.Get("a")
+		cache.Get("b")
+		assert.Equal(t, 4, op.GetCallCount("GET"))
+
+		time.Sleep(60 * time.Millisecond)
+		cache.Get("a")
+		assert.Equal(t, 5, op.GetCallCount("GET"))
+	})
+
+	t.Run("Keyspace notifications", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		cache := NewRedisLocalCache(op, RedisLocalCacheOptions{KeyspaceNotifications: true, DB: 2})
+		defer cache.Close()
+
+		assert.Eventually(t, func() bool { return op.GetCallCount("SUBSCRIBE") == 1 }, time.Second, time.Millisecond)
+		assert.Contains(t, op.GetCallsByCommand("SUBSCRIBE")[0].Args, "__keyevent@2__:hset")
+
+		op.Set("user:1", "alice")
+		assert.Eventually(t, func() bool {
+			cache.Get("user:1")
+			return cache.Stats().Hits > 0
+		}, time.Second, time.Millisecond)
+
+		op.Set("user:1", "bob")
+		op.Publish("__keyevent@2__:set", "user:1")
+		assert.Eventually(t, func() bool { return cache.Get("user:1").GetString() == "bob" }, time.Second, time.Millisecond)
+	})
+
+	t.Run("Bus", func(t *testing.T) {
+		first := NewMockRedisOp()
+		first.EnableStatefulMode()
+		second := NewMockRedisOp()
+		second.shareStore(first)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		localBus, remoteBus := NewInvalidationBus(first, "local_cache"), NewInvalidationBus(second, "local_cache")
+		defer localBus.Close()
+		defer remoteBus.Close()
+		assert.NoError(t, localBus.Wait(ctx))
+		assert.NoError(t, remoteBus.Wait(ctx))
+
+		local := NewRedisLocalCache(first, RedisLocalCacheOptions{Bus: localBus})
+		remote := NewRedisLocalCache(second, RedisLocalCacheOptions{Bus: remoteBus})
+		local.Set("user:1", "alice")
+		assert.Equal(t, "alice", remote.Get("user:1").GetString())
+
+		local.Set("user:1", "bob")
+		assert.Eventually(t, func() bool { return remote.Get("user:1").GetString() == "bob" }, time.Second, time.Millisecond)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+
+		cache := NewRedisLocalCache(redis.Master(), RedisLocalCacheOptions{})
+		defer cache.Close()
+		defer cache.Delete("test_local_cache")
+		assert.NoError(t, cache.Set("test_local_cache", "value").Error)
+		assert.Equal(t, "value", cache.Get("test_local_cache").GetString())
+		assert.Equal(t, "value", cache.Get("test_local_cache").GetString())
+		assert.Equal(t, int64(1), cache.Stats().Hits)
+	})
+}
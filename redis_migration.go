@@ -0,0 +1,961 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultRedisMigrationQueueSize is the number of asynchronous secondary writes a MigrationRedisOp created with a
+// QueueSize of 0 keeps waiting, further writes are dropped.
+var DefaultRedisMigrationQueueSize = 10000
+
+func init() {
+	envInt("GOTH_DEFAULT_REDIS_MIGRATION_QUEUE_SIZE", &DefaultRedisMigrationQueueSize)
+}
+
+// MigrationRedisOptions configures NewMigrationRedisOp.
+type MigrationRedisOptions struct {
+	// Async writes to the secondary in the background, in the order of the primary writes, instead of before
+	// returning
+	Async bool
+	// QueueSize bounds the asynchronous writes waiting, DefaultRedisMigrationQueueSize when 0
+	QueueSize int
+	// ReadFallback reads the keys missing from the primary from the secondary, see MigrationRedisOp
+	ReadFallback bool
+	// OnDivergence is called for each secondary write replying differently from the primary, logged when nil
+	OnDivergence func(divergence MigrationRedisDivergence)
+}
+
+// MigrationRedisDivergence is a write whose reply on the secondary differs from the one on the primary, e.g. an
+// INCR of a key not migrated yet. Replies are in their string form, "(nil)" for a nil reply and "(error) " and
+// the message for errors.
+type MigrationRedisDivergence struct {
+	Cmd       string
+	Key       string
+	Primary   string
+	Secondary string
+}
+
+// MigrationRedisStats are the counters of a MigrationRedisOp.
+type MigrationRedisStats struct {
+	// SecondaryWrites is the number of writes sent to the secondary
+	SecondaryWrites int64
+	// SecondaryErrors is the number of secondary writes failing, also counted as divergences
+	SecondaryErrors int64
+	// Divergences is the number of secondary writes replying differently from the primary
+	Divergences int64
+	// Dropped is the number of asynchronous writes dropped, the queue being full or the operator closed
+	Dropped int64
+	// FallbackReads is the number of reads served by the secondary
+	FallbackReads int64
+}
+
+// MigrationRedisOp is a RedisOperator for the live migration of keys between two instances, e.g. to a new cluster.
+// Every command is sent to the primary, whose reply is returned, and the writes succeeding on the primary are
+// replayed on the secondary, before returning or in the background with Async. The replies of the secondary are
+// compared with the ones of the primary, see Stats.
+//
+// With ReadFallback, Get, HGet, HGetAll, LRange, SMembers and ZRange read a key missing from the primary from the
+// secondary, so the new instance can become the primary before every key was copied to it. Writes of the
+// transactions of ExecCtx and the pipelines are replayed as a transaction or pipeline of their write commands,
+// Do and DoWithTimeout replay the commands of the write commands of RedisCommandGuard. Publish and Subscribe only
+// use the primary.
+type MigrationRedisOp struct {
+	RedisOperator
+	secondary    RedisOperator
+	fallback     bool
+	onDivergence func(divergence MigrationRedisDivergence)
+
+	mutex  sync.RWMutex
+	closed bool
+	queue  chan func()
+	done   chan struct{}
+	once   sync.Once
+
+	writes        atomic.Int64
+	errors        atomic.Int64
+	divergences   atomic.Int64
+	dropped       atomic.Int64
+	fallbackReads atomic.Int64
+}
+
+// NewMigrationRedisOp returns an operator sending the commands to primary and replaying the writes on secondary.
+// With Async, secondary writes are sent by a goroutine running until Close.
+func NewMigrationRedisOp(primary, secondary RedisOperator, opts MigrationRedisOptions) *MigrationRedisOp {
+	m := &MigrationRedisOp{
+		RedisOperator: primary,
+		secondary:     secondary,
+		fallback:      opts.ReadFallback,
+		onDivergence:  opts.OnDivergence,
+	}
+
+	if m.onDivergence == nil {
+		m.onDivergence = func(d MigrationRedisDivergence) {
+			kklogger.WarnJ("datastore:MigrationRedisOp.divergence",
+				fmt.Sprintf("%s %s: primary %s, secondary %s", d.Cmd, d.Key, d.Primary, d.Secondary))
+		}
+	}
+
+	if opts.Async {
+		size := opts.QueueSize
+		if size <= 0 {
+			size = DefaultRedisMigrationQueueSize
+		}
+
+		m.queue, m.done = make(chan func(), max(size, 1)), make(chan struct{})
+		go m.run()
+	}
+
+	return m
+}
+
+// NewMigrationRedis returns a Redis named name whose master and slave are the MigrationRedisOp of the master and
+// slave of primary and secondary.
+func NewMigrationRedis(name string, primary, secondary *Redis, opts MigrationRedisOptions) *Redis {
+	return &Redis{
+		name:   name,
+		master: NewMigrationRedisOp(primary.Master(), secondary.Master(), opts),
+		slave:  NewMigrationRedisOp(primary.Slave(), secondary.Slave(), opts),
+	}
+}
+
+// Primary returns the operator whose replies are returned.
+func (m *MigrationRedisOp) Primary() RedisOperator {
+	return m.RedisOperator
+}
+
+// Secondary returns the operator the writes are replayed on.
+func (m *MigrationRedisOp) Secondary() RedisOperator {
+	return m.secondary
+}
+
+// Stats returns the counters of the operator.
+func (m *MigrationRedisOp) Stats() MigrationRedisStats {
+	return MigrationRedisStats{
+		SecondaryWrites: m.writes.Load(),
+		SecondaryErrors: m.errors.Load(),
+		Divergences:     m.divergences.Load(),
+		Dropped:         m.dropped.Load(),
+		FallbackReads:   m.fallbackReads.Load(),
+	}
+}
+
+// Flush waits until the asynchronous secondary writes queued so far are sent.
+func (m *MigrationRedisOp) Flush() {
+	if m.queue == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	m.mutex.RLock()
+	if m.closed {
+		m.mutex.RUnlock()
+		return
+	}
+
+	m.queue <- func() {
+		close(done)
+	}
+
+	m.mutex.RUnlock()
+	<-done
+}
+
+// Close sends the asynchronous secondary writes queued, then closes the primary and the secondary.
+func (m *MigrationRedisOp) Close() error {
+	m.once.Do(func() {
+		m.mutex.Lock()
+		m.closed = true
+		if m.queue != nil {
+			close(m.queue)
+		}
+
+		m.mutex.Unlock()
+		if m.done != nil {
+			<-m.done
+		}
+	})
+
+	return errors.Join(m.RedisOperator.Close(), m.secondary.Close())
+}
+
+func (m *MigrationRedisOp) run() {
+	defer close(m.done)
+	for job := range m.queue {
+		job()
+	}
+}
+
+// SetCodec sets the Codec of the primary and the secondary.
+func (m *MigrationRedisOp) SetCodec(codec Codec) {
+	m.RedisOperator.SetCodec(codec)
+	m.secondary.SetCodec(codec)
+}
+
+// SetEncryption sets the RedisEncryption of the primary and the secondary.
+func (m *MigrationRedisOp) SetEncryption(encryption *RedisEncryption) {
+	m.RedisOperator.SetEncryption(encryption)
+	m.secondary.SetEncryption(encryption)
+}
+
+// SetCommandGuard sets the RedisCommandGuard of the primary and the secondary.
+func (m *MigrationRedisOp) SetCommandGuard(guard *RedisCommandGuard) {
+	m.RedisOperator.SetCommandGuard(guard)
+	m.secondary.SetCommandGuard(guard)
+}
+
+// redisMigrationReply returns the string form of the reply of response compared between the instances.
+func redisMigrationReply(response *RedisResponse) string {
+	switch {
+	case response == nil:
+		return ""
+	case errors.Is(response.Error, RedisNotFound):
+		return "(nil)"
+	case response.Error != nil:
+		return "(error) " + response.Error.Error()
+	default:
+		return fmt.Sprint(response.data)
+	}
+}
+
+// redisMigrationReplayed reports whether the write of response is replayed on the secondary: the primary either
+// succeeded or replied nil, like SET NX on an existing key.
+func redisMigrationReplayed(response *RedisResponse) bool {
+	return response != nil && (response.Error == nil || errors.Is(response.Error, RedisNotFound))
+}
+
+// mirror sends write to the primary, and to the secondary when it is replayed.
+func (m *MigrationRedisOp) mirror(cmd string, key interface{}, write func(op RedisOperator) *RedisResponse) *RedisResponse {
+	response := write(m.RedisOperator)
+	if redisMigrationReplayed(response) {
+		primary := redisMigrationReply(response)
+		m.replay(func() {
+			m.compare(cmd, key, primary, write(m.secondary))
+		})
+	}
+
+	return response
+}
+
+// mirrorPipeline replays the write commands of cmds replayed on the primary as one pipeline, a transaction with
+// opts.Transaction.
+func (m *MigrationRedisOp) mirrorPipeline(opts RedisPipelineOptions, cmds []RedisPipelineCmd, responses []*RedisResponse) {
+	var writes []RedisPipelineCmd
+	var replies []string
+	for i, c := range cmds {
+		if i < len(responses) && redisWriteCommands[strings.ToUpper(c.Cmd)] && redisMigrationReplayed(responses[i]) {
+			writes = append(writes, c)
+			replies = append(replies, redisMigrationReply(responses[i]))
+		}
+	}
+
+	if len(writes) == 0 {
+		return
+	}
+
+	m.replay(func() {
+		secondary := m.secondary.PipelineWithOptions(opts, writes...)
+		for i, c := range writes {
+			var response *RedisResponse
+			if i < len(secondary) {
+				response = secondary[i]
+			}
+
+			var key interface{}
+			if len(c.Args) > 0 {
+				key = c.Args[0]
+			}
+
+			m.compare(c.Cmd, key, replies[i], response)
+		}
+	})
+}
+
+// replay runs the secondary write job now, or queues it with Async, and drops it once closed.
+func (m *MigrationRedisOp) replay(job func()) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.closed {
+		m.dropped.Add(1)
+		return
+	}
+
+	if m.queue == nil {
+		job()
+		return
+	}
+
+	select {
+	case m.queue <- job:
+	default:
+		m.dropped.Add(1)
+	}
+}
+
+// compare counts the secondary write of cmd and reports its divergence from the primary reply.
+func (m *MigrationRedisOp) compare(cmd string, key interface{}, primary string, response *RedisResponse) {
+	m.writes.Add(1)
+	if response == nil || response.Error != nil && !errors.Is(response.Error, RedisNotFound) {
+		m.errors.Add(1)
+	}
+
+	if secondary := redisMigrationReply(response); secondary != primary {
+		m.divergences.Add(1)
+		divergence := MigrationRedisDivergence{Cmd: strings.ToUpper(cmd), Primary: primary, Secondary: secondary}
+		if key != nil {
+			divergence.Key = redisClientCacheKey(key)
+		}
+
+		m.onDivergence(divergence)
+	}
+}
+
+// read sends read to the primary, and to the secondary with ReadFallback when the key is missing from the primary.
+func (m *MigrationRedisOp) read(read func(op RedisOperator) *RedisResponse) *RedisResponse {
+	response := read(m.RedisOperator)
+	if !m.fallback || !redisMigrationMissing(response) {
+		return response
+	}
+
+	secondary := read(m.secondary)
+	if redisMigrationMissing(secondary) {
+		return response
+	}
+
+	m.fallbackReads.Add(1)
+	return secondary
+}
+
+// redisMigrationMissing reports whether response is the reply of a missing key: a nil reply, or an empty array or
+// map, Redis removing the collections left empty.
+func redisMigrationMissing(response *RedisResponse) bool {
+	if errors.Is(response.Error, RedisNotFound) {
+		return true
+	}
+
+	if response.Error != nil {
+		return false
+	}
+
+	switch data := response.data.(type) {
+	case []interface{}:
+		return len(data) == 0
+	case map[interface{}]interface{}:
+		return len(data) == 0
+	case map[string]string:
+		return len(data) == 0
+	default:
+		return false
+	}
+}
+
+// Pipeline operations
+
+func (m *MigrationRedisOp) Do(cmd string, args ...interface{}) *RedisResponse {
+	if !redisWriteCommands[strings.ToUpper(cmd)] {
+		return m.RedisOperator.Do(cmd, args...)
+	}
+
+	return m.mirror(cmd, redisMigrationKey(args), func(op RedisOperator) *RedisResponse {
+		return op.Do(cmd, args...)
+	})
+}
+
+func (m *MigrationRedisOp) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) *RedisResponse {
+	if !redisWriteCommands[strings.ToUpper(cmd)] {
+		return m.RedisOperator.DoWithTimeout(timeout, cmd, args...)
+	}
+
+	return m.mirror(cmd, redisMigrationKey(args), func(op RedisOperator) *RedisResponse {
+		return op.DoWithTimeout(timeout, cmd, args...)
+	})
+}
+
+func redisMigrationKey(args []interface{}) interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+
+	return args[0]
+}
+
+func (m *MigrationRedisOp) Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse {
+	return m.PipelineWithOptions(RedisPipelineOptions{}, cmds...)
+}
+
+func (m *MigrationRedisOp) PipelineWithOptions(opts RedisPipelineOptions, cmds ...RedisPipelineCmd) []*RedisResponse {
+	responses := m.RedisOperator.PipelineWithOptions(opts, cmds...)
+	m.mirrorPipeline(opts, cmds, responses)
+	return responses
+}
+
+func (m *MigrationRedisOp) PipelineCtx(ctx context.Context, cmds ...RedisPipelineCmd) []*RedisResponse {
+	responses := m.RedisOperator.PipelineCtx(ctx, cmds...)
+	m.mirrorPipeline(RedisPipelineOptions{}, cmds, responses)
+	return responses
+}
+
+func (m *MigrationRedisOp) ExecCtx(ctx context.Context, f func(tx *RedisTx) error) ([]*RedisResponse, error) {
+	tx := &RedisTx{}
+	if err := f(tx); err != nil {
+		return nil, err
+	}
+
+	responses, err := m.RedisOperator.ExecCtx(ctx, func(primary *RedisTx) error {
+		primary.cmds = tx.cmds
+		return nil
+	})
+
+	if err == nil {
+		m.mirrorPipeline(RedisPipelineOptions{Transaction: true}, tx.cmds, responses)
+	}
+
+	return responses, err
+}
+
+// Reads falling back to the secondary
+
+func (m *MigrationRedisOp) Get(key interface{}) *RedisResponse {
+	return m.read(func(op RedisOperator) *RedisResponse {
+		return op.Get(key)
+	})
+}
+
+func (m *MigrationRedisOp) HGet(key, field interface{}) *RedisResponse {
+	return m.read(func(op RedisOperator) *RedisResponse {
+		return op.HGet(key, field)
+	})
+}
+
+func (m *MigrationRedisOp) HGetAll(key interface{}) *RedisResponse {
+	return m.read(func(op RedisOperator) *RedisResponse {
+		return op.HGetAll(key)
+	})
+}
+
+func (m *MigrationRedisOp) LRange(key interface{}, start, stop int64) *RedisResponse {
+	return m.read(func(op RedisOperator) *RedisResponse {
+		return op.LRange(key, start, stop)
+	})
+}
+
+func (m *MigrationRedisOp) SMembers(key interface{}) *RedisResponse {
+	return m.read(func(op RedisOperator) *RedisResponse {
+		return op.SMembers(key)
+	})
+}
+
+func (m *MigrationRedisOp) ZRange(key interface{}, start, stop int64) *RedisResponse {
+	return m.read(func(op RedisOperator) *RedisResponse {
+		return op.ZRange(key, start, stop)
+	})
+}
+
+// String writes
+
+func (m *MigrationRedisOp) Set(key interface{}, val interface{}) *RedisResponse {
+	return m.mirror("SET", key, func(op RedisOperator) *RedisResponse {
+		return op.Set(key, val)
+	})
+}
+
+func (m *MigrationRedisOp) SetWithOptions(key interface{}, val interface{}, opts SetOptions) *RedisResponse {
+	return m.mirror("SET", key, func(op RedisOperator) *RedisResponse {
+		return op.SetWithOptions(key, val, opts)
+	})
+}
+
+func (m *MigrationRedisOp) SetExpire(key interface{}, val interface{}, ttl int64) *RedisResponse {
+	return m.mirror("SETEX", key, func(op RedisOperator) *RedisResponse {
+		return op.SetExpire(key, val, ttl)
+	})
+}
+
+// SetExpireJitter draws the jitter once, the key expires at the same time on both instances.
+func (m *MigrationRedisOp) SetExpireJitter(key interface{}, val interface{}, ttl int64, jitterFraction float64) *RedisResponse {
+	return m.SetExpire(key, val, jitterTTL(ttl, jitterFraction))
+}
+
+func (m *MigrationRedisOp) SetNX(key interface{}, val interface{}) *RedisResponse {
+	return m.mirror("SETNX", key, func(op RedisOperator) *RedisResponse {
+		return op.SetNX(key, val)
+	})
+}
+
+func (m *MigrationRedisOp) MSetNX(keyvals ...interface{}) *RedisResponse {
+	return m.mirror("MSETNX", redisMigrationKey(keyvals), func(op RedisOperator) *RedisResponse {
+		return op.MSetNX(keyvals...)
+	})
+}
+
+func (m *MigrationRedisOp) Incr(key interface{}) *RedisResponse {
+	return m.mirror("INCR", key, func(op RedisOperator) *RedisResponse {
+		return op.Incr(key)
+	})
+}
+
+func (m *MigrationRedisOp) IncrBy(key interface{}, val int64) *RedisResponse {
+	return m.mirror("INCRBY", key, func(op RedisOperator) *RedisResponse {
+		return op.IncrBy(key, val)
+	})
+}
+
+func (m *MigrationRedisOp) Decr(key interface{}) *RedisResponse {
+	return m.mirror("DECR", key, func(op RedisOperator) *RedisResponse {
+		return op.Decr(key)
+	})
+}
+
+func (m *MigrationRedisOp) DecrBy(key interface{}, val int64) *RedisResponse {
+	return m.mirror("DECRBY", key, func(op RedisOperator) *RedisResponse {
+		return op.DecrBy(key, val)
+	})
+}
+
+func (m *MigrationRedisOp) Append(key interface{}, val interface{}) *RedisResponse {
+	return m.mirror("APPEND", key, func(op RedisOperator) *RedisResponse {
+		return op.Append(key, val)
+	})
+}
+
+func (m *MigrationRedisOp) SetRange(key interface{}, offset int64, val interface{}) *RedisResponse {
+	return m.mirror("SETRANGE", key, func(op RedisOperator) *RedisResponse {
+		return op.SetRange(key, offset, val)
+	})
+}
+
+// Hash writes
+
+func (m *MigrationRedisOp) HMSet(key interface{}, val map[interface{}]interface{}) *RedisResponse {
+	return m.mirror("HMSET", key, func(op RedisOperator) *RedisResponse {
+		return op.HMSet(key, val)
+	})
+}
+
+func (m *MigrationRedisOp) HMSetOrdered(key interface{}, pairs [][2]interface{}) *RedisResponse {
+	return m.mirror("HMSET", key, func(op RedisOperator) *RedisResponse {
+		return op.HMSetOrdered(key, pairs)
+	})
+}
+
+func (m *MigrationRedisOp) HSet(key, field, val interface{}) *RedisResponse {
+	return m.mirror("HSET", key, func(op RedisOperator) *RedisResponse {
+		return op.HSet(key, field, val)
+	})
+}
+
+func (m *MigrationRedisOp) HSetNX(key, field, val interface{}) *RedisResponse {
+	return m.mirror("HSETNX", key, func(op RedisOperator) *RedisResponse {
+		return op.HSetNX(key, field, val)
+	})
+}
+
+func (m *MigrationRedisOp) HDel(key interface{}, field ...interface{}) *RedisResponse {
+	return m.mirror("HDEL", key, func(op RedisOperator) *RedisResponse {
+		return op.HDel(key, field...)
+	})
+}
+
+func (m *MigrationRedisOp) HIncrBy(key interface{}, field interface{}, val int64) *RedisResponse {
+	return m.mirror("HINCRBY", key, func(op RedisOperator) *RedisResponse {
+		return op.HIncrBy(key, field, val)
+	})
+}
+
+// Key writes
+
+func (m *MigrationRedisOp) Expire(key interface{}, ttl int64) *RedisResponse {
+	return m.mirror("EXPIRE", key, func(op RedisOperator) *RedisResponse {
+		return op.Expire(key, ttl)
+	})
+}
+
+func (m *MigrationRedisOp) ExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	return m.mirror("EXPIRE", key, func(op RedisOperator) *RedisResponse {
+		return op.ExpireWithOptions(key, ttl, opts)
+	})
+}
+
+func (m *MigrationRedisOp) PExpire(key interface{}, ttl int64) *RedisResponse {
+	return m.mirror("PEXPIRE", key, func(op RedisOperator) *RedisResponse {
+		return op.PExpire(key, ttl)
+	})
+}
+
+func (m *MigrationRedisOp) PExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	return m.mirror("PEXPIRE", key, func(op RedisOperator) *RedisResponse {
+		return op.PExpireWithOptions(key, ttl, opts)
+	})
+}
+
+func (m *MigrationRedisOp) ExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return m.mirror("EXPIREAT", key, func(op RedisOperator) *RedisResponse {
+		return op.ExpireAt(key, timestamp)
+	})
+}
+
+func (m *MigrationRedisOp) ExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	return m.mirror("EXPIREAT", key, func(op RedisOperator) *RedisResponse {
+		return op.ExpireAtWithOptions(key, timestamp, opts)
+	})
+}
+
+func (m *MigrationRedisOp) PExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return m.mirror("PEXPIREAT", key, func(op RedisOperator) *RedisResponse {
+		return op.PExpireAt(key, timestamp)
+	})
+}
+
+func (m *MigrationRedisOp) PExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	return m.mirror("PEXPIREAT", key, func(op RedisOperator) *RedisResponse {
+		return op.PExpireAtWithOptions(key, timestamp, opts)
+	})
+}
+
+func (m *MigrationRedisOp) Delete(key ...interface{}) *RedisResponse {
+	return m.mirror("DEL", redisMigrationKey(key), func(op RedisOperator) *RedisResponse {
+		return op.Delete(key...)
+	})
+}
+
+func (m *MigrationRedisOp) Copy(src, dst interface{}) *RedisResponse {
+	return m.mirror("COPY", src, func(op RedisOperator) *RedisResponse {
+		return op.Copy(src, dst)
+	})
+}
+
+func (m *MigrationRedisOp) Restore(key interface{}, ttl int64, payload []byte, replace bool) *RedisResponse {
+	return m.mirror("RESTORE", key, func(op RedisOperator) *RedisResponse {
+		return op.Restore(key, ttl, payload, replace)
+	})
+}
+
+func (m *MigrationRedisOp) Rename(oldKey, newKey interface{}) *RedisResponse {
+	return m.mirror("RENAME", oldKey, func(op RedisOperator) *RedisResponse {
+		return op.Rename(oldKey, newKey)
+	})
+}
+
+func (m *MigrationRedisOp) RenameNX(oldKey, newKey interface{}) *RedisResponse {
+	return m.mirror("RENAMENX", oldKey, func(op RedisOperator) *RedisResponse {
+		return op.RenameNX(oldKey, newKey)
+	})
+}
+
+func (m *MigrationRedisOp) Unlink(key ...interface{}) *RedisResponse {
+	return m.mirror("UNLINK", redisMigrationKey(key), func(op RedisOperator) *RedisResponse {
+		return op.Unlink(key...)
+	})
+}
+
+func (m *MigrationRedisOp) DeleteByPattern(pattern string, batchSize int64) *RedisResponse {
+	return m.mirror("UNLINK", pattern, func(op RedisOperator) *RedisResponse {
+		return op.DeleteByPattern(pattern, batchSize)
+	})
+}
+
+// DeleteByPatternWithOptions deletes the keys of both instances, Progress is called for the primary only.
+func (m *MigrationRedisOp) DeleteByPatternWithOptions(pattern string, opts DeleteByPatternOptions) *RedisResponse {
+	response := m.RedisOperator.DeleteByPatternWithOptions(pattern, opts)
+	if redisMigrationReplayed(response) {
+		primary := redisMigrationReply(response)
+		opts.Progress = nil
+		m.replay(func() {
+			m.compare("UNLINK", pattern, primary, m.secondary.DeleteByPatternWithOptions(pattern, opts))
+		})
+	}
+
+	return response
+}
+
+func (m *MigrationRedisOp) Persist(key interface{}) *RedisResponse {
+	return m.mirror("PERSIST", key, func(op RedisOperator) *RedisResponse {
+		return op.Persist(key)
+	})
+}
+
+// List writes
+
+func (m *MigrationRedisOp) LInsert(key interface{}, where string, pivot, element interface{}) *RedisResponse {
+	return m.mirror("LINSERT", key, func(op RedisOperator) *RedisResponse {
+		return op.LInsert(key, where, pivot, element)
+	})
+}
+
+func (m *MigrationRedisOp) LMove(source, destination interface{}, srcWhere, dstWhere string) *RedisResponse {
+	return m.mirror("LMOVE", source, func(op RedisOperator) *RedisResponse {
+		return op.LMove(source, destination, srcWhere, dstWhere)
+	})
+}
+
+func (m *MigrationRedisOp) LMPop(count int64, where string, key ...interface{}) *RedisResponse {
+	return m.mirror("LMPOP", redisMigrationKey(key), func(op RedisOperator) *RedisResponse {
+		return op.LMPop(count, where, key...)
+	})
+}
+
+func (m *MigrationRedisOp) LPop(key interface{}) *RedisResponse {
+	return m.mirror("LPOP", key, func(op RedisOperator) *RedisResponse {
+		return op.LPop(key)
+	})
+}
+
+func (m *MigrationRedisOp) LPopN(key interface{}, count int64) *RedisResponse {
+	return m.mirror("LPOP", key, func(op RedisOperator) *RedisResponse {
+		return op.LPopN(key, count)
+	})
+}
+
+func (m *MigrationRedisOp) LPush(key interface{}, val ...interface{}) *RedisResponse {
+	return m.mirror("LPUSH", key, func(op RedisOperator) *RedisResponse {
+		return op.LPush(key, val...)
+	})
+}
+
+func (m *MigrationRedisOp) LPushX(key interface{}, val ...interface{}) *RedisResponse {
+	return m.mirror("LPUSHX", key, func(op RedisOperator) *RedisResponse {
+		return op.LPushX(key, val...)
+	})
+}
+
+func (m *MigrationRedisOp) LRem(key interface{}, count int64, element interface{}) *RedisResponse {
+	return m.mirror("LREM", key, func(op RedisOperator) *RedisResponse {
+		return op.LRem(key, count, element)
+	})
+}
+
+func (m *MigrationRedisOp) LSet(key interface{}, index int64, element interface{}) *RedisResponse {
+	return m.mirror("LSET", key, func(op RedisOperator) *RedisResponse {
+		return op.LSet(key, index, element)
+	})
+}
+
+func (m *MigrationRedisOp) LTrim(key interface{}, start, stop int64) *RedisResponse {
+	return m.mirror("LTRIM", key, func(op RedisOperator) *RedisResponse {
+		return op.LTrim(key, start, stop)
+	})
+}
+
+func (m *MigrationRedisOp) RPop(key interface{}) *RedisResponse {
+	return m.mirror("RPOP", key, func(op RedisOperator) *RedisResponse {
+		return op.RPop(key)
+	})
+}
+
+func (m *MigrationRedisOp) RPopN(key interface{}, count int64) *RedisResponse {
+	return m.mirror("RPOP", key, func(op RedisOperator) *RedisResponse {
+		return op.RPopN(key, count)
+	})
+}
+
+func (m *MigrationRedisOp) RPopLPush(source, destination interface{}) *RedisResponse {
+	return m.mirror("RPOPLPUSH", source, func(op RedisOperator) *RedisResponse {
+		return op.RPopLPush(source, destination)
+	})
+}
+
+func (m *MigrationRedisOp) RPush(key interface{}, val ...interface{}) *RedisResponse {
+	return m.mirror("RPUSH", key, func(op RedisOperator) *RedisResponse {
+		return op.RPush(key, val...)
+	})
+}
+
+func (m *MigrationRedisOp) RPushX(key interface{}, val ...interface{}) *RedisResponse {
+	return m.mirror("RPUSHX", key, func(op RedisOperator) *RedisResponse {
+		return op.RPushX(key, val...)
+	})
+}
+
+// Set writes
+
+func (m *MigrationRedisOp) SAdd(key interface{}, member ...interface{}) *RedisResponse {
+	return m.mirror("SADD", key, func(op RedisOperator) *RedisResponse {
+		return op.SAdd(key, member...)
+	})
+}
+
+func (m *MigrationRedisOp) SDiffStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return m.mirror("SDIFFSTORE", destination, func(op RedisOperator) *RedisResponse {
+		return op.SDiffStore(destination, key...)
+	})
+}
+
+func (m *MigrationRedisOp) SInterStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return m.mirror("SINTERSTORE", destination, func(op RedisOperator) *RedisResponse {
+		return op.SInterStore(destination, key...)
+	})
+}
+
+func (m *MigrationRedisOp) SMove(source, destination, member interface{}) *RedisResponse {
+	return m.mirror("SMOVE", source, func(op RedisOperator) *RedisResponse {
+		return op.SMove(source, destination, member)
+	})
+}
+
+// SPop removes the member popped from the primary from the secondary, SPOP picks members at random.
+func (m *MigrationRedisOp) SPop(key interface{}) *RedisResponse {
+	response := m.RedisOperator.SPop(key)
+	if response.Error == nil {
+		m.mirrorSRem(key, []interface{}{response.data})
+	}
+
+	return response
+}
+
+// SPopN removes the members popped from the primary from the secondary, SPOP picks members at random.
+func (m *MigrationRedisOp) SPopN(key interface{}, count int64) *RedisResponse {
+	response := m.RedisOperator.SPopN(key, count)
+	if members, ok := response.data.([]interface{}); response.Error == nil && ok && len(members) > 0 {
+		m.mirrorSRem(key, members)
+	}
+
+	return response
+}
+
+func (m *MigrationRedisOp) mirrorSRem(key interface{}, members []interface{}) {
+	primary := redisMigrationReply(&RedisResponse{RedisResponseEntity: RedisResponseEntity{data: int64(len(members))}})
+	m.replay(func() {
+		m.compare("SREM", key, primary, m.secondary.SRem(key, members...))
+	})
+}
+
+func (m *MigrationRedisOp) SRem(key interface{}, member ...interface{}) *RedisResponse {
+	return m.mirror("SREM", key, func(op RedisOperator) *RedisResponse {
+		return op.SRem(key, member...)
+	})
+}
+
+func (m *MigrationRedisOp) SUnionStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return m.mirror("SUNIONSTORE", destination, func(op RedisOperator) *RedisResponse {
+		return op.SUnionStore(destination, key...)
+	})
+}
+
+// Sorted set writes
+
+func (m *MigrationRedisOp) ZAdd(key interface{}, score float64, member interface{}, pairs ...interface{}) *RedisResponse {
+	return m.mirror("ZADD", key, func(op RedisOperator) *RedisResponse {
+		return op.ZAdd(key, score, member, pairs...)
+	})
+}
+
+func (m *MigrationRedisOp) ZAddWithOptions(key interface{}, opts ZAddOptions, score float64, member interface{}, pairs ...interface{}) *RedisResponse {
+	return m.mirror("ZADD", key, func(op RedisOperator) *RedisResponse {
+		return op.ZAddWithOptions(key, opts, score, member, pairs...)
+	})
+}
+
+func (m *MigrationRedisOp) ZDiffStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return m.mirror("ZDIFFSTORE", destination, func(op RedisOperator) *RedisResponse {
+		return op.ZDiffStore(destination, key...)
+	})
+}
+
+func (m *MigrationRedisOp) ZIncrBy(key interface{}, increment float64, member interface{}) *RedisResponse {
+	return m.mirror("ZINCRBY", key, func(op RedisOperator) *RedisResponse {
+		return op.ZIncrBy(key, increment, member)
+	})
+}
+
+func (m *MigrationRedisOp) ZInterStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return m.mirror("ZINTERSTORE", destination, func(op RedisOperator) *RedisResponse {
+		return op.ZInterStore(destination, key...)
+	})
+}
+
+func (m *MigrationRedisOp) ZMPop(count int64, where string, key ...interface{}) *RedisResponse {
+	return m.mirror("ZMPOP", redisMigrationKey(key), func(op RedisOperator) *RedisResponse {
+		return op.ZMPop(count, where, key...)
+	})
+}
+
+func (m *MigrationRedisOp) ZPopMax(key interface{}) *RedisResponse {
+	return m.mirror("ZPOPMAX", key, func(op RedisOperator) *RedisResponse {
+		return op.ZPopMax(key)
+	})
+}
+
+func (m *MigrationRedisOp) ZPopMin(key interface{}) *RedisResponse {
+	return m.mirror("ZPOPMIN", key, func(op RedisOperator) *RedisResponse {
+		return op.ZPopMin(key)
+	})
+}
+
+func (m *MigrationRedisOp) ZRangeStore(dst interface{}, src interface{}, min, max int64) *RedisResponse {
+	return m.mirror("ZRANGESTORE", dst, func(op RedisOperator) *RedisResponse {
+		return op.ZRangeStore(dst, src, min, max)
+	})
+}
+
+func (m *MigrationRedisOp) ZRem(key interface{}, member ...interface{}) *RedisResponse {
+	return m.mirror("ZREM", key, func(op RedisOperator) *RedisResponse {
+		return op.ZRem(key, member...)
+	})
+}
+
+func (m *MigrationRedisOp) ZRemRangeByLex(key interface{}, min, max string) *RedisResponse {
+	return m.mirror("ZREMRANGEBYLEX", key, func(op RedisOperator) *RedisResponse {
+		return op.ZRemRangeByLex(key, min, max)
+	})
+}
+
+func (m *MigrationRedisOp) ZRemRangeByRank(key interface{}, start, stop int64) *RedisResponse {
+	return m.mirror("ZREMRANGEBYRANK", key, func(op RedisOperator) *RedisResponse {
+		return op.ZRemRangeByRank(key, start, stop)
+	})
+}
+
+func (m *MigrationRedisOp) ZRemRangeByScore(key interface{}, min, max string) *RedisResponse {
+	return m.mirror("ZREMRANGEBYSCORE", key, func(op RedisOperator) *RedisResponse {
+		return op.ZRemRangeByScore(key, min, max)
+	})
+}
+
+func (m *MigrationRedisOp) ZUnionStore(destination interface{}, key ...interface{}) *RedisResponse {
+	return m.mirror("ZUNIONSTORE", destination, func(op RedisOperator) *RedisResponse {
+		return op.ZUnionStore(destination, key...)
+	})
+}
+
+// Admin and script writes
+
+func (m *MigrationRedisOp) FlushDB() *RedisResponse {
+	return m.mirror("FLUSHDB", nil, func(op RedisOperator) *RedisResponse {
+		return op.FlushDB()
+	})
+}
+
+func (m *MigrationRedisOp) FlushAll() *RedisResponse {
+	return m.mirror("FLUSHALL", nil, func(op RedisOperator) *RedisResponse {
+		return op.FlushAll()
+	})
+}
+
+func (m *MigrationRedisOp) Eval(script string, keys []interface{}, args []interface{}) *RedisResponse {
+	return m.mirror("EVAL", redisMigrationKey(keys), func(op RedisOperator) *RedisResponse {
+		return op.Eval(script, keys, args)
+	})
+}
+
+func (m *MigrationRedisOp) EvalSha(sha string, keys []interface{}, args []interface{}) *RedisResponse {
+	return m.mirror("EVALSHA", redisMigrationKey(keys), func(op RedisOperator) *RedisResponse {
+		return op.EvalSha(sha, keys, args)
+	})
+}
+
+// ScriptLoad loads script on both instances, so EvalSha can be replayed.
+func (m *MigrationRedisOp) ScriptLoad(script string) *RedisResponse {
+	return m.mirror("SCRIPT", nil, func(op RedisOperator) *RedisResponse {
+		return op.ScriptLoad(script)
+	})
+}
+
+// Compile-time check that the migration operator stays in sync with RedisOperator.
+var _ RedisOperator = (*MigrationRedisOp)(nil)
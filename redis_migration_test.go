@@ -0,0 +1,189 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestMigrationRedisOp(t *testing.T) {
+	newStore := func() *MockRedisOp {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		return op
+	}
+
+	check := func(t *testing.T, async bool) {
+		primary, secondary := newStore(), newStore()
+		var mutex sync.Mutex
+		var divergences []MigrationRedisDivergence
+		m := NewMigrationRedisOp(primary, secondary, MigrationRedisOptions{
+			Async: async,
+			OnDivergence: func(divergence MigrationRedisDivergence) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				divergences = append(divergences, divergence)
+			},
+		})
+
+		assert.Equal(t, primary, m.Primary())
+		assert.Equal(t, secondary, m.Secondary())
+		assert.NoError(t, m.Set("test_migration:a", "1").Error)
+		assert.NoError(t, m.SetExpireJitter("test_migration:b", "2", 100, 0.5).Error)
+		m.HSet("test_migration:h", "f", "v")
+		m.RPush("test_migration:l", "x", "y")
+		m.Do("SET", "test_migration:c", "3")
+		m.Pipeline(
+			RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"test_migration:a"}},
+			RedisPipelineCmd{Cmd: "INCR", Args: []interface{}{"test_migration:a"}},
+		)
+
+		_, err := m.ExecCtx(context.Background(), func(tx *RedisTx) error {
+			tx.Do("SADD", "test_migration:s", "m1", "m2")
+			tx.Do("EXPIRE", "test_migration:s", 100)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		popped := m.SPop("test_migration:s").GetString()
+
+		// A key written to the primary only diverges
+		primary.Set("test_migration:n", "10")
+		assert.Equal(t, int64(11), m.Incr("test_migration:n").GetInt64())
+		m.Flush()
+
+		assert.Equal(t, "2", secondary.Get("test_migration:a").GetString())
+		assert.Equal(t, "2", secondary.Get("test_migration:b").GetString())
+		assert.Equal(t, primary.TTL("test_migration:b").GetInt64(), secondary.TTL("test_migration:b").GetInt64())
+		assert.Equal(t, "v", secondary.HGet("test_migration:h", "f").GetString())
+		assert.Equal(t, int64(2), secondary.LLen("test_migration:l").GetInt64())
+		assert.Equal(t, "3", secondary.Get("test_migration:c").GetString())
+		assert.Equal(t, int64(1), secondary.SCard("test_migration:s").GetInt64())
+		assert.Equal(t, int64(0), secondary.SIsMember("test_migration:s", popped).GetInt64())
+		assert.Equal(t, "1", secondary.Get("test_migration:n").GetString())
+		assert.Equal(t, []MigrationRedisDivergence{
+			{Cmd: "INCR", Key: "test_migration:n", Primary: "11", Secondary: "1"},
+		}, divergences)
+
+		stats := m.Stats()
+		assert.Equal(t, int64(10), stats.SecondaryWrites)
+		assert.Equal(t, int64(1), stats.Divergences)
+		assert.Equal(t, int64(0), stats.SecondaryErrors)
+		assert.Equal(t, int64(0), stats.Dropped)
+		assert.NoError(t, m.Close())
+		m.Set("test_migration:a", "closed")
+		m.Flush()
+		assert.Equal(t, "2", secondary.Get("test_migration:a").GetString())
+	}
+
+	t.Run("Sync", func(t *testing.T) {
+		check(t, false)
+	})
+
+	t.Run("Async", func(t *testing.T) {
+		check(t, true)
+	})
+
+	t.Run("SkipFailedWrites", func(t *testing.T) {
+		primary, secondary := newStore(), newStore()
+		m := NewMigrationRedisOp(primary, secondary, MigrationRedisOptions{})
+		primary.Set("test_migration:a", "text")
+		assert.Error(t, m.Incr("test_migration:a").Error)
+		assert.Equal(t, int64(0), m.Stats().SecondaryWrites)
+		assert.True(t, IsNotFound(secondary.Get("test_migration:a").Error))
+
+		// A failing secondary is reported
+		secondary.Set("test_migration:b", "text")
+		m.Incr("test_migration:b")
+		assert.Equal(t, int64(1), m.Stats().SecondaryErrors)
+		assert.Equal(t, int64(1), m.Stats().Divergences)
+	})
+
+	t.Run("ReadFallback", func(t *testing.T) {
+		primary, secondary := newStore(), newStore()
+		m := NewMigrationRedisOp(primary, secondary, MigrationRedisOptions{ReadFallback: true})
+		secondary.Set("test_migration:old", "1")
+		secondary.HSet("test_migration:h", "f", "v")
+		secondary.RPush("test_migration:l", "x")
+		secondary.SAdd("test_migration:s", "m")
+		primary.Set("test_migration:new", "2")
+		secondary.Set("test_migration:new", "stale")
+
+		assert.Equal(t, "1", m.Get("test_migration:old").GetString())
+		assert.Equal(t, "2", m.Get("test_migration:new").GetString())
+		assert.Equal(t, "v", m.HGet("test_migration:h", "f").GetString())
+		assert.Len(t, m.LRange("test_migration:l", 0, -1).GetSlice(), 1)
+		assert.Len(t, m.SMembers("test_migration:s").GetSlice(), 1)
+		assert.True(t, IsNotFound(m.Get("test_migration:missing").Error))
+		assert.Equal(t, int64(4), m.Stats().FallbackReads)
+
+		m = NewMigrationRedisOp(primary, secondary, MigrationRedisOptions{})
+		assert.True(t, IsNotFound(m.Get("test_migration:old").Error))
+	})
+
+	t.Run("Dropped", func(t *testing.T) {
+		primary, secondary := newStore(), newStore()
+		started, block := make(chan struct{}), make(chan struct{})
+		m := NewMigrationRedisOp(primary, secondary, MigrationRedisOptions{Async: true, QueueSize: 1})
+		m.replay(func() {
+			close(started)
+			<-block
+		})
+
+		<-started
+
+		m.Set("test_migration:a", "1")
+		m.Set("test_migration:b", "2")
+		m.Set("test_migration:c", "3")
+		close(block)
+		m.Flush()
+		assert.Equal(t, int64(1), m.Stats().SecondaryWrites)
+		assert.Equal(t, int64(2), m.Stats().Dropped)
+		assert.Equal(t, "1", secondary.Get("test_migration:a").GetString())
+		assert.NoError(t, m.Close())
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		instances := make([]*Redis, 2)
+		for i, db := range []int{1, 2} {
+			profile, err := secret.LoadRedisProfile("test")
+			assert.NoError(t, err)
+			profile.DB = db
+			instances[i] = NewRedisWithProfile("test", profile)
+		}
+
+		redis := NewMigrationRedis("test", instances[0], instances[1], MigrationRedisOptions{Async: true, ReadFallback: true})
+		defer redis.Close()
+		m := redis.Master().(*MigrationRedisOp)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, m.Set(fmt.Sprintf("test_migration:%d", i), i).Error)
+		}
+
+		instances[1].Master().Set("test_migration:old", "old")
+		m.Flush()
+		for i := 0; i < 10; i++ {
+			key := fmt.Sprintf("test_migration:%d", i)
+			assert.Equal(t, fmt.Sprint(i), instances[1].Master().Get(key).GetString())
+		}
+
+		assert.Equal(t, "old", redis.Slave().Get("test_migration:old").GetString())
+		assert.Equal(t, int64(0), m.Stats().Divergences)
+		m.DeleteByPattern("test_migration:*", 100)
+		m.Flush()
+		assert.True(t, IsNotFound(instances[0].Master().Get("test_migration:0").Error))
+		assert.True(t, IsNotFound(instances[1].Master().Get("test_migration:old").Error))
+	})
+}
@@ -1,20 +1,69 @@
 package datastore
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	secret "github.com/yetiz-org/goth-datastore/secrets"
 )
 
+// ErrMockCrossSlot is returned in cluster mode, see SetClusterMode, for a multi-key command whose keys hash to
+// different slots, like the CROSSSLOT error of the server.
+var ErrMockCrossSlot = errors.New("CROSSSLOT Keys in request don't hash to the same slot")
+
 // MockCallRecord represents a single Redis command call record for testing verification.
 type MockCallRecord struct {
-	Timestamp time.Time
-	Command   string
-	Args      []interface{}
-	Response  interface{}
-	Error     error
+	Timestamp   time.Time
+	Command     string
+	Args        []interface{}
+	Response    interface{}
+	Error       error
+	GoroutineID uint64 // Goroutine that issued the call
+	Caller      string // file:line of the first caller outside MockRedisOp
+	Stack       string // Stack trace of the calling goroutine, only set when SetRecordStacks is enabled
+}
+
+// mockRedisOpFramePrefix is the function name prefix of MockRedisOp methods, skipped when resolving the caller.
+var mockRedisOpFramePrefix = reflect.TypeOf(MockRedisOp{}).PkgPath() + ".(*MockRedisOp)."
+
+// MockGoroutineID returns the id of the calling goroutine, as recorded in MockCallRecord.GoroutineID.
+func MockGoroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	// Stack starts with "goroutine 123 [running]:"
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
+
+// mockCaller returns file:line of the first frame outside MockRedisOp methods.
+func mockCaller() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, mockRedisOpFramePrefix) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+
+		if !more {
+			return ""
+		}
+	}
 }
 
 // MockResponse contains the response data and optional error for mock operations.
@@ -34,34 +83,163 @@ type MockConditionRule struct {
 	Response  MockResponse
 }
 
+// MockAnyArg matches any value at its position in ExpectCommand and SetPatternResponse arguments.
+const MockAnyArg = "mock.Anything"
+
+// MockArgMatcher matches a single command argument in ExpectCommand and SetPatternResponse.
+type MockArgMatcher interface {
+	Match(arg interface{}) bool
+}
+
+type mockGlobMatcher string
+
+func (g mockGlobMatcher) Match(arg interface{}) bool {
+	return mockGlobMatch(string(g), mockArgString(arg))
+}
+
+func (g mockGlobMatcher) String() string {
+	return fmt.Sprintf("glob(%s)", string(g))
+}
+
+// MockGlob returns a matcher accepting arguments that match the Redis glob-style pattern, e.g. "user:*:profile".
+func MockGlob(pattern string) MockArgMatcher {
+	return mockGlobMatcher(pattern)
+}
+
+type mockRegexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (r mockRegexMatcher) Match(arg interface{}) bool {
+	return r.re.MatchString(mockArgString(arg))
+}
+
+func (r mockRegexMatcher) String() string {
+	return fmt.Sprintf("regex(%s)", r.re.String())
+}
+
+// MockRegex returns a matcher accepting arguments that match the regular expression, panicking if expr is invalid.
+func MockRegex(expr string) MockArgMatcher {
+	return mockRegexMatcher{re: regexp.MustCompile(expr)}
+}
+
+// mockArgsMatch compares args position by position against literals, MockAnyArg and MockArgMatcher values.
+// Extra args are allowed unless exact is set.
+func mockArgsMatch(expected, args []interface{}, exact bool) bool {
+	if len(args) < len(expected) || (exact && len(args) != len(expected)) {
+		return false
+	}
+
+	for i, e := range expected {
+		switch matcher := e.(type) {
+		case MockArgMatcher:
+			if !matcher.Match(args[i]) {
+				return false
+			}
+		default:
+			if e != MockAnyArg && mockArgString(e) != mockArgString(args[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// mockIsGlobPattern reports whether a SetResponse key pattern needs glob matching.
+func mockIsGlobPattern(pattern string) bool {
+	return pattern != "*" && strings.ContainsAny(pattern, "*?[")
+}
+
+// MockTestingT is the subset of *testing.T used by AssertExpectations.
+type MockTestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// MockExpectation describes a command the code under test is expected to call.
+// Create expectations with MockRedisOp.ExpectCommand and verify them with AssertExpectations.
+type MockExpectation struct {
+	Command  string
+	Args     []interface{}
+	response *MockResponse
+	times    int
+	calls    int
+}
+
+// Return sets the response returned when the expectation matches, taking precedence over other responses.
+func (e *MockExpectation) Return(data interface{}, err error) *MockExpectation {
+	e.response = &MockResponse{Data: data, Error: err}
+	return e
+}
+
+// Times requires the command to be called exactly n times; further calls no longer match.
+func (e *MockExpectation) Times(n int) *MockExpectation {
+	e.times = n
+	return e
+}
+
+// Once is shorthand for Times(1).
+func (e *MockExpectation) Once() *MockExpectation {
+	return e.Times(1)
+}
+
+func (e *MockExpectation) matches(cmd string, args []interface{}) bool {
+	if e.Command != cmd || (e.times > 0 && e.calls >= e.times) {
+		return false
+	}
+
+	// No arguments means any arguments
+	return len(e.Args) == 0 || mockArgsMatch(e.Args, args, true)
+}
+
+func (e *MockExpectation) String() string {
+	return fmt.Sprintf("%s %v", e.Command, e.Args)
+}
+
 // MockRedisOp implements RedisOperator interface for testing purposes.
 // It provides a full mock implementation that can simulate Redis behavior,
 // record call history, and return configured responses.
 type MockRedisOp struct {
 	mutex           sync.RWMutex
 	responses       map[string]MockResponse   // Static responses by command:key pattern
-	sequences       map[string][]MockResponse // Sequential responses
+	sequences       map[string]*mockSequence  // Sequential responses by command:key pattern
 	conditions      []MockConditionRule       // Conditional responses
 	callHistory     []MockCallRecord          // All call records
-	sequenceIndexes map[string]int            // Current index for sequence responses
+	strictSteps     []string                  // Sequence keys in the order set WithStrictOrder
+	strictNext      int                       // Index of the next strict order step
+	orderViolations []MockCallRecord          // Calls out of the strict order
 	defaultError    error                     // Default error for unmatched calls
+	store           *mockRedisStore           // In-memory data set used in stateful mode
+	expectations    []*MockExpectation        // Expected calls verified by AssertExpectations
+	unexpectedCalls []MockCallRecord          // Calls matching no expectation while expectations are set
+	chaos           *mockChaos                // Fault injection, nil when disabled
+	historyLimit    int                       // Maximum records kept in callHistory, 0 means unlimited
+	recordStacks    bool                      // Capture stack traces in call records
+	fixtures        map[string][]MockResponse // Replies replayed from fixtures by command and arguments
+	fixtureIndexes  map[string]int            // Next reply of each fixture key
+	scripts         map[string]MockScriptFunc // Script behaviors by SHA1 digest
+	loadedScripts   map[string]bool           // Digests of the scripts loaded with ScriptLoad
+	clock           *MockClock                // Time source of TTLs and outages, the wall clock when nil
+	cluster         bool                      // Multi-key commands across slots are rejected
 
 	// Simulated connection pool info
 	activeCount int
 	idleCount   int
 	meta        secret.RedisMeta
+	codec       Codec
+	crypt       *RedisEncryption
+	guard       *RedisCommandGuard
 }
 
 // NewMockRedisOp creates a new MockRedisOp instance.
 func NewMockRedisOp() *MockRedisOp {
 	return &MockRedisOp{
-		responses:       make(map[string]MockResponse),
-		sequences:       make(map[string][]MockResponse),
-		conditions:      make([]MockConditionRule, 0),
-		callHistory:     make([]MockCallRecord, 0),
-		sequenceIndexes: make(map[string]int),
-		activeCount:     0,
-		idleCount:       1,
+		responses:   make(map[string]MockResponse),
+		sequences:   make(map[string]*mockSequence),
+		conditions:  make([]MockConditionRule, 0),
+		callHistory: make([]MockCallRecord, 0),
+		activeCount: 0,
+		idleCount:   1,
 		meta: secret.RedisMeta{
 			Host: "mock",
 			Port: 6379,
@@ -70,7 +248,8 @@ func NewMockRedisOp() *MockRedisOp {
 }
 
 // SetResponse sets a static response for a specific command and key pattern.
-// Pattern supports "*" as wildcard for any key.
+// Pattern supports "*" as wildcard for any key and Redis glob patterns such as "user:*:profile",
+// an exact key takes precedence over glob patterns which take precedence over "*".
 func (m *MockRedisOp) SetResponse(cmd string, keyPattern string, data interface{}, err error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -78,14 +257,43 @@ func (m *MockRedisOp) SetResponse(cmd string, keyPattern string, data interface{
 	m.responses[key] = MockResponse{Data: data, Error: err}
 }
 
+// SetPatternResponse sets a response for calls whose leading arguments match args position by position.
+// Each position may be a literal, MockAnyArg, MockGlob or MockRegex; remaining arguments are not compared.
+// Pattern responses are checked together with conditional responses, in the order they were added.
+func (m *MockRedisOp) SetPatternResponse(cmd string, args []interface{}, data interface{}, err error) {
+	expected := append([]interface{}(nil), args...)
+	m.SetConditionalResponse(cmd, func(cmd string, args []interface{}) bool {
+		return mockArgsMatch(expected, args, false)
+	}, MockResponse{Data: data, Error: err})
+}
+
 // SetSequentialResponses sets a sequence of responses for a command and key pattern.
-// Each call will return the next response in sequence, cycling back to start when exhausted.
-func (m *MockRedisOp) SetSequentialResponses(cmd string, keyPattern string, responses []MockResponse) {
+// Each call will return the next response in sequence; once exhausted, the sequence of the "*" pattern cycles back
+// to start and the others keep returning their last response. See WithStrictOrder to enforce the order of calls.
+func (m *MockRedisOp) SetSequentialResponses(cmd string, keyPattern string, responses []MockResponse, opts ...MockSequenceOption) {
+	sequence := &mockSequence{responses: append([]MockResponse(nil), responses...), cycle: keyPattern == "*"}
+	for _, opt := range opts {
+		opt(sequence)
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	key := fmt.Sprintf("%s:%s", cmd, keyPattern)
-	m.sequences[key] = responses
-	m.sequenceIndexes[key] = 0
+	if !sequence.strict {
+		m.sequences[key] = sequence
+		return
+	}
+
+	sequence.cycle = false
+	if existing, ok := m.sequences[key]; ok && existing.strict {
+		existing.responses = append(existing.responses, sequence.responses...)
+	} else {
+		m.sequences[key] = sequence
+	}
+
+	for range responses {
+		m.strictSteps = append(m.strictSteps, key)
+	}
 }
 
 // SetConditionalResponse adds a conditional response rule.
@@ -116,6 +324,98 @@ func (m *MockRedisOp) GetCallHistory() []MockCallRecord {
 	return history
 }
 
+// SetCallHistoryLimit caps the call history to the most recent limit records, dropping the oldest ones
+// like a ring buffer. A limit of 0 keeps every record.
+func (m *MockRedisOp) SetCallHistoryLimit(limit int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.historyLimit = limit
+	if limit > 0 && len(m.callHistory) > limit {
+		m.callHistory = append([]MockCallRecord(nil), m.callHistory[len(m.callHistory)-limit:]...)
+	}
+}
+
+// SetRecordStacks enables capturing the caller's stack trace in every call record.
+func (m *MockRedisOp) SetRecordStacks(enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recordStacks = enabled
+}
+
+// GetCallsByGoroutine returns all recorded calls issued by the goroutine, see MockGoroutineID.
+func (m *MockRedisOp) GetCallsByGoroutine(goroutineID uint64) []MockCallRecord {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var filteredCalls []MockCallRecord
+	for _, call := range m.callHistory {
+		if call.GoroutineID == goroutineID {
+			filteredCalls = append(filteredCalls, call)
+		}
+	}
+	return filteredCalls
+}
+
+// GetCallsBetween returns all recorded calls with from <= Timestamp < to.
+func (m *MockRedisOp) GetCallsBetween(from, to time.Time) []MockCallRecord {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var filteredCalls []MockCallRecord
+	for _, call := range m.callHistory {
+		if !call.Timestamp.Before(from) && call.Timestamp.Before(to) {
+			filteredCalls = append(filteredCalls, call)
+		}
+	}
+	return filteredCalls
+}
+
+// GetCallsMatching returns all recorded calls of command whose leading arguments match args,
+// which may contain literals, MockAnyArg, MockGlob or MockRegex.
+func (m *MockRedisOp) GetCallsMatching(command string, args ...interface{}) []MockCallRecord {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var filteredCalls []MockCallRecord
+	for _, call := range m.callHistory {
+		if call.Command == command && mockArgsMatch(args, call.Args, false) {
+			filteredCalls = append(filteredCalls, call)
+		}
+	}
+	return filteredCalls
+}
+
+// newCallRecord creates a call record tagged with the calling goroutine and caller location.
+func (m *MockRedisOp) newCallRecord(timestamp time.Time, command string, args []interface{}) MockCallRecord {
+	record := MockCallRecord{
+		Timestamp:   timestamp,
+		Command:     command,
+		Args:        args,
+		GoroutineID: MockGoroutineID(),
+		Caller:      mockCaller(),
+	}
+
+	m.mutex.RLock()
+	recordStacks := m.recordStacks
+	m.mutex.RUnlock()
+	if recordStacks {
+		buf := make([]byte, 8192)
+		record.Stack = string(buf[:runtime.Stack(buf, false)])
+	}
+
+	return record
+}
+
+// appendCallRecord adds a record to the call history, honoring the history limit. Must be called with the lock held.
+func (m *MockRedisOp) appendCallRecord(record MockCallRecord) {
+	if m.historyLimit > 0 && len(m.callHistory) >= m.historyLimit {
+		// Drop the oldest records, append reallocates once capacity is exhausted so memory stays bounded
+		m.callHistory = m.callHistory[len(m.callHistory)-m.historyLimit+1:]
+	}
+
+	m.callHistory = append(m.callHistory, record)
+}
+
 // GetCallsByCommand returns all recorded calls for a specific command.
 func (m *MockRedisOp) GetCallsByCommand(command string) []MockCallRecord {
 	m.mutex.RLock()
@@ -168,11 +468,132 @@ func (m *MockRedisOp) Reset() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	m.responses = make(map[string]MockResponse)
-	m.sequences = make(map[string][]MockResponse)
+	m.sequences = make(map[string]*mockSequence)
 	m.conditions = make([]MockConditionRule, 0)
 	m.callHistory = make([]MockCallRecord, 0)
-	m.sequenceIndexes = make(map[string]int)
+	m.strictSteps, m.strictNext, m.orderViolations = nil, 0, nil
 	m.defaultError = nil
+	m.expectations = nil
+	m.unexpectedCalls = nil
+	m.chaos = nil
+	m.fixtures, m.fixtureIndexes = nil, nil
+	m.scripts, m.loadedScripts = nil, nil
+	if m.store != nil {
+		m.store.reset()
+	}
+}
+
+// ExpectCommand registers an expected call of cmd. Arguments are compared by their string form,
+// MockAnyArg matches any value, MockGlob and MockRegex match by pattern and no arguments match any argument list.
+// Once an expectation is registered, calls matching no expectation are reported by AssertExpectations.
+func (m *MockRedisOp) ExpectCommand(cmd string, args ...interface{}) *MockExpectation {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	expectation := &MockExpectation{Command: cmd, Args: args}
+	m.expectations = append(m.expectations, expectation)
+	return expectation
+}
+
+// AssertExpectations reports unmet expectations and unexpected calls to t, returning true when all were met.
+func (m *MockRedisOp) AssertExpectations(t MockTestingT) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	ok := true
+	for _, e := range m.expectations {
+		switch {
+		case e.times > 0 && e.calls != e.times:
+			t.Errorf("mock: expected %s to be called %d times, got %d", e, e.times, e.calls)
+			ok = false
+		case e.times == 0 && e.calls == 0:
+			t.Errorf("mock: expected %s to be called", e)
+			ok = false
+		}
+	}
+
+	for _, call := range m.unexpectedCalls {
+		t.Errorf("mock: unexpected call %s %v", call.Command, call.Args)
+		ok = false
+	}
+
+	return m.assertStrictOrder(t) && ok
+}
+
+// matchExpectation counts the call against the first matching expectation and returns its response if set.
+func (m *MockRedisOp) matchExpectation(cmd string, args []interface{}) (MockResponse, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.expectations) == 0 {
+		return MockResponse{}, false
+	}
+
+	for _, e := range m.expectations {
+		if e.matches(cmd, args) {
+			e.calls++
+			if e.response != nil {
+				return *e.response, true
+			}
+
+			return MockResponse{}, false
+		}
+	}
+
+	m.unexpectedCalls = append(m.unexpectedCalls, MockCallRecord{Timestamp: time.Now(), Command: cmd, Args: args})
+	return MockResponse{}, false
+}
+
+// EnableChaos injects latency, random failures and outages into every subsequent call as described by config.
+// Injected failures take precedence over expectations and configured responses.
+func (m *MockRedisOp) EnableChaos(config MockChaosConfig) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = newMockChaos(config)
+	if m.clock != nil {
+		m.chaos.setNow(m.nowFunc())
+	}
+}
+
+// DisableChaos stops fault injection.
+func (m *MockRedisOp) DisableChaos() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chaos = nil
+}
+
+func (m *MockRedisOp) injectChaos() (time.Duration, error) {
+	m.mutex.RLock()
+	chaos := m.chaos
+	m.mutex.RUnlock()
+	return chaos.inject()
+}
+
+// EnableStatefulMode switches the mock to evaluate unconfigured commands against an in-memory data set,
+// so GET returns what SET stored, TTLs expire and INCR increments. Configured responses still take precedence.
+func (m *MockRedisOp) EnableStatefulMode() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.store == nil {
+		m.store = newMockRedisStore()
+		m.store.setNow(m.nowFunc())
+	}
+}
+
+// IsStateful reports whether the mock evaluates commands against its in-memory data set.
+func (m *MockRedisOp) IsStateful() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.store != nil
+}
+
+// shareStore makes both mocks read and write the same in-memory data set.
+func (m *MockRedisOp) shareStore(other *MockRedisOp) {
+	other.EnableStatefulMode()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.store = other.store
 }
 
 // SetActiveCount sets the simulated active connection count.
@@ -198,22 +619,34 @@ func (m *MockRedisOp) SetMeta(meta secret.RedisMeta) {
 
 // mockDo handles the core mock logic for Redis commands.
 func (m *MockRedisOp) mockDo(cmd string, args ...interface{}) *RedisResponse {
+	if err := m.CommandGuard().Check(cmd, args...); err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	if m.crossSlot(cmd, args) {
+		return &RedisResponse{Error: ErrMockCrossSlot}
+	}
+
 	timestamp := time.Now()
 
-	// Try to find a matching response
-	response := m.findResponse(cmd, args)
+	// Injected faults take precedence over configured responses
+	delay, chaosErr := m.injectChaos()
+	var response MockResponse
+	if chaosErr != nil {
+		response = MockResponse{Error: chaosErr}
+	} else {
+		response = m.findResponse(cmd, args)
+	}
+
+	response.Delay += delay
 
 	// Record the call
-	record := MockCallRecord{
-		Timestamp: timestamp,
-		Command:   cmd,
-		Args:      args,
-		Response:  response.Data,
-		Error:     response.Error,
-	}
+	record := m.newCallRecord(timestamp, cmd, args)
+	record.Response = response.Data
+	record.Error = response.Error
 
 	m.mutex.Lock()
-	m.callHistory = append(m.callHistory, record)
+	m.appendCallRecord(record)
 	m.mutex.Unlock()
 
 	// Simulate delay if configured
@@ -233,38 +666,65 @@ func (m *MockRedisOp) mockDo(cmd string, args ...interface{}) *RedisResponse {
 }
 
 // findResponse finds the appropriate mock response for a command.
+// In stateful mode, commands without a configured response are evaluated against the in-memory data set.
 func (m *MockRedisOp) findResponse(cmd string, args []interface{}) MockResponse {
+	if response, ok := m.matchExpectation(cmd, args); ok {
+		return response
+	}
+
+	if response, ok := m.findConfiguredResponse(cmd, args); ok {
+		return response
+	}
+
+	if response, ok := m.findFixtureResponse(cmd, args); ok {
+		return response
+	}
+
+	if response, ok := m.findScriptResponse(cmd, args); ok {
+		return response
+	}
+
 	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+	store := m.store
+	defaultError := m.defaultError
+	m.mutex.RUnlock()
+
+	if store != nil {
+		data, err := store.exec(cmd, args)
+		if err == nil && data == nil {
+			// Nil replies surface as RedisNotFound, like RedisOp does
+			err = RedisNotFound
+		}
+
+		return MockResponse{Data: data, Error: err}
+	}
+
+	// Return default error or not found
+	if defaultError != nil {
+		return MockResponse{Error: defaultError}
+	}
+
+	// Default: return nil for unconfigured responses (allows test flexibility)
+	return MockResponse{Data: nil, Error: nil}
+}
+
+// findConfiguredResponse looks up conditional, sequential and static responses in that order.
+// It takes the write lock, taking a sequential response advances its sequence.
+func (m *MockRedisOp) findConfiguredResponse(cmd string, args []interface{}) (MockResponse, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 
 	// 1. Try conditional responses first
 	for _, rule := range m.conditions {
 		if rule.Command == cmd && rule.Condition(cmd, args) {
-			return rule.Response
+			return rule.Response, true
 		}
 	}
 
 	// 2. Try sequence responses
 	if len(args) > 0 {
-		key := fmt.Sprintf("%s:%v", cmd, args[0])
-		if sequence, exists := m.sequences[key]; exists && len(sequence) > 0 {
-			index := m.sequenceIndexes[key]
-			response := sequence[index]
-			// Update index for next call, but don't exceed sequence length
-			if index < len(sequence)-1 {
-				m.sequenceIndexes[key] = index + 1
-			}
-			// Stay at last response once exhausted
-			return response
-		}
-
-		// Try wildcard sequence
-		wildcardKey := fmt.Sprintf("%s:*", cmd)
-		if sequence, exists := m.sequences[wildcardKey]; exists && len(sequence) > 0 {
-			index := m.sequenceIndexes[wildcardKey]
-			response := sequence[index]
-			m.sequenceIndexes[wildcardKey] = (index + 1) % len(sequence)
-			return response
+		if response, ok := m.findSequenceResponse(cmd, args); ok {
+			return response, true
 		}
 	}
 
@@ -272,29 +732,75 @@ func (m *MockRedisOp) findResponse(cmd string, args []interface{}) MockResponse
 	if len(args) > 0 {
 		key := fmt.Sprintf("%s:%v", cmd, args[0])
 		if response, exists := m.responses[key]; exists {
-			return response
+			return response, true
+		}
+
+		// Try glob static responses
+		if key, ok := m.matchGlobKey(cmd, args[0], m.responsesKeys()); ok {
+			return m.responses[key], true
 		}
 
 		// Try wildcard static response
 		wildcardKey := fmt.Sprintf("%s:*", cmd)
 		if response, exists := m.responses[wildcardKey]; exists {
-			return response
+			return response, true
 		}
 	}
 
 	// 4. Command without key (like PING)
 	noKeyResponse := fmt.Sprintf("%s:", cmd)
 	if response, exists := m.responses[noKeyResponse]; exists {
-		return response
+		return response, true
 	}
 
-	// 5. Return default error or not found
-	if m.defaultError != nil {
-		return MockResponse{Error: m.defaultError}
+	return MockResponse{}, false
+}
+
+func (m *MockRedisOp) responsesKeys() []string {
+	keys := make([]string, 0, len(m.responses))
+	for key := range m.responses {
+		keys = append(keys, key)
 	}
 
-	// Default: return nil for unconfigured responses (allows test flexibility)
-	return MockResponse{Data: nil, Error: nil}
+	return keys
+}
+
+func (m *MockRedisOp) sequencesKeys() []string {
+	keys := make([]string, 0, len(m.sequences))
+	for key := range m.sequences {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// matchGlobKey finds the configured "cmd:pattern" key whose glob pattern matches arg.
+// The longest pattern wins so more specific patterns take precedence.
+func (m *MockRedisOp) matchGlobKey(cmd string, arg interface{}, keys []string) (string, bool) {
+	prefix := cmd + ":"
+	var candidates []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) && mockIsGlobPattern(key[len(prefix):]) {
+			candidates = append(candidates, key)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i]) != len(candidates[j]) {
+			return len(candidates[i]) > len(candidates[j])
+		}
+
+		return candidates[i] < candidates[j]
+	})
+
+	name := mockArgString(arg)
+	for _, key := range candidates {
+		if mockGlobMatch(key[len(prefix):], name) {
+			return key, true
+		}
+	}
+
+	return "", false
 }
 
 // Connection and pool management methods
@@ -304,6 +810,27 @@ func (m *MockRedisOp) Meta() secret.RedisMeta {
 	return m.meta
 }
 
+// Cluster reports whether the mock simulates a cluster, see SetClusterMode.
+func (m *MockRedisOp) Cluster() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.cluster
+}
+
+// SetClusterMode makes the mock simulate a cluster, failing the multi-key commands whose keys hash to different
+// slots with the CROSSSLOT error of the server.
+func (m *MockRedisOp) SetClusterMode(enabled bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cluster = enabled
+}
+
+// crossSlot reports whether the mock simulates a cluster and the keys of cmd hash to different slots.
+func (m *MockRedisOp) crossSlot(cmd string, args []interface{}) bool {
+	slot := -1
+	return m.Cluster() && redisCheckSlot(&slot, cmd, args) != nil
+}
+
 func (m *MockRedisOp) ActiveCount() int {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -320,16 +847,142 @@ func (m *MockRedisOp) Close() error {
 	return nil
 }
 
+// Codec returns the Codec set with SetCodec, DefaultRedisCodec when none is set.
+func (m *MockRedisOp) Codec() Codec {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.codec == nil {
+		return DefaultRedisCodec
+	}
+
+	return m.codec
+}
+
+// SetCodec sets the Codec used by the typed helpers on this mock.
+func (m *MockRedisOp) SetCodec(codec Codec) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.codec = codec
+}
+
+// Encryption returns the RedisEncryption set with SetEncryption.
+func (m *MockRedisOp) Encryption() *RedisEncryption {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.crypt
+}
+
+// SetEncryption sets the RedisEncryption used by the typed helpers on this mock.
+func (m *MockRedisOp) SetEncryption(encryption *RedisEncryption) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.crypt = encryption
+}
+
+// CommandGuard returns the RedisCommandGuard set with SetCommandGuard.
+func (m *MockRedisOp) CommandGuard() *RedisCommandGuard {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.guard
+}
+
+// SetCommandGuard restricts the commands of this mock, rejected commands are not recorded like RedisOp does not
+// send them.
+func (m *MockRedisOp) SetCommandGuard(guard *RedisCommandGuard) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.guard = guard
+}
+
 // Pipeline operations
 func (m *MockRedisOp) Do(cmd string, args ...interface{}) *RedisResponse {
 	return m.mockDo(cmd, args...)
 }
 
+// DoWithTimeout behaves like Do, the timeout is not simulated.
+func (m *MockRedisOp) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) *RedisResponse {
+	return m.mockDo(cmd, args...)
+}
+
 func (m *MockRedisOp) Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse {
+	return m.pipeline("PIPELINE", cmds)
+}
+
+// PipelineWithOptions behaves like Pipeline; transactional batches are configured and
+// recorded under the "TXPIPELINE" command instead of "PIPELINE".
+func (m *MockRedisOp) PipelineWithOptions(opts RedisPipelineOptions, cmds ...RedisPipelineCmd) []*RedisResponse {
+	if opts.Transaction {
+		return m.pipeline("TXPIPELINE", cmds)
+	}
+
+	return m.pipeline("PIPELINE", cmds)
+}
+
+// PipelineCtx fails every response with the error of ctx when it is already done, like a pipeline whose deadline
+// elapsed before the connection was checked out.
+func (m *MockRedisOp) PipelineCtx(ctx context.Context, cmds ...RedisPipelineCmd) []*RedisResponse {
+	return m.pipelineCtx(ctx, RedisPipelineOptions{}, cmds)
+}
+
+func (m *MockRedisOp) ExecCtx(ctx context.Context, f func(tx *RedisTx) error) ([]*RedisResponse, error) {
+	tx := &RedisTx{}
+	if err := f(tx); err != nil {
+		return nil, err
+	}
+
+	return m.pipelineCtx(ctx, RedisPipelineOptions{Transaction: true}, tx.cmds), nil
+}
+
+func (m *MockRedisOp) pipelineCtx(ctx context.Context, opts RedisPipelineOptions, cmds []RedisPipelineCmd) []*RedisResponse {
+	if err := ctx.Err(); err != nil && len(cmds) > 0 {
+		err = classifyError("redis", "pipeline", err)
+		responses := make([]*RedisResponse, len(cmds))
+		for i := range responses {
+			responses[i] = &RedisResponse{Error: err}
+		}
+
+		return responses
+	}
+
+	return m.PipelineWithOptions(opts, cmds...)
+}
+
+func (m *MockRedisOp) pipeline(command string, cmds []RedisPipelineCmd) []*RedisResponse {
+	if err := m.CommandGuard().checkAll(cmds); err != nil {
+		responses := make([]*RedisResponse, len(cmds))
+		for i := range responses {
+			responses[i] = &RedisResponse{Error: err}
+		}
+
+		return responses
+	}
+
 	timestamp := time.Now()
 
-	// Try to find a configured PIPELINE response first
-	pipelineResponse := m.findResponse("PIPELINE", []interface{}{})
+	// An injected fault fails the whole pipeline like a broken connection
+	delay, chaosErr := m.injectChaos()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if chaosErr != nil {
+		responses := make([]*RedisResponse, len(cmds))
+		for i := range responses {
+			responses[i] = &RedisResponse{Error: chaosErr}
+		}
+
+		record := m.newCallRecord(timestamp, command, []interface{}{cmds})
+		record.Response = responses
+		record.Error = chaosErr
+
+		m.mutex.Lock()
+		m.appendCallRecord(record)
+		m.mutex.Unlock()
+		return responses
+	}
+
+	// Try to find a configured pipeline response first
+	pipelineResponse := m.findResponse(command, []interface{}{})
 
 	var responses []*RedisResponse
 
@@ -361,6 +1014,11 @@ func (m *MockRedisOp) Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse {
 		// Fallback: create responses for each individual command
 		responses = make([]*RedisResponse, len(cmds))
 		for i, cmd := range cmds {
+			if m.crossSlot(cmd.Cmd, cmd.Args) {
+				responses[i] = &RedisResponse{Error: ErrMockCrossSlot}
+				continue
+			}
+
 			response := m.findResponse(cmd.Cmd, cmd.Args)
 
 			if response.Error != nil {
@@ -374,17 +1032,13 @@ func (m *MockRedisOp) Pipeline(cmds ...RedisPipelineCmd) []*RedisResponse {
 		}
 	}
 
-	// Record a single PIPELINE call in history
-	record := MockCallRecord{
-		Timestamp: timestamp,
-		Command:   "PIPELINE",
-		Args:      []interface{}{cmds},
-		Response:  responses,
-		Error:     pipelineResponse.Error,
-	}
+	// Record a single pipeline call in history
+	record := m.newCallRecord(timestamp, command, []interface{}{cmds})
+	record.Response = responses
+	record.Error = pipelineResponse.Error
 
 	m.mutex.Lock()
-	m.callHistory = append(m.callHistory, record)
+	m.appendCallRecord(record)
 	m.mutex.Unlock()
 
 	return responses
@@ -400,40 +1054,17 @@ func (m *MockRedisOp) Set(key interface{}, val interface{}) *RedisResponse {
 }
 
 func (m *MockRedisOp) SetWithOptions(key interface{}, val interface{}, opts SetOptions) *RedisResponse {
-	args := []interface{}{key, val}
-
-	// Add condition options (mutually exclusive)
-	if opts.NX {
-		args = append(args, "NX")
-	} else if opts.XX {
-		args = append(args, "XX")
-	}
-
-	// Add GET option
-	if opts.GET {
-		args = append(args, "GET")
-	}
-
-	// Add expiration options (mutually exclusive)
-	if opts.EX > 0 {
-		args = append(args, "EX", opts.EX)
-	} else if opts.PX > 0 {
-		args = append(args, "PX", opts.PX)
-	} else if opts.EXAT > 0 {
-		args = append(args, "EXAT", opts.EXAT)
-	} else if opts.PXAT > 0 {
-		args = append(args, "PXAT", opts.PXAT)
-	} else if opts.KEEPTTL {
-		args = append(args, "KEEPTTL")
-	}
-
-	return m.mockDo("SET", args...)
+	return m.mockDo("SET", setArgs(key, val, opts)...)
 }
 
 func (m *MockRedisOp) SetExpire(key interface{}, val interface{}, ttl int64) *RedisResponse {
 	return m.mockDo("SETEX", key, ttl, val)
 }
 
+func (m *MockRedisOp) SetExpireJitter(key interface{}, val interface{}, ttl int64, jitterFraction float64) *RedisResponse {
+	return m.mockDo("SETEX", key, jitterTTL(ttl, jitterFraction), val)
+}
+
 func (m *MockRedisOp) SetNX(key interface{}, val interface{}) *RedisResponse {
 	return m.mockDo("SETNX", key, val)
 }
@@ -476,17 +1107,15 @@ func (m *MockRedisOp) SetRange(key interface{}, offset int64, val interface{}) *
 
 // Hash operations
 func (m *MockRedisOp) HMSet(key interface{}, val map[interface{}]interface{}) *RedisResponse {
-	args := []interface{}{key}
-	for mk, mv := range val {
-		args = append(args, mk, mv)
-	}
-	return m.mockDo("HMSET", args...)
+	return hmSet(m, key, redisHashPairs(val))
+}
+
+func (m *MockRedisOp) HMSetOrdered(key interface{}, pairs [][2]interface{}) *RedisResponse {
+	return hmSet(m, key, pairs)
 }
 
 func (m *MockRedisOp) HMGet(key interface{}, field ...interface{}) *RedisResponse {
-	args := []interface{}{key}
-	args = append(args, field...)
-	return m.mockDo("HMGET", args...)
+	return hmGet(m, key, field)
 }
 
 func (m *MockRedisOp) HSet(key, field, val interface{}) *RedisResponse {
@@ -542,11 +1171,83 @@ func (m *MockRedisOp) HScan(key interface{}, cursor int64, match string, count i
 	return m.mockDo("HSCAN", args...)
 }
 
+func (m *MockRedisOp) HRandField(key interface{}) *RedisResponse {
+	return m.mockDo("HRANDFIELD", key)
+}
+
+func (m *MockRedisOp) HRandFieldN(key interface{}, count int64, withValues bool) *RedisResponse {
+	args := []interface{}{key, count}
+	if withValues {
+		args = append(args, "WITHVALUES")
+	}
+	return m.mockDo("HRANDFIELD", args...)
+}
+
+func (m *MockRedisOp) HStrLen(key, field interface{}) *RedisResponse {
+	return m.mockDo("HSTRLEN", key, field)
+}
+
 // Key operations
 func (m *MockRedisOp) Expire(key interface{}, ttl int64) *RedisResponse {
 	return m.mockDo("EXPIRE", key, ttl)
 }
 
+func (m *MockRedisOp) ExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, ttl, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return m.mockDo("EXPIRE", args...)
+}
+
+func (m *MockRedisOp) PExpire(key interface{}, ttl int64) *RedisResponse {
+	return m.mockDo("PEXPIRE", key, ttl)
+}
+
+func (m *MockRedisOp) PExpireWithOptions(key interface{}, ttl int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, ttl, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return m.mockDo("PEXPIRE", args...)
+}
+
+func (m *MockRedisOp) ExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return m.mockDo("EXPIREAT", key, timestamp)
+}
+
+func (m *MockRedisOp) ExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, timestamp, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return m.mockDo("EXPIREAT", args...)
+}
+
+func (m *MockRedisOp) PExpireAt(key interface{}, timestamp int64) *RedisResponse {
+	return m.mockDo("PEXPIREAT", key, timestamp)
+}
+
+func (m *MockRedisOp) PExpireAtWithOptions(key interface{}, timestamp int64, opts ExpireOptions) *RedisResponse {
+	args, err := expireArgs(key, timestamp, opts)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return m.mockDo("PEXPIREAT", args...)
+}
+
+func (m *MockRedisOp) ExpireTime(key interface{}) *RedisResponse {
+	return m.mockDo("EXPIRETIME", key)
+}
+
+func (m *MockRedisOp) PExpireTime(key interface{}) *RedisResponse {
+	return m.mockDo("PEXPIRETIME", key)
+}
+
 func (m *MockRedisOp) Delete(key ...interface{}) *RedisResponse {
 	return m.mockDo("DEL", key...)
 }
@@ -567,6 +1268,19 @@ func (m *MockRedisOp) Dump(key interface{}) *RedisResponse {
 	return m.mockDo("DUMP", key)
 }
 
+func (m *MockRedisOp) Restore(key interface{}, ttl int64, payload []byte, replace bool) *RedisResponse {
+	args := []interface{}{key, ttl, payload}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+
+	return m.mockDo("RESTORE", args...)
+}
+
+func (m *MockRedisOp) Migrate(host string, port uint, key interface{}, db int, timeout int64, opts MigrateOptions) *RedisResponse {
+	return m.mockDo("MIGRATE", migrateArgs(host, port, key, db, timeout, opts)...)
+}
+
 func (m *MockRedisOp) TTL(key interface{}) *RedisResponse {
 	return m.mockDo("TTL", key)
 }
@@ -599,6 +1313,16 @@ func (m *MockRedisOp) Unlink(key ...interface{}) *RedisResponse {
 	return m.mockDo("UNLINK", key...)
 }
 
+func (m *MockRedisOp) DeleteByPattern(pattern string, batchSize int64) *RedisResponse {
+	return m.DeleteByPatternWithOptions(pattern, DeleteByPatternOptions{BatchSize: batchSize})
+}
+
+func (m *MockRedisOp) DeleteByPatternWithOptions(pattern string, opts DeleteByPatternOptions) *RedisResponse {
+	return deleteByPattern(m, []redisScanner{func(args ...interface{}) *RedisResponse {
+		return m.Do("SCAN", args...)
+	}}, pattern, opts)
+}
+
 func (m *MockRedisOp) Persist(key interface{}) *RedisResponse {
 	return m.mockDo("PERSIST", key)
 }
@@ -635,10 +1359,18 @@ func (m *MockRedisOp) LPop(key interface{}) *RedisResponse {
 	return m.mockDo("LPOP", key)
 }
 
+func (m *MockRedisOp) LPopN(key interface{}, count int64) *RedisResponse {
+	return m.mockDo("LPOP", key, count)
+}
+
 func (m *MockRedisOp) LPos(key, element interface{}) *RedisResponse {
 	return m.mockDo("LPOS", key, element)
 }
 
+func (m *MockRedisOp) LPosWithOptions(key, element interface{}, opts LPosOptions) *RedisResponse {
+	return m.mockDo("LPOS", lposArgs(key, element, opts)...)
+}
+
 func (m *MockRedisOp) LPush(key interface{}, val ...interface{}) *RedisResponse {
 	args := []interface{}{key}
 	args = append(args, val...)
@@ -671,6 +1403,10 @@ func (m *MockRedisOp) RPop(key interface{}) *RedisResponse {
 	return m.mockDo("RPOP", key)
 }
 
+func (m *MockRedisOp) RPopN(key interface{}, count int64) *RedisResponse {
+	return m.mockDo("RPOP", key, count)
+}
+
 func (m *MockRedisOp) RPopLPush(source, destination interface{}) *RedisResponse {
 	return m.mockDo("RPOPLPUSH", source, destination)
 }
@@ -751,6 +1487,14 @@ func (m *MockRedisOp) SRandMember(key interface{}) *RedisResponse {
 	return m.mockDo("SRANDMEMBER", key)
 }
 
+func (m *MockRedisOp) SPopN(key interface{}, count int64) *RedisResponse {
+	return m.mockDo("SPOP", key, count)
+}
+
+func (m *MockRedisOp) SRandMemberN(key interface{}, count int64) *RedisResponse {
+	return m.mockDo("SRANDMEMBER", key, count)
+}
+
 func (m *MockRedisOp) SRem(key interface{}, member ...interface{}) *RedisResponse {
 	args := []interface{}{key}
 	args = append(args, member...)
@@ -785,6 +1529,15 @@ func (m *MockRedisOp) ZAdd(key interface{}, score float64, member interface{}, p
 	return m.mockDo("ZADD", args...)
 }
 
+func (m *MockRedisOp) ZAddWithOptions(key interface{}, opts ZAddOptions, score float64, member interface{}, pairs ...interface{}) *RedisResponse {
+	args, err := zaddArgs(key, opts, score, member, pairs)
+	if err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return m.mockDo("ZADD", args...)
+}
+
 func (m *MockRedisOp) ZCard(key interface{}) *RedisResponse {
 	return m.mockDo("ZCARD", key)
 }
@@ -865,10 +1618,22 @@ func (m *MockRedisOp) ZRandMember(key interface{}) *RedisResponse {
 	return m.mockDo("ZRANDMEMBER", key)
 }
 
+func (m *MockRedisOp) ZRandMemberN(key interface{}, count int64, withScores bool) *RedisResponse {
+	args := []interface{}{key, count}
+	if withScores {
+		args = append(args, "WITHSCORES")
+	}
+	return m.mockDo("ZRANDMEMBER", args...)
+}
+
 func (m *MockRedisOp) ZRange(key interface{}, start, stop int64) *RedisResponse {
 	return m.mockDo("ZRANGE", key, start, stop)
 }
 
+func (m *MockRedisOp) ZRangeWithOptions(key interface{}, start, stop string, opts ZRangeOptions) *RedisResponse {
+	return m.mockDo("ZRANGE", zrangeArgs(key, start, stop, opts)...)
+}
+
 func (m *MockRedisOp) ZRangeByLex(key interface{}, min, max string) *RedisResponse {
 	return m.mockDo("ZRANGEBYLEX", key, min, max)
 }
@@ -968,6 +1733,22 @@ func (m *MockRedisOp) Scan(cursor int64, match string, count int64) *RedisRespon
 	return m.mockDo("SCAN", args...)
 }
 
+func (m *MockRedisOp) ScanTyped(cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(m.mockDo("SCAN", scanArgs(nil, cursor, match, count)...))
+}
+
+func (m *MockRedisOp) HScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(m.mockDo("HSCAN", scanArgs([]interface{}{key}, cursor, match, count)...))
+}
+
+func (m *MockRedisOp) SScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(m.mockDo("SSCAN", scanArgs([]interface{}{key}, cursor, match, count)...))
+}
+
+func (m *MockRedisOp) ZScanTyped(key interface{}, cursor int64, match string, count int64) (*ScanResult, error) {
+	return newScanResult(m.mockDo("ZSCAN", scanArgs([]interface{}{key}, cursor, match, count)...))
+}
+
 func (m *MockRedisOp) Ping() *RedisResponse {
 	return m.mockDo("PING")
 }
@@ -976,6 +1757,76 @@ func (m *MockRedisOp) Publish(key interface{}, val interface{}) *RedisResponse {
 	return m.mockDo("PUBLISH", key, val)
 }
 
+// Subscribe records a SUBSCRIBE call, an error response fails the subscription.
+// In stateful mode the channel receives what is published on the shared data set,
+// otherwise it only receives the subscription confirmations.
+func (m *MockRedisOp) Subscribe(ctx context.Context, channels ...string) (<-chan *RedisMessage, error) {
+	args := make([]interface{}, len(channels))
+	for i, channel := range channels {
+		args[i] = channel
+	}
+
+	if resp := m.mockDo("SUBSCRIBE", args...); resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	m.mutex.RLock()
+	store := m.store
+	m.mutex.RUnlock()
+	if store == nil {
+		store = newMockRedisStore()
+	}
+
+	subscriber := store.subscribe(channels)
+	messages := make(chan *RedisMessage)
+	go func() {
+		defer close(messages)
+		defer store.unsubscribe(subscriber)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message := <-subscriber.messages:
+				select {
+				case messages <- message:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages, nil
+}
+
+// Connection operations
+func (m *MockRedisOp) ClientList() *RedisResponse {
+	return m.mockDo("CLIENT", "LIST")
+}
+
+func (m *MockRedisOp) ClientKill(args ...interface{}) *RedisResponse {
+	cmdArgs := []interface{}{"KILL"}
+	cmdArgs = append(cmdArgs, args...)
+	return m.mockDo("CLIENT", cmdArgs...)
+}
+
+func (m *MockRedisOp) ClientGetName() *RedisResponse {
+	return m.mockDo("CLIENT", "GETNAME")
+}
+
+func (m *MockRedisOp) ClientSetName(name string) *RedisResponse {
+	return m.mockDo("CLIENT", "SETNAME", name)
+}
+
+// Replication operations
+func (m *MockRedisOp) Wait(numreplicas int64, timeout int64) *RedisResponse {
+	return m.mockDo("WAIT", numreplicas, timeout)
+}
+
+func (m *MockRedisOp) Failover(opts FailoverOptions) *RedisResponse {
+	return m.mockDo("FAILOVER", failoverArgs(opts)...)
+}
+
 // Script operations
 func (m *MockRedisOp) Eval(script string, keys []interface{}, args []interface{}) *RedisResponse {
 	numkeys := int64(len(keys))
@@ -985,11 +1836,46 @@ func (m *MockRedisOp) Eval(script string, keys []interface{}, args []interface{}
 	return m.mockDo("EVAL", cmdArgs...)
 }
 
+// EvalSha runs the behavior set with SetScript for sha, it fails with NOSCRIPT when no behavior is set and the
+// script was not loaded with ScriptLoad.
+func (m *MockRedisOp) EvalSha(sha string, keys []interface{}, args []interface{}) *RedisResponse {
+	cmdArgs := []interface{}{sha, int64(len(keys))}
+	cmdArgs = append(cmdArgs, keys...)
+	cmdArgs = append(cmdArgs, args...)
+	return m.mockDo("EVALSHA", cmdArgs...)
+}
+
+// ScriptLoad returns the SHA1 digest of script, like the server does.
+func (m *MockRedisOp) ScriptLoad(script string) *RedisResponse {
+	return m.mockDo("SCRIPT", "LOAD", script)
+}
+
 // NewMockRedis creates a Redis instance with mock operators for testing.
 // This allows full testing of Redis operations without requiring a real Redis server.
 func NewMockRedis() *Redis {
 	mockMaster := NewMockRedisOp()
 	mockSlave := NewMockRedisOp()
+	if DefaultRedisSlaveReadOnly {
+		mockSlave.SetCommandGuard(mockSlave.CommandGuard().WithReadOnly())
+	}
+
+	return &Redis{
+		name:   "mock",
+		master: mockMaster,
+		slave:  mockSlave,
+	}
+}
+
+// NewStatefulMockRedis creates a Redis instance whose master and slave mocks share one in-memory data set,
+// so values written through Master() are readable through Slave() like on a replicated server.
+func NewStatefulMockRedis() *Redis {
+	mockMaster := NewMockRedisOp()
+	mockSlave := NewMockRedisOp()
+	mockMaster.EnableStatefulMode()
+	mockSlave.shareStore(mockMaster)
+	if DefaultRedisSlaveReadOnly {
+		mockSlave.SetCommandGuard(mockSlave.CommandGuard().WithReadOnly())
+	}
 
 	return &Redis{
 		name:   "mock",
@@ -0,0 +1,89 @@
+package datastore
+
+import (
+	"sync"
+	"time"
+)
+
+// MockClock is a clock moved by the tests, making the TTLs of the stateful mock and the outages of EnableChaos
+// deterministic, see MockRedisOp.SetClock.
+type MockClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewMockClock returns a clock stopped at now.
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *MockClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now.
+func (c *MockClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d.
+func (c *MockClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetClock makes the TTLs of the stateful data set and the outages of EnableChaos follow clock, nil restores the
+// wall clock. Mocks sharing a data set, like the master and slave of NewMockRedis, should share the clock.
+func (m *MockRedisOp) SetClock(clock *MockClock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.clock = clock
+	if m.store != nil {
+		m.store.setNow(m.nowFunc())
+	}
+
+	if m.chaos != nil {
+		m.chaos.setNow(m.nowFunc())
+	}
+}
+
+// Clock returns the clock set with SetClock, nil when the mock follows the wall clock.
+func (m *MockRedisOp) Clock() *MockClock {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.clock
+}
+
+// Advance moves the clock of the mock forward by d, first stopping a clock at the current time when none is set.
+// The keys of the stateful data set whose TTL elapsed are expired, and their "expired" keyspace and keyevent
+// notifications published to the subscribers of __keyspace@0__:<key> and __keyevent@0__:expired.
+func (m *MockRedisOp) Advance(d time.Duration) {
+	clock := m.Clock()
+	if clock == nil {
+		clock = NewMockClock(time.Now())
+		m.SetClock(clock)
+	}
+
+	clock.Advance(d)
+	m.mutex.RLock()
+	store := m.store
+	m.mutex.RUnlock()
+	if store != nil {
+		store.expireDue()
+	}
+}
+
+// nowFunc returns the time source of the mock, the caller holds the mutex.
+func (m *MockRedisOp) nowFunc() func() time.Time {
+	if m.clock == nil {
+		return time.Now
+	}
+
+	return m.clock.Now
+}
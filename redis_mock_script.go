@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ErrMockNoScript is returned by EvalSha for a digest with no behavior that was not loaded, like the NOSCRIPT
+// error of the server.
+var ErrMockNoScript = errors.New("NOSCRIPT No matching script. Please use EVAL.")
+
+// MockScriptFunc simulates a Lua script, called with the KEYS and ARGV of the call as strings. Its reply is
+// returned by Eval and EvalSha, a nil reply without error surfaces as RedisNotFound like a nil reply of a script.
+type MockScriptFunc func(keys []string, args []string) (interface{}, error)
+
+// mockScriptSHA returns the SHA1 digest identifying script on the server.
+func mockScriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// mockIsScriptSHA reports whether s is a SHA1 digest rather than a script body.
+func mockIsScriptSHA(s string) bool {
+	if len(s) != sha1.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// SetScript runs fn for the Eval calls of the script and the EvalSha calls of its digest. script is the Lua body or
+// its SHA1 digest, a nil fn removes the behavior. Responses set for EVAL or EVALSHA with SetResponse and the other
+// setters take precedence over the behaviors.
+func (m *MockRedisOp) SetScript(script string, fn MockScriptFunc) {
+	sha := strings.ToLower(script)
+	if !mockIsScriptSHA(sha) {
+		sha = mockScriptSHA(script)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if fn == nil {
+		delete(m.scripts, sha)
+		return
+	}
+
+	if m.scripts == nil {
+		m.scripts = map[string]MockScriptFunc{}
+	}
+
+	m.scripts[sha] = fn
+}
+
+// findScriptResponse runs the behavior of the script of EVAL and EVALSHA calls, and simulates SCRIPT LOAD.
+func (m *MockRedisOp) findScriptResponse(cmd string, args []interface{}) (MockResponse, bool) {
+	cmd = strings.ToUpper(cmd)
+	if cmd == "SCRIPT" && len(args) == 2 && strings.EqualFold(mockArgString(args[0]), "LOAD") {
+		sha := mockScriptSHA(mockArgString(args[1]))
+		m.mutex.Lock()
+		if m.loadedScripts == nil {
+			m.loadedScripts = map[string]bool{}
+		}
+
+		m.loadedScripts[sha] = true
+		m.mutex.Unlock()
+		return MockResponse{Data: sha}, true
+	}
+
+	if (cmd != "EVAL" && cmd != "EVALSHA") || len(args) < 2 {
+		return MockResponse{}, false
+	}
+
+	sha := strings.ToLower(mockArgString(args[0]))
+	if cmd == "EVAL" {
+		sha = mockScriptSHA(mockArgString(args[0]))
+	}
+
+	m.mutex.RLock()
+	fn, ok := m.scripts[sha]
+	loaded := m.loadedScripts[sha]
+	m.mutex.RUnlock()
+	if !ok {
+		if cmd == "EVALSHA" && !loaded {
+			return MockResponse{Error: ErrMockNoScript}, true
+		}
+
+		return MockResponse{}, false
+	}
+
+	numKeys, err := strconv.Atoi(mockArgString(args[1]))
+	if err != nil || numKeys < 0 || numKeys > len(args)-2 {
+		return MockResponse{Error: errors.New("ERR Number of keys can't be greater than number of args")}, true
+	}
+
+	strs := make([]string, len(args)-2)
+	for i, arg := range args[2:] {
+		strs[i] = mockArgString(arg)
+	}
+
+	data, err := fn(strs[:numKeys:numKeys], strs[numKeys:])
+	if err == nil && data == nil {
+		err = RedisNotFound
+	}
+
+	return MockResponse{Data: data, Error: err}, true
+}
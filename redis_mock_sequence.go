@@ -0,0 +1,112 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMockOutOfOrder is returned for a call of a sequence set WithStrictOrder that is not the next configured step.
+var ErrMockOutOfOrder = errors.New("mock: call out of the configured order")
+
+// MockSequenceOption configures a sequence of SetSequentialResponses.
+type MockSequenceOption func(sequence *mockSequence)
+
+// WithStrictOrder makes the responses of the sequence steps of one order shared by every strict sequence of the
+// mock, in the order they were set. A call of a strict sequence that is not the next step, or comes once every
+// step was taken, fails with ErrMockOutOfOrder and is reported by AssertExpectations, as are the steps not taken.
+// Setting a strict sequence again for the same pattern appends its responses, so commands can be interleaved:
+//
+//	mock.SetSequentialResponses("GET", "k", []MockResponse{{Data: "a"}}, WithStrictOrder())
+//	mock.SetSequentialResponses("SET", "k", []MockResponse{{Data: "OK"}}, WithStrictOrder())
+//	mock.SetSequentialResponses("GET", "k", []MockResponse{{Data: "b"}}, WithStrictOrder())
+func WithStrictOrder() MockSequenceOption {
+	return func(sequence *mockSequence) {
+		sequence.strict = true
+	}
+}
+
+// mockSequence hands out the responses of a sequence in order, guarded by the mutex of the mock so each response
+// is taken by exactly one call whatever the goroutines issuing them.
+type mockSequence struct {
+	responses []MockResponse
+	next      int
+	// cycle restarts the wildcard sequences once exhausted, the others stay at their last response
+	cycle  bool
+	strict bool
+}
+
+// take returns the next response of the sequence.
+func (s *mockSequence) take() MockResponse {
+	response := s.responses[s.next]
+	switch {
+	case s.next < len(s.responses)-1:
+		s.next++
+	case s.cycle:
+		s.next = 0
+	}
+
+	return response
+}
+
+// findSequenceResponse takes the next response of the sequence matching the call, the caller holds the mutex.
+func (m *MockRedisOp) findSequenceResponse(cmd string, args []interface{}) (MockResponse, bool) {
+	key, ok := m.matchSequenceKey(cmd, args[0])
+	if !ok {
+		return MockResponse{}, false
+	}
+
+	sequence := m.sequences[key]
+	if !sequence.strict {
+		return sequence.take(), true
+	}
+
+	if m.strictNext >= len(m.strictSteps) || m.strictSteps[m.strictNext] != key {
+		expected := "no further call"
+		if m.strictNext < len(m.strictSteps) {
+			expected = m.strictSteps[m.strictNext]
+		}
+
+		err := fmt.Errorf("%w: %s %v, expected %s", ErrMockOutOfOrder, cmd, args, expected)
+		m.orderViolations = append(m.orderViolations, MockCallRecord{Timestamp: time.Now(), Command: cmd, Args: args, Error: err})
+		return MockResponse{Error: err}, true
+	}
+
+	m.strictNext++
+	return sequence.take(), true
+}
+
+// matchSequenceKey finds the sequence of the exact key, the longest matching glob pattern or "*", in that order.
+func (m *MockRedisOp) matchSequenceKey(cmd string, arg interface{}) (string, bool) {
+	key := fmt.Sprintf("%s:%v", cmd, arg)
+	if sequence, ok := m.sequences[key]; ok && len(sequence.responses) > 0 {
+		return key, true
+	}
+
+	if key, ok := m.matchGlobKey(cmd, arg, m.sequencesKeys()); ok && len(m.sequences[key].responses) > 0 {
+		return key, true
+	}
+
+	key = fmt.Sprintf("%s:*", cmd)
+	if sequence, ok := m.sequences[key]; ok && len(sequence.responses) > 0 {
+		return key, true
+	}
+
+	return "", false
+}
+
+// assertStrictOrder reports the calls out of the strict order and the steps not taken, the caller holds the mutex.
+func (m *MockRedisOp) assertStrictOrder(t MockTestingT) bool {
+	ok := true
+	for _, call := range m.orderViolations {
+		t.Errorf("%s", call.Error)
+		ok = false
+	}
+
+	if m.strictNext < len(m.strictSteps) {
+		t.Errorf("mock: %d steps of the configured order not called, next %s", len(m.strictSteps)-m.strictNext, m.strictSteps[m.strictNext])
+		ok = false
+	}
+
+	return ok
+}
@@ -0,0 +1,2173 @@
+package datastore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	mockErrWrongType   = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	mockErrNotInteger  = errors.New("ERR value is not an integer or out of range")
+	mockErrNotFloat    = errors.New("ERR value is not a valid float")
+	mockErrSyntax      = errors.New("ERR syntax error")
+	mockErrNoSuchKey   = errors.New("ERR no such key")
+	mockErrOutOfRange  = errors.New("ERR index out of range")
+	mockErrWrongArgNum = errors.New("ERR wrong number of arguments")
+	mockErrBusyKey     = errors.New("BUSYKEY Target key name already exists.")
+	mockErrBadPayload  = errors.New("ERR DUMP payload version or checksum are wrong")
+)
+
+const (
+	mockTypeString = "string"
+	mockTypeHash   = "hash"
+	mockTypeList   = "list"
+	mockTypeSet    = "set"
+	mockTypeZSet   = "zset"
+)
+
+type mockRedisValue struct {
+	kind     string
+	str      string
+	hash     map[string]string
+	list     []string
+	set      map[string]struct{}
+	zset     map[string]float64
+	expireAt time.Time
+}
+
+// mockRedisStore keeps keys in memory and evaluates commands semantically for the stateful mock mode.
+// Replies use the same Go types as go-redis returns over RESP3, so RedisResponse accessors behave like
+// they do against a real server.
+type mockRedisStore struct {
+	mutex       sync.Mutex
+	data        map[string]*mockRedisValue
+	now         func() time.Time
+	subscribers map[*mockSubscriber]struct{}
+}
+
+// mockSubscriber receives the messages published to its channels, see MockRedisOp.Subscribe.
+type mockSubscriber struct {
+	channels map[string]bool
+	messages chan *RedisMessage
+}
+
+type mockStoreHandler func(s *mockRedisStore, args []string) (interface{}, error)
+
+// mockStoreCommands lists the commands evaluated by the stateful mock, others return an error.
+var mockStoreCommands map[string]mockStoreHandler
+
+func init() {
+	mockStoreCommands = map[string]mockStoreHandler{
+		// Strings
+		"GET":      (*mockRedisStore).get,
+		"SET":      (*mockRedisStore).set,
+		"SETEX":    func(s *mockRedisStore, args []string) (interface{}, error) { return s.setEx(args, "EX") },
+		"PSETEX":   func(s *mockRedisStore, args []string) (interface{}, error) { return s.setEx(args, "PX") },
+		"SETNX":    (*mockRedisStore).setNX,
+		"MSET":     (*mockRedisStore).mSet,
+		"MSETNX":   (*mockRedisStore).mSetNX,
+		"MGET":     (*mockRedisStore).mGet,
+		"INCR":     func(s *mockRedisStore, args []string) (interface{}, error) { return s.incrBy(args, 1, false) },
+		"DECR":     func(s *mockRedisStore, args []string) (interface{}, error) { return s.incrBy(args, -1, false) },
+		"INCRBY":   func(s *mockRedisStore, args []string) (interface{}, error) { return s.incrBy(args, 1, true) },
+		"DECRBY":   func(s *mockRedisStore, args []string) (interface{}, error) { return s.incrBy(args, -1, true) },
+		"APPEND":   (*mockRedisStore).append,
+		"STRLEN":   (*mockRedisStore).strLen,
+		"GETRANGE": (*mockRedisStore).getRange,
+		// Keys
+		"DEL":      (*mockRedisStore).del,
+		"UNLINK":   (*mockRedisStore).del,
+		"EXISTS":   (*mockRedisStore).exists,
+		"TOUCH":    (*mockRedisStore).exists,
+		"TYPE":     (*mockRedisStore).typeOf,
+		"MEMORY":   (*mockRedisStore).memory,
+		"KEYS":     (*mockRedisStore).keys,
+		"SCAN":     (*mockRedisStore).scan,
+		"DUMP":     (*mockRedisStore).dump,
+		"RESTORE":  (*mockRedisStore).restore,
+		"RENAME":   func(s *mockRedisStore, args []string) (interface{}, error) { return s.rename(args, false) },
+		"RENAMENX": func(s *mockRedisStore, args []string) (interface{}, error) { return s.rename(args, true) },
+		"EXPIRE":   func(s *mockRedisStore, args []string) (interface{}, error) { return s.expire(args, time.Second, false) },
+		"PEXPIRE": func(s *mockRedisStore, args []string) (interface{}, error) {
+			return s.expire(args, time.Millisecond, false)
+		},
+		"EXPIREAT": func(s *mockRedisStore, args []string) (interface{}, error) { return s.expire(args, time.Second, true) },
+		"PEXPIREAT": func(s *mockRedisStore, args []string) (interface{}, error) {
+			return s.expire(args, time.Millisecond, true)
+		},
+		"TTL": func(s *mockRedisStore, args []string) (interface{}, error) { return s.ttl(args, time.Second, false) },
+		"PTTL": func(s *mockRedisStore, args []string) (interface{}, error) {
+			return s.ttl(args, time.Millisecond, false)
+		},
+		"EXPIRETIME": func(s *mockRedisStore, args []string) (interface{}, error) { return s.ttl(args, time.Second, true) },
+		"PEXPIRETIME": func(s *mockRedisStore, args []string) (interface{}, error) {
+			return s.ttl(args, time.Millisecond, true)
+		},
+		"PERSIST":  (*mockRedisStore).persist,
+		"FLUSHDB":  (*mockRedisStore).flush,
+		"FLUSHALL": (*mockRedisStore).flush,
+		"DBSIZE":   (*mockRedisStore).dbSize,
+		"PING":     func(s *mockRedisStore, args []string) (interface{}, error) { return "PONG", nil },
+		"PUBLISH":  (*mockRedisStore).publish,
+		// The subscription itself is registered by MockRedisOp.Subscribe
+		"SUBSCRIBE": func(s *mockRedisStore, args []string) (interface{}, error) { return int64(len(args)), nil },
+		// Hashes
+		"HSET":    (*mockRedisStore).hSet,
+		"HMSET":   (*mockRedisStore).hSet,
+		"HSETNX":  (*mockRedisStore).hSetNX,
+		"HGET":    (*mockRedisStore).hGet,
+		"HMGET":   (*mockRedisStore).hMGet,
+		"HGETALL": (*mockRedisStore).hGetAll,
+		"HDEL":    (*mockRedisStore).hDel,
+		"HEXISTS": (*mockRedisStore).hExists,
+		"HLEN":    (*mockRedisStore).hLen,
+		"HKEYS":   (*mockRedisStore).hKeys,
+		"HVALS":   (*mockRedisStore).hVals,
+		"HINCRBY": (*mockRedisStore).hIncrBy,
+		"HSTRLEN": (*mockRedisStore).hStrLen,
+		// Lists
+		"LPUSH":  func(s *mockRedisStore, args []string) (interface{}, error) { return s.push(args, true, false) },
+		"RPUSH":  func(s *mockRedisStore, args []string) (interface{}, error) { return s.push(args, false, false) },
+		"LPUSHX": func(s *mockRedisStore, args []string) (interface{}, error) { return s.push(args, true, true) },
+		"RPUSHX": func(s *mockRedisStore, args []string) (interface{}, error) { return s.push(args, false, true) },
+		"LPOP":   func(s *mockRedisStore, args []string) (interface{}, error) { return s.pop(args, true) },
+		"RPOP":   func(s *mockRedisStore, args []string) (interface{}, error) { return s.pop(args, false) },
+		"LLEN":   (*mockRedisStore).lLen,
+		"LRANGE": (*mockRedisStore).lRange,
+		"LINDEX": (*mockRedisStore).lIndex,
+		"LSET":   (*mockRedisStore).lSet,
+		"LREM":   (*mockRedisStore).lRem,
+		"LTRIM":  (*mockRedisStore).lTrim,
+		// Sets
+		"SADD":       (*mockRedisStore).sAdd,
+		"SREM":       (*mockRedisStore).sRem,
+		"SPOP":       (*mockRedisStore).sPop,
+		"SMEMBERS":   (*mockRedisStore).sMembers,
+		"SISMEMBER":  (*mockRedisStore).sIsMember,
+		"SMISMEMBER": (*mockRedisStore).sMIsMember,
+		"SCARD":      (*mockRedisStore).sCard,
+		"SINTER":     func(s *mockRedisStore, args []string) (interface{}, error) { return s.sCombine(args, "inter") },
+		"SUNION":     func(s *mockRedisStore, args []string) (interface{}, error) { return s.sCombine(args, "union") },
+		"SDIFF":      func(s *mockRedisStore, args []string) (interface{}, error) { return s.sCombine(args, "diff") },
+		// Sorted sets
+		"ZADD":          (*mockRedisStore).zAdd,
+		"ZINCRBY":       (*mockRedisStore).zIncrBy,
+		"ZSCORE":        (*mockRedisStore).zScore,
+		"ZCARD":         (*mockRedisStore).zCard,
+		"ZREM":          (*mockRedisStore).zRem,
+		"ZCOUNT":        (*mockRedisStore).zCount,
+		"ZRANK":         func(s *mockRedisStore, args []string) (interface{}, error) { return s.zRank(args, false) },
+		"ZREVRANK":      func(s *mockRedisStore, args []string) (interface{}, error) { return s.zRank(args, true) },
+		"ZRANGE":        (*mockRedisStore).zRange,
+		"ZREVRANGE":     func(s *mockRedisStore, args []string) (interface{}, error) { return s.zRangeCompat(args, false, true) },
+		"ZRANGEBYSCORE": func(s *mockRedisStore, args []string) (interface{}, error) { return s.zRangeCompat(args, true, false) },
+		"ZREVRANGEBYSCORE": func(s *mockRedisStore, args []string) (interface{}, error) {
+			return s.zRangeCompat(args, true, true)
+		},
+	}
+}
+
+func newMockRedisStore() *mockRedisStore {
+	return &mockRedisStore{
+		data: map[string]*mockRedisValue{},
+		now:  time.Now,
+	}
+}
+
+// reset drops every key.
+func (s *mockRedisStore) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data = map[string]*mockRedisValue{}
+}
+
+// exec evaluates a command, a nil reply means the key or field does not exist.
+func (s *mockRedisStore) exec(cmd string, args []interface{}) (interface{}, error) {
+	handler, ok := mockStoreCommands[strings.ToUpper(cmd)]
+	if !ok {
+		return nil, fmt.Errorf("ERR stateful mock does not support command '%s'", cmd)
+	}
+
+	strArgs := make([]string, len(args))
+	for i, arg := range args {
+		strArgs[i] = mockArgString(arg)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return handler(s, strArgs)
+}
+
+// subscribe registers a subscriber of channels, its messages channel is closed by unsubscribe.
+func (s *mockRedisStore) subscribe(channels []string) *mockSubscriber {
+	subscriber := &mockSubscriber{channels: map[string]bool{}, messages: make(chan *RedisMessage, 100)}
+	for _, channel := range channels {
+		subscriber.channels[channel] = true
+		subscriber.messages <- &RedisMessage{Channel: channel, Subscribed: true}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = map[*mockSubscriber]struct{}{}
+	}
+
+	s.subscribers[subscriber] = struct{}{}
+	return subscriber
+}
+
+func (s *mockRedisStore) unsubscribe(subscriber *mockSubscriber) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.subscribers, subscriber)
+	close(subscriber.messages)
+}
+
+// publish delivers the message to the subscribers of the channel and returns their number.
+// Like go-redis does with slow readers, messages are dropped for subscribers whose buffer is full.
+func (s *mockRedisStore) publish(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	var receivers int64
+	for subscriber := range s.subscribers {
+		if !subscriber.channels[args[0]] {
+			continue
+		}
+
+		receivers++
+		select {
+		case subscriber.messages <- &RedisMessage{Channel: args[0], Payload: args[1]}:
+		default:
+		}
+	}
+
+	return receivers, nil
+}
+
+func mockArgString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func mockFormatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// lookup returns the live value at key, expiring it lazily.
+func (s *mockRedisStore) lookup(key string) *mockRedisValue {
+	value, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+
+	if !value.expireAt.IsZero() && !s.now().Before(value.expireAt) {
+		delete(s.data, key)
+		s.publish([]string{"__keyspace@0__:" + key, "expired"})
+		s.publish([]string{"__keyevent@0__:expired", key})
+		return nil
+	}
+
+	return value
+}
+
+func (s *mockRedisStore) setNow(now func() time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.now = now
+}
+
+// expireDue expires the keys whose TTL elapsed, like the active expiry of the server.
+func (s *mockRedisStore) expireDue() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	keys := make([]string, 0, len(s.data))
+	for key, value := range s.data {
+		if !value.expireAt.IsZero() {
+			keys = append(keys, key)
+		}
+	}
+
+	// expire in key order so the notifications are deterministic
+	sort.Strings(keys)
+	for _, key := range keys {
+		s.lookup(key)
+	}
+}
+
+func (s *mockRedisStore) lookupKind(key, kind string) (*mockRedisValue, error) {
+	value := s.lookup(key)
+	if value != nil && value.kind != kind {
+		return nil, mockErrWrongType
+	}
+
+	return value, nil
+}
+
+func (s *mockRedisStore) create(key, kind string) (*mockRedisValue, error) {
+	value, err := s.lookupKind(key, kind)
+	if err != nil || value != nil {
+		return value, err
+	}
+
+	value = &mockRedisValue{kind: kind}
+	switch kind {
+	case mockTypeHash:
+		value.hash = map[string]string{}
+	case mockTypeSet:
+		value.set = map[string]struct{}{}
+	case mockTypeZSet:
+		value.zset = map[string]float64{}
+	}
+
+	s.data[key] = value
+	return value, nil
+}
+
+// removeIfEmpty deletes container keys left without elements, as Redis does.
+func (s *mockRedisStore) removeIfEmpty(key string, value *mockRedisValue) {
+	if len(value.hash) == 0 && len(value.list) == 0 && len(value.set) == 0 && len(value.zset) == 0 && value.kind != mockTypeString {
+		delete(s.data, key)
+	}
+}
+
+func mockParseInt(v string) (int64, error) {
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, mockErrNotInteger
+	}
+
+	return i, nil
+}
+
+func mockParseFloat(v string) (float64, error) {
+	switch strings.ToLower(v) {
+	case "+inf", "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, mockErrNotFloat
+	}
+
+	return f, nil
+}
+
+func mockStrings(values []string) []interface{} {
+	reply := make([]interface{}, len(values))
+	for i, v := range values {
+		reply[i] = v
+	}
+
+	return reply
+}
+
+// mockIndexRange normalizes Redis start/stop indexes, ok is false for an empty range.
+func mockIndexRange(start, stop int64, length int) (int, int, bool) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+
+	if stop < 0 {
+		stop += n
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	if stop >= n {
+		stop = n - 1
+	}
+
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+
+	return int(start), int(stop), true
+}
+
+// String commands
+
+func (s *mockRedisStore) get(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeString)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	return value.str, nil
+}
+
+func (s *mockRedisStore) set(args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	key := args[0]
+	var nx, xx, get, keepTTL bool
+	var expireAt time.Time
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(args) {
+				return nil, mockErrSyntax
+			}
+
+			n, err := mockParseInt(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			i++
+			switch opt {
+			case "EX":
+				expireAt = s.now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				expireAt = s.now().Add(time.Duration(n) * time.Millisecond)
+			case "EXAT":
+				expireAt = time.Unix(n, 0)
+			case "PXAT":
+				expireAt = time.UnixMilli(n)
+			}
+		default:
+			return nil, mockErrSyntax
+		}
+	}
+
+	existing := s.lookup(key)
+	var old interface{}
+	if get && existing != nil {
+		if existing.kind != mockTypeString {
+			return nil, mockErrWrongType
+		}
+
+		old = existing.str
+	}
+
+	if (nx && existing != nil) || (xx && existing == nil) {
+		if get {
+			return old, nil
+		}
+
+		return nil, nil
+	}
+
+	value := &mockRedisValue{kind: mockTypeString, str: args[1], expireAt: expireAt}
+	if keepTTL && existing != nil {
+		value.expireAt = existing.expireAt
+	}
+
+	s.data[key] = value
+	if get {
+		return old, nil
+	}
+
+	return "OK", nil
+}
+
+func (s *mockRedisStore) setEx(args []string, unit string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	return s.set([]string{args[0], args[2], unit, args[1]})
+}
+
+func (s *mockRedisStore) setNX(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	if s.lookup(args[0]) != nil {
+		return int64(0), nil
+	}
+
+	s.data[args[0]] = &mockRedisValue{kind: mockTypeString, str: args[1]}
+	return int64(1), nil
+}
+
+func (s *mockRedisStore) mSet(args []string) (interface{}, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, mockErrWrongArgNum
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		s.data[args[i]] = &mockRedisValue{kind: mockTypeString, str: args[i+1]}
+	}
+
+	return "OK", nil
+}
+
+// mGet replies nil for the keys missing or not holding a string.
+func (s *mockRedisStore) mGet(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, mockErrWrongArgNum
+	}
+
+	reply := make([]interface{}, len(args))
+	for i, key := range args {
+		if value := s.lookup(key); value != nil && value.kind == mockTypeString {
+			reply[i] = value.str
+		}
+	}
+
+	return reply, nil
+}
+
+func (s *mockRedisStore) mSetNX(args []string) (interface{}, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, mockErrWrongArgNum
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		if s.lookup(args[i]) != nil {
+			return int64(0), nil
+		}
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		s.data[args[i]] = &mockRedisValue{kind: mockTypeString, str: args[i+1]}
+	}
+
+	return int64(1), nil
+}
+
+func (s *mockRedisStore) incrBy(args []string, sign int64, withDelta bool) (interface{}, error) {
+	delta := sign
+	if withDelta {
+		if len(args) != 2 {
+			return nil, mockErrWrongArgNum
+		}
+
+		n, err := mockParseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		delta = sign * n
+	} else if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	var current int64
+	if value != nil {
+		if current, err = mockParseInt(value.str); err != nil {
+			return nil, err
+		}
+	} else {
+		value = &mockRedisValue{kind: mockTypeString}
+		s.data[args[0]] = value
+	}
+
+	current += delta
+	value.str = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+func (s *mockRedisStore) append(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.create(args[0], mockTypeString)
+	if err != nil {
+		return nil, err
+	}
+
+	value.str += args[1]
+	return int64(len(value.str)), nil
+}
+
+func (s *mockRedisStore) strLen(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeString)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	return int64(len(value.str)), nil
+}
+
+func (s *mockRedisStore) getRange(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	start, err := mockParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := mockParseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeString)
+	if err != nil || value == nil {
+		return "", err
+	}
+
+	from, to, ok := mockIndexRange(start, stop, len(value.str))
+	if !ok {
+		return "", nil
+	}
+
+	return value.str[from : to+1], nil
+}
+
+// Key commands
+
+func (s *mockRedisStore) del(args []string) (interface{}, error) {
+	var count int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			delete(s.data, key)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *mockRedisStore) exists(args []string) (interface{}, error) {
+	var count int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *mockRedisStore) typeOf(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	if value := s.lookup(args[0]); value != nil {
+		return value.kind, nil
+	}
+
+	return "none", nil
+}
+
+// memory supports MEMORY USAGE, estimating the size as the key and payload bytes plus a fixed overhead per entry.
+func (s *mockRedisStore) memory(args []string) (interface{}, error) {
+	if len(args) < 2 || strings.ToUpper(args[0]) != "USAGE" {
+		return nil, mockErrSyntax
+	}
+
+	value := s.lookup(args[1])
+	if value == nil {
+		return nil, nil
+	}
+
+	const overhead = 16
+	size := int64(len(args[1]) + len(value.str) + 3*overhead)
+	for field, v := range value.hash {
+		size += int64(len(field) + len(v) + overhead)
+	}
+
+	for _, v := range value.list {
+		size += int64(len(v) + overhead)
+	}
+
+	for member := range value.set {
+		size += int64(len(member) + overhead)
+	}
+
+	for member := range value.zset {
+		size += int64(len(member) + 8 + overhead)
+	}
+
+	return size, nil
+}
+
+func (s *mockRedisStore) liveKeys(pattern string) []string {
+	var keys []string
+	for key := range s.data {
+		if s.lookup(key) != nil && (pattern == "" || mockGlobMatch(pattern, key)) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *mockRedisStore) keys(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	return mockStrings(s.liveKeys(args[0])), nil
+}
+
+// scan returns every matching key in a single page with cursor 0.
+func (s *mockRedisStore) scan(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, mockErrWrongArgNum
+	}
+
+	pattern := ""
+	for i := 1; i+1 < len(args); i += 2 {
+		if strings.ToUpper(args[i]) == "MATCH" {
+			pattern = args[i+1]
+		}
+	}
+
+	return []interface{}{"0", mockStrings(s.liveKeys(pattern))}, nil
+}
+
+// mockDumpPrefix starts the payloads of DUMP, the value encoded as mockDumpValue in JSON.
+const mockDumpPrefix = "mockdump:"
+
+type mockDumpValue struct {
+	Kind string             `json:"kind"`
+	Str  string             `json:"str,omitempty"`
+	Hash map[string]string  `json:"hash,omitempty"`
+	List []string           `json:"list,omitempty"`
+	Set  []string           `json:"set,omitempty"`
+	ZSet map[string]float64 `json:"zset,omitempty"`
+}
+
+// dump serializes the value without its TTL, like the server. The payload is only understood by the mock.
+func (s *mockRedisStore) dump(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value := s.lookup(args[0])
+	if value == nil {
+		return nil, nil
+	}
+
+	dump := mockDumpValue{Kind: value.kind, Str: value.str, Hash: value.hash, List: value.list, ZSet: value.zset}
+	for member := range value.set {
+		dump.Set = append(dump.Set, member)
+	}
+
+	sort.Strings(dump.Set)
+	bs, err := json.Marshal(dump)
+	if err != nil {
+		return nil, err
+	}
+
+	return mockDumpPrefix + string(bs), nil
+}
+
+// restore supports RESTORE key ttl payload [REPLACE] [ABSTTL] with the payloads of dump.
+func (s *mockRedisStore) restore(args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	ttl, err := mockParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var replace, absolute bool
+	for _, opt := range args[3:] {
+		switch strings.ToUpper(opt) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absolute = true
+		default:
+			return nil, mockErrSyntax
+		}
+	}
+
+	var dump mockDumpValue
+	payload, ok := strings.CutPrefix(args[2], mockDumpPrefix)
+	if !ok || json.Unmarshal([]byte(payload), &dump) != nil {
+		return nil, mockErrBadPayload
+	}
+
+	if !replace && s.lookup(args[0]) != nil {
+		return nil, mockErrBusyKey
+	}
+
+	value := &mockRedisValue{kind: dump.Kind, str: dump.Str, hash: dump.Hash, list: dump.List, zset: dump.ZSet}
+	if dump.Kind == mockTypeSet {
+		value.set = make(map[string]struct{}, len(dump.Set))
+		for _, member := range dump.Set {
+			value.set[member] = struct{}{}
+		}
+	}
+
+	switch {
+	case ttl > 0 && absolute:
+		value.expireAt = time.UnixMilli(ttl)
+	case ttl > 0:
+		value.expireAt = s.now().Add(time.Duration(ttl) * time.Millisecond)
+	}
+
+	s.data[args[0]] = value
+	return "OK", nil
+}
+
+func (s *mockRedisStore) rename(args []string, nx bool) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value := s.lookup(args[0])
+	if value == nil {
+		return nil, mockErrNoSuchKey
+	}
+
+	if nx {
+		if s.lookup(args[1]) != nil {
+			return int64(0), nil
+		}
+
+		delete(s.data, args[0])
+		s.data[args[1]] = value
+		return int64(1), nil
+	}
+
+	delete(s.data, args[0])
+	s.data[args[1]] = value
+	return "OK", nil
+}
+
+func (s *mockRedisStore) expire(args []string, unit time.Duration, absolute bool) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	n, err := mockParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	value := s.lookup(args[0])
+	if value == nil {
+		return int64(0), nil
+	}
+
+	var expireAt time.Time
+	if absolute {
+		expireAt = time.Unix(0, 0).Add(time.Duration(n) * unit)
+	} else {
+		expireAt = s.now().Add(time.Duration(n) * unit)
+	}
+
+	for _, opt := range args[2:] {
+		switch strings.ToUpper(opt) {
+		case "NX":
+			if !value.expireAt.IsZero() {
+				return int64(0), nil
+			}
+		case "XX":
+			if value.expireAt.IsZero() {
+				return int64(0), nil
+			}
+		case "GT":
+			// A key without expiry is treated as an infinite TTL
+			if value.expireAt.IsZero() || !expireAt.After(value.expireAt) {
+				return int64(0), nil
+			}
+		case "LT":
+			if !value.expireAt.IsZero() && !expireAt.Before(value.expireAt) {
+				return int64(0), nil
+			}
+		default:
+			return nil, mockErrSyntax
+		}
+	}
+
+	if !s.now().Before(expireAt) {
+		delete(s.data, args[0])
+		return int64(1), nil
+	}
+
+	value.expireAt = expireAt
+	return int64(1), nil
+}
+
+func (s *mockRedisStore) ttl(args []string, unit time.Duration, absolute bool) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value := s.lookup(args[0])
+	if value == nil {
+		return int64(-2), nil
+	}
+
+	if value.expireAt.IsZero() {
+		return int64(-1), nil
+	}
+
+	if absolute {
+		return value.expireAt.UnixNano() / int64(unit), nil
+	}
+
+	remaining := value.expireAt.Sub(s.now())
+	return int64((remaining + unit/2) / unit), nil
+}
+
+func (s *mockRedisStore) persist(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value := s.lookup(args[0])
+	if value == nil || value.expireAt.IsZero() {
+		return int64(0), nil
+	}
+
+	value.expireAt = time.Time{}
+	return int64(1), nil
+}
+
+func (s *mockRedisStore) flush(args []string) (interface{}, error) {
+	s.data = map[string]*mockRedisValue{}
+	return "OK", nil
+}
+
+func (s *mockRedisStore) dbSize(args []string) (interface{}, error) {
+	return int64(len(s.liveKeys(""))), nil
+}
+
+// Hash commands
+
+func (s *mockRedisStore) hSet(args []string) (interface{}, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.create(args[0], mockTypeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var added int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := value.hash[args[i]]; !ok {
+			added++
+		}
+
+		value.hash[args[i]] = args[i+1]
+	}
+
+	return added, nil
+}
+
+func (s *mockRedisStore) hSetNX(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.create(args[0], mockTypeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := value.hash[args[1]]; ok {
+		return int64(0), nil
+	}
+
+	value.hash[args[1]] = args[2]
+	return int64(1), nil
+}
+
+func (s *mockRedisStore) hGet(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeHash)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	if field, ok := value.hash[args[1]]; ok {
+		return field, nil
+	}
+
+	return nil, nil
+}
+
+func (s *mockRedisStore) hMGet(args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := make([]interface{}, len(args)-1)
+	for i, field := range args[1:] {
+		if value == nil {
+			continue
+		}
+
+		if v, ok := value.hash[field]; ok {
+			reply[i] = v
+		}
+	}
+
+	return reply, nil
+}
+
+func (s *mockRedisStore) hGetAll(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := map[interface{}]interface{}{}
+	if value != nil {
+		for k, v := range value.hash {
+			reply[k] = v
+		}
+	}
+
+	return reply, nil
+}
+
+func (s *mockRedisStore) hDel(args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeHash)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	var count int64
+	for _, field := range args[1:] {
+		if _, ok := value.hash[field]; ok {
+			delete(value.hash, field)
+			count++
+		}
+	}
+
+	s.removeIfEmpty(args[0], value)
+	return count, nil
+}
+
+func (s *mockRedisStore) hExists(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeHash)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	if _, ok := value.hash[args[1]]; ok {
+		return int64(1), nil
+	}
+
+	return int64(0), nil
+}
+
+func (s *mockRedisStore) hLen(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeHash)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	return int64(len(value.hash)), nil
+}
+
+func (s *mockRedisStore) hFields(key string, values bool) (interface{}, error) {
+	value, err := s.lookupKind(key, mockTypeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := []interface{}{}
+	if value == nil {
+		return reply, nil
+	}
+
+	fields := make([]string, 0, len(value.hash))
+	for field := range value.hash {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+	for _, field := range fields {
+		if values {
+			reply = append(reply, value.hash[field])
+		} else {
+			reply = append(reply, field)
+		}
+	}
+
+	return reply, nil
+}
+
+func (s *mockRedisStore) hKeys(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	return s.hFields(args[0], false)
+}
+
+func (s *mockRedisStore) hVals(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	return s.hFields(args[0], true)
+}
+
+func (s *mockRedisStore) hIncrBy(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	delta, err := mockParseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.create(args[0], mockTypeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var current int64
+	if field, ok := value.hash[args[1]]; ok {
+		if current, err = mockParseInt(field); err != nil {
+			return nil, errors.New("ERR hash value is not an integer")
+		}
+	}
+
+	current += delta
+	value.hash[args[1]] = strconv.FormatInt(current, 10)
+	return current, nil
+}
+
+func (s *mockRedisStore) hStrLen(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeHash)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	return int64(len(value.hash[args[1]])), nil
+}
+
+// List commands
+
+func (s *mockRedisStore) push(args []string, left, onlyExisting bool) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		if onlyExisting {
+			return int64(0), nil
+		}
+
+		value, _ = s.create(args[0], mockTypeList)
+	}
+
+	for _, element := range args[1:] {
+		if left {
+			value.list = append([]string{element}, value.list...)
+		} else {
+			value.list = append(value.list, element)
+		}
+	}
+
+	return int64(len(value.list)), nil
+}
+
+func (s *mockRedisStore) pop(args []string, left bool) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	count := int64(1)
+	if len(args) == 2 {
+		n, err := mockParseInt(args[1])
+		if err != nil || n < 0 {
+			return nil, mockErrOutOfRange
+		}
+
+		count = n
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	if count > int64(len(value.list)) {
+		count = int64(len(value.list))
+	}
+
+	popped := make([]string, count)
+	for i := range popped {
+		if left {
+			popped[i] = value.list[0]
+			value.list = value.list[1:]
+		} else {
+			popped[i] = value.list[len(value.list)-1]
+			value.list = value.list[:len(value.list)-1]
+		}
+	}
+
+	s.removeIfEmpty(args[0], value)
+	if len(args) == 1 {
+		return popped[0], nil
+	}
+
+	return mockStrings(popped), nil
+}
+
+func (s *mockRedisStore) lLen(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	return int64(len(value.list)), nil
+}
+
+func (s *mockRedisStore) lRange(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	start, err := mockParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := mockParseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return []interface{}{}, nil
+	}
+
+	from, to, ok := mockIndexRange(start, stop, len(value.list))
+	if !ok {
+		return []interface{}{}, nil
+	}
+
+	return mockStrings(value.list[from : to+1]), nil
+}
+
+func (s *mockRedisStore) listIndex(value *mockRedisValue, index string) (int, error) {
+	i, err := mockParseInt(index)
+	if err != nil {
+		return 0, err
+	}
+
+	if i < 0 {
+		i += int64(len(value.list))
+	}
+
+	if i < 0 || i >= int64(len(value.list)) {
+		return -1, nil
+	}
+
+	return int(i), nil
+}
+
+func (s *mockRedisStore) lIndex(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	i, err := s.listIndex(value, args[1])
+	if err != nil || i < 0 {
+		return nil, err
+	}
+
+	return value.list[i], nil
+}
+
+func (s *mockRedisStore) lSet(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return nil, mockErrNoSuchKey
+	}
+
+	i, err := s.listIndex(value, args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if i < 0 {
+		return nil, mockErrOutOfRange
+	}
+
+	value.list[i] = args[2]
+	return "OK", nil
+}
+
+func (s *mockRedisStore) lRem(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	count, err := mockParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+
+	var removed int64
+	kept := make([]string, 0, len(value.list))
+	if count >= 0 {
+		for _, element := range value.list {
+			if element == args[2] && (limit == 0 || removed < limit) {
+				removed++
+				continue
+			}
+
+			kept = append(kept, element)
+		}
+	} else {
+		for i := len(value.list) - 1; i >= 0; i-- {
+			if value.list[i] == args[2] && removed < limit {
+				removed++
+				continue
+			}
+
+			kept = append([]string{value.list[i]}, kept...)
+		}
+	}
+
+	value.list = kept
+	s.removeIfEmpty(args[0], value)
+	return removed, nil
+}
+
+func (s *mockRedisStore) lTrim(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	start, err := mockParseInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	stop, err := mockParseInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeList)
+	if err != nil || value == nil {
+		return "OK", err
+	}
+
+	from, to, ok := mockIndexRange(start, stop, len(value.list))
+	if !ok {
+		value.list = nil
+	} else {
+		value.list = append([]string(nil), value.list[from:to+1]...)
+	}
+
+	s.removeIfEmpty(args[0], value)
+	return "OK", nil
+}
+
+// Set commands
+
+func (s *mockRedisStore) sAdd(args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.create(args[0], mockTypeSet)
+	if err != nil {
+		return nil, err
+	}
+
+	var added int64
+	for _, member := range args[1:] {
+		if _, ok := value.set[member]; !ok {
+			value.set[member] = struct{}{}
+			added++
+		}
+	}
+
+	return added, nil
+}
+
+func (s *mockRedisStore) sRem(args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeSet)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	var removed int64
+	for _, member := range args[1:] {
+		if _, ok := value.set[member]; ok {
+			delete(value.set, member)
+			removed++
+		}
+	}
+
+	s.removeIfEmpty(args[0], value)
+	return removed, nil
+}
+
+// sPop removes random members, picked by the map iteration order.
+func (s *mockRedisStore) sPop(args []string) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	count := int64(1)
+	if len(args) == 2 {
+		n, err := mockParseInt(args[1])
+		if err != nil || n < 0 {
+			return nil, mockErrOutOfRange
+		}
+
+		count = n
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeSet)
+	if err != nil || value == nil {
+		if len(args) == 2 && err == nil {
+			return []interface{}{}, nil
+		}
+
+		return nil, err
+	}
+
+	popped := make([]string, 0, count)
+	for member := range value.set {
+		if int64(len(popped)) == count {
+			break
+		}
+
+		delete(value.set, member)
+		popped = append(popped, member)
+	}
+
+	s.removeIfEmpty(args[0], value)
+	if len(args) == 1 {
+		return popped[0], nil
+	}
+
+	return mockStrings(popped), nil
+}
+
+func mockSetMembers(set map[string]struct{}) []interface{} {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+
+	sort.Strings(members)
+	return mockStrings(members)
+}
+
+func (s *mockRedisStore) sMembers(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeSet)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return []interface{}{}, nil
+	}
+
+	return mockSetMembers(value.set), nil
+}
+
+func (s *mockRedisStore) sIsMember(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	reply, err := s.sMIsMember(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.([]interface{})[0], nil
+}
+
+func (s *mockRedisStore) sMIsMember(args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeSet)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := make([]interface{}, len(args)-1)
+	for i, member := range args[1:] {
+		reply[i] = int64(0)
+		if value != nil {
+			if _, ok := value.set[member]; ok {
+				reply[i] = int64(1)
+			}
+		}
+	}
+
+	return reply, nil
+}
+
+func (s *mockRedisStore) sCard(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeSet)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	return int64(len(value.set)), nil
+}
+
+func (s *mockRedisStore) sCombine(args []string, op string) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	sets := make([]map[string]struct{}, len(args))
+	for i, key := range args {
+		value, err := s.lookupKind(key, mockTypeSet)
+		if err != nil {
+			return nil, err
+		}
+
+		if value != nil {
+			sets[i] = value.set
+		}
+	}
+
+	result := map[string]struct{}{}
+	for member := range sets[0] {
+		result[member] = struct{}{}
+	}
+
+	for _, set := range sets[1:] {
+		switch op {
+		case "inter":
+			for member := range result {
+				if _, ok := set[member]; !ok {
+					delete(result, member)
+				}
+			}
+		case "union":
+			for member := range set {
+				result[member] = struct{}{}
+			}
+		case "diff":
+			for member := range set {
+				delete(result, member)
+			}
+		}
+	}
+
+	return mockSetMembers(result), nil
+}
+
+// Sorted set commands
+
+type mockZMember struct {
+	member string
+	score  float64
+}
+
+// sortedZMembers returns members ordered by score then lexicographically, as Redis orders them.
+func sortedZMembers(zset map[string]float64) []mockZMember {
+	members := make([]mockZMember, 0, len(zset))
+	for member, score := range zset {
+		members = append(members, mockZMember{member: member, score: score})
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].score != members[j].score {
+			return members[i].score < members[j].score
+		}
+
+		return members[i].member < members[j].member
+	})
+	return members
+}
+
+func mockZReply(members []mockZMember, withScores bool) []interface{} {
+	reply := make([]interface{}, 0, len(members))
+	for _, m := range members {
+		if withScores {
+			// RESP3 replies WITHSCORES as [member, score] pairs
+			reply = append(reply, []interface{}{m.member, m.score})
+		} else {
+			reply = append(reply, m.member)
+		}
+	}
+
+	return reply
+}
+
+func (s *mockRedisStore) zAdd(args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+
+	rest := args[i:]
+	if len(rest) == 0 || len(rest)%2 != 0 || (incr && len(rest) != 2) {
+		return nil, mockErrSyntax
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeZSet)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		if xx {
+			if incr {
+				return nil, nil
+			}
+
+			return int64(0), nil
+		}
+
+		value, _ = s.create(args[0], mockTypeZSet)
+	}
+
+	var added, changed int64
+	var incrResult interface{}
+	for j := 0; j < len(rest); j += 2 {
+		score, err := mockParseFloat(rest[j])
+		if err != nil {
+			return nil, err
+		}
+
+		member := rest[j+1]
+		current, exists := value.zset[member]
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+
+		if incr && exists {
+			score += current
+		}
+
+		if exists && ((gt && score <= current) || (lt && score >= current)) {
+			continue
+		}
+
+		if !exists {
+			added++
+			changed++
+		} else if score != current {
+			changed++
+		}
+
+		value.zset[member] = score
+		incrResult = score
+	}
+
+	s.removeIfEmpty(args[0], value)
+	if incr {
+		return incrResult, nil
+	}
+
+	if ch {
+		return changed, nil
+	}
+
+	return added, nil
+}
+
+func (s *mockRedisStore) zIncrBy(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	return s.zAdd([]string{args[0], "INCR", args[1], args[2]})
+}
+
+func (s *mockRedisStore) zScore(args []string) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeZSet)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	if score, ok := value.zset[args[1]]; ok {
+		return score, nil
+	}
+
+	return nil, nil
+}
+
+func (s *mockRedisStore) zCard(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeZSet)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	return int64(len(value.zset)), nil
+}
+
+func (s *mockRedisStore) zRem(args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeZSet)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	var removed int64
+	for _, member := range args[1:] {
+		if _, ok := value.zset[member]; ok {
+			delete(value.zset, member)
+			removed++
+		}
+	}
+
+	s.removeIfEmpty(args[0], value)
+	return removed, nil
+}
+
+// mockScoreBound parses a score range bound such as "(1.5", "-inf" or "10".
+func mockScoreBound(v string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(v, "(")
+	score, err := mockParseFloat(strings.TrimPrefix(v, "("))
+	if err != nil {
+		return 0, false, errors.New("ERR min or max is not a float")
+	}
+
+	return score, exclusive, nil
+}
+
+func mockScoreInRange(score, min float64, minEx bool, max float64, maxEx bool) bool {
+	if score < min || (minEx && score == min) {
+		return false
+	}
+
+	return score < max || (!maxEx && score == max)
+}
+
+func (s *mockRedisStore) zCount(args []string) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	min, minEx, err := mockScoreBound(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	max, maxEx, err := mockScoreBound(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeZSet)
+	if err != nil || value == nil {
+		return int64(0), err
+	}
+
+	var count int64
+	for _, score := range value.zset {
+		if mockScoreInRange(score, min, minEx, max, maxEx) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *mockRedisStore) zRank(args []string, reverse bool) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, mockErrWrongArgNum
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeZSet)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	members := sortedZMembers(value.zset)
+	for i, m := range members {
+		if m.member == args[1] {
+			if reverse {
+				return int64(len(members) - 1 - i), nil
+			}
+
+			return int64(i), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// zRange implements ZRANGE key start stop [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES].
+func (s *mockRedisStore) zRange(args []string) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	var byScore, rev, withScores, limit bool
+	var offset, count int64
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			byScore = true
+		case "REV":
+			rev = true
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, mockErrSyntax
+			}
+
+			var err error
+			if offset, err = mockParseInt(args[i+1]); err != nil {
+				return nil, err
+			}
+
+			if count, err = mockParseInt(args[i+2]); err != nil {
+				return nil, err
+			}
+
+			limit = true
+			i += 2
+		default:
+			return nil, fmt.Errorf("ERR stateful mock does not support ZRANGE option '%s'", args[i])
+		}
+	}
+
+	if limit && !byScore {
+		return nil, errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+
+	value, err := s.lookupKind(args[0], mockTypeZSet)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return []interface{}{}, nil
+	}
+
+	members := sortedZMembers(value.zset)
+	if rev {
+		for i, j := 0, len(members)-1; i < j; i, j = i+1, j-1 {
+			members[i], members[j] = members[j], members[i]
+		}
+	}
+
+	if !byScore {
+		start, err := mockParseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		stop, err := mockParseInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		from, to, ok := mockIndexRange(start, stop, len(members))
+		if !ok {
+			return []interface{}{}, nil
+		}
+
+		return mockZReply(members[from:to+1], withScores), nil
+	}
+
+	// With REV the range is given as max then min
+	minArg, maxArg := args[1], args[2]
+	if rev {
+		minArg, maxArg = maxArg, minArg
+	}
+
+	min, minEx, err := mockScoreBound(minArg)
+	if err != nil {
+		return nil, err
+	}
+
+	max, maxEx, err := mockScoreBound(maxArg)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []mockZMember
+	for _, m := range members {
+		if mockScoreInRange(m.score, min, minEx, max, maxEx) {
+			matched = append(matched, m)
+		}
+	}
+
+	if limit {
+		if offset < 0 || offset >= int64(len(matched)) {
+			matched = nil
+		} else {
+			matched = matched[offset:]
+			if count >= 0 && count < int64(len(matched)) {
+				matched = matched[:count]
+			}
+		}
+	}
+
+	return mockZReply(matched, withScores), nil
+}
+
+// zRangeCompat maps ZREVRANGE and ZRANGEBYSCORE style commands onto zRange.
+func (s *mockRedisStore) zRangeCompat(args []string, byScore, rev bool) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, mockErrWrongArgNum
+	}
+
+	rangeArgs := append([]string{}, args[:3]...)
+	if byScore {
+		rangeArgs = append(rangeArgs, "BYSCORE")
+	}
+
+	if rev {
+		rangeArgs = append(rangeArgs, "REV")
+	}
+
+	return s.zRange(append(rangeArgs, args[3:]...))
+}
+
+// mockGlobMatch reports whether str matches the Redis glob-style pattern.
+// Supports *, ?, [abc], [^abc], [a-z] and backslash escapes.
+func mockGlobMatch(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+
+			if len(pattern) == 1 {
+				return true
+			}
+
+			for i := 0; i <= len(str); i++ {
+				if mockGlobMatch(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+
+			str = str[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				// Unterminated class is matched literally
+				if str[0] != '[' {
+					return false
+				}
+
+				str = str[1:]
+				pattern = pattern[1:]
+				continue
+			}
+
+			class := pattern[1 : end+1]
+			negate := strings.HasPrefix(class, "^")
+			if negate {
+				class = class[1:]
+			}
+
+			matched := false
+			for i := 0; i < len(class); i++ {
+				if i+2 < len(class) && class[i+1] == '-' {
+					if class[i] <= str[0] && str[0] <= class[i+2] {
+						matched = true
+					}
+
+					i += 2
+				} else if class[i] == str[0] {
+					matched = true
+				}
+			}
+
+			if matched == negate {
+				return false
+			}
+
+			str = str[1:]
+			pattern = pattern[end+2:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+
+			fallthrough
+		default:
+			if len(str) == 0 || str[0] != pattern[0] {
+				return false
+			}
+
+			str = str[1:]
+			pattern = pattern[1:]
+		}
+	}
+
+	return len(str) == 0
+}
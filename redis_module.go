@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrRedisModuleNotLoaded is returned by the helpers of a module when the server does not provide its commands.
+var ErrRedisModuleNotLoaded = errors.New("redis module not loaded")
+
+// RedisHasCommand reports whether the server of op knows command, e.g. "BF.ADD" to detect RedisBloom.
+// Unlike MODULE LIST, it also detects modules built into the server and is allowed on managed services.
+func RedisHasCommand(op RedisOperator, command string) (bool, error) {
+	resp := op.Do("COMMAND", "INFO", command)
+	if resp.Error != nil {
+		return false, resp.Error
+	}
+
+	// Unknown commands have a nil entry, known ones start with their lowercase name
+	for _, entry := range resp.GetSlice() {
+		if info := entry.GetSlice(); len(info) > 0 && strings.EqualFold(info[0].GetString(), command) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// redisModule gates the helpers of a module on the detection of one of its commands.
+// The detection result is kept, failed detections are retried on the next call.
+type redisModule struct {
+	name    string
+	command string
+	mutex   sync.Mutex
+	checked bool
+	loaded  bool
+}
+
+// check returns ErrRedisModuleNotLoaded when the server of op does not provide the module.
+func (m *redisModule) check(op RedisOperator) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.checked {
+		loaded, err := RedisHasCommand(op, m.command)
+		if err != nil {
+			return err
+		}
+
+		m.checked, m.loaded = true, loaded
+	}
+
+	if !m.loaded {
+		return fmt.Errorf("%w: %s", ErrRedisModuleNotLoaded, m.name)
+	}
+
+	return nil
+}
+
+// redisBool converts an integer or RESP3 boolean reply.
+func redisBool(entity RedisResponseEntity) bool {
+	switch v := entity.data.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n != 0
+	}
+
+	return entity.GetInt64() != 0
+}
+
+// redisBools converts an array of integer or RESP3 boolean replies.
+func redisBools(resp *RedisResponse) []bool {
+	entities := resp.GetSlice()
+	bools := make([]bool, 0, len(entities))
+	for _, entity := range entities {
+		bools = append(bools, redisBool(entity))
+	}
+
+	return bools
+}
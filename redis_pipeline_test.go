@@ -1,9 +1,14 @@
 package datastore
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	secret "github.com/yetiz-org/goth-datastore/secrets"
@@ -189,3 +194,270 @@ func TestRedisPipelineWithServerError(t *testing.T) {
 	// Cleanup
 	r.Master().Delete("p_key_err")
 }
+
+// TestRedisAutoPipeline Concurrent single commands coalesced into pipelines
+func TestRedisAutoPipeline(t *testing.T) {
+	// Save original secret path and auto pipeline settings, restore them after test
+	originalPath := secret.Path()
+	originalAutoPipeline := DefaultRedisAutoPipeline
+	originalMaxBatch := DefaultRedisAutoPipelineMaxBatch
+	defer func() {
+		secret.PATH = originalPath
+		DefaultRedisAutoPipeline = originalAutoPipeline
+		DefaultRedisAutoPipelineMaxBatch = originalMaxBatch
+	}()
+
+	// Set secret path to the example directory
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+
+	DefaultRedisAutoPipeline = true
+	DefaultRedisAutoPipelineMaxBatch = 8
+	r := NewRedis("test")
+	defer r.Master().Close()
+
+	assert.NotNil(t, r.Master().(*RedisOp).batcher)
+
+	t.Run("ConcurrentCommands", func(t *testing.T) {
+		const workers = 50
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				key := fmt.Sprintf("ap_key_%d", i)
+				assert.NoError(t, r.Master().Set(key, i).Error)
+				assert.Equal(t, fmt.Sprint(i), r.Master().Get(key).GetString())
+				assert.Equal(t, int64(i+1), r.Master().Incr(key).GetInt64())
+			}(i)
+		}
+
+		wg.Wait()
+		for i := 0; i < workers; i++ {
+			r.Master().Delete(fmt.Sprintf("ap_key_%d", i))
+		}
+	})
+
+	t.Run("ErrorsStayPerCommand", func(t *testing.T) {
+		r.Master().Set("ap_key_err", "not_a_number")
+		defer r.Master().Delete("ap_key_err")
+
+		var wg sync.WaitGroup
+		var incrResp, getResp, missingResp *RedisResponse
+		wg.Add(3)
+		go func() { defer wg.Done(); incrResp = r.Master().Incr("ap_key_err") }()
+		go func() { defer wg.Done(); getResp = r.Master().Get("ap_key_err") }()
+		go func() { defer wg.Done(); missingResp = r.Master().Get("ap_key_missing") }()
+		wg.Wait()
+
+		assert.Error(t, incrResp.Error)
+		assert.NoError(t, getResp.Error)
+		assert.Equal(t, "not_a_number", getResp.GetString())
+		assert.True(t, missingResp.RecordNotFound())
+	})
+
+	t.Run("ConcurrentBatches", func(t *testing.T) {
+		// Batches in flight do not hold back the next ones up to the concurrency
+		p := newRedisAutoPipeline(r.Master().(*RedisOp).client, time.Millisecond, 1, 2)
+		defer p.close()
+
+		var wg sync.WaitGroup
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				p.do([]interface{}{"BLPOP", fmt.Sprintf("ap_key_blocked_%d", i), 0.3})
+			}(i)
+		}
+
+		wg.Wait()
+		assert.Less(t, time.Since(start), 550*time.Millisecond)
+	})
+
+	t.Run("AfterClose", func(t *testing.T) {
+		op := r.Master().(*RedisOp)
+		op.batcher.close()
+
+		// Commands fall back to direct execution once the batcher is stopped
+		response := r.Master().Ping()
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "PONG", response.GetString())
+	})
+}
+
+func BenchmarkRedisAutoPipeline(b *testing.B) {
+	originalAutoPipeline := DefaultRedisAutoPipeline
+	defer func() {
+		DefaultRedisAutoPipeline = originalAutoPipeline
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+
+	for _, autoPipeline := range []bool{false, true} {
+		DefaultRedisAutoPipeline = autoPipeline
+		r := NewRedis("test")
+		if r == nil {
+			b.Skip("Skipping benchmark - Redis not available")
+			return
+		}
+
+		b.Run(fmt.Sprintf("AutoPipeline_%v", autoPipeline), func(b *testing.B) {
+			b.SetParallelism(64)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := fmt.Sprintf("bench_ap_key_%d", i%1000)
+					r.Master().Set(key, "benchmark_value")
+					r.Master().Get(key)
+					i++
+				}
+			})
+		})
+
+		r.Master().Close()
+		r.Slave().Close()
+	}
+}
+
+// TestRedisTransactionPipeline Pipeline wrapped in MULTI/EXEC
+func TestRedisTransactionPipeline(t *testing.T) {
+	// Save original secret path and restore it after test
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	// Set secret path to the example directory
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+
+	r := NewRedis("test")
+	txOpts := RedisPipelineOptions{Transaction: true}
+
+	t.Run("ExecRepliesMappedPerCommand", func(t *testing.T) {
+		r.Master().Delete("tx_key1", "tx_counter")
+		defer r.Master().Delete("tx_key1", "tx_counter")
+
+		resps := r.Master().PipelineWithOptions(txOpts,
+			RedisPipelineCmd{Cmd: "SET", Args: []interface{}{"tx_key1", "value1"}},
+			RedisPipelineCmd{Cmd: "INCR", Args: []interface{}{"tx_counter"}},
+			RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"tx_key1"}},
+			RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"tx_missing"}},
+		)
+		assert.Len(t, resps, 4)
+
+		assert.NoError(t, resps[0].Error)
+		assert.Equal(t, "OK", resps[0].GetString())
+
+		assert.NoError(t, resps[1].Error)
+		assert.Equal(t, int64(1), resps[1].GetInt64())
+
+		assert.NoError(t, resps[2].Error)
+		assert.Equal(t, "value1", resps[2].GetString())
+
+		assert.True(t, resps[3].RecordNotFound())
+	})
+
+	t.Run("RuntimeErrorDoesNotRollback", func(t *testing.T) {
+		r.Master().Set("tx_key_err", "not_a_number")
+		defer r.Master().Delete("tx_key_err")
+
+		resps := r.Master().PipelineWithOptions(txOpts,
+			RedisPipelineCmd{Cmd: "INCR", Args: []interface{}{"tx_key_err"}},
+			RedisPipelineCmd{Cmd: "SET", Args: []interface{}{"tx_key_err", "10"}},
+		)
+		assert.Len(t, resps, 2)
+		assert.Error(t, resps[0].Error)
+		assert.NoError(t, resps[1].Error)
+		assert.Equal(t, "10", r.Master().Get("tx_key_err").GetString())
+	})
+
+	t.Run("QueueErrorAbortsTransaction", func(t *testing.T) {
+		r.Master().Set("tx_key_abort", "original")
+		defer r.Master().Delete("tx_key_abort")
+
+		resps := r.Master().PipelineWithOptions(txOpts,
+			RedisPipelineCmd{Cmd: "SET", Args: []interface{}{"tx_key_abort", "changed"}},
+			RedisPipelineCmd{Cmd: "GET", Args: []interface{}{}}, // Wrong arity is rejected while queueing
+		)
+		assert.Len(t, resps, 2)
+		assert.Error(t, resps[0].Error)
+		assert.Error(t, resps[1].Error)
+		assert.Equal(t, "original", r.Master().Get("tx_key_abort").GetString())
+	})
+}
+
+// TestRedisPipelineCtx Pipeline and transaction bounded by the caller context
+func TestRedisPipelineCtx(t *testing.T) {
+	t.Run("Mock", func(t *testing.T) {
+		op := NewMockRedisOp()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		resps := op.PipelineCtx(ctx,
+			RedisPipelineCmd{Cmd: "SET", Args: []interface{}{"key", "value"}},
+			RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"key"}},
+		)
+		assert.Len(t, resps, 2)
+		for _, resp := range resps {
+			assert.ErrorIs(t, resp.Error, context.Canceled)
+		}
+
+		assert.Empty(t, op.GetCallHistory())
+
+		failure := errors.New("failure")
+		_, err := op.ExecCtx(context.Background(), func(tx *RedisTx) error {
+			tx.Do("SET", "key", "value")
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+		assert.Empty(t, op.GetCallHistory())
+
+		resps, err = op.ExecCtx(context.Background(), func(tx *RedisTx) error {
+			tx.Do("SET", "key", "value")
+			tx.Do("GET", "key")
+			assert.Equal(t, 2, tx.Len())
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, resps, 2)
+		assert.Len(t, op.GetCallsByCommand("TXPIPELINE"), 1)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		r := NewRedis("test")
+		assert.NotNil(t, r)
+		defer r.Close()
+
+		op := r.Master()
+		defer op.Delete("test_pipeline_ctx", "test_pipeline_ctx_list")
+		resps, err := op.ExecCtx(context.Background(), func(tx *RedisTx) error {
+			tx.Do("SET", "test_pipeline_ctx", "value")
+			tx.Do("GET", "test_pipeline_ctx")
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, resps, 2)
+		assert.Equal(t, "value", resps[1].GetString())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		resps = op.PipelineCtx(ctx, RedisPipelineCmd{Cmd: "BLPOP", Args: []interface{}{"test_pipeline_ctx_list", 2}})
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Len(t, resps, 1)
+		assert.ErrorIs(t, resps[0].Error, ErrTimeout)
+
+		assert.Equal(t, "value", op.Get("test_pipeline_ctx").GetString())
+	})
+}
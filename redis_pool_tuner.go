@@ -0,0 +1,366 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultRedisPoolAutoTune enables the adaptive pool mode: instead of the static DefaultRedisMaxIdle, the number of
+// idle connections kept per server follows the connections used concurrently, between DefaultRedisPoolAutoTuneMinIdle
+// and DefaultRedisPoolAutoTuneMaxIdle, see Redis.AddPoolTuneObserver.
+var DefaultRedisPoolAutoTune = false
+
+// DefaultRedisPoolAutoTuneMinIdle is the lowest number of idle connections the adaptive pool keeps per server.
+var DefaultRedisPoolAutoTuneMinIdle = 2
+
+// DefaultRedisPoolAutoTuneMaxIdle is the highest number of idle connections the adaptive pool keeps per server.
+var DefaultRedisPoolAutoTuneMaxIdle = 200
+
+// DefaultRedisPoolAutoTuneInterval is how often the adaptive pool reviews its idle limit, connections unused for a
+// whole interval are the ones closed when the limit is exceeded.
+var DefaultRedisPoolAutoTuneInterval = 10 * time.Second
+
+func init() {
+	envBool("GOTH_DEFAULT_REDIS_POOL_AUTO_TUNE", &DefaultRedisPoolAutoTune)
+	envInt("GOTH_DEFAULT_REDIS_POOL_AUTO_TUNE_MIN_IDLE", &DefaultRedisPoolAutoTuneMinIdle)
+	envInt("GOTH_DEFAULT_REDIS_POOL_AUTO_TUNE_MAX_IDLE", &DefaultRedisPoolAutoTuneMaxIdle)
+	envMillis("GOTH_DEFAULT_REDIS_POOL_AUTO_TUNE_INTERVAL", &DefaultRedisPoolAutoTuneInterval)
+}
+
+// RedisPoolTuneEvent is a decision of the adaptive pool for one server, reported when the idle limit changes or
+// idle connections are closed.
+type RedisPoolTuneEvent struct {
+	Addr string
+	// Previous and MaxIdle are the idle limits before and after the decision
+	Previous int
+	MaxIdle  int
+	// Used is the number of connections that sent or received data during the interval, the concurrency observed
+	Used int
+	// Dials is the number of connections opened during the interval, commands that found no idle connection
+	// waited DialTime in total for them
+	Dials    int
+	DialTime time.Duration
+	// Closed is the number of idle connections closed to honour MaxIdle
+	Closed int
+}
+
+// RedisPoolTuneObserverFunc is called for every decision of the adaptive pool, from its tuning goroutine.
+type RedisPoolTuneObserverFunc func(event RedisPoolTuneEvent)
+
+// errRedisConnRetired fails the health check go-redis runs on idle connections, so closed ones are discarded.
+var errRedisConnRetired = errors.New("redis connection retired by the adaptive pool")
+
+// redisPoolTuner tracks the connections dialed for a client per server, and closes the idle connections above a
+// limit derived from the connections used during the last interval. go-redis can not resize a pool, so the pool
+// is built with the upper bound as MaxIdleConns and the closed connections are dropped when it next hands them out.
+type redisPoolTuner struct {
+	minIdle  int
+	maxIdle  int
+	interval time.Duration
+
+	mutex     sync.Mutex
+	servers   map[string]*redisPoolTunerServer
+	tunings   int64
+	observers []RedisPoolTuneObserverFunc
+	closed    chan struct{}
+	once      sync.Once
+}
+
+type redisPoolTunerServer struct {
+	limit    int
+	conns    map[*redisTunedConn]struct{}
+	dials    int
+	dialTime time.Duration
+}
+
+// newRedisPoolTuner returns the tuner of a client, nil when DefaultRedisPoolAutoTune is disabled.
+func newRedisPoolTuner() *redisPoolTuner {
+	if !DefaultRedisPoolAutoTune {
+		return nil
+	}
+
+	minIdle, maxIdle := max(DefaultRedisPoolAutoTuneMinIdle, 0), DefaultRedisPoolAutoTuneMaxIdle
+	if maxIdle < minIdle {
+		maxIdle = minIdle
+	}
+
+	interval := DefaultRedisPoolAutoTuneInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	return &redisPoolTuner{
+		minIdle:  minIdle,
+		maxIdle:  maxIdle,
+		interval: interval,
+		servers:  map[string]*redisPoolTunerServer{},
+		closed:   make(chan struct{}),
+	}
+}
+
+func (t *redisPoolTuner) start() {
+	go func() {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				t.tune(now)
+			case <-t.closed:
+				return
+			}
+		}
+	}()
+}
+
+func (t *redisPoolTuner) close() {
+	t.once.Do(func() {
+		close(t.closed)
+	})
+}
+
+// wrapDialer returns a dialer tracking the connections of dial.
+func (t *redisPoolTuner) wrapDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		tuned := &redisTunedConn{Conn: conn, tuner: t, addr: addr, lastUsed: time.Now()}
+		t.mutex.Lock()
+		server := t.server(addr)
+		server.conns[tuned] = struct{}{}
+		server.dials++
+		server.dialTime += time.Since(start)
+		t.mutex.Unlock()
+		return tuned, nil
+	}
+}
+
+func (t *redisPoolTuner) server(addr string) *redisPoolTunerServer {
+	server, ok := t.servers[addr]
+	if !ok {
+		server = &redisPoolTunerServer{
+			limit: min(max(DefaultRedisMaxIdle, t.minIdle), t.maxIdle),
+			conns: map[*redisTunedConn]struct{}{},
+		}
+
+		t.servers[addr] = server
+	}
+
+	return server
+}
+
+func (t *redisPoolTuner) remove(conn *redisTunedConn) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if server, ok := t.servers[conn.addr]; ok {
+		delete(server.conns, conn)
+	}
+}
+
+// limit returns the current idle limit of addr, 0 when no connection was dialed to it.
+func (t *redisPoolTuner) limit(addr string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if server, ok := t.servers[addr]; ok {
+		return server.limit
+	}
+
+	return 0
+}
+
+// stats returns the sum of the idle limits of the servers, and the number of decisions changing one.
+func (t *redisPoolTuner) stats() (maxIdle int, tunings int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, server := range t.servers {
+		maxIdle += server.limit
+	}
+
+	return maxIdle, t.tunings
+}
+
+func (t *redisPoolTuner) addObserver(fn RedisPoolTuneObserverFunc) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.observers = append(t.observers, fn)
+}
+
+// tune reviews the idle limit of every server: it grows at once to the connections used during the interval plus a
+// quarter of headroom, and shrinks by half the gap per interval so a short lull does not drop the connections a
+// burst needs. Connections unused for the whole interval above the limit are closed.
+func (t *redisPoolTuner) tune(now time.Time) {
+	var events []RedisPoolTuneEvent
+	t.mutex.Lock()
+	for addr, server := range t.servers {
+		used, unused := 0, make([]*redisTunedConn, 0)
+		for conn := range server.conns {
+			if conn.usedSince(now.Add(-t.interval)) {
+				used++
+			} else {
+				unused = append(unused, conn)
+			}
+		}
+
+		target := used + (used+3)/4
+		limit := server.limit
+		if target > limit {
+			limit = target
+		} else {
+			limit -= (limit - target) / 2
+		}
+
+		limit = min(max(limit, t.minIdle), t.maxIdle)
+		event := RedisPoolTuneEvent{
+			Addr:     addr,
+			Previous: server.limit,
+			MaxIdle:  limit,
+			Used:     used,
+			Dials:    server.dials,
+			DialTime: server.dialTime,
+		}
+
+		// close the longest unused first, keeping the connections in use and up to limit idle ones
+		sort.Slice(unused, func(i, j int) bool { return unused[i].idleSince().Before(unused[j].idleSince()) })
+		for excess := len(server.conns) - max(limit, used); excess > 0 && len(unused) > 0; excess-- {
+			if unused[0].retire(now.Add(-t.interval)) {
+				delete(server.conns, unused[0])
+				event.Closed++
+			}
+
+			unused = unused[1:]
+		}
+
+		if limit != server.limit {
+			t.tunings++
+		}
+
+		server.limit, server.dials, server.dialTime = limit, 0, 0
+		if event.MaxIdle != event.Previous || event.Closed > 0 {
+			events = append(events, event)
+		}
+	}
+
+	observers := t.observers
+	t.mutex.Unlock()
+	for _, event := range events {
+		kklogger.DebugJ("datastore:RedisPoolTuner.tune", fmt.Sprintf("%s max idle %d -> %d, %d used, %d dials, %d closed",
+			event.Addr, event.Previous, event.MaxIdle, event.Used, event.Dials, event.Closed))
+		for _, fn := range observers {
+			fn(event)
+		}
+	}
+}
+
+// redisTunedConn is a connection tracked by a redisPoolTuner. A retired connection is closed and fails the health
+// check go-redis runs through SyscallConn before handing out an idle connection.
+type redisTunedConn struct {
+	net.Conn
+	tuner      *redisPoolTuner
+	addr       string
+	mutex      sync.Mutex
+	lastUsed   time.Time
+	reading    int
+	subscribed bool
+	retired    bool
+}
+
+func (c *redisTunedConn) Read(b []byte) (int, error) {
+	c.mutex.Lock()
+	c.reading++
+	c.mutex.Unlock()
+	n, err := c.Conn.Read(b)
+	c.mutex.Lock()
+	c.reading--
+	c.lastUsed = time.Now()
+	c.mutex.Unlock()
+	return n, err
+}
+
+func (c *redisTunedConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	if c.retired {
+		c.mutex.Unlock()
+		return 0, errRedisConnRetired
+	}
+
+	c.lastUsed = time.Now()
+	if !c.subscribed && redisIsSubscribeCommand(b) {
+		c.subscribed = true
+	}
+
+	c.mutex.Unlock()
+	return c.Conn.Write(b)
+}
+
+// SyscallConn is called by go-redis to check an idle connection before reusing it, it counts as a use so the
+// connection is not retired while being handed out.
+func (c *redisTunedConn) SyscallConn() (syscall.RawConn, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.retired {
+		return nil, errRedisConnRetired
+	}
+
+	c.lastUsed = time.Now()
+	if conn, ok := c.Conn.(syscall.Conn); ok {
+		return conn.SyscallConn()
+	}
+
+	return redisNoopRawConn{}, nil
+}
+
+func (c *redisTunedConn) Close() error {
+	c.tuner.remove(c)
+	c.mutex.Lock()
+	retired := c.retired
+	c.mutex.Unlock()
+	if err := c.Conn.Close(); err != nil && !retired {
+		return err
+	}
+
+	return nil
+}
+
+func (c *redisTunedConn) usedSince(since time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.reading > 0 || c.subscribed || c.lastUsed.After(since)
+}
+
+func (c *redisTunedConn) idleSince() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lastUsed
+}
+
+// retire closes the connection unless it was used after since, or is blocked reading a reply.
+func (c *redisTunedConn) retire(since time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.retired || c.reading > 0 || c.subscribed || c.lastUsed.After(since) {
+		return false
+	}
+
+	c.retired = true
+	c.Conn.Close()
+	return true
+}
+
+// redisNoopRawConn passes the health check of connections without a file descriptor.
+type redisNoopRawConn struct{}
+
+func (redisNoopRawConn) Control(func(fd uintptr)) error           { return nil }
+func (redisNoopRawConn) Read(func(fd uintptr) (done bool)) error  { return nil }
+func (redisNoopRawConn) Write(func(fd uintptr) (done bool)) error { return nil }
@@ -0,0 +1,150 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisPoolTuner(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, newRedisPoolTuner())
+	})
+
+	t.Run("Tune", func(t *testing.T) {
+		defer func(enabled bool, minIdle, maxIdle int) {
+			DefaultRedisPoolAutoTune, DefaultRedisPoolAutoTuneMinIdle, DefaultRedisPoolAutoTuneMaxIdle = enabled, minIdle, maxIdle
+		}(DefaultRedisPoolAutoTune, DefaultRedisPoolAutoTuneMinIdle, DefaultRedisPoolAutoTuneMaxIdle)
+
+		DefaultRedisPoolAutoTune, DefaultRedisPoolAutoTuneMinIdle, DefaultRedisPoolAutoTuneMaxIdle = true, 2, 12
+		tuner := newRedisPoolTuner()
+		var events []RedisPoolTuneEvent
+		tuner.addObserver(func(event RedisPoolTuneEvent) {
+			events = append(events, event)
+		})
+
+		var peers []net.Conn
+		dial := tuner.wrapDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			peers = append(peers, server)
+			return client, nil
+		})
+
+		defer func() {
+			for _, peer := range peers {
+				peer.Close()
+			}
+		}()
+
+		var conns []*redisTunedConn
+		for i := 0; i < 16; i++ {
+			conn, err := dial(context.Background(), "tcp", "redis:6379")
+			assert.NoError(t, err)
+			conns = append(conns, conn.(*redisTunedConn))
+		}
+
+		assert.Equal(t, 12, tuner.limit("redis:6379"))
+
+		// 16 connections used, the limit grows to the upper bound
+		now := time.Now()
+		tuner.tune(now)
+		assert.Equal(t, 12, tuner.limit("redis:6379"))
+		assert.Empty(t, events)
+
+		// 4 used during the next interval, the limit shrinks by half the gap to 5 and the 7 oldest unused are closed
+		for i, conn := range conns {
+			conn.lastUsed = now.Add(-time.Duration(20-i) * time.Second)
+		}
+
+		for _, conn := range conns[:4] {
+			conn.lastUsed = now.Add(2 * time.Second)
+		}
+
+		tuner.tune(now.Add(tuner.interval + time.Second))
+		assert.Equal(t, 9, tuner.limit("redis:6379"))
+		assert.Equal(t, []RedisPoolTuneEvent{{Addr: "redis:6379", Previous: 12, MaxIdle: 9, Used: 4, Closed: 7}}, events)
+		for i, conn := range conns {
+			_, err := conn.SyscallConn()
+			if i >= 4 && i < 11 {
+				assert.ErrorIs(t, err, errRedisConnRetired)
+				assert.NoError(t, conn.Close())
+			} else {
+				assert.NoError(t, err)
+			}
+		}
+
+		// connections blocked reading a reply or subscribed are never closed
+		conns[12].reading, conns[13].subscribed = 1, true
+		tuner.tune(now.Add(10 * tuner.interval))
+		maxIdle, tunings := tuner.stats()
+		assert.Equal(t, 6, maxIdle)
+		assert.Equal(t, int64(2), tunings)
+		assert.Equal(t, 3, events[1].Closed)
+		assert.Equal(t, 2, events[1].Used)
+		_, err := conns[12].SyscallConn()
+		assert.NoError(t, err)
+		_, err = conns[13].SyscallConn()
+		assert.NoError(t, err)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func(enabled bool, minIdle, maxIdle int, interval time.Duration) {
+			secret.PATH = originalPath
+			DefaultRedisPoolAutoTune, DefaultRedisPoolAutoTuneMinIdle, DefaultRedisPoolAutoTuneMaxIdle = enabled, minIdle, maxIdle
+			DefaultRedisPoolAutoTuneInterval = interval
+		}(DefaultRedisPoolAutoTune, DefaultRedisPoolAutoTuneMinIdle, DefaultRedisPoolAutoTuneMaxIdle, DefaultRedisPoolAutoTuneInterval)
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		DefaultRedisPoolAutoTune, DefaultRedisPoolAutoTuneMinIdle, DefaultRedisPoolAutoTuneMaxIdle = true, 1, 16
+		DefaultRedisPoolAutoTuneInterval = 50 * time.Millisecond
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		var mutex sync.Mutex
+		var events []RedisPoolTuneEvent
+		redis.AddPoolTuneObserver(func(event RedisPoolTuneEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			events = append(events, event)
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					assert.NoError(t, redis.Master().Set(fmt.Sprintf("test_pool_tuner_%d", i), j).Error)
+				}
+			}(i)
+		}
+
+		wg.Wait()
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(events) > 0 && events[len(events)-1].MaxIdle == 1
+		}, 2*time.Second, 10*time.Millisecond)
+
+		stats := redis.Stats()
+		assert.Equal(t, float64(1), stats["master.pool_max_idle"])
+		assert.Greater(t, stats["master.pool_tunings"], float64(0))
+		for i := 0; i < 8; i++ {
+			n, err := redis.Master().Get(fmt.Sprintf("test_pool_tuner_%d", i)).TryGetInt64()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(19), n)
+			redis.Master().Delete(fmt.Sprintf("test_pool_tuner_%d", i))
+		}
+	})
+}
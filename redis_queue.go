@@ -0,0 +1,505 @@
+package datastore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+var (
+	// DefaultRedisQueueVisibility is how long a dequeued job stays invisible before it is delivered again
+	DefaultRedisQueueVisibility = 30 * time.Second
+	// DefaultRedisQueueMaxAttempts is the number of deliveries before a job is moved to the dead-letter queue
+	DefaultRedisQueueMaxAttempts = 5
+	// DefaultRedisQueuePollInterval is how long an idle QueueWorkerPool worker waits before dequeuing again
+	DefaultRedisQueuePollInterval = time.Second
+	// DefaultRedisQueueRetryDelay is the delay before the first retry of a failed job, doubled on each attempt
+	DefaultRedisQueueRetryDelay = time.Second
+	// DefaultRedisQueueShutdownTimeout is how long QueueWorkerPool waits for running jobs before cancelling them
+	DefaultRedisQueueShutdownTimeout = 30 * time.Second
+)
+
+func init() {
+	envMillis("GOTH_DEFAULT_REDIS_QUEUE_VISIBILITY", &DefaultRedisQueueVisibility)
+	envInt("GOTH_DEFAULT_REDIS_QUEUE_MAX_ATTEMPTS", &DefaultRedisQueueMaxAttempts)
+	envMillis("GOTH_DEFAULT_REDIS_QUEUE_POLL_INTERVAL", &DefaultRedisQueuePollInterval)
+	envMillis("GOTH_DEFAULT_REDIS_QUEUE_RETRY_DELAY", &DefaultRedisQueueRetryDelay)
+	envMillis("GOTH_DEFAULT_REDIS_QUEUE_SHUTDOWN_TIMEOUT", &DefaultRedisQueueShutdownTimeout)
+}
+
+// RedisQueueMaxPriority bounds EnqueueOptions.Priority, so priorities and sequences share the exact range of a score.
+const RedisQueueMaxPriority = 100
+
+var (
+	// ErrQueueEmpty is returned by Dequeue when no job is ready.
+	ErrQueueEmpty = errors.New("redis queue empty")
+	// ErrQueueJobNotFound is returned by Ack, Nack and Touch for a delivery which is not in flight anymore,
+	// e.g. because its visibility timeout expired and the job was delivered again, and by Retry for a job which
+	// is not dead.
+	ErrQueueJobNotFound = errors.New("redis queue job not found")
+)
+
+// RedisQueue is a job queue stored in Redis, see NewRedisQueue.
+// Jobs are ordered by priority then by the order they became ready, Dequeue hides a job for the visibility timeout
+// until it is acknowledged by Ack or released by Nack, a job not acknowledged in time is delivered again.
+// Jobs delivered MaxAttempts times without Ack are moved to the dead-letter queue.
+// State changes run as Lua scripts timed by the Redis clock, the keys of a queue share a hash tag to live on the
+// same cluster slot.
+type RedisQueue struct {
+	op   RedisOperator
+	name string
+	keys []interface{}
+	// Visibility is how long a dequeued job stays invisible, DefaultRedisQueueVisibility when created
+	Visibility time.Duration
+	// MaxAttempts is the number of deliveries before a job is dead, DefaultRedisQueueMaxAttempts when created, 0 retries forever
+	MaxAttempts int
+}
+
+// QueueJob is a job of a RedisQueue.
+type QueueJob struct {
+	ID       string
+	Payload  []byte
+	Priority int
+	// Attempts counts the deliveries of the job, including the current one
+	Attempts int
+	// Lease identifies the delivery, Ack, Nack and Touch of a previous delivery fail with ErrQueueJobNotFound
+	Lease string
+}
+
+// EnqueueOptions configures RedisQueue.EnqueueWithOptions.
+type EnqueueOptions struct {
+	// Delay postpones the first delivery
+	Delay time.Duration
+	// Priority orders the ready jobs, higher first, within ±RedisQueueMaxPriority
+	Priority int
+}
+
+// QueueStats are the number of jobs of a RedisQueue by state.
+type QueueStats struct {
+	Ready    int64
+	Delayed  int64
+	InFlight int64
+	Dead     int64
+}
+
+// NewRedisQueue returns the queue name on op.
+func NewRedisQueue(op RedisOperator, name string) *RedisQueue {
+	keys := make([]interface{}, 0, 9)
+	for _, suffix := range []string{"ready", "delayed", "inflight", "dead", "jobs", "priority", "attempts", "seq", "lease"} {
+		keys = append(keys, fmt.Sprintf("queue:{%s}:%s", name, suffix))
+	}
+
+	return &RedisQueue{
+		op:          op,
+		name:        name,
+		keys:        keys,
+		Visibility:  DefaultRedisQueueVisibility,
+		MaxAttempts: DefaultRedisQueueMaxAttempts,
+	}
+}
+
+// Name returns the name of the queue.
+func (q *RedisQueue) Name() string {
+	return q.name
+}
+
+// Indexes of RedisQueue.keys, also the KEYS of the scripts.
+const (
+	queueReady = iota
+	queueDelayed
+	queueInFlight
+	queueDead
+	queueJobs
+	queuePriority
+	queueAttempts
+	queueSeq
+	queueLease
+)
+
+// redisQueueLib is prepended to the scripts, now reads the Redis clock in milliseconds, ready adds a job to the
+// ready set and retry releases a delivered job, ending its lease.
+// Ready jobs are scored by priority then by a sequence, jobs becoming ready within the same millisecond keep their order.
+const redisQueueLib = `
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+local function now()
+	local time = redis.call('TIME')
+	return tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+end
+local function leased(id, lease)
+	return redis.call('HGET', KEYS[9], id) == lease and redis.call('ZSCORE', KEYS[3], id)
+end
+local function ready(id)
+	local priority = tonumber(redis.call('HGET', KEYS[6], id) or '0')
+	local seq = redis.call('INCR', KEYS[8]) % 1e12
+	redis.call('ZADD', KEYS[1], string.format('%.0f', -priority * 1e12 + seq), id)
+end
+local function retry(id, now, delay, max)
+	redis.call('HDEL', KEYS[9], id)
+	local attempts = tonumber(redis.call('HGET', KEYS[7], id) or '0')
+	if max > 0 and attempts >= max then
+		redis.call('ZADD', KEYS[4], string.format('%.0f', now), id)
+	elseif delay > 0 then
+		redis.call('ZADD', KEYS[2], string.format('%.0f', now + delay), id)
+	else
+		ready(id)
+	end
+end
+`
+
+var (
+	redisQueueEnqueueScript = redisQueueLib + `
+redis.call('HSET', KEYS[5], ARGV[1], ARGV[2])
+redis.call('HSET', KEYS[6], ARGV[1], ARGV[3])
+local delay = tonumber(ARGV[4])
+if delay > 0 then
+	redis.call('ZADD', KEYS[2], string.format('%.0f', now() + delay), ARGV[1])
+else
+	ready(ARGV[1])
+end
+return 1
+`
+	redisQueueDequeueScript = redisQueueLib + `
+local now, max = now(), tonumber(ARGV[2])
+for _, id in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now, 'LIMIT', 0, 100)) do
+	redis.call('ZREM', KEYS[2], id)
+	ready(id)
+end
+for _, id in ipairs(redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', now, 'LIMIT', 0, 100)) do
+	redis.call('ZREM', KEYS[3], id)
+	retry(id, now, 0, max)
+end
+local ids = redis.call('ZRANGE', KEYS[1], 0, 0)
+if #ids == 0 then
+	return false
+end
+local id = ids[1]
+redis.call('ZREM', KEYS[1], id)
+redis.call('ZADD', KEYS[3], string.format('%.0f', now + tonumber(ARGV[1])), id)
+redis.call('HSET', KEYS[9], id, ARGV[3])
+local attempts = redis.call('HINCRBY', KEYS[7], id, 1)
+return {id, redis.call('HGET', KEYS[5], id) or '', attempts, redis.call('HGET', KEYS[6], id) or '0'}
+`
+	redisQueueAckScript = redisQueueLib + `
+if not leased(ARGV[1], ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('HDEL', KEYS[5], ARGV[1])
+redis.call('HDEL', KEYS[6], ARGV[1])
+redis.call('HDEL', KEYS[7], ARGV[1])
+redis.call('HDEL', KEYS[9], ARGV[1])
+return 1
+`
+	redisQueueNackScript = redisQueueLib + `
+if not leased(ARGV[1], ARGV[2]) then
+	return 0
+end
+redis.call('ZREM', KEYS[3], ARGV[1])
+retry(ARGV[1], now(), tonumber(ARGV[3]), tonumber(ARGV[4]))
+return 1
+`
+	redisQueueTouchScript = redisQueueLib + `
+if not leased(ARGV[1], ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[3], string.format('%.0f', now() + tonumber(ARGV[3])), ARGV[1])
+return 1
+`
+	redisQueueRetryScript = redisQueueLib + `
+if redis.call('ZREM', KEYS[4], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[7], ARGV[1])
+ready(ARGV[1])
+return 1
+`
+)
+
+// Enqueue adds a job with payload, ready immediately with the default priority, and returns its id.
+func (q *RedisQueue) Enqueue(payload []byte) (string, error) {
+	return q.EnqueueWithOptions(payload, EnqueueOptions{})
+}
+
+// EnqueueWithOptions adds a job with payload and returns its id.
+func (q *RedisQueue) EnqueueWithOptions(payload []byte, opts EnqueueOptions) (string, error) {
+	if opts.Priority > RedisQueueMaxPriority || opts.Priority < -RedisQueueMaxPriority {
+		return "", fmt.Errorf("redis queue priority %d out of range", opts.Priority)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	job := hex.EncodeToString(id)
+	resp := q.op.Eval(redisQueueEnqueueScript, q.keys,
+		[]interface{}{job, payload, opts.Priority, opts.Delay.Milliseconds()})
+	if resp.Error != nil {
+		return "", resp.Error
+	}
+
+	return job, nil
+}
+
+// Dequeue delivers the next ready job, hidden from other consumers for Visibility, ErrQueueEmpty when none is ready.
+// Delayed jobs which became due and jobs whose visibility timeout expired are made ready first.
+func (q *RedisQueue) Dequeue() (*QueueJob, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	lease := hex.EncodeToString(random)
+	resp := q.op.Eval(redisQueueDequeueScript, q.keys, []interface{}{q.Visibility.Milliseconds(), q.MaxAttempts, lease})
+	if errors.Is(resp.Error, RedisNotFound) {
+		return nil, ErrQueueEmpty
+	}
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	reply := resp.GetSlice()
+	if len(reply) != 4 {
+		return nil, errors.New("invalid dequeue response")
+	}
+
+	priority, _ := strconv.Atoi(reply[3].GetString())
+	return &QueueJob{
+		ID:       reply[0].GetString(),
+		Payload:  reply[1].GetBytes(),
+		Priority: priority,
+		Attempts: int(reply[2].GetInt64()),
+		Lease:    lease,
+	}, nil
+}
+
+// Ack completes the delivery job and removes the job from the queue.
+func (q *RedisQueue) Ack(job *QueueJob) error {
+	return q.eval(redisQueueAckScript, job.ID, job.Lease)
+}
+
+// Nack releases the delivery job to be delivered again after delay, or moves the job to the dead-letter queue
+// when it was delivered MaxAttempts times.
+func (q *RedisQueue) Nack(job *QueueJob, delay time.Duration) error {
+	return q.eval(redisQueueNackScript, job.ID, job.Lease, delay.Milliseconds(), q.MaxAttempts)
+}
+
+// Touch hides the delivery job for another visibility period, for jobs running longer than Visibility.
+func (q *RedisQueue) Touch(job *QueueJob, visibility time.Duration) error {
+	return q.eval(redisQueueTouchScript, job.ID, job.Lease, visibility.Milliseconds())
+}
+
+// DeadJobs returns up to limit jobs of the dead-letter queue, the oldest first.
+func (q *RedisQueue) DeadJobs(limit int64) ([]*QueueJob, error) {
+	resp := q.op.ZRange(q.keys[queueDead], 0, limit-1)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	ids := resp.GetSlice()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cmds := make([]RedisPipelineCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, RedisPipelineCmd{Cmd: "EVAL", Args: []interface{}{
+			"return {redis.call('HGET', KEYS[1], ARGV[1]) or '', redis.call('HGET', KEYS[2], ARGV[1]) or '0', redis.call('HGET', KEYS[3], ARGV[1]) or '0'}",
+			3, q.keys[queueJobs], q.keys[queuePriority], q.keys[queueAttempts], id.GetString(),
+		}})
+	}
+
+	jobs := make([]*QueueJob, 0, len(ids))
+	for i, resp := range q.op.Pipeline(cmds...) {
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+
+		reply := resp.GetSlice()
+		if len(reply) != 3 {
+			return nil, errors.New("invalid dead job response")
+		}
+
+		priority, _ := strconv.Atoi(reply[1].GetString())
+		attempts, _ := strconv.Atoi(reply[2].GetString())
+		jobs = append(jobs, &QueueJob{ID: ids[i].GetString(), Payload: reply[0].GetBytes(), Priority: priority, Attempts: attempts})
+	}
+
+	return jobs, nil
+}
+
+// Retry moves the dead job id back to the ready jobs with its attempts reset.
+func (q *RedisQueue) Retry(id string) error {
+	return q.eval(redisQueueRetryScript, id)
+}
+
+// Stats returns the number of jobs by state.
+func (q *RedisQueue) Stats() (QueueStats, error) {
+	cmds := make([]RedisPipelineCmd, 0, 4)
+	for _, key := range q.keys[queueReady : queueDead+1] {
+		cmds = append(cmds, RedisPipelineCmd{Cmd: "ZCARD", Args: []interface{}{key}})
+	}
+
+	responses := q.op.Pipeline(cmds...)
+	for _, resp := range responses {
+		if resp.Error != nil {
+			return QueueStats{}, resp.Error
+		}
+	}
+
+	return QueueStats{
+		Ready:    responses[queueReady].GetInt64(),
+		Delayed:  responses[queueDelayed].GetInt64(),
+		InFlight: responses[queueInFlight].GetInt64(),
+		Dead:     responses[queueDead].GetInt64(),
+	}, nil
+}
+
+// Purge deletes every job of the queue, including the dead ones.
+func (q *RedisQueue) Purge() error {
+	return q.op.Delete(q.keys...).Error
+}
+
+// eval runs a script replying 1 on success and 0 when the job is not found.
+func (q *RedisQueue) eval(script string, args ...interface{}) error {
+	resp := q.op.Eval(script, q.keys, args)
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	if resp.GetInt64() == 0 {
+		return ErrQueueJobNotFound
+	}
+
+	return nil
+}
+
+// QueueHandler processes a job of QueueWorkerPool, the job is acknowledged when it returns nil and released for
+// a retry otherwise. ctx is cancelled when the pool shutdown times out.
+type QueueHandler func(ctx context.Context, job *QueueJob) error
+
+// QueueWorkerPool runs a QueueHandler on the jobs of a RedisQueue with concurrent workers, see NewQueueWorkerPool.
+type QueueWorkerPool struct {
+	queue   *RedisQueue
+	handler QueueHandler
+	// Concurrency is the number of workers
+	Concurrency int
+	// PollInterval is how long an idle worker waits before dequeuing again, DefaultRedisQueuePollInterval when created
+	PollInterval time.Duration
+	// RetryDelay returns the delay before a failed job is delivered again, doubling DefaultRedisQueueRetryDelay
+	// with each attempt when nil
+	RetryDelay func(job *QueueJob, err error) time.Duration
+	// ShutdownTimeout is how long Run waits for running jobs once its context is done before cancelling them,
+	// DefaultRedisQueueShutdownTimeout when created, 0 waits until they return
+	ShutdownTimeout time.Duration
+}
+
+// NewQueueWorkerPool returns a pool of concurrency workers running handler on the jobs of queue.
+func NewQueueWorkerPool(queue *RedisQueue, concurrency int, handler QueueHandler) *QueueWorkerPool {
+	return &QueueWorkerPool{
+		queue:           queue,
+		handler:         handler,
+		Concurrency:     concurrency,
+		PollInterval:    DefaultRedisQueuePollInterval,
+		ShutdownTimeout: DefaultRedisQueueShutdownTimeout,
+	}
+}
+
+// Run processes jobs until ctx is done, then stops dequeuing and returns once the running jobs returned.
+// Jobs still running after ShutdownTimeout have their context cancelled, Run keeps waiting for them.
+func (p *QueueWorkerPool) Run(ctx context.Context) {
+	handlerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	wg := sync.WaitGroup{}
+	for i := 0; i < max(p.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx, handlerCtx)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	<-ctx.Done()
+	if p.ShutdownTimeout > 0 {
+		timer := time.NewTimer(p.ShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+			kklogger.WarnJ("datastore:QueueWorkerPool.Run", fmt.Sprintf("queue %s shutdown timed out, cancelling running jobs", p.queue.name))
+			cancel()
+		}
+	}
+
+	<-done
+}
+
+func (p *QueueWorkerPool) work(ctx, handlerCtx context.Context) {
+	for ctx.Err() == nil {
+		job, err := p.queue.Dequeue()
+		if err != nil {
+			if !errors.Is(err, ErrQueueEmpty) {
+				kklogger.WarnJ("datastore:QueueWorkerPool.Dequeue", fmt.Sprintf("queue %s: %s", p.queue.name, err.Error()))
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(p.PollInterval):
+			}
+
+			continue
+		}
+
+		p.process(handlerCtx, job)
+	}
+}
+
+func (p *QueueWorkerPool) process(ctx context.Context, job *QueueJob) {
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("queue job panic: %v", r)
+			}
+		}()
+
+		return p.handler(ctx, job)
+	}()
+
+	if err == nil {
+		if err := p.queue.Ack(job); err != nil {
+			kklogger.WarnJ("datastore:QueueWorkerPool.Ack", fmt.Sprintf("queue %s job %s: %s", p.queue.name, job.ID, err.Error()))
+		}
+
+		return
+	}
+
+	delay := p.retryDelay(job, err)
+	if err := p.queue.Nack(job, delay); err != nil {
+		kklogger.WarnJ("datastore:QueueWorkerPool.Nack", fmt.Sprintf("queue %s job %s: %s", p.queue.name, job.ID, err.Error()))
+	}
+}
+
+func (p *QueueWorkerPool) retryDelay(job *QueueJob, err error) time.Duration {
+	if p.RetryDelay != nil {
+		return p.RetryDelay(job, err)
+	}
+
+	return DefaultRedisQueueRetryDelay << min(max(job.Attempts-1, 0), 16)
+}
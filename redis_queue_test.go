@@ -0,0 +1,245 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisQueue(t *testing.T) {
+	originalPath := secret.Path()
+	defer func() {
+		secret.PATH = originalPath
+	}()
+
+	wd, _ := os.Getwd()
+	secret.PATH = filepath.Join(wd, "example")
+	redis := NewRedis("test")
+	assert.NotNil(t, redis)
+	defer redis.Close()
+
+	newQueue := func(t *testing.T) *RedisQueue {
+		queue := NewRedisQueue(redis.Master(), "test_"+t.Name())
+		queue.Purge()
+		t.Cleanup(func() { queue.Purge() })
+		return queue
+	}
+
+	t.Run("Priority and ack", func(t *testing.T) {
+		queue := newQueue(t)
+		_, err := queue.Enqueue([]byte("first"))
+		assert.NoError(t, err)
+		_, err = queue.Enqueue([]byte("second"))
+		assert.NoError(t, err)
+		urgent, err := queue.EnqueueWithOptions([]byte("urgent"), EnqueueOptions{Priority: 10})
+		assert.NoError(t, err)
+
+		job, err := queue.Dequeue()
+		assert.NoError(t, err)
+		assert.Equal(t, urgent, job.ID)
+		assert.Equal(t, []byte("urgent"), job.Payload)
+		assert.Equal(t, 10, job.Priority)
+		assert.Equal(t, 1, job.Attempts)
+		assert.NoError(t, queue.Ack(job))
+		assert.ErrorIs(t, queue.Ack(job), ErrQueueJobNotFound)
+
+		job, err = queue.Dequeue()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("first"), job.Payload)
+		stats, err := queue.Stats()
+		assert.NoError(t, err)
+		assert.Equal(t, QueueStats{Ready: 1, InFlight: 1}, stats)
+
+		_, err = queue.EnqueueWithOptions(nil, EnqueueOptions{Priority: RedisQueueMaxPriority + 1})
+		assert.Error(t, err)
+	})
+
+	t.Run("Delay", func(t *testing.T) {
+		queue := newQueue(t)
+		_, err := queue.EnqueueWithOptions([]byte("later"), EnqueueOptions{Delay: 100 * time.Millisecond})
+		assert.NoError(t, err)
+		_, err = queue.Dequeue()
+		assert.ErrorIs(t, err, ErrQueueEmpty)
+
+		time.Sleep(150 * time.Millisecond)
+		job, err := queue.Dequeue()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("later"), job.Payload)
+	})
+
+	t.Run("Visibility and dead letter", func(t *testing.T) {
+		queue := newQueue(t)
+		queue.Visibility = 50 * time.Millisecond
+		queue.MaxAttempts = 2
+		id, _ := queue.Enqueue([]byte("poison"))
+
+		job, err := queue.Dequeue()
+		assert.NoError(t, err)
+		_, err = queue.Dequeue()
+		assert.ErrorIs(t, err, ErrQueueEmpty)
+
+		time.Sleep(80 * time.Millisecond)
+		job, err = queue.Dequeue()
+		assert.NoError(t, err)
+		assert.Equal(t, id, job.ID)
+		assert.Equal(t, 2, job.Attempts)
+
+		assert.NoError(t, queue.Nack(job, 0))
+		assert.ErrorIs(t, queue.Nack(job, 0), ErrQueueJobNotFound)
+		_, err = queue.Dequeue()
+		assert.ErrorIs(t, err, ErrQueueEmpty)
+
+		dead, err := queue.DeadJobs(10)
+		assert.NoError(t, err)
+		assert.Len(t, dead, 1)
+		assert.Equal(t, &QueueJob{ID: id, Payload: []byte("poison"), Attempts: 2}, dead[0])
+
+		assert.NoError(t, queue.Retry(id))
+		job, err = queue.Dequeue()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, job.Attempts)
+	})
+
+	t.Run("Nack delay and touch", func(t *testing.T) {
+		queue := newQueue(t)
+		queue.Visibility = 50 * time.Millisecond
+		queue.Enqueue([]byte("retry"))
+		job, _ := queue.Dequeue()
+		assert.NoError(t, queue.Nack(job, time.Hour))
+		stats, _ := queue.Stats()
+		assert.Equal(t, QueueStats{Delayed: 1}, stats)
+
+		queue.Enqueue([]byte("long"))
+		job, _ = queue.Dequeue()
+		assert.NoError(t, queue.Touch(job, time.Hour))
+		time.Sleep(80 * time.Millisecond)
+		_, err := queue.Dequeue()
+		assert.ErrorIs(t, err, ErrQueueEmpty)
+	})
+
+	t.Run("Stale delivery", func(t *testing.T) {
+		queue := newQueue(t)
+		queue.Visibility = 50 * time.Millisecond
+		queue.Enqueue([]byte("slow"))
+		stale, err := queue.Dequeue()
+		assert.NoError(t, err)
+		assert.Len(t, stale.Lease, 32)
+
+		time.Sleep(80 * time.Millisecond)
+		job, err := queue.Dequeue()
+		assert.NoError(t, err)
+		assert.Equal(t, stale.ID, job.ID)
+		assert.NotEqual(t, stale.Lease, job.Lease)
+
+		// The first worker finishing late cannot complete or release the new delivery
+		assert.ErrorIs(t, queue.Touch(stale, time.Hour), ErrQueueJobNotFound)
+		assert.ErrorIs(t, queue.Ack(stale), ErrQueueJobNotFound)
+		assert.ErrorIs(t, queue.Nack(stale, 0), ErrQueueJobNotFound)
+		stats, _ := queue.Stats()
+		assert.Equal(t, QueueStats{InFlight: 1}, stats)
+		assert.NoError(t, queue.Touch(job, time.Hour))
+		assert.NoError(t, queue.Ack(job))
+		stats, _ = queue.Stats()
+		assert.Equal(t, QueueStats{}, stats)
+	})
+
+	t.Run("Worker pool", func(t *testing.T) {
+		queue := newQueue(t)
+		for i := 0; i < 10; i++ {
+			queue.Enqueue([]byte{byte(i)})
+		}
+
+		mutex := sync.Mutex{}
+		processed := map[byte]int{}
+		pool := NewQueueWorkerPool(queue, 3, func(ctx context.Context, job *QueueJob) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			processed[job.Payload[0]]++
+			if job.Payload[0] == 0 && job.Attempts == 1 {
+				return errors.New("fail once")
+			}
+
+			if job.Payload[0] == 1 && job.Attempts == 1 {
+				panic("panic once")
+			}
+
+			return nil
+		})
+		pool.PollInterval = 10 * time.Millisecond
+		pool.RetryDelay = func(job *QueueJob, err error) time.Duration { return 0 }
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			pool.Run(ctx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			stats, _ := queue.Stats()
+			return stats == QueueStats{}
+		}, 2*time.Second, 10*time.Millisecond)
+		cancel()
+		<-done
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Len(t, processed, 10)
+		assert.Equal(t, 2, processed[0])
+		assert.Equal(t, 2, processed[1])
+		assert.Equal(t, 1, processed[2])
+	})
+
+	t.Run("Graceful shutdown", func(t *testing.T) {
+		queue := newQueue(t)
+		queue.Enqueue([]byte("slow"))
+		started := make(chan struct{})
+		pool := NewQueueWorkerPool(queue, 1, func(ctx context.Context, job *QueueJob) error {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(100 * time.Millisecond):
+				return nil
+			}
+		})
+		pool.PollInterval = 10 * time.Millisecond
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		pool.Run(ctx)
+		stats, _ := queue.Stats()
+		assert.Equal(t, QueueStats{}, stats)
+
+		queue.Enqueue([]byte("stuck"))
+		started = make(chan struct{})
+		pool.ShutdownTimeout = 20 * time.Millisecond
+		pool.RetryDelay = func(job *QueueJob, err error) time.Duration { return time.Hour }
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+
+		pool.handler = func(ctx context.Context, job *QueueJob) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		pool.Run(ctx)
+		stats, _ = queue.Stats()
+		assert.Equal(t, QueueStats{Delayed: 1}, stats)
+	})
+}
@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ScanResult is a page of a SCAN, HSCAN, SSCAN or ZSCAN reply, returned by the ScanTyped methods.
+// Scan the next page with Cursor until Done.
+type ScanResult struct {
+	cursor int64
+	items  []RedisResponseEntity
+}
+
+// ScanPair is a field and its value of a HSCAN page, or a member and its score of a ZSCAN page.
+type ScanPair struct {
+	Field string
+	Value RedisResponseEntity
+}
+
+// Cursor returns the cursor of the next page, 0 when the iteration is complete.
+func (r *ScanResult) Cursor() int64 {
+	return r.cursor
+}
+
+// Done reports whether the iteration is complete.
+func (r *ScanResult) Done() bool {
+	return r.cursor == 0
+}
+
+// Items returns the elements of the page: keys for SCAN, members for SSCAN, and fields and values, or members and
+// scores, alternating for HSCAN and ZSCAN.
+func (r *ScanResult) Items() []RedisResponseEntity {
+	return r.items
+}
+
+// Pairs returns the elements of a HSCAN or ZSCAN page as field/value pairs.
+func (r *ScanResult) Pairs() []ScanPair {
+	pairs := make([]ScanPair, 0, len(r.items)/2)
+	for i := 0; i+1 < len(r.items); i += 2 {
+		pairs = append(pairs, ScanPair{Field: r.items[i].GetString(), Value: r.items[i+1]})
+	}
+
+	return pairs
+}
+
+func newScanResult(resp *RedisResponse) (*ScanResult, error) {
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	parts := resp.GetSlice()
+	if len(parts) != 2 {
+		return nil, errors.New("invalid scan response")
+	}
+
+	cursor, err := parts[0].TryGetInt64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid scan cursor: %w", err)
+	}
+
+	return &ScanResult{cursor: cursor, items: parts[1].GetSlice()}, nil
+}
+
+// scanArgs appends the cursor and the MATCH and COUNT options of a scan command to args.
+func scanArgs(args []interface{}, cursor int64, match string, count int64) []interface{} {
+	args = append(args, cursor)
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+
+	return args
+}
@@ -0,0 +1,126 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisScanTyped(t *testing.T) {
+	t.Run("Mock", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.SetSequentialResponses("SCAN", "*", []MockResponse{
+			{Data: []interface{}{[]byte("17"), []interface{}{[]byte("a"), []byte("b")}}},
+			{Data: []interface{}{[]byte("0"), []interface{}{[]byte("c")}}},
+		})
+
+		var keys []string
+		cursor := int64(0)
+		for {
+			page, err := op.ScanTyped(cursor, "*", 2)
+			assert.NoError(t, err)
+			for _, item := range page.Items() {
+				keys = append(keys, item.GetString())
+			}
+
+			if cursor = page.Cursor(); page.Done() {
+				break
+			}
+
+			assert.Equal(t, int64(17), cursor)
+		}
+
+		assert.Equal(t, []string{"a", "b", "c"}, keys)
+		assert.Equal(t, []interface{}{int64(17), "MATCH", "*", "COUNT", int64(2)}, op.GetCallsByCommand("SCAN")[1].Args)
+
+		op.SetResponse("HSCAN", "hash", []interface{}{"0", []interface{}{"name", "alice", "age", int64(30)}}, nil)
+		page, err := op.HScanTyped("hash", 0, "", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []ScanPair{
+			{Field: "name", Value: RedisResponseEntity{data: "alice"}},
+			{Field: "age", Value: RedisResponseEntity{data: int64(30)}},
+		}, page.Pairs())
+
+		op.SetResponse("ZSCAN", "zset", []interface{}{"0", []interface{}{"a", "1.5"}}, nil)
+		page, err = op.ZScanTyped("zset", 0, "", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.5, page.Pairs()[0].Value.GetFloat64())
+
+		op.SetResponse("SSCAN", "set", []interface{}{"x", []interface{}{}}, nil)
+		_, err = op.SScanTyped("set", 0, "", 0)
+		assert.ErrorIs(t, err, ErrRedisConversion)
+
+		op.SetResponse("SSCAN", "broken", "OK", nil)
+		_, err = op.SScanTyped("broken", 0, "", 0)
+		assert.EqualError(t, err, "invalid scan response")
+
+		failure := errors.New("failure")
+		op.SetResponse("SSCAN", "failing", nil, failure)
+		_, err = op.SScanTyped("failing", 0, "", 0)
+		assert.ErrorIs(t, err, failure)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		op := redis.Master()
+		defer op.Delete("test_scan_hash", "test_scan_set", "test_scan_zset")
+		fields := map[interface{}]interface{}{}
+		for i := 0; i < 20; i++ {
+			fields[fmt.Sprintf("f%d", i)] = i
+			op.SAdd("test_scan_set", i)
+			op.ZAdd("test_scan_zset", float64(i), fmt.Sprintf("m%d", i))
+		}
+		op.HMSet("test_scan_hash", fields)
+
+		collect := func(scan func(cursor int64) (*ScanResult, error)) []ScanPair {
+			var pairs []ScanPair
+			for cursor := int64(0); ; {
+				page, err := scan(cursor)
+				if !assert.NoError(t, err) {
+					return nil
+				}
+
+				pairs = append(pairs, page.Pairs()...)
+				if cursor = page.Cursor(); page.Done() {
+					return pairs
+				}
+			}
+		}
+
+		hash := collect(func(cursor int64) (*ScanResult, error) { return op.HScanTyped("test_scan_hash", cursor, "", 5) })
+		assert.Len(t, hash, 20)
+		for _, pair := range hash {
+			assert.Equal(t, pair.Field, "f"+pair.Value.GetString())
+		}
+
+		zset := collect(func(cursor int64) (*ScanResult, error) { return op.ZScanTyped("test_scan_zset", cursor, "m1*", 5) })
+		assert.Len(t, zset, 11)
+		for _, pair := range zset {
+			assert.Equal(t, pair.Field, fmt.Sprintf("m%d", int(pair.Value.GetFloat64())))
+		}
+
+		page, err := op.SScanTyped("test_scan_set", 0, "", 100)
+		assert.NoError(t, err)
+		assert.True(t, page.Done())
+		assert.Len(t, page.Items(), 20)
+
+		page, err = op.ScanTyped(0, "test_scan_*", 1000)
+		assert.NoError(t, err)
+		assert.NotNil(t, page)
+	})
+}
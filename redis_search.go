@@ -0,0 +1,677 @@
+package datastore
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ErrRedisSearchIndexExists is returned by RedisSearch.CreateIndex when the index already exists.
+var ErrRedisSearchIndexExists = errors.New("redis search index exists")
+
+// Field types of FTField.
+const (
+	FTFieldText    = "TEXT"
+	FTFieldTag     = "TAG"
+	FTFieldNumeric = "NUMERIC"
+	FTFieldGeo     = "GEO"
+	FTFieldVector  = "VECTOR"
+)
+
+// RedisSearch runs the FT.* commands of RediSearch, see NewRedisSearch.
+// Commands fail with ErrRedisModuleNotLoaded when the server does not provide RediSearch, call Available at startup
+// to detect it early. Replies are parsed from RESP2 and RESP3, whatever DefaultRedisProtocol is.
+type RedisSearch struct {
+	op     RedisOperator
+	module redisModule
+}
+
+// NewRedisSearch returns the RediSearch helpers of op.
+func NewRedisSearch(op RedisOperator) *RedisSearch {
+	return &RedisSearch{op: op, module: redisModule{name: "search", command: "FT.SEARCH"}}
+}
+
+// Available returns ErrRedisModuleNotLoaded when the server does not provide RediSearch.
+func (s *RedisSearch) Available() error {
+	return s.module.check(s.op)
+}
+
+// FTField is a field of the schema of an index.
+type FTField struct {
+	// Name is the hash field, or the JSONPath for JSON documents, e.g. "$.title"
+	Name string
+	// As is the attribute name used in queries, required for JSONPath names
+	As string
+	// Type is FTFieldText, FTFieldTag, FTFieldNumeric, FTFieldGeo or FTFieldVector
+	Type     string
+	Sortable bool
+	NoIndex  bool
+	// Weight of TEXT fields in the score, 1 by the server when 0
+	Weight float64
+	// Separator of TAG values, "," by the server when empty
+	Separator string
+	// Args are appended to the field definition, e.g. the algorithm and attributes of a VECTOR field
+	Args []interface{}
+}
+
+// FTCreateOptions configures RedisSearch.CreateIndex.
+type FTCreateOptions struct {
+	// OnJSON indexes JSON documents instead of hashes
+	OnJSON bool
+	// Prefixes selects the indexed keys, every key when empty
+	Prefixes []string
+	// Filter is an expression selecting the indexed documents, e.g. "@age>16"
+	Filter string
+	// Language of the TEXT fields for stemming, English by the server when empty
+	Language string
+}
+
+// CreateIndex creates index with the fields, ErrRedisSearchIndexExists when it already exists.
+func (s *RedisSearch) CreateIndex(index string, opts FTCreateOptions, fields ...FTField) error {
+	args := []interface{}{index, "ON", "HASH"}
+	if opts.OnJSON {
+		args[2] = "JSON"
+	}
+
+	if len(opts.Prefixes) > 0 {
+		args = append(args, "PREFIX", len(opts.Prefixes))
+		for _, prefix := range opts.Prefixes {
+			args = append(args, prefix)
+		}
+	}
+
+	if opts.Filter != "" {
+		args = append(args, "FILTER", opts.Filter)
+	}
+
+	if opts.Language != "" {
+		args = append(args, "LANGUAGE", opts.Language)
+	}
+
+	args = append(args, "SCHEMA")
+	for _, field := range fields {
+		args = append(args, field.Name)
+		if field.As != "" {
+			args = append(args, "AS", field.As)
+		}
+
+		args = append(args, field.Type)
+		args = append(args, field.Args...)
+		if field.Weight > 0 {
+			args = append(args, "WEIGHT", field.Weight)
+		}
+
+		if field.Separator != "" {
+			args = append(args, "SEPARATOR", field.Separator)
+		}
+
+		if field.Sortable {
+			args = append(args, "SORTABLE")
+		}
+
+		if field.NoIndex {
+			args = append(args, "NOINDEX")
+		}
+	}
+
+	err := s.do("FT.CREATE", args...).Error
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "index already exists") {
+		return fmt.Errorf("%w: %s", ErrRedisSearchIndexExists, index)
+	}
+
+	return err
+}
+
+// DropIndex drops index, deleteDocuments also deletes the indexed keys.
+func (s *RedisSearch) DropIndex(index string, deleteDocuments bool) error {
+	args := []interface{}{index}
+	if deleteDocuments {
+		args = append(args, "DD")
+	}
+
+	return s.do("FT.DROPINDEX", args...).Error
+}
+
+// FTQuery is a query of RedisSearch.Search, see NewFTQuery.
+type FTQuery struct {
+	query      string
+	returns    []string
+	offset     int64
+	num        int64
+	sortBy     string
+	descending bool
+	withScores bool
+	noContent  bool
+	verbatim   bool
+	language   string
+	params     []interface{}
+	dialect    int
+}
+
+// NewFTQuery returns a query of the documents matching query, e.g. built with FTAnd, FTTag and FTRange.
+func NewFTQuery(query string) *FTQuery {
+	return &FTQuery{query: query, num: -1}
+}
+
+// Return only returns the fields of the documents.
+func (q *FTQuery) Return(fields ...string) *FTQuery {
+	q.returns = append(q.returns, fields...)
+	return q
+}
+
+// Limit returns num documents from offset, 10 by the server when not set.
+func (q *FTQuery) Limit(offset, num int64) *FTQuery {
+	q.offset, q.num = offset, num
+	return q
+}
+
+// SortBy orders the documents by a SORTABLE field.
+func (q *FTQuery) SortBy(field string, ascending bool) *FTQuery {
+	q.sortBy, q.descending = field, !ascending
+	return q
+}
+
+// WithScores returns the relevance score of the documents.
+func (q *FTQuery) WithScores() *FTQuery {
+	q.withScores = true
+	return q
+}
+
+// NoContent only returns the document ids.
+func (q *FTQuery) NoContent() *FTQuery {
+	q.noContent = true
+	return q
+}
+
+// Verbatim disables stemming of the query terms.
+func (q *FTQuery) Verbatim() *FTQuery {
+	q.verbatim = true
+	return q
+}
+
+// Language sets the language of the query terms for stemming.
+func (q *FTQuery) Language(language string) *FTQuery {
+	q.language = language
+	return q
+}
+
+// Param sets the value of $name in the query, which then uses dialect 2 unless set otherwise.
+func (q *FTQuery) Param(name string, value interface{}) *FTQuery {
+	q.params = append(q.params, name, value)
+	return q
+}
+
+// Dialect sets the query dialect.
+func (q *FTQuery) Dialect(dialect int) *FTQuery {
+	q.dialect = dialect
+	return q
+}
+
+func (q *FTQuery) args(index string) []interface{} {
+	args := []interface{}{index, q.query}
+	if q.noContent {
+		args = append(args, "NOCONTENT")
+	}
+
+	if q.verbatim {
+		args = append(args, "VERBATIM")
+	}
+
+	if q.withScores {
+		args = append(args, "WITHSCORES")
+	}
+
+	if len(q.returns) > 0 && !q.noContent {
+		args = append(args, "RETURN", len(q.returns))
+		for _, field := range q.returns {
+			args = append(args, field)
+		}
+	}
+
+	if q.sortBy != "" {
+		order := "ASC"
+		if q.descending {
+			order = "DESC"
+		}
+
+		args = append(args, "SORTBY", q.sortBy, order)
+	}
+
+	if q.language != "" {
+		args = append(args, "LANGUAGE", q.language)
+	}
+
+	if q.num >= 0 {
+		args = append(args, "LIMIT", q.offset, q.num)
+	}
+
+	if len(q.params) > 0 {
+		args = append(append(args, "PARAMS", len(q.params)), q.params...)
+	}
+
+	if dialect := q.dialect; dialect > 0 || len(q.params) > 0 {
+		args = append(args, "DIALECT", max(dialect, 2))
+	}
+
+	return args
+}
+
+// FTDocument is a document found by RedisSearch.Search.
+type FTDocument struct {
+	ID string
+	// Score is the relevance of the document, set with FTQuery.WithScores
+	Score  float64
+	Fields map[string]string
+}
+
+// Decode decodes the document into v, from its JSON for documents of JSON indexes, from its fields otherwise.
+// Fields are matched by the redis tag, the json tag or the name of the struct fields.
+func (d FTDocument) Decode(v interface{}) error {
+	if doc, ok := d.Fields["$"]; ok {
+		return json.Unmarshal([]byte(doc), v)
+	}
+
+	return bindRedisFields(d.Fields, v)
+}
+
+// FTSearchResult are the documents found by RedisSearch.Search.
+type FTSearchResult struct {
+	// Total is the number of matching documents, including those beyond the limit
+	Total     int64
+	Documents []FTDocument
+}
+
+// Search returns the documents of index matching query.
+func (s *RedisSearch) Search(index string, query *FTQuery) (*FTSearchResult, error) {
+	resp := s.do("FT.SEARCH", query.args(index)...)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	result := &FTSearchResult{}
+	if reply, ok := resp.data.(map[interface{}]interface{}); ok {
+		result.Total = (&RedisResponseEntity{data: reply["total_results"]}).GetInt64()
+		for _, entry := range (&RedisResponseEntity{data: reply["results"]}).GetSlice() {
+			doc, _ := entry.data.(map[interface{}]interface{})
+			result.Documents = append(result.Documents, FTDocument{
+				ID:     (&RedisResponseEntity{data: doc["id"]}).GetString(),
+				Score:  (&RedisResponseEntity{data: doc["score"]}).GetFloat64(),
+				Fields: redisStringMap(doc["extra_attributes"]),
+			})
+		}
+
+		return result, nil
+	}
+
+	// RESP2 replies the total then the id, the score and the fields of each document as requested
+	reply := resp.GetSlice()
+	if len(reply) == 0 {
+		return nil, errors.New("invalid search response")
+	}
+
+	result.Total = reply[0].GetInt64()
+	for i := 1; i < len(reply); {
+		doc := FTDocument{ID: reply[i].GetString()}
+		i++
+		if query.withScores && i < len(reply) {
+			doc.Score = reply[i].GetFloat64()
+			i++
+		}
+
+		if !query.noContent && i < len(reply) {
+			doc.Fields = redisStringMap(reply[i].data)
+			i++
+		}
+
+		result.Documents = append(result.Documents, doc)
+	}
+
+	return result, nil
+}
+
+// FTSearchAs returns the documents of index matching query decoded into T, see FTDocument.Decode,
+// and the number of matching documents.
+func FTSearchAs[T any](s *RedisSearch, index string, query *FTQuery) ([]T, int64, error) {
+	result, err := s.Search(index, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	docs := make([]T, 0, len(result.Documents))
+	for _, doc := range result.Documents {
+		var v T
+		if err := doc.Decode(&v); err != nil {
+			return nil, 0, fmt.Errorf("document %s: %w", doc.ID, err)
+		}
+
+		docs = append(docs, v)
+	}
+
+	return docs, result.Total, nil
+}
+
+// FTAggregate is an aggregation of RedisSearch.Aggregate, see NewFTAggregate.
+// Steps are applied in the order they are added.
+type FTAggregate struct {
+	query   string
+	steps   []interface{}
+	params  []interface{}
+	dialect int
+}
+
+// NewFTAggregate returns an aggregation of the documents matching query.
+func NewFTAggregate(query string) *FTAggregate {
+	return &FTAggregate{query: query}
+}
+
+// Load loads document fields which are not SORTABLE, to be used by the following steps.
+func (a *FTAggregate) Load(fields ...string) *FTAggregate {
+	a.steps = append(a.steps, "LOAD", len(fields))
+	for _, field := range fields {
+		a.steps = append(a.steps, ftProperty(field))
+	}
+
+	return a
+}
+
+// GroupBy groups the rows by fields, followed by the Reduce steps computing the group values.
+func (a *FTAggregate) GroupBy(fields ...string) *FTAggregate {
+	a.steps = append(a.steps, "GROUPBY", len(fields))
+	for _, field := range fields {
+		a.steps = append(a.steps, ftProperty(field))
+	}
+
+	return a
+}
+
+// Reduce adds the value of function over the rows of each group as alias, e.g. Reduce("SUM", "total", "@price").
+func (a *FTAggregate) Reduce(function, alias string, args ...interface{}) *FTAggregate {
+	a.steps = append(append(a.steps, "REDUCE", function, len(args)), args...)
+	if alias != "" {
+		a.steps = append(a.steps, "AS", alias)
+	}
+
+	return a
+}
+
+// Apply adds the value of expr as alias to each row, e.g. Apply("@price * @quantity", "total").
+func (a *FTAggregate) Apply(expr, alias string) *FTAggregate {
+	a.steps = append(a.steps, "APPLY", expr, "AS", alias)
+	return a
+}
+
+// Filter keeps the rows matching expr, e.g. Filter("@total > 100").
+func (a *FTAggregate) Filter(expr string) *FTAggregate {
+	a.steps = append(a.steps, "FILTER", expr)
+	return a
+}
+
+// SortBy orders the rows by field.
+func (a *FTAggregate) SortBy(field string, ascending bool) *FTAggregate {
+	order := "ASC"
+	if !ascending {
+		order = "DESC"
+	}
+
+	a.steps = append(a.steps, "SORTBY", 2, ftProperty(field), order)
+	return a
+}
+
+// Limit keeps num rows from offset.
+func (a *FTAggregate) Limit(offset, num int64) *FTAggregate {
+	a.steps = append(a.steps, "LIMIT", offset, num)
+	return a
+}
+
+// Param sets the value of $name in the query, which then uses dialect 2 unless set otherwise.
+func (a *FTAggregate) Param(name string, value interface{}) *FTAggregate {
+	a.params = append(a.params, name, value)
+	return a
+}
+
+// Dialect sets the query dialect.
+func (a *FTAggregate) Dialect(dialect int) *FTAggregate {
+	a.dialect = dialect
+	return a
+}
+
+func (a *FTAggregate) args(index string) []interface{} {
+	args := append([]interface{}{index, a.query}, a.steps...)
+	if len(a.params) > 0 {
+		args = append(append(args, "PARAMS", len(a.params)), a.params...)
+	}
+
+	if dialect := a.dialect; dialect > 0 || len(a.params) > 0 {
+		args = append(args, "DIALECT", max(dialect, 2))
+	}
+
+	return args
+}
+
+// FTAggregateResult are the rows of RedisSearch.Aggregate.
+type FTAggregateResult struct {
+	Total int64
+	Rows  []map[string]string
+}
+
+// Aggregate runs aggregation on index.
+func (s *RedisSearch) Aggregate(index string, aggregation *FTAggregate) (*FTAggregateResult, error) {
+	resp := s.do("FT.AGGREGATE", aggregation.args(index)...)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	result := &FTAggregateResult{}
+	if reply, ok := resp.data.(map[interface{}]interface{}); ok {
+		result.Total = (&RedisResponseEntity{data: reply["total_results"]}).GetInt64()
+		for _, entry := range (&RedisResponseEntity{data: reply["results"]}).GetSlice() {
+			row, _ := entry.data.(map[interface{}]interface{})
+			result.Rows = append(result.Rows, redisStringMap(row["extra_attributes"]))
+		}
+
+		return result, nil
+	}
+
+	reply := resp.GetSlice()
+	if len(reply) == 0 {
+		return nil, errors.New("invalid aggregate response")
+	}
+
+	result.Total = reply[0].GetInt64()
+	for _, row := range reply[1:] {
+		result.Rows = append(result.Rows, redisStringMap(row.data))
+	}
+
+	return result, nil
+}
+
+func (s *RedisSearch) do(cmd string, args ...interface{}) *RedisResponse {
+	if err := s.module.check(s.op); err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return s.op.Do(cmd, args...)
+}
+
+// ftEscaper escapes the characters RediSearch treats as syntax in terms and tags.
+var ftEscaper = strings.NewReplacer(
+	",", `\,`, ".", `\.`, "<", `\<`, ">", `\>`, "{", `\{`, "}", `\}`, "[", `\[`, "]", `\]`,
+	`"`, `\"`, "'", `\'`, ":", `\:`, ";", `\;`, "!", `\!`, "@", `\@`, "#", `\#`, "$", `\$`,
+	"%", `\%`, "^", `\^`, "&", `\&`, "*", `\*`, "(", `\(`, ")", `\)`, "-", `\-`, "+", `\+`,
+	"=", `\=`, "~", `\~`, "|", `\|`, "/", `\/`, `\`, `\\`, " ", `\ `,
+)
+
+// FTEscape escapes value to be matched literally in a query.
+func FTEscape(value string) string {
+	return ftEscaper.Replace(value)
+}
+
+// FTMatch matches the query terms in a TEXT field, e.g. FTMatch("title", "redis | cache"), terms are not escaped.
+func FTMatch(field, terms string) string {
+	return fmt.Sprintf("@%s:(%s)", field, terms)
+}
+
+// FTTag matches any of values in a TAG field, values are escaped.
+func FTTag(field string, values ...string) string {
+	escaped := make([]string, 0, len(values))
+	for _, value := range values {
+		escaped = append(escaped, FTEscape(value))
+	}
+
+	return fmt.Sprintf("@%s:{%s}", field, strings.Join(escaped, " | "))
+}
+
+// FTRange matches a NUMERIC field from min to max inclusive, infinite bounds are open.
+func FTRange(field string, min, max float64) string {
+	return fmt.Sprintf("@%s:[%s %s]", field, ftNumber(min), ftNumber(max))
+}
+
+// FTAnd matches the documents matching every part.
+func FTAnd(parts ...string) string {
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// FTOr matches the documents matching any of parts.
+func FTOr(parts ...string) string {
+	return "(" + strings.Join(parts, " | ") + ")"
+}
+
+// FTNot matches the documents not matching part.
+func FTNot(part string) string {
+	return "-(" + part + ")"
+}
+
+func ftNumber(n float64) string {
+	switch {
+	case math.IsInf(n, 1):
+		return "+inf"
+	case math.IsInf(n, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+}
+
+func ftProperty(field string) string {
+	if strings.HasPrefix(field, "@") {
+		return field
+	}
+
+	return "@" + field
+}
+
+// redisStringMap converts a RESP3 map or a RESP2 flat array of field value pairs.
+func redisStringMap(data interface{}) map[string]string {
+	fields := map[string]string{}
+	switch v := data.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			fields[(&RedisResponseEntity{data: key}).GetString()] = (&RedisResponseEntity{data: value}).GetString()
+		}
+	case []interface{}:
+		for i := 0; i+1 < len(v); i += 2 {
+			fields[(&RedisResponseEntity{data: v[i]}).GetString()] = (&RedisResponseEntity{data: v[i+1]}).GetString()
+		}
+	}
+
+	return fields
+}
+
+// bindRedisFields sets the fields of the struct pointed by v from fields, matched by the redis tag, the json tag or
+// the field name. Strings are parsed for numbers and booleans, other types are decoded from JSON.
+func bindRedisFields(fields map[string]string, v interface{}) error {
+	if m, ok := v.(*map[string]string); ok {
+		*m = fields
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind target %T is not a struct pointer", v)
+	}
+
+	rv = rv.Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("redis"), ",")[0]; tag != "" {
+			name = tag
+		} else if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" {
+			name = tag
+		}
+
+		value, ok := fields[name]
+		if name == "-" || !ok {
+			continue
+		}
+
+		if err := bindRedisValue(rv.Field(i), value); err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func bindRedisValue(target reflect.Value, value string) error {
+	if target.Kind() == reflect.Pointer {
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		target.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		target.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		target.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, target.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		target.SetFloat(f)
+	default:
+		if target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8 {
+			target.SetBytes([]byte(value))
+			return nil
+		}
+
+		// e.g. time.Time from RFC 3339
+		if unmarshaler, ok := target.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return unmarshaler.UnmarshalText([]byte(value))
+		}
+
+		return json.Unmarshal([]byte(value), target.Addr().Interface())
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisSearch(t *testing.T) {
+	type product struct {
+		Name    string    `redis:"name"`
+		Price   float64   `json:"price"`
+		Stock   int       `redis:"stock"`
+		Tags    []string  `redis:"tags"`
+		Updated time.Time `redis:"updated"`
+	}
+
+	newSearch := func() (*MockRedisOp, *RedisSearch) {
+		op := NewMockRedisOp()
+		op.SetResponse("COMMAND", "INFO", []interface{}{[]interface{}{"ft.search"}}, nil)
+		return op, NewRedisSearch(op)
+	}
+
+	t.Run("Create index", func(t *testing.T) {
+		op, search := newSearch()
+		assert.NoError(t, search.Available())
+		assert.NoError(t, search.CreateIndex("products", FTCreateOptions{Prefixes: []string{"product:"}},
+			FTField{Name: "name", Type: FTFieldText, Weight: 2, Sortable: true},
+			FTField{Name: "tags", Type: FTFieldTag, Separator: "|"},
+			FTField{Name: "price", Type: FTFieldNumeric, Sortable: true},
+		))
+		assert.Equal(t, []interface{}{"products", "ON", "HASH", "PREFIX", 1, "product:", "SCHEMA",
+			"name", "TEXT", "WEIGHT", 2.0, "SORTABLE", "tags", "TAG", "SEPARATOR", "|", "price", "NUMERIC", "SORTABLE"},
+			op.GetCallsByCommand("FT.CREATE")[0].Args)
+
+		op.SetResponse("FT.CREATE", "products", nil, assert.AnError)
+		assert.ErrorIs(t, search.CreateIndex("products", FTCreateOptions{}), assert.AnError)
+		op.SetResponse("FT.CREATE", "products", nil, errors.New("Index already exists"))
+		assert.ErrorIs(t, search.CreateIndex("products", FTCreateOptions{OnJSON: true}), ErrRedisSearchIndexExists)
+	})
+
+	t.Run("Query builder", func(t *testing.T) {
+		query := FTAnd(FTMatch("name", "red | blue"), FTTag("tags", "on sale", "new-in"), FTNot(FTRange("price", 100, math.Inf(1))))
+		assert.Equal(t, `(@name:(red | blue) @tags:{on\ sale | new\-in} -(@price:[100 +inf]))`, query)
+		assert.Equal(t, `a\.b\@c\\d`, FTEscape(`a.b@c\d`))
+		assert.Equal(t, `(@a:[-inf 1.5] | @b:{x})`, FTOr(FTRange("a", math.Inf(-1), 1.5), FTTag("b", "x")))
+
+		args := NewFTQuery("@name:$name").Param("name", "red").Return("name", "price").SortBy("price", false).
+			Limit(10, 5).WithScores().Verbatim().args("products")
+		assert.Equal(t, []interface{}{"products", "@name:$name", "VERBATIM", "WITHSCORES", "RETURN", 2, "name", "price",
+			"SORTBY", "price", "DESC", "LIMIT", int64(10), int64(5), "PARAMS", 2, "name", "red", "DIALECT", 2},
+			args)
+		assert.Equal(t, []interface{}{"products", "*", "NOCONTENT", "DIALECT", 3}, NewFTQuery("*").NoContent().Dialect(3).args("products"))
+	})
+
+	t.Run("Search RESP3", func(t *testing.T) {
+		op, search := newSearch()
+		op.SetResponse("FT.SEARCH", "products", map[interface{}]interface{}{
+			"total_results": int64(12),
+			"results": []interface{}{
+				map[interface{}]interface{}{"id": "product:1", "score": 1.5, "extra_attributes": map[interface{}]interface{}{
+					"name": "red shoe", "price": "9.5", "stock": "3", "tags": `["a","b"]`, "updated": "2024-01-02T03:04:05Z",
+				}},
+				map[interface{}]interface{}{"id": "product:2", "extra_attributes": map[interface{}]interface{}{"name": "blue shoe"}},
+			},
+		}, nil)
+
+		result, err := search.Search("products", NewFTQuery("shoe").WithScores())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(12), result.Total)
+		assert.Len(t, result.Documents, 2)
+		assert.Equal(t, "product:1", result.Documents[0].ID)
+		assert.Equal(t, 1.5, result.Documents[0].Score)
+
+		products, total, err := FTSearchAs[product](search, "products", NewFTQuery("shoe"))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(12), total)
+		assert.Equal(t, product{Name: "red shoe", Price: 9.5, Stock: 3, Tags: []string{"a", "b"},
+			Updated: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}, products[0])
+		assert.Equal(t, "blue shoe", products[1].Name)
+	})
+
+	t.Run("Search RESP2", func(t *testing.T) {
+		op, search := newSearch()
+		op.SetResponse("FT.SEARCH", "products", []interface{}{
+			int64(2),
+			"product:1", "2.5", []interface{}{"name", "red shoe", "stock", "x"},
+			"product:2", "1", []interface{}{"$", `{"name":"json shoe","price":3}`},
+		}, nil)
+
+		result, err := search.Search("products", NewFTQuery("shoe").WithScores())
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), result.Total)
+		assert.Equal(t, FTDocument{ID: "product:1", Score: 2.5, Fields: map[string]string{"name": "red shoe", "stock": "x"}},
+			result.Documents[0])
+
+		var doc product
+		assert.Error(t, result.Documents[0].Decode(&doc))
+		assert.NoError(t, result.Documents[1].Decode(&doc))
+		assert.Equal(t, product{Name: "json shoe", Price: 3}, doc)
+
+		op.SetResponse("FT.SEARCH", "ids", []interface{}{int64(2), "product:1", "product:2"}, nil)
+		result, err = search.Search("ids", NewFTQuery("*").NoContent())
+		assert.NoError(t, err)
+		assert.Equal(t, []FTDocument{{ID: "product:1"}, {ID: "product:2"}}, result.Documents)
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		op, search := newSearch()
+		aggregation := NewFTAggregate("*").Load("price").GroupBy("@tags").Reduce("SUM", "total", "@price").
+			Reduce("COUNT", "count").Apply("@total / @count", "average").Filter("@count > 1").SortBy("total", false).Limit(0, 10)
+		assert.Equal(t, []interface{}{"products", "*", "LOAD", 1, "@price", "GROUPBY", 1, "@tags",
+			"REDUCE", "SUM", 1, "@price", "AS", "total", "REDUCE", "COUNT", 0, "AS", "count",
+			"APPLY", "@total / @count", "AS", "average", "FILTER", "@count > 1", "SORTBY", 2, "@total", "DESC",
+			"LIMIT", int64(0), int64(10)}, aggregation.args("products"))
+
+		op.SetResponse("FT.AGGREGATE", "products", []interface{}{int64(2),
+			[]interface{}{"tags", "a", "total", "30"}, []interface{}{"tags", "b", "total", "10"}}, nil)
+		result, err := search.Aggregate("products", aggregation)
+		assert.NoError(t, err)
+		assert.Equal(t, &FTAggregateResult{Total: 2, Rows: []map[string]string{{"tags": "a", "total": "30"}, {"tags": "b", "total": "10"}}}, result)
+
+		op.SetResponse("FT.AGGREGATE", "products", map[interface{}]interface{}{"total_results": int64(1), "results": []interface{}{
+			map[interface{}]interface{}{"extra_attributes": map[interface{}]interface{}{"tags": "a", "total": int64(30)}},
+		}}, nil)
+		result, err = search.Aggregate("products", aggregation)
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]string{{"tags": "a", "total": "30"}}, result.Rows)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		search := NewRedisSearch(redis.Master())
+		if err := search.Available(); err != nil {
+			assert.ErrorIs(t, err, ErrRedisModuleNotLoaded)
+			_, err = search.Search("products", NewFTQuery("*"))
+			assert.ErrorIs(t, err, ErrRedisModuleNotLoaded)
+			return
+		}
+
+		search.DropIndex("test_products", true)
+		assert.NoError(t, search.CreateIndex("test_products", FTCreateOptions{Prefixes: []string{"test_product:"}},
+			FTField{Name: "name", Type: FTFieldText}))
+		defer search.DropIndex("test_products", true)
+		redis.Master().HSet("test_product:1", "name", "red shoe")
+		assert.Eventually(t, func() bool {
+			result, err := search.Search("test_products", NewFTQuery("shoe"))
+			return err == nil && result.Total == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+}
@@ -0,0 +1,103 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SeedRedis sets the string keys of values in one pipeline, replacing their current values. It works against a
+// server and a MockRedisOp in stateful mode alike, to prepare the keys of a test.
+func SeedRedis(op RedisOperator, values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	cmds := make([]RedisPipelineCmd, 0, len(keys))
+	for _, key := range keys {
+		cmds = append(cmds, RedisPipelineCmd{Cmd: "SET", Args: []interface{}{key, values[key]}})
+	}
+
+	return seedRedis(op, cmds)
+}
+
+// SeedHash replaces the hash key with fields.
+func SeedHash(op RedisOperator, key string, fields map[string]interface{}) error {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	args := make([]interface{}, 0, 1+2*len(names))
+	args = append(args, key)
+	for _, name := range names {
+		args = append(args, name, fields[name])
+	}
+
+	return seedRedisKey(op, key, len(names), RedisPipelineCmd{Cmd: "HSET", Args: args})
+}
+
+// SeedList replaces the list key with values, in order.
+func SeedList(op RedisOperator, key string, values ...interface{}) error {
+	return seedRedisKey(op, key, len(values), RedisPipelineCmd{Cmd: "RPUSH", Args: append([]interface{}{key}, values...)})
+}
+
+// SeedZSet replaces the sorted set key with members and their scores.
+func SeedZSet(op RedisOperator, key string, members map[string]float64) error {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	args := make([]interface{}, 0, 1+2*len(names))
+	args = append(args, key)
+	for _, name := range names {
+		args = append(args, members[name], name)
+	}
+
+	return seedRedisKey(op, key, len(names), RedisPipelineCmd{Cmd: "ZADD", Args: args})
+}
+
+// TruncateAll deletes the keys matching patterns, see DeleteByPattern, or flushes the database without patterns.
+// It cleans up the keys seeded by a test.
+func TruncateAll(op RedisOperator, patterns ...string) error {
+	if len(patterns) == 0 {
+		return op.FlushDB().Error
+	}
+
+	for _, pattern := range patterns {
+		if err := op.DeleteByPatternWithOptions(pattern, DeleteByPatternOptions{}).Error; err != nil {
+			return fmt.Errorf("truncate %s: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// seedRedisKey deletes key and runs write, unless there are no elements to write, as one transaction.
+func seedRedisKey(op RedisOperator, key string, elements int, write RedisPipelineCmd) error {
+	cmds := []RedisPipelineCmd{{Cmd: "DEL", Args: []interface{}{key}}}
+	if elements > 0 {
+		cmds = append(cmds, write)
+	}
+
+	return seedRedis(op, cmds)
+}
+
+// seedRedis runs cmds as one transaction and returns the first error.
+func seedRedis(op RedisOperator, cmds []RedisPipelineCmd) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	for i, response := range op.PipelineWithOptions(RedisPipelineOptions{Transaction: true}, cmds...) {
+		if response.Error != nil {
+			return fmt.Errorf("seed %s %v: %w", cmds[i].Cmd, cmds[i].Args[0], response.Error)
+		}
+	}
+
+	return nil
+}
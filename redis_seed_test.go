@@ -0,0 +1,70 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisSeed(t *testing.T) {
+	check := func(t *testing.T, op RedisOperator, prefix string) {
+		assert.NoError(t, SeedRedis(op, map[string]interface{}{prefix + ":a": "1", prefix + ":b": 2}))
+		assert.Equal(t, "1", op.Get(prefix+":a").GetString())
+		assert.Equal(t, "2", op.Get(prefix+":b").GetString())
+
+		// Seeding replaces the previous content of the key
+		op.HSet(prefix+":hash", "stale", "x")
+		assert.NoError(t, SeedHash(op, prefix+":hash", map[string]interface{}{"name": "seed", "count": 3}))
+		assert.Equal(t, map[string]string{"name": "seed", "count": "3"}, op.HGetAll(prefix+":hash").GetMap())
+
+		op.RPush(prefix+":list", "stale")
+		assert.NoError(t, SeedList(op, prefix+":list", "a", "b", "c"))
+		var values []string
+		for _, value := range op.LRange(prefix+":list", 0, -1).GetSlice() {
+			values = append(values, value.GetString())
+		}
+
+		assert.Equal(t, []string{"a", "b", "c"}, values)
+
+		assert.NoError(t, SeedZSet(op, prefix+":zset", map[string]float64{"low": 1, "high": 10}))
+		assert.Equal(t, "10", op.ZScore(prefix+":zset", "high").GetString())
+		assert.Equal(t, int64(2), op.ZCard(prefix+":zset").GetInt64())
+
+		// Seeding no elements leaves the key deleted
+		assert.NoError(t, SeedList(op, prefix+":list"))
+		assert.Equal(t, int64(0), op.Exists(prefix+":list").GetInt64())
+
+		op.Set("keep_"+prefix, 1)
+		defer op.Delete("keep_" + prefix)
+		assert.NoError(t, TruncateAll(op, prefix+":*"))
+		assert.Equal(t, int64(0), op.Exists(prefix+":a", prefix+":hash", prefix+":zset").GetInt64())
+		assert.Equal(t, int64(1), op.Exists("keep_"+prefix).GetInt64())
+	}
+
+	t.Run("Mock", func(t *testing.T) {
+		op := NewStatefulMockRedis().Master()
+		check(t, op, "seed")
+
+		op.Set("other", 1)
+		assert.NoError(t, TruncateAll(op))
+		assert.Equal(t, int64(0), op.Exists("other").GetInt64())
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		check(t, redis.Master(), "test_seed")
+	})
+}
@@ -0,0 +1,304 @@
+package datastore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// DefaultRedisSessionTTL is how long a session of a SessionStore lives, since its last use when sliding
+	DefaultRedisSessionTTL = 30 * time.Minute
+	// DefaultRedisSessionPrefix is the prefix of the keys of a SessionStore created with an empty prefix
+	DefaultRedisSessionPrefix = "session:"
+)
+
+func init() {
+	envMillis("GOTH_DEFAULT_REDIS_SESSION_TTL", &DefaultRedisSessionTTL)
+	envStr("GOTH_DEFAULT_REDIS_SESSION_PREFIX", &DefaultRedisSessionPrefix)
+}
+
+// ErrSessionNotFound is returned by SessionStore for a session which does not exist or expired.
+var ErrSessionNotFound = errors.New("redis session not found")
+
+// Session is a session of a SessionStore, Data is its payload as JSON.
+type Session struct {
+	ID        string          `json:"id"`
+	UserID    string          `json:"user_id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Decode unmarshals the payload of the session into v.
+func (s *Session) Decode(v interface{}) error {
+	if len(s.Data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(s.Data, v)
+}
+
+// SessionStore stores sessions in Redis as JSON, see NewSessionStore. Sessions expire after TTL, extended by every
+// Get with Sliding. With UserIndex the ids of the sessions of a user are kept in a set, so UserSessions and
+// DestroyUser find them, e.g. to log a user out everywhere.
+type SessionStore struct {
+	op     RedisOperator
+	prefix string
+	// TTL is how long a session lives, DefaultRedisSessionTTL when created
+	TTL time.Duration
+	// Sliding extends the TTL of a session on every Get, true when created
+	Sliding bool
+	// UserIndex keeps the ids of the sessions of each user in a set
+	UserIndex bool
+}
+
+// NewSessionStore returns a SessionStore on op storing the sessions under prefix, DefaultRedisSessionPrefix when
+// empty.
+func NewSessionStore(op RedisOperator, prefix string) *SessionStore {
+	if prefix == "" {
+		prefix = DefaultRedisSessionPrefix
+	}
+
+	return &SessionStore{op: op, prefix: prefix, TTL: DefaultRedisSessionTTL, Sliding: true}
+}
+
+func (s *SessionStore) key(id string) string {
+	return s.prefix + id
+}
+
+func (s *SessionStore) userKey(userID string) string {
+	return s.prefix + "user:" + userID
+}
+
+func (s *SessionStore) ttlSeconds() int64 {
+	return max(int64(s.TTL/time.Second), 1)
+}
+
+// Create stores a new session of userID, empty for an anonymous session, with data marshaled as JSON, and returns
+// it with its random id.
+func (s *SessionStore) Create(userID string, data interface{}) (*Session, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+
+	session := &Session{ID: hex.EncodeToString(random), UserID: userID, CreatedAt: time.Now()}
+	if data != nil {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		session.Data = payload
+	}
+
+	if err := s.save(session, SetOptions{NX: true}); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Update replaces the data of the session id, its TTL is extended with Sliding and kept otherwise.
+func (s *SessionStore) Update(id string, data interface{}) (*Session, error) {
+	session, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	session.Data = payload
+	opts := SetOptions{XX: true, KEEPTTL: !s.Sliding}
+	if err := s.save(session, opts); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// save stores session with opts, NX or XX, and adds it to the index of its user.
+func (s *SessionStore) save(session *Session, opts SetOptions) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	if !opts.KEEPTTL {
+		opts.EX = s.ttlSeconds()
+	}
+
+	cmds := []RedisPipelineCmd{{Cmd: "SET", Args: setArgs(s.key(session.ID), value, opts)}}
+	if s.UserIndex && session.UserID != "" {
+		userKey := s.userKey(session.UserID)
+		cmds = append(cmds,
+			RedisPipelineCmd{Cmd: "SADD", Args: []interface{}{userKey, session.ID}},
+			RedisPipelineCmd{Cmd: "EXPIRE", Args: []interface{}{userKey, s.ttlSeconds()}},
+		)
+	}
+
+	responses := s.op.Pipeline(cmds...)
+	if IsNotFound(responses[0].Error) {
+		return ErrSessionNotFound
+	}
+
+	for _, response := range responses {
+		if response.Error != nil {
+			return response.Error
+		}
+	}
+
+	return nil
+}
+
+// Get returns the session id, ErrSessionNotFound when it does not exist or expired, and extends its TTL with
+// Sliding.
+func (s *SessionStore) Get(id string) (*Session, error) {
+	if s.Sliding {
+		return s.Refresh(id)
+	}
+
+	return s.get(id)
+}
+
+func (s *SessionStore) get(id string) (*Session, error) {
+	response := s.op.Get(s.key(id))
+	if IsNotFound(response.Error) {
+		return nil, ErrSessionNotFound
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	session := &Session{}
+	if err := json.Unmarshal(response.GetBytes(), session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Refresh extends the TTL of the session id and returns it, ErrSessionNotFound when it does not exist or expired.
+func (s *SessionStore) Refresh(id string) (*Session, error) {
+	responses := s.op.Pipeline(
+		RedisPipelineCmd{Cmd: "GET", Args: []interface{}{s.key(id)}},
+		RedisPipelineCmd{Cmd: "EXPIRE", Args: []interface{}{s.key(id), s.ttlSeconds()}},
+	)
+
+	if IsNotFound(responses[0].Error) {
+		return nil, ErrSessionNotFound
+	}
+
+	for _, response := range responses {
+		if response.Error != nil {
+			return nil, response.Error
+		}
+	}
+
+	session := &Session{}
+	if err := json.Unmarshal(responses[0].GetBytes(), session); err != nil {
+		return nil, err
+	}
+
+	if s.UserIndex && session.UserID != "" {
+		if err := s.op.Expire(s.userKey(session.UserID), s.ttlSeconds()).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+// Destroy deletes the session id, ErrSessionNotFound when it does not exist or expired.
+func (s *SessionStore) Destroy(id string) error {
+	session, err := s.get(id)
+	if err != nil {
+		return err
+	}
+
+	cmds := []RedisPipelineCmd{{Cmd: "DEL", Args: []interface{}{s.key(id)}}}
+	if s.UserIndex && session.UserID != "" {
+		cmds = append(cmds, RedisPipelineCmd{Cmd: "SREM", Args: []interface{}{s.userKey(session.UserID), id}})
+	}
+
+	for _, response := range s.op.Pipeline(cmds...) {
+		if response.Error != nil {
+			return response.Error
+		}
+	}
+
+	return nil
+}
+
+// UserSessions returns the ids of the live sessions of userID, removing the expired ones from the index. It
+// requires UserIndex.
+func (s *SessionStore) UserSessions(userID string) ([]string, error) {
+	userKey := s.userKey(userID)
+	response := s.op.SMembers(userKey)
+	if response.Error != nil && !IsNotFound(response.Error) {
+		return nil, response.Error
+	}
+
+	members := response.GetSlice()
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	cmds := make([]RedisPipelineCmd, len(members))
+	for i, member := range members {
+		cmds[i] = RedisPipelineCmd{Cmd: "EXISTS", Args: []interface{}{s.key(member.GetString())}}
+	}
+
+	var ids []string
+	var expired []interface{}
+	for i, exists := range s.op.Pipeline(cmds...) {
+		if exists.Error != nil {
+			return nil, exists.Error
+		}
+
+		if exists.GetInt64() > 0 {
+			ids = append(ids, members[i].GetString())
+		} else {
+			expired = append(expired, members[i].GetString())
+		}
+	}
+
+	if len(expired) > 0 {
+		if err := s.op.SRem(userKey, expired...).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// DestroyUser deletes the sessions of userID and returns their number. It requires UserIndex.
+func (s *SessionStore) DestroyUser(userID string) (int64, error) {
+	ids, err := s.UserSessions(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(id)
+	}
+
+	var deleted int64
+	if len(keys) > 0 {
+		response := CountBySlot(s.op, "DEL", keys...)
+		if response.Error != nil {
+			return 0, response.Error
+		}
+
+		deleted = response.GetInt64()
+	}
+
+	return deleted, s.op.Delete(s.userKey(userID)).Error
+}
@@ -0,0 +1,125 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestSessionStore(t *testing.T) {
+	type payload struct {
+		Role string `json:"role"`
+	}
+
+	check := func(t *testing.T, op RedisOperator) {
+		store := NewSessionStore(op, "test_session:")
+		store.TTL, store.UserIndex = 100*time.Second, true
+
+		session, err := store.Create("u1", payload{Role: "admin"})
+		assert.NoError(t, err)
+		assert.Len(t, session.ID, 64)
+		assert.Equal(t, "u1", session.UserID)
+
+		got, err := store.Get(session.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, session.ID, got.ID)
+		var data payload
+		assert.NoError(t, got.Decode(&data))
+		assert.Equal(t, "admin", data.Role)
+
+		// Get slides the TTL
+		op.Expire("test_session:"+session.ID, 10)
+		_, err = store.Get(session.ID)
+		assert.NoError(t, err)
+		assert.Greater(t, op.TTL("test_session:"+session.ID).GetInt64(), int64(90))
+		assert.Greater(t, op.TTL("test_session:user:u1").GetInt64(), int64(90))
+
+		// Without sliding Get keeps it, Refresh extends it
+		store.Sliding = false
+		op.Expire("test_session:"+session.ID, 10)
+		_, err = store.Get(session.ID)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, op.TTL("test_session:"+session.ID).GetInt64(), int64(10))
+		_, err = store.Refresh(session.ID)
+		assert.NoError(t, err)
+		assert.Greater(t, op.TTL("test_session:"+session.ID).GetInt64(), int64(90))
+
+		updated, err := store.Update(session.ID, payload{Role: "user"})
+		assert.NoError(t, err)
+		assert.NoError(t, updated.Decode(&data))
+		assert.Equal(t, "user", data.Role)
+		got, err = store.Get(session.ID)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"role":"user"}`, string(got.Data))
+		assert.Greater(t, op.TTL("test_session:"+session.ID).GetInt64(), int64(90))
+
+		// The user index skips the expired sessions
+		second, err := store.Create("u1", nil)
+		assert.NoError(t, err)
+		expired, err := store.Create("u1", nil)
+		assert.NoError(t, err)
+		op.Delete("test_session:" + expired.ID)
+		anonymous, err := store.Create("", nil)
+		assert.NoError(t, err)
+		ids, err := store.UserSessions("u1")
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{session.ID, second.ID}, ids)
+		assert.Equal(t, int64(2), op.SCard("test_session:user:u1").GetInt64())
+
+		assert.NoError(t, store.Destroy(second.ID))
+		_, err = store.Get(second.ID)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		assert.ErrorIs(t, store.Destroy(second.ID), ErrSessionNotFound)
+		_, err = store.Refresh(second.ID)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		_, err = store.Update(second.ID, nil)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+
+		deleted, err := store.DestroyUser("u1")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), deleted)
+		_, err = store.Get(session.ID)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		ids, err = store.UserSessions("u1")
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+
+		_, err = store.Get(anonymous.ID)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Destroy(anonymous.ID))
+		_, err = store.Create("u1", func() {})
+		assert.Error(t, err)
+	}
+
+	t.Run("Mock", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		check(t, op)
+		assert.Equal(t, DefaultRedisSessionPrefix, NewSessionStore(op, "").prefix)
+	})
+
+	t.Run("Cluster", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		op.SetClusterMode(true)
+		check(t, op)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+		check(t, redis.Master())
+	})
+}
@@ -0,0 +1,440 @@
+package datastore
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+)
+
+// DefaultRedisShardPoints is the number of points of a shard of weight 1 on the hash ring of a ShardedRedis, 160
+// like ketama.
+var DefaultRedisShardPoints = 160
+
+func init() {
+	envInt("GOTH_DEFAULT_REDIS_SHARD_POINTS", &DefaultRedisShardPoints)
+}
+
+// ErrRedisNoShard is returned by the commands of a ShardedRedis without shards.
+var ErrRedisNoShard = errors.New("redis sharded has no shard")
+
+// ShardedRedis distributes keys across independent Redis, its shards, by consistent hashing compatible with
+// ketama, for sharded setups without Redis Cluster. A key belongs to the shard of the first point of the ring
+// following the MD5 of its hash tag, see RedisHashSlot, so keys sharing a tag share a shard. Adding or removing a
+// shard only moves the keys of its points, which Rebalance migrates.
+type ShardedRedis struct {
+	name    string
+	mutex   sync.RWMutex
+	shards  map[string]*Redis
+	weights map[string]int
+	ring    []redisShardPoint
+}
+
+type redisShardPoint struct {
+	hash  uint32
+	shard string
+}
+
+// NewShardedRedis constructs a ShardedRedis of the Redis profiles profileNames, each shard of weight 1 named after
+// its profile. It returns nil when a profile fails to load.
+func NewShardedRedis(name string, profileNames ...string) *ShardedRedis {
+	shards := make(map[string]*Redis, len(profileNames))
+	for _, profileName := range profileNames {
+		redis := NewRedis(profileName)
+		if redis == nil {
+			kklogger.ErrorJ("datastore:NewShardedRedis", fmt.Sprintf("%s: redis profile %s unavailable", name, profileName))
+			for _, shard := range shards {
+				shard.Close()
+			}
+
+			return nil
+		}
+
+		shards[profileName] = redis
+	}
+
+	return NewShardedRedisWithShards(name, shards)
+}
+
+// NewShardedRedisWithShards returns a ShardedRedis of shards by name, each of weight 1.
+func NewShardedRedisWithShards(name string, shards map[string]*Redis) *ShardedRedis {
+	s := &ShardedRedis{name: name, shards: map[string]*Redis{}, weights: map[string]int{}}
+	for shard, redis := range shards {
+		s.shards[shard], s.weights[shard] = redis, 1
+	}
+
+	s.buildRing()
+	return s
+}
+
+// Name returns "sharded_redis/<name>".
+func (s *ShardedRedis) Name() string {
+	return "sharded_redis/" + s.name
+}
+
+// Ping pings the master of every shard, and returns their errors, ErrRedisNoShard without shards.
+func (s *ShardedRedis) Ping(ctx context.Context) error {
+	if len(s.Shards()) == 0 {
+		return ErrRedisNoShard
+	}
+
+	return s.FanOut(ctx, func(ctx context.Context, shard string, redis *Redis) error {
+		if err := redis.Ping(ctx); err != nil {
+			return fmt.Errorf("%s: %w", shard, err)
+		}
+
+		return nil
+	})
+}
+
+// Stats returns the stats of every shard prefixed with its name, e.g. "cache1.master.active_conns", and the
+// number of shards as "shards".
+func (s *ShardedRedis) Stats() DataStoreStats {
+	stats := DataStoreStats{}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for shard, redis := range s.shards {
+		for name, value := range redis.Stats() {
+			stats[shard+"."+name] = value
+		}
+	}
+
+	stats["shards"] = float64(len(s.shards))
+	return stats
+}
+
+// Close closes every shard.
+func (s *ShardedRedis) Close() error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var errs []error
+	for _, redis := range s.shards {
+		errs = append(errs, redis.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// Shards returns the sorted names of the shards.
+func (s *ShardedRedis) Shards() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	names := make([]string, 0, len(s.shards))
+	for shard := range s.shards {
+		names = append(names, shard)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// ShardName returns the name of the shard of key, empty when there is no shard.
+func (s *ShardedRedis) ShardName(key interface{}) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.locate(redisClientCacheKey(key))
+}
+
+// Shard returns the Redis of the shard of key, nil when there is no shard.
+func (s *ShardedRedis) Shard(key interface{}) *Redis {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.shards[s.locate(redisClientCacheKey(key))]
+}
+
+// Master returns the master of the shard of key, nil when there is no shard.
+func (s *ShardedRedis) Master(key interface{}) RedisOperator {
+	if redis := s.Shard(key); redis != nil {
+		return redis.Master()
+	}
+
+	return nil
+}
+
+// Slave returns the slave of the shard of key, nil when there is no shard.
+func (s *ShardedRedis) Slave(key interface{}) RedisOperator {
+	if redis := s.Shard(key); redis != nil {
+		return redis.Slave()
+	}
+
+	return nil
+}
+
+// AddShard adds redis as the shard name with weight times DefaultRedisShardPoints points on the ring, or replaces
+// the shard of that name. The keys now belonging to it stay on their former shards until Rebalance moves them.
+func (s *ShardedRedis) AddShard(name string, redis *Redis, weight int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.shards[name], s.weights[name] = redis, max(weight, 1)
+	s.buildRing()
+}
+
+// RemoveShard removes the shard name from the ring and returns its Redis, not closed so its keys can be moved to
+// the remaining shards first, nil when there is no such shard.
+func (s *ShardedRedis) RemoveShard(name string) *Redis {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	redis := s.shards[name]
+	delete(s.shards, name)
+	delete(s.weights, name)
+	s.buildRing()
+	return redis
+}
+
+// buildRing places the points of the shards like ketama: each MD5 digest of "<shard>-<n>" gives 4 points.
+func (s *ShardedRedis) buildRing() {
+	ring := make([]redisShardPoint, 0, len(s.shards)*DefaultRedisShardPoints)
+	for shard := range s.shards {
+		digests := max(s.weights[shard]*DefaultRedisShardPoints/4, 1)
+		for n := 0; n < digests; n++ {
+			digest := md5.Sum([]byte(shard + "-" + strconv.Itoa(n)))
+			for i := 0; i < 4; i++ {
+				ring = append(ring, redisShardPoint{hash: binary.LittleEndian.Uint32(digest[4*i:]), shard: shard})
+			}
+		}
+	}
+
+	// shard names break ties so the ring does not depend on the map order
+	sort.Slice(ring, func(i, j int) bool {
+		if ring[i].hash != ring[j].hash {
+			return ring[i].hash < ring[j].hash
+		}
+
+		return ring[i].shard < ring[j].shard
+	})
+
+	s.ring = ring
+}
+
+// locate returns the shard of key, the caller holds the mutex.
+func (s *ShardedRedis) locate(key string) string {
+	if len(s.ring) == 0 {
+		return ""
+	}
+
+	digest := md5.Sum([]byte(redisHashTag(key)))
+	hash := binary.LittleEndian.Uint32(digest[:4])
+	i := sort.Search(len(s.ring), func(i int) bool {
+		return s.ring[i].hash >= hash
+	})
+
+	if i == len(s.ring) {
+		i = 0
+	}
+
+	return s.ring[i].shard
+}
+
+// FanOut calls fn for every shard concurrently, and returns their errors joined.
+func (s *ShardedRedis) FanOut(ctx context.Context, fn func(ctx context.Context, shard string, redis *Redis) error) error {
+	s.mutex.RLock()
+	shards := make(map[string]*Redis, len(s.shards))
+	for shard, redis := range s.shards {
+		shards[shard] = redis
+	}
+
+	s.mutex.RUnlock()
+	errs := make(chan error, len(shards))
+	for shard, redis := range shards {
+		go func() {
+			errs <- fn(ctx, shard, redis)
+		}()
+	}
+
+	var all []error
+	for range shards {
+		all = append(all, <-errs)
+	}
+
+	return errors.Join(all...)
+}
+
+// MGet gets the values of keys from the slaves of their shards, one MGET per shard sent concurrently, and returns
+// them in the order of keys, nil for missing keys.
+func (s *ShardedRedis) MGet(keys ...interface{}) *RedisResponse {
+	s.mutex.RLock()
+	groups := map[string][]int{}
+	for i, key := range keys {
+		shard := s.locate(redisClientCacheKey(key))
+		groups[shard] = append(groups[shard], i)
+	}
+
+	ops := make(map[string]RedisOperator, len(groups))
+	for shard := range groups {
+		if redis := s.shards[shard]; redis != nil {
+			ops[shard] = redis.Slave()
+		}
+	}
+
+	s.mutex.RUnlock()
+	if len(keys) > 0 && len(ops) == 0 {
+		return &RedisResponse{Error: ErrRedisNoShard}
+	}
+
+	values := make([]interface{}, len(keys))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr *RedisResponse
+	for shard, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response := ops[shard].Do("MGET", redisSlotArgs(keys, group)...)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if response.Error != nil {
+				if firstErr == nil {
+					firstErr = response
+				}
+
+				return
+			}
+
+			reply, _ := response.data.([]interface{})
+			for j, index := range group {
+				if j < len(reply) {
+					values[index] = reply[j]
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: values}}
+}
+
+// Rebalance moves the keys matching pattern stored on a shard they no longer belong to, after AddShard, or on the
+// removed Redis returned by RemoveShard, to their shard with DUMP and RESTORE, keeping their TTL. It returns the
+// number of keys moved, also on error, and stops when ctx is done. A key already written on its new shard is kept
+// there and its former copy deleted.
+//
+// Rebalance is not atomic: a key is copied then deleted from its former shard, a write reaching the former shard
+// in between, e.g. from a process whose ring still lacks the new shard, is lost. Stop such writers, or move keys
+// which are not written during the rebalance.
+func (s *ShardedRedis) Rebalance(ctx context.Context, pattern string, removed ...*Redis) (int64, error) {
+	if pattern == "" {
+		return 0, ErrRedisPatternEmpty
+	}
+
+	type source struct {
+		shard string
+		redis *Redis
+	}
+
+	var sources []source
+	for _, shard := range s.Shards() {
+		s.mutex.RLock()
+		sources = append(sources, source{shard: shard, redis: s.shards[shard]})
+		s.mutex.RUnlock()
+	}
+
+	// no key belongs to the empty shard name, every key of a removed Redis moves
+	for _, redis := range removed {
+		sources = append(sources, source{redis: redis})
+	}
+
+	moved := int64(0)
+	for _, source := range sources {
+		n, err := s.rebalanceShard(ctx, source.shard, source.redis.Master(), pattern)
+		moved += n
+		if err != nil {
+			return moved, fmt.Errorf("rebalance %s: %w", source.redis.Name(), err)
+		}
+	}
+
+	return moved, nil
+}
+
+// rebalanceShard SCANs the keys of op matching pattern and moves the ones not belonging to shard.
+func (s *ShardedRedis) rebalanceShard(ctx context.Context, shard string, op RedisOperator, pattern string) (int64, error) {
+	moved := int64(0)
+	cursor := "0"
+	for {
+		if err := ctx.Err(); err != nil {
+			return moved, err
+		}
+
+		resp := op.Do("SCAN", cursor, "MATCH", pattern, "COUNT", DefaultRedisDeleteBatchSize)
+		if resp.Error != nil {
+			return moved, resp.Error
+		}
+
+		parts := resp.GetSlice()
+		if len(parts) != 2 {
+			return moved, errors.New("invalid scan response")
+		}
+
+		cursor = parts[0].GetString()
+		for _, entity := range parts[1].GetSlice() {
+			key := entity.GetString()
+			s.mutex.RLock()
+			owner := s.locate(key)
+			target := s.shards[owner]
+			s.mutex.RUnlock()
+			if target == nil {
+				return moved, ErrRedisNoShard
+			}
+
+			if owner == shard {
+				continue
+			}
+
+			ok, err := moveRedisKey(op, target.Master(), key)
+			if err != nil {
+				return moved, fmt.Errorf("%s: %w", key, err)
+			}
+
+			if ok {
+				moved++
+			}
+		}
+
+		if cursor == "0" {
+			return moved, nil
+		}
+	}
+}
+
+// moveRedisKey copies key from source to target with its TTL and deletes it from source, false when it vanished
+// or target already has it. A key on target was written through the ring since the shard changed, it is newer
+// and kept, the stale copy of source is only deleted.
+func moveRedisKey(source, target RedisOperator, key string) (bool, error) {
+	ttl := source.PTTL(key)
+	if ttl.Error != nil {
+		return false, ttl.Error
+	}
+
+	if ttl.GetInt64() == -2 {
+		return false, nil
+	}
+
+	dump := source.Dump(key)
+	if errors.Is(dump.Error, RedisNotFound) {
+		return false, nil
+	}
+
+	if dump.Error != nil {
+		return false, dump.Error
+	}
+
+	if err := target.Restore(key, max(ttl.GetInt64(), 0), []byte(dump.GetString()), false).Error; err != nil {
+		if strings.HasPrefix(err.Error(), "BUSYKEY") {
+			return false, source.Unlink(key).Error
+		}
+
+		return false, err
+	}
+
+	return true, source.Unlink(key).Error
+}
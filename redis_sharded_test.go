@@ -0,0 +1,211 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestShardedRedis(t *testing.T) {
+	newSharded := func(shards ...string) *ShardedRedis {
+		redis := map[string]*Redis{}
+		for _, shard := range shards {
+			redis[shard] = NewStatefulMockRedis()
+		}
+
+		return NewShardedRedisWithShards("test", redis)
+	}
+
+	t.Run("Distribution", func(t *testing.T) {
+		sharded := newSharded("a", "b", "c")
+		assert.Equal(t, "sharded_redis/test", sharded.Name())
+		assert.Equal(t, []string{"a", "b", "c"}, sharded.Shards())
+		counts := map[string]int{}
+		before := map[string]string{}
+		for i := 0; i < 3000; i++ {
+			key := fmt.Sprintf("key:%d", i)
+			before[key] = sharded.ShardName(key)
+			counts[before[key]]++
+		}
+
+		for _, shard := range sharded.Shards() {
+			assert.InDelta(t, 1000, counts[shard], 250, shard)
+		}
+
+		assert.Equal(t, sharded.ShardName("user:1"), sharded.ShardName("{user:1}:profile"))
+		assert.Equal(t, sharded.ShardName("{user:1}:settings"), sharded.ShardName("{user:1}:profile"))
+
+		// Adding a shard only moves keys to it
+		sharded.AddShard("d", NewStatefulMockRedis(), 1)
+		moved := 0
+		for key, shard := range before {
+			if now := sharded.ShardName(key); now != shard {
+				assert.Equal(t, "d", now)
+				moved++
+			}
+		}
+
+		assert.InDelta(t, 750, moved, 250)
+
+		// Removing it moves them back
+		sharded.RemoveShard("d")
+		for key, shard := range before {
+			assert.Equal(t, shard, sharded.ShardName(key))
+		}
+
+		assert.Equal(t, "", newSharded().ShardName("key"))
+		assert.Nil(t, newSharded().Master("key"))
+	})
+
+	t.Run("Rebalance", func(t *testing.T) {
+		sharded := newSharded("a", "b")
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("rebalance:%d", i)
+			assert.NoError(t, sharded.Master(key).Do("SET", key, i, "EX", 100).Error)
+		}
+
+		sharded.Master("rebalance:list").RPush("rebalance:list", "a", "b")
+		formers := map[string]*Redis{}
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("rebalance:%d", i)
+			formers[key] = sharded.Shard(key)
+		}
+
+		sharded.AddShard("c", NewStatefulMockRedis(), 2)
+		expected := int64(0)
+		for i := 0; i < 200; i++ {
+			if sharded.ShardName(fmt.Sprintf("rebalance:%d", i)) == "c" {
+				expected++
+			}
+		}
+
+		if sharded.ShardName("rebalance:list") == "c" {
+			expected++
+		}
+
+		// A key written on its new shard before the rebalance is newer, its former copy is dropped
+		newer := ""
+		for i := 0; newer == ""; i++ {
+			if key := fmt.Sprintf("rebalance:%d", i); sharded.ShardName(key) == "c" {
+				newer = key
+			}
+		}
+
+		sharded.Master(newer).Set(newer, "newer")
+		moved, err := sharded.Rebalance(context.Background(), "rebalance:*")
+		assert.NoError(t, err)
+		assert.Equal(t, expected-1, moved)
+		assert.Greater(t, moved, int64(0))
+		assert.Equal(t, "newer", sharded.Master(newer).Get(newer).GetString())
+		assert.Equal(t, int64(0), formers[newer].Master().Exists(newer).GetInt64())
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("rebalance:%d", i)
+			if key == newer {
+				continue
+			}
+
+			op := sharded.Master(key)
+			assert.Equal(t, fmt.Sprint(i), op.Get(key).GetString())
+			assert.Greater(t, op.TTL(key).GetInt64(), int64(90))
+		}
+
+		assert.Equal(t, int64(2), sharded.Master("rebalance:list").LLen("rebalance:list").GetInt64())
+
+		// Nothing is left to move
+		moved, err = sharded.Rebalance(context.Background(), "rebalance:*")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), moved)
+
+		removed := sharded.RemoveShard("c")
+		moved, err = sharded.Rebalance(context.Background(), "rebalance:*", removed)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, moved)
+		assert.Equal(t, int64(0), removed.Master().Do("DBSIZE").GetInt64())
+		assert.Equal(t, "7", sharded.Master("rebalance:7").Get("rebalance:7").GetString())
+
+		_, err = sharded.Rebalance(context.Background(), "")
+		assert.ErrorIs(t, err, ErrRedisPatternEmpty)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = sharded.Rebalance(ctx, "*")
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("FanOut", func(t *testing.T) {
+		sharded := newSharded("a", "b", "c")
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("fanout:%d", i)
+			sharded.Master(key).Set(key, i)
+		}
+
+		values := sharded.MGet("fanout:3", "fanout:missing", "fanout:17", "fanout:0").GetSlice()
+		assert.Len(t, values, 4)
+		assert.Equal(t, "3", values[0].GetString())
+		assert.Nil(t, values[1].data)
+		assert.Equal(t, "17", values[2].GetString())
+		assert.Equal(t, "0", values[3].GetString())
+		assert.ErrorIs(t, newSharded().MGet("key").Error, ErrRedisNoShard)
+
+		failure := errors.New("failure")
+		err := sharded.FanOut(context.Background(), func(ctx context.Context, shard string, redis *Redis) error {
+			if shard == "b" {
+				return failure
+			}
+
+			return nil
+		})
+
+		assert.ErrorIs(t, err, failure)
+		assert.NoError(t, sharded.Ping(context.Background()))
+		assert.ErrorIs(t, newSharded().Ping(context.Background()), ErrRedisNoShard)
+		assert.Equal(t, float64(3), sharded.Stats()["shards"])
+		assert.Contains(t, sharded.Stats(), "a.master.idle_conns")
+		assert.NoError(t, sharded.Close())
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		shards := map[string]*Redis{}
+		for _, db := range []int{1, 2} {
+			profile, err := secret.LoadRedisProfile("test")
+			assert.NoError(t, err)
+			profile.DB = db
+			shards[fmt.Sprintf("db%d", db)] = NewRedisWithProfile("test", profile)
+		}
+
+		sharded := NewShardedRedisWithShards("test", shards)
+		defer sharded.Close()
+		assert.NoError(t, sharded.Ping(context.Background()))
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("test_sharded:%d", i)
+			assert.NoError(t, sharded.Master(key).Set(key, i).Error)
+		}
+
+		db3, err := secret.LoadRedisProfile("test")
+		assert.NoError(t, err)
+		db3.DB = 3
+		sharded.AddShard("db3", NewRedisWithProfile("test", db3), 1)
+		_, err = sharded.Rebalance(context.Background(), "test_sharded:*")
+		assert.NoError(t, err)
+		values := sharded.MGet("test_sharded:4", "test_sharded:19").GetSlice()
+		assert.Equal(t, "4", values[0].GetString())
+		assert.Equal(t, "19", values[1].GetString())
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("test_sharded:%d", i)
+			assert.Equal(t, fmt.Sprint(i), sharded.Master(key).Get(key).GetString())
+			sharded.Master(key).Delete(key)
+		}
+	})
+}
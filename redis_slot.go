@@ -0,0 +1,202 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RedisClusterSlots is the number of hash slots of a Redis cluster.
+const RedisClusterSlots = 16384
+
+// ErrRedisCrossSlot is returned, wrapped with the command, by CheckRedisSlots for the keys of a multi-key command
+// or transaction hashing to different slots of a cluster.
+var ErrRedisCrossSlot = errors.New("redis keys in different slots")
+
+// RedisHashSlot returns the cluster slot of key, computed from its hash tag, the part between the first "{" and
+// the next "}", when it is not empty. Keys sharing a hash tag, like "{user:1}:profile" and "{user:1}:settings",
+// share a slot.
+func RedisHashSlot(key string) int {
+	return int(redisCRC16(redisHashTag(key)) % RedisClusterSlots)
+}
+
+// redisHashTag returns the hash tag of key, key itself when it has none.
+func redisHashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+
+	return key
+}
+
+// redisCRC16 is the CRC16-CCITT (XMODEM) checksum of the cluster key distribution.
+func redisCRC16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// CheckRedisSlots returns ErrRedisCrossSlot when op is a cluster operator and the keys of cmds, a multi-key
+// command like SINTERSTORE or the commands of a transaction, hash to different slots, which the cluster rejects.
+// It returns nil for other operators.
+func CheckRedisSlots(op RedisOperator, cmds ...RedisPipelineCmd) error {
+	if !op.Cluster() {
+		return nil
+	}
+
+	slot := -1
+	for _, c := range cmds {
+		if err := redisCheckSlot(&slot, c.Cmd, c.Args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// redisCheckSlot checks that the keys of cmd hash to slot, set to the slot of the first key when it is -1.
+func redisCheckSlot(slot *int, cmd string, args []interface{}) error {
+	name := strings.ToUpper(cmd)
+	for _, key := range redisCommandKeys(name, args) {
+		keySlot := RedisHashSlot(redisClientCacheKey(key))
+		if *slot < 0 {
+			*slot = keySlot
+		} else if keySlot != *slot {
+			return fmt.Errorf("%w: %s", ErrRedisCrossSlot, name)
+		}
+	}
+
+	return nil
+}
+
+// MSetBySlot sets the keys of keyvals, alternating keys and values, with one MSET per slot on a cluster operator,
+// sent in one pipeline, and with one MSET otherwise. Across slots the keys are not set atomically.
+func MSetBySlot(op RedisOperator, keyvals ...interface{}) *RedisResponse {
+	if len(keyvals)%2 != 0 {
+		return &RedisResponse{Error: fmt.Errorf("MSET: odd number of arguments %d", len(keyvals))}
+	}
+
+	if !op.Cluster() {
+		return op.Do("MSET", keyvals...)
+	}
+
+	keys := make([]interface{}, 0, len(keyvals)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		keys = append(keys, keyvals[i])
+	}
+
+	groups := redisSlotGroups(keys)
+	cmds := make([]RedisPipelineCmd, len(groups))
+	for i, group := range groups {
+		args := make([]interface{}, 0, 2*len(group))
+		for _, index := range group {
+			args = append(args, keyvals[2*index], keyvals[2*index+1])
+		}
+
+		cmds[i] = RedisPipelineCmd{Cmd: "MSET", Args: args}
+	}
+
+	for _, response := range op.Pipeline(cmds...) {
+		if response.Error != nil {
+			return response
+		}
+	}
+
+	return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: "OK"}}
+}
+
+// MGetBySlot gets the values of keys with one MGET per slot on a cluster operator, sent in one pipeline, and with
+// one MGET otherwise. The reply holds the values in the order of keys, nil for missing keys.
+func MGetBySlot(op RedisOperator, keys ...interface{}) *RedisResponse {
+	if !op.Cluster() || len(keys) == 0 {
+		return op.Do("MGET", keys...)
+	}
+
+	groups := redisSlotGroups(keys)
+	cmds := make([]RedisPipelineCmd, len(groups))
+	for i, group := range groups {
+		cmds[i] = RedisPipelineCmd{Cmd: "MGET", Args: redisSlotArgs(keys, group)}
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, response := range op.Pipeline(cmds...) {
+		if response.Error != nil {
+			return response
+		}
+
+		reply, _ := response.data.([]interface{})
+		for j, index := range groups[i] {
+			if j < len(reply) {
+				values[index] = reply[j]
+			}
+		}
+	}
+
+	return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: values}}
+}
+
+// CountBySlot sends cmd, a multi-key command replying with a count such as DEL, UNLINK, EXISTS or TOUCH, with one
+// command per slot on a cluster operator, sent in one pipeline, and as one command otherwise. The reply is the sum
+// of the counts.
+func CountBySlot(op RedisOperator, cmd string, keys ...interface{}) *RedisResponse {
+	if !op.Cluster() || len(keys) == 0 {
+		return op.Do(cmd, keys...)
+	}
+
+	groups := redisSlotGroups(keys)
+	cmds := make([]RedisPipelineCmd, len(groups))
+	for i, group := range groups {
+		cmds[i] = RedisPipelineCmd{Cmd: cmd, Args: redisSlotArgs(keys, group)}
+	}
+
+	count := int64(0)
+	for _, response := range op.Pipeline(cmds...) {
+		if response.Error != nil {
+			return response
+		}
+
+		count += response.GetInt64()
+	}
+
+	return &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: count}}
+}
+
+// redisSlotGroups returns the indexes of keys grouped by slot, the groups in the order of their first key.
+func redisSlotGroups(keys []interface{}) [][]int {
+	var groups [][]int
+	slots := map[int]int{}
+	for i, key := range keys {
+		slot := RedisHashSlot(redisClientCacheKey(key))
+		group, ok := slots[slot]
+		if !ok {
+			group = len(groups)
+			slots[slot] = group
+			groups = append(groups, nil)
+		}
+
+		groups[group] = append(groups[group], i)
+	}
+
+	return groups
+}
+
+func redisSlotArgs(keys []interface{}, group []int) []interface{} {
+	args := make([]interface{}, len(group))
+	for i, index := range group {
+		args[i] = keys[index]
+	}
+
+	return args
+}
@@ -0,0 +1,80 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisHashSlot(t *testing.T) {
+	assert.Equal(t, 12182, RedisHashSlot("foo"))
+	assert.Equal(t, 5061, RedisHashSlot("bar"))
+	assert.Equal(t, RedisHashSlot("user1000"), RedisHashSlot("{user1000}.following"))
+	assert.Equal(t, RedisHashSlot("{user1000}.followers"), RedisHashSlot("{user1000}.following"))
+	// An empty tag hashes the whole key, only the first tag counts
+	assert.Equal(t, int(redisCRC16("foo{}{bar}")%RedisClusterSlots), RedisHashSlot("foo{}{bar}"))
+	assert.Equal(t, RedisHashSlot("{bar"), RedisHashSlot("foo{{bar}}zap"))
+}
+
+func TestRedisSlotHelpers(t *testing.T) {
+	check := func(t *testing.T, op RedisOperator) {
+		assert.NoError(t, MSetBySlot(op, "test_slot_a", "1", "test_slot_b", "2", "test_slot_c", "3").Error)
+		values := MGetBySlot(op, "test_slot_c", "test_slot_missing", "test_slot_a").GetSlice()
+		assert.Len(t, values, 3)
+		assert.Equal(t, "3", values[0].GetString())
+		assert.Nil(t, values[1].data)
+		assert.Equal(t, "1", values[2].GetString())
+		assert.Equal(t, int64(3), CountBySlot(op, "EXISTS", "test_slot_a", "test_slot_b", "test_slot_c").GetInt64())
+		assert.Equal(t, int64(3), CountBySlot(op, "DEL", "test_slot_a", "test_slot_b", "test_slot_c", "test_slot_missing").GetInt64())
+		assert.Error(t, MSetBySlot(op, "test_slot_a").Error)
+	}
+
+	t.Run("Cluster", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		op.SetClusterMode(true)
+		assert.True(t, op.Cluster())
+		assert.NotEqual(t, RedisHashSlot("test_slot_a"), RedisHashSlot("test_slot_b"))
+		assert.ErrorIs(t, op.Do("MSET", "test_slot_a", "1", "test_slot_b", "2").Error, ErrMockCrossSlot)
+		assert.NoError(t, op.Do("MSET", "{test_slot}a", "1", "{test_slot}b", "2").Error)
+		check(t, op)
+
+		assert.ErrorIs(t, CheckRedisSlots(op, RedisPipelineCmd{Cmd: "SINTERSTORE", Args: []interface{}{"dst", "a", "b"}}), ErrRedisCrossSlot)
+		assert.ErrorIs(t, CheckRedisSlots(op,
+			RedisPipelineCmd{Cmd: "SET", Args: []interface{}{"{user:1}:name", "x"}},
+			RedisPipelineCmd{Cmd: "INCR", Args: []interface{}{"{user:2}:visits"}},
+		), ErrRedisCrossSlot)
+		assert.NoError(t, CheckRedisSlots(op,
+			RedisPipelineCmd{Cmd: "SINTERSTORE", Args: []interface{}{"{user:1}:common", "{user:1}:a", "{user:1}:b"}},
+			RedisPipelineCmd{Cmd: "PING"},
+		))
+	})
+
+	t.Run("Mock", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		assert.False(t, op.Cluster())
+		check(t, op)
+		assert.NoError(t, CheckRedisSlots(op, RedisPipelineCmd{Cmd: "SINTERSTORE", Args: []interface{}{"dst", "a", "b"}}))
+		assert.Len(t, op.GetCallsByCommand("MSET"), 1)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		assert.False(t, redis.Master().Cluster())
+		check(t, redis.Master())
+	})
+}
@@ -1,15 +1,22 @@
 package datastore
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/yetiz-org/goth-datastore/datastoretest/testserver"
 	secret "github.com/yetiz-org/goth-datastore/secrets"
 )
 
@@ -75,6 +82,165 @@ func TestRedisResponseEntity(t *testing.T) {
 		slice = resp.GetSlice()
 		assert.Empty(t, slice)
 	})
+
+	t.Run("TryGetInt64", func(t *testing.T) {
+		for data, expected := range map[interface{}]int64{int64(1): 1, 2: 2, "3": 3, 4.0: 4} {
+			resp := RedisResponseEntity{data: data}
+			n, err := resp.TryGetInt64()
+			assert.NoError(t, err)
+			assert.Equal(t, expected, n)
+		}
+
+		resp := RedisResponseEntity{data: []byte("-5")}
+		n, err := resp.TryGetInt64()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-5), n)
+
+		for _, data := range []interface{}{"not_a_number", 1.5, "1.5", nil, []interface{}{}} {
+			resp := RedisResponseEntity{data: data}
+			_, err := resp.TryGetInt64()
+			assert.ErrorIs(t, err, ErrRedisConversion)
+		}
+
+		resp = RedisResponseEntity{data: "abc"}
+		_, err = resp.TryGetInt64()
+		assert.EqualError(t, err, "redis reply conversion failed: string abc to int64")
+	})
+
+	t.Run("TryGetFloat64", func(t *testing.T) {
+		for _, data := range []interface{}{1.5, float32(1.5), "1.5", []byte("1.5")} {
+			resp := RedisResponseEntity{data: data}
+			f, err := resp.TryGetFloat64()
+			assert.NoError(t, err)
+			assert.Equal(t, 1.5, f)
+		}
+
+		resp := RedisResponseEntity{data: int64(2)}
+		f, err := resp.TryGetFloat64()
+		assert.NoError(t, err)
+		assert.Equal(t, 2.0, f)
+
+		resp = RedisResponseEntity{data: "1,5"}
+		_, err = resp.TryGetFloat64()
+		assert.ErrorIs(t, err, ErrRedisConversion)
+	})
+
+	t.Run("TryGetString", func(t *testing.T) {
+		for data, expected := range map[interface{}]string{"a": "a", int64(-1): "-1", 2: "2", 0.25: "0.25", true: "true"} {
+			resp := RedisResponseEntity{data: data}
+			str, err := resp.TryGetString()
+			assert.NoError(t, err)
+			assert.Equal(t, expected, str)
+		}
+
+		resp := RedisResponseEntity{data: nil}
+		_, err := resp.TryGetString()
+		assert.EqualError(t, err, "redis reply conversion failed: nil reply to string")
+		resp = RedisResponseEntity{data: []interface{}{"a"}}
+		_, err = resp.TryGetString()
+		assert.ErrorIs(t, err, ErrRedisConversion)
+	})
+
+	t.Run("GetMap", func(t *testing.T) {
+		resp := RedisResponseEntity{data: []interface{}{[]byte("name"), []byte("alice"), []byte("age"), int64(30)}}
+		assert.Equal(t, map[string]string{"name": "alice", "age": "30"}, resp.GetMap())
+
+		resp = RedisResponseEntity{data: map[interface{}]interface{}{"name": "alice"}}
+		assert.Equal(t, map[string]string{"name": "alice"}, resp.GetMap())
+
+		// HSCAN cursor reply
+		resp = RedisResponseEntity{data: []interface{}{[]byte("0"), []interface{}{[]byte("name"), []byte("alice")}}}
+		assert.Equal(t, map[string]string{"name": "alice"}, resp.GetMap())
+
+		// Flat and nested WITHSCORES replies
+		resp = RedisResponseEntity{data: []interface{}{"a", "1.5", "b", "2"}}
+		assert.Equal(t, map[string]string{"a": "1.5", "b": "2"}, resp.GetMap())
+		resp = RedisResponseEntity{data: []interface{}{[]interface{}{"a", 1.5}, []interface{}{"b", float64(2)}}}
+		assert.Equal(t, map[string]string{"a": "1.5", "b": "2"}, resp.GetMap())
+
+		resp = RedisResponseEntity{data: nil}
+		assert.Empty(t, resp.GetMap())
+	})
+
+	t.Run("Bind", func(t *testing.T) {
+		type user struct {
+			Name   string `redis:"name"`
+			Age    int    `json:"age"`
+			Active bool
+			Score  *float64 `redis:"score"`
+			Skip   string   `redis:"-"`
+		}
+
+		resp := &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: []interface{}{
+			[]byte("name"), []byte("alice"), []byte("age"), []byte("30"), []byte("Active"), []byte("1"),
+			[]byte("score"), []byte("0.5"), []byte("-"), []byte("x"),
+		}}}
+		var u user
+		assert.NoError(t, resp.Bind(&u))
+		assert.Equal(t, "alice", u.Name)
+		assert.Equal(t, 30, u.Age)
+		assert.True(t, u.Active)
+		assert.Equal(t, 0.5, *u.Score)
+		assert.Empty(t, u.Skip)
+
+		var fields map[string]string
+		assert.NoError(t, resp.Bind(&fields))
+		assert.Equal(t, "alice", fields["name"])
+
+		scores := &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: []interface{}{"a", "1.5", "b", "2"}}}
+		var members map[string]float64
+		assert.NoError(t, scores.Bind(&members))
+		assert.Equal(t, map[string]float64{"a": 1.5, "b": 2}, members)
+		assert.ErrorIs(t, resp.Bind(&members), ErrRedisConversion)
+
+		bad := &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: []interface{}{"age", "old"}}}
+		assert.Error(t, bad.Bind(&u))
+		assert.Error(t, resp.Bind(u))
+		assert.ErrorIs(t, (&RedisResponse{Error: RedisNotFound}).Bind(&u), RedisNotFound)
+
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		op.HMSet("user:1", map[interface{}]interface{}{"name": "bob", "age": 41})
+		u = user{}
+		assert.NoError(t, op.HGetAll("user:1").Bind(&u))
+		assert.Equal(t, user{Name: "bob", Age: 41}, u)
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		resp := newRedisResponse("value", nil)
+		assert.Equal(t, "value", resp.GetString())
+		resp.Release()
+		assert.Nil(t, resp.data)
+		assert.NoError(t, resp.Error)
+
+		// String replies are returned as is, integer and byte replies allocate the string only
+		entity := RedisResponseEntity{data: "value"}
+		assert.Zero(t, testing.AllocsPerRun(100, func() { entity.GetString() }))
+		for data, expected := range map[interface{}]string{int64(123456): "123456", int64(-100): "-100"} {
+			entity = RedisResponseEntity{data: data}
+			assert.Equal(t, float64(1), testing.AllocsPerRun(100, func() { entity.GetString() }))
+			assert.Equal(t, expected, entity.GetString())
+		}
+
+		entity = RedisResponseEntity{data: []byte("value")}
+		assert.Equal(t, float64(1), testing.AllocsPerRun(100, func() { entity.GetString() }))
+		assert.Equal(t, "value", entity.GetString())
+	})
+
+	t.Run("RedisResponse TryGet", func(t *testing.T) {
+		failed := &RedisResponse{Error: RedisNotFound}
+		_, err := failed.TryGetInt64()
+		assert.ErrorIs(t, err, RedisNotFound)
+		_, err = failed.TryGetFloat64()
+		assert.ErrorIs(t, err, RedisNotFound)
+		_, err = failed.TryGetString()
+		assert.ErrorIs(t, err, RedisNotFound)
+
+		resp := &RedisResponse{RedisResponseEntity: RedisResponseEntity{data: "7"}}
+		n, err := resp.TryGetInt64()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), n)
+	})
 }
 
 func TestRedisPool(t *testing.T) {
@@ -111,10 +277,113 @@ func TestRedisPool(t *testing.T) {
 		}
 		profile.Normalize()
 
-		client := newRedisClient(profile, profile.MasterAddrs(), false)
+		client := newRedisClient(profile, profile.MasterAddrs(), false, redisClientName("test"), nil, nil, nil)
 		assert.NotNil(t, client)
 		assert.NoError(t, client.Close())
 	})
+
+	t.Run("TestOnBorrow_Ping", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		conn := &redisTestOnBorrowConn{Conn: client, idle: time.Millisecond, timeout: time.Second, lastUsed: time.Now().Add(-time.Second)}
+		defer conn.Close()
+
+		go func() {
+			buf := make([]byte, len(redisPingCommand))
+			io.ReadFull(server, buf)
+			server.Write([]byte("+PONG\r\n"))
+			io.ReadFull(server, make([]byte, len("*1\r\n$4\r\nPING\r\n")))
+		}()
+
+		// Idle connection is checked before the command is written
+		_, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+		assert.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), conn.lastUsed, time.Second)
+	})
+
+	t.Run("TestOnBorrow_RESP3", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		conn := &redisTestOnBorrowConn{Conn: client, idle: time.Millisecond, timeout: time.Second, lastUsed: time.Now().Add(-time.Second)}
+		defer conn.Close()
+
+		invalidate := "*2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nkey\r\n"
+		go func() {
+			io.ReadFull(server, make([]byte, len(redisPingCommand)))
+			server.Write([]byte(">" + invalidate[1:] + "$4\r\nPONG\r\n"))
+			io.ReadFull(server, make([]byte, len("*1\r\n$4\r\nPING\r\n")))
+			server.Write([]byte("+PONG\r\n"))
+		}()
+
+		// Push messages received before the reply are read by the client afterwards
+		_, err := conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+		assert.NoError(t, err)
+		reply := make([]byte, len(invalidate)+len("+PONG\r\n"))
+		_, err = io.ReadFull(conn, reply)
+		assert.NoError(t, err)
+		assert.Equal(t, ">"+invalidate[1:]+"+PONG\r\n", string(reply))
+	})
+
+	t.Run("TestOnBorrow_ReadReply", func(t *testing.T) {
+		for _, reply := range []string{"+OK\r\n", "$-1\r\n", "$3\r\na\r\n\r\n", "*2\r\n:1\r\n_\r\n", "%1\r\n+a\r\n,1.5\r\n", "*-1\r\n"} {
+			read, err := redisReadReply(strings.NewReader(reply + "+NEXT\r\n"))
+			assert.NoError(t, err)
+			assert.Equal(t, reply, string(read))
+		}
+
+		read, err := redisReadReply(strings.NewReader("|1\r\n+key\r\n+value\r\n+PONG\r\n"))
+		assert.NoError(t, err)
+		assert.Equal(t, "+PONG\r\n", string(read))
+		_, err = redisReadReply(strings.NewReader("?\r\n"))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("TestOnBorrow_UnexpectedReply", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		conn := &redisTestOnBorrowConn{Conn: client, idle: time.Millisecond, timeout: time.Second, lastUsed: time.Now().Add(-time.Second)}
+		defer conn.Close()
+
+		go func() {
+			io.ReadFull(server, make([]byte, len(redisPingCommand)))
+			server.Write([]byte("-ERR xx\r\n"))
+		}()
+
+		// Unexpected replies surface as retryable errors so the pool drops the connection
+		_, err := conn.Write([]byte("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("TestOnBorrow_SubscribeCommand", func(t *testing.T) {
+		assert.True(t, redisIsSubscribeCommand([]byte("*2\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n")))
+		assert.True(t, redisIsSubscribeCommand([]byte("*2\r\n$10\r\nPSUBSCRIBE\r\n$2\r\nc*\r\n")))
+		assert.False(t, redisIsSubscribeCommand([]byte("*2\r\n$3\r\nGET\r\n$9\r\nsubscribe\r\n")))
+		assert.False(t, redisIsSubscribeCommand([]byte("*1")))
+	})
+
+	t.Run("TestOnBorrow_Profile", func(t *testing.T) {
+		profile := &secret.Redis{
+			Mode: secret.RedisModeSingle,
+			Master: secret.RedisMeta{
+				Host: "localhost",
+				Port: 6379,
+			},
+			TestOnBorrowIdle: 1,
+		}
+
+		redis := NewRedisWithProfile("test", profile)
+		defer redis.Master().Close()
+
+		for i := 0; i < 3; i++ {
+			time.Sleep(5 * time.Millisecond)
+			response := redis.Master().Ping()
+			assert.NoError(t, response.Error)
+			assert.Equal(t, "PONG", response.GetString())
+		}
+	})
 }
 
 // TestLoadRedisExampleSecret tests loading Redis secret from example file
@@ -170,18 +439,7 @@ func TestLoadRedisExampleSecret(t *testing.T) {
 
 // TestRedisKeyCommands Key command tests
 func TestRedisKeyCommands(t *testing.T) {
-	// Save original secret path and restore it after test
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
-
-	// Set secret path to the example directory
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
-
-	redis := NewRedis("test")
-	assert.NotNil(t, redis)
+	redis := testRedis(t)
 
 	t.Run("Copy", func(t *testing.T) {
 		redis.Master().Set("test_key", "test_value")
@@ -226,6 +484,53 @@ func TestRedisKeyCommands(t *testing.T) {
 		redis.Master().Delete("test_key")
 	})
 
+	t.Run("Dump_Restore", func(t *testing.T) {
+		redis.Master().Set("test_key", "test_value")
+		defer redis.Master().Delete("test_key", "test_key_restored")
+
+		payload := redis.Master().Dump("test_key").GetBytes()
+		assert.NotNil(t, payload)
+
+		response := redis.Master().Restore("test_key_restored", 60000, payload, false)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "OK", response.GetString())
+		assert.Equal(t, "test_value", redis.Master().Get("test_key_restored").GetString())
+		assert.True(t, redis.Master().PTTL("test_key_restored").GetInt64() > 0)
+
+		// Restoring onto an existing key fails without REPLACE
+		response = redis.Master().Restore("test_key_restored", 0, payload, false)
+		assert.Error(t, response.Error)
+
+		response = redis.Master().Restore("test_key_restored", 0, payload, true)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(-1), redis.Master().TTL("test_key_restored").GetInt64())
+	})
+
+	t.Run("Migrate", func(t *testing.T) {
+		// A server refuses to migrate to itself with IOERR, the target is a second instance
+		host, portStr, err := net.SplitHostPort(testserver.RedisMigrateAddr(t))
+		assert.NoError(t, err)
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		assert.NoError(t, err)
+
+		redis.Master().Set("test_migrate_key", "test_value")
+		defer redis.Master().Delete("test_migrate_key")
+
+		response := redis.Master().Migrate(host, uint(port), "test_migrate_key", 0, 1000, MigrateOptions{Copy: true, Replace: true})
+		if response.Error != nil && strings.HasPrefix(response.Error.Error(), "ERR unknown command") {
+			t.Skipf("MIGRATE not supported: %v", response.Error)
+		}
+
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "OK", response.GetString())
+		assert.Equal(t, "test_value", redis.Master().Get("test_migrate_key").GetString())
+
+		// Missing keys are reported as NOKEY
+		response = redis.Master().Migrate(host, uint(port), "", 0, 1000, MigrateOptions{Keys: []interface{}{"test_migrate_missing"}})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "NOKEY", response.GetString())
+	})
+
 	t.Run("TTL", func(t *testing.T) {
 		redis.Master().SetExpire("test_key", "test_value", 60)
 		response := redis.Master().TTL("test_key")
@@ -462,19 +767,133 @@ func TestRedisKeyCommands(t *testing.T) {
 }
 
 // TestRedisListCommands List command tests
-func TestRedisListCommands(t *testing.T) {
-	// Save original secret path and restore it after test
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
+func TestRedisExpireCommands(t *testing.T) {
+	redis := testRedis(t)
 
-	// Set secret path to the example directory
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
+	t.Run("PExpire", func(t *testing.T) {
+		key := "test_pexpire"
+		redis.Master().Set(key, "value")
+		defer redis.Master().Delete(key)
+
+		response := redis.Master().PExpire(key, 5000)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+
+		pttl := redis.Master().PTTL(key).GetInt64()
+		assert.True(t, pttl > 0 && pttl <= 5000)
+	})
+
+	t.Run("ExpireAt_ExpireTime", func(t *testing.T) {
+		key := "test_expireat"
+		redis.Master().Set(key, "value")
+		defer redis.Master().Delete(key)
+
+		timestamp := time.Now().Unix() + 60
+		response := redis.Master().ExpireAt(key, timestamp)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+
+		expireTime := redis.Master().ExpireTime(key)
+		assert.NoError(t, expireTime.Error)
+		assert.Equal(t, timestamp, expireTime.GetInt64())
+	})
+
+	t.Run("PExpireAt_PExpireTime", func(t *testing.T) {
+		key := "test_pexpireat"
+		redis.Master().Set(key, "value")
+		defer redis.Master().Delete(key)
+
+		timestamp := time.Now().UnixMilli() + 60000
+		response := redis.Master().PExpireAt(key, timestamp)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+
+		expireTime := redis.Master().PExpireTime(key)
+		assert.NoError(t, expireTime.Error)
+		assert.Equal(t, timestamp, expireTime.GetInt64())
+	})
+
+	t.Run("ExpireTime_NoExpiry", func(t *testing.T) {
+		key := "test_expiretime_persist"
+		redis.Master().Set(key, "value")
+		defer redis.Master().Delete(key)
+
+		assert.Equal(t, int64(-1), redis.Master().ExpireTime(key).GetInt64())
+		assert.Equal(t, int64(-2), redis.Master().PExpireTime("test_expiretime_missing").GetInt64())
+	})
+
+	t.Run("ExpireWithOptions", func(t *testing.T) {
+		key := "test_expire_opts"
+		redis.Master().Set(key, "value")
+		defer redis.Master().Delete(key)
+
+		// XX fails while the key has no expiry
+		response := redis.Master().ExpireWithOptions(key, 100, ExpireOptions{XX: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(0), response.GetInt64())
+
+		// NX succeeds while the key has no expiry
+		response = redis.Master().ExpireWithOptions(key, 100, ExpireOptions{NX: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+
+		// GT refuses a shorter expiry
+		response = redis.Master().ExpireWithOptions(key, 50, ExpireOptions{GT: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(0), response.GetInt64())
+
+		// LT accepts a shorter expiry
+		response = redis.Master().ExpireWithOptions(key, 50, ExpireOptions{LT: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+
+		ttl := redis.Master().TTL(key).GetInt64()
+		assert.True(t, ttl > 0 && ttl <= 50)
+	})
+
+	t.Run("PExpireWithOptions_ExpireAtWithOptions", func(t *testing.T) {
+		key := "test_pexpire_opts"
+		redis.Master().Set(key, "value")
+		defer redis.Master().Delete(key)
+
+		response := redis.Master().PExpireWithOptions(key, 10000, ExpireOptions{NX: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+
+		response = redis.Master().ExpireAtWithOptions(key, time.Now().Unix()+60, ExpireOptions{XX: true, GT: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+
+		response = redis.Master().PExpireAtWithOptions(key, time.Now().UnixMilli()+1000, ExpireOptions{GT: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(0), response.GetInt64())
+	})
+
+	t.Run("ExpireArgs", func(t *testing.T) {
+		valid := func(opts ExpireOptions) []interface{} {
+			args, err := expireArgs("k", 10, opts)
+			assert.NoError(t, err)
+			return args
+		}
+
+		assert.Equal(t, []interface{}{"k", int64(10)}, valid(ExpireOptions{}))
+		assert.Equal(t, []interface{}{"k", int64(10), "NX"}, valid(ExpireOptions{NX: true}))
+		assert.Equal(t, []interface{}{"k", int64(10), "XX", "GT"}, valid(ExpireOptions{XX: true, GT: true}))
+		assert.Equal(t, []interface{}{"k", int64(10), "LT"}, valid(ExpireOptions{LT: true}))
+
+		for _, opts := range []ExpireOptions{{NX: true, XX: true}, {NX: true, GT: true}, {NX: true, LT: true}, {GT: true, LT: true}} {
+			_, err := expireArgs("k", 10, opts)
+			assert.ErrorIs(t, err, ErrRedisOptionsConflict)
+		}
+
+		mock := NewMockRedisOp()
+		assert.ErrorIs(t, mock.ExpireWithOptions("k", 10, ExpireOptions{NX: true, GT: true}).Error, ErrRedisOptionsConflict)
+		assert.Empty(t, mock.GetCallsByCommand("EXPIRE"))
+	})
+}
 
-	redis := NewRedis("test")
-	assert.NotNil(t, redis)
+func TestRedisListCommands(t *testing.T) {
+	redis := testRedis(t)
 
 	t.Run("LPush_LLen_LIndex", func(t *testing.T) {
 		listKey := "test_list"
@@ -703,22 +1122,70 @@ func TestRedisListCommands(t *testing.T) {
 		// Cleanup
 		redis.Master().Delete(listKey)
 	})
+
+	t.Run("LPopN_RPopN", func(t *testing.T) {
+		listKey := "test_list_popn"
+		redis.Master().Delete(listKey)
+		defer redis.Master().Delete(listKey)
+
+		redis.Master().RPush(listKey, "a", "b", "c", "d", "e")
+
+		response := redis.Master().LPopN(listKey, 2)
+		assert.NoError(t, response.Error)
+		items := response.GetSlice()
+		assert.Len(t, items, 2)
+		assert.Equal(t, "a", items[0].GetString())
+		assert.Equal(t, "b", items[1].GetString())
+
+		response = redis.Master().RPopN(listKey, 2)
+		assert.NoError(t, response.Error)
+		items = response.GetSlice()
+		assert.Len(t, items, 2)
+		assert.Equal(t, "e", items[0].GetString())
+		assert.Equal(t, "d", items[1].GetString())
+
+		// Count larger than the list drains it
+		response = redis.Master().LPopN(listKey, 10)
+		assert.NoError(t, response.Error)
+		assert.Len(t, response.GetSlice(), 1)
+		assert.Equal(t, int64(0), redis.Master().LLen(listKey).GetInt64())
+
+		// Popping from a missing key returns nil
+		response = redis.Master().LPopN(listKey, 2)
+		assert.True(t, response.RecordNotFound())
+	})
+
+	t.Run("LPosWithOptions", func(t *testing.T) {
+		listKey := "test_list_lpos_opts"
+		redis.Master().Delete(listKey)
+		defer redis.Master().Delete(listKey)
+
+		redis.Master().RPush(listKey, "a", "b", "c", "b", "d", "b")
+
+		response := redis.Master().LPosWithOptions(listKey, "b", LPosOptions{Rank: 2})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(3), response.GetInt64())
+
+		response = redis.Master().LPosWithOptions(listKey, "b", LPosOptions{Rank: -1})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(5), response.GetInt64())
+
+		response = redis.Master().LPosWithOptions(listKey, "b", LPosOptions{Count: -1})
+		assert.NoError(t, response.Error)
+		positions := response.GetSlice()
+		assert.Len(t, positions, 3)
+		assert.Equal(t, int64(1), positions[0].GetInt64())
+		assert.Equal(t, int64(5), positions[2].GetInt64())
+
+		response = redis.Master().LPosWithOptions(listKey, "b", LPosOptions{Count: 5, MaxLen: 4})
+		assert.NoError(t, response.Error)
+		assert.Len(t, response.GetSlice(), 2)
+	})
 }
 
 // TestRedisSetCommands Set command tests
 func TestRedisSetCommands(t *testing.T) {
-	// Save original secret path and restore it after test
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
-
-	// Set secret path to the example directory
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
-
-	redis := NewRedis("test")
-	assert.NotNil(t, redis)
+	redis := testRedis(t)
 
 	t.Run("SAdd_SCard_SMembers", func(t *testing.T) {
 		setKey := "test_set"
@@ -936,22 +1403,43 @@ func TestRedisSetCommands(t *testing.T) {
 		// Cleanup
 		redis.Master().Delete(setKey)
 	})
+
+	t.Run("SPopN_SRandMemberN", func(t *testing.T) {
+		setKey := "test_set_count"
+		redis.Master().Delete(setKey)
+		defer redis.Master().Delete(setKey)
+
+		redis.Master().SAdd(setKey, "member1", "member2", "member3", "member4", "member5")
+
+		// SRandMemberN (doesn't remove)
+		randResp := redis.Master().SRandMemberN(setKey, 3)
+		assert.NoError(t, randResp.Error)
+		assert.Len(t, randResp.GetSlice(), 3)
+
+		// Negative count allows repeated members
+		repeatResp := redis.Master().SRandMemberN(setKey, -8)
+		assert.NoError(t, repeatResp.Error)
+		assert.Len(t, repeatResp.GetSlice(), 8)
+
+		// SPopN
+		popResp := redis.Master().SPopN(setKey, 2)
+		assert.NoError(t, popResp.Error)
+		assert.Len(t, popResp.GetSlice(), 2)
+
+		cardResp := redis.Master().SCard(setKey)
+		assert.NoError(t, cardResp.Error)
+		assert.Equal(t, int64(3), cardResp.GetInt64())
+
+		// Count larger than the set drains it
+		drainResp := redis.Master().SPopN(setKey, 10)
+		assert.NoError(t, drainResp.Error)
+		assert.Len(t, drainResp.GetSlice(), 3)
+	})
 }
 
 // TestRedisSortedSetCommands Sorted Set command tests
 func TestRedisSortedSetCommands(t *testing.T) {
-	// Save original secret path and restore it after test
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
-
-	// Set secret path to the example directory
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
-
-	redis := NewRedis("test")
-	assert.NotNil(t, redis)
+	redis := testRedis(t)
 
 	t.Run("ZAdd_ZCard_ZRange", func(t *testing.T) {
 		zsetKey := "test_zset"
@@ -1368,35 +1856,129 @@ func TestRedisSortedSetCommands(t *testing.T) {
 		// Cleanup
 		redis.Master().Delete(zsetKey)
 	})
-}
 
-// TestRedisHashCommands Hash command tests
-func TestRedisHashCommands(t *testing.T) {
-	// Save original secret path and restore it after test
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
+	t.Run("ZRandMemberN", func(t *testing.T) {
+		zsetKey := "test_zset_randmember"
+		redis.Master().Delete(zsetKey)
+		defer redis.Master().Delete(zsetKey)
 
-	// Set secret path to the example directory
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
+		redis.Master().ZAdd(zsetKey, 1.0, "a", 2.0, "b", 3.0, "c")
 
-	redis := NewRedis("test")
-	assert.NotNil(t, redis)
+		response := redis.Master().ZRandMemberN(zsetKey, 2, false)
+		assert.NoError(t, response.Error)
+		assert.Len(t, response.GetSlice(), 2)
 
-	// Clean test environment
-	defer func() {
-		redis.Master().Delete("test_hash", "test_hash_2", "test_hash_incr", "test_hash_scan")
-		redis.Master().Close()
-	}()
+		// RESP2 replies alternate member/score while RESP3 replies nest [member, score] pairs
+		withScores := redis.Master().ZRandMemberN(zsetKey, 3, true)
+		assert.NoError(t, withScores.Error)
+		assert.NotEmpty(t, withScores.GetSlice())
 
-	t.Run("HSet_HGet_Basic_Set_And_Get", func(t *testing.T) {
-		hashKey := "test_hash"
-		field := "test_field"
-		value := "test_value"
+		cardResp := redis.Master().ZCard(zsetKey)
+		assert.NoError(t, cardResp.Error)
+		assert.Equal(t, int64(3), cardResp.GetInt64())
+	})
 
-		// HSet - set hash fieldvalue
+	t.Run("ZAddWithOptions", func(t *testing.T) {
+		zsetKey := "test_zset_zadd_opts"
+		redis.Master().Delete(zsetKey)
+		defer redis.Master().Delete(zsetKey)
+
+		// NX only adds new members
+		response := redis.Master().ZAddWithOptions(zsetKey, ZAddOptions{NX: true}, 10, "a", 20, "b")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(2), response.GetInt64())
+
+		response = redis.Master().ZAddWithOptions(zsetKey, ZAddOptions{NX: true}, 99, "a")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(0), response.GetInt64())
+		assert.Equal(t, 10.0, redis.Master().ZScore(zsetKey, "a").GetFloat64())
+
+		// XX + CH reports updated members and never adds new ones
+		response = redis.Master().ZAddWithOptions(zsetKey, ZAddOptions{XX: true, CH: true}, 15, "a", 30, "c")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+		assert.True(t, redis.Master().ZScore(zsetKey, "c").RecordNotFound())
+
+		// GT only raises scores
+		response = redis.Master().ZAddWithOptions(zsetKey, ZAddOptions{GT: true, CH: true}, 5, "a", 25, "b")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+		assert.Equal(t, 15.0, redis.Master().ZScore(zsetKey, "a").GetFloat64())
+		assert.Equal(t, 25.0, redis.Master().ZScore(zsetKey, "b").GetFloat64())
+
+		// LT only lowers scores
+		response = redis.Master().ZAddWithOptions(zsetKey, ZAddOptions{LT: true, CH: true}, 1, "a")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(1), response.GetInt64())
+		assert.Equal(t, 1.0, redis.Master().ZScore(zsetKey, "a").GetFloat64())
+
+		// INCR returns the new score
+		response = redis.Master().ZAddWithOptions(zsetKey, ZAddOptions{INCR: true}, 2.5, "a")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, 3.5, response.GetFloat64())
+
+		// INCR with a failed NX condition returns nil
+		response = redis.Master().ZAddWithOptions(zsetKey, ZAddOptions{NX: true, INCR: true}, 1, "a")
+		assert.True(t, response.RecordNotFound())
+	})
+
+	t.Run("ZRangeWithOptions", func(t *testing.T) {
+		zsetKey := "test_zset_range_opts"
+		redis.Master().Delete(zsetKey)
+		defer redis.Master().Delete(zsetKey)
+
+		redis.Master().ZAdd(zsetKey, 1, "a", 2, "b", 3, "c", 4, "d", 5, "e")
+
+		// BYSCORE with LIMIT and WITHSCORES
+		response := redis.Master().ZRangeWithOptions(zsetKey, "2", "+inf", ZRangeOptions{ByScore: true, Offset: 1, Count: 2, WithScores: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, []ZMember{{Member: "c", Score: 3}, {Member: "d", Score: 4}}, response.GetZMembers())
+
+		// REV by index
+		response = redis.Master().ZRangeWithOptions(zsetKey, "0", "1", ZRangeOptions{Rev: true, WithScores: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, []ZMember{{Member: "e", Score: 5}, {Member: "d", Score: 4}}, response.GetZMembers())
+
+		// BYSCORE + REV expects max before min
+		response = redis.Master().ZRangeWithOptions(zsetKey, "(5", "-inf", ZRangeOptions{ByScore: true, Rev: true, Count: 1})
+		assert.NoError(t, response.Error)
+		members := response.GetSlice()
+		assert.Len(t, members, 1)
+		assert.Equal(t, "d", members[0].GetString())
+	})
+
+	t.Run("ZRangeWithOptions_ByLex", func(t *testing.T) {
+		zsetKey := "test_zset_range_lex"
+		redis.Master().Delete(zsetKey)
+		defer redis.Master().Delete(zsetKey)
+
+		redis.Master().ZAdd(zsetKey, 0, "apple", 0, "banana", 0, "cherry", 0, "date")
+
+		response := redis.Master().ZRangeWithOptions(zsetKey, "[b", "+", ZRangeOptions{ByLex: true, Count: 2})
+		assert.NoError(t, response.Error)
+		members := response.GetSlice()
+		assert.Len(t, members, 2)
+		assert.Equal(t, "banana", members[0].GetString())
+		assert.Equal(t, "cherry", members[1].GetString())
+	})
+}
+
+// TestRedisHashCommands Hash command tests
+func TestRedisHashCommands(t *testing.T) {
+	redis := testRedis(t)
+
+	// Clean test environment
+	defer func() {
+		redis.Master().Delete("test_hash", "test_hash_2", "test_hash_incr", "test_hash_scan")
+		redis.Master().Close()
+	}()
+
+	t.Run("HSet_HGet_Basic_Set_And_Get", func(t *testing.T) {
+		hashKey := "test_hash"
+		field := "test_field"
+		value := "test_value"
+
+		// HSet - set hash fieldvalue
 		setResp := redis.Master().HSet(hashKey, field, value)
 		assert.NoError(t, setResp.Error)
 		assert.Equal(t, int64(1), setResp.GetInt64()) // newfieldshouldreturn 1
@@ -1778,22 +2360,53 @@ func TestRedisHashCommands(t *testing.T) {
 		assert.NoError(t, hlen.Error)
 		assert.Equal(t, int64(2), hlen.GetInt64())
 	})
+
+	t.Run("HRandField_HRandFieldN", func(t *testing.T) {
+		hashKey := "test_hash_randfield"
+		redis.Master().Delete(hashKey)
+		defer redis.Master().Delete(hashKey)
+
+		redis.Master().HSet(hashKey, "field1", "value1")
+		redis.Master().HSet(hashKey, "field2", "value2")
+		redis.Master().HSet(hashKey, "field3", "value3")
+
+		single := redis.Master().HRandField(hashKey)
+		assert.NoError(t, single.Error)
+		assert.Contains(t, []string{"field1", "field2", "field3"}, single.GetString())
+
+		fields := redis.Master().HRandFieldN(hashKey, 2, false)
+		assert.NoError(t, fields.Error)
+		assert.Len(t, fields.GetSlice(), 2)
+
+		// RESP2 replies alternate field/value while RESP3 replies nest [field, value] pairs
+		withValues := redis.Master().HRandFieldN(hashKey, 5, true)
+		assert.NoError(t, withValues.Error)
+		assert.NotEmpty(t, withValues.GetSlice())
+
+		missing := redis.Master().HRandField("test_hash_randfield_missing")
+		assert.True(t, missing.RecordNotFound())
+	})
+
+	t.Run("HStrLen", func(t *testing.T) {
+		hashKey := "test_hash_strlen"
+		redis.Master().Delete(hashKey)
+		defer redis.Master().Delete(hashKey)
+
+		redis.Master().HSet(hashKey, "field", "hello")
+
+		response := redis.Master().HStrLen(hashKey, "field")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(5), response.GetInt64())
+
+		missing := redis.Master().HStrLen(hashKey, "missing")
+		assert.NoError(t, missing.Error)
+		assert.Equal(t, int64(0), missing.GetInt64())
+	})
 }
 
 // TestRedisEval Script command tests
 func TestRedisEval(t *testing.T) {
-	// Save original secret path and restore it after test
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
-
-	// Set secret path to the example directory
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
-
-	redis := NewRedis("test")
-	assert.NotNil(t, redis)
+	redis := testRedis(t)
 
 	t.Run("EvalBasicScript", func(t *testing.T) {
 		// Simple script that returns a string
@@ -1883,22 +2496,24 @@ func TestRedisEval(t *testing.T) {
 		response := redis.Master().Eval(script, []interface{}{}, []interface{}{})
 		assert.Error(t, response.Error)
 	})
+
+	t.Run("EvalSha", func(t *testing.T) {
+		script := "return {KEYS[1], ARGV[1]}"
+		sha := redis.Master().ScriptLoad(script)
+		assert.NoError(t, sha.Error)
+		assert.Equal(t, mockScriptSHA(script), sha.GetString())
+
+		response := redis.Master().EvalSha(sha.GetString(), []interface{}{"key1"}, []interface{}{"arg1"})
+		assert.NoError(t, response.Error)
+		slice := response.GetSlice()
+		assert.Equal(t, "key1", slice[0].GetString())
+		assert.Equal(t, "arg1", slice[1].GetString())
+	})
 }
 
 // TestRedisStringCommands String command tests - completecoverall 11  String command
 func TestRedisStringCommands(t *testing.T) {
-	// Save original secret path and restore it after test
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
-
-	// Set secret path to the example directory
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
-
-	redis := NewRedis("test")
-	assert.NotNil(t, redis)
+	redis := testRedis(t)
 
 	// Clean test environment
 	defer func() {
@@ -2576,6 +3191,75 @@ func TestRedisStringCommands(t *testing.T) {
 	})
 }
 
+func TestRedisConnectionCommands(t *testing.T) {
+	redis := testRedis(t)
+
+	t.Run("ClientName", func(t *testing.T) {
+		assert.Equal(t, "goth-datastore:test", redisClientName("test"))
+		assert.Equal(t, "goth-datastore:my_profile", redisClientName("my profile"))
+
+		origPrefix := DefaultRedisClientNamePrefix
+		defer func() {
+			DefaultRedisClientNamePrefix = origPrefix
+		}()
+
+		DefaultRedisClientNamePrefix = ""
+		assert.Equal(t, "", redisClientName("test"))
+	})
+
+	t.Run("ClientGetName_Default", func(t *testing.T) {
+		response := redis.Master().ClientGetName()
+		assert.NoError(t, response.Error)
+		assert.Equal(t, redisClientName(testserver.ProfileName), response.GetString())
+	})
+
+	t.Run("ClientSetName_ClientGetName", func(t *testing.T) {
+		op := testRedis(t).Master()
+
+		response := op.ClientSetName("goth-datastore:renamed")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "OK", response.GetString())
+
+		getResp := op.ClientGetName()
+		assert.NoError(t, getResp.Error)
+		assert.Equal(t, "goth-datastore:renamed", getResp.GetString())
+	})
+
+	t.Run("ClientList", func(t *testing.T) {
+		response := redis.Master().ClientList()
+		assert.NoError(t, response.Error)
+		assert.Contains(t, response.GetString(), "name="+redisClientName(testserver.ProfileName))
+	})
+
+	t.Run("ClientKill", func(t *testing.T) {
+		response := redis.Master().ClientKill("ADDR", "127.0.0.1:1", "SKIPME", "yes")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(0), response.GetInt64())
+	})
+}
+
+func TestRedisReplicationCommands(t *testing.T) {
+	redis := testRedis(t)
+
+	t.Run("Wait", func(t *testing.T) {
+		redis.Master().Set("test_wait_key", "value")
+		defer redis.Master().Delete("test_wait_key")
+
+		// No replicas are required, so WAIT returns immediately
+		response := redis.Master().Wait(0, 100)
+		assert.NoError(t, response.Error)
+		assert.True(t, response.GetInt64() >= 0)
+	})
+
+	t.Run("FailoverArgs", func(t *testing.T) {
+		assert.Equal(t, []interface{}{}, failoverArgs(FailoverOptions{}))
+		assert.Equal(t, []interface{}{"ABORT"}, failoverArgs(FailoverOptions{Abort: true, Host: "127.0.0.1", Port: 6380}))
+		assert.Equal(t, []interface{}{"TIMEOUT", int64(500)}, failoverArgs(FailoverOptions{Timeout: 500}))
+		assert.Equal(t, []interface{}{"TO", "127.0.0.1", uint(6380), "FORCE", "TIMEOUT", int64(500)},
+			failoverArgs(FailoverOptions{Host: "127.0.0.1", Port: 6380, Force: true, Timeout: 500}))
+	})
+}
+
 // =============================================================================
 // Mock Redis Tests - Comprehensive Testing of Mock Functionality
 // =============================================================================
@@ -2909,6 +3593,28 @@ func TestMockRedisHashCommands(t *testing.T) {
 			assert.Equal(t, expectedCmd, history[i].Command)
 		}
 	})
+
+	t.Run("HRandField_HStrLen_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("HRANDFIELD", "hash1", []interface{}{"field1", "value1"}, nil)
+		mock.SetResponse("HSTRLEN", "hash1", int64(6), nil)
+
+		randResp := mock.HRandFieldN("hash1", 1, true)
+		assert.NoError(t, randResp.Error)
+		assert.Len(t, randResp.GetSlice(), 2)
+
+		singleResp := mock.HRandField("hash1")
+		assert.NoError(t, singleResp.Error)
+
+		strLenResp := mock.HStrLen("hash1", "field1")
+		assert.NoError(t, strLenResp.Error)
+		assert.Equal(t, int64(6), strLenResp.GetInt64())
+
+		calls := mock.GetCallsByCommand("HRANDFIELD")
+		assert.Len(t, calls, 2)
+		assert.Equal(t, []interface{}{"hash1", int64(1), "WITHVALUES"}, calls[0].Args)
+		assert.Equal(t, []interface{}{"hash1"}, calls[1].Args)
+	})
 }
 
 func TestMockRedisStringCommands(t *testing.T) {
@@ -3040,18 +3746,7 @@ func TestMockRedisBackwardCompatibility(t *testing.T) {
 		// This test verifies that real Redis instances still work
 		// when using the interface-based design
 
-		// Save original secret path and restore it after test
-		originalPath := secret.Path()
-		defer func() {
-			secret.PATH = originalPath
-		}()
-
-		// Set secret path to the example directory
-		wd, _ := os.Getwd()
-		secret.PATH = filepath.Join(wd, "example")
-
-		realRedis := NewRedis("test")
-		assert.NotNil(t, realRedis)
+		realRedis := testRedis(t)
 
 		// Test interface methods work with real Redis
 		master := realRedis.Master()
@@ -3071,18 +3766,7 @@ func TestMockRedisBackwardCompatibility(t *testing.T) {
 }
 
 func TestRedisDirectCommandIntegration(t *testing.T) {
-	originalPath := secret.Path()
-	defer func() {
-		secret.PATH = originalPath
-	}()
-
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
-
-	realRedis := NewRedis("test")
-	if !assert.NotNil(t, realRedis) {
-		return
-	}
+	realRedis := testRedis(t)
 
 	pingResp := realRedis.Master().Do("PING")
 	assert.NoError(t, pingResp.Error)
@@ -3116,6 +3800,35 @@ func TestMockRedisConnectionAndPool(t *testing.T) {
 	})
 }
 
+func TestMockRedisConnectionCommands(t *testing.T) {
+	mock := NewMockRedisOp()
+	mock.SetResponse("CLIENT", "LIST", "id=1 addr=127.0.0.1:50000 name=goth-datastore:mock", nil)
+	mock.SetResponse("CLIENT", "GETNAME", "goth-datastore:mock", nil)
+	mock.SetResponse("CLIENT", "SETNAME", "OK", nil)
+	mock.SetResponse("CLIENT", "KILL", int64(1), nil)
+
+	listResp := mock.ClientList()
+	assert.NoError(t, listResp.Error)
+	assert.Contains(t, listResp.GetString(), "name=goth-datastore:mock")
+
+	getNameResp := mock.ClientGetName()
+	assert.NoError(t, getNameResp.Error)
+	assert.Equal(t, "goth-datastore:mock", getNameResp.GetString())
+
+	setNameResp := mock.ClientSetName("renamed")
+	assert.NoError(t, setNameResp.Error)
+	assert.Equal(t, "OK", setNameResp.GetString())
+
+	killResp := mock.ClientKill("ID", int64(1))
+	assert.NoError(t, killResp.Error)
+	assert.Equal(t, int64(1), killResp.GetInt64())
+
+	calls := mock.GetCallsByCommand("CLIENT")
+	assert.Len(t, calls, 4)
+	assert.Equal(t, []interface{}{"SETNAME", "renamed"}, calls[2].Args)
+	assert.Equal(t, []interface{}{"KILL", "ID", int64(1)}, calls[3].Args)
+}
+
 func TestMockRedisPipeline(t *testing.T) {
 	t.Run("Pipeline_With_Mock_Responses", func(t *testing.T) {
 		mock := NewMockRedisOp()
@@ -3152,6 +3865,30 @@ func TestMockRedisPipeline(t *testing.T) {
 		assert.Len(t, history, 1)
 		assert.Equal(t, "PIPELINE", history[0].Command)
 	})
+
+	t.Run("Transaction_Pipeline_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("SET", "key1", "OK", nil)
+		mock.SetResponse("INCR", "counter", int64(2), nil)
+
+		cmds := []RedisPipelineCmd{
+			{Cmd: "SET", Args: []interface{}{"key1", "value1"}},
+			{Cmd: "INCR", Args: []interface{}{"counter"}},
+		}
+
+		responses := mock.PipelineWithOptions(RedisPipelineOptions{Transaction: true}, cmds...)
+		assert.Len(t, responses, 2)
+		assert.Equal(t, "OK", responses[0].GetString())
+		assert.Equal(t, int64(2), responses[1].GetInt64())
+
+		// Non transactional options behave like Pipeline
+		mock.PipelineWithOptions(RedisPipelineOptions{}, cmds...)
+
+		history := mock.GetCallHistory()
+		assert.Len(t, history, 2)
+		assert.Equal(t, "TXPIPELINE", history[0].Command)
+		assert.Equal(t, "PIPELINE", history[1].Command)
+	})
 }
 
 func TestMockRedisListCommands(t *testing.T) {
@@ -3255,6 +3992,29 @@ func TestMockRedisListCommands(t *testing.T) {
 		assert.Equal(t, 1, len(lpushCalls))
 		assert.Equal(t, []interface{}{"list1", "item1"}, lpushCalls[0].Args)
 	})
+
+	t.Run("PopN_LPosWithOptions_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("LPOP", "list1", []interface{}{"item1", "item2"}, nil)
+		mock.SetResponse("RPOP", "list1", []interface{}{"item4", "item3"}, nil)
+		mock.SetResponse("LPOS", "list1", []interface{}{int64(1), int64(3)}, nil)
+
+		response := mock.LPopN("list1", 2)
+		assert.NoError(t, response.Error)
+		assert.Len(t, response.GetSlice(), 2)
+
+		response = mock.RPopN("list1", 2)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "item4", response.GetSlice()[0].GetString())
+
+		response = mock.LPosWithOptions("list1", "item", LPosOptions{Rank: -1, Count: -1, MaxLen: 100})
+		assert.NoError(t, response.Error)
+		assert.Len(t, response.GetSlice(), 2)
+
+		assert.Equal(t, []interface{}{"list1", int64(2)}, mock.GetCallsByCommand("LPOP")[0].Args)
+		assert.Equal(t, []interface{}{"list1", int64(2)}, mock.GetCallsByCommand("RPOP")[0].Args)
+		assert.Equal(t, []interface{}{"list1", "item", "RANK", int64(-1), "COUNT", 0, "MAXLEN", int64(100)}, mock.GetCallsByCommand("LPOS")[0].Args)
+	})
 }
 
 func TestMockRedisSetCommands(t *testing.T) {
@@ -3358,6 +4118,23 @@ func TestMockRedisSetCommands(t *testing.T) {
 		assert.Equal(t, 1, len(saddCalls))
 		assert.Equal(t, []interface{}{"set1", "item1"}, saddCalls[0].Args)
 	})
+
+	t.Run("Count_Variants_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("SPOP", "set1", []interface{}{"item1", "item2"}, nil)
+		mock.SetResponse("SRANDMEMBER", "set1", []interface{}{"item1", "item3"}, nil)
+
+		popResp := mock.SPopN("set1", 2)
+		assert.NoError(t, popResp.Error)
+		assert.Len(t, popResp.GetSlice(), 2)
+
+		randResp := mock.SRandMemberN("set1", 2)
+		assert.NoError(t, randResp.Error)
+		assert.Len(t, randResp.GetSlice(), 2)
+
+		assert.Equal(t, []interface{}{"set1", int64(2)}, mock.GetCallsByCommand("SPOP")[0].Args)
+		assert.Equal(t, []interface{}{"set1", int64(2)}, mock.GetCallsByCommand("SRANDMEMBER")[0].Args)
+	})
 }
 
 func TestMockRedisSortedSetCommands(t *testing.T) {
@@ -3536,6 +4313,61 @@ func TestMockRedisSortedSetCommands(t *testing.T) {
 		assert.Equal(t, 1, len(zaddCalls))
 		assert.Equal(t, []interface{}{"zset1", 1.0, "member1"}, zaddCalls[0].Args)
 	})
+
+	t.Run("ZRandMemberN_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("ZRANDMEMBER", "zset1", []interface{}{"member1", "1", "member2", "2"}, nil)
+
+		response := mock.ZRandMemberN("zset1", 2, true)
+		assert.NoError(t, response.Error)
+		assert.Len(t, response.GetSlice(), 4)
+
+		mock.ZRandMemberN("zset1", -3, false)
+
+		calls := mock.GetCallsByCommand("ZRANDMEMBER")
+		assert.Equal(t, []interface{}{"zset1", int64(2), "WITHSCORES"}, calls[0].Args)
+		assert.Equal(t, []interface{}{"zset1", int64(-3)}, calls[1].Args)
+	})
+
+	t.Run("ZAddWithOptions_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("ZADD", "zset1", int64(2), nil)
+
+		response := mock.ZAddWithOptions("zset1", ZAddOptions{XX: true, GT: true, CH: true}, 1.5, "member1", 2.5, "member2")
+		assert.NoError(t, response.Error)
+		assert.Equal(t, int64(2), response.GetInt64())
+
+		mock.ZAddWithOptions("zset1", ZAddOptions{NX: true, INCR: true}, 1, "member1")
+
+		calls := mock.GetCallsByCommand("ZADD")
+		assert.Equal(t, []interface{}{"zset1", "XX", "GT", "CH", 1.5, "member1", 2.5, "member2"}, calls[0].Args)
+		assert.Equal(t, []interface{}{"zset1", "NX", "INCR", 1.0, "member1"}, calls[1].Args)
+
+		// Flags Redis does not combine fail without a call
+		for _, opts := range []ZAddOptions{{NX: true, XX: true}, {NX: true, GT: true}, {NX: true, LT: true}, {GT: true, LT: true}} {
+			assert.ErrorIs(t, mock.ZAddWithOptions("zset1", opts, 1, "member1").Error, ErrRedisOptionsConflict)
+		}
+
+		assert.ErrorIs(t, mock.ZAddWithOptions("zset1", ZAddOptions{INCR: true}, 1, "member1", 2, "member2").Error, ErrRedisOptionsConflict)
+		assert.Len(t, mock.GetCallsByCommand("ZADD"), 2)
+	})
+
+	t.Run("ZRangeWithOptions_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("ZRANGE", "zset1", []interface{}{"member1", "1.5", "member2", "2.5"}, nil)
+
+		response := mock.ZRangeWithOptions("zset1", "-inf", "+inf", ZRangeOptions{ByScore: true, Rev: true, Offset: 0, Count: 10, WithScores: true})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, []ZMember{{Member: "member1", Score: 1.5}, {Member: "member2", Score: 2.5}}, response.GetZMembers())
+
+		calls := mock.GetCallsByCommand("ZRANGE")
+		assert.Equal(t, []interface{}{"zset1", "-inf", "+inf", "BYSCORE", "REV", "LIMIT", int64(0), int64(10), "WITHSCORES"}, calls[0].Args)
+
+		// Nested RESP3 style pairs are parsed as well
+		mock.SetResponse("ZRANGE", "zset2", []interface{}{[]interface{}{"member1", 1.5}, []interface{}{"member2", 2.5}}, nil)
+		response = mock.ZRangeWithOptions("zset2", "0", "-1", ZRangeOptions{WithScores: true})
+		assert.Equal(t, []ZMember{{Member: "member1", Score: 1.5}, {Member: "member2", Score: 2.5}}, response.GetZMembers())
+	})
 }
 
 func TestMockRedisKeyTTLCommands(t *testing.T) {
@@ -3649,19 +4481,604 @@ func TestMockRedisKeyTTLCommands(t *testing.T) {
 		assert.Equal(t, 1, len(expireCalls))
 		assert.Equal(t, []interface{}{"key1", int64(3600)}, expireCalls[0].Args)
 	})
+
+	t.Run("Restore_Migrate_With_Mock_Responses", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("RESTORE", "key1", "OK", nil)
+		mock.SetResponse("MIGRATE", "*", "OK", nil)
+
+		response := mock.Restore("key1", 1000, []byte("serialized_data"), true)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "OK", response.GetString())
+		assert.Equal(t, []interface{}{"key1", int64(1000), []byte("serialized_data"), "REPLACE"}, mock.GetCallsByCommand("RESTORE")[0].Args)
+
+		response = mock.Migrate("10.0.0.2", 6379, "key1", 0, 5000, MigrateOptions{Copy: true, Password: "secret"})
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "OK", response.GetString())
+
+		mock.Migrate("10.0.0.2", 6379, "ignored", 2, 5000, MigrateOptions{Replace: true, Username: "user", Password: "secret", Keys: []interface{}{"key1", "key2"}})
+
+		calls := mock.GetCallsByCommand("MIGRATE")
+		assert.Equal(t, []interface{}{"10.0.0.2", uint(6379), "key1", 0, int64(5000), "COPY", "AUTH", "secret"}, calls[0].Args)
+		assert.Equal(t, []interface{}{"10.0.0.2", uint(6379), "", 2, int64(5000), "REPLACE", "AUTH2", "user", "secret", "KEYS", "key1", "key2"}, calls[1].Args)
+	})
+}
+
+func TestMockRedisReplicationCommands(t *testing.T) {
+	mock := NewMockRedisOp()
+	mock.SetResponse("WAIT", "*", int64(2), nil)
+	mock.SetResponse("FAILOVER", "", "OK", nil)
+	mock.SetResponse("FAILOVER", "ABORT", "OK", nil)
+
+	waitResp := mock.Wait(2, 1000)
+	assert.NoError(t, waitResp.Error)
+	assert.Equal(t, int64(2), waitResp.GetInt64())
+
+	failoverResp := mock.Failover(FailoverOptions{})
+	assert.NoError(t, failoverResp.Error)
+	assert.Equal(t, "OK", failoverResp.GetString())
+
+	abortResp := mock.Failover(FailoverOptions{Abort: true})
+	assert.NoError(t, abortResp.Error)
+	assert.Equal(t, "OK", abortResp.GetString())
+
+	lastCall := mock.GetLastCall()
+	assert.Equal(t, "FAILOVER", lastCall.Command)
+	assert.Equal(t, []interface{}{"ABORT"}, lastCall.Args)
+	assert.Equal(t, []interface{}{int64(2), int64(1000)}, mock.GetCallsByCommand("WAIT")[0].Args)
+}
+
+func TestMockRedisExpireCommands(t *testing.T) {
+	mock := NewMockRedisOp()
+	mock.SetResponse("PEXPIRE", "*", int64(1), nil)
+	mock.SetResponse("EXPIREAT", "*", int64(1), nil)
+	mock.SetResponse("PEXPIREAT", "*", int64(1), nil)
+	mock.SetResponse("EXPIRE", "*", int64(0), nil)
+	mock.SetResponse("EXPIRETIME", "*", int64(1700000000), nil)
+	mock.SetResponse("PEXPIRETIME", "*", int64(1700000000000), nil)
+
+	assert.Equal(t, int64(1), mock.PExpire("key", 1000).GetInt64())
+	assert.Equal(t, int64(1), mock.ExpireAt("key", 1700000000).GetInt64())
+	assert.Equal(t, int64(1), mock.PExpireAt("key", 1700000000000).GetInt64())
+	assert.Equal(t, int64(1), mock.PExpireWithOptions("key", 1000, ExpireOptions{NX: true}).GetInt64())
+	assert.Equal(t, int64(1), mock.ExpireAtWithOptions("key", 1700000000, ExpireOptions{GT: true}).GetInt64())
+	assert.Equal(t, int64(1), mock.PExpireAtWithOptions("key", 1700000000000, ExpireOptions{LT: true}).GetInt64())
+	assert.Equal(t, int64(0), mock.ExpireWithOptions("key", 10, ExpireOptions{XX: true}).GetInt64())
+	assert.Equal(t, int64(1700000000), mock.ExpireTime("key").GetInt64())
+	assert.Equal(t, int64(1700000000000), mock.PExpireTime("key").GetInt64())
+
+	expireCalls := mock.GetCallsByCommand("EXPIRE")
+	assert.Len(t, expireCalls, 1)
+	assert.Equal(t, []interface{}{"key", int64(10), "XX"}, expireCalls[0].Args)
+	assert.Equal(t, []interface{}{"key", int64(1700000000000), "LT"}, mock.GetCallsByCommand("PEXPIREAT")[1].Args)
+}
+
+func TestMockRedisStatefulMode(t *testing.T) {
+	t.Run("Strings_And_Keys", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.EnableStatefulMode()
+		assert.True(t, mock.IsStateful())
+
+		assert.True(t, mock.Get("key1").RecordNotFound())
+		assert.Equal(t, "OK", mock.Set("key1", "value1").GetString())
+		assert.Equal(t, "value1", mock.Get("key1").GetString())
+
+		assert.Equal(t, int64(1), mock.Incr("counter").GetInt64())
+		assert.Equal(t, int64(11), mock.IncrBy("counter", 10).GetInt64())
+		assert.Equal(t, int64(10), mock.Decr("counter").GetInt64())
+		assert.Error(t, mock.Incr("key1").Error)
+
+		assert.True(t, mock.SetWithOptions("key1", "value2", SetOptions{NX: true}).RecordNotFound())
+		assert.Equal(t, "value1", mock.SetWithOptions("key1", "value2", SetOptions{GET: true}).GetString())
+		assert.Equal(t, int64(11), mock.Append("key1", "_tail").GetInt64())
+		assert.Equal(t, "value2_tail", mock.Get("key1").GetString())
+
+		assert.Equal(t, int64(2), mock.Exists("key1", "counter", "missing").GetInt64())
+		assert.Equal(t, "string", mock.Type("key1").GetString())
+		assert.Equal(t, "OK", mock.Rename("key1", "key2").GetString())
+		assert.Equal(t, int64(1), mock.Delete("key2").GetInt64())
+		assert.Equal(t, "none", mock.Type("key2").GetString())
+
+		// Wrong type errors like Redis
+		mock.HSet("hash1", "field", "value")
+		assert.EqualError(t, mock.Get("hash1").Error, "WRONGTYPE Operation against a key holding the wrong kind of value")
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.EnableStatefulMode()
+
+		mock.SetExpire("session", "data", 60)
+		assert.Equal(t, int64(60), mock.TTL("session").GetInt64())
+		assert.Equal(t, int64(-2), mock.TTL("missing").GetInt64())
+
+		mock.Set("forever", "data")
+		assert.Equal(t, int64(-1), mock.TTL("forever").GetInt64())
+		assert.Equal(t, int64(0), mock.ExpireWithOptions("forever", 10, ExpireOptions{XX: true}).GetInt64())
+
+		mock.PExpire("forever", 20)
+		time.Sleep(30 * time.Millisecond)
+		assert.True(t, mock.Get("forever").RecordNotFound())
+		assert.Equal(t, int64(1), mock.Persist("session").GetInt64())
+		assert.Equal(t, int64(-1), mock.TTL("session").GetInt64())
+	})
+
+	t.Run("Clock", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		clock := NewMockClock(time.Unix(1700000000, 0))
+		mock.SetClock(clock)
+		mock.EnableStatefulMode()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		messages, err := mock.Subscribe(ctx, "__keyevent@0__:expired", "__keyspace@0__:session")
+		assert.NoError(t, err)
+		<-messages
+		<-messages
+
+		mock.SetExpire("session", "data", 60)
+		mock.Set("token", "data")
+		mock.ExpireAt("token", clock.Now().Add(90*time.Second).Unix())
+		mock.Advance(59 * time.Second)
+		assert.Equal(t, int64(1), mock.TTL("session").GetInt64())
+		assert.Equal(t, int64(31), mock.TTL("token").GetInt64())
+
+		mock.Advance(time.Second)
+		assert.Equal(t, "expired", (<-messages).Payload)
+		assert.Equal(t, "session", (<-messages).Payload)
+		assert.True(t, mock.Get("session").RecordNotFound())
+		assert.Equal(t, "data", mock.Get("token").GetString())
+
+		clock.Advance(time.Minute)
+		assert.True(t, mock.Get("token").RecordNotFound())
+		assert.Equal(t, "token", (<-messages).Payload)
+
+		// a mock without clock stops one at the current time
+		mock = NewMockRedisOp()
+		mock.EnableStatefulMode()
+		mock.SetExpire("session", "data", 60)
+		mock.Advance(time.Hour)
+		assert.NotNil(t, mock.Clock())
+		assert.Equal(t, int64(-2), mock.TTL("session").GetInt64())
+
+		// outages follow the clock too
+		mock.EnableChaos(MockChaosConfig{Outages: []MockOutage{{Start: time.Minute, Duration: time.Minute}}})
+		mock.Advance(90 * time.Second)
+		assert.Equal(t, ErrMockOutage, mock.Get("session").Error)
+		mock.Advance(time.Minute)
+		assert.True(t, mock.Get("session").RecordNotFound())
+	})
+
+	t.Run("Hashes_Lists_Sets", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.EnableStatefulMode()
+
+		mock.HMSet("user:1", map[interface{}]interface{}{"name": "alice", "age": 30})
+		assert.Equal(t, "alice", mock.HGet("user:1", "name").GetString())
+		assert.Equal(t, int64(31), mock.HIncrBy("user:1", "age", 1).GetInt64())
+		assert.Len(t, mock.HGetAll("user:1").GetSlice(), 4)
+		assert.Equal(t, int64(1), mock.HDel("user:1", "name").GetInt64())
+		assert.Equal(t, int64(1), mock.HLen("user:1").GetInt64())
+
+		mock.RPush("queue", "a", "b", "c")
+		mock.LPush("queue", "z")
+		items := mock.LRange("queue", 0, -1).GetSlice()
+		assert.Len(t, items, 4)
+		assert.Equal(t, "z", items[0].GetString())
+		assert.Equal(t, "z", mock.LPop("queue").GetString())
+		assert.Len(t, mock.RPopN("queue", 5).GetSlice(), 3)
+		assert.Equal(t, int64(0), mock.Exists("queue").GetInt64())
+
+		assert.Equal(t, int64(2), mock.SAdd("tags", "go", "redis", "go").GetInt64())
+		assert.Equal(t, int64(1), mock.SIsMember("tags", "go").GetInt64())
+		assert.Equal(t, int64(2), mock.SCard("tags").GetInt64())
+		mock.SAdd("tags2", "redis", "mysql")
+		inter := mock.SInter("tags", "tags2").GetSlice()
+		assert.Len(t, inter, 1)
+		assert.Equal(t, "redis", inter[0].GetString())
+	})
+
+	t.Run("Sorted_Sets", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.EnableStatefulMode()
+
+		assert.Equal(t, int64(3), mock.ZAdd("board", 10, "alice", 20, "bob", 15, "carol").GetInt64())
+		assert.Equal(t, 20.0, mock.ZScore("board", "bob").GetFloat64())
+		assert.Equal(t, 20.0, mock.ZIncrBy("board", 5, "carol").GetFloat64())
+		assert.Equal(t, int64(0), mock.ZRank("board", "alice").GetInt64())
+		assert.Equal(t, int64(0), mock.ZRevRank("board", "carol").GetInt64())
+
+		// GT only raises scores and CH counts the update
+		assert.Equal(t, int64(1), mock.ZAddWithOptions("board", ZAddOptions{GT: true, CH: true}, 5, "alice", 30, "bob").GetInt64())
+
+		members := mock.ZRangeWithOptions("board", "+inf", "0", ZRangeOptions{ByScore: true, Rev: true, Count: 2, WithScores: true}).GetZMembers()
+		assert.Equal(t, []ZMember{{Member: "bob", Score: 30}, {Member: "carol", Score: 20}}, members)
+		assert.Len(t, mock.ZRange("board", 0, -1).GetSlice(), 3)
+	})
+
+	t.Run("Configured_Responses_Take_Precedence", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.EnableStatefulMode()
+		mock.SetResponse("GET", "key1", "configured", nil)
+
+		mock.Set("key1", "stored")
+		mock.Set("key2", "stored")
+		assert.Equal(t, "configured", mock.Get("key1").GetString())
+		assert.Equal(t, "stored", mock.Get("key2").GetString())
+		assert.Error(t, mock.Eval("return 1", nil, nil).Error)
+
+		// Reset drops stored keys but stays stateful
+		mock.Reset()
+		assert.True(t, mock.Get("key2").RecordNotFound())
+		assert.True(t, mock.IsStateful())
+	})
+
+	t.Run("Shared_Master_Slave", func(t *testing.T) {
+		redis := NewStatefulMockRedis()
+		redis.Master().Set("key1", "value1")
+		assert.Equal(t, "value1", redis.Slave().Get("key1").GetString())
+
+		keys := redis.Slave().Keys("key*").GetSlice()
+		assert.Len(t, keys, 1)
+	})
+
+	t.Run("Glob_Match", func(t *testing.T) {
+		assert.True(t, mockGlobMatch("user:*", "user:1"))
+		assert.True(t, mockGlobMatch("h?llo", "hello"))
+		assert.True(t, mockGlobMatch("h[ae]llo", "hallo"))
+		assert.False(t, mockGlobMatch("h[^e]llo", "hello"))
+		assert.True(t, mockGlobMatch("h[a-c]llo", "hbllo"))
+		assert.True(t, mockGlobMatch("a\\*b", "a*b"))
+		assert.False(t, mockGlobMatch("a\\*b", "axb"))
+	})
+}
+
+type mockRecordingT struct {
+	errors []string
+}
+
+func (r *mockRecordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMockRedisExpectations(t *testing.T) {
+	t.Run("Expectations_Met", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.ExpectCommand("SET", "key1", "value1").Return("OK", nil).Once()
+		mock.ExpectCommand("GET", "key1").Return("value1", nil).Times(2)
+		mock.ExpectCommand("INCRBY", "counter", MockAnyArg).Return(int64(5), nil)
+
+		assert.Equal(t, "OK", mock.Set("key1", "value1").GetString())
+		assert.Equal(t, "value1", mock.Get("key1").GetString())
+		assert.Equal(t, "value1", mock.Get("key1").GetString())
+		assert.Equal(t, int64(5), mock.IncrBy("counter", 5).GetInt64())
+		assert.Equal(t, int64(5), mock.IncrBy("counter", 7).GetInt64())
+
+		assert.True(t, mock.AssertExpectations(t))
+	})
+
+	t.Run("Unmet_And_Unexpected_Calls", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.ExpectCommand("GET", "key1").Return("value1", nil).Once()
+		mock.ExpectCommand("DEL")
+
+		assert.Equal(t, "value1", mock.Get("key1").GetString())
+		// Exhausted expectation falls back to configured responses and is reported
+		mock.SetResponse("GET", "key1", "fallback", nil)
+		assert.Equal(t, "fallback", mock.Get("key1").GetString())
+
+		recorder := &mockRecordingT{}
+		assert.False(t, mock.AssertExpectations(recorder))
+		assert.Len(t, recorder.errors, 2)
+		assert.Contains(t, recorder.errors[0], "DEL")
+		assert.Contains(t, recorder.errors[1], "unexpected call GET")
+	})
+
+	t.Run("Expectation_Without_Return", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.EnableStatefulMode()
+		mock.ExpectCommand("SET").Once()
+
+		assert.Equal(t, "OK", mock.Set("key1", "value1").GetString())
+		assert.True(t, mock.AssertExpectations(t))
+
+		mock.Reset()
+		recorder := &mockRecordingT{}
+		assert.True(t, mock.AssertExpectations(recorder))
+		assert.Empty(t, recorder.errors)
+	})
+}
+
+func TestMockRedisSequences(t *testing.T) {
+	t.Run("Concurrent_Calls_Take_Each_Response_Once", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		responses := make([]MockResponse, 100)
+		for i := range responses {
+			responses[i] = MockResponse{Data: int64(i)}
+		}
+
+		mock.SetSequentialResponses("INCR", "counter", responses)
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		seen := map[int64]bool{}
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				value := mock.Incr("counter").GetInt64()
+				mutex.Lock()
+				seen[value] = true
+				mutex.Unlock()
+			}()
+		}
+
+		wg.Wait()
+		assert.Len(t, seen, 100)
+		assert.Equal(t, int64(99), mock.Incr("counter").GetInt64())
+	})
+
+	t.Run("Strict_Order", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetSequentialResponses("GET", "key", []MockResponse{{Data: "a"}}, WithStrictOrder())
+		mock.SetSequentialResponses("SET", "key", []MockResponse{{Data: "OK"}}, WithStrictOrder())
+		mock.SetSequentialResponses("GET", "key", []MockResponse{{Data: "b"}}, WithStrictOrder())
+		mock.SetSequentialResponses("GET", "other", []MockResponse{{Data: "free"}})
+
+		assert.Equal(t, "a", mock.Get("key").GetString())
+		assert.ErrorIs(t, mock.Get("key").Error, ErrMockOutOfOrder)
+		assert.Equal(t, "free", mock.Get("other").GetString())
+		assert.Equal(t, "OK", mock.Set("key", "b").GetString())
+		assert.Equal(t, "b", mock.Get("key").GetString())
+		assert.ErrorIs(t, mock.Get("key").Error, ErrMockOutOfOrder)
+
+		recorder := &mockRecordingT{}
+		assert.False(t, mock.AssertExpectations(recorder))
+		assert.Len(t, recorder.errors, 2)
+		assert.Contains(t, recorder.errors[0], "GET [key], expected SET:key")
+		assert.Contains(t, recorder.errors[1], "GET [key], expected no further call")
+	})
+
+	t.Run("Strict_Order_Steps_Not_Called", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetSequentialResponses("GET", "key", []MockResponse{{Data: "a"}, {Data: "b"}}, WithStrictOrder())
+		assert.Equal(t, "a", mock.Get("key").GetString())
+
+		recorder := &mockRecordingT{}
+		assert.False(t, mock.AssertExpectations(recorder))
+		assert.Equal(t, []string{"mock: 1 steps of the configured order not called, next GET:key"}, recorder.errors)
+
+		assert.Equal(t, "b", mock.Get("key").GetString())
+		assert.True(t, mock.AssertExpectations(t))
+		mock.Reset()
+		assert.Nil(t, mock.Get("key").data)
+	})
+}
+
+func TestMockRedisPatternMatching(t *testing.T) {
+	t.Run("Glob_Key_Patterns", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("GET", "user:*:profile", "profile", nil)
+		mock.SetResponse("GET", "user:1?:*", "teen", nil)
+		mock.SetResponse("GET", "user:42:profile", "exact", nil)
+		mock.SetResponse("GET", "*", "any", nil)
+
+		assert.Equal(t, "exact", mock.Get("user:42:profile").GetString())
+		assert.Equal(t, "profile", mock.Get("user:7:profile").GetString())
+		// Longer pattern is more specific
+		assert.Equal(t, "profile", mock.Get("user:12:profile").GetString())
+		assert.Equal(t, "teen", mock.Get("user:12:settings").GetString())
+		assert.Equal(t, "any", mock.Get("order:1").GetString())
+	})
+
+	t.Run("Glob_Sequence_Patterns", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetSequentialResponses("INCR", "counter:[ab]", []MockResponse{
+			{Data: int64(1)},
+			{Data: int64(2)},
+		})
+
+		assert.Equal(t, int64(1), mock.Incr("counter:a").GetInt64())
+		assert.Equal(t, int64(2), mock.Incr("counter:b").GetInt64())
+		assert.Equal(t, int64(2), mock.Incr("counter:a").GetInt64())
+		assert.Nil(t, mock.Incr("counter:c").data)
+	})
+
+	t.Run("Argument_Matchers", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetPatternResponse("SCAN", []interface{}{MockAnyArg, "MATCH", MockGlob("session:*")}, []interface{}{"0", []interface{}{"session:1"}}, nil)
+		mock.SetPatternResponse("HGET", []interface{}{MockRegex(`^user:\d+$`), "name"}, "alice", nil)
+
+		response := mock.Scan(0, "session:*", 10)
+		assert.NoError(t, response.Error)
+		assert.Equal(t, "0", response.GetSlice()[0].GetString())
+		assert.Nil(t, mock.Scan(0, "user:*", 10).data)
+
+		assert.Equal(t, "alice", mock.HGet("user:42", "name").GetString())
+		assert.Nil(t, mock.HGet("user:abc", "name").data)
+		assert.Nil(t, mock.HGet("user:42", "email").data)
+	})
+
+	t.Run("Expectation_Matchers", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.ExpectCommand("SET", MockGlob("cache:*"), MockRegex(`^v\d$`)).Return("OK", nil).Times(2)
+
+		assert.Equal(t, "OK", mock.Set("cache:a", "v1").GetString())
+		assert.Equal(t, "OK", mock.Set("cache:b", "v2").GetString())
+		assert.True(t, mock.AssertExpectations(t))
+	})
+}
+
+func TestMockRedisChaos(t *testing.T) {
+	t.Run("Seeded_Failures_Are_Repeatable", func(t *testing.T) {
+		run := func() []bool {
+			mock := NewMockRedisOp()
+			mock.SetResponse("GET", "*", "value", nil)
+			mock.EnableChaos(MockChaosConfig{Seed: 42, ErrorRate: 0.3})
+			var results []bool
+			for i := 0; i < 50; i++ {
+				results = append(results, mock.Get("key").Error == ErrMockChaos)
+			}
+
+			return results
+		}
+
+		first := run()
+		assert.Equal(t, first, run())
+		assert.Contains(t, first, true)
+		assert.Contains(t, first, false)
+	})
+
+	t.Run("Outage_Window", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("GET", "*", "value", nil)
+		mock.EnableChaos(MockChaosConfig{Outages: []MockOutage{{Start: time.Minute, Duration: time.Minute}}})
+		now := time.Now()
+		mock.chaos.now = func() time.Time { return now }
+
+		assert.Equal(t, "value", mock.Get("key").GetString())
+		now = now.Add(90 * time.Second)
+		assert.Equal(t, ErrMockOutage, mock.Get("key").Error)
+		responses := mock.Pipeline(RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"key"}})
+		assert.Equal(t, ErrMockOutage, responses[0].Error)
+		now = now.Add(time.Minute)
+		assert.Equal(t, "value", mock.Get("key").GetString())
+
+		history := mock.GetCallsByCommand("GET")
+		assert.Equal(t, ErrMockOutage, history[1].Error)
+	})
+
+	t.Run("Latency_Distributions", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 100; i++ {
+			latency := MockUniformLatency(time.Millisecond, 2*time.Millisecond)(rng)
+			assert.True(t, latency >= time.Millisecond && latency <= 2*time.Millisecond)
+			assert.True(t, MockNormalLatency(time.Millisecond, 5*time.Millisecond)(rng) >= 0)
+			assert.True(t, MockExponentialLatency(time.Millisecond)(rng) >= 0)
+		}
+
+		mock := NewMockRedisOp()
+		mock.EnableChaos(MockChaosConfig{Latency: MockUniformLatency(5*time.Millisecond, 5*time.Millisecond)})
+		start := time.Now()
+		mock.Ping()
+		assert.True(t, time.Since(start) >= 5*time.Millisecond)
+
+		mock.Reset()
+		assert.Nil(t, mock.Get("key").Error)
+	})
+}
+
+func TestMockRedisScripts(t *testing.T) {
+	const script = "return redis.call('INCRBY', KEYS[1], ARGV[1])"
+	mock := NewMockRedisOp()
+	counters := map[string]int64{}
+	mock.SetScript(script, func(keys []string, args []string) (interface{}, error) {
+		by, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return nil, errors.New("ERR value is not an integer or out of range")
+		}
+
+		counters[keys[0]] += by
+		return counters[keys[0]], nil
+	})
+
+	assert.Equal(t, int64(2), mock.Eval(script, []interface{}{"counter"}, []interface{}{2}).GetInt64())
+	assert.Error(t, mock.Eval(script, []interface{}{"counter"}, []interface{}{"x"}).Error)
+
+	sha := mock.ScriptLoad(script).GetString()
+	assert.Equal(t, mockScriptSHA(script), sha)
+	assert.Equal(t, int64(5), mock.EvalSha(sha, []interface{}{"counter"}, []interface{}{3}).GetInt64())
+	assert.Equal(t, 2, len(mock.GetCallsByCommand("EVAL")))
+	assert.Equal(t, 1, len(mock.GetCallsByCommand("EVALSHA")))
+
+	// behaviors keyed by digest, unknown digests fail like the server
+	unknown := mockScriptSHA("return 1")
+	assert.ErrorIs(t, mock.EvalSha(unknown, nil, nil).Error, ErrMockNoScript)
+	mock.SetScript(strings.ToUpper(unknown), func(keys []string, args []string) (interface{}, error) {
+		return nil, nil
+	})
+	assert.ErrorIs(t, mock.EvalSha(unknown, nil, nil).Error, RedisNotFound)
+
+	// configured responses take precedence
+	mock.SetResponse("EVAL", "*", int64(42), nil)
+	assert.Equal(t, int64(42), mock.Eval(script, []interface{}{"counter"}, []interface{}{1}).GetInt64())
+
+	mock.Reset()
+	assert.ErrorIs(t, mock.EvalSha(sha, nil, nil).Error, ErrMockNoScript)
+}
+
+func TestMockRedisCallHistoryTagging(t *testing.T) {
+	t.Run("Goroutine_And_Caller", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.Set("key1", "value1")
+
+		var wg sync.WaitGroup
+		var workerID uint64
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workerID = MockGoroutineID()
+			mock.Get("key1")
+			mock.Pipeline(RedisPipelineCmd{Cmd: "GET", Args: []interface{}{"key1"}})
+		}()
+		wg.Wait()
+
+		own := mock.GetCallsByGoroutine(MockGoroutineID())
+		assert.Len(t, own, 1)
+		assert.Equal(t, "SET", own[0].Command)
+		assert.Contains(t, own[0].Caller, "redis_test.go:")
+		assert.Empty(t, own[0].Stack)
+
+		worker := mock.GetCallsByGoroutine(workerID)
+		assert.Len(t, worker, 2)
+		assert.NotEqual(t, MockGoroutineID(), workerID)
+		assert.Contains(t, worker[1].Caller, "redis_test.go:")
+
+		mock.SetRecordStacks(true)
+		mock.Get("key1")
+		assert.Contains(t, mock.GetLastCall().Stack, "TestMockRedisCallHistoryTagging")
+	})
+
+	t.Run("Time_Range_And_Argument_Filters", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.Set("user:1", "a")
+		mock.Set("session:1", "b")
+		mid := time.Now()
+		time.Sleep(time.Millisecond)
+		mock.Set("user:2", "c")
+
+		assert.Len(t, mock.GetCallsMatching("SET", MockGlob("user:*")), 2)
+		assert.Len(t, mock.GetCallsMatching("SET", MockAnyArg, MockRegex("^[bc]$")), 2)
+		assert.Len(t, mock.GetCallsMatching("SET"), 3)
+
+		assert.Len(t, mock.GetCallsBetween(mid, time.Now().Add(time.Second)), 1)
+		assert.Len(t, mock.GetCallsBetween(time.Time{}, mid), 2)
+	})
+
+	t.Run("Ring_Buffer_Limit", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		for i := 0; i < 10; i++ {
+			mock.Incr(fmt.Sprintf("key%d", i))
+		}
+
+		mock.SetCallHistoryLimit(5)
+		history := mock.GetCallHistory()
+		assert.Len(t, history, 5)
+		assert.Equal(t, "key5", history[0].Args[0])
+
+		for i := 10; i < 1000; i++ {
+			mock.Incr(fmt.Sprintf("key%d", i))
+		}
+
+		history = mock.GetCallHistory()
+		assert.Len(t, history, 5)
+		assert.Equal(t, "key995", history[0].Args[0])
+		assert.Equal(t, "key999", history[4].Args[0])
+	})
 }
 
 // Benchmark tests comparing Real Redis vs Mock Redis performance
 func BenchmarkRedisOperations(b *testing.B) {
 	// Setup real Redis for benchmarking
-	wd, _ := os.Getwd()
-	secret.PATH = filepath.Join(wd, "example")
-
-	realRedis := NewRedis("test")
-	if realRedis == nil {
-		b.Skip("Skipping benchmark - Redis not available")
-		return
-	}
+	realRedis := testRedis(b)
 
 	// Setup Mock Redis
 	mockRedis := NewMockRedis()
@@ -3768,6 +5185,60 @@ func BenchmarkRedisOperations(b *testing.B) {
 	})
 }
 
+// BenchmarkRedisFastPath reports the allocations of small string GET/SET round trips and of the reply accessors.
+func BenchmarkRedisFastPath(b *testing.B) {
+	r := testRedis(b)
+	defer r.Master().Delete("bench_fast_path")
+	op := r.Master()
+
+	b.Run("Set", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			op.Set("bench_fast_path", "benchmark_value")
+		}
+	})
+
+	b.Run("Get", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			op.Get("bench_fast_path").GetString()
+		}
+	})
+
+	b.Run("Get_Release", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			resp := op.Get("bench_fast_path")
+			resp.GetString()
+			resp.Release()
+		}
+	})
+
+	b.Run("GetString_Int64", func(b *testing.B) {
+		b.ReportAllocs()
+		resp := RedisResponseEntity{data: int64(123456)}
+		for i := 0; i < b.N; i++ {
+			resp.GetString()
+		}
+	})
+
+	b.Run("GetString_String", func(b *testing.B) {
+		b.ReportAllocs()
+		resp := RedisResponseEntity{data: "benchmark_value"}
+		for i := 0; i < b.N; i++ {
+			resp.GetString()
+		}
+	})
+
+	b.Run("GetString_Bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		resp := RedisResponseEntity{data: []byte("benchmark_value")}
+		for i := 0; i < b.N; i++ {
+			resp.GetString()
+		}
+	})
+}
+
 func TestLoadRedisProfileLegacyAndCluster(t *testing.T) {
 	originalPath := secret.Path()
 	defer func() {
@@ -3852,6 +5323,64 @@ func TestLoadRedisProfileLegacyAndCluster(t *testing.T) {
 		assert.Equal(t, []string{"127.0.0.1:6379"}, profile.MasterAddrs())
 		assert.Equal(t, []string{"127.0.0.1:6380"}, profile.SlaveAddrs())
 	})
+
+	t.Run("unix_socket_profile", func(t *testing.T) {
+		// unix socket paths are limited to about 100 bytes, t.TempDir() may be longer
+		socketDir, err := os.MkdirTemp("", "redis")
+		assert.NoError(t, err)
+		defer os.RemoveAll(socketDir)
+
+		socket := filepath.Join(socketDir, "redis.sock")
+		listener, err := net.Listen("unix", socket)
+		assert.NoError(t, err)
+		defer listener.Close()
+
+		// forward the socket to the test server
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				go func() {
+					defer conn.Close()
+					server, err := net.Dial("tcp", "127.0.0.1:6379")
+					if err != nil {
+						return
+					}
+
+					defer server.Close()
+					go io.Copy(server, conn)
+					io.Copy(conn, server)
+				}()
+			}
+		}()
+
+		tempDir := t.TempDir()
+		secretDir := filepath.Join(tempDir, "redis-socket")
+		assert.NoError(t, os.MkdirAll(secretDir, 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(secretDir, "secret.json"), []byte(fmt.Sprintf(`{
+  "master": {
+    "socket": %q
+  }
+}`, socket)), 0o644))
+		secret.PATH = tempDir
+
+		profile, err := secret.LoadRedisProfile("socket")
+		assert.NoError(t, err)
+		assert.Equal(t, redisModeSingle, profile.Mode)
+		assert.Equal(t, []string{socket}, profile.MasterAddrs())
+		assert.Equal(t, []string{socket}, profile.SlaveAddrs())
+
+		redis := NewRedis("socket")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+		assert.Equal(t, secret.RedisMeta{Socket: socket}, redis.Master().Meta())
+		defer redis.Master().Delete("test_unix_socket")
+		assert.NoError(t, redis.Master().Set("test_unix_socket", "value").Error)
+		assert.Equal(t, "value", redis.Slave().Get("test_unix_socket").GetString())
+	})
 }
 
 func TestNewRedisSupportsSingleAndClusterProfiles(t *testing.T) {
@@ -4005,3 +5534,23 @@ func TestRedisClusterIntegration(t *testing.T) {
 	}
 	assert.Equal(t, "v1", pipeResp[1].GetString())
 }
+
+// testRedis returns a Redis of the server of testserver, closed when t ends. t is skipped when there is none.
+func testRedis(t testing.TB) *Redis {
+	t.Helper()
+	profile := testserver.RedisProfile(t)
+	var r *Redis
+	testserver.WithProfile(t, "redis", profile, func(name string) {
+		r = NewRedis(name)
+	})
+
+	if r == nil {
+		t.Fatalf("create redis of %s", profile.Master.Addr())
+	}
+
+	t.Cleanup(func() {
+		r.Close()
+	})
+
+	return r
+}
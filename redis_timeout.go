@@ -0,0 +1,88 @@
+package datastore
+
+import (
+	"strings"
+	"time"
+
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+// DefaultRedisReadTimeout bounds the wait for the reply of a command, unless the command has a timeout of its own
+// in DefaultRedisCommandTimeouts, in the command_timeouts of the profile or given to DoWithTimeout.
+var DefaultRedisReadTimeout = 3 * time.Second
+
+// DefaultRedisWriteTimeout bounds the write of a command to its connection.
+var DefaultRedisWriteTimeout = 3 * time.Second
+
+// DefaultRedisCommandTimeouts are the read timeouts of commands by name, e.g. a longer one for EVAL and a shorter
+// one for GET. The command_timeouts of a profile, in milliseconds, are added to them.
+var DefaultRedisCommandTimeouts = map[string]time.Duration{}
+
+func init() {
+	envMillis("GOTH_DEFAULT_REDIS_READ_TIMEOUT", &DefaultRedisReadTimeout)
+	envMillis("GOTH_DEFAULT_REDIS_WRITE_TIMEOUT", &DefaultRedisWriteTimeout)
+}
+
+// redisTimeouts are the read and write timeouts of an operator. The client reads with the longest of the read
+// timeouts, the commands with a shorter one are bounded by a context deadline since go-redis reads until the
+// earliest of the two.
+type redisTimeouts struct {
+	read     time.Duration
+	write    time.Duration
+	longest  time.Duration
+	commands map[string]time.Duration
+}
+
+func newRedisTimeouts(profile *secret.RedisProfile) *redisTimeouts {
+	timeouts := &redisTimeouts{
+		read:     DefaultRedisReadTimeout,
+		write:    DefaultRedisWriteTimeout,
+		commands: map[string]time.Duration{},
+	}
+
+	if profile.ReadTimeout > 0 {
+		timeouts.read = time.Duration(profile.ReadTimeout) * time.Millisecond
+	}
+
+	if profile.WriteTimeout > 0 {
+		timeouts.write = time.Duration(profile.WriteTimeout) * time.Millisecond
+	}
+
+	for cmd, timeout := range DefaultRedisCommandTimeouts {
+		timeouts.commands[strings.ToUpper(cmd)] = timeout
+	}
+
+	for cmd, timeout := range profile.CommandTimeouts {
+		timeouts.commands[strings.ToUpper(cmd)] = time.Duration(timeout) * time.Millisecond
+	}
+
+	timeouts.longest = timeouts.read
+	for cmd, timeout := range timeouts.commands {
+		if timeout <= 0 {
+			delete(timeouts.commands, cmd)
+		} else if timeout > timeouts.longest {
+			timeouts.longest = timeout
+		}
+	}
+
+	return timeouts
+}
+
+// command returns the deadline to bound cmd with, 0 when the read timeout of the client applies. Blocking commands
+// wait as long as they ask to unless a timeout is set for them.
+func (t *redisTimeouts) command(cmd string) time.Duration {
+	if t == nil || (len(t.commands) == 0 && t.longest == t.read) {
+		return 0
+	}
+
+	cmd = strings.ToUpper(cmd)
+	if timeout, ok := t.commands[cmd]; ok {
+		return timeout
+	}
+
+	if t.longest > t.read && !redisBlockingCommands[cmd] {
+		return t.read
+	}
+
+	return 0
+}
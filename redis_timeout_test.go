@@ -0,0 +1,77 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisTimeouts(t *testing.T) {
+	t.Run("Command", func(t *testing.T) {
+		defer func(read, write time.Duration, commands map[string]time.Duration) {
+			DefaultRedisReadTimeout, DefaultRedisWriteTimeout, DefaultRedisCommandTimeouts = read, write, commands
+		}(DefaultRedisReadTimeout, DefaultRedisWriteTimeout, DefaultRedisCommandTimeouts)
+
+		DefaultRedisReadTimeout, DefaultRedisWriteTimeout = time.Second, 2*time.Second
+		DefaultRedisCommandTimeouts = map[string]time.Duration{}
+		timeouts := newRedisTimeouts(&secret.RedisProfile{})
+		assert.Equal(t, time.Second, timeouts.longest)
+		assert.Equal(t, 2*time.Second, timeouts.write)
+		assert.Equal(t, time.Duration(0), timeouts.command("GET"))
+
+		DefaultRedisCommandTimeouts = map[string]time.Duration{"eval": 10 * time.Second, "GET": time.Minute}
+		timeouts = newRedisTimeouts(&secret.RedisProfile{
+			ReadTimeout:     500,
+			CommandTimeouts: map[string]int{"get": 200, "ping": 0},
+		})
+		assert.Equal(t, 10*time.Second, timeouts.longest)
+		assert.Equal(t, 10*time.Second, timeouts.command("EVAL"))
+		assert.Equal(t, 200*time.Millisecond, timeouts.command("get"))
+		assert.Equal(t, 500*time.Millisecond, timeouts.command("PING"))
+		assert.Equal(t, 500*time.Millisecond, timeouts.command("SET"))
+		assert.Equal(t, time.Duration(0), timeouts.command("BLPOP"))
+
+		var none *redisTimeouts
+		assert.Equal(t, time.Duration(0), none.command("GET"))
+	})
+
+	t.Run("Mock", func(t *testing.T) {
+		mock := NewMockRedisOp()
+		mock.SetResponse("GET", "key", "value", nil)
+		assert.Equal(t, "value", mock.DoWithTimeout(time.Millisecond, "GET", "key").GetString())
+		assert.Len(t, mock.GetCallsByCommand("GET"), 1)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		profile, err := secret.LoadRedisProfile("test")
+		assert.NoError(t, err)
+		profile.CommandTimeouts = map[string]int{"BLPOP": 50}
+		redis := NewRedisWithProfile("test", profile)
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		op := redis.Master()
+		defer op.Delete("test_timeout")
+		start := time.Now()
+		assert.ErrorIs(t, op.Do("BLPOP", "test_timeout", 2).Error, ErrTimeout)
+		assert.Less(t, time.Since(start), time.Second)
+
+		start = time.Now()
+		assert.ErrorIs(t, op.DoWithTimeout(50*time.Millisecond, "BLPOP", "test_timeout", 2).Error, ErrTimeout)
+		assert.Less(t, time.Since(start), time.Second)
+
+		assert.NoError(t, op.DoWithTimeout(time.Second, "SET", "test_timeout", "value").Error)
+		assert.Equal(t, "value", op.Get("test_timeout").GetString())
+	})
+}
@@ -0,0 +1,282 @@
+package datastore
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// Duplicate policies of TSOptions, how samples with an existing timestamp are handled.
+const (
+	TSDuplicateBlock = "BLOCK"
+	TSDuplicateFirst = "FIRST"
+	TSDuplicateLast  = "LAST"
+	TSDuplicateMin   = "MIN"
+	TSDuplicateMax   = "MAX"
+	TSDuplicateSum   = "SUM"
+)
+
+// RedisTimeSeries runs the TS.* commands of RedisTimeSeries, see NewRedisTimeSeries.
+// Commands fail with ErrRedisModuleNotLoaded when the server does not provide RedisTimeSeries.
+// Replies are parsed from RESP2 and RESP3, whatever DefaultRedisProtocol is.
+type RedisTimeSeries struct {
+	op     RedisOperator
+	module redisModule
+}
+
+// NewRedisTimeSeries returns the RedisTimeSeries helpers of op.
+func NewRedisTimeSeries(op RedisOperator) *RedisTimeSeries {
+	return &RedisTimeSeries{op: op, module: redisModule{name: "timeseries", command: "TS.ADD"}}
+}
+
+// Available returns ErrRedisModuleNotLoaded when the server does not provide RedisTimeSeries.
+func (s *RedisTimeSeries) Available() error {
+	return s.module.check(s.op)
+}
+
+// TSOptions configures the series created by RedisTimeSeries.Create, and by Add for missing series.
+// Zero values use the server defaults.
+type TSOptions struct {
+	// Retention is how long samples are kept relative to the newest one
+	Retention time.Duration
+	// Labels are the name value pairs MRange filters series on
+	Labels map[string]string
+	// DuplicatePolicy is TSDuplicateBlock, TSDuplicateLast or another TSDuplicate policy
+	DuplicatePolicy string
+	// ChunkSize is the memory size in bytes of the sample chunks
+	ChunkSize int64
+	// Uncompressed stores the samples without compression
+	Uncompressed bool
+}
+
+func (o TSOptions) args(duplicate string) []interface{} {
+	var args []interface{}
+	if o.Retention > 0 {
+		args = append(args, "RETENTION", o.Retention.Milliseconds())
+	}
+
+	if o.Uncompressed {
+		args = append(args, "ENCODING", "UNCOMPRESSED")
+	}
+
+	if o.ChunkSize > 0 {
+		args = append(args, "CHUNK_SIZE", o.ChunkSize)
+	}
+
+	if o.DuplicatePolicy != "" {
+		args = append(args, duplicate, o.DuplicatePolicy)
+	}
+
+	if len(o.Labels) > 0 {
+		names := make([]string, 0, len(o.Labels))
+		for name := range o.Labels {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		args = append(args, "LABELS")
+		for _, name := range names {
+			args = append(args, name, o.Labels[name])
+		}
+	}
+
+	return args
+}
+
+// TSSample is a sample of a series.
+type TSSample struct {
+	Timestamp time.Time
+	Value     float64
+}
+
+// TSSeries is a series returned by RedisTimeSeries.MRange.
+type TSSeries struct {
+	Key string
+	// Labels of the series, set with TSRangeOptions.WithLabels
+	Labels  map[string]string
+	Samples []TSSample
+}
+
+// TSRangeOptions configures RedisTimeSeries.Range and MRange.
+type TSRangeOptions struct {
+	// Count limits the number of samples per series
+	Count int64
+	// Aggregation aggregates the samples per BucketDuration, e.g. "avg", "sum", "max" or "count"
+	Aggregation    string
+	BucketDuration time.Duration
+	// Reverse returns the newest samples first
+	Reverse bool
+	// WithLabels returns the labels of the series of MRange
+	WithLabels bool
+}
+
+func (o TSRangeOptions) args() []interface{} {
+	var args []interface{}
+	if o.Count > 0 {
+		args = append(args, "COUNT", o.Count)
+	}
+
+	if o.Aggregation != "" {
+		args = append(args, "AGGREGATION", o.Aggregation, max(o.BucketDuration.Milliseconds(), 1))
+	}
+
+	return args
+}
+
+// Create creates the series key, it fails when key exists.
+func (s *RedisTimeSeries) Create(key string, opts TSOptions) error {
+	return s.do("TS.CREATE", append([]interface{}{key}, opts.args("DUPLICATE_POLICY")...)...).Error
+}
+
+// Add adds a sample of value at timestamp to key, the server time when timestamp is zero, and returns its timestamp.
+// A missing series is created with opts, which DuplicatePolicy also overrides for this sample.
+func (s *RedisTimeSeries) Add(key string, timestamp time.Time, value float64, opts TSOptions) (time.Time, error) {
+	resp := s.do("TS.ADD", append([]interface{}{key, tsTimestamp(timestamp, "*"), value}, opts.args("ON_DUPLICATE")...)...)
+	if resp.Error != nil {
+		return time.Time{}, resp.Error
+	}
+
+	return time.UnixMilli(resp.GetInt64()), nil
+}
+
+// Get returns the newest sample of key, RedisNotFound when the series is empty.
+func (s *RedisTimeSeries) Get(key string) (TSSample, error) {
+	resp := s.do("TS.GET", key)
+	if resp.Error != nil {
+		return TSSample{}, resp.Error
+	}
+
+	sample, ok := tsSample(resp.RedisResponseEntity)
+	if !ok {
+		return TSSample{}, RedisNotFound
+	}
+
+	return sample, nil
+}
+
+// Range returns the samples of key from from to to inclusive, zero times are the oldest and the newest sample.
+func (s *RedisTimeSeries) Range(key string, from, to time.Time, opts TSRangeOptions) ([]TSSample, error) {
+	cmd := "TS.RANGE"
+	if opts.Reverse {
+		cmd = "TS.REVRANGE"
+	}
+
+	args := append([]interface{}{key, tsTimestamp(from, "-"), tsTimestamp(to, "+")}, opts.args()...)
+	resp := s.do(cmd, args...)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	return tsSamples(resp.RedisResponseEntity), nil
+}
+
+// MRange returns the samples of the series matching filters, e.g. "host=web1" or "region=(eu,us)", from from to to.
+// Series are sorted by key.
+func (s *RedisTimeSeries) MRange(from, to time.Time, filters []string, opts TSRangeOptions) ([]TSSeries, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("timeseries mrange needs a filter")
+	}
+
+	cmd := "TS.MRANGE"
+	if opts.Reverse {
+		cmd = "TS.MREVRANGE"
+	}
+
+	args := append([]interface{}{tsTimestamp(from, "-"), tsTimestamp(to, "+")}, opts.args()...)
+	if opts.WithLabels {
+		args = append(args, "WITHLABELS")
+	}
+
+	args = append(args, "FILTER")
+	for _, filter := range filters {
+		args = append(args, filter)
+	}
+
+	resp := s.do(cmd, args...)
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	var series []TSSeries
+	if reply, ok := resp.data.(map[interface{}]interface{}); ok {
+		// RESP3 maps each key to its labels, optional metadata and samples
+		for key, value := range reply {
+			parts := (&RedisResponseEntity{data: value}).GetSlice()
+			if len(parts) < 2 {
+				continue
+			}
+
+			series = append(series, TSSeries{
+				Key:     (&RedisResponseEntity{data: key}).GetString(),
+				Labels:  tsLabels(parts[0]),
+				Samples: tsSamples(parts[len(parts)-1]),
+			})
+		}
+	} else {
+		for _, entry := range resp.GetSlice() {
+			parts := entry.GetSlice()
+			if len(parts) < 3 {
+				continue
+			}
+
+			series = append(series, TSSeries{Key: parts[0].GetString(), Labels: tsLabels(parts[1]), Samples: tsSamples(parts[2])})
+		}
+	}
+
+	sort.Slice(series, func(i, j int) bool { return series[i].Key < series[j].Key })
+	return series, nil
+}
+
+func (s *RedisTimeSeries) do(cmd string, args ...interface{}) *RedisResponse {
+	if err := s.module.check(s.op); err != nil {
+		return &RedisResponse{Error: err}
+	}
+
+	return s.op.Do(cmd, args...)
+}
+
+func tsTimestamp(t time.Time, zero string) interface{} {
+	if t.IsZero() {
+		return zero
+	}
+
+	return t.UnixMilli()
+}
+
+// tsSample converts a [timestamp, value] pair, the value is a string in RESP2 and a double in RESP3.
+func tsSample(entity RedisResponseEntity) (TSSample, bool) {
+	pair := entity.GetSlice()
+	if len(pair) != 2 {
+		return TSSample{}, false
+	}
+
+	return TSSample{Timestamp: time.UnixMilli(pair[0].GetInt64()), Value: pair[1].GetFloat64()}, true
+}
+
+func tsSamples(entity RedisResponseEntity) []TSSample {
+	entries := entity.GetSlice()
+	samples := make([]TSSample, 0, len(entries))
+	for _, entry := range entries {
+		if sample, ok := tsSample(entry); ok {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples
+}
+
+// tsLabels converts the labels of a series, a map in RESP3 and an array of [name, value] pairs in RESP2.
+func tsLabels(entity RedisResponseEntity) map[string]string {
+	if _, ok := entity.data.(map[interface{}]interface{}); ok {
+		return redisStringMap(entity.data)
+	}
+
+	labels := map[string]string{}
+	for _, entry := range entity.GetSlice() {
+		if pair := entry.GetSlice(); len(pair) == 2 {
+			labels[pair[0].GetString()] = pair[1].GetString()
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,127 @@
+package datastore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRedisTimeSeries(t *testing.T) {
+	newSeries := func() (*MockRedisOp, *RedisTimeSeries) {
+		op := NewMockRedisOp()
+		op.SetResponse("COMMAND", "INFO", []interface{}{[]interface{}{"ts.add"}}, nil)
+		return op, NewRedisTimeSeries(op)
+	}
+
+	t.Run("Create and add", func(t *testing.T) {
+		op, series := newSeries()
+		opts := TSOptions{
+			Retention:       time.Hour,
+			Labels:          map[string]string{"region": "eu", "host": "web1"},
+			DuplicatePolicy: TSDuplicateLast,
+			ChunkSize:       4096,
+			Uncompressed:    true,
+		}
+
+		assert.NoError(t, series.Create("cpu:web1", opts))
+		assert.Equal(t, []interface{}{"cpu:web1", "RETENTION", int64(3600000), "ENCODING", "UNCOMPRESSED", "CHUNK_SIZE", int64(4096),
+			"DUPLICATE_POLICY", "LAST", "LABELS", "host", "web1", "region", "eu"}, op.GetCallsByCommand("TS.CREATE")[0].Args)
+
+		op.SetResponse("TS.ADD", "cpu:web1", int64(1700000000000), nil)
+		timestamp, err := series.Add("cpu:web1", time.Time{}, 0.5, TSOptions{DuplicatePolicy: TSDuplicateMax})
+		assert.NoError(t, err)
+		assert.Equal(t, time.UnixMilli(1700000000000), timestamp)
+		assert.Equal(t, []interface{}{"cpu:web1", "*", 0.5, "ON_DUPLICATE", "MAX"}, op.GetCallsByCommand("TS.ADD")[0].Args)
+
+		series.Add("cpu:web1", time.UnixMilli(42), 1, TSOptions{})
+		assert.Equal(t, []interface{}{"cpu:web1", int64(42), 1.0}, op.GetCallsByCommand("TS.ADD")[1].Args)
+	})
+
+	t.Run("Get and range", func(t *testing.T) {
+		op, series := newSeries()
+		op.SetResponse("TS.GET", "cpu:web1", []interface{}{int64(2000), "0.75"}, nil)
+		op.SetResponse("TS.GET", "cpu:empty", []interface{}{}, nil)
+		op.SetResponse("TS.RANGE", "cpu:web1", []interface{}{
+			[]interface{}{int64(1000), "0.5"},
+			[]interface{}{int64(2000), 0.75},
+		}, nil)
+
+		sample, err := series.Get("cpu:web1")
+		assert.NoError(t, err)
+		assert.Equal(t, TSSample{Timestamp: time.UnixMilli(2000), Value: 0.75}, sample)
+		_, err = series.Get("cpu:empty")
+		assert.ErrorIs(t, err, RedisNotFound)
+
+		samples, err := series.Range("cpu:web1", time.Time{}, time.UnixMilli(5000),
+			TSRangeOptions{Count: 10, Aggregation: "avg", BucketDuration: time.Second})
+		assert.NoError(t, err)
+		assert.Equal(t, []TSSample{{time.UnixMilli(1000), 0.5}, {time.UnixMilli(2000), 0.75}}, samples)
+		assert.Equal(t, []interface{}{"cpu:web1", "-", int64(5000), "COUNT", int64(10), "AGGREGATION", "avg", int64(1000)},
+			op.GetCallsByCommand("TS.RANGE")[0].Args)
+
+		series.Range("cpu:web1", time.UnixMilli(1), time.Time{}, TSRangeOptions{Reverse: true})
+		assert.Equal(t, []interface{}{"cpu:web1", int64(1), "+"}, op.GetCallsByCommand("TS.REVRANGE")[0].Args)
+	})
+
+	t.Run("MRange", func(t *testing.T) {
+		op, series := newSeries()
+		_, err := series.MRange(time.Time{}, time.Time{}, nil, TSRangeOptions{})
+		assert.Error(t, err)
+
+		expected := []TSSeries{
+			{Key: "cpu:web1", Labels: map[string]string{"region": "eu"}, Samples: []TSSample{{time.UnixMilli(1000), 0.5}}},
+			{Key: "cpu:web2", Labels: map[string]string{"region": "eu"}, Samples: []TSSample{{time.UnixMilli(1000), 0.25}}},
+		}
+
+		op.SetResponse("TS.MRANGE", "-", []interface{}{
+			[]interface{}{"cpu:web2", []interface{}{[]interface{}{"region", "eu"}}, []interface{}{[]interface{}{int64(1000), "0.25"}}},
+			[]interface{}{"cpu:web1", []interface{}{[]interface{}{"region", "eu"}}, []interface{}{[]interface{}{int64(1000), "0.5"}}},
+		}, nil)
+		result, err := series.MRange(time.Time{}, time.Time{}, []string{"region=eu"}, TSRangeOptions{WithLabels: true})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result)
+		assert.Equal(t, []interface{}{"-", "+", "WITHLABELS", "FILTER", "region=eu"}, op.GetCallsByCommand("TS.MRANGE")[0].Args)
+
+		op.SetResponse("TS.MRANGE", "-", map[interface{}]interface{}{
+			"cpu:web1": []interface{}{map[interface{}]interface{}{"region": "eu"}, []interface{}{[]interface{}{int64(1000), 0.5}}},
+			"cpu:web2": []interface{}{map[interface{}]interface{}{"region": "eu"}, map[interface{}]interface{}{},
+				[]interface{}{[]interface{}{int64(1000), 0.25}}},
+		}, nil)
+		result, err = series.MRange(time.Time{}, time.Time{}, []string{"region=eu"}, TSRangeOptions{WithLabels: true})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+
+		series := NewRedisTimeSeries(redis.Master())
+		if err := series.Available(); err != nil {
+			assert.ErrorIs(t, err, ErrRedisModuleNotLoaded)
+			_, err = series.Add("test_ts", time.Time{}, 1, TSOptions{})
+			assert.ErrorIs(t, err, ErrRedisModuleNotLoaded)
+			return
+		}
+
+		redis.Master().Delete("test_ts")
+		defer redis.Master().Delete("test_ts")
+		_, err := series.Add("test_ts", time.UnixMilli(1000), 1.5, TSOptions{Labels: map[string]string{"test": "goth"}})
+		assert.NoError(t, err)
+		samples, err := series.Range("test_ts", time.Time{}, time.Time{}, TSRangeOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, []TSSample{{time.UnixMilli(1000), 1.5}}, samples)
+	})
+}
@@ -0,0 +1,129 @@
+package datastore
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Backoff strategies for RetryPolicy.
+const (
+	RetryBackoffConstant    = "constant"
+	RetryBackoffLinear      = "linear"
+	RetryBackoffExponential = "exponential"
+	// RetryBackoffExponentialJitter draws each delay uniformly from [delay/2, delay] of the exponential backoff
+	RetryBackoffExponentialJitter = "exponential_jitter"
+)
+
+// RetryPolicy describes how a failed operation is retried, shared by the database, Redis and Cassandra operators.
+type RetryPolicy struct {
+	// Attempts is the total number of tries including the first one, values below 1 mean a single try
+	Attempts int
+	// Backoff is one of the RetryBackoff* strategies, constant when empty
+	Backoff string
+	// Interval is the delay before the first retry, the base of linear and exponential backoff
+	Interval time.Duration
+	// MaxInterval caps a single delay, 0 means no cap
+	MaxInterval time.Duration
+	// MaxElapsedTime stops retrying once exceeded since the first try, 0 means no limit
+	MaxElapsedTime time.Duration
+}
+
+// DefaultDatabaseRetryPolicy is used to open database pools.
+var DefaultDatabaseRetryPolicy = RetryPolicy{
+	Attempts: 5,
+	Backoff:  RetryBackoffConstant,
+	Interval: time.Second,
+}
+
+// DefaultDatabaseTransactionRetryPolicy retries the transactions of Database.WithTransaction aborted by a deadlock,
+// lock wait timeout or serialization failure.
+var DefaultDatabaseTransactionRetryPolicy = RetryPolicy{
+	Attempts: 4,
+	Backoff:  RetryBackoffExponentialJitter,
+	Interval: 20 * time.Millisecond,
+}
+
+// DefaultRedisRetryPolicy sets the go-redis command retries, zero fields keep the go-redis defaults.
+// go-redis always backs off exponentially with jitter between Interval and MaxInterval, Backoff and
+// MaxElapsedTime are not used.
+var DefaultRedisRetryPolicy = RetryPolicy{}
+
+// DefaultCassandraRetryPolicy sets the delay between Cassandra query retries, and their number when
+// CassandraOp.MaxRetryAttempt is not set.
+var DefaultCassandraRetryPolicy = RetryPolicy{
+	Backoff:  RetryBackoffConstant,
+	Interval: 100 * time.Millisecond,
+}
+
+func init() {
+	envInt("GOTH_DEFAULT_DATABASE_RETRY_ATTEMPTS", &DefaultDatabaseRetryPolicy.Attempts)
+	envStr("GOTH_DEFAULT_DATABASE_RETRY_BACKOFF", &DefaultDatabaseRetryPolicy.Backoff)
+	envMillis("GOTH_DEFAULT_DATABASE_RETRY_INTERVAL", &DefaultDatabaseRetryPolicy.Interval)
+	envMillis("GOTH_DEFAULT_DATABASE_RETRY_MAX_INTERVAL", &DefaultDatabaseRetryPolicy.MaxInterval)
+	envMillis("GOTH_DEFAULT_DATABASE_RETRY_MAX_ELAPSED_TIME", &DefaultDatabaseRetryPolicy.MaxElapsedTime)
+	envInt("GOTH_DEFAULT_DATABASE_TRANSACTION_RETRY_ATTEMPTS", &DefaultDatabaseTransactionRetryPolicy.Attempts)
+	envStr("GOTH_DEFAULT_DATABASE_TRANSACTION_RETRY_BACKOFF", &DefaultDatabaseTransactionRetryPolicy.Backoff)
+	envMillis("GOTH_DEFAULT_DATABASE_TRANSACTION_RETRY_INTERVAL", &DefaultDatabaseTransactionRetryPolicy.Interval)
+	envMillis("GOTH_DEFAULT_DATABASE_TRANSACTION_RETRY_MAX_INTERVAL", &DefaultDatabaseTransactionRetryPolicy.MaxInterval)
+	envMillis("GOTH_DEFAULT_DATABASE_TRANSACTION_RETRY_MAX_ELAPSED_TIME", &DefaultDatabaseTransactionRetryPolicy.MaxElapsedTime)
+	envInt("GOTH_DEFAULT_REDIS_RETRY_ATTEMPTS", &DefaultRedisRetryPolicy.Attempts)
+	envMillis("GOTH_DEFAULT_REDIS_RETRY_INTERVAL", &DefaultRedisRetryPolicy.Interval)
+	envMillis("GOTH_DEFAULT_REDIS_RETRY_MAX_INTERVAL", &DefaultRedisRetryPolicy.MaxInterval)
+	envInt("GOTH_DEFAULT_CASSANDRA_RETRY_ATTEMPTS", &DefaultCassandraRetryPolicy.Attempts)
+	envStr("GOTH_DEFAULT_CASSANDRA_RETRY_BACKOFF", &DefaultCassandraRetryPolicy.Backoff)
+	envMillis("GOTH_DEFAULT_CASSANDRA_RETRY_INTERVAL", &DefaultCassandraRetryPolicy.Interval)
+	envMillis("GOTH_DEFAULT_CASSANDRA_RETRY_MAX_INTERVAL", &DefaultCassandraRetryPolicy.MaxInterval)
+}
+
+// Delay returns the wait before the given retry, retry 1 being the wait after the first failed try.
+func (p RetryPolicy) Delay(retry int) time.Duration {
+	if retry < 1 || p.Interval <= 0 {
+		return 0
+	}
+
+	delay := p.Interval
+	switch p.Backoff {
+	case RetryBackoffLinear:
+		delay = p.Interval * time.Duration(retry)
+	case RetryBackoffExponential, RetryBackoffExponentialJitter:
+		for i := 1; i < retry && (p.MaxInterval <= 0 || delay < p.MaxInterval); i++ {
+			delay *= 2
+		}
+	}
+
+	if p.MaxInterval > 0 && delay > p.MaxInterval {
+		delay = p.MaxInterval
+	}
+
+	if p.Backoff == RetryBackoffExponentialJitter && delay > 1 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	return delay
+}
+
+// Do calls fn until it succeeds, the attempts are used up, MaxElapsedTime passes or ctx is done.
+// The last error of fn is returned, or the context error when ctx ends first.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts {
+			return err
+		}
+
+		delay := p.Delay(attempt)
+		if p.MaxElapsedTime > 0 && time.Since(start)+delay > p.MaxElapsedTime {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
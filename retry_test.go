@@ -0,0 +1,211 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	redis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	t.Run("Constant", func(t *testing.T) {
+		policy := RetryPolicy{Interval: 100 * time.Millisecond}
+		assert.Equal(t, time.Duration(0), policy.Delay(0))
+		assert.Equal(t, 100*time.Millisecond, policy.Delay(1))
+		assert.Equal(t, 100*time.Millisecond, policy.Delay(5))
+	})
+
+	t.Run("Linear", func(t *testing.T) {
+		policy := RetryPolicy{Backoff: RetryBackoffLinear, Interval: 100 * time.Millisecond, MaxInterval: 250 * time.Millisecond}
+		assert.Equal(t, 100*time.Millisecond, policy.Delay(1))
+		assert.Equal(t, 200*time.Millisecond, policy.Delay(2))
+		assert.Equal(t, 250*time.Millisecond, policy.Delay(3))
+	})
+
+	t.Run("Exponential", func(t *testing.T) {
+		policy := RetryPolicy{Backoff: RetryBackoffExponential, Interval: 100 * time.Millisecond, MaxInterval: time.Second}
+		assert.Equal(t, 100*time.Millisecond, policy.Delay(1))
+		assert.Equal(t, 200*time.Millisecond, policy.Delay(2))
+		assert.Equal(t, 400*time.Millisecond, policy.Delay(3))
+		assert.Equal(t, time.Second, policy.Delay(10))
+		assert.Equal(t, time.Second, policy.Delay(1000))
+	})
+
+	t.Run("Exponential jitter", func(t *testing.T) {
+		policy := RetryPolicy{Backoff: RetryBackoffExponentialJitter, Interval: 100 * time.Millisecond}
+		for i := 0; i < 100; i++ {
+			delay := policy.Delay(3)
+			assert.True(t, delay >= 200*time.Millisecond && delay <= 400*time.Millisecond, delay)
+		}
+	})
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	errFail := errors.New("fail")
+
+	t.Run("Stops on success", func(t *testing.T) {
+		calls := 0
+		err := RetryPolicy{Attempts: 5, Interval: time.Millisecond}.Do(context.Background(), func() error {
+			if calls++; calls < 3 {
+				return errFail
+			}
+
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Returns last error after attempts", func(t *testing.T) {
+		calls := 0
+		err := RetryPolicy{Attempts: 3, Interval: time.Millisecond}.Do(context.Background(), func() error {
+			calls++
+			return errFail
+		})
+
+		assert.ErrorIs(t, err, errFail)
+		assert.Equal(t, 3, calls)
+
+		calls = 0
+		assert.ErrorIs(t, RetryPolicy{}.Do(context.Background(), func() error { calls++; return errFail }), errFail)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Max elapsed time", func(t *testing.T) {
+		calls := 0
+		start := time.Now()
+		err := RetryPolicy{Attempts: 100, Interval: 20 * time.Millisecond, MaxElapsedTime: 50 * time.Millisecond}.Do(context.Background(), func() error {
+			calls++
+			return errFail
+		})
+
+		assert.ErrorIs(t, err, errFail)
+		assert.Equal(t, 3, calls)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("Context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		err := RetryPolicy{Attempts: 5, Interval: time.Second}.Do(ctx, func() error { return errFail })
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestApplyRedisRetryPolicy(t *testing.T) {
+	options := &redis.UniversalOptions{}
+	applyRedisRetryPolicy(options, RetryPolicy{})
+	assert.Equal(t, 0, options.MaxRetries)
+	assert.Equal(t, time.Duration(0), options.MinRetryBackoff)
+
+	applyRedisRetryPolicy(options, RetryPolicy{Attempts: 1})
+	assert.Equal(t, -1, options.MaxRetries)
+
+	applyRedisRetryPolicy(options, RetryPolicy{Attempts: 4, Interval: 10 * time.Millisecond, MaxInterval: time.Second})
+	assert.Equal(t, 3, options.MaxRetries)
+	assert.Equal(t, 10*time.Millisecond, options.MinRetryBackoff)
+	assert.Equal(t, time.Second, options.MaxRetryBackoff)
+}
+
+func TestDatabaseOpRetryPolicy(t *testing.T) {
+	meta := secret.DatabaseMeta{Adapter: "mysql"}
+	meta.Params.Host = "127.0.0.1"
+	meta.Params.Port = 1
+	op := newDatabaseOp(meta)
+	assert.Equal(t, DefaultDatabaseRetryPolicy, op.RetryPolicy)
+
+	op.RetryPolicy = RetryPolicy{Attempts: 2, Interval: 50 * time.Millisecond}
+	start := time.Now()
+	assert.Nil(t, newDBPool(op))
+	elapsed := time.Since(start)
+	assert.True(t, elapsed >= 50*time.Millisecond && elapsed < time.Second, elapsed)
+}
+
+func TestCassandraOpRetryPolicy(t *testing.T) {
+	op := &CassandraOp{MaxRetryAttempt: 2, RetryPolicy: RetryPolicy{Interval: 20 * time.Millisecond}}
+	start := time.Now()
+	assert.True(t, op.Attempt(&testQuery{attempts: 1}))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.False(t, op.Attempt(&testQuery{attempts: 2}))
+	assert.Equal(t, DefaultCassandraRetryPolicy, configureCassandraOp(secret.CassandraMeta{Endpoints: []string{"127.0.0.1:9042"}}).RetryPolicy)
+}
+
+type idempotentTestQuery struct {
+	testQuery
+	idempotent bool
+}
+
+func (q *idempotentTestQuery) IsIdempotent() bool {
+	return q.idempotent
+}
+
+type cassandraTestRequestError struct {
+	code int
+}
+
+func (e cassandraTestRequestError) Code() int       { return e.code }
+func (e cassandraTestRequestError) Message() string { return "test" }
+func (e cassandraTestRequestError) Error() string   { return "test" }
+
+func TestCassandraOpRetryOptions(t *testing.T) {
+	t.Run("Attempts from policy", func(t *testing.T) {
+		op := &CassandraOp{RetryPolicy: RetryPolicy{Attempts: 3}}
+		assert.True(t, op.Attempt(&testQuery{attempts: 1}))
+		assert.False(t, op.Attempt(&testQuery{attempts: 2}))
+		assert.False(t, (&CassandraOp{}).Attempt(&testQuery{}))
+	})
+
+	t.Run("Idempotent only", func(t *testing.T) {
+		op := &CassandraOp{MaxRetryAttempt: 3, RetryIdempotentOnly: true}
+		assert.False(t, op.Attempt(&testQuery{attempts: 1}))
+		assert.False(t, op.Attempt(&idempotentTestQuery{testQuery: testQuery{attempts: 1}}))
+		assert.True(t, op.Attempt(&idempotentTestQuery{testQuery: testQuery{attempts: 1}, idempotent: true}))
+	})
+
+	t.Run("Downgrade consistency", func(t *testing.T) {
+		op := &CassandraOp{MaxRetryAttempt: 5, RetryDowngradeConsistency: parseCassandraConsistencies("local_one, bogus,ONE")}
+		assert.Equal(t, []gocql.Consistency{gocql.LocalOne, gocql.One}, op.RetryDowngradeConsistency)
+
+		query := &testQuery{attempts: 0, consistency: gocql.Quorum}
+		assert.True(t, op.Attempt(query))
+		assert.Equal(t, gocql.Quorum, query.consistency)
+		query.attempts = 1
+		assert.True(t, op.Attempt(query))
+		assert.Equal(t, gocql.LocalOne, query.consistency)
+		query.attempts = 3
+		assert.True(t, op.Attempt(query))
+		assert.Equal(t, gocql.One, query.consistency)
+	})
+
+	t.Run("Context ends backoff", func(t *testing.T) {
+		op := &CassandraOp{MaxRetryAttempt: 3, RetryPolicy: RetryPolicy{Interval: time.Minute}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.False(t, op.Attempt(&contextTestQuery{testQuery: testQuery{attempts: 1}, ctx: ctx}))
+	})
+
+	t.Run("Retry type", func(t *testing.T) {
+		op := &CassandraOp{}
+		assert.Equal(t, gocql.RetryNextHost, op.GetRetryType(errors.New("connection reset")))
+		assert.Equal(t, gocql.RetryNextHost, op.GetRetryType(cassandraTestRequestError{code: gocql.ErrCodeUnavailable}))
+		assert.Equal(t, gocql.Retry, op.GetRetryType(cassandraTestRequestError{code: gocql.ErrCodeReadTimeout}))
+		assert.Equal(t, gocql.Retry, op.GetRetryType(fmt.Errorf("wrapped: %w", cassandraTestRequestError{code: gocql.ErrCodeWriteTimeout})))
+		assert.Equal(t, gocql.Rethrow, op.GetRetryType(cassandraTestRequestError{code: gocql.ErrCodeSyntax}))
+	})
+}
+
+type contextTestQuery struct {
+	testQuery
+	ctx context.Context
+}
+
+func (q *contextTestQuery) Context() context.Context {
+	return q.ctx
+}
@@ -0,0 +1,576 @@
+package datastore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kklogger "github.com/yetiz-org/goth-kklogger"
+	"gorm.io/gorm"
+)
+
+var (
+	// DefaultSagaStateTTL is how long the state of a saga is kept in Redis after its last change
+	DefaultSagaStateTTL = 24 * time.Hour
+	// DefaultSagaLease is how long a run stays owned by its process without a heartbeat, renewed at a third of it
+	DefaultSagaLease = 30 * time.Second
+)
+
+func init() {
+	envMillis("GOTH_DEFAULT_SAGA_STATE_TTL", &DefaultSagaStateTTL)
+	envMillis("GOTH_DEFAULT_SAGA_LEASE", &DefaultSagaLease)
+}
+
+var (
+	// ErrSagaExists is returned by Saga.Run for an id already run
+	ErrSagaExists = errors.New("saga already exists")
+	// ErrSagaLeased is returned by Saga.Recover for a run owned by a process whose lease has not expired
+	ErrSagaLeased = errors.New("saga leased by another owner")
+	// ErrSagaLeaseLost is returned by Saga.Run and Saga.Recover when another process claimed the run, e.g. after
+	// the lease expired while Redis was unreachable. The run is left to that process
+	ErrSagaLeaseLost = errors.New("saga lease lost")
+)
+
+// sagaSaveScript replaces the state of a run only while it holds the state last stored by the owner.
+const sagaSaveScript = `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'EX', ARGV[3])
+return 1
+`
+
+// SagaStatus is the status of a run of a Saga.
+type SagaStatus string
+
+const (
+	// SagaRunning is a run whose steps are running, or which stopped before completing, see Saga.Recover
+	SagaRunning SagaStatus = "running"
+	// SagaCompleted is a run whose steps all succeeded
+	SagaCompleted SagaStatus = "completed"
+	// SagaCompensated is a run with a failed step whose completed steps were all compensated
+	SagaCompensated SagaStatus = "compensated"
+	// SagaFailed is a run with a failed step and a failed compensation, left partially applied
+	SagaFailed SagaStatus = "failed"
+)
+
+// SagaStep is a step of a Saga. Compensate undoes Action, it is nil for a step with nothing to undo.
+type SagaStep struct {
+	Name       string
+	Action     func(ctx context.Context) error
+	Compensate func(ctx context.Context) error
+}
+
+// SagaState is the state of a run of a Saga, stored as JSON in Redis.
+type SagaState struct {
+	ID     string     `json:"id"`
+	Saga   string     `json:"saga"`
+	Status SagaStatus `json:"status"`
+	// Completed are the steps whose action succeeded, in the order they ran
+	Completed []string `json:"completed,omitempty"`
+	// Compensated are the steps compensated, in the order they were
+	Compensated []string `json:"compensated,omitempty"`
+	// FailedStep is the step whose action failed
+	FailedStep string `json:"failed_step,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// CompensationErrors are the errors of the failed compensations by step
+	CompensationErrors map[string]string `json:"compensation_errors,omitempty"`
+	// Owner identifies the Run or Recover call which owns the run, until LeaseExpiry while it is in progress
+	Owner       string    `json:"owner,omitempty"`
+	LeaseExpiry time.Time `json:"lease_expiry"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Leased reports whether the run is owned by a process whose lease has not expired.
+func (s *SagaState) Leased() bool {
+	return time.Now().Before(s.LeaseExpiry)
+}
+
+// SagaError is the error of a run of a Saga with a failed step. Err is the error of the step, or the one
+// interrupting the run for Saga.Recover.
+type SagaError struct {
+	ID   string
+	Step string
+	Err  error
+	// Compensated are the steps compensated
+	Compensated []string
+	// CompensationErrors are the errors of the failed compensations by step, the run is partially applied
+	// when it is not empty
+	CompensationErrors map[string]error
+}
+
+func (e *SagaError) Error() string {
+	msg := fmt.Sprintf("saga %s step %s: %s", e.ID, e.Step, e.Err)
+	if len(e.CompensationErrors) > 0 {
+		steps := make([]string, 0, len(e.CompensationErrors))
+		for step := range e.CompensationErrors {
+			steps = append(steps, step)
+		}
+
+		sort.Strings(steps)
+		msg += fmt.Sprintf(", compensation of %s failed", strings.Join(steps, ", "))
+	}
+
+	return msg
+}
+
+func (e *SagaError) Unwrap() error {
+	return e.Err
+}
+
+// Partial reports whether a compensation failed, leaving the run partially applied.
+func (e *SagaError) Partial() bool {
+	return len(e.CompensationErrors) > 0
+}
+
+// Saga sequences steps across datastores, see NewSaga. The steps run in order, when one fails the steps completed
+// before it are compensated in reverse order. The state of each run is stored in Redis, updated after every step,
+// so a run interrupted by a crash can be compensated by Recover.
+//
+// A run is owned by the process running it, which renews a lease in the state while it runs. Recover claims
+// only runs whose lease expired, the state is changed only by its owner.
+//
+// Compensations must be safe to run again and to run for an action which did not complete: Recover compensates
+// the step running when the run stopped, its action may or may not have been applied.
+type Saga struct {
+	op    RedisOperator
+	name  string
+	steps []SagaStep
+	// TTL is how long the state of a run is kept after its last change, DefaultSagaStateTTL when created
+	TTL time.Duration
+	// Lease is how long a run stays owned without a heartbeat, DefaultSagaLease when created
+	Lease time.Duration
+}
+
+// NewSaga returns the saga name storing the state of its runs on op.
+func NewSaga(op RedisOperator, name string) *Saga {
+	return &Saga{op: op, name: name, TTL: DefaultSagaStateTTL, Lease: DefaultSagaLease}
+}
+
+// Name returns the name of the saga.
+func (s *Saga) Name() string {
+	return s.name
+}
+
+// Step appends the step name, unique in the saga, running action, undone by compensate, nil when there is nothing to undo.
+func (s *Saga) Step(name string, action, compensate func(ctx context.Context) error) *Saga {
+	s.steps = append(s.steps, SagaStep{Name: name, Action: action, Compensate: compensate})
+	return s
+}
+
+// DatabaseStep appends the step name running action in a transaction of database, undone by compensate in
+// another transaction, nil when there is nothing to undo. Both are retried as Database.WithTransaction does.
+func (s *Saga) DatabaseStep(name string, database *Database, action, compensate func(tx *gorm.DB) error) *Saga {
+	step := SagaStep{
+		Name: name,
+		Action: func(ctx context.Context) error {
+			return database.WithTransaction(ctx, action)
+		},
+	}
+
+	if compensate != nil {
+		step.Compensate = func(ctx context.Context) error {
+			return database.WithTransaction(ctx, compensate)
+		}
+	}
+
+	s.steps = append(s.steps, step)
+	return s
+}
+
+func (s *Saga) key(id string) string {
+	return "saga:" + s.name + ":" + id
+}
+
+// Run runs the steps as the run id, a random id when empty, and returns its final state. A failed step returns a
+// *SagaError once the completed steps are compensated. Run returns ErrSagaExists when id already ran, and
+// ErrSagaLeaseLost when another process claimed the run, which stops it without compensating.
+func (s *Saga) Run(ctx context.Context, id string) (*SagaState, error) {
+	if id == "" {
+		random, err := sagaRandomID()
+		if err != nil {
+			return nil, err
+		}
+
+		id = random
+	}
+
+	owner, err := sagaRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	state := &SagaState{ID: id, Saga: s.name, Status: SagaRunning, Owner: owner, LeaseExpiry: now.Add(s.Lease),
+		StartedAt: now, UpdatedAt: now}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := s.op.SetWithOptions(s.key(id), data, SetOptions{NX: true, EX: s.ttlSeconds()})
+	if IsNotFound(resp.Error) {
+		return nil, fmt.Errorf("%w: %s %s", ErrSagaExists, s.name, id)
+	}
+
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := s.own(state, data, cancel)
+	defer run.stop()
+	for _, step := range s.steps {
+		if err := s.action(ctx, step); err != nil {
+			if run.isLost() {
+				return state, run.lostErr()
+			}
+
+			// Compensations run even when the step failed because ctx is done
+			run.update(func(state *SagaState) {
+				state.FailedStep, state.Error = step.Name, err.Error()
+			}, false)
+			return state, s.compensate(context.WithoutCancel(ctx), run, state.Completed, err)
+		}
+
+		if err := run.update(func(state *SagaState) {
+			state.Completed = append(state.Completed, step.Name)
+		}, false); errors.Is(err, ErrSagaLeaseLost) {
+			return state, err
+		}
+	}
+
+	if err := run.update(func(state *SagaState) {
+		state.Status = SagaCompleted
+	}, true); errors.Is(err, ErrSagaLeaseLost) {
+		return state, err
+	}
+
+	return state, nil
+}
+
+// Recover compensates the run id left running, e.g. by a crash, including the step it was running, and returns
+// its final state. The run is compensated again when a compensation failed. Other runs are returned as is.
+// Recover claims the run first, it returns ErrSagaLeased when its lease has not expired or another process
+// claimed it concurrently.
+func (s *Saga) Recover(ctx context.Context, id string) (*SagaState, error) {
+	state, data, err := s.load(id)
+	if err != nil || state == nil {
+		return state, err
+	}
+
+	var steps []string
+	switch state.Status {
+	case SagaRunning:
+		// The step following the completed ones was running
+		steps = append([]string(nil), state.Completed...)
+		if len(steps) < len(s.steps) {
+			steps = append(steps, s.steps[len(steps)].Name)
+		}
+	case SagaFailed:
+		// Compensated steps are left out
+		done := map[string]bool{}
+		for _, step := range state.Compensated {
+			done[step] = true
+		}
+
+		for _, step := range state.Completed {
+			if !done[step] {
+				steps = append(steps, step)
+			}
+		}
+	default:
+		return state, nil
+	}
+
+	run, err := s.claim(state, data)
+	if err != nil {
+		return state, err
+	}
+
+	defer run.stop()
+	if state.Status == SagaRunning {
+		run.update(func(state *SagaState) {
+			if len(state.Completed) < len(s.steps) {
+				state.FailedStep = s.steps[len(state.Completed)].Name
+			}
+
+			state.Error = "saga interrupted"
+		}, false)
+	}
+
+	return state, s.compensate(ctx, run, steps, errors.New(state.Error))
+}
+
+// claim takes the run of state, stored as data, over once its lease expired.
+func (s *Saga) claim(state *SagaState, data []byte) (*sagaRun, error) {
+	if state.Leased() {
+		return nil, fmt.Errorf("%w: %s %s owned by %s", ErrSagaLeased, s.name, state.ID, state.Owner)
+	}
+
+	owner, err := sagaRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	run := &sagaRun{saga: s, state: state, data: data}
+	if err := run.update(func(state *SagaState) {
+		state.Owner = owner
+	}, false); err != nil {
+		if errors.Is(err, ErrSagaLeaseLost) {
+			return nil, fmt.Errorf("%w: %s %s claimed concurrently", ErrSagaLeased, s.name, state.ID)
+		}
+
+		return nil, err
+	}
+
+	run.heartbeat(func() {})
+	return run, nil
+}
+
+// own starts the heartbeat of the run of state, just stored as data, cancel is called when the lease is lost.
+func (s *Saga) own(state *SagaState, data []byte, cancel context.CancelFunc) *sagaRun {
+	run := &sagaRun{saga: s, state: state, data: data}
+	run.heartbeat(cancel)
+	return run
+}
+
+// compensate compensates steps in reverse order and returns the *SagaError of cause.
+func (s *Saga) compensate(ctx context.Context, run *sagaRun, completed []string, cause error) error {
+	steps := map[string]SagaStep{}
+	for _, step := range s.steps {
+		steps[step.Name] = step
+	}
+
+	state := run.state
+	sagaErr := &SagaError{ID: state.ID, Step: state.FailedStep, Err: cause}
+	run.update(func(state *SagaState) {
+		state.CompensationErrors = nil
+	}, false)
+	for i := len(completed) - 1; i >= 0; i-- {
+		if run.isLost() {
+			return run.lostErr()
+		}
+
+		step := steps[completed[i]]
+		if step.Compensate != nil {
+			if err := s.run(ctx, step.Compensate); err != nil {
+				kklogger.WarnJ("datastore:Saga.compensate", fmt.Sprintf("saga %s %s step %s: %s", s.name, state.ID, step.Name, err.Error()))
+				if sagaErr.CompensationErrors == nil {
+					sagaErr.CompensationErrors = map[string]error{}
+				}
+
+				sagaErr.CompensationErrors[step.Name] = err
+				run.update(func(state *SagaState) {
+					if state.CompensationErrors == nil {
+						state.CompensationErrors = map[string]string{}
+					}
+
+					state.CompensationErrors[step.Name] = err.Error()
+				}, false)
+				continue
+			}
+		}
+
+		run.update(func(state *SagaState) {
+			state.Compensated = append(state.Compensated, step.Name)
+		}, false)
+	}
+
+	if err := run.update(func(state *SagaState) {
+		state.Status = SagaCompensated
+		if sagaErr.Partial() {
+			state.Status = SagaFailed
+		}
+	}, true); errors.Is(err, ErrSagaLeaseLost) {
+		return err
+	}
+
+	sagaErr.Compensated = state.Compensated
+	return sagaErr
+}
+
+func (s *Saga) action(ctx context.Context, step SagaStep) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return s.run(ctx, step.Action)
+}
+
+func (s *Saga) run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("saga step panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+// sagaRun is a run owned by the process, its state is changed through update while the heartbeat renews the
+// lease.
+type sagaRun struct {
+	saga  *Saga
+	mutex sync.Mutex
+	state *SagaState
+	// data is the state last stored
+	data []byte
+	lost bool
+	done chan struct{}
+	wait sync.WaitGroup
+}
+
+// update applies fn to the state and stores it with a renewed lease, released when the run is over. A failure
+// to reach Redis is logged, the steps having already changed the datastores, ErrSagaLeaseLost is returned once
+// the state was changed by another process.
+func (r *sagaRun) update(fn func(state *SagaState), release bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.lost {
+		return r.lostErr()
+	}
+
+	if fn != nil {
+		fn(r.state)
+	}
+
+	now := time.Now()
+	r.state.UpdatedAt, r.state.LeaseExpiry = now, now.Add(r.saga.Lease)
+	if release {
+		r.state.LeaseExpiry = time.Time{}
+	}
+
+	data, err := json.Marshal(r.state)
+	if err == nil {
+		resp := r.saga.op.Eval(sagaSaveScript, []interface{}{r.saga.key(r.state.ID)},
+			[]interface{}{r.data, data, r.saga.ttlSeconds()})
+		if err = resp.Error; err == nil && resp.GetInt64() == 0 {
+			r.lost = true
+			kklogger.WarnJ("datastore:Saga.update", fmt.Sprintf("saga %s %s: lease lost", r.saga.name, r.state.ID))
+			return r.lostErr()
+		}
+	}
+
+	if err != nil {
+		kklogger.WarnJ("datastore:Saga.update", fmt.Sprintf("saga %s %s: %s", r.saga.name, r.state.ID, err.Error()))
+		return err
+	}
+
+	r.data = data
+	return nil
+}
+
+// heartbeat renews the lease at a third of it until stop, onLost is called when the lease is lost.
+func (r *sagaRun) heartbeat(onLost func()) {
+	r.done = make(chan struct{})
+	r.wait.Add(1)
+	go func() {
+		defer r.wait.Done()
+		ticker := time.NewTicker(max(r.saga.Lease/3, time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				if errors.Is(r.update(nil, false), ErrSagaLeaseLost) {
+					onLost()
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (r *sagaRun) stop() {
+	close(r.done)
+	r.wait.Wait()
+}
+
+func (r *sagaRun) isLost() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.lost
+}
+
+func (r *sagaRun) lostErr() error {
+	return fmt.Errorf("%w: %s %s", ErrSagaLeaseLost, r.saga.name, r.state.ID)
+}
+
+func sagaRandomID() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(random), nil
+}
+
+func (s *Saga) ttlSeconds() int64 {
+	return max(int64(s.TTL/time.Second), 1)
+}
+
+// State returns the state of the run id, nil when it is unknown or expired.
+func (s *Saga) State(id string) (*SagaState, error) {
+	state, _, err := s.load(id)
+	return state, err
+}
+
+// load returns the state of the run id and its JSON as stored.
+func (s *Saga) load(id string) (*SagaState, []byte, error) {
+	resp := s.op.Get(s.key(id))
+	if IsNotFound(resp.Error) {
+		return nil, nil, nil
+	}
+
+	if resp.Error != nil {
+		return nil, nil, resp.Error
+	}
+
+	state := &SagaState{}
+	if err := json.Unmarshal(resp.GetBytes(), state); err != nil {
+		return nil, nil, err
+	}
+
+	return state, resp.GetBytes(), nil
+}
+
+// Running returns the ids of the runs left running whose lease expired, to Recover those stopped, e.g. on
+// startup. The runs still owned by a live process are left out.
+func (s *Saga) Running(ctx context.Context) ([]string, error) {
+	prefix := s.key("")
+	var ids []string
+	for cursor := int64(0); ; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err := s.op.ScanTyped(cursor, prefix+"*", 100)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Items() {
+			id := strings.TrimPrefix(item.GetString(), prefix)
+			if state, err := s.State(id); err != nil {
+				return nil, err
+			} else if state != nil && state.Status == SagaRunning && !state.Leased() {
+				ids = append(ids, id)
+			}
+		}
+
+		if cursor = result.Cursor(); result.Done() {
+			return ids, nil
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	secret "github.com/yetiz-org/goth-datastore/secrets"
+	"gorm.io/gorm"
+)
+
+func TestSaga(t *testing.T) {
+	newSaga := func(op RedisOperator, calls *[]string, fail map[string]error) *Saga {
+		step := func(name string) func(ctx context.Context) error {
+			return func(ctx context.Context) error {
+				*calls = append(*calls, name)
+				return fail[name]
+			}
+		}
+
+		return NewSaga(op, "test_saga").
+			Step("reserve", step("reserve"), step("release")).
+			Step("notify", step("notify"), nil).
+			Step("charge", step("charge"), step("refund"))
+	}
+
+	check := func(t *testing.T, op RedisOperator) {
+		var calls []string
+		saga := newSaga(op, &calls, nil)
+		assert.Equal(t, "test_saga", saga.Name())
+		state, err := saga.Run(context.Background(), "completed")
+		assert.NoError(t, err)
+		assert.Equal(t, SagaCompleted, state.Status)
+		assert.Equal(t, []string{"reserve", "notify", "charge"}, calls)
+		stored, err := saga.State("completed")
+		assert.NoError(t, err)
+		assert.Equal(t, SagaCompleted, stored.Status)
+		assert.Equal(t, []string{"reserve", "notify", "charge"}, stored.Completed)
+		_, err = saga.Run(context.Background(), "completed")
+		assert.ErrorIs(t, err, ErrSagaExists)
+
+		// A failed step compensates the completed ones in reverse order
+		calls = nil
+		declined := errors.New("card declined")
+		saga = newSaga(op, &calls, map[string]error{"charge": declined})
+		state, err = saga.Run(context.Background(), "compensated")
+		assert.ErrorIs(t, err, declined)
+		var sagaErr *SagaError
+		assert.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, "charge", sagaErr.Step)
+		assert.False(t, sagaErr.Partial())
+		assert.Equal(t, []string{"notify", "reserve"}, sagaErr.Compensated)
+		assert.Equal(t, []string{"reserve", "notify", "charge", "release"}, calls)
+		assert.Equal(t, SagaCompensated, state.Status)
+		stored, err = saga.State("compensated")
+		assert.NoError(t, err)
+		assert.Equal(t, SagaCompensated, stored.Status)
+		assert.Equal(t, "charge", stored.FailedStep)
+		assert.Equal(t, "card declined", stored.Error)
+
+		// A failed compensation leaves the run partially applied until recovered
+		calls = nil
+		fail := map[string]error{"charge": declined, "release": errors.New("inventory unavailable")}
+		saga = newSaga(op, &calls, fail)
+		_, err = saga.Run(context.Background(), "failed")
+		assert.ErrorAs(t, err, &sagaErr)
+		assert.True(t, sagaErr.Partial())
+		assert.EqualError(t, err, "saga failed step charge: card declined, compensation of reserve failed")
+		stored, err = saga.State("failed")
+		assert.NoError(t, err)
+		assert.Equal(t, SagaFailed, stored.Status)
+		assert.Equal(t, map[string]string{"reserve": "inventory unavailable"}, stored.CompensationErrors)
+
+		calls = nil
+		delete(fail, "release")
+		state, err = saga.Recover(context.Background(), "failed")
+		assert.ErrorAs(t, err, &sagaErr)
+		assert.False(t, sagaErr.Partial())
+		assert.Equal(t, []string{"release"}, calls)
+		assert.Equal(t, SagaCompensated, state.Status)
+		assert.Equal(t, []string{"notify", "reserve"}, state.Compensated)
+
+		// A run left running by a crash is compensated with the step it was running
+		calls = nil
+		op.Set("saga:test_saga:crashed", `{"id":"crashed","saga":"test_saga","status":"running","completed":["reserve"]}`)
+		ids, err := saga.Running(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"crashed"}, ids)
+		state, err = saga.Recover(context.Background(), "crashed")
+		assert.ErrorAs(t, err, &sagaErr)
+		assert.Equal(t, "notify", sagaErr.Step)
+		assert.Equal(t, []string{"release"}, calls)
+		assert.Equal(t, SagaCompensated, state.Status)
+		ids, err = saga.Running(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+
+		// A run owned by a live process is left to it
+		leased := fmt.Sprintf(`{"id":"leased","saga":"test_saga","status":"running","owner":"other","lease_expiry":%q}`,
+			time.Now().Add(time.Hour).Format(time.RFC3339Nano))
+		op.Set("saga:test_saga:leased", leased)
+		ids, err = saga.Running(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+		_, err = saga.Recover(context.Background(), "leased")
+		assert.ErrorIs(t, err, ErrSagaLeased)
+		assert.Equal(t, leased, op.Get("saga:test_saga:leased").GetString())
+
+		// The heartbeat keeps a run owned while a step runs longer than the lease
+		calls = nil
+		saga = newSaga(op, &calls, nil)
+		saga.Lease = 60 * time.Millisecond
+		saga.Step("slow", func(ctx context.Context) error {
+			time.Sleep(150 * time.Millisecond)
+			_, err := saga.Recover(ctx, "heartbeat")
+			assert.ErrorIs(t, err, ErrSagaLeased)
+			return nil
+		}, nil)
+		state, err = saga.Run(context.Background(), "heartbeat")
+		assert.NoError(t, err)
+		assert.Equal(t, SagaCompleted, state.Status)
+		assert.True(t, state.LeaseExpiry.IsZero())
+		assert.Equal(t, []string{"reserve", "notify", "charge"}, calls)
+
+		// A run claimed by another process stops without compensating
+		calls = nil
+		saga = NewSaga(op, "test_saga").Step("reserve", func(ctx context.Context) error {
+			calls = append(calls, "reserve")
+			return op.Set("saga:test_saga:claimed", `{"id":"claimed","status":"running","owner":"other"}`).Error
+		}, func(ctx context.Context) error {
+			calls = append(calls, "release")
+			return nil
+		}).Step("charge", func(ctx context.Context) error {
+			calls = append(calls, "charge")
+			return nil
+		}, nil)
+		_, err = saga.Run(context.Background(), "claimed")
+		assert.ErrorIs(t, err, ErrSagaLeaseLost)
+		assert.Equal(t, []string{"reserve"}, calls)
+		stored, err = saga.State("claimed")
+		assert.NoError(t, err)
+		assert.Equal(t, "other", stored.Owner)
+
+		state, err = saga.Recover(context.Background(), "completed")
+		assert.NoError(t, err)
+		assert.Equal(t, SagaCompleted, state.Status)
+		state, err = saga.Recover(context.Background(), "missing")
+		assert.NoError(t, err)
+		assert.Nil(t, state)
+
+		op.Delete("saga:test_saga:completed", "saga:test_saga:compensated", "saga:test_saga:failed", "saga:test_saga:crashed",
+			"saga:test_saga:leased", "saga:test_saga:heartbeat", "saga:test_saga:claimed")
+	}
+
+	t.Run("Mock", func(t *testing.T) {
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		mockSagaScripts(op)
+		check(t, op)
+
+		// A panicking step fails, the run id is random when empty
+		var calls []string
+		state, err := NewSaga(op, "test_saga").
+			Step("reserve", func(ctx context.Context) error { return nil }, func(ctx context.Context) error {
+				calls = append(calls, "release")
+				return nil
+			}).
+			Step("charge", func(ctx context.Context) error { panic("boom") }, nil).
+			Run(context.Background(), "")
+		assert.ErrorContains(t, err, "saga step panic: boom")
+		assert.Len(t, state.ID, 32)
+		assert.Equal(t, []string{"release"}, calls)
+		assert.True(t, op.TTL("saga:test_saga:"+state.ID).GetInt64() > 0)
+	})
+
+	t.Run("Database", func(t *testing.T) {
+		database := &Database{writer: &DatabaseOp{meta: secret.DatabaseMeta{Adapter: "sqlite"}}}
+		db := database.Writer().DB()
+		assert.NoError(t, db.AutoMigrate(&databaseCRUDRecord{}))
+		op := NewMockRedisOp()
+		op.EnableStatefulMode()
+		mockSagaScripts(op)
+
+		record := &databaseCRUDRecord{Name: "saga"}
+		_, err := NewSaga(op, "test_saga").
+			DatabaseStep("create", database, func(tx *gorm.DB) error {
+				return tx.Create(record).Error
+			}, func(tx *gorm.DB) error {
+				return tx.Delete(record).Error
+			}).
+			Step("cache", func(ctx context.Context) error {
+				return op.Do("INCR", "saga:test_saga:counter", "invalid").Error
+			}, nil).
+			Run(context.Background(), "database")
+
+		assert.Error(t, err)
+		var count int64
+		assert.NoError(t, db.Model(&databaseCRUDRecord{}).Where("name = ?", "saga").Count(&count).Error)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("Server", func(t *testing.T) {
+		originalPath := secret.Path()
+		defer func() {
+			secret.PATH = originalPath
+		}()
+
+		wd, _ := os.Getwd()
+		secret.PATH = filepath.Join(wd, "example")
+		redis := NewRedis("test")
+		assert.NotNil(t, redis)
+		defer redis.Close()
+		check(t, redis.Master())
+	})
+}
+
+// mockSagaScripts simulates the scripts of Saga on a stateful mock.
+func mockSagaScripts(op *MockRedisOp) {
+	var mutex sync.Mutex
+	op.SetScript(sagaSaveScript, func(keys []string, args []string) (interface{}, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if op.Get(keys[0]).GetString() != args[0] {
+			return int64(0), nil
+		}
+
+		ttl, _ := strconv.ParseInt(args[2], 10, 64)
+		return int64(1), op.SetExpire(keys[0], args[1], ttl).Error
+	})
+}
@@ -13,4 +13,28 @@ type CassandraMeta struct {
 	Username  string   `json:"username"`
 	Password  string   `json:"password"`
 	CaPath    string   `json:"ca_path"`
+	// CertPath and KeyPath locate the client certificate for clusters requiring mutual TLS
+	CertPath string `json:"cert_path"`
+	KeyPath  string `json:"key_path"`
+	// SSL enables TLS with the system roots when no CaPath is given
+	SSL                    bool `json:"ssl"`
+	EnableHostVerification bool `json:"enable_host_verification"`
+	// Consistency and SerialConsistency are level names like "QUORUM" or "LOCAL_SERIAL",
+	// timeouts are in milliseconds. Unset values keep the operator defaults.
+	Consistency       string `json:"consistency"`
+	SerialConsistency string `json:"serial_consistency"`
+	PageSize          int    `json:"page_size"`
+	Timeout           int    `json:"timeout"`
+	ConnectTimeout    int    `json:"connect_timeout"`
+	// LocalDC routes queries to hosts of this data center first, LocalDCOnly never connects to other ones
+	LocalDC     string `json:"local_dc"`
+	LocalDCOnly bool   `json:"local_dc_only"`
+	// TokenAware sends queries to replicas of their partition, ShuffleReplicas spreads them over the replicas
+	TokenAware      bool `json:"token_aware"`
+	ShuffleReplicas bool `json:"shuffle_replicas"`
+}
+
+// TLSEnabled reports whether connections to the cluster use TLS.
+func (m CassandraMeta) TLSEnabled() bool {
+	return m.SSL || m.CaPath != "" || m.CertPath != "" || m.KeyPath != ""
 }
@@ -4,6 +4,8 @@ type Database struct {
 	DefaultSecret
 	Writer DatabaseMeta `json:"writer"`
 	Reader DatabaseMeta `json:"reader"`
+	// Readers lists read replicas balanced by Database.Reader(), taking precedence over Reader when set
+	Readers []DatabaseMeta `json:"readers"`
 }
 
 type DatabaseMeta struct {
@@ -15,5 +17,28 @@ type DatabaseMeta struct {
 		DBName   string `json:"dbname"`
 		Username string `json:"username"`
 		Password string `json:"password"`
+		// Socket is the path of the unix socket of a MySQL server, used instead of Host and Port when set
+		Socket string `json:"socket"`
 	} `json:"params"`
+	TLS DatabaseTLS `json:"tls"`
+}
+
+// DatabaseTLS configures TLS for the MySQL adapter. PEM content takes precedence over the matching file path.
+type DatabaseTLS struct {
+	// Mode is the driver tls parameter, true, false, skip-verify or preferred.
+	// Certificates below register a custom config instead, an empty Mode then defaults to true. In preferred mode
+	// the custom config is not verified and a server without TLS is used in plaintext, like the driver's preferred.
+	Mode       string `json:"mode"`
+	CA         string `json:"ca"`
+	CAFile     string `json:"ca_file"`
+	Cert       string `json:"cert"`
+	CertFile   string `json:"cert_file"`
+	Key        string `json:"key"`
+	KeyFile    string `json:"key_file"`
+	ServerName string `json:"server_name"`
+}
+
+// Custom reports whether certificates are configured, requiring a registered TLS config.
+func (t DatabaseTLS) Custom() bool {
+	return t.CA != "" || t.CAFile != "" || t.Cert != "" || t.CertFile != "" || t.Key != "" || t.KeyFile != ""
 }
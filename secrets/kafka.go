@@ -0,0 +1,41 @@
+package secrets
+
+type Kafka struct {
+	DefaultSecret
+	// Driver names the registered Kafka driver, the package default when empty
+	Driver   string    `json:"driver"`
+	Producer KafkaMeta `json:"producer"`
+	// Consumer defaults its connection settings to Producer when it has no brokers
+	Consumer KafkaMeta `json:"consumer"`
+}
+
+type KafkaMeta struct {
+	Brokers  []string `json:"brokers"`
+	ClientID string   `json:"client_id"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, PLAIN when a username is set and it is empty
+	SASLMechanism string `json:"sasl_mechanism"`
+	TLS           bool   `json:"tls"`
+	CAFile        string `json:"ca_file"`
+	// Acks is all, one or none, Compression is gzip, snappy, lz4 or zstd, BatchTimeout is in milliseconds
+	Acks         string `json:"acks"`
+	Compression  string `json:"compression"`
+	BatchSize    int    `json:"batch_size"`
+	BatchTimeout int    `json:"batch_timeout"`
+	// StartOffset is earliest or latest, where a consumer group without committed offsets starts
+	StartOffset string `json:"start_offset"`
+}
+
+// Normalize defaults the Consumer connection settings to the Producer ones when it is not configured.
+func (p *Kafka) Normalize() {
+	if len(p.Consumer.Brokers) == 0 {
+		p.Consumer.Brokers = p.Producer.Brokers
+		p.Consumer.ClientID = p.Producer.ClientID
+		p.Consumer.Username = p.Producer.Username
+		p.Consumer.Password = p.Producer.Password
+		p.Consumer.SASLMechanism = p.Producer.SASLMechanism
+		p.Consumer.TLS = p.Producer.TLS
+		p.Consumer.CAFile = p.Producer.CAFile
+	}
+}
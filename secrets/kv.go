@@ -0,0 +1,13 @@
+package secrets
+
+type KV struct {
+	DefaultSecret
+	// Address is the scheme://host:port of the Consul HTTP API, like http://127.0.0.1:8500
+	Address    string `json:"address"`
+	Token      string `json:"token"`
+	Datacenter string `json:"datacenter"`
+	// Prefix is prepended to every key, so services can share one cluster without colliding
+	Prefix string `json:"prefix"`
+	// Timeout is the request timeout in milliseconds, the package default when 0
+	Timeout int `json:"timeout"`
+}
@@ -0,0 +1,23 @@
+package secrets
+
+type Memcached struct {
+	DefaultSecret
+	Master MemcachedMeta `json:"master"`
+	// Slave serves reads, it defaults to Master when it has no servers
+	Slave MemcachedMeta `json:"slave"`
+	// Timeout is the socket read/write timeout in milliseconds, the package default when 0
+	Timeout      int `json:"timeout"`
+	MaxIdleConns int `json:"max_idle_conns"`
+}
+
+type MemcachedMeta struct {
+	// Servers are host:port addresses or unix socket paths, keys are spread over them by consistent hashing
+	Servers []string `json:"servers"`
+}
+
+// Normalize defaults Slave to Master when it is not configured.
+func (p *Memcached) Normalize() {
+	if len(p.Slave.Servers) == 0 {
+		p.Slave = p.Master
+	}
+}
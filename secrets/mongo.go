@@ -0,0 +1,35 @@
+package secrets
+
+type Mongo struct {
+	DefaultSecret
+	Primary MongoMeta `json:"primary"`
+	// Secondary serves reads, it defaults to Primary with the secondaryPreferred read preference
+	Secondary MongoMeta `json:"secondary"`
+}
+
+type MongoMeta struct {
+	// URI is a mongodb:// or mongodb+srv:// connection string, Hosts and the credentials below are then ignored
+	URI        string   `json:"uri"`
+	Hosts      []string `json:"hosts"`
+	Database   string   `json:"database"`
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	AuthSource string   `json:"auth_source"`
+	ReplicaSet string   `json:"replica_set"`
+	// ReadPreference is primary, primaryPreferred, secondary, secondaryPreferred or nearest
+	ReadPreference string `json:"read_preference"`
+	TLS            bool   `json:"tls"`
+	CAFile         string `json:"ca_file"`
+}
+
+// Normalize defaults Secondary to Primary reading from secondaries when it is not configured.
+func (p *Mongo) Normalize() {
+	if p.Secondary.URI == "" && len(p.Secondary.Hosts) == 0 {
+		readPreference := p.Secondary.ReadPreference
+		p.Secondary = p.Primary
+		p.Secondary.ReadPreference = readPreference
+		if p.Secondary.ReadPreference == "" {
+			p.Secondary.ReadPreference = "secondaryPreferred"
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package secrets
+
+type ObjectStore struct {
+	DefaultSecret
+	// Endpoint is the host[:port] of the S3 compatible service, like s3.amazonaws.com or minio:9000
+	Endpoint     string `json:"endpoint"`
+	Region       string `json:"region"`
+	Bucket       string `json:"bucket"`
+	AccessKey    string `json:"access_key"`
+	SecretKey    string `json:"secret_key"`
+	SessionToken string `json:"session_token"`
+	UseSSL       bool   `json:"use_ssl"`
+	// PathStyle addresses buckets as endpoint/bucket instead of bucket.endpoint, as most self hosted services need
+	PathStyle bool `json:"path_style"`
+}
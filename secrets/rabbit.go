@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"fmt"
+	"net/url"
+)
+
+type Rabbit struct {
+	DefaultSecret
+	// URL is the amqp:// or amqps:// connection URL, it takes precedence over the separate connection fields
+	URL      string `json:"url"`
+	Host     string `json:"host"`
+	Port     uint   `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// VHost is the virtual host, the default "/" when empty
+	VHost string `json:"vhost"`
+	TLS   bool   `json:"tls"`
+	// Prefetch is the number of unacknowledged deliveries of a consumer, the package default when 0
+	Prefetch int `json:"prefetch"`
+}
+
+// ConnectionURL returns URL, or the amqp URL built from the separate connection fields when it is empty.
+func (p *Rabbit) ConnectionURL() string {
+	if p.URL != "" {
+		return p.URL
+	}
+
+	scheme, port := "amqp", p.Port
+	if p.TLS {
+		scheme = "amqps"
+	}
+
+	if port == 0 {
+		port = 5672
+		if p.TLS {
+			port = 5671
+		}
+	}
+
+	u := url.URL{Scheme: scheme, Host: fmt.Sprintf("%s:%d", p.Host, port)}
+	if p.VHost != "" && p.VHost != "/" {
+		u.Path = "/" + p.VHost
+	}
+
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+
+	return u.String()
+}
@@ -20,11 +20,57 @@ type Redis struct {
 	Master   RedisMeta          `json:"master"`
 	Slave    RedisMeta          `json:"slave"`
 	Cluster  RedisClusterSecret `json:"cluster"`
+	// TestOnBorrowIdle pings a pooled connection before reuse when it has been idle longer than this many milliseconds (0 disables)
+	TestOnBorrowIdle int `json:"test_on_borrow_idle"`
+	// Codec names the serialization of the typed helpers, e.g. "msgpack", DefaultRedisCodec when empty
+	Codec string `json:"codec"`
+	// Encryption enables the encryption of the values written by the typed helpers when it has keys
+	Encryption RedisEncryption `json:"encryption"`
+	// AllowCommands limits the commands sent to the ones listed, e.g. "GET" or "CONFIG|GET", every command when empty
+	AllowCommands []string `json:"allow_commands"`
+	// DenyCommands rejects the commands listed, e.g. "FLUSHALL", "FLUSHDB" and "KEYS" in production
+	DenyCommands []string `json:"deny_commands"`
+	// SlaveWritable allows write commands through the slave operator, which rejects them by default
+	SlaveWritable bool `json:"slave_writable"`
+	// MaxValueSize rejects command arguments longer than this many bytes, DefaultRedisMaxValueSize when 0
+	MaxValueSize int `json:"max_value_size"`
+	// KeyForbiddenChars rejects keys containing one of these characters, DefaultRedisKeyForbiddenChars when empty
+	KeyForbiddenChars string `json:"key_forbidden_chars"`
+	// ReadTimeout bounds the wait for a reply in milliseconds, DefaultRedisReadTimeout when 0
+	ReadTimeout int `json:"read_timeout"`
+	// WriteTimeout bounds the write of a command in milliseconds, DefaultRedisWriteTimeout when 0
+	WriteTimeout int `json:"write_timeout"`
+	// CommandTimeouts are the read timeouts of commands in milliseconds by name, e.g. {"EVAL": 10000, "GET": 200}
+	CommandTimeouts map[string]int `json:"command_timeouts"`
+}
+
+type RedisEncryption struct {
+	// Keys are the base64 encoded AES keys by id, 16, 24 or 32 bytes long
+	Keys map[string]string `json:"keys"`
+	// Current is the id of the key encrypting new values, the others only decrypt
+	Current string `json:"current"`
+	// Patterns limits encryption to the keys matching one of these path.Match patterns, empty encrypts every key
+	Patterns []string `json:"patterns"`
 }
 
 type RedisMeta struct {
 	Host string `json:"host"`
 	Port uint   `json:"port"`
+	// Socket is the path of a unix socket, e.g. of a co-located sidecar, used instead of Host and Port when set
+	Socket string `json:"socket"`
+}
+
+// Addr returns the socket path when set, host:port otherwise.
+func (m RedisMeta) Addr() string {
+	if m.Socket != "" {
+		return m.Socket
+	}
+
+	return fmt.Sprintf("%s:%d", m.Host, m.Port)
+}
+
+func (m RedisMeta) empty() bool {
+	return m.Host == "" && m.Socket == ""
 }
 
 type RedisClusterSecret struct {
@@ -54,7 +100,7 @@ func (p *Redis) Normalize() {
 	if p.Mode == "" {
 		if len(p.Cluster.Addrs) > 0 {
 			p.Mode = RedisModeCluster
-		} else if p.Master.Host != "" && p.Slave.Host != "" && !sameRedisMeta(p.Master, p.Slave) {
+		} else if !p.Master.empty() && !p.Slave.empty() && !sameRedisMeta(p.Master, p.Slave) {
 			p.Mode = RedisModeReplication
 		} else {
 			p.Mode = RedisModeSingle
@@ -66,7 +112,7 @@ func (p *Redis) Normalize() {
 		return
 	}
 
-	if p.Slave.Host == "" {
+	if p.Slave.empty() {
 		p.Slave = p.Master
 	}
 }
@@ -75,20 +121,20 @@ func (p *Redis) MasterAddrs() []string {
 	if p.Mode == RedisModeCluster {
 		return append([]string(nil), p.Cluster.Addrs...)
 	}
-	if p.Master.Host == "" {
+	if p.Master.empty() {
 		return nil
 	}
-	return []string{fmt.Sprintf("%s:%d", p.Master.Host, p.Master.Port)}
+	return []string{p.Master.Addr()}
 }
 
 func (p *Redis) SlaveAddrs() []string {
 	if p.Mode == RedisModeCluster {
 		return append([]string(nil), p.Cluster.Addrs...)
 	}
-	if p.Slave.Host == "" {
+	if p.Slave.empty() {
 		return nil
 	}
-	return []string{fmt.Sprintf("%s:%d", p.Slave.Host, p.Slave.Port)}
+	return []string{p.Slave.Addr()}
 }
 
 func normalizeRedisAddrs(addrs []string) []string {
@@ -104,5 +150,6 @@ func normalizeRedisAddrs(addrs []string) []string {
 }
 
 func sameRedisMeta(a, b RedisMeta) bool {
-	return strings.TrimSpace(a.Host) == strings.TrimSpace(b.Host) && a.Port == b.Port
+	return strings.TrimSpace(a.Host) == strings.TrimSpace(b.Host) && a.Port == b.Port &&
+		strings.TrimSpace(a.Socket) == strings.TrimSpace(b.Socket)
 }
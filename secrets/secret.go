@@ -2,6 +2,7 @@ package secrets
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -11,6 +12,9 @@ import (
 
 var PATH = ""
 
+// ErrLoad is wrapped by the errors of Load, with the type and name of the secret.
+var ErrLoad = errors.New("secret load failed")
+
 func Path() string {
 	if PATH == "" {
 		return os.Getenv("GOTH_SECRET_PATH")
@@ -63,6 +67,14 @@ func Load(typ string, name string, secret Secret) error {
 }
 
 func LoadWithFS(typ string, name string, secret Secret, fs FileSystem) error {
+	if err := loadWithFS(typ, name, secret, fs); err != nil {
+		return fmt.Errorf("%w: %s-%s: %w", ErrLoad, typ, name, err)
+	}
+
+	return nil
+}
+
+func loadWithFS(typ string, name string, secret Secret, fs FileSystem) error {
 	if fs == nil {
 		fs = defaultFS
 	}